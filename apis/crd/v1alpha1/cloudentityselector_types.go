@@ -18,6 +18,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// SelectorAnnotationConfirmVMCount confirms the inventory of a CloudEntitySelector held by the selector match spike
+// threshold of its account, for up to the given number of VMs.
+const SelectorAnnotationConfirmVMCount = "cloud.antrea.io/confirm-vm-count"
+
 // EntityMatch specifies match conditions to cloud entities.
 // Cloud entities must satisfy all fields(ANDed) in EntityMatch to satisfy EntityMatch.
 type EntityMatch struct {
@@ -27,6 +31,52 @@ type EntityMatch struct {
 	MatchID string `json:"matchID,omitempty"`
 }
 
+// TagMatch specifies match conditions to a cloud entity tag.
+type TagMatch struct {
+	// Key is the tag key to match.
+	Key string `json:"key"`
+	// Value matches the tag value. If not specified, cloud entities having the tag Key with any value are matched.
+	Value string `json:"value,omitempty"`
+}
+
+// NetworkSecurityGroupMatch specifies match conditions to the network security groups associated with the network
+// interfaces of a VirtualMachine or their subnets.
+type NetworkSecurityGroupMatch struct {
+	// MatchID matches VirtualMachines associated with the network security group of this cloud assigned ID.
+	MatchID string `json:"matchID,omitempty"`
+	// MatchNone matches VirtualMachines not associated with any network security group.
+	// MatchNone and MatchID are mutually exclusive.
+	MatchNone bool `json:"matchNone,omitempty"`
+}
+
+// ExtensionMatch specifies match conditions to the extensions, e.g. monitoring agents, installed on a VirtualMachine.
+type ExtensionMatch struct {
+	// MatchName matches VirtualMachines having the extension of this name, e.g. AzureMonitorLinuxAgent,
+	// case-insensitively.
+	MatchName string `json:"matchName"`
+	// MatchMissing inverts the match to VirtualMachines not having the extension of MatchName.
+	MatchMissing bool `json:"matchMissing,omitempty"`
+}
+
+// DataDiskMatch specifies match conditions to the data disks attached to a VirtualMachine. VirtualMachines must
+// satisfy all configured fields(ANDed), VirtualMachines without data disks have a count and total size of 0.
+type DataDiskMatch struct {
+	// MinCount matches VirtualMachines with at least this number of attached data disks.
+	MinCount uint32 `json:"minCount,omitempty"`
+	// MinTotalSizeGB matches VirtualMachines whose attached data disks add up to at least this size in GB.
+	MinTotalSizeGB uint32 `json:"minTotalSizeGB,omitempty"`
+}
+
+// BootIntegrityMatch specifies match conditions to the trusted launch security settings of a VirtualMachine.
+// VirtualMachines must satisfy all configured fields(ANDed). Generation 1 VirtualMachines, which do not report these
+// settings, are considered as having Secure Boot and vTPM disabled.
+type BootIntegrityMatch struct {
+	// SecureBootEnabled matches VirtualMachines with Secure Boot enabled when true, or disabled when false.
+	SecureBootEnabled *bool `json:"secureBootEnabled,omitempty"`
+	// VTPMEnabled matches VirtualMachines with vTPM enabled when true, or disabled when false.
+	VTPMEnabled *bool `json:"vTPMEnabled,omitempty"`
+}
+
 // VirtualMachineSelector specifies VirtualMachine match criteria.
 // VirtualMachines must satisfy all fields(ANDed) in a VirtualMachineSelector in order to satisfy match.
 type VirtualMachineSelector struct {
@@ -38,8 +88,63 @@ type VirtualMachineSelector struct {
 	// It is an array, match satisfying any item on VMMatch is selected(ORed).
 	// If it is not specified, all VirtualMachines matching VpcMatch are selected.
 	VMMatch []EntityMatch `json:"vmMatch,omitempty"`
+	// SubnetMatch specifies the subnet, by MatchID, to which network interfaces of VirtualMachines belong. Only network
+	// interfaces in the subnet are discovered. SubnetMatch is ANDed with all other matches. Only supported for Azure.
+	SubnetMatch *EntityMatch `json:"subnetMatch,omitempty"`
 	// Agented specifies if VM runs in agented mode, default is false.
 	Agented bool `json:"agented,omitempty"`
+	// TagMatch specifies tags of VirtualMachines to match.
+	// It is an array, VirtualMachines must satisfy all items(ANDed) on TagMatch, and TagMatch is ANDed with
+	// VpcMatch and VMMatch. Only supported for Azure.
+	TagMatch []TagMatch `json:"tagMatch,omitempty"`
+	// HasPublicIP specifies if only VirtualMachines having a public IP associated with any of their network
+	// interfaces are matched. HasPublicIP is ANDed with VpcMatch, VMMatch and TagMatch. Only supported for Azure.
+	HasPublicIP bool `json:"hasPublicIP,omitempty"`
+	// NsgMatch specifies the network security group association of VirtualMachines to match. NsgMatch is ANDed with
+	// VpcMatch, VMMatch, TagMatch and HasPublicIP. Only supported for Azure.
+	NsgMatch *NetworkSecurityGroupMatch `json:"nsgMatch,omitempty"`
+	// SizeMatch matches the size of VirtualMachines, e.g. Standard_D4s_v3, case-insensitively. Glob patterns are
+	// supported, '*' matches any sequence of characters and '?' matches any single character, e.g. Standard_D*.
+	// SizeMatch is ANDed with all other matches. Only supported for Azure.
+	SizeMatch string `json:"sizeMatch,omitempty"`
+	// ProvisionedOnly specifies if only provisioned VirtualMachines, in the Succeeded or Updating provisioning state,
+	// are matched, excluding VirtualMachines being created or deleted and those that failed provisioning.
+	// ProvisionedOnly is ANDed with all other matches. Only supported for Azure.
+	ProvisionedOnly bool `json:"provisionedOnly,omitempty"`
+	// ExtensionMatch specifies an extension VirtualMachines must have, or must not have, installed to match.
+	// ExtensionMatch is ANDed with all other matches. Only supported for Azure.
+	ExtensionMatch *ExtensionMatch `json:"extensionMatch,omitempty"`
+	// OSFamilyMatch matches the operating system family of VirtualMachines, linux or windows, regardless of their
+	// image. OSFamilyMatch is ANDed with all other matches.
+	// +kubebuilder:validation:Enum=linux;windows
+	OSFamilyMatch string `json:"osFamilyMatch,omitempty"`
+	// ModifiedWithinSeconds specifies if only VirtualMachines modified within the given number of seconds are matched,
+	// e.g. 3600 for VirtualMachines changed in the last hour. The window is evaluated at every inventory poll, and
+	// VirtualMachines whose last modification time is not reported by cloud are not matched. ModifiedWithinSeconds is
+	// ANDed with all other matches. Only supported for Azure.
+	// +kubebuilder:validation:Minimum=1
+	ModifiedWithinSeconds uint32 `json:"modifiedWithinSeconds,omitempty"`
+	// EncryptionAtHostOnly specifies if only VirtualMachines with encryption at host enabled are matched.
+	// VirtualMachines without the setting are considered as having encryption at host disabled. EncryptionAtHostOnly
+	// is ANDed with all other matches. Only supported for Azure.
+	EncryptionAtHostOnly bool `json:"encryptionAtHostOnly,omitempty"`
+	// ExcludeLocked specifies if the security of VirtualMachines under an Azure management lock, on the
+	// VirtualMachine, its resource group or subscription, or on its network interfaces or network security groups, is
+	// not modified. Such VirtualMachines are still matched and imported, but their network interfaces are neither
+	// attached to nor detached from security groups. Only supported for Azure.
+	ExcludeLocked bool `json:"excludeLocked,omitempty"`
+	// DataDiskMatch specifies the data disks VirtualMachines must have attached to match, e.g. to select VirtualMachines
+	// with large attached storage. DataDiskMatch is ANDed with all other matches. Only supported for Azure.
+	DataDiskMatch *DataDiskMatch `json:"dataDiskMatch,omitempty"`
+	// BootIntegrityMatch specifies the Secure Boot and vTPM status of VirtualMachines to match, e.g. to find
+	// VirtualMachines without Secure Boot. BootIntegrityMatch is ANDed with all other matches. Only supported for Azure.
+	BootIntegrityMatch *BootIntegrityMatch `json:"bootIntegrityMatch,omitempty"`
+	// CustomQueryFilter is an advanced Azure Resource Graph KQL predicate on the virtualmachines resources, appended
+	// to the generated query as a where clause, e.g. properties.storageProfile.osDisk.osType =~ 'Linux'. Pipes,
+	// statement separators and comments are not allowed. CustomQueryFilter is ANDed with all other matches. Only
+	// supported for Azure.
+	// +kubebuilder:validation:MaxLength=1024
+	CustomQueryFilter string `json:"customQueryFilter,omitempty"`
 }
 
 // CloudEntitySelectorSpec defines the desired state of CloudEntitySelector.
@@ -58,8 +163,28 @@ type CloudEntitySelectorSpec struct {
 type CloudEntitySelectorStatus struct {
 	// Error is current error, if any, of the CloudEntitySelector.
 	Error string `json:"error,omitempty"`
+	// Conditions are the current conditions of the CloudEntitySelector.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LastConfirmedVMCount is the number of VMs matched by the CloudEntitySelector at the last inventory poll not
+	// holding its inventory. It is the base number of VMs a spike is detected against after a controller restart.
+	LastConfirmedVMCount *int `json:"lastConfirmedVMCount,omitempty"`
+	// LastConfirmedVMIDs are the sorted lower case cloud IDs of the VMs matched by the CloudEntitySelector at the last
+	// inventory poll not holding its inventory. They are the VMs kept while its inventory is held after a controller
+	// restart.
+	LastConfirmedVMIDs []string `json:"lastConfirmedVMIDs,omitempty"`
 }
 
+// CloudEntitySelector condition types and reasons.
+const (
+	// SelectorConditionAccountFound is true when the CloudProviderAccount referenced by the selector exists. A false
+	// condition reports a stale selector, whose account was deleted or never created.
+	SelectorConditionAccountFound = "AccountFound"
+	// SelectorReasonAccountFound is the reason of a true AccountFound condition.
+	SelectorReasonAccountFound = "AccountFound"
+	// SelectorReasonAccountNotFound is the reason of a false AccountFound condition.
+	SelectorReasonAccountNotFound = "AccountNotFound"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:shortName="ces"
 // +kubebuilder:subresource:status
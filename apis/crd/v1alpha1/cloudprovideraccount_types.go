@@ -25,6 +25,34 @@ const (
 	DefaultPollIntervalInSeconds = 60
 )
 
+// Well-known annotations of CloudProviderAccount honored by cloud plugins when the account is added or updated.
+const (
+	// AccountAnnotationDetachPolicy specifies the SecurityGroupDetachPolicy of an Azure account, when DetachPolicy is not
+	// set in the account config.
+	AccountAnnotationDetachPolicy = "cloud.antrea.io/detach-policy"
+	// AccountAnnotationInventoryTombstonePolls overrides the controller wide number of consecutive inventory polls a VM
+	// must be absent from before it is removed from the inventory of the account.
+	AccountAnnotationInventoryTombstonePolls = "cloud.antrea.io/inventory-tombstone-polls"
+	// AccountAnnotationMaxInventoryVMs caps the number of VMs cached in the inventory of the account, VMs not attached
+	// to Nephe security groups are evicted first.
+	AccountAnnotationMaxInventoryVMs = "cloud.antrea.io/max-inventory-vms"
+	// AccountAnnotationInventoryConsistencyRetries specifies how many times the inventory query of a selector is retried
+	// when VMs it selects by ID are absent from the results, e.g. not yet indexed by Azure Resource Graph after creation.
+	AccountAnnotationInventoryConsistencyRetries = "cloud.antrea.io/inventory-consistency-retries"
+	// AccountAnnotationInventoryFields specifies the comma separated optional VM fields queried from Azure Resource
+	// Graph, all optional fields are queried when not set.
+	AccountAnnotationInventoryFields = "cloud.antrea.io/inventory-fields"
+	// AccountAnnotationDenyRulePlacement specifies the DenyRulePlacement of the default deny rules of an Azure account.
+	AccountAnnotationDenyRulePlacement = "cloud.antrea.io/deny-rule-placement"
+	// AccountAnnotationSelectorMatchSpikeThreshold specifies by how many VMs the number of VMs matched by a
+	// CloudEntitySelector may grow between inventory polls. The inventory of a selector growing beyond it is held at
+	// its previous VMs until the new number of VMs is confirmed with the SelectorAnnotationConfirmVMCount annotation.
+	AccountAnnotationSelectorMatchSpikeThreshold = "cloud.antrea.io/selector-match-spike-threshold"
+	// AccountAnnotationPeerAddressSpaceFallback specifies whether security groups of peered Azure vnets not visible to
+	// the account are resolved to the remote address space of the peering, they are left out of rules otherwise.
+	AccountAnnotationPeerAddressSpaceFallback = "cloud.antrea.io/peer-address-space-fallback"
+)
+
 // CloudProviderAccountSpec defines the desired state of CloudProviderAccount.
 type CloudProviderAccountSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster.
@@ -36,20 +64,100 @@ type CloudProviderAccountSpec struct {
 	AWSConfig *CloudProviderAccountAWSConfig `json:"awsConfig,omitempty"`
 	// Cloud provider account config.
 	AzureConfig *CloudProviderAccountAzureConfig `json:"azureConfig,omitempty"`
+	// AllowedSelectorNamespaces are the namespaces of CloudEntitySelectors served by the account. Selectors of any
+	// namespace are served, if not specified.
+	AllowedSelectorNamespaces []string `json:"allowedSelectorNamespaces,omitempty"`
+	// Paused suspends inventory polling and security operations of the account, while retaining its config and
+	// cached inventory.
+	Paused bool `json:"paused,omitempty"`
 }
 
 type CloudProviderAccountAWSConfig struct {
 	// Reference to k8s secret which has cloud provider credentials.
 	SecretRef *SecretReference `json:"secretRef,omitempty"`
+	// References to k8s secrets tried in order when SecretRef is missing or invalid.
+	FallbackSecretRefs []SecretReference `json:"fallbackSecretRefs,omitempty"`
 	// Cloud provider account region.
 	Region []string `json:"region"`
 	// Endpoint URL that overrides the default AWS generated endpoint.
 	Endpoint string `json:"endpoint,omitempty"`
+	// Proxy used for AWS API calls of the account.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+	// EgressAllowCIDRs are CIDRs, e.g. of management networks, always allowed egress from every appliedTo group of
+	// the account regardless of network policies.
+	EgressAllowCIDRs []string `json:"egressAllowCIDRs,omitempty"`
 }
 
 type CloudProviderAccountAzureConfig struct {
 	SecretRef *SecretReference `json:"secretRef,omitempty"`
-	Region    []string         `json:"region"`
+	// References to k8s secrets tried in order when SecretRef is missing or invalid.
+	FallbackSecretRefs []SecretReference `json:"fallbackSecretRefs,omitempty"`
+	Region             []string          `json:"region"`
+	// DetachPolicy specifies the security behavior of a VM once it is no longer a member of any appliedTo
+	// group (default value is MoveToDefault, if not specified).
+	// +kubebuilder:validation:Enum=MoveToDefault;LeaveUnattached
+	DetachPolicy SecurityGroupDetachPolicy `json:"detachPolicy,omitempty"`
+	// EgressAllowCIDRs are CIDRs, e.g. of management networks, always allowed egress from every appliedTo group of
+	// the account regardless of network policies.
+	EgressAllowCIDRs []string `json:"egressAllowCIDRs,omitempty"`
+	// Proxy used for Azure API calls of the account.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+	// FallbackEndpoints are Azure Resource Manager endpoints, e.g. https://management.azure.com, tried in order for
+	// inventory queries when the default endpoint is unreachable.
+	FallbackEndpoints []string `json:"fallbackEndpoints,omitempty"`
+}
+
+// ProxyConfig is the HTTP(S) proxy cloud API calls of an account go through.
+type ProxyConfig struct {
+	// URL of the proxy, e.g. http://proxy.example.com:3128.
+	URL string `json:"url"`
+	// NoProxy are hosts, domains, IP addresses or CIDRs reached without the proxy.
+	NoProxy []string `json:"noProxy,omitempty"`
+}
+
+// SecurityGroupDetachPolicy specifies the security behavior of a VM once it is no longer a member of any appliedTo group.
+type SecurityGroupDetachPolicy string
+
+const (
+	// SecurityGroupDetachPolicyMoveToDefault moves the VM to the cloud default security. For Azure, the network security
+	// group created by nephe is disassociated from the network interface.
+	SecurityGroupDetachPolicyMoveToDefault SecurityGroupDetachPolicy = "MoveToDefault"
+	// SecurityGroupDetachPolicyLeaveUnattached only removes the VM from the nephe appliedTo groups. For Azure, the
+	// network security group created by nephe stays associated with the network interface, despite the policy name,
+	// hence its rules not specific to an appliedTo group, e.g. default deny rules, keep applying to the VM.
+	SecurityGroupDetachPolicyLeaveUnattached SecurityGroupDetachPolicy = "LeaveUnattached"
+)
+
+// DenyRulePlacement specifies the priority of the default deny rules added by nephe to a network security group.
+type DenyRulePlacement string
+
+const (
+	// DenyRulePlacementPriorityFloor places the default deny rules at the lowest priority of the nephe priority range,
+	// so that any rule added with a higher priority takes effect.
+	DenyRulePlacementPriorityFloor DenyRulePlacement = "PriorityFloor"
+	// DenyRulePlacementAfterAllowRules places the default deny rules immediately after the nephe allow rules.
+	DenyRulePlacementAfterAllowRules DenyRulePlacement = "AfterAllowRules"
+)
+
+// GetSecretRefs returns SecretRef followed by FallbackSecretRefs.
+func (c *CloudProviderAccountAWSConfig) GetSecretRefs() []*SecretReference {
+	return getSecretRefs(c.SecretRef, c.FallbackSecretRefs)
+}
+
+// GetSecretRefs returns SecretRef followed by FallbackSecretRefs.
+func (c *CloudProviderAccountAzureConfig) GetSecretRefs() []*SecretReference {
+	return getSecretRefs(c.SecretRef, c.FallbackSecretRefs)
+}
+
+func getSecretRefs(secretRef *SecretReference, fallbackSecretRefs []SecretReference) []*SecretReference {
+	var secretRefs []*SecretReference
+	if secretRef != nil {
+		secretRefs = append(secretRefs, secretRef)
+	}
+	for i := range fallbackSecretRefs {
+		secretRefs = append(secretRefs, &fallbackSecretRefs[i])
+	}
+	return secretRefs
 }
 
 // SecretReference is a reference to a k8s secret resource in an arbitrary namespace.
@@ -85,6 +193,80 @@ type CloudProviderAccountStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	// Error is current error, if any, of the CloudProviderAccount.
 	Error string `json:"error,omitempty"`
+	// APIQuotas is the remaining cloud API quota last reported by the cloud provider, if any.
+	APIQuotas []CloudAPIQuota `json:"apiQuotas,omitempty"`
+	// SubscriptionID is the Azure subscription ID resolved from the account credentials, redacted to its last 4
+	// characters.
+	SubscriptionID string `json:"subscriptionID,omitempty"`
+	// TenantID is the Azure tenant ID resolved from the account credentials, redacted to its last 4 characters.
+	TenantID string `json:"tenantID,omitempty"`
+	// UnresolvedVpcPeers are the IDs of VPCs peered with the VPCs of the account, which could not be resolved, including
+	// peers not visible to the account whose address space is not used as a fallback. Rules referencing them do not
+	// cover their CIDRs.
+	UnresolvedVpcPeers []string `json:"unresolvedVpcPeers,omitempty"`
+	// HeldSelectors are the CloudEntitySelectors whose inventory is held, as the number of VMs they match grew beyond
+	// the selector match spike threshold of the account.
+	HeldSelectors []string `json:"heldSelectors,omitempty"`
+	// Conditions are the current conditions of the CloudProviderAccount.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// CloudProviderAccount condition types and reasons.
+const (
+	// AccountConditionSecretAvailable is true when a Secret referenced by the account exists and carries the
+	// referenced key.
+	AccountConditionSecretAvailable = "SecretAvailable"
+	// AccountReasonSecretFound is the reason of a true SecretAvailable condition.
+	AccountReasonSecretFound = "SecretFound"
+	// AccountReasonSecretNotFound is the reason of a false SecretAvailable condition, and of a false CredentialsValid
+	// condition when no credentials could be read.
+	AccountReasonSecretNotFound = "SecretNotFound"
+	// AccountConditionCredentialsValid is true when the cloud plugin accepted the credentials of the account, and is
+	// false when they could not be read or the cloud rejected them.
+	AccountConditionCredentialsValid = "CredentialsValid"
+	// AccountReasonCredentialsAccepted is the reason of a true CredentialsValid condition.
+	AccountReasonCredentialsAccepted = "CredentialsAccepted"
+	// AccountReasonCredentialsRejected is the reason of a false CredentialsValid condition when the cloud plugin or the
+	// cloud rejected the credentials.
+	AccountReasonCredentialsRejected = "CredentialsRejected"
+	// AccountConditionConnected is true when the last inventory poll of the account reached the cloud.
+	AccountConditionConnected = "Connected"
+	// AccountReasonInventoryPollSucceeded is the reason of a true Connected condition.
+	AccountReasonInventoryPollSucceeded = "InventoryPollSucceeded"
+	// AccountReasonInventoryPollFailed is the reason of a false Connected condition.
+	AccountReasonInventoryPollFailed = "InventoryPollFailed"
+	// AccountConditionInventoryReady is true once an inventory poll of the account succeeded.
+	AccountConditionInventoryReady = "InventoryReady"
+	// AccountReasonInventoryInitialized is the reason of a true InventoryReady condition.
+	AccountReasonInventoryInitialized = "InventoryInitialized"
+	// AccountReasonInventoryNotInitialized is the reason of a false InventoryReady condition.
+	AccountReasonInventoryNotInitialized = "InventoryNotInitialized"
+	// AccountConditionInventoryPermitted is true when the credentials of the account are permitted to read the cloud
+	// inventory, as probed at account add.
+	AccountConditionInventoryPermitted = "InventoryPermitted"
+	// AccountConditionSecurityPermitted is true when the credentials of the account are permitted to program security
+	// rules in cloud, as probed at account add. The account is read-only when it is false.
+	AccountConditionSecurityPermitted = "SecurityPermitted"
+	// AccountReasonPermissionsGranted is the reason of a true InventoryPermitted or SecurityPermitted condition.
+	AccountReasonPermissionsGranted = "PermissionsGranted"
+	// AccountReasonPermissionsMissing is the reason of a false InventoryPermitted or SecurityPermitted condition.
+	AccountReasonPermissionsMissing = "PermissionsMissing"
+	// AccountReasonPermissionProbeFailed is the reason of an unknown InventoryPermitted or SecurityPermitted condition.
+	AccountReasonPermissionProbeFailed = "PermissionProbeFailed"
+	// AccountConditionPaused is true when inventory polling and security operations of the account are suspended.
+	AccountConditionPaused = "Paused"
+	// AccountReasonPauseRequested is the reason of a true Paused condition.
+	AccountReasonPauseRequested = "PauseRequested"
+	// AccountReasonActive is the reason of a false Paused condition.
+	AccountReasonActive = "Active"
+)
+
+// CloudAPIQuota is the remaining quota of a cloud API rate limit.
+type CloudAPIQuota struct {
+	// Name of the quota, e.g. subscription-reads.
+	Name string `json:"name"`
+	// Remaining is the number of requests allowed before the cloud provider throttles the account.
+	Remaining int64 `json:"remaining"`
 }
 
 // +kubebuilder:object:root=true
@@ -20,6 +20,7 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -53,13 +54,53 @@ func (in *AzureAccountCredential) DeepCopy() *AzureAccountCredential {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BootIntegrityMatch) DeepCopyInto(out *BootIntegrityMatch) {
+	*out = *in
+	if in.SecureBootEnabled != nil {
+		in, out := &in.SecureBootEnabled, &out.SecureBootEnabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.VTPMEnabled != nil {
+		in, out := &in.VTPMEnabled, &out.VTPMEnabled
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootIntegrityMatch.
+func (in *BootIntegrityMatch) DeepCopy() *BootIntegrityMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(BootIntegrityMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudAPIQuota) DeepCopyInto(out *CloudAPIQuota) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudAPIQuota.
+func (in *CloudAPIQuota) DeepCopy() *CloudAPIQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudAPIQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudEntitySelector) DeepCopyInto(out *CloudEntitySelector) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudEntitySelector.
@@ -137,6 +178,23 @@ func (in *CloudEntitySelectorSpec) DeepCopy() *CloudEntitySelectorSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudEntitySelectorStatus) DeepCopyInto(out *CloudEntitySelectorStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastConfirmedVMCount != nil {
+		in, out := &in.LastConfirmedVMCount, &out.LastConfirmedVMCount
+		*out = new(int)
+		**out = **in
+	}
+	if in.LastConfirmedVMIDs != nil {
+		in, out := &in.LastConfirmedVMIDs, &out.LastConfirmedVMIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudEntitySelectorStatus.
@@ -155,7 +213,7 @@ func (in *CloudProviderAccount) DeepCopyInto(out *CloudProviderAccount) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderAccount.
@@ -184,11 +242,26 @@ func (in *CloudProviderAccountAWSConfig) DeepCopyInto(out *CloudProviderAccountA
 		*out = new(SecretReference)
 		**out = **in
 	}
+	if in.FallbackSecretRefs != nil {
+		in, out := &in.FallbackSecretRefs, &out.FallbackSecretRefs
+		*out = make([]SecretReference, len(*in))
+		copy(*out, *in)
+	}
 	if in.Region != nil {
 		in, out := &in.Region, &out.Region
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(ProxyConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EgressAllowCIDRs != nil {
+		in, out := &in.EgressAllowCIDRs, &out.EgressAllowCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderAccountAWSConfig.
@@ -209,11 +282,31 @@ func (in *CloudProviderAccountAzureConfig) DeepCopyInto(out *CloudProviderAccoun
 		*out = new(SecretReference)
 		**out = **in
 	}
+	if in.FallbackSecretRefs != nil {
+		in, out := &in.FallbackSecretRefs, &out.FallbackSecretRefs
+		*out = make([]SecretReference, len(*in))
+		copy(*out, *in)
+	}
 	if in.Region != nil {
 		in, out := &in.Region, &out.Region
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.EgressAllowCIDRs != nil {
+		in, out := &in.EgressAllowCIDRs, &out.EgressAllowCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(ProxyConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FallbackEndpoints != nil {
+		in, out := &in.FallbackEndpoints, &out.FallbackEndpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderAccountAzureConfig.
@@ -276,6 +369,11 @@ func (in *CloudProviderAccountSpec) DeepCopyInto(out *CloudProviderAccountSpec)
 		*out = new(CloudProviderAccountAzureConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.AllowedSelectorNamespaces != nil {
+		in, out := &in.AllowedSelectorNamespaces, &out.AllowedSelectorNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderAccountSpec.
@@ -291,6 +389,28 @@ func (in *CloudProviderAccountSpec) DeepCopy() *CloudProviderAccountSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudProviderAccountStatus) DeepCopyInto(out *CloudProviderAccountStatus) {
 	*out = *in
+	if in.APIQuotas != nil {
+		in, out := &in.APIQuotas, &out.APIQuotas
+		*out = make([]CloudAPIQuota, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnresolvedVpcPeers != nil {
+		in, out := &in.UnresolvedVpcPeers, &out.UnresolvedVpcPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HeldSelectors != nil {
+		in, out := &in.HeldSelectors, &out.HeldSelectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderAccountStatus.
@@ -303,6 +423,21 @@ func (in *CloudProviderAccountStatus) DeepCopy() *CloudProviderAccountStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataDiskMatch) DeepCopyInto(out *DataDiskMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataDiskMatch.
+func (in *DataDiskMatch) DeepCopy() *DataDiskMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(DataDiskMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EntityMatch) DeepCopyInto(out *EntityMatch) {
 	*out = *in
@@ -318,6 +453,56 @@ func (in *EntityMatch) DeepCopy() *EntityMatch {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtensionMatch) DeepCopyInto(out *ExtensionMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtensionMatch.
+func (in *ExtensionMatch) DeepCopy() *ExtensionMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtensionMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkSecurityGroupMatch) DeepCopyInto(out *NetworkSecurityGroupMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSecurityGroupMatch.
+func (in *NetworkSecurityGroupMatch) DeepCopy() *NetworkSecurityGroupMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkSecurityGroupMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyConfig) DeepCopyInto(out *ProxyConfig) {
+	*out = *in
+	if in.NoProxy != nil {
+		in, out := &in.NoProxy, &out.NoProxy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyConfig.
+func (in *ProxyConfig) DeepCopy() *ProxyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretReference) DeepCopyInto(out *SecretReference) {
 	*out = *in
@@ -333,6 +518,21 @@ func (in *SecretReference) DeepCopy() *SecretReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TagMatch) DeepCopyInto(out *TagMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagMatch.
+func (in *TagMatch) DeepCopy() *TagMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(TagMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualMachineSelector) DeepCopyInto(out *VirtualMachineSelector) {
 	*out = *in
@@ -346,6 +546,36 @@ func (in *VirtualMachineSelector) DeepCopyInto(out *VirtualMachineSelector) {
 		*out = make([]EntityMatch, len(*in))
 		copy(*out, *in)
 	}
+	if in.SubnetMatch != nil {
+		in, out := &in.SubnetMatch, &out.SubnetMatch
+		*out = new(EntityMatch)
+		**out = **in
+	}
+	if in.TagMatch != nil {
+		in, out := &in.TagMatch, &out.TagMatch
+		*out = make([]TagMatch, len(*in))
+		copy(*out, *in)
+	}
+	if in.NsgMatch != nil {
+		in, out := &in.NsgMatch, &out.NsgMatch
+		*out = new(NetworkSecurityGroupMatch)
+		**out = **in
+	}
+	if in.ExtensionMatch != nil {
+		in, out := &in.ExtensionMatch, &out.ExtensionMatch
+		*out = new(ExtensionMatch)
+		**out = **in
+	}
+	if in.DataDiskMatch != nil {
+		in, out := &in.DataDiskMatch, &out.DataDiskMatch
+		*out = new(DataDiskMatch)
+		**out = **in
+	}
+	if in.BootIntegrityMatch != nil {
+		in, out := &in.BootIntegrityMatch, &out.BootIntegrityMatch
+		*out = new(BootIntegrityMatch)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineSelector.
@@ -41,6 +41,16 @@ const (
 	AWSCloudProvider CloudProvider = "AWS"
 )
 
+// OSFamily is the normalized operating system family of a VirtualMachine.
+type OSFamily string
+
+const (
+	// OSFamilyLinux specifies Linux VMs.
+	OSFamilyLinux OSFamily = "linux"
+	// OSFamilyWindows specifies Windows VMs.
+	OSFamilyWindows OSFamily = "windows"
+)
+
 const (
 	Running      VMState = "running"
 	Stopped      VMState = "stopped"
@@ -72,6 +82,8 @@ func (this VMState) String() string {
 type IPAddress struct {
 	AddressType AddressType `json:"addressType"`
 	Address     string      `json:"address"`
+	// Primary is true for the primary private IP of the network interface.
+	Primary bool `json:"primary,omitempty"`
 }
 
 // NetworkInterface contains information pertaining to NetworkInterface.
@@ -106,6 +118,45 @@ type VirtualMachineStatus struct {
 	CloudVpcId string `json:"cloudVpcId,omitempty"`
 	// CloudVpcName is the VPC Name this VirtualMachine belongs to.
 	CloudVpcName string `json:"cloudVpcName,omitempty"`
+	// CreatedAt is the cloud reported creation time of the VM, if available.
+	CreatedAt *metav1.Time `json:"createdAt,omitempty"`
+	// Extensions are the lowercase names of the extensions installed on the VM, e.g. azuremonitorlinuxagent. Only
+	// populated for Azure.
+	Extensions []string `json:"extensions,omitempty"`
+	// LastModifiedAt is the cloud reported last modification time of the VM, if available. Only populated for Azure.
+	LastModifiedAt *metav1.Time `json:"lastModifiedAt,omitempty"`
+	// HasPublicIP is true if a public IP is associated with any of the NetworkInterfaces of the VM.
+	HasPublicIP bool `json:"hasPublicIP,omitempty"`
+	// EncryptionAtHost is true if encryption at host is enabled on the VM. Only populated for Azure.
+	EncryptionAtHost bool `json:"encryptionAtHost,omitempty"`
+	// DataDiskCount is the number of data disks attached to the VM. Only populated for Azure.
+	DataDiskCount int32 `json:"dataDiskCount,omitempty"`
+	// DataDiskSizeGB is the total size in GB of the data disks attached to the VM. Only populated for Azure.
+	DataDiskSizeGB int32 `json:"dataDiskSizeGB,omitempty"`
+	// SecureBootEnabled is true if Secure Boot is enabled on the VM. Only populated for Azure.
+	SecureBootEnabled bool `json:"secureBootEnabled,omitempty"`
+	// VTPMEnabled is true if vTPM is enabled on the VM. Only populated for Azure.
+	VTPMEnabled bool `json:"vTPMEnabled,omitempty"`
+	// Locked is true if a management lock applies to the VM, or to its network interfaces or network security groups.
+	// Only populated for Azure.
+	Locked bool `json:"locked,omitempty"`
+	// ScaleSetId is the cloud assigned ID of the scale set the VM is an instance of, empty for a standalone VM. Only
+	// populated for Azure.
+	ScaleSetId string `json:"scaleSetId,omitempty"`
+	// EnforcementUnsupported is true if network policies are not enforced on the VM. Instances of uniform scale sets
+	// are not enforced, since their network interfaces are managed by the model of their scale set. Only populated
+	// for Azure.
+	EnforcementUnsupported bool `json:"enforcementUnsupported,omitempty"`
+	// NetworkSecurityGroups are the cloud assigned IDs of the network security groups associated with the
+	// NetworkInterfaces of the VM or their subnets. Only populated for Azure.
+	NetworkSecurityGroups []string `json:"networkSecurityGroups,omitempty"`
+	// OSFamily is the operating system family of the VM, derived from the Azure OS disk type or the AWS platform.
+	OSFamily OSFamily `json:"osFamily,omitempty"`
+	// ProvisioningState is the cloud reported provisioning state of the VM, e.g. Succeeded, Creating or Failed. Only
+	// populated for Azure.
+	ProvisioningState string `json:"provisioningState,omitempty"`
+	// Size is the cloud reported instance size of the VM, e.g. Standard_D4s_v3 in Azure or t3.micro in AWS.
+	Size string `json:"size,omitempty"`
 }
 
 type VirtualMachineSpec struct {
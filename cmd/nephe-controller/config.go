@@ -14,10 +14,13 @@
 
 package main
 
+import "time"
+
 const (
 	electionID                = "nephe-controller-election.cloud.antrea.io"
 	defaultLeaderElectionFlag = false
 	defaultMetricsAddress     = ":8080"
 	defaultDebugLogFlag       = false
 	defaultCertDir            = "/var/run/nephe/nephe-controller-tls"
+	securityShutdownTimeout   = time.Second * 30
 )
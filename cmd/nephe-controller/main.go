@@ -16,7 +16,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -30,7 +33,10 @@ import (
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/accountmanager"
 	"antrea.io/nephe/pkg/apiserver"
+	"antrea.io/nephe/pkg/apiserver/changenotification"
+	"antrea.io/nephe/pkg/apiserver/inventoryquery"
 	nephewebhook "antrea.io/nephe/pkg/apiserver/webhook"
+	"antrea.io/nephe/pkg/cloudprovider/cloud"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/controllers/cloudentityselector"
 	"antrea.io/nephe/pkg/controllers/cloudprovideraccount"
@@ -38,6 +44,7 @@ import (
 	"antrea.io/nephe/pkg/controllers/sync"
 	"antrea.io/nephe/pkg/controllers/virtualmachine"
 	"antrea.io/nephe/pkg/inventory"
+	"antrea.io/nephe/pkg/labels"
 	"antrea.io/nephe/pkg/logging"
 	"antrea.io/nephe/pkg/util/k8s/crd"
 	// +kubebuilder:scaffold:imports
@@ -63,6 +70,12 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var enableDebugLog bool
+	var inventoryQueryAddr string
+	var inventoryQueryTokenFile string
+	var inventoryQueryCertDir string
+	var changeNotificationAddr string
+	var changeNotificationTokenFile string
+	var changeNotificationCertDir string
 
 	opts := newOptions()
 	flag.StringVar(&opts.configFile, "config", opts.configFile, "The path to the configuration file.")
@@ -72,6 +85,19 @@ func main() {
 			"Enabling this will ensure there is only one active nephe-controller manager.")
 	flag.BoolVar(&enableDebugLog, "enable-debug-log", defaultDebugLogFlag,
 		"Enable debug mode for nephe-controller manager. Enabling this will add debug logs")
+	flag.StringVar(&inventoryQueryAddr, "inventory-query-addr", "",
+		"The address the read-only inventory query API binds to. The API is disabled when empty.")
+	flag.StringVar(&inventoryQueryTokenFile, "inventory-query-token-file", "",
+		"The path to the file holding the bearer token required by the inventory query API.")
+	flag.StringVar(&inventoryQueryCertDir, "inventory-query-cert-dir", defaultCertDir,
+		"The directory holding the tls.crt and tls.key files the inventory query API is served with.")
+	flag.StringVar(&changeNotificationAddr, "change-notification-addr", "",
+		"The address cloud change notifications of security groups are received on. Notifications are disabled when empty.")
+	flag.StringVar(&changeNotificationTokenFile, "change-notification-token-file", "",
+		"The path to the file holding the bearer token required by cloud change notifications.")
+	flag.StringVar(&changeNotificationCertDir, "change-notification-cert-dir", "",
+		"The directory holding the tls.crt and tls.key files cloud change notifications are received with, "+
+			"a certificate trusted by the cloud other than the webhook certificate.")
 	flag.Parse()
 
 	logging.SetDebugLog(enableDebugLog)
@@ -84,6 +110,14 @@ func main() {
 
 	setupLog.Info("Nephe ConfigMap", "ControllerConfig", opts.config)
 	cloudresource.SetCloudResourcePrefix(opts.config.CloudResourcePrefix)
+	cloudresource.SetInventoryTombstonePolls(opts.config.InventoryTombstonePolls)
+	cloudresource.SetInventoryPollTimeout(opts.config.InventoryPollTimeout)
+	cloudresource.SetCoalesceInventoryQueries(opts.config.CoalesceInventoryQueries)
+	cloudresource.SetInventorySnapshotHistory(opts.config.InventorySnapshotHistory)
+	cloudresource.SetMaxRuleAddressPrefixes(opts.config.MaxRuleAddressPrefixes)
+	cloudresource.SetStatelessRuleEnforcement(opts.config.StatelessRuleEnforcement)
+	labels.SetTagLabelKeys(opts.config.TagLabels)
+	labels.SetValueTruncationStrategy(labels.TruncationStrategy(opts.config.LabelTruncationStrategy))
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
@@ -133,6 +167,8 @@ func main() {
 		Scheme:            mgr.GetScheme(),
 		CloudSyncInterval: opts.config.CloudSyncInterval,
 		Inventory:         cloudInventory,
+
+		ReconcileMembershipOnInventoryChange: opts.config.ReconcileMembershipOnInventoryChange,
 	}
 
 	if err = npController.SetupWithManager(mgr); err != nil {
@@ -170,12 +206,88 @@ func main() {
 
 	configureWebhooks(mgr)
 
+	if inventoryQueryAddr != "" {
+		if err = addInventoryQueryServer(mgr, inventoryQueryAddr, inventoryQueryTokenFile,
+			inventoryQueryCertDir); err != nil {
+			setupLog.Error(err, "unable to create inventory query API server")
+			os.Exit(1)
+		}
+	}
+
+	if changeNotificationAddr != "" {
+		if err = addChangeNotificationServer(mgr, changeNotificationAddr, changeNotificationTokenFile,
+			changeNotificationCertDir, npController); err != nil {
+			setupLog.Error(err, "unable to create cloud change notification server")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	setupLog.Info("waiting for pending cloud security operations")
+	if err := cloud.ShutdownCloudProviders(securityShutdownTimeout); err != nil {
+		setupLog.Error(err, "pending cloud security operations dropped on shutdown")
+	}
+}
+
+// addInventoryQueryServer adds the server of the read-only inventory query API to the manager.
+func addInventoryQueryServer(mgr ctrl.Manager, addr, tokenFile, certDir string) error {
+	token, err := readTokenFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read inventory query token: %w", err)
+	}
+	var clouds []cloud.CloudInterface
+	for _, providerType := range cloud.GetSupportedCloudProviderTypes() {
+		cloudInterface, err := cloud.GetCloudInterface(providerType)
+		if err != nil {
+			return err
+		}
+		clouds = append(clouds, cloudInterface)
+	}
+	return mgr.Add(&inventoryquery.Server{
+		Addr:    addr,
+		CertDir: certDir,
+		Token:   token,
+		Clouds:  clouds,
+		Log:     logging.GetLogger("inventoryQuery"),
+	})
+}
+
+// addChangeNotificationServer adds the server receiving cloud change notifications to the manager, security groups
+// changed in cloud are reconciled by npController.
+func addChangeNotificationServer(mgr ctrl.Manager, addr, tokenFile, certDir string,
+	npController *networkpolicy.NetworkPolicyReconciler) error {
+	// the webhook certificate is issued for the in-cluster service, it is not trusted by cloud notification senders.
+	if certDir == "" || filepath.Clean(certDir) == filepath.Clean(defaultCertDir) {
+		return fmt.Errorf("change notifications require a certificate directory other than %v", defaultCertDir)
+	}
+	token, err := readTokenFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read change notification token: %w", err)
+	}
+	return mgr.Add(&changenotification.Server{
+		Addr:      addr,
+		CertDir:   certDir,
+		Token:     token,
+		Reconcile: npController.RequestSecurityGroupReconcile,
+		Log:       logging.GetLogger("changeNotification"),
+	})
+}
+
+// readTokenFile returns the bearer token held by tokenFile.
+func readTokenFile(tokenFile string) (string, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", err
+	}
+	if len(strings.TrimSpace(string(token))) == 0 {
+		return "", fmt.Errorf("token file %v is empty", tokenFile)
+	}
+	return strings.TrimSpace(string(token)), nil
 }
 
 func configureWebhooks(mgr ctrl.Manager) {
@@ -18,10 +18,13 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"antrea.io/nephe/pkg/config"
+	"antrea.io/nephe/pkg/labels"
 )
 
 type Options struct {
@@ -75,6 +78,48 @@ func (o *Options) validate() error {
 		return fmt.Errorf("invalid CloudSyncInterval %v, CloudSyncInterval should be >= %v seconds",
 			o.config.CloudSyncInterval, config.MinimumCloudSyncInterval)
 	}
+
+	if o.config.InventoryTombstonePolls < 0 {
+		return fmt.Errorf("invalid InventoryTombstonePolls %v, InventoryTombstonePolls should be >= 1, "+
+			"or 0 for the default of %v", o.config.InventoryTombstonePolls, config.DefaultInventoryTombstonePolls)
+	}
+
+	if o.config.InventoryPollTimeout < 0 {
+		return fmt.Errorf("invalid InventoryPollTimeout %v, InventoryPollTimeout should be >= 1 seconds, "+
+			"or 0 for the default of %v seconds", o.config.InventoryPollTimeout, config.DefaultInventoryPollTimeout)
+	}
+
+	if o.config.InventorySnapshotHistory < 0 || o.config.InventorySnapshotHistory > config.MaximumInventorySnapshotHistory {
+		return fmt.Errorf("invalid InventorySnapshotHistory %v, InventorySnapshotHistory should be between 0 and %v",
+			o.config.InventorySnapshotHistory, config.MaximumInventorySnapshotHistory)
+	}
+
+	if o.config.MaxRuleAddressPrefixes < 0 || o.config.MaxRuleAddressPrefixes > config.MaximumRuleAddressPrefixes {
+		return fmt.Errorf("invalid MaxRuleAddressPrefixes %v, MaxRuleAddressPrefixes should be between 1 and %v, "+
+			"or 0 for the default of %v", o.config.MaxRuleAddressPrefixes, config.MaximumRuleAddressPrefixes,
+			config.MaximumRuleAddressPrefixes)
+	}
+
+	for tagKey, labelKey := range o.config.TagLabels {
+		if len(tagKey) == 0 {
+			return fmt.Errorf("invalid TagLabels, tag key of label %v is empty", labelKey)
+		}
+		if errs := validation.IsQualifiedName(labelKey); len(errs) > 0 {
+			return fmt.Errorf("invalid TagLabels label key %v of tag %v: %v", labelKey, tagKey,
+				strings.Join(errs, "; "))
+		}
+		if strings.HasPrefix(labelKey, labels.LabelPrefixNephe) {
+			return fmt.Errorf("invalid TagLabels label key %v of tag %v, prefix %v is reserved", labelKey, tagKey,
+				labels.LabelPrefixNephe)
+		}
+	}
+
+	switch labels.TruncationStrategy(o.config.LabelTruncationStrategy) {
+	case labels.TruncationStrategyNone, labels.TruncationStrategyTruncate, labels.TruncationStrategyHashSuffix:
+	default:
+		return fmt.Errorf("invalid LabelTruncationStrategy %v, LabelTruncationStrategy should be %v or %v",
+			o.config.LabelTruncationStrategy, labels.TruncationStrategyTruncate, labels.TruncationStrategyHashSuffix)
+	}
 	return nil
 }
 
@@ -86,4 +131,13 @@ func (o *Options) setDefaults() {
 	if o.config.CloudSyncInterval == 0 {
 		o.config.CloudSyncInterval = config.DefaultCloudSyncInterval
 	}
+	if o.config.InventoryTombstonePolls == 0 {
+		o.config.InventoryTombstonePolls = config.DefaultInventoryTombstonePolls
+	}
+	if o.config.InventoryPollTimeout == 0 {
+		o.config.InventoryPollTimeout = config.DefaultInventoryPollTimeout
+	}
+	if o.config.MaxRuleAddressPrefixes == 0 {
+		o.config.MaxRuleAddressPrefixes = config.MaximumRuleAddressPrefixes
+	}
 }
@@ -42,6 +42,62 @@ func TestOptions(t *testing.T) {
 				CloudSyncInterval:   30,
 			},
 			expectedErr: "invalid CloudSyncInterval",
+		}, {
+			name: "Invalid InventoryTombstonePolls",
+			config: &config.ControllerConfig{
+				CloudResourcePrefix:     "anp",
+				CloudSyncInterval:       70,
+				InventoryTombstonePolls: -1,
+			},
+			expectedErr: "invalid InventoryTombstonePolls",
+		}, {
+			name: "Invalid InventoryPollTimeout",
+			config: &config.ControllerConfig{
+				CloudResourcePrefix:  "anp",
+				CloudSyncInterval:    70,
+				InventoryPollTimeout: -1,
+			},
+			expectedErr: "invalid InventoryPollTimeout",
+		}, {
+			name: "Invalid InventorySnapshotHistory",
+			config: &config.ControllerConfig{
+				CloudResourcePrefix:      "anp",
+				CloudSyncInterval:        70,
+				InventorySnapshotHistory: 11,
+			},
+			expectedErr: "invalid InventorySnapshotHistory",
+		}, {
+			name: "Invalid MaxRuleAddressPrefixes",
+			config: &config.ControllerConfig{
+				CloudResourcePrefix:    "anp",
+				CloudSyncInterval:      70,
+				MaxRuleAddressPrefixes: 4001,
+			},
+			expectedErr: "invalid MaxRuleAddressPrefixes",
+		}, {
+			name: "Invalid TagLabels label key",
+			config: &config.ControllerConfig{
+				CloudResourcePrefix: "anp",
+				CloudSyncInterval:   70,
+				TagLabels:           map[string]string{"app": "app name"},
+			},
+			expectedErr: "invalid TagLabels",
+		}, {
+			name: "Reserved TagLabels label key",
+			config: &config.ControllerConfig{
+				CloudResourcePrefix: "anp",
+				CloudSyncInterval:   70,
+				TagLabels:           map[string]string{"app": "nephe.antrea.io/app"},
+			},
+			expectedErr: "invalid TagLabels",
+		}, {
+			name: "Invalid LabelTruncationStrategy",
+			config: &config.ControllerConfig{
+				CloudResourcePrefix:     "anp",
+				CloudSyncInterval:       70,
+				LabelTruncationStrategy: "drop",
+			},
+			expectedErr: "invalid LabelTruncationStrategy",
 		}, {
 			name:        "Empty config",
 			config:      &config.ControllerConfig{},
@@ -50,8 +106,10 @@ func TestOptions(t *testing.T) {
 		{
 			name: "Valid input",
 			config: &config.ControllerConfig{
-				CloudResourcePrefix: "anp",
-				CloudSyncInterval:   70,
+				CloudResourcePrefix:     "anp",
+				CloudSyncInterval:       70,
+				TagLabels:               map[string]string{"app": "example.com/app"},
+				LabelTruncationStrategy: "hash-suffix",
 			},
 			expectedErr: "",
 		},
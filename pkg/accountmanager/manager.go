@@ -16,8 +16,8 @@ package accountmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -49,6 +49,7 @@ const (
 type Interface interface {
 	AddAccount(*types.NamespacedName, runtimev1alpha1.CloudProvider, *crdv1alpha1.CloudProviderAccount) (bool, error)
 	RemoveAccount(*types.NamespacedName) error
+	InvalidateAccount(*types.NamespacedName)
 	IsAccountCredentialsValid(namespacedName *types.NamespacedName) bool
 	AddResourceFiltersToAccount(*types.NamespacedName, *types.NamespacedName, *crdv1alpha1.CloudEntitySelector, bool) (bool, error)
 	RemoveResourceFiltersFromAccount(*types.NamespacedName, *types.NamespacedName) error
@@ -222,6 +223,21 @@ func (a *AccountManager) RemoveResourceFiltersFromAccount(accNamespacedName *typ
 	return nil
 }
 
+// InvalidateAccount removes account poller and inventory of an account whose credentials are no longer available, e.g.
+// its Secret is deleted, as when the cloud plugin rejects the account credentials. The account is polled again once it
+// is added back with valid credentials.
+func (a *AccountManager) InvalidateAccount(namespacedName *types.NamespacedName) {
+	config := a.getAccountConfig(namespacedName)
+	if config == nil {
+		return
+	}
+	a.Log.Info("Invalidating account", "account", namespacedName)
+	a.removeAccountInventory(namespacedName)
+	config.initialized = false
+	config.credentialsValid = false
+	config.retry = false
+}
+
 // IsAccountCredentialsValid return true for an account, if credentials are valid.
 func (a *AccountManager) IsAccountCredentialsValid(namespacedName *types.NamespacedName) bool {
 	config := a.getAccountConfig(namespacedName)
@@ -384,12 +400,10 @@ func (a *AccountManager) getAccountProviderType(namespacedName *types.Namespaced
 func (a *AccountManager) handleAddProviderAccountError(namespacedName *types.NamespacedName, config *accountConfig,
 	err error) bool {
 	// Account poller is removed upon any error in the plug-in.
-	_ = a.removeAccountPoller(namespacedName)
-	_ = a.Inventory.DeleteVpcsFromCache(namespacedName)
-	_ = a.Inventory.DeleteAllVmsFromCache(namespacedName)
+	a.removeAccountInventory(namespacedName)
 	// TODO: require lock to write into account config structure.
 	config.initialized = false
-	if strings.Contains(err.Error(), util.ErrorMsgSecretReference) {
+	if errors.Is(err, util.ErrSecretReference) {
 		config.credentialsValid = false
 		config.retry = false
 	} else {
@@ -399,6 +413,13 @@ func (a *AccountManager) handleAddProviderAccountError(namespacedName *types.Nam
 	return config.retry
 }
 
+// removeAccountInventory removes account poller and inventory of an account.
+func (a *AccountManager) removeAccountInventory(namespacedName *types.NamespacedName) {
+	_ = a.removeAccountPoller(namespacedName)
+	_ = a.Inventory.DeleteVpcsFromCache(namespacedName)
+	_ = a.Inventory.DeleteAllVmsFromCache(namespacedName)
+}
+
 // replaySelectorsForAccount replays all the selectors that belong to this specified account,
 // set/resets the selector status.
 func (a *AccountManager) replaySelectorsForAccount(accNamespacedName *types.NamespacedName, config *accountConfig) {
@@ -17,11 +17,15 @@ package accountmanager
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
@@ -153,6 +157,7 @@ func (p *accountPoller) doAccountPolling() {
 	}
 
 	p.processCloudInventory(cloudInventory)
+	p.updateSelectorVMCounts(cloudInventory)
 }
 
 // processCloudInventory fetches vpc and vm inventory from the snapshot and updates respective cache inventory.
@@ -182,9 +187,18 @@ func (p *accountPoller) updateAccountStatus(cloudInterface cloud.CloudInterface)
 		if err := p.Get(context.TODO(), *p.accountNamespacedName, account); err != nil {
 			return nil
 		}
-		if account.Status != discoveredStatus {
-			account.Status.Error = discoveredStatus.Error
-			p.log.Info("Setting CPA status", "account", p.accountNamespacedName, "message", discoveredStatus.Error)
+		// Only merge the conditions owned by the cloud plugin, others are owned by the account reconciler.
+		conditions := append([]metav1.Condition{}, account.Status.Conditions...)
+		for _, condition := range discoveredStatus.Conditions {
+			meta.SetStatusCondition(&conditions, condition)
+		}
+		discoveredStatus.Conditions = conditions
+		if !reflect.DeepEqual(account.Status, discoveredStatus) {
+			// API quotas change on every poll, only log error changes.
+			if account.Status.Error != discoveredStatus.Error {
+				p.log.Info("Setting CPA status", "account", p.accountNamespacedName, "message", discoveredStatus.Error)
+			}
+			account.Status = discoveredStatus
 			if err = p.Client.Status().Update(context.TODO(), account); err != nil {
 				p.log.Error(err, "failed to update CPA status, retrying", "account", p.accountNamespacedName)
 				return err
@@ -198,6 +212,53 @@ func (p *accountPoller) updateAccountStatus(cloudInterface cloud.CloudInterface)
 	}
 }
 
+// updateSelectorVMCounts records the number and cloud IDs of the VMs of the selectors whose inventory is not held in
+// their status, so that a selector whose number of VMs spikes across a controller restart is still held, keeping its
+// last confirmed VMs.
+func (p *accountPoller) updateSelectorVMCounts(cloudInventory *nephetypes.CloudInventory) {
+	status, err := p.cloudInterface.GetAccountStatus(p.accountNamespacedName)
+	if err != nil || status == nil {
+		return
+	}
+	heldSelectors := make(map[string]struct{})
+	for _, selector := range status.HeldSelectors {
+		heldSelectors[selector] = struct{}{}
+	}
+
+	for selectorNamespacedName, virtualMachines := range cloudInventory.VmMap {
+		if _, held := heldSelectors[selectorNamespacedName.String()]; held {
+			continue
+		}
+		namespacedName := selectorNamespacedName
+		count := len(virtualMachines)
+		vmIDs := make([]string, 0, count)
+		for _, vm := range virtualMachines {
+			vmIDs = append(vmIDs, strings.ToLower(vm.Status.CloudId))
+		}
+		sort.Strings(vmIDs)
+		updateStatusFunc := func() error {
+			selector := &crdv1alpha1.CloudEntitySelector{}
+			if err := p.Get(context.TODO(), namespacedName, selector); err != nil {
+				return nil
+			}
+			if selector.Status.LastConfirmedVMCount != nil && *selector.Status.LastConfirmedVMCount == count &&
+				reflect.DeepEqual(selector.Status.LastConfirmedVMIDs, vmIDs) {
+				return nil
+			}
+			selector.Status.LastConfirmedVMCount = &count
+			selector.Status.LastConfirmedVMIDs = vmIDs
+			if err := p.Client.Status().Update(context.TODO(), selector); err != nil {
+				p.log.Error(err, "failed to update CES status, retrying", "selector", namespacedName)
+				return err
+			}
+			return nil
+		}
+		if err := retry.RetryOnConflict(retry.DefaultRetry, updateStatusFunc); err != nil {
+			p.log.Error(err, "failed to update CES status", "selector", namespacedName)
+		}
+	}
+}
+
 // updateAgentState sets the Agented field in a VM object.
 func (p *accountPoller) updateAgentState(vms map[string]*runtimev1alpha1.VirtualMachine) {
 	for _, vm := range vms {
@@ -286,6 +286,37 @@ var _ = Describe("Account Poller", func() {
 			_ = fakeClient.Get(context.Background(), testAccountNamespacedName, accountError)
 			Expect(accountError.Status.Error).To(ContainSubstring("error"))
 		})
+		It("Update selector VM counts", func() {
+			accountPollerObj.accountNamespacedName = &testAccountNamespacedName
+			accountPollerObj.cloudInterface = mockCloudInterface
+			_ = fakeClient.Create(context.Background(), ces)
+			vmMap := map[types.NamespacedName]map[string]*runtimev1alpha1.VirtualMachine{
+				testCesNamespacedName: {"ubuntu": {Status: runtimev1alpha1.VirtualMachineStatus{CloudId: "I-Ubuntu"}}},
+			}
+			getSelector := func() *v1alpha1.CloudEntitySelector {
+				selector := &v1alpha1.CloudEntitySelector{}
+				Expect(fakeClient.Get(context.Background(), testCesNamespacedName, selector)).Should(BeNil())
+				return selector
+			}
+			getVMCount := func() *int {
+				return getSelector().Status.LastConfirmedVMCount
+			}
+
+			mockCloudInterface.EXPECT().GetAccountStatus(&testAccountNamespacedName).Return(&v1alpha1.
+				CloudProviderAccountStatus{}, nil).Times(1)
+			accountPollerObj.updateSelectorVMCounts(&nephetypes.CloudInventory{VmMap: vmMap})
+			Expect(getVMCount()).NotTo(BeNil())
+			Expect(*getVMCount()).To(Equal(1))
+			Expect(getSelector().Status.LastConfirmedVMIDs).To(Equal([]string{"i-ubuntu"}))
+
+			// the count of a held selector is not confirmed.
+			vmMap[testCesNamespacedName]["centos"] = new(runtimev1alpha1.VirtualMachine)
+			mockCloudInterface.EXPECT().GetAccountStatus(&testAccountNamespacedName).Return(&v1alpha1.
+				CloudProviderAccountStatus{HeldSelectors: []string{testCesNamespacedName.String()}}, nil).Times(1)
+			accountPollerObj.updateSelectorVMCounts(&nephetypes.CloudInventory{VmMap: vmMap})
+			Expect(*getVMCount()).To(Equal(1))
+			Expect(getSelector().Status.LastConfirmedVMIDs).To(Equal([]string{"i-ubuntu"}))
+		})
 		It("Get vm selector match", func() {
 			vmLabelsMap := map[string]string{
 				labels.CloudAccountName:       testAccountNamespacedName.Name,
@@ -0,0 +1,288 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package changenotification receives cloud change notifications of security groups, Azure Event Grid events and AWS
+// CloudTrail events delivered by EventBridge, so that drift of the affected security groups is reconciled without
+// waiting for the next cloud sync.
+package changenotification
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"antrea.io/nephe/pkg/logging"
+)
+
+const (
+	// AzurePath is the path Azure Event Grid subscriptions deliver resource write and delete events to.
+	AzurePath = "/notifications/v1alpha1/azure"
+	// AWSPath is the path EventBridge API destinations deliver CloudTrail events of EC2 API calls to.
+	AWSPath = "/notifications/v1alpha1/aws"
+
+	azureEventTypeSubscriptionValidation = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	azureEventTypeResourceWriteSuccess   = "Microsoft.Resources.ResourceWriteSuccess"
+	azureEventTypeResourceDeleteSuccess  = "Microsoft.Resources.ResourceDeleteSuccess"
+
+	awsDetailTypeCloudTrailAPICall = "AWS API Call via CloudTrail"
+	awsEventSourceEC2              = "ec2.amazonaws.com"
+
+	bearerPrefix      = "Bearer "
+	certFileName      = "tls.crt"
+	keyFileName       = "tls.key"
+	maxBodyBytes      = 1 << 20
+	readHeaderTimeout = time.Second * 10
+	shutdownTimeout   = time.Second * 5
+)
+
+var (
+	// azureSecurityGroupTypes are the lower case resource types of Azure security groups managed by Nephe.
+	azureSecurityGroupTypes = []string{
+		"/providers/microsoft.network/networksecuritygroups/",
+		"/providers/microsoft.network/applicationsecuritygroups/",
+	}
+	// awsSecurityGroupEvents are the EC2 API calls modifying rules of a security group.
+	awsSecurityGroupEvents = map[string]struct{}{
+		"AuthorizeSecurityGroupIngress":              {},
+		"AuthorizeSecurityGroupEgress":               {},
+		"RevokeSecurityGroupIngress":                 {},
+		"RevokeSecurityGroupEgress":                  {},
+		"ModifySecurityGroupRules":                   {},
+		"UpdateSecurityGroupRuleDescriptionsIngress": {},
+		"UpdateSecurityGroupRuleDescriptionsEgress":  {},
+	}
+)
+
+// ReconcileFunc is invoked with the cloud identifier of a security group changed in cloud.
+type ReconcileFunc func(cloudID string)
+
+type azureEvent struct {
+	EventType string          `json:"eventType"`
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type azureResourceEventData struct {
+	ResourceURI string `json:"resourceUri"`
+}
+
+type azureValidationEventData struct {
+	ValidationCode string `json:"validationCode"`
+}
+
+type awsEvent struct {
+	DetailType string `json:"detail-type"`
+	Detail     struct {
+		EventSource       string `json:"eventSource"`
+		EventName         string `json:"eventName"`
+		ErrorCode         string `json:"errorCode"`
+		RequestParameters struct {
+			GroupID                         string `json:"groupId"`
+			ModifySecurityGroupRulesRequest struct {
+				GroupID string `json:"GroupId"`
+			} `json:"ModifySecurityGroupRulesRequest"`
+		} `json:"requestParameters"`
+	} `json:"detail"`
+}
+
+// NewHandler returns the handler receiving cloud change notifications, reconcile is invoked for every security group
+// changed. Requests must carry token as a bearer token.
+func NewHandler(reconcile ReconcileFunc, token string, log logging.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AzurePath, func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readRequest(w, r, token)
+		if !ok {
+			return
+		}
+		cloudIDs, validationCode, err := parseAzureEvents(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if validationCode != "" {
+			log.Info("Validated Azure Event Grid subscription")
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{"validationResponse": validationCode})
+			return
+		}
+		for _, cloudID := range cloudIDs {
+			log.V(1).Info("Received security group change notification", "cloudID", cloudID)
+			reconcile(cloudID)
+		}
+	})
+	mux.HandleFunc(AWSPath, func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readRequest(w, r, token)
+		if !ok {
+			return
+		}
+		cloudID, err := parseAWSEvent(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if cloudID != "" {
+			log.V(1).Info("Received security group change notification", "cloudID", cloudID)
+			reconcile(cloudID)
+		}
+	})
+	return mux
+}
+
+// readRequest authorizes a notification request and returns its body, or writes the error response and returns false.
+func readRequest(w http.ResponseWriter, r *http.Request, token string) ([]byte, bool) {
+	if !authorized(r, token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// authorized returns true if the request carries token as a bearer token.
+func authorized(r *http.Request, token string) bool {
+	authorization := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(authorization, bearerPrefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, bearerPrefix)), []byte(token)) == 1
+}
+
+// parseAzureEvents returns the lower case IDs of the security groups written or deleted by a batch of Event Grid
+// events, or the validation code of a subscription validation event.
+func parseAzureEvents(body []byte) ([]string, string, error) {
+	var events []azureEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, "", errors.New("invalid Event Grid events")
+	}
+	var cloudIDs []string
+	seen := make(map[string]struct{})
+	for _, event := range events {
+		switch event.EventType {
+		case azureEventTypeSubscriptionValidation:
+			data := azureValidationEventData{}
+			if err := json.Unmarshal(event.Data, &data); err != nil || data.ValidationCode == "" {
+				return nil, "", errors.New("invalid Event Grid subscription validation event")
+			}
+			return nil, data.ValidationCode, nil
+		case azureEventTypeResourceWriteSuccess, azureEventTypeResourceDeleteSuccess:
+			data := azureResourceEventData{}
+			_ = json.Unmarshal(event.Data, &data)
+			resourceURI := data.ResourceURI
+			if resourceURI == "" {
+				resourceURI = event.Subject
+			}
+			cloudID := getAzureSecurityGroupID(resourceURI)
+			if _, ok := seen[cloudID]; cloudID == "" || ok {
+				continue
+			}
+			seen[cloudID] = struct{}{}
+			cloudIDs = append(cloudIDs, cloudID)
+		}
+	}
+	return cloudIDs, "", nil
+}
+
+// getAzureSecurityGroupID returns the lower case ID of the network or application security group of a resource, e.g.
+// the network security group of a security rule, or an empty string if the resource is not a security group.
+func getAzureSecurityGroupID(resourceURI string) string {
+	resourceURI = strings.ToLower(resourceURI)
+	for _, groupType := range azureSecurityGroupTypes {
+		idx := strings.Index(resourceURI, groupType)
+		if idx < 0 {
+			continue
+		}
+		name := strings.SplitN(resourceURI[idx+len(groupType):], "/", 2)[0]
+		if name == "" {
+			return ""
+		}
+		return resourceURI[:idx+len(groupType)] + name
+	}
+	return ""
+}
+
+// parseAWSEvent returns the ID of the security group whose rules are modified by a successful EC2 API call, or an
+// empty string if the event does not modify security group rules.
+func parseAWSEvent(body []byte) (string, error) {
+	event := awsEvent{}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return "", errors.New("invalid EventBridge event")
+	}
+	if event.DetailType != awsDetailTypeCloudTrailAPICall || event.Detail.EventSource != awsEventSourceEC2 ||
+		event.Detail.ErrorCode != "" {
+		return "", nil
+	}
+	if _, ok := awsSecurityGroupEvents[event.Detail.EventName]; !ok {
+		return "", nil
+	}
+	if groupID := event.Detail.RequestParameters.GroupID; groupID != "" {
+		return groupID, nil
+	}
+	return event.Detail.RequestParameters.ModifySecurityGroupRulesRequest.GroupID, nil
+}
+
+// Server is a manager runnable receiving cloud change notifications on Addr over TLS, using the tls.crt and tls.key
+// files of CertDir, so that the bearer token of notifications is never sent in clear text.
+type Server struct {
+	Addr      string
+	CertDir   string
+	Token     string
+	Reconcile ReconcileFunc
+	Log       logging.Logger
+}
+
+// Start receives cloud change notifications until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           NewHandler(s.Reconcile, s.Token, s.Log),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("Receiving cloud change notifications", "address", s.Addr)
+		errCh <- server.ListenAndServeTLS(filepath.Join(s.CertDir, certFileName), filepath.Join(s.CertDir, keyFileName))
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// NeedLeaderElection returns true, as security groups are reconciled by the leader only.
+func (s *Server) NeedLeaderElection() bool {
+	return true
+}
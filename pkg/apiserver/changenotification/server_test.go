@@ -0,0 +1,109 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package changenotification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"antrea.io/nephe/pkg/logging"
+)
+
+var _ = Describe("Cloud change notifications", func() {
+	const (
+		token   = "test-token"
+		nsgID   = "/subscriptions/sub01/resourceGroups/rg01/providers/Microsoft.Network/networkSecurityGroups/nephe-at-default-vnet01"
+		awsSGID = "sg-0123456789abcdef0"
+	)
+	var (
+		reconciled []string
+		handler    http.Handler
+	)
+
+	BeforeEach(func() {
+		reconciled = nil
+		handler = NewHandler(func(cloudID string) {
+			reconciled = append(reconciled, cloudID)
+		}, token, logging.GetLogger("changeNotification"))
+	})
+
+	post := func(path, requestToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if requestToken != "" {
+			req.Header.Set("Authorization", "Bearer "+requestToken)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("Should reconcile the network security group of a changed security rule", func() {
+		body := `[{"eventType": "Microsoft.Resources.ResourceWriteSuccess", "subject": "` + nsgID + `/securityRules/rule01",
+			"data": {"resourceUri": "` + nsgID + `/securityRules/rule01",
+			"operationName": "Microsoft.Network/networkSecurityGroups/securityRules/write"}},
+			{"eventType": "Microsoft.Resources.ResourceDeleteSuccess", "subject": "` + nsgID + `/securityRules/rule02",
+			"data": {"resourceUri": "` + nsgID + `/securityRules/rule02"}},
+			{"eventType": "Microsoft.Resources.ResourceWriteSuccess",
+			"data": {"resourceUri": "/subscriptions/sub01/resourceGroups/rg01/providers/Microsoft.Compute/virtualMachines/vm01"}}]`
+		Expect(post(AzurePath, token, body).Code).To(Equal(http.StatusOK))
+		Expect(reconciled).To(Equal([]string{strings.ToLower(nsgID)}))
+	})
+
+	It("Should answer Event Grid subscription validation", func() {
+		body := `[{"eventType": "Microsoft.EventGrid.SubscriptionValidationEvent", "data": {"validationCode": "code01"}}]`
+		rec := post(AzurePath, token, body)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		response := map[string]string{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &response)).Should(Succeed())
+		Expect(response["validationResponse"]).To(Equal("code01"))
+		Expect(reconciled).To(BeEmpty())
+	})
+
+	It("Should reconcile the security group of a CloudTrail rule change", func() {
+		event := func(eventName, requestParameters, errorCode string) string {
+			return `{"detail-type": "AWS API Call via CloudTrail", "source": "aws.ec2", "detail": {
+				"eventSource": "ec2.amazonaws.com", "eventName": "` + eventName + `", "errorCode": "` + errorCode + `",
+				"requestParameters": ` + requestParameters + `}}`
+		}
+		Expect(post(AWSPath, token, event("AuthorizeSecurityGroupIngress", `{"groupId": "`+awsSGID+`"}`, "")).Code).
+			To(Equal(http.StatusOK))
+		Expect(post(AWSPath, token, event("ModifySecurityGroupRules",
+			`{"ModifySecurityGroupRulesRequest": {"GroupId": "`+awsSGID+`"}}`, "")).Code).To(Equal(http.StatusOK))
+		// Failed API calls and calls not modifying security group rules are ignored.
+		Expect(post(AWSPath, token, event("RevokeSecurityGroupEgress", `{"groupId": "`+awsSGID+`"}`,
+			"Client.UnauthorizedOperation")).Code).To(Equal(http.StatusOK))
+		Expect(post(AWSPath, token, event("RunInstances", `{}`, "")).Code).To(Equal(http.StatusOK))
+		Expect(reconciled).To(Equal([]string{awsSGID, awsSGID}))
+	})
+
+	It("Should reject requests without a valid token or with malformed events", func() {
+		for _, path := range []string{AzurePath, AWSPath} {
+			Expect(post(path, "", "[]").Code).To(Equal(http.StatusUnauthorized))
+			Expect(post(path, "wrong-token", "[]").Code).To(Equal(http.StatusUnauthorized))
+			Expect(post(path, token, "not-json").Code).To(Equal(http.StatusBadRequest))
+		}
+		req := httptest.NewRequest(http.MethodGet, AWSPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(reconciled).To(BeEmpty())
+	})
+})
@@ -0,0 +1,186 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inventoryquery serves a read-only HTTP API of the cloud inventory, for integrations outside Kubernetes.
+package inventoryquery
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloud"
+	"antrea.io/nephe/pkg/logging"
+	nephetypes "antrea.io/nephe/pkg/types"
+)
+
+const (
+	// PathPrefix is the path prefix of the inventory of an account, followed by <namespace>/<name>/vms or
+	// <namespace>/<name>/vpcs.
+	PathPrefix = "/inventory/v1alpha1/accounts/"
+
+	bearerPrefix      = "Bearer "
+	certFileName      = "tls.crt"
+	keyFileName       = "tls.key"
+	readHeaderTimeout = time.Second * 10
+	shutdownTimeout   = time.Second * 5
+)
+
+// NewHandler returns the handler serving the inventory of the accounts managed by clouds. Requests must carry token
+// as a bearer token.
+func NewHandler(clouds []cloud.CloudInterface, token string, log logging.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathPrefix, func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		tokens := strings.Split(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+		if len(tokens) != 3 || tokens[0] == "" || tokens[1] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		accountNamespacedName := &types.NamespacedName{Namespace: tokens[0], Name: tokens[1]}
+		inventory, found := getCloudInventory(clouds, accountNamespacedName)
+		if !found {
+			http.Error(w, "account "+accountNamespacedName.String()+" not found", http.StatusNotFound)
+			return
+		}
+
+		var items interface{}
+		switch tokens[2] {
+		case "vms":
+			items = getVMs(inventory)
+		case "vpcs":
+			items = getVpcs(inventory)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(items); err != nil {
+			log.Error(err, "failed to write inventory response", "account", accountNamespacedName, "path", r.URL.Path)
+		}
+	})
+	return mux
+}
+
+// authorized returns true if the request carries token as a bearer token.
+func authorized(r *http.Request, token string) bool {
+	authorization := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(authorization, bearerPrefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, bearerPrefix)), []byte(token)) == 1
+}
+
+// getCloudInventory returns the inventory of an account from the cloud managing it.
+func getCloudInventory(clouds []cloud.CloudInterface,
+	accountNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, bool) {
+	for _, cloudInterface := range clouds {
+		if inventory, err := cloudInterface.GetCloudInventory(accountNamespacedName); err == nil && inventory != nil {
+			return inventory, true
+		}
+	}
+	return nil, false
+}
+
+// getVMs returns the VMs matched by any selector of the account, sorted by namespace and name.
+// A VM matched by several selectors of the same namespace is returned once.
+func getVMs(inventory *nephetypes.CloudInventory) []*runtimev1alpha1.VirtualMachine {
+	vmsByNamespacedName := make(map[types.NamespacedName]*runtimev1alpha1.VirtualMachine)
+	for _, vmMap := range inventory.VmMap {
+		for _, vm := range vmMap {
+			vmsByNamespacedName[types.NamespacedName{Namespace: vm.Namespace, Name: vm.Name}] = vm
+		}
+	}
+	vms := make([]*runtimev1alpha1.VirtualMachine, 0, len(vmsByNamespacedName))
+	for _, vm := range vmsByNamespacedName {
+		vms = append(vms, vm)
+	}
+	sort.Slice(vms, func(i, j int) bool {
+		if vms[i].Namespace != vms[j].Namespace {
+			return vms[i].Namespace < vms[j].Namespace
+		}
+		return vms[i].Name < vms[j].Name
+	})
+	return vms
+}
+
+// getVpcs returns the VPCs of the account, sorted by name.
+func getVpcs(inventory *nephetypes.CloudInventory) []*runtimev1alpha1.Vpc {
+	vpcs := make([]*runtimev1alpha1.Vpc, 0, len(inventory.VpcMap))
+	for _, vpc := range inventory.VpcMap {
+		vpcs = append(vpcs, vpc)
+	}
+	sort.Slice(vpcs, func(i, j int) bool {
+		return vpcs[i].Name < vpcs[j].Name
+	})
+	return vpcs
+}
+
+// Server is a manager runnable serving the inventory query API on Addr over TLS, using the tls.crt and tls.key files of
+// CertDir, so that the bearer token of requests is never sent in clear text.
+type Server struct {
+	Addr    string
+	CertDir string
+	Token   string
+	Clouds  []cloud.CloudInterface
+	Log     logging.Logger
+}
+
+// Start serves the inventory query API until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           NewHandler(s.Clouds, s.Token, s.Log),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("Serving inventory query API", "address", s.Addr)
+		errCh <- server.ListenAndServeTLS(filepath.Join(s.CertDir, certFileName), filepath.Join(s.CertDir, keyFileName))
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// NeedLeaderElection returns true, as accounts are only loaded, and their inventory polled, on the leader.
+func (s *Server) NeedLeaderElection() bool {
+	return true
+}
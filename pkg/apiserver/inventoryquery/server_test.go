@@ -0,0 +1,117 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventoryquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloud"
+	"antrea.io/nephe/pkg/logging"
+	cloudtest "antrea.io/nephe/pkg/testing/cloud"
+	nephetypes "antrea.io/nephe/pkg/types"
+)
+
+var _ = Describe("Inventory query API", func() {
+	const token = "test-token"
+	var (
+		accountNamespacedName  = types.NamespacedName{Namespace: "namespace01", Name: "account01"}
+		selectorNamespacedName = types.NamespacedName{Namespace: "namespace01", Name: "selector01"}
+
+		mockCtrl  *gomock.Controller
+		mockCloud *cloudtest.MockCloudInterface
+		handler   http.Handler
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCloud = cloudtest.NewMockCloudInterface(mockCtrl)
+		inventory := &nephetypes.CloudInventory{
+			VmMap: map[types.NamespacedName]map[string]*runtimev1alpha1.VirtualMachine{
+				selectorNamespacedName: {
+					"vm02": {ObjectMeta: metav1.ObjectMeta{Name: "vm02", Namespace: accountNamespacedName.Namespace}},
+					"vm01": {ObjectMeta: metav1.ObjectMeta{Name: "vm01", Namespace: accountNamespacedName.Namespace}},
+				},
+				{Namespace: "namespace02", Name: "selector02"}: {
+					"vm01": {ObjectMeta: metav1.ObjectMeta{Name: "vm01", Namespace: "namespace02"}},
+				},
+			},
+			VpcMap: map[string]*runtimev1alpha1.Vpc{
+				"vpc01": {ObjectMeta: metav1.ObjectMeta{Name: "vpc01", Namespace: accountNamespacedName.Namespace}},
+			},
+		}
+		mockCloud.EXPECT().GetCloudInventory(&accountNamespacedName).Return(inventory, nil).AnyTimes()
+		mockCloud.EXPECT().GetCloudInventory(gomock.Not(&accountNamespacedName)).
+			Return(nil, fmt.Errorf("unable to find cloud account config")).AnyTimes()
+		handler = NewHandler([]cloud.CloudInterface{mockCloud}, token, logging.GetLogger("inventoryQuery"))
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	get := func(path, requestToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if requestToken != "" {
+			req.Header.Set("Authorization", "Bearer "+requestToken)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	accountPath := PathPrefix + accountNamespacedName.Namespace + "/" + accountNamespacedName.Name
+
+	It("Should list VMs of an account", func() {
+		rec := get(accountPath+"/vms", token)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var vms []runtimev1alpha1.VirtualMachine
+		Expect(json.Unmarshal(rec.Body.Bytes(), &vms)).Should(Succeed())
+		Expect(vms).To(HaveLen(3))
+		Expect(vms[0].Name).To(Equal("vm01"))
+		Expect(vms[1].Name).To(Equal("vm02"))
+		Expect(vms[2].Namespace).To(Equal("namespace02"))
+		Expect(vms[2].Name).To(Equal("vm01"))
+	})
+
+	It("Should list VPCs of an account", func() {
+		rec := get(accountPath+"/vpcs", token)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var vpcs []runtimev1alpha1.Vpc
+		Expect(json.Unmarshal(rec.Body.Bytes(), &vpcs)).Should(Succeed())
+		Expect(vpcs).To(HaveLen(1))
+		Expect(vpcs[0].Name).To(Equal("vpc01"))
+	})
+
+	It("Should reject requests without a valid token", func() {
+		for _, path := range []string{accountPath + "/vms", accountPath + "/vpcs"} {
+			Expect(get(path, "").Code).To(Equal(http.StatusUnauthorized))
+			Expect(get(path, "wrong-token").Code).To(Equal(http.StatusUnauthorized))
+		}
+	})
+
+	It("Should return not found for unknown accounts and resources", func() {
+		Expect(get(PathPrefix+"namespace01/unknown/vms", token).Code).To(Equal(http.StatusNotFound))
+		Expect(get(accountPath+"/subnets", token).Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -23,6 +23,10 @@ const (
 	StatusCloudVpcId = "status.cloudVpcId"
 	StatusRegion     = "status.region"
 
-	CloudAccountName      = labels.CloudAccountName
-	CloudAccountNamespace = labels.CloudAccountNamespace
+	CloudAccountName       = labels.CloudAccountName
+	CloudAccountNamespace  = labels.CloudAccountNamespace
+	CloudSelectorName      = labels.CloudSelectorName
+	CloudSelectorNamespace = labels.CloudSelectorNamespace
+	VpcName                = labels.VpcName
+	CloudVpcUID            = labels.CloudVpcUID
 )
@@ -229,11 +229,16 @@ func (r *REST) setSupportedFieldKeysMap() {
 	r.fieldKeysMap[selector.StatusRegion] = struct{}{}
 }
 
-// setSupportedLabelKeysMap set the map of supported label names.
+// setSupportedLabelKeysMap set the map of supported label names, so that VMs can be listed across accounts by the
+// selector importing them or by their VPC.
 func (r *REST) setSupportedLabelKeysMap() {
 	r.labelKeysMap = make(map[string]struct{})
 	r.labelKeysMap[selector.CloudAccountNamespace] = struct{}{}
 	r.labelKeysMap[selector.CloudAccountName] = struct{}{}
+	r.labelKeysMap[selector.CloudSelectorNamespace] = struct{}{}
+	r.labelKeysMap[selector.CloudSelectorName] = struct{}{}
+	r.labelKeysMap[selector.VpcName] = struct{}{}
+	r.labelKeysMap[selector.CloudVpcUID] = struct{}{}
 }
 
 // sortAndConvertObjsToVmList sorts the objs based on Namespace and Name and returns the VPC list.
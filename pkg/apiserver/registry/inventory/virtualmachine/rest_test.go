@@ -240,6 +240,46 @@ var _ = Describe("Virtual Machine", func() {
 				Expect(actualObj.(*runtimev1alpha1.VirtualMachineList)).To(Equal(expectedVMLists[i]))
 			}
 		})
+		It("Should return the VM list across accounts by vpc label", func() {
+			newVM := func(namespace, name, account, vpcID string) *runtimev1alpha1.VirtualMachine {
+				return &runtimev1alpha1.VirtualMachine{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: namespace,
+						Name:      name,
+						Labels: map[string]string{
+							nephelabels.CloudAccountNamespace:  namespace,
+							nephelabels.CloudAccountName:       account,
+							nephelabels.CloudSelectorName:      "selector01",
+							nephelabels.CloudSelectorNamespace: namespace,
+							nephelabels.CloudVpcUID:            vpcID,
+						},
+					},
+					Status: runtimev1alpha1.VirtualMachineStatus{CloudVpcId: vpcID},
+				}
+			}
+			vm1 := newVM("ns1", "vm1", "account1", "vpc-1")
+			vm2 := newVM("ns1", "vm2", "account1", "vpc-2")
+			vm3 := newVM("ns2", "vm3", "account2", "vpc-1")
+			vpcInventory := inventory.InitInventory()
+			for _, vms := range [][]*runtimev1alpha1.VirtualMachine{{vm1, vm2}, {vm3}} {
+				vmMap := make(map[string]*runtimev1alpha1.VirtualMachine)
+				for _, vm := range vms {
+					vmMap[vm.Name] = vm
+				}
+				accountNamespacedName := types.NamespacedName{Namespace: vms[0].Namespace,
+					Name: vms[0].Labels[nephelabels.CloudAccountName]}
+				selectorNamespacedName := types.NamespacedName{Namespace: vms[0].Namespace, Name: "selector01"}
+				vpcInventory.BuildVmCache(vmMap, &accountNamespacedName, &selectorNamespacedName)
+			}
+
+			req, _ := labels.NewRequirement(nephelabels.CloudVpcUID, selection.Equals, []string{"vpc-1"})
+			listOption := &internalversion.ListOptions{LabelSelector: labels.NewSelector().Add(*req)}
+			rest := NewREST(vpcInventory, l)
+			actualObj, err := rest.List(context.TODO(), listOption)
+			Expect(err).Should(BeNil())
+			Expect(actualObj.(*runtimev1alpha1.VirtualMachineList).Items).To(Equal(
+				[]runtimev1alpha1.VirtualMachine{*vm1, *vm3}))
+		})
 		It("Should return error for invalid labels,", func() {
 			req2, _ := labels.NewRequirement(nephelabels.CloudVmUID, selection.Equals,
 				[]string{"dummy"})
@@ -30,6 +30,7 @@ import (
 
 	"antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 	"antrea.io/nephe/pkg/controllers/sync"
 	"antrea.io/nephe/pkg/util"
 )
@@ -50,7 +51,29 @@ var (
 	errorMsgAccountNamespaceUpdate    = "account namespace update not allowed"
 	errorMsgReferencedAccountNotFound = "failed to find the referenced CloudProviderAccount"
 	errorMsgInvalidCloudType          = "invalid cloud provider type"
-	errorMsgVpcOrVmMatchNotAvailable  = "either vpcMatch or vmMatch is mandatory"
+	errorMsgUnsupportedTagMatch       = "tagMatch is not supported for AWS"
+	errorMsgUnsupportedHasPublicIP    = "hasPublicIP is not supported for AWS"
+	errorMsgUnsupportedNsgMatch       = "nsgMatch is not supported for AWS"
+	errorMsgUnsupportedSizeMatch      = "sizeMatch is not supported for AWS"
+	errorMsgUnsupportedProvisioned    = "provisionedOnly is not supported for AWS"
+	errorMsgUnsupportedCustomQuery    = "customQueryFilter is not supported for AWS"
+	errorMsgUnsupportedExtension      = "extensionMatch is not supported for AWS"
+	errorMsgUnsupportedSubnetMatch    = "subnetMatch is not supported for AWS"
+	errorMsgUnsupportedModifiedWithin = "modifiedWithinSeconds is not supported for AWS"
+	errorMsgUnsupportedEncryption     = "encryptionAtHostOnly is not supported for AWS"
+	errorMsgUnsupportedDataDiskMatch  = "dataDiskMatch is not supported for AWS"
+	errorMsgUnsupportedBootIntegrity  = "bootIntegrityMatch is not supported for AWS"
+	errorMsgUnsupportedExcludeLocked  = "excludeLocked is not supported for AWS"
+	errorMsgEmptySubnetMatchID        = "matchID is mandatory in subnetMatch"
+	errorMsgInvalidCustomQuery        = "invalid customQueryFilter"
+	errorMsgEmptyTagMatchKey          = "key is mandatory in tagMatch"
+	errorMsgInvalidNsgMatch           = "either matchID or matchNone must be configured in nsgMatch"
+	errorMsgEmptyDataDiskMatch        = "either minCount or minTotalSizeGB must be configured in dataDiskMatch"
+	errorMsgEmptyBootIntegrityMatch   = "either secureBootEnabled or vTPMEnabled must be configured in bootIntegrityMatch"
+	errorMsgEmptyExtensionMatchName   = "matchName is mandatory in extensionMatch"
+	errorMsgVpcOrVmMatchNotAvailable  = "either vpcMatch, vmMatch, tagMatch, hasPublicIP, nsgMatch, sizeMatch, provisionedOnly, " +
+		"customQueryFilter, extensionMatch, osFamilyMatch, subnetMatch, modifiedWithinSeconds, encryptionAtHostOnly, dataDiskMatch, " +
+		"bootIntegrityMatch or excludeLocked is mandatory"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -101,6 +124,9 @@ func (v *CESMutator) Handle(_ context.Context, req admission.Request) admission.
 				m.VpcMatch.MatchID = strings.ToLower(m.VpcMatch.MatchID)
 				m.VpcMatch.MatchName = strings.ToLower(m.VpcMatch.MatchName)
 			}
+			if m.SubnetMatch != nil {
+				m.SubnetMatch.MatchID = strings.ToLower(m.SubnetMatch.MatchID)
+			}
 			for _, vmMatch := range m.VMMatch {
 				vmMatch.MatchID = strings.ToLower(vmMatch.MatchID)
 				vmMatch.MatchName = strings.ToLower(vmMatch.MatchName)
@@ -170,6 +196,9 @@ func (v *CESValidator) validateCreate(req admission.Request) admission.Response
 	if err := v.validateMatchSections(selector); err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	if _, err := utils.ParseConfirmedVMCount(selector.Annotations); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
 
 	return admission.Allowed("")
 }
@@ -215,6 +244,9 @@ func (v *CESValidator) validateUpdate(req admission.Request) admission.Response
 	if err := v.validateMatchSections(newSelector); err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	if _, err := utils.ParseConfirmedVMCount(newSelector.Annotations); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
 
 	return admission.Allowed("")
 }
@@ -243,11 +275,44 @@ func (v *CESValidator) getReferencedAccount(selector *v1alpha1.CloudEntitySelect
 
 // validateMatchSections checks for unsupported selector match combinations and errors out.
 func (v *CESValidator) validateMatchSections(selector *v1alpha1.CloudEntitySelector) error {
-	// Empty vpcMatch and empty vmMatch section are not supported.
+	// Empty vpcMatch, empty vmMatch, empty tagMatch, unset hasPublicIP, empty nsgMatch, empty sizeMatch, unset
+	// provisionedOnly, empty customQueryFilter, empty extensionMatch, empty osFamilyMatch, empty subnetMatch, unset
+	// modifiedWithinSeconds, unset encryptionAtHostOnly, empty dataDiskMatch, empty bootIntegrityMatch and unset
+	// excludeLocked section are not supported.
 	for _, m := range selector.Spec.VMSelector {
-		if m.VpcMatch == nil && len(m.VMMatch) == 0 {
+		if m.VpcMatch == nil && len(m.VMMatch) == 0 && len(m.TagMatch) == 0 && !m.HasPublicIP && m.NsgMatch == nil &&
+			len(strings.TrimSpace(m.SizeMatch)) == 0 && !m.ProvisionedOnly && len(strings.TrimSpace(m.CustomQueryFilter)) == 0 &&
+			m.ExtensionMatch == nil && len(strings.TrimSpace(m.OSFamilyMatch)) == 0 && m.SubnetMatch == nil &&
+			m.ModifiedWithinSeconds == 0 && !m.EncryptionAtHostOnly && m.DataDiskMatch == nil && m.BootIntegrityMatch == nil &&
+			!m.ExcludeLocked {
 			return fmt.Errorf("%s", errorMsgVpcOrVmMatchNotAvailable)
 		}
+		if m.DataDiskMatch != nil && m.DataDiskMatch.MinCount == 0 && m.DataDiskMatch.MinTotalSizeGB == 0 {
+			return fmt.Errorf("%s", errorMsgEmptyDataDiskMatch)
+		}
+		if m.BootIntegrityMatch != nil && m.BootIntegrityMatch.SecureBootEnabled == nil &&
+			m.BootIntegrityMatch.VTPMEnabled == nil {
+			return fmt.Errorf("%s", errorMsgEmptyBootIntegrityMatch)
+		}
+		if m.SubnetMatch != nil && len(strings.TrimSpace(m.SubnetMatch.MatchID)) == 0 {
+			return fmt.Errorf("%s", errorMsgEmptySubnetMatchID)
+		}
+		if m.ExtensionMatch != nil && len(strings.TrimSpace(m.ExtensionMatch.MatchName)) == 0 {
+			return fmt.Errorf("%s", errorMsgEmptyExtensionMatchName)
+		}
+		if m.NsgMatch != nil && (len(strings.TrimSpace(m.NsgMatch.MatchID)) != 0) == m.NsgMatch.MatchNone {
+			return fmt.Errorf("%s", errorMsgInvalidNsgMatch)
+		}
+		if customQueryFilter := strings.TrimSpace(m.CustomQueryFilter); len(customQueryFilter) != 0 {
+			if err := utils.ValidateKqlPredicate(customQueryFilter); err != nil {
+				return fmt.Errorf("%s: %v", errorMsgInvalidCustomQuery, err)
+			}
+		}
+		for _, tagMatch := range m.TagMatch {
+			if len(strings.TrimSpace(tagMatch.Key)) == 0 {
+				return fmt.Errorf("%s", errorMsgEmptyTagMatchKey)
+			}
+		}
 	}
 
 	// MatchID and MatchName are not supported together in an EntityMatch, applicable for both vpcMatch, vmMatch section.
@@ -286,6 +351,45 @@ func (v *CESValidator) validateMatchSections(selector *v1alpha1.CloudEntitySelec
 		}
 	} else {
 		for _, m := range selector.Spec.VMSelector {
+			if len(m.TagMatch) != 0 {
+				return fmt.Errorf(errorMsgUnsupportedTagMatch)
+			}
+			if m.HasPublicIP {
+				return fmt.Errorf(errorMsgUnsupportedHasPublicIP)
+			}
+			if m.NsgMatch != nil {
+				return fmt.Errorf(errorMsgUnsupportedNsgMatch)
+			}
+			if len(strings.TrimSpace(m.SizeMatch)) != 0 {
+				return fmt.Errorf(errorMsgUnsupportedSizeMatch)
+			}
+			if m.ProvisionedOnly {
+				return fmt.Errorf(errorMsgUnsupportedProvisioned)
+			}
+			if len(strings.TrimSpace(m.CustomQueryFilter)) != 0 {
+				return fmt.Errorf(errorMsgUnsupportedCustomQuery)
+			}
+			if m.ExtensionMatch != nil {
+				return fmt.Errorf(errorMsgUnsupportedExtension)
+			}
+			if m.SubnetMatch != nil {
+				return fmt.Errorf(errorMsgUnsupportedSubnetMatch)
+			}
+			if m.ModifiedWithinSeconds != 0 {
+				return fmt.Errorf(errorMsgUnsupportedModifiedWithin)
+			}
+			if m.EncryptionAtHostOnly {
+				return fmt.Errorf(errorMsgUnsupportedEncryption)
+			}
+			if m.DataDiskMatch != nil {
+				return fmt.Errorf(errorMsgUnsupportedDataDiskMatch)
+			}
+			if m.BootIntegrityMatch != nil {
+				return fmt.Errorf(errorMsgUnsupportedBootIntegrity)
+			}
+			if m.ExcludeLocked {
+				return fmt.Errorf(errorMsgUnsupportedExcludeLocked)
+			}
 			if m.VpcMatch != nil && len(strings.TrimSpace(m.VpcMatch.MatchName)) != 0 {
 				for _, vmMatch := range m.VMMatch {
 					if len(strings.TrimSpace(vmMatch.MatchID)) != 0 ||
@@ -314,6 +418,9 @@ func (v *CESValidator) validateMatchSections(selector *v1alpha1.CloudEntitySelec
 // Block same combination of VPC ID and VM ID configuration in any two VMSelectors.
 // Block same combination of VPC ID and VM Name configuration in any two VMSelectors.
 // Block same VM Name configuration in any two VMSelectors with only VMMatch section, when used along with VPCMatch, it is allowed.
+// VMSelectors with TagMatch, HasPublicIP, NsgMatch, SizeMatch, ProvisionedOnly, CustomQueryFilter, ExtensionMatch,
+// OSFamilyMatch, SubnetMatch, ModifiedWithinSeconds, EncryptionAtHostOnly, DataDiskMatch or BootIntegrityMatch narrow
+// down their VPC and VM matches, hence they are not considered as conflicting.
 func (v *CESValidator) validateMatchCombinations(selector *v1alpha1.CloudEntitySelector) error {
 	// vpcIDOnlyMatch map - VPC ID as key for selector with only vpcMatch matchID.
 	// vmIDOnlyMatch map - VM ID as key for selector with only vmMatch matchID.
@@ -328,6 +435,14 @@ func (v *CESValidator) validateMatchCombinations(selector *v1alpha1.CloudEntityS
 	exists := struct{}{}
 
 	for _, selector := range selector.Spec.VMSelector {
+		if len(selector.TagMatch) != 0 || selector.HasPublicIP || selector.NsgMatch != nil ||
+			len(strings.TrimSpace(selector.SizeMatch)) != 0 || selector.ProvisionedOnly ||
+			len(strings.TrimSpace(selector.CustomQueryFilter)) != 0 || selector.ExtensionMatch != nil ||
+			len(strings.TrimSpace(selector.OSFamilyMatch)) != 0 || selector.SubnetMatch != nil ||
+			selector.ModifiedWithinSeconds != 0 || selector.EncryptionAtHostOnly || selector.DataDiskMatch != nil ||
+			selector.BootIntegrityMatch != nil {
+			continue
+		}
 		if selector.VpcMatch != nil {
 			if selector.VpcMatch.MatchID != "" {
 				if len(selector.VMMatch) == 0 {
@@ -33,6 +33,9 @@ import (
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/aws"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/azure"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 	"antrea.io/nephe/pkg/controllers/sync"
 	"antrea.io/nephe/pkg/util"
 )
@@ -42,7 +45,7 @@ const MinPollInterval = 30
 var (
 	errorMsgSecretNotConfigured  = "unable to get secret"
 	errorMsgMinPollInterval      = "pollIntervalInSeconds should be >= 30. If not specified, defaults to 60"
-	errorMsgMissingCredential    = "must specify either credentials or role arn, cannot both be empty"
+	errorMsgMissingCredential    = util.ErrorMsgMissingCredential
 	errorMsgMissingRegion        = "region cannot be blank or empty"
 	errorMsgInvalidRegion        = "not in supported regions"
 	errorMsgJsonUnmarshalFail    = "unable to unmarshal the json"
@@ -51,6 +54,9 @@ var (
 	errorMsgMissingSubscritionID = "subscription id cannot be blank or empty"
 	errorMsgInvalidRequest       = "invalid admission webhook request"
 	errorMsgDecodeFail           = "unable to decode the secret"
+	errorMsgInvalidEgressCIDR    = "invalid egressAllowCIDRs"
+	errorMsgInvalidProxy         = "invalid proxy"
+	errorMsgInvalidEndpoint      = "invalid fallbackEndpoints"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -164,6 +170,10 @@ func (v *CPAValidator) validateCreate(req admission.Request) admission.Response
 		return admission.Errored(http.StatusBadRequest, fmt.Errorf(errorMsgMinPollInterval))
 	}
 
+	if _, err := utils.ParseAccountAnnotations(cpa.Annotations); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
 	return admission.Allowed("")
 }
 
@@ -203,6 +213,10 @@ func (v *CPAValidator) validateUpdate(req admission.Request) admission.Response
 		return admission.Errored(http.StatusBadRequest, fmt.Errorf(errorMsgMinPollInterval))
 	}
 
+	if _, err := utils.ParseAccountAnnotations(newCpa.Annotations); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
 	return admission.Allowed("")
 }
 
@@ -212,8 +226,32 @@ func (v *CPAValidator) validateDelete(_ admission.Request) admission.Response {
 	return admission.Allowed("")
 }
 
-// validateAWSAccount validates parameters in CPA AWS account credentials.
-func (v *CPAValidator) validateAWSAccount(account *crdv1alpha1.CloudProviderAccount) error {
+// validateSecretRefs validates the primary and fallback Secrets in order using validateFunc. Validation passes if
+// any of the Secrets is valid, otherwise the error of the primary Secret is returned.
+func (v *CPAValidator) validateSecretRefs(secretRefs []*crdv1alpha1.SecretReference,
+	validateFunc func(secretRef *crdv1alpha1.SecretReference) error) error {
+	if len(secretRefs) == 0 {
+		return fmt.Errorf(errorMsgSecretNotConfigured)
+	}
+	var primaryErr error
+	for i, secretRef := range secretRefs {
+		err := validateFunc(secretRef)
+		if err == nil {
+			if i > 0 {
+				v.Log.Info("Fallback Secret will be used for cloud-account access", "secret",
+					types.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name}, "error", primaryErr)
+			}
+			return nil
+		}
+		if i == 0 {
+			primaryErr = err
+		}
+	}
+	return primaryErr
+}
+
+// getSecretCredential returns the decoded credential json of the Secret referenced by secretRef.
+func (v *CPAValidator) getSecretCredential(secretRef *crdv1alpha1.SecretReference) ([]byte, error) {
 	u := &unstructured.Unstructured{}
 	u.SetGroupVersionKind(schema.GroupVersionKind{
 		Group:   "",
@@ -221,30 +259,46 @@ func (v *CPAValidator) validateAWSAccount(account *crdv1alpha1.CloudProviderAcco
 		Version: "v1",
 	})
 
-	awsConfig := account.Spec.AWSConfig
-
 	err := v.Client.Get(context.TODO(), types.NamespacedName{
-		Namespace: awsConfig.SecretRef.Namespace,
-		Name:      awsConfig.SecretRef.Name}, u)
+		Namespace: secretRef.Namespace,
+		Name:      secretRef.Name}, u)
 	if err != nil {
-		return fmt.Errorf("%s: %s", errorMsgSecretNotConfigured, err.Error())
+		return nil, fmt.Errorf("%s: %s", errorMsgSecretNotConfigured, err.Error())
 	}
 	data := u.Object["data"].(map[string]interface{})
-	decode, err := base64.StdEncoding.DecodeString(data[awsConfig.SecretRef.Key].(string))
+	decode, err := base64.StdEncoding.DecodeString(data[secretRef.Key].(string))
 	if err != nil {
-		return fmt.Errorf("%s: %s", errorMsgDecodeFail, err.Error())
+		return nil, fmt.Errorf("%s: %s", errorMsgDecodeFail, err.Error())
+	}
+	return decode, nil
+}
+
+// validateAWSCredential validates AWS account credentials in the Secret referenced by secretRef.
+func (v *CPAValidator) validateAWSCredential(secretRef *crdv1alpha1.SecretReference) error {
+	decode, err := v.getSecretCredential(secretRef)
+	if err != nil {
+		return err
 	}
 
 	awsCredential := &crdv1alpha1.AwsAccountCredential{}
 	if err = json.Unmarshal(decode, awsCredential); err != nil {
 		return fmt.Errorf("%s: %s", errorMsgJsonUnmarshalFail, err.Error())
 	}
-	// validate roleArn or A
+	if err = aws.ValidateAccountCredential(awsCredential); err != nil {
+		return err
+	}
 	if len(strings.TrimSpace(awsCredential.RoleArn)) != 0 {
 		v.Log.Info("Role ARN configured will be used for cloud-account access")
-	} else if len(strings.TrimSpace(awsCredential.AccessKeyID)) == 0 ||
-		len(strings.TrimSpace(awsCredential.AccessKeySecret)) == 0 {
-		return fmt.Errorf(errorMsgMissingCredential)
+	}
+	return nil
+}
+
+// validateAWSAccount validates parameters in CPA AWS account credentials.
+func (v *CPAValidator) validateAWSAccount(account *crdv1alpha1.CloudProviderAccount) error {
+	awsConfig := account.Spec.AWSConfig
+
+	if err := v.validateSecretRefs(awsConfig.GetSecretRefs(), v.validateAWSCredential); err != nil {
+		return err
 	}
 
 	if len(awsConfig.Region) == 0 || len(strings.TrimSpace(awsConfig.Region[0])) == 0 {
@@ -263,30 +317,22 @@ func (v *CPAValidator) validateAWSAccount(account *crdv1alpha1.CloudProviderAcco
 		return fmt.Errorf("%v %s [%v]", awsConfig.Region, errorMsgInvalidRegion, supportedRegions)
 	}
 
-	return nil
-}
+	if err := aws.ValidateAccountConfig(account); err != nil {
+		return err
+	}
 
-// validateAzureAccount validates parameters in CPA Azure account credentials.
-func (v *CPAValidator) validateAzureAccount(account *crdv1alpha1.CloudProviderAccount) error {
-	u := &unstructured.Unstructured{}
-	u.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "",
-		Kind:    "Secret",
-		Version: "v1",
-	})
+	if _, err := utils.ParseCIDRs(awsConfig.EgressAllowCIDRs); err != nil {
+		return fmt.Errorf("%s: %s", errorMsgInvalidEgressCIDR, err.Error())
+	}
 
-	azureConfig := account.Spec.AzureConfig
+	return validateProxy(awsConfig.Proxy)
+}
 
-	err := v.Client.Get(context.TODO(), types.NamespacedName{
-		Namespace: azureConfig.SecretRef.Namespace,
-		Name:      azureConfig.SecretRef.Name}, u)
-	if err != nil {
-		return fmt.Errorf("%s: %s", errorMsgSecretNotConfigured, err.Error())
-	}
-	data := u.Object["data"].(map[string]interface{})
-	decode, err := base64.StdEncoding.DecodeString(data[azureConfig.SecretRef.Key].(string))
+// validateAzureCredential validates Azure account credentials in the Secret referenced by secretRef.
+func (v *CPAValidator) validateAzureCredential(secretRef *crdv1alpha1.SecretReference) error {
+	decode, err := v.getSecretCredential(secretRef)
 	if err != nil {
-		return fmt.Errorf("%s: %s", errorMsgDecodeFail, err.Error())
+		return err
 	}
 
 	azureCredential := &crdv1alpha1.AzureAccountCredential{}
@@ -306,11 +352,44 @@ func (v *CPAValidator) validateAzureAccount(account *crdv1alpha1.CloudProviderAc
 	if len(strings.TrimSpace(azureCredential.ClientID)) == 0 || len(strings.TrimSpace(azureCredential.ClientKey)) == 0 {
 		return fmt.Errorf(errorMsgMissingClientDetails)
 	}
+	return nil
+}
+
+// validateAzureAccount validates parameters in CPA Azure account credentials.
+func (v *CPAValidator) validateAzureAccount(account *crdv1alpha1.CloudProviderAccount) error {
+	azureConfig := account.Spec.AzureConfig
+
+	if err := v.validateSecretRefs(azureConfig.GetSecretRefs(), v.validateAzureCredential); err != nil {
+		return err
+	}
 
 	// validate region
 	if len(azureConfig.Region) == 0 || len(strings.TrimSpace(azureConfig.Region[0])) == 0 {
 		return fmt.Errorf(errorMsgMissingRegion)
 	}
 
+	if err := azure.ValidateAccountConfig(account); err != nil {
+		return err
+	}
+
+	if _, err := utils.ParseCIDRs(azureConfig.EgressAllowCIDRs); err != nil {
+		return fmt.Errorf("%s: %s", errorMsgInvalidEgressCIDR, err.Error())
+	}
+
+	if _, err := utils.ParseEndpointURLs(azureConfig.FallbackEndpoints); err != nil {
+		return fmt.Errorf("%s: %s", errorMsgInvalidEndpoint, err.Error())
+	}
+
+	return validateProxy(azureConfig.Proxy)
+}
+
+// validateProxy validates the proxy of a CPA, if configured.
+func validateProxy(proxy *crdv1alpha1.ProxyConfig) error {
+	if proxy == nil {
+		return nil
+	}
+	if _, err := utils.ParseProxyURL(proxy.URL); err != nil {
+		return fmt.Errorf("%s: %s", errorMsgInvalidProxy, err.Error())
+	}
 	return nil
 }
@@ -322,6 +322,55 @@ var _ = Describe("CloudProviderAccountWebhook", func() {
 			Expect(response.AdmissionResponse.Allowed).To(BeFalse())
 			Expect(response.AdmissionResponse.String()).Should(ContainSubstring(errorMsgMinPollInterval))
 		})
+		It("Validate invalid AWS egress allow CIDRs", func() {
+			err = fakeClient.Create(context.Background(), s1)
+			Expect(err).Should(BeNil())
+
+			awsAccount = &v1alpha1.CloudProviderAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testAccountNamespacedName.Name,
+					Namespace: testAccountNamespacedName.Namespace,
+				},
+				Spec: v1alpha1.CloudProviderAccountSpec{
+					PollIntervalInSeconds: &pollIntv,
+					AWSConfig: &v1alpha1.CloudProviderAccountAWSConfig{
+						Region: []string{"us-east-1"},
+						SecretRef: &v1alpha1.SecretReference{
+							Name:      testSecretNamespacedName.Name,
+							Namespace: testSecretNamespacedName.Namespace,
+							Key:       credentials,
+						},
+						EgressAllowCIDRs: []string{"10.0.0.0/8", "10.0.0.0"},
+					},
+				},
+			}
+			encodedAccount, _ = json.Marshal(awsAccount)
+			accountReq = admission.Request{
+				AdmissionRequest: v1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1alpha1",
+						Kind:    "CloudProviderAccount",
+					},
+					Resource: metav1.GroupVersionResource{
+						Group:    "",
+						Version:  "v1alpha1",
+						Resource: "CloudProviderAccounts",
+					},
+					Name:      testAccountNamespacedName.Name,
+					Namespace: testAccountNamespacedName.Namespace,
+					Operation: v1.Create,
+					Object: runtime.RawExtension{
+						Raw: encodedAccount,
+					},
+				},
+			}
+
+			response := validator.Handle(context.Background(), accountReq)
+			_, _ = GinkgoWriter.Write([]byte(fmt.Sprintf("Got admission response %+v\n", response)))
+			Expect(response.AdmissionResponse.Allowed).To(BeFalse())
+			Expect(response.AdmissionResponse.String()).Should(ContainSubstring(errorMsgInvalidEgressCIDR))
+		})
 		It("Validate missing field in AWS Secret credential", func() {
 			cred := `{"accessKeySecret": "keySecret"}`
 			s1 = &corev1.Secret{
@@ -572,7 +621,7 @@ var _ = Describe("CloudProviderAccountWebhook", func() {
 			_, _ = GinkgoWriter.Write([]byte(fmt.Sprintf("Got admission response %+v\n", response)))
 			Expect(response.AdmissionResponse.Allowed).To(BeTrue())
 		})
-		It("Validate AWS RoleARN with Access and Secret Key", func() {
+		It("Validate AWS RoleARN with Access and Secret Key rejected", func() {
 			cred := `{"accessKeyId": "keyId","accessKeySecret": "keySecret", "roleArn": "roleArnId", "externalId": "externalId"}`
 			s1 := &corev1.Secret{
 				ObjectMeta: metav1.ObjectMeta{
@@ -627,7 +676,8 @@ var _ = Describe("CloudProviderAccountWebhook", func() {
 
 			response := validator.Handle(context.Background(), accountReq)
 			_, _ = GinkgoWriter.Write([]byte(fmt.Sprintf("Got admission response %+v\n", response)))
-			Expect(response.AdmissionResponse.Allowed).To(BeTrue())
+			Expect(response.AdmissionResponse.Allowed).To(BeFalse())
+			Expect(response.AdmissionResponse.String()).Should(ContainSubstring("cannot specify both"))
 		})
 		It("Validate AWS account add with decode error", func() {
 			err = fakeClient.Create(context.Background(), s1)
@@ -1119,6 +1169,65 @@ var _ = Describe("CloudProviderAccountWebhook", func() {
 			Expect(response.AdmissionResponse.Allowed).To(BeFalse())
 			Expect(response.AdmissionResponse.String()).Should(ContainSubstring(errorMsgMissingRegion))
 		})
+		It("Validate invalid Azure egress allow CIDRs", func() {
+			cred := `{"subscriptionId": "SubID","clientId": "ClientID","tenantId": "TenantID", "clientKey": "ClientKey"}`
+			s1 := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testSecretNamespacedName.Name,
+					Namespace: testSecretNamespacedName.Namespace,
+				},
+				Data: map[string][]byte{
+					credentials: []byte(cred),
+				},
+			}
+			err = fakeClient.Create(context.Background(), s1)
+			Expect(err).Should(BeNil())
+
+			azureAccount = &v1alpha1.CloudProviderAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testAccountNamespacedName.Name,
+					Namespace: testAccountNamespacedName.Namespace,
+				},
+				Spec: v1alpha1.CloudProviderAccountSpec{
+					PollIntervalInSeconds: &pollIntv,
+					AzureConfig: &v1alpha1.CloudProviderAccountAzureConfig{
+						SecretRef: &v1alpha1.SecretReference{
+							Name:      testSecretNamespacedName.Name,
+							Namespace: testSecretNamespacedName.Namespace,
+							Key:       credentials,
+						},
+						Region:           []string{"eastus"},
+						EgressAllowCIDRs: []string{"10.0.0.0/8", "10.0.0.0"},
+					},
+				},
+			}
+			encodedAccount, _ = json.Marshal(azureAccount)
+			accountReq = admission.Request{
+				AdmissionRequest: v1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1alpha1",
+						Kind:    "CloudProviderAccount",
+					},
+					Resource: metav1.GroupVersionResource{
+						Group:    "",
+						Version:  "v1alpha1",
+						Resource: "CloudProviderAccounts",
+					},
+					Name:      testAccountNamespacedName.Name,
+					Namespace: testAccountNamespacedName.Namespace,
+					Operation: v1.Create,
+					Object: runtime.RawExtension{
+						Raw: encodedAccount,
+					},
+				},
+			}
+
+			response := validator.Handle(context.Background(), accountReq)
+			_, _ = GinkgoWriter.Write([]byte(fmt.Sprintf("Got admission response %+v\n", response)))
+			Expect(response.AdmissionResponse.Allowed).To(BeFalse())
+			Expect(response.AdmissionResponse.String()).Should(ContainSubstring(errorMsgInvalidEgressCIDR))
+		})
 		It("Validate AWS missing secret in webhook update", func() {
 			encodedAccount, _ = json.Marshal(awsAccount)
 
@@ -17,7 +17,9 @@ package cloud
 import (
 	"fmt"
 	"sync"
+	"time"
 
+	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -56,14 +58,37 @@ type AccountMgmtInterface interface {
 	GetAccountStatus(accNamespacedName *types.NamespacedName) (*crdv1alpha1.CloudProviderAccountStatus, error)
 	// DoInventoryPoll calls cloud API to get cloud resources.
 	DoInventoryPoll(accountNamespacedName *types.NamespacedName) error
+	// RefreshVpc calls cloud API to get the VMs of a single VPC and merges them into the cloud resources.
+	RefreshVpc(accountNamespacedName *types.NamespacedName, vpcID string) error
 	// ResetInventoryCache resets cloud snapshot and poll stats to nil.
 	ResetInventoryCache(accountNamespacedName *types.NamespacedName) error
+	// SetCredentialRotationHook sets the hook invoked after the credentials of an account are rotated.
+	SetCredentialRotationHook(hook func(accountNamespacedName *types.NamespacedName))
+	// SetVpcDeletedHook sets the hook invoked after an inventory poll finds VPCs of an account deleted from cloud.
+	SetVpcDeletedHook(hook func(accountNamespacedName *types.NamespacedName))
+	// SetAccountResumedHook sets the hook invoked after a paused account is resumed.
+	SetAccountResumedHook(hook func(accountNamespacedName *types.NamespacedName))
+	// SetSecurityOptionsChangedHook sets the hook invoked after account options changing how security groups are
+	// enforced are updated in place.
+	SetSecurityOptionsChangedHook(hook func(accountNamespacedName *types.NamespacedName))
 }
 
 // ComputeInterface is an abstract providing set of methods to get inventory details to be implemented by cloud providers.
 type ComputeInterface interface {
 	// GetCloudInventory gets VPC and VM inventory from plugin snapshot for a given cloud provider account.
 	GetCloudInventory(accountNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, error)
+	// GetSnapshotFootprint gets the approximate memory footprint of the plugin snapshot and of its history for a given
+	// cloud provider account, nil if the cloud provider does not estimate it.
+	GetSnapshotFootprint(accountNamespacedName *types.NamespacedName) (*nephetypes.SnapshotFootprint, error)
+	// GetMatchingSelectors gets the selectors which matched a VM for a given cloud provider account.
+	GetMatchingSelectors(accNamespacedName *types.NamespacedName, instanceID string) ([]string, error)
+	// GetSelectorCloudInventory gets the VMs matched by a selector and their VPCs for a given cloud provider account.
+	GetSelectorCloudInventory(accNamespacedName, selectorNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, error)
+	// PreviewSelector gets the VMs a selector would match for a given cloud provider account, without adding it.
+	PreviewSelector(accNamespacedName *types.NamespacedName,
+		selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error)
+	// GetVpcPeerings gets the peerings of the VPCs from plugin snapshot for a given cloud provider account.
+	GetVpcPeerings(accNamespacedName *types.NamespacedName) ([]nephetypes.VpcPeering, error)
 }
 
 type SecurityInterface interface {
@@ -71,8 +96,16 @@ type SecurityInterface interface {
 	// If it exists, returns the existing cloud SG ID.
 	CreateSecurityGroup(securityGroupIdentifier *cloudresource.CloudResource, membershipOnly bool) (*string, error)
 	// UpdateSecurityGroupRules updates cloud security group corresponding to provided appliedTo group with provided rules.
-	// addRules and rmRules are the changed rules, allRules are rules from all nps of the security group.
+	// addRules and rmRules are the changed rules, allRules are rules from all nps of the security group. Added rules
+	// invalid for the provider are rejected with a *cloudresource.InvalidRulesError, after updating the other rules, and
+	// rules realized without some of the security groups they reference are reported with a
+	// *cloudresource.UnresolvedGroupsError.
 	UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudresource.CloudResource, addRules, rmRules []*cloudresource.CloudRule) error
+	// UpdateSecurityGroupRulesBatch updates rules of multiple appliedTo groups, groups referenced by rules of other groups
+	// first. Groups referenced by rules must have been already created. All updates are attempted, except those depending
+	// on failed groups or on a dependency cycle, and on any failure a *cloudresource.GroupRuleUpdateBatchError reporting
+	// the succeeded and failed groups is returned.
+	UpdateSecurityGroupRulesBatch(updates []cloudresource.GroupRuleUpdate) error
 	// UpdateSecurityGroupMembers updates membership of cloud security group corresponding to provided security group. Only
 	// provided computeResources will remain attached to cloud security group. UpdateSecurityGroupMembers will also make sure that
 	// after membership update, if compute resource is no longer attached to any nephe created cloud security group, then
@@ -86,6 +119,10 @@ type SecurityInterface interface {
 	DeleteSecurityGroup(securityGroupIdentifier *cloudresource.CloudResource, membershipOnly bool) error
 	// GetEnforcedSecurity returns the cloud view of enforced security.
 	GetEnforcedSecurity() []cloudresource.SynchronizationContent
+	// Shutdown waits up to timeout for in-progress security operations, and those waiting on the vpc of another one,
+	// to complete, and returns an error reporting the operations dropped if they do not. Security updates not yet
+	// issued to the plugin, e.g. still queued by controllers, are not awaited.
+	Shutdown(timeout time.Duration) error
 }
 
 // All registered crdv1alpha1 providers.
@@ -142,3 +179,26 @@ func GetSupportedCloudProviderTypes() []runtimev1alpha1.CloudProvider {
 	}
 	return providerTypes
 }
+
+// ShutdownCloudProviders waits up to timeout for the pending security operations of all registered providers.
+func ShutdownCloudProviders(timeout time.Duration) error {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	var wg sync.WaitGroup
+	var errsMutex sync.Mutex
+	var errs error
+	for providerType, cloud := range providers {
+		wg.Add(1)
+		go func(providerType runtimev1alpha1.CloudProvider, cloud CloudInterface) {
+			defer wg.Done()
+			if err := cloud.Shutdown(timeout); err != nil {
+				errsMutex.Lock()
+				errs = multierr.Append(errs, fmt.Errorf("%v: %w", providerType, err))
+				errsMutex.Unlock()
+			}
+		}(providerType, cloud)
+	}
+	wg.Wait()
+	return errs
+}
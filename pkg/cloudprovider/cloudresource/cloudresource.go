@@ -21,7 +21,10 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 )
@@ -30,8 +33,49 @@ var (
 	ControllerPrefix             string
 	ControllerAddressGroupPrefix string
 	ControllerAppliedToPrefix    string
+
+	// InventoryTombstonePolls is the number of consecutive inventory polls a VM must be absent from before it is
+	// removed from the cloud inventory.
+	InventoryTombstonePolls = 1
+
+	// InventoryPollTimeout is the timeout of a single inventory poll of an account.
+	InventoryPollTimeout = 300 * time.Second
+
+	// CoalesceInventoryQueries enables sharing the results of identical inventory queries among accounts.
+	CoalesceInventoryQueries = false
+
+	// InventorySnapshotHistory is the number of recent inventory snapshots kept per account for debugging.
+	InventorySnapshotHistory = 0
+
+	// MaxRuleAddressPrefixes is the maximum number of CIDRs in a single cloud security rule.
+	MaxRuleAddressPrefixes = 4000
+
+	// StatelessRuleEnforcement indicates cloud security rules do not track connections, so the return-direction
+	// rules of allowed connections are generated. It has no effect today, as all supported cloud providers are stateful.
+	StatelessRuleEnforcement = false
+
+	// shortenedCloudNames maps the shortened cloud names of security groups to the names they are shortened from. It
+	// is rebuilt by SetKnownCloudNames from the security groups known to the controller.
+	shortenedCloudNames = struct {
+		sync.RWMutex
+		names map[string]string
+	}{names: make(map[string]string)}
+)
+
+const (
+	// MaxCloudNameLength is the maximum length of the cloud names of security groups, the AWS security group name
+	// limit. Cloud providers with a stricter limit are listed in maxCloudNameLengths.
+	MaxCloudNameLength = 255
+	// cloudNameHashSuffixLength is the number of hex characters of the name hash suffixing a shortened cloud name.
+	cloudNameHashSuffixLength = 8
 )
 
+// maxCloudNameLengths are the maximum lengths of the cloud names of security groups of cloud providers stricter than
+// MaxCloudNameLength. Azure application security group and network security group names are limited to 80.
+var maxCloudNameLengths = map[runtimev1alpha1.CloudProvider]int{
+	runtimev1alpha1.AzureCloudProvider: 80,
+}
+
 // CloudResourceType specifies the type of cloud resource.
 type CloudResourceType string
 
@@ -42,16 +86,44 @@ var (
 
 func SetCloudResourcePrefix(CloudResourcePrefix string) {
 	ControllerPrefix = CloudResourcePrefix
+	ControllerAddressGroupPrefix = GetControllerAddressGroupPrefix()
+	ControllerAppliedToPrefix = GetControllerAppliedToPrefix()
+}
+
+func SetInventoryTombstonePolls(polls int) {
+	InventoryTombstonePolls = polls
+}
+
+func SetInventoryPollTimeout(seconds int64) {
+	InventoryPollTimeout = time.Duration(seconds) * time.Second
+}
+
+func SetCoalesceInventoryQueries(coalesce bool) {
+	CoalesceInventoryQueries = coalesce
 }
 
+func SetInventorySnapshotHistory(depth int) {
+	InventorySnapshotHistory = depth
+}
+
+func SetMaxRuleAddressPrefixes(max int) {
+	MaxRuleAddressPrefixes = max
+}
+
+func SetStatelessRuleEnforcement(stateless bool) {
+	StatelessRuleEnforcement = stateless
+}
+
+// GetControllerAddressGroupPrefix returns the prefix of address groups. It only reads the controller prefix, as it is
+// called by security operations running concurrently.
 func GetControllerAddressGroupPrefix() string {
-	ControllerAddressGroupPrefix = ControllerPrefix + "-ag-"
-	return ControllerAddressGroupPrefix
+	return ControllerPrefix + "-ag-"
 }
 
+// GetControllerAppliedToPrefix returns the prefix of appliedTo groups. It only reads the controller prefix, as it is
+// called by security operations running concurrently.
 func GetControllerAppliedToPrefix() string {
-	ControllerAppliedToPrefix = ControllerPrefix + "-at-"
-	return ControllerAppliedToPrefix
+	return ControllerPrefix + "-at-"
 }
 
 type CloudResourceID struct {
@@ -72,11 +144,86 @@ func (c *CloudResource) String() string {
 	return string(c.Type) + "/" + c.CloudResourceID.String()
 }
 
+// Equal returns true if both identify the same cloud resource. Cloud names and vpcs are compared case-insensitively.
+func (c *CloudResource) Equal(other *CloudResource) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return c.Type == other.Type && strings.EqualFold(c.Name, other.Name) && strings.EqualFold(c.Vpc, other.Vpc) &&
+		c.AccountID == other.AccountID && c.CloudProvider == other.CloudProvider
+}
+
+// GetCloudName returns the cloud name of the security group, names exceeding MaxCloudNameLength are shortened with
+// shortenCloudName.
 func (c *CloudResourceID) GetCloudName(membershipOnly bool) string {
+	return c.GetCloudNameOfProvider("", membershipOnly)
+}
+
+// GetCloudNameOfProvider returns the cloud name of the security group on the cloud provider, names exceeding the
+// maximum length of the provider are shortened with shortenCloudName.
+func (c *CloudResourceID) GetCloudNameOfProvider(provider runtimev1alpha1.CloudProvider, membershipOnly bool) string {
+	prefix := GetControllerAppliedToPrefix()
 	if membershipOnly {
-		return fmt.Sprintf("%v%v", GetControllerAddressGroupPrefix(), strings.ToLower(c.Name))
+		prefix = GetControllerAddressGroupPrefix()
+	}
+	return prefix + shortenCloudName(prefix, strings.ToLower(c.Name), getMaxCloudNameLength(provider))
+}
+
+func getMaxCloudNameLength(provider runtimev1alpha1.CloudProvider) int {
+	if maxLength, ok := maxCloudNameLengths[provider]; ok {
+		return maxLength
+	}
+	return MaxCloudNameLength
+}
+
+// shortenCloudName returns name when prefix followed by name is within maxLength. Otherwise, name is truncated and
+// suffixed with a hash of the full name, so that the shortened name is stable and distinct for names sharing a long
+// common prefix.
+func shortenCloudName(prefix, name string, maxLength int) string {
+	if len(prefix)+len(name) <= maxLength {
+		return name
+	}
+	hash := sha1.Sum([]byte(name))
+	suffix := hex.EncodeToString(hash[:])[:cloudNameHashSuffixLength]
+	keep := maxLength - len(prefix) - len(suffix) - 1
+	if keep < 0 {
+		keep = 0
 	}
-	return fmt.Sprintf("%v%v", GetControllerAppliedToPrefix(), strings.ToLower(c.Name))
+	return name[:keep] + "-" + suffix
+}
+
+// SetKnownCloudNames records the security group names the controller knows of, so that GetOriginalCloudName recovers
+// them from their shortened cloud names of any cloud provider. The names recorded by a previous call are dropped.
+func SetKnownCloudNames(names []string) {
+	maxLengths := []int{MaxCloudNameLength}
+	for _, maxLength := range maxCloudNameLengths {
+		maxLengths = append(maxLengths, maxLength)
+	}
+	shortened := make(map[string]string)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		for _, prefix := range []string{GetControllerAddressGroupPrefix(), GetControllerAppliedToPrefix()} {
+			for _, maxLength := range maxLengths {
+				if short := shortenCloudName(prefix, name, maxLength); short != name {
+					shortened[short] = name
+				}
+			}
+		}
+	}
+	shortenedCloudNames.Lock()
+	defer shortenedCloudNames.Unlock()
+	shortenedCloudNames.names = shortened
+}
+
+// GetOriginalCloudName returns the name a security group name recovered from a cloud name was shortened from, among
+// the names recorded by SetKnownCloudNames. name is returned as is otherwise.
+func GetOriginalCloudName(name string) string {
+	shortenedCloudNames.RLock()
+	defer shortenedCloudNames.RUnlock()
+	if original, found := shortenedCloudNames.names[name]; found {
+		return original
+	}
+	return name
 }
 
 func (c *CloudResourceID) String() string {
@@ -87,16 +234,44 @@ func (c *CloudResourceID) String() string {
 const (
 	Name      = "Name"
 	Namespace = "Ns"
+	UID       = "Uid"
+	Logging   = "Log"
+	// AnnotationPrefix prefixes the keys of rule annotations in a rule description.
+	AnnotationPrefix = "a."
+	// MaxRuleAnnotations is the maximum number of annotations carried by a rule description.
+	MaxRuleAnnotations = 4
 )
 
 type CloudRuleDescription struct {
 	Name      string
 	Namespace string
+	// UID of the policy is optional, it is absent in descriptions of rules created by earlier releases.
+	UID string
+	// Logging is optional and only present in the description when enabled. It only records that logging was
+	// requested for the rule, no traffic logging is configured on cloud.
+	Logging bool
+	// Annotations are optional key/value pairs of the policy, in the description ordered by key.
+	Annotations map[string]string
 }
 
 func (r *CloudRuleDescription) String() string {
-	return Name + ":" + r.Name + ", " +
+	desc := Name + ":" + r.Name + ", " +
 		Namespace + ":" + r.Namespace
+	if r.UID != "" {
+		desc += ", " + UID + ":" + r.UID
+	}
+	if r.Logging {
+		desc += ", " + Logging + ":true"
+	}
+	keys := make([]string, 0, len(r.Annotations))
+	for key := range r.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		desc += ", " + AnnotationPrefix + key + ":" + r.Annotations[key]
+	}
+	return desc
 }
 
 type Rule interface {
@@ -110,6 +285,13 @@ type IngressRule struct {
 	FromSecurityGroups []*CloudResourceID
 	Protocol           *int
 	AppliedToGroup     map[string]struct{}
+	// EnableLogging requests logging of traffic matching the rule. No provider enables traffic logging today: Azure
+	// only tags the description of the NSG rule with it, and AWS ignores it.
+	EnableLogging bool `json:",omitempty"`
+	// SrcPort and SrcEndPort constrain the source port range, on providers supporting it. Any source port is
+	// allowed when SrcPort is nil, SrcEndPort is nil for a single port.
+	SrcPort    *int `json:",omitempty"`
+	SrcEndPort *int `json:",omitempty"`
 }
 
 func (i *IngressRule) isRule() {}
@@ -121,6 +303,13 @@ type EgressRule struct {
 	ToSecurityGroups []*CloudResourceID
 	Protocol         *int
 	AppliedToGroup   map[string]struct{}
+	// EnableLogging requests logging of traffic matching the rule. No provider enables traffic logging today: Azure
+	// only tags the description of the NSG rule with it, and AWS ignores it.
+	EnableLogging bool `json:",omitempty"`
+	// SrcPort and SrcEndPort constrain the source port range, on providers supporting it. Any source port is
+	// allowed when SrcPort is nil, SrcEndPort is nil for a single port.
+	SrcPort    *int `json:",omitempty"`
+	SrcEndPort *int `json:",omitempty"`
 }
 
 func (e *EgressRule) isRule() {}
@@ -129,17 +318,80 @@ type CloudRule struct {
 	Hash             string `json:"-"`
 	Rule             Rule
 	NpNamespacedName string `json:"-"`
-	AppliedToGrp     string
+	// NpUID is the UID of the policy, it distinguishes rules of a policy recreated with the same name.
+	NpUID        string `json:"-"`
+	AppliedToGrp string
+	// Annotations are key/value pairs of the policy carried into the cloud rule description for traceability, as far
+	// as the description size allows. They are not hashed, as they do not change what the rule allows and the
+	// annotations realized in cloud may be truncated, so a rule is not re-realized when only its annotations change.
+	Annotations map[string]string `json:"-"`
+	// Generated is true for the return-direction rule of a policy rule under stateless rule enforcement.
+	Generated bool `json:"-"`
 }
 
+// IsStale returns true if the rule was realized for a previous incarnation of the given policy, i.e. a policy with
+// the same namespaced name but a different UID. Rules without a recorded UID are never stale.
+func (c *CloudRule) IsStale(npNamespacedName, npUID string) bool {
+	return c.NpNamespacedName == npNamespacedName && c.NpUID != "" && npUID != "" && c.NpUID != npUID
+}
+
+// GetHash returns the hash of the semantic fields of the rule, i.e. its direction, protocol, ports, CIDRs, security
+// group references and logging. Other fields, such as the appliedTo group, the policy the rule belongs to or its
+// annotations, do not change what the rule allows and are not hashed.
 func (c *CloudRule) GetHash() string {
 	hash := sha1.New()
-	bytes, _ := json.Marshal(c)
+	bytes, _ := json.Marshal(c.canonicalRule())
 	hash.Write(bytes)
 	hashValue := hex.EncodeToString(hash.Sum(nil))
 	return hashValue
 }
 
+// canonicalRule is the canonical form of the semantic fields of a CloudRule, CIDRs and security group references are
+// sorted so that their order does not change the rule hash.
+type canonicalRule struct {
+	Direction      string
+	Protocol       *int
+	Port           *int
+	SrcPort        *int
+	SrcEndPort     *int
+	CIDRs          []string
+	SecurityGroups []string
+	EnableLogging  bool
+}
+
+func (c *CloudRule) canonicalRule() *canonicalRule {
+	var (
+		canonical canonicalRule
+		cidrs     []*net.IPNet
+		sgs       []*CloudResourceID
+	)
+	switch rule := c.Rule.(type) {
+	case *IngressRule:
+		canonical = canonicalRule{Direction: "ingress", Protocol: rule.Protocol, Port: rule.FromPort,
+			SrcPort: rule.SrcPort, SrcEndPort: rule.SrcEndPort, EnableLogging: rule.EnableLogging}
+		cidrs, sgs = rule.FromSrcIP, rule.FromSecurityGroups
+	case *EgressRule:
+		canonical = canonicalRule{Direction: "egress", Protocol: rule.Protocol, Port: rule.ToPort,
+			SrcPort: rule.SrcPort, SrcEndPort: rule.SrcEndPort, EnableLogging: rule.EnableLogging}
+		cidrs, sgs = rule.ToDstIP, rule.ToSecurityGroups
+	default:
+		return &canonical
+	}
+	for _, cidr := range cidrs {
+		if cidr != nil {
+			canonical.CIDRs = append(canonical.CIDRs, cidr.String())
+		}
+	}
+	sort.Strings(canonical.CIDRs)
+	for _, sg := range sgs {
+		if sg != nil {
+			canonical.SecurityGroups = append(canonical.SecurityGroups, sg.String())
+		}
+	}
+	sort.Strings(canonical.SecurityGroups)
+	return &canonical
+}
+
 // SynchronizationContent returns a SecurityGroup content in cloud.
 type SynchronizationContent struct {
 	Resource                   CloudResource
@@ -148,4 +400,61 @@ type SynchronizationContent struct {
 	MembersWithOtherSGAttached []CloudResource
 	IngressRules               []CloudRule
 	EgressRules                []CloudRule
+	// CloudID is the cloud identifier of the security group holding the rules or members of the group, e.g. AWS
+	// security group ID or Azure network security group ID.
+	CloudID string
+}
+
+// GroupRuleUpdate specifies the rules to be added to and removed from one appliedTo group.
+type GroupRuleUpdate struct {
+	AppliedToGroup *CloudResource
+	AddRules       []*CloudRule
+	RmRules        []*CloudRule
+}
+
+// GroupRuleUpdateBatchError is returned by a batch rule update when one or more group updates fail. It carries the
+// groups that were updated successfully and the failure reason of every other group, so that the caller can decide
+// whether to roll back.
+type GroupRuleUpdateBatchError struct {
+	Succeeded []CloudResource
+	Failed    map[CloudResource]error
+}
+
+// InvalidRulesError is returned by a rule update when some of the added rules are rejected by the validation of the
+// provider. The other rules are updated regardless, Rejected holds the reason each rejected rule is invalid.
+type InvalidRulesError struct {
+	AppliedToGroup string
+	Rejected       map[*CloudRule]error
+}
+
+// UnresolvedGroupsError is returned by a rule update when the rules are realized without some of the security groups
+// they reference, which the provider cannot resolve, e.g. groups of vpcs not visible to the account. The rules are
+// updated regardless, Groups holds the security groups left out.
+type UnresolvedGroupsError struct {
+	AppliedToGroup string
+	Groups         []string
+}
+
+func (e *InvalidRulesError) Error() string {
+	var rejected []string
+	for _, err := range e.Rejected {
+		rejected = append(rejected, err.Error())
+	}
+	sort.Strings(rejected)
+	return fmt.Sprintf("invalid rules for appliedTo group %v: [%v]", e.AppliedToGroup, strings.Join(rejected, "; "))
+}
+
+func (e *UnresolvedGroupsError) Error() string {
+	return fmt.Sprintf("security groups left out of rules for appliedTo group %v: [%v]", e.AppliedToGroup,
+		strings.Join(e.Groups, "; "))
+}
+
+func (e *GroupRuleUpdateBatchError) Error() string {
+	var failed []string
+	for group, err := range e.Failed {
+		failed = append(failed, fmt.Sprintf("%v: %v", group.String(), err))
+	}
+	sort.Strings(failed)
+	return fmt.Sprintf("failed to update rules of %d out of %d security groups: [%v]", len(e.Failed),
+		len(e.Failed)+len(e.Succeeded), strings.Join(failed, "; "))
 }
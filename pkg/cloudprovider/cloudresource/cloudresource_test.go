@@ -0,0 +1,155 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudresource
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+)
+
+func TestCloudResource(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cloud Resource")
+}
+
+var _ = Describe("Cloud rule hash", func() {
+	var (
+		tcp     = 6
+		ssh     = 22
+		web     = CloudResourceID{Name: "web", Vpc: "vpc01"}
+		db      = CloudResourceID{Name: "db", Vpc: "vpc01"}
+		newRule func(cidrs ...string) *CloudRule
+	)
+
+	BeforeEach(func() {
+		newRule = func(cidrs ...string) *CloudRule {
+			var ipNets []*net.IPNet
+			for _, cidr := range cidrs {
+				_, ipNet, _ := net.ParseCIDR(cidr)
+				ipNets = append(ipNets, ipNet)
+			}
+			return &CloudRule{
+				Rule: &IngressRule{
+					FromPort:           &ssh,
+					FromSrcIP:          ipNets,
+					FromSecurityGroups: []*CloudResourceID{&db},
+					Protocol:           &tcp,
+				},
+				NpNamespacedName: "default/np-web",
+				AppliedToGrp:     web.String(),
+			}
+		}
+	})
+
+	It("Should not change with non-semantic fields", func() {
+		rule := newRule("10.0.0.0/16", "10.1.0.0/16")
+		hash := rule.GetHash()
+
+		rule.AppliedToGrp = "WEB/vpc01"
+		rule.NpNamespacedName = "default/np-web-renamed"
+		rule.NpUID = "uid"
+		rule.Annotations = map[string]string{"owner": "web-team"}
+		rule.Rule.(*IngressRule).AppliedToGroup = map[string]struct{}{"web": {}}
+		Expect(rule.GetHash()).To(Equal(hash))
+		Expect(newRule("10.1.0.0/16", "10.0.0.0/16").GetHash()).To(Equal(hash))
+	})
+
+	It("Should change with semantic fields", func() {
+		hash := newRule("10.0.0.0/16").GetHash()
+
+		Expect(newRule("10.2.0.0/16").GetHash()).NotTo(Equal(hash))
+
+		rule := newRule("10.0.0.0/16")
+		https := 443
+		rule.Rule.(*IngressRule).FromPort = &https
+		Expect(rule.GetHash()).NotTo(Equal(hash))
+
+		rule = newRule("10.0.0.0/16")
+		rule.Rule.(*IngressRule).FromSecurityGroups = []*CloudResourceID{&web}
+		Expect(rule.GetHash()).NotTo(Equal(hash))
+
+		rule = newRule("10.0.0.0/16")
+		rule.Rule.(*IngressRule).EnableLogging = true
+		Expect(rule.GetHash()).NotTo(Equal(hash))
+
+		ingress := newRule("10.0.0.0/16").Rule.(*IngressRule)
+		egressRule := &CloudRule{Rule: &EgressRule{
+			ToPort:           ingress.FromPort,
+			ToDstIP:          ingress.FromSrcIP,
+			ToSecurityGroups: ingress.FromSecurityGroups,
+			Protocol:         ingress.Protocol,
+		}}
+		Expect(egressRule.GetHash()).NotTo(Equal(hash))
+	})
+})
+
+var _ = Describe("Cloud name", func() {
+	BeforeEach(func() {
+		SetCloudResourcePrefix("nephe")
+	})
+
+	It("Should not shorten a name within the length limit", func() {
+		id := CloudResourceID{Name: "Web", Vpc: "vpc01"}
+		Expect(id.GetCloudName(true)).To(Equal("nephe-ag-web"))
+		Expect(id.GetCloudName(false)).To(Equal("nephe-at-web"))
+	})
+
+	It("Should shorten a long name to a valid and stable cloud name", func() {
+		longName := "ns-with-a-long-name/policy-with-a-very-long-name-exceeding-the-azure-asg-name-length-01"
+		id := CloudResourceID{Name: longName, Vpc: "vpc01"}
+		Expect(id.GetCloudName(true)).To(Equal(GetControllerAddressGroupPrefix() + longName))
+
+		cloudName := id.GetCloudNameOfProvider(runtimev1alpha1.AzureCloudProvider, true)
+		Expect(len(cloudName)).To(Equal(80))
+		Expect(cloudName).To(HavePrefix(GetControllerAddressGroupPrefix() + longName[:60]))
+		Expect(cloudName).To(MatchRegexp(`-[0-9a-f]{8}$`))
+		Expect(id.GetCloudNameOfProvider(runtimev1alpha1.AzureCloudProvider, true)).To(Equal(cloudName))
+
+		other := CloudResourceID{Name: longName[:len(longName)-1] + "2", Vpc: "vpc01"}
+		Expect(other.GetCloudNameOfProvider(runtimev1alpha1.AzureCloudProvider, true)).NotTo(Equal(cloudName))
+
+		awsName := CloudResourceID{Name: strings.Repeat(longName, 3), Vpc: "vpc01"}
+		Expect(len(awsName.GetCloudName(false))).To(Equal(MaxCloudNameLength))
+	})
+
+	It("Should recover the original name of a shortened cloud name after restart", func() {
+		longName := "ns-with-a-long-name/policy-with-a-very-long-name-exceeding-the-azure-asg-name-length-01"
+		id := CloudResourceID{Name: longName, Vpc: "vpc01"}
+		azureName := strings.TrimPrefix(id.GetCloudNameOfProvider(runtimev1alpha1.AzureCloudProvider, false),
+			GetControllerAppliedToPrefix())
+		awsID := CloudResourceID{Name: strings.Repeat(longName, 3), Vpc: "vpc01"}
+		awsName := strings.TrimPrefix(awsID.GetCloudName(true), GetControllerAddressGroupPrefix())
+
+		// Cloud names generated by a previous run are not known until the controller records its security groups.
+		SetKnownCloudNames(nil)
+		Expect(GetOriginalCloudName(azureName)).To(Equal(azureName))
+		Expect(GetOriginalCloudName(awsName)).To(Equal(awsName))
+
+		SetKnownCloudNames([]string{longName, awsID.Name, "web"})
+		Expect(GetOriginalCloudName(azureName)).To(Equal(longName))
+		Expect(GetOriginalCloudName(awsName)).To(Equal(awsID.Name))
+		Expect(GetOriginalCloudName("web")).To(Equal("web"))
+
+		// Names of deleted security groups are dropped.
+		SetKnownCloudNames([]string{"web"})
+		Expect(GetOriginalCloudName(azureName)).To(Equal(azureName))
+	})
+})
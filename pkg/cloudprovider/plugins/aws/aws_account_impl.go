@@ -19,16 +19,20 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
 )
 
 // AddProviderAccount adds and initializes given account of a cloud provider.
 func (c *awsCloud) AddProviderAccount(client client.Client, account *crdv1alpha1.CloudProviderAccount) error {
-	return c.cloudCommon.AddCloudAccount(client, account, account.Spec.AWSConfig)
+	return c.cloudCommon.AddCloudAccount(client, account, account)
 }
 
 // RemoveProviderAccount removes and cleans up any resources of given account of a cloud provider.
 func (c *awsCloud) RemoveProviderAccount(namespacedName *types.NamespacedName) {
 	c.cloudCommon.RemoveCloudAccount(namespacedName)
+	internal.SecurityMetrics.DeleteAccount(string(providerType), namespacedName.String())
+	internal.DeleteAPIErrors(string(providerType), namespacedName.String())
+	internal.EvictedInventoryVMsGauge.DeleteLabelValues(namespacedName.String(), string(providerType))
 }
 
 // AddAccountResourceSelector adds account specific resource selector.
@@ -42,7 +46,14 @@ func (c *awsCloud) RemoveAccountResourcesSelector(accNamespacedName, selectorNam
 }
 
 func (c *awsCloud) GetAccountStatus(accNamespacedName *types.NamespacedName) (*crdv1alpha1.CloudProviderAccountStatus, error) {
-	return c.cloudCommon.GetStatus(accNamespacedName)
+	status, err := c.cloudCommon.GetStatus(accNamespacedName)
+	if err != nil || status == nil {
+		return status, err
+	}
+	if accCfg, found := c.cloudCommon.GetCloudAccountByName(accNamespacedName); found {
+		status.HeldSelectors = accCfg.GetServiceConfig().(*ec2ServiceConfig).selectorHolds.Get()
+	}
+	return status, nil
 }
 
 // DoInventoryPoll calls cloud API to get cloud resources.
@@ -50,7 +61,33 @@ func (c *awsCloud) DoInventoryPoll(accountNamespacedName *types.NamespacedName)
 	return c.cloudCommon.DoInventoryPoll(accountNamespacedName)
 }
 
+// RefreshVpc calls cloud API to get the VMs of a single VPC and merges them into the cloud resources.
+func (c *awsCloud) RefreshVpc(accountNamespacedName *types.NamespacedName, vpcID string) error {
+	return c.cloudCommon.RefreshVpc(accountNamespacedName, vpcID)
+}
+
 // ResetInventoryCache resets cloud snapshot and poll stats to nil.
 func (c *awsCloud) ResetInventoryCache(accountNamespacedName *types.NamespacedName) error {
 	return c.cloudCommon.ResetInventoryCache(accountNamespacedName)
 }
+
+// SetCredentialRotationHook sets the hook invoked after the credentials of an account are rotated.
+func (c *awsCloud) SetCredentialRotationHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetCredentialRotationHook(hook)
+}
+
+// SetVpcDeletedHook sets the hook invoked after an inventory poll finds vpcs of an account deleted from cloud.
+func (c *awsCloud) SetVpcDeletedHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetVpcDeletedHook(hook)
+}
+
+// SetAccountResumedHook sets the hook invoked after a paused account is resumed.
+func (c *awsCloud) SetAccountResumedHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetAccountResumedHook(hook)
+}
+
+// SetSecurityOptionsChangedHook sets the hook invoked after account options changing how security groups are enforced
+// are updated in place.
+func (c *awsCloud) SetSecurityOptionsChangedHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetSecurityOptionsChangedHook(hook)
+}
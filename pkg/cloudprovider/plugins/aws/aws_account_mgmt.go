@@ -19,31 +19,102 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
+	"reflect"
+	"regexp"
 	"strings"
 
+	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 	"antrea.io/nephe/pkg/util"
 )
 
 type awsAccountConfig struct {
 	crdv1alpha1.AwsAccountCredential
-	region   string
-	endpoint string
+	region                      string
+	endpoint                    string
+	proxy                       *crdv1alpha1.ProxyConfig
+	inventoryTombstonePolls     int
+	maxInventoryVMs             int
+	selectorMatchSpikeThreshold int
+	egressAllowCIDRs            []*net.IPNet
+	// credentialFingerprint identifies the Secret credential, nil when it could not be resolved.
+	credentialFingerprint *utils.CredentialFingerprint
 }
 
-// setAccountCredentials sets account credentials.
+// awsRegionFormat matches region names of all AWS partitions, e.g. us-east-1, us-gov-west-1 or cn-north-1.
+var awsRegionFormat = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// ValidateAccountConfig checks the AWS specific invariants of an account config, which do not depend on the Secret
+// content or cloud access, so that they can be enforced by the validating webhook.
+func ValidateAccountConfig(account *crdv1alpha1.CloudProviderAccount) error {
+	awsConfig := account.Spec.AWSConfig
+	if awsConfig == nil {
+		return fmt.Errorf("%v: missing AWS config", util.ErrorMsgUnknownCloudProvider)
+	}
+	if err := utils.ValidateSecretRefs(awsConfig.GetSecretRefs()); err != nil {
+		return err
+	}
+	if len(awsConfig.Region) == 0 {
+		return fmt.Errorf("region cannot be empty")
+	}
+	for _, region := range awsConfig.Region {
+		if !awsRegionFormat.MatchString(strings.TrimSpace(region)) {
+			return fmt.Errorf("invalid region %q, expected format e.g. us-east-1", region)
+		}
+	}
+	return nil
+}
+
+// ValidateAccountCredential checks that an AWS credential provides either static credentials, i.e. access key id and
+// secret, or a role arn, but not both. Other fields a credential may carry along are not validated.
+func ValidateAccountCredential(cred *crdv1alpha1.AwsAccountCredential) error {
+	hasStaticCredentials := strings.TrimSpace(cred.AccessKeyID) != "" && strings.TrimSpace(cred.AccessKeySecret) != ""
+	hasRole := strings.TrimSpace(cred.RoleArn) != ""
+	if !hasRole && !hasStaticCredentials {
+		return fmt.Errorf(util.ErrorMsgMissingCredential)
+	}
+	if hasRole && hasStaticCredentials {
+		return fmt.Errorf("must specify either credentials or role arn, cannot specify both")
+	}
+	return nil
+}
+
+// setAccountCredentials sets account credentials and the options of the account annotations. Invalid annotations,
+// proxy and egress allow CIDRs are ignored and reported as error.
 func setAccountCredentials(client client.Client, credentials interface{}) (interface{}, error) {
-	awsProviderConfig := credentials.(*crdv1alpha1.CloudProviderAccountAWSConfig)
+	account := credentials.(*crdv1alpha1.CloudProviderAccount)
+	awsProviderConfig := account.Spec.AWSConfig
+	options, annotationErr := utils.ParseAccountAnnotations(account.Annotations)
+	if annotationErr != nil {
+		options = &utils.AccountOptions{}
+	}
 	awsConfig := &awsAccountConfig{
-		region:   strings.TrimSpace(awsProviderConfig.Region[0]),
-		endpoint: strings.TrimSpace(awsProviderConfig.Endpoint),
+		region:                      strings.TrimSpace(awsProviderConfig.Region[0]),
+		endpoint:                    strings.TrimSpace(awsProviderConfig.Endpoint),
+		inventoryTombstonePolls:     options.InventoryTombstonePolls,
+		maxInventoryVMs:             options.MaxInventoryVMs,
+		selectorMatchSpikeThreshold: options.SelectorMatchSpikeThreshold,
+	}
+	var proxyErr error
+	if awsProviderConfig.Proxy != nil {
+		if _, proxyErr = utils.ParseProxyURL(awsProviderConfig.Proxy.URL); proxyErr == nil {
+			awsConfig.proxy = awsProviderConfig.Proxy.DeepCopy()
+		}
 	}
-	accCred, err := extractSecret(client, awsProviderConfig.SecretRef)
+	egressAllowCIDRs, cidrErr := utils.ParseCIDRs(awsProviderConfig.EgressAllowCIDRs)
+	if cidrErr == nil {
+		awsConfig.egressAllowCIDRs = egressAllowCIDRs
+	}
+	accCred, fingerprint, err := extractSecret(client, &types.NamespacedName{Namespace: account.Namespace, Name: account.Name},
+		awsProviderConfig.GetSecretRefs())
 	if err != nil {
 		accCred.AccessKeyID = internal.AccountCredentialsDefault
 		accCred.AccessKeySecret = internal.AccountCredentialsDefault
@@ -54,47 +125,104 @@ func setAccountCredentials(client client.Client, credentials interface{}) (inter
 
 	// As only single region is supported right now, use 0th index in awsProviderConfig.Region as the configured region.
 	awsConfig.AwsAccountCredential = *accCred
-	return awsConfig, err
+	awsConfig.credentialFingerprint = fingerprint
+	return awsConfig, multierr.Combine(err, annotationErr, proxyErr, cidrErr)
 }
 
-func compareAccountCredentials(accountName string, existing interface{}, new interface{}) bool {
+// compareAccountCredentials returns whether the effective credentials, resolved from the primary or a fallback
+// Secret, or other account parameters the cloud clients are created with changed, and whether account options
+// applied in place changed.
+func compareAccountCredentials(accountName string, existing interface{}, new interface{}) (bool, bool) {
 	existingConfig := existing.(*awsAccountConfig)
 	newConfig := new.(*awsAccountConfig)
 
 	credsChanged := false
-	if strings.Compare(existingConfig.AccessKeyID, newConfig.AccessKeyID) != 0 {
+	if !existingConfig.credentialFingerprint.Equal(newConfig.credentialFingerprint) {
 		credsChanged = true
-		awsPluginLogger().Info("Account access key ID updated", "account", accountName)
+		awsPluginLogger().Info("Account credentials updated", "account", accountName,
+			"fields", utils.ChangedCredentialFields(existingConfig.credentialFingerprint, newConfig.credentialFingerprint))
 	}
-	if strings.Compare(existingConfig.AccessKeySecret, newConfig.AccessKeySecret) != 0 {
+	if strings.Compare(existingConfig.region, newConfig.region) != 0 {
 		credsChanged = true
-		awsPluginLogger().Info("Account access key secret updated", "account", accountName)
+		awsPluginLogger().Info("Account region updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.SessionToken, newConfig.SessionToken) != 0 {
+	if strings.Compare(existingConfig.endpoint, newConfig.endpoint) != 0 {
 		credsChanged = true
-		awsPluginLogger().Info("Account session token updated", "account", accountName)
+		awsPluginLogger().Info("Endpoint url updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.RoleArn, newConfig.RoleArn) != 0 {
+	if !reflect.DeepEqual(existingConfig.proxy, newConfig.proxy) {
 		credsChanged = true
-		awsPluginLogger().Info("Account IAM role updated", "account", accountName)
+		awsPluginLogger().Info("Account proxy updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.ExternalID, newConfig.ExternalID) != 0 {
-		credsChanged = true
-		awsPluginLogger().Info("Account IAM external id updated", "account", accountName)
+
+	optionsChanged := false
+	if existingConfig.inventoryTombstonePolls != newConfig.inventoryTombstonePolls {
+		optionsChanged = true
+		awsPluginLogger().Info("Account inventory tombstone polls updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.region, newConfig.region) != 0 {
-		credsChanged = true
-		awsPluginLogger().Info("Account region updated", "account", accountName)
+	if existingConfig.maxInventoryVMs != newConfig.maxInventoryVMs {
+		optionsChanged = true
+		awsPluginLogger().Info("Account max inventory VMs updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.endpoint, newConfig.endpoint) != 0 {
-		credsChanged = true
-		awsPluginLogger().Info("Endpoint url updated", "account", accountName)
+	if existingConfig.selectorMatchSpikeThreshold != newConfig.selectorMatchSpikeThreshold {
+		optionsChanged = true
+		awsPluginLogger().Info("Account selector match spike threshold updated", "account", accountName)
+	}
+	if !reflect.DeepEqual(existingConfig.egressAllowCIDRs, newConfig.egressAllowCIDRs) {
+		optionsChanged = true
+		awsPluginLogger().Info("Account egress allow CIDRs updated", "account", accountName)
+	}
+	return credsChanged, optionsChanged
+}
+
+// extractSecret extracts credentials from the first valid Kubernetes secret in secretRefs, which starts with the
+// primary secret followed by the fallback secrets. Credentials rejected by the cloud for the account are skipped,
+// unless the credentials of every valid secret were rejected, in which case the rejections are forgotten and the
+// first valid secret is used again.
+func extractSecret(c client.Client, account *types.NamespacedName, secretRefs []*crdv1alpha1.SecretReference) (
+	*crdv1alpha1.AwsAccountCredential, *utils.CredentialFingerprint, error) {
+	if len(secretRefs) == 0 {
+		return &crdv1alpha1.AwsAccountCredential{}, nil, fmt.Errorf("%w, no Secret configured", util.ErrSecretReference)
+	}
+
+	var errs error
+	var firstRejectedCred *crdv1alpha1.AwsAccountCredential
+	var firstRejectedFingerprint *utils.CredentialFingerprint
+	for i, s := range secretRefs {
+		cred, fingerprint, err := extractSecretFromReference(c, s)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		if internal.RejectedCredentials.IsRejected(account, fingerprint) {
+			errs = multierr.Append(errs, fmt.Errorf("credentials rejected by cloud: %v/%v", s.Namespace, s.Name))
+			if firstRejectedCred == nil {
+				firstRejectedCred, firstRejectedFingerprint = cred, fingerprint
+			}
+			continue
+		}
+		if i > 0 {
+			awsPluginLogger().Info("Using fallback Secret credentials", "secret", s.Namespace+"/"+s.Name, "error", errs)
+		}
+		return cred, fingerprint, nil
+	}
+	if firstRejectedCred != nil {
+		awsPluginLogger().Info("Credentials of all Secrets rejected by cloud, retrying from the first one", "account", account)
+		internal.RejectedCredentials.Forget(account)
+		return firstRejectedCred, firstRejectedFingerprint, nil
 	}
-	return credsChanged
+	return &crdv1alpha1.AwsAccountCredential{}, nil, errs
 }
 
-// extractSecret extracts credentials from a Kubernetes secret.
-func extractSecret(c client.Client, s *crdv1alpha1.SecretReference) (*crdv1alpha1.AwsAccountCredential, error) {
+// GetCredentialFingerprint returns the fingerprint of the Secret credentials, nil when they could not be resolved.
+func (c *awsAccountConfig) GetCredentialFingerprint() *utils.CredentialFingerprint {
+	return c.credentialFingerprint
+}
+
+// extractSecretFromReference extracts credentials from a Kubernetes secret, along with the fingerprint of the
+// credentials.
+func extractSecretFromReference(c client.Client, s *crdv1alpha1.SecretReference) (*crdv1alpha1.AwsAccountCredential,
+	*utils.CredentialFingerprint, error) {
 	cred := &crdv1alpha1.AwsAccountCredential{}
 	u := &unstructured.Unstructured{}
 	u.SetGroupVersionKind(schema.GroupVersionKind{
@@ -103,31 +231,35 @@ func extractSecret(c client.Client, s *crdv1alpha1.SecretReference) (*crdv1alpha
 		Version: "v1",
 	})
 	if err := c.Get(context.Background(), client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, u); err != nil {
-		return cred, fmt.Errorf("%v, failed to get Secret object: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, failed to get Secret object: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
 	data, ok := u.Object["data"].(map[string]interface{})
 	if !ok {
-		return cred, fmt.Errorf("%v, failed to get Secret data: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, failed to get Secret data: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
 	key, ok := data[s.Key].(string)
 	if !ok {
-		return cred, fmt.Errorf("%v, failed to get Secret key: %v/%v, key: %v", util.ErrorMsgSecretReference, s.Namespace, s.Name, s.Key)
+		return cred, nil, fmt.Errorf("%w, failed to get Secret key: %v/%v, key: %v", util.ErrSecretReference, s.Namespace, s.Name, s.Key)
 	}
 
 	decode, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
-		return cred, fmt.Errorf("%v, failed to decode Secret key: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, failed to decode Secret key: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
 	if err = json.Unmarshal(decode, cred); err != nil {
-		return cred, fmt.Errorf("error unmarshalling credentials: %v/%v", s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("error unmarshalling credentials: %v/%v", s.Namespace, s.Name)
 	}
 
 	if (cred.AccessKeyID == "" || cred.AccessKeySecret == "") && cred.RoleArn == "" {
-		return cred, fmt.Errorf("%v, Secret credentials cannot be empty: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, Secret credentials cannot be empty: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
-	return cred, nil
+	fingerprint, err := utils.NewCredentialFingerprint(decode)
+	if err != nil {
+		return cred, nil, fmt.Errorf("%w, failed to fingerprint Secret credentials: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
+	}
+	return cred, fingerprint, nil
 }
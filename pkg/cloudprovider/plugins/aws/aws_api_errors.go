@@ -0,0 +1,101 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+)
+
+// awsAuthErrorCodes are the AWS error codes of authentication and authorization failures.
+var awsAuthErrorCodes = map[string]struct{}{
+	"AuthFailure":                {},
+	"UnauthorizedOperation":      {},
+	"InvalidClientTokenId":       {},
+	"ExpiredToken":               {},
+	"RequestExpired":             {},
+	"AccessDenied":               {},
+	"AccessDeniedException":      {},
+	"SignatureDoesNotMatch":      {},
+	"OptInRequired":              {},
+	"NoCredentialProviders":      {},
+	"InvalidAccessKeyId":         {},
+	"IncompleteSignature":        {},
+	"MissingAuthenticationToken": {},
+}
+
+// awsCredentialsErrorCodes are the AWS error codes of credentials rejected by AWS, as opposed to credentials lacking
+// permissions.
+var awsCredentialsErrorCodes = map[string]struct{}{
+	"AuthFailure":                {},
+	"InvalidClientTokenId":       {},
+	"ExpiredToken":               {},
+	"SignatureDoesNotMatch":      {},
+	"NoCredentialProviders":      {},
+	"InvalidAccessKeyId":         {},
+	"IncompleteSignature":        {},
+	"MissingAuthenticationToken": {},
+}
+
+// awsServerErrorCodes are the AWS error codes of failures of the cloud service.
+var awsServerErrorCodes = map[string]struct{}{
+	"InternalError":      {},
+	"InternalFailure":    {},
+	"ServiceUnavailable": {},
+	"Unavailable":        {},
+}
+
+// classifyAWSError returns the error class of a failed AWS API call.
+func classifyAWSError(err error) internal.APIErrorClass {
+	if request.IsErrorThrottle(err) {
+		return internal.APIErrorClassThrottle
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		code := awsErr.Code()
+		if _, ok := awsAuthErrorCodes[code]; ok {
+			return internal.APIErrorClassAuth
+		}
+		if _, ok := awsServerErrorCodes[code]; ok {
+			return internal.APIErrorClassServerError
+		}
+		// EC2 reports missing resources with codes like InvalidInstanceID.NotFound.
+		if strings.HasSuffix(code, "NotFound") {
+			return internal.APIErrorClassNotFound
+		}
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		if class, ok := internal.ClassifyHTTPStatus(reqErr.StatusCode()); ok {
+			return class
+		}
+	}
+	return internal.APIErrorClassOther
+}
+
+// isCredentialsRejectedError returns true if err reports that AWS rejected the credentials of the account.
+func isCredentialsRejectedError(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	_, ok := awsCredentialsErrorCodes[awsErr.Code()]
+	return ok
+}
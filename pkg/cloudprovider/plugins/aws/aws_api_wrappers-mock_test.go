@@ -20,6 +20,7 @@
 package aws
 
 import (
+	context "context"
 	reflect "reflect"
 
 	ec2 "github.com/aws/aws-sdk-go/service/ec2"
@@ -109,6 +110,21 @@ func (mr *MockawsEC2WrapperMockRecorder) deleteSecurityGroup(input interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "deleteSecurityGroup", reflect.TypeOf((*MockawsEC2Wrapper)(nil).deleteSecurityGroup), input)
 }
 
+// dryRun mocks base method.
+func (m *MockawsEC2Wrapper) dryRun(ctx context.Context, action, vpcID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "dryRun", ctx, action, vpcID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// dryRun indicates an expected call of dryRun.
+func (mr *MockawsEC2WrapperMockRecorder) dryRun(ctx, action, vpcID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "dryRun", reflect.TypeOf((*MockawsEC2Wrapper)(nil).dryRun), ctx, action, vpcID)
+}
+
 // describeSecurityGroups mocks base method.
 func (m *MockawsEC2Wrapper) describeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
 	m.ctrl.T.Helper()
@@ -125,33 +141,33 @@ func (mr *MockawsEC2WrapperMockRecorder) describeSecurityGroups(input interface{
 }
 
 // describeVpcPeeringConnectionsWrapper mocks base method.
-func (m *MockawsEC2Wrapper) describeVpcPeeringConnectionsWrapper(input *ec2.DescribeVpcPeeringConnectionsInput) (*ec2.DescribeVpcPeeringConnectionsOutput, error) {
+func (m *MockawsEC2Wrapper) describeVpcPeeringConnectionsWrapper(ctx context.Context, input *ec2.DescribeVpcPeeringConnectionsInput) (*ec2.DescribeVpcPeeringConnectionsOutput, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "describeVpcPeeringConnectionsWrapper", input)
+	ret := m.ctrl.Call(m, "describeVpcPeeringConnectionsWrapper", ctx, input)
 	ret0, _ := ret[0].(*ec2.DescribeVpcPeeringConnectionsOutput)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // describeVpcPeeringConnectionsWrapper indicates an expected call of describeVpcPeeringConnectionsWrapper.
-func (mr *MockawsEC2WrapperMockRecorder) describeVpcPeeringConnectionsWrapper(input interface{}) *gomock.Call {
+func (mr *MockawsEC2WrapperMockRecorder) describeVpcPeeringConnectionsWrapper(ctx, input interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "describeVpcPeeringConnectionsWrapper", reflect.TypeOf((*MockawsEC2Wrapper)(nil).describeVpcPeeringConnectionsWrapper), input)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "describeVpcPeeringConnectionsWrapper", reflect.TypeOf((*MockawsEC2Wrapper)(nil).describeVpcPeeringConnectionsWrapper), ctx, input)
 }
 
 // describeVpcsWrapper mocks base method.
-func (m *MockawsEC2Wrapper) describeVpcsWrapper(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+func (m *MockawsEC2Wrapper) describeVpcsWrapper(ctx context.Context, input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "describeVpcsWrapper", input)
+	ret := m.ctrl.Call(m, "describeVpcsWrapper", ctx, input)
 	ret0, _ := ret[0].(*ec2.DescribeVpcsOutput)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // describeVpcsWrapper indicates an expected call of describeVpcsWrapper.
-func (mr *MockawsEC2WrapperMockRecorder) describeVpcsWrapper(input interface{}) *gomock.Call {
+func (mr *MockawsEC2WrapperMockRecorder) describeVpcsWrapper(ctx, input interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "describeVpcsWrapper", reflect.TypeOf((*MockawsEC2Wrapper)(nil).describeVpcsWrapper), input)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "describeVpcsWrapper", reflect.TypeOf((*MockawsEC2Wrapper)(nil).describeVpcsWrapper), ctx, input)
 }
 
 // modifyNetworkInterfaceAttribute mocks base method.
@@ -170,18 +186,18 @@ func (mr *MockawsEC2WrapperMockRecorder) modifyNetworkInterfaceAttribute(input i
 }
 
 // pagedDescribeInstancesWrapper mocks base method.
-func (m *MockawsEC2Wrapper) pagedDescribeInstancesWrapper(input *ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
+func (m *MockawsEC2Wrapper) pagedDescribeInstancesWrapper(ctx context.Context, input *ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "pagedDescribeInstancesWrapper", input)
+	ret := m.ctrl.Call(m, "pagedDescribeInstancesWrapper", ctx, input)
 	ret0, _ := ret[0].([]*ec2.Instance)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // pagedDescribeInstancesWrapper indicates an expected call of pagedDescribeInstancesWrapper.
-func (mr *MockawsEC2WrapperMockRecorder) pagedDescribeInstancesWrapper(input interface{}) *gomock.Call {
+func (mr *MockawsEC2WrapperMockRecorder) pagedDescribeInstancesWrapper(ctx, input interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "pagedDescribeInstancesWrapper", reflect.TypeOf((*MockawsEC2Wrapper)(nil).pagedDescribeInstancesWrapper), input)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "pagedDescribeInstancesWrapper", reflect.TypeOf((*MockawsEC2Wrapper)(nil).pagedDescribeInstancesWrapper), ctx, input)
 }
 
 // pagedDescribeNetworkInterfaces mocks base method.
@@ -15,16 +15,19 @@
 package aws
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 )
 
 // awsEC2Wrapper is layer above aws EC2 sdk apis to allow for unit-testing.
 type awsEC2Wrapper interface {
 	// instances
-	pagedDescribeInstancesWrapper(input *ec2.DescribeInstancesInput) ([]*ec2.Instance, error)
+	pagedDescribeInstancesWrapper(ctx context.Context, input *ec2.DescribeInstancesInput) ([]*ec2.Instance, error)
 
 	// network interfaces
 	pagedDescribeNetworkInterfaces(input *ec2.DescribeNetworkInterfacesInput) ([]*ec2.NetworkInterface, error)
@@ -40,20 +43,25 @@ type awsEC2Wrapper interface {
 	revokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error)
 
 	// vpcs
-	describeVpcsWrapper(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error)
+	describeVpcsWrapper(ctx context.Context, input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error)
 
 	// peer connections
-	describeVpcPeeringConnectionsWrapper(input *ec2.DescribeVpcPeeringConnectionsInput) (*ec2.DescribeVpcPeeringConnectionsOutput, error)
+	describeVpcPeeringConnectionsWrapper(ctx context.Context, input *ec2.DescribeVpcPeeringConnectionsInput) (
+		*ec2.DescribeVpcPeeringConnectionsOutput, error)
+
+	// permissions
+	dryRun(ctx context.Context, action string, vpcID string) (bool, error)
 }
 type awsEC2WrapperImpl struct {
 	ec2 *ec2.EC2
 }
 
-func (ec2Wrapper *awsEC2WrapperImpl) pagedDescribeInstancesWrapper(input *ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
+func (ec2Wrapper *awsEC2WrapperImpl) pagedDescribeInstancesWrapper(ctx context.Context,
+	input *ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
 	var instances []*ec2.Instance
 	var nextToken *string
 	for {
-		response, err := ec2Wrapper.ec2.DescribeInstances(input)
+		response, err := ec2Wrapper.ec2.DescribeInstancesWithContext(ctx, input)
 		if err != nil {
 			return nil, fmt.Errorf("error describing ec2 instances: %q", err)
 		}
@@ -132,15 +140,58 @@ func (ec2Wrapper *awsEC2WrapperImpl) revokeSecurityGroupIngress(input *ec2.Revok
 	return ec2Wrapper.ec2.RevokeSecurityGroupIngress(input)
 }
 
-func (ec2Wrapper *awsEC2WrapperImpl) describeVpcsWrapper(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
-	vpcs, err := ec2Wrapper.ec2.DescribeVpcs(input)
+func (ec2Wrapper *awsEC2WrapperImpl) describeVpcsWrapper(ctx context.Context,
+	input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	vpcs, err := ec2Wrapper.ec2.DescribeVpcsWithContext(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("error describing ec2 vpcs: %q", err)
 	}
 	return vpcs, nil
 }
 
-func (ec2Wrapper *awsEC2WrapperImpl) describeVpcPeeringConnectionsWrapper(input *ec2.DescribeVpcPeeringConnectionsInput) (
-	*ec2.DescribeVpcPeeringConnectionsOutput, error) {
-	return ec2Wrapper.ec2.DescribeVpcPeeringConnections(input)
+func (ec2Wrapper *awsEC2WrapperImpl) describeVpcPeeringConnectionsWrapper(ctx context.Context,
+	input *ec2.DescribeVpcPeeringConnectionsInput) (*ec2.DescribeVpcPeeringConnectionsOutput, error) {
+	return ec2Wrapper.ec2.DescribeVpcPeeringConnectionsWithContext(ctx, input)
+}
+
+// dryRun dry runs an action, in vpcID for actions creating a resource, and returns whether the credentials are
+// permitted to perform it.
+func (ec2Wrapper *awsEC2WrapperImpl) dryRun(ctx context.Context, action string, vpcID string) (bool, error) {
+	var err error
+	switch action {
+	case actionDescribeInstances:
+		_, err = ec2Wrapper.ec2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{DryRun: aws.Bool(true)})
+	case actionDescribeVpcs:
+		_, err = ec2Wrapper.ec2.DescribeVpcsWithContext(ctx, &ec2.DescribeVpcsInput{DryRun: aws.Bool(true)})
+	case actionDescribeVpcPeeringConnections:
+		_, err = ec2Wrapper.ec2.DescribeVpcPeeringConnectionsWithContext(ctx,
+			&ec2.DescribeVpcPeeringConnectionsInput{DryRun: aws.Bool(true)})
+	case actionDescribeSecurityGroups:
+		_, err = ec2Wrapper.ec2.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{DryRun: aws.Bool(true)})
+	case actionDescribeNetworkInterfaces:
+		_, err = ec2Wrapper.ec2.DescribeNetworkInterfacesWithContext(ctx,
+			&ec2.DescribeNetworkInterfacesInput{DryRun: aws.Bool(true)})
+	case actionCreateSecurityGroup:
+		_, err = ec2Wrapper.ec2.CreateSecurityGroupWithContext(ctx, &ec2.CreateSecurityGroupInput{
+			DryRun:      aws.Bool(true),
+			GroupName:   aws.String(permissionProbeGroupName),
+			Description: aws.String(permissionProbeGroupName),
+			VpcId:       aws.String(vpcID),
+		})
+	default:
+		return false, fmt.Errorf("dry run of action %v not supported", action)
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "DryRunOperation":
+			return true, nil
+		case "UnauthorizedOperation":
+			return false, nil
+		}
+	}
+	if err == nil {
+		return true, nil
+	}
+	return false, fmt.Errorf("error dry running %v: %w", action, err)
 }
@@ -29,3 +29,7 @@ func (h *awsCloudCommonHelperImpl) SetAccountCredentialsFunc() internal.CloudCre
 func (h *awsCloudCommonHelperImpl) GetCloudCredentialsComparatorFunc() internal.CloudCredentialComparatorFunc {
 	return compareAccountCredentials
 }
+
+func (h *awsCloudCommonHelperImpl) GetCredentialsRejectedFunc() internal.CredentialsRejectedFunc {
+	return isCredentialsRejectedError
+}
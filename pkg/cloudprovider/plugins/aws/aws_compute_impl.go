@@ -15,8 +15,12 @@
 package aws
 
 import (
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/types"
 
+	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	nephetypes "antrea.io/nephe/pkg/types"
 )
 
@@ -24,3 +28,34 @@ import (
 func (c *awsCloud) GetCloudInventory(accountNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, error) {
 	return c.cloudCommon.GetCloudInventory(accountNamespacedName)
 }
+
+// GetSnapshotFootprint returns nil, the memory footprint of the internal snapshot is not estimated.
+func (c *awsCloud) GetSnapshotFootprint(accountNamespacedName *types.NamespacedName) (*nephetypes.SnapshotFootprint, error) {
+	return c.cloudCommon.GetSnapshotFootprint(accountNamespacedName)
+}
+
+// GetMatchingSelectors returns the selectors which matched the VM in internal snapshot.
+func (c *awsCloud) GetMatchingSelectors(accNamespacedName *types.NamespacedName, instanceID string) ([]string, error) {
+	return c.cloudCommon.GetMatchingSelectors(accNamespacedName, instanceID)
+}
+
+// GetSelectorCloudInventory pulls the VMs matched by the selector and their vpcs from internal snapshot.
+func (c *awsCloud) GetSelectorCloudInventory(accNamespacedName, selectorNamespacedName *types.NamespacedName) (
+	*nephetypes.CloudInventory, error) {
+	return c.cloudCommon.GetSelectorCloudInventory(accNamespacedName, selectorNamespacedName)
+}
+
+// PreviewSelector returns the VMs the selector would match, without adding the selector.
+func (c *awsCloud) PreviewSelector(accNamespacedName *types.NamespacedName,
+	selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error) {
+	return c.cloudCommon.PreviewSelector(accNamespacedName, selector)
+}
+
+// GetVpcPeerings returns the peering connections of the vpcs of the account from internal snapshot.
+func (c *awsCloud) GetVpcPeerings(accNamespacedName *types.NamespacedName) ([]nephetypes.VpcPeering, error) {
+	accCfg, found := c.cloudCommon.GetCloudAccountByName(accNamespacedName)
+	if !found {
+		return nil, fmt.Errorf("unable to find cloud account config")
+	}
+	return accCfg.GetServiceConfig().(*ec2ServiceConfig).getVpcPeerings(), nil
+}
@@ -17,7 +17,6 @@ package aws
 import (
 	"fmt"
 	"net"
-	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -28,17 +27,23 @@ import (
 	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
-func convertToIPPermissionProtocol(protocol *int) *string {
+// convertToIPPermissionProtocol converts a protocol number to the IP protocol of an AWS rule. A nil protocol number is
+// any protocol.
+func convertToIPPermissionProtocol(protocol *int) (*string, error) {
 	if protocol == nil {
-		return aws.String(awsAnyProtocolValue)
+		return aws.String(awsAnyProtocolValue), nil
 	}
-	return aws.String(strconv.FormatInt(int64(*protocol), 10))
+	ipProtocol, err := utils.ProtocolToAWS(*protocol)
+	if err != nil {
+		return nil, err
+	}
+	return aws.String(ipProtocol), nil
 }
 
 func convertToIPPermissionPort(port *int, protocol *int) (*int64, *int64) {
 	if port == nil {
 		// For TCP and UDP, aws expects explicit start and end port numbers (for all ports case)
-		if protocol != nil && (*protocol == 6 || *protocol == 17) {
+		if protocol != nil && (*protocol == utils.ProtocolTCP || *protocol == utils.ProtocolUDP) {
 			return aws.Int64(int64(tcpUDPPortStart)), aws.Int64(int64(tcpUDPPortEnd))
 		}
 		return nil, nil
@@ -138,26 +143,44 @@ func convertFromSecurityGroupPair(cloudGroups []*ec2.UserIdGroupPair, managedSGs
 	return cloudResourceIDs, desc
 }
 
+// warnUnsupportedRuleLogging logs that rule logging is ignored, once per policy in loggingPolicies.
+func warnUnsupportedRuleLogging(loggingPolicies map[string]struct{}, enableLogging bool, policy string) {
+	if !enableLogging {
+		return
+	}
+	if _, found := loggingPolicies[policy]; found {
+		return
+	}
+	loggingPolicies[policy] = struct{}{}
+	awsPluginLogger().Info("Rule logging is not supported by AWS security groups, ignoring", "policy", policy)
+}
+
 // convertIngressToIpPermission converts internal ingress CloudRules into AWS IpPermissions.
 func convertIngressToIpPermission(rules []*cloudresource.CloudRule, cloudSGNameToObj map[string]*ec2.SecurityGroup) (
 	[]*ec2.IpPermission, error) {
 	ipPermissions := make([]*ec2.IpPermission, 0)
+	loggingPolicies := make(map[string]struct{})
 	for _, obj := range rules {
 		rule := obj.Rule.(*cloudresource.IngressRule)
 		if rule == nil {
 			continue
 		}
-		description, err := utils.GenerateCloudDescription(obj.NpNamespacedName)
+		warnUnsupportedRuleLogging(loggingPolicies, rule.EnableLogging, obj.NpNamespacedName)
+		description, err := utils.GenerateCloudDescriptionWithAnnotations(obj.NpNamespacedName, obj.NpUID, false, obj.Annotations)
 		if err != nil {
 			return nil, fmt.Errorf("unable to generate rule description, err: %v", err)
 		}
 		idGroupPairs := buildEc2UserIDGroupPairs(rule.FromSecurityGroups, cloudSGNameToObj, &description)
 		ipv4Ranges, ipv6Ranges := convertToEc2IpRanges(rule.FromSrcIP, len(rule.FromSecurityGroups) > 0, &description)
+		ipProtocol, err := convertToIPPermissionProtocol(rule.Protocol)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert rule of %v, err: %v", obj.NpNamespacedName, err)
+		}
 		startPort, endPort := convertToIPPermissionPort(rule.FromPort, rule.Protocol)
 		ipPermission := &ec2.IpPermission{
 			FromPort:         startPort,
 			ToPort:           endPort,
-			IpProtocol:       convertToIPPermissionProtocol(rule.Protocol),
+			IpProtocol:       ipProtocol,
 			IpRanges:         ipv4Ranges,
 			Ipv6Ranges:       ipv6Ranges,
 			UserIdGroupPairs: idGroupPairs,
@@ -171,23 +194,29 @@ func convertIngressToIpPermission(rules []*cloudresource.CloudRule, cloudSGNameT
 func convertEgressToIpPermission(rules []*cloudresource.CloudRule, cloudSGNameToObj map[string]*ec2.SecurityGroup) (
 	[]*ec2.IpPermission, error) {
 	ipPermissions := make([]*ec2.IpPermission, 0)
+	loggingPolicies := make(map[string]struct{})
 	for _, obj := range rules {
 		rule := obj.Rule.(*cloudresource.EgressRule)
 		if rule == nil {
 			continue
 		}
-		description, err := utils.GenerateCloudDescription(obj.NpNamespacedName)
+		warnUnsupportedRuleLogging(loggingPolicies, rule.EnableLogging, obj.NpNamespacedName)
+		description, err := utils.GenerateCloudDescriptionWithAnnotations(obj.NpNamespacedName, obj.NpUID, false, obj.Annotations)
 		if err != nil {
 			return nil, fmt.Errorf("unable to generate rule description, err: %v", err)
 		}
 
 		idGroupPairs := buildEc2UserIDGroupPairs(rule.ToSecurityGroups, cloudSGNameToObj, &description)
 		ipv4Ranges, ipv6Ranges := convertToEc2IpRanges(rule.ToDstIP, len(rule.ToSecurityGroups) > 0, &description)
+		ipProtocol, err := convertToIPPermissionProtocol(rule.Protocol)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert rule of %v, err: %v", obj.NpNamespacedName, err)
+		}
 		startPort, endPort := convertToIPPermissionPort(rule.ToPort, rule.Protocol)
 		ipPermission := &ec2.IpPermission{
 			FromPort:         startPort,
 			ToPort:           endPort,
-			IpProtocol:       convertToIPPermissionProtocol(rule.Protocol),
+			IpProtocol:       ipProtocol,
 			IpRanges:         ipv4Ranges,
 			Ipv6Ranges:       ipv6Ranges,
 			UserIdGroupPairs: idGroupPairs,
@@ -203,6 +232,11 @@ func convertFromIngressIpPermissionToCloudRule(sgID string, ipPermissions []*ec2
 	managedSGs, unmanagedSGs map[string]*ec2.SecurityGroup) []cloudresource.CloudRule {
 	var ingressRules []cloudresource.CloudRule
 	for _, ipPermission := range ipPermissions {
+		protocol, err := convertFromIPPermissionProtocol(*ipPermission.IpProtocol)
+		if err != nil {
+			awsPluginLogger().Error(err, "failed to convert rule protocol, skipping rule", "securityGroup", sgID)
+			continue
+		}
 		fromSrcIPs, descriptions := convertFromIPRange(ipPermission.IpRanges, ipPermission.Ipv6Ranges)
 		for i, srcIP := range fromSrcIPs {
 			// Get cloud rule description.
@@ -211,12 +245,14 @@ func convertFromIngressIpPermissionToCloudRule(sgID string, ipPermissions []*ec2
 				Rule: &cloudresource.IngressRule{
 					FromPort:  convertFromIPPermissionPort(ipPermission.FromPort, ipPermission.ToPort),
 					FromSrcIP: []*net.IPNet{srcIP},
-					Protocol:  convertFromIPPermissionProtocol(*ipPermission.IpProtocol),
+					Protocol:  protocol,
 				},
 				AppliedToGrp: sgID,
 			}
 			if ok {
 				ingressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+				ingressRule.NpUID = desc.UID
+				ingressRule.Annotations = desc.Annotations
 			}
 			ingressRule.Hash = ingressRule.GetHash()
 			ingressRules = append(ingressRules, ingressRule)
@@ -229,12 +265,14 @@ func convertFromIngressIpPermissionToCloudRule(sgID string, ipPermissions []*ec2
 				Rule: &cloudresource.IngressRule{
 					FromPort:           convertFromIPPermissionPort(ipPermission.FromPort, ipPermission.ToPort),
 					FromSecurityGroups: []*cloudresource.CloudResourceID{SecurityGroup},
-					Protocol:           convertFromIPPermissionProtocol(*ipPermission.IpProtocol),
+					Protocol:           protocol,
 				},
 				AppliedToGrp: sgID,
 			}
 			if ok {
 				ingressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+				ingressRule.NpUID = desc.UID
+				ingressRule.Annotations = desc.Annotations
 			}
 			ingressRule.Hash = ingressRule.GetHash()
 			ingressRules = append(ingressRules, ingressRule)
@@ -249,20 +287,31 @@ func convertFromEgressIpPermissionToCloudRule(sgID string, ipPermissions []*ec2.
 	managedSGs, unmanagedSGs map[string]*ec2.SecurityGroup) []cloudresource.CloudRule {
 	var egressRules []cloudresource.CloudRule
 	for _, ipPermission := range ipPermissions {
+		protocol, err := convertFromIPPermissionProtocol(*ipPermission.IpProtocol)
+		if err != nil {
+			awsPluginLogger().Error(err, "failed to convert rule protocol, skipping rule", "securityGroup", sgID)
+			continue
+		}
 		toDstIPs, descriptions := convertFromIPRange(ipPermission.IpRanges, ipPermission.Ipv6Ranges)
 		for i, dstIP := range toDstIPs {
+			// allow-list rules are not owned by any network policy, they are rebuilt on each rule update.
+			if utils.IsEgressAllowListRuleDescription(descriptions[i]) {
+				continue
+			}
 			// Get cloud rule description.
 			desc, ok := utils.ExtractCloudDescription(descriptions[i])
 			egressRule := cloudresource.CloudRule{
 				Rule: &cloudresource.EgressRule{
 					ToPort:   convertFromIPPermissionPort(ipPermission.FromPort, ipPermission.ToPort),
 					ToDstIP:  []*net.IPNet{dstIP},
-					Protocol: convertFromIPPermissionProtocol(*ipPermission.IpProtocol),
+					Protocol: protocol,
 				},
 				AppliedToGrp: sgID,
 			}
 			if ok {
 				egressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+				egressRule.NpUID = desc.UID
+				egressRule.Annotations = desc.Annotations
 			}
 			egressRule.Hash = egressRule.GetHash()
 			egressRules = append(egressRules, egressRule)
@@ -275,12 +324,14 @@ func convertFromEgressIpPermissionToCloudRule(sgID string, ipPermissions []*ec2.
 				Rule: &cloudresource.EgressRule{
 					ToPort:           convertFromIPPermissionPort(ipPermission.FromPort, ipPermission.ToPort),
 					ToSecurityGroups: []*cloudresource.CloudResourceID{SecurityGroup},
-					Protocol:         convertFromIPPermissionProtocol(*ipPermission.IpProtocol),
+					Protocol:         protocol,
 				},
 				AppliedToGrp: sgID,
 			}
 			if ok {
 				egressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+				egressRule.NpUID = desc.UID
+				egressRule.Annotations = desc.Annotations
 			}
 			egressRule.Hash = egressRule.GetHash()
 			egressRules = append(egressRules, egressRule)
@@ -308,10 +359,15 @@ func convertFromIPPermissionPort(startPort *int64, endPort *int64) *int {
 	return nil
 }
 
-func convertFromIPPermissionProtocol(proto string) *int {
+// convertFromIPPermissionProtocol converts the IP protocol of an AWS rule to a protocol number. Any protocol is
+// converted to nil, and an unsupported protocol returns an error.
+func convertFromIPPermissionProtocol(proto string) (*int, error) {
 	if strings.Compare(proto, awsAnyProtocolValue) == 0 {
-		return nil
+		return nil, nil
+	}
+	protoNum, err := utils.ProtocolFromAWS(proto)
+	if err != nil {
+		return nil, err
 	}
-	protoNum := protocolNameNumMap[strings.ToLower(proto)]
-	return &protoNum
+	return &protoNum, nil
 }
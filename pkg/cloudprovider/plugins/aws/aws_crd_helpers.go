@@ -45,6 +45,7 @@ func ec2InstanceToInternalVirtualMachineObject(instance *ec2.Instance, vpcs map[
 	// Network interfaces associated with Virtual machine
 	instNetworkInterfaces := instance.NetworkInterfaces
 	networkInterfaces := make([]runtimev1alpha1.NetworkInterface, 0, len(instNetworkInterfaces))
+	hasPublicIP := false
 
 	for _, nwInf := range instNetworkInterfaces {
 		var ipAddressObjs []runtimev1alpha1.IPAddress
@@ -54,11 +55,13 @@ func ec2InstanceToInternalVirtualMachineObject(instance *ec2.Instance, vpcs map[
 				ipAddressCRD := runtimev1alpha1.IPAddress{
 					AddressType: runtimev1alpha1.AddressTypeInternalIP,
 					Address:     *ipAddress.PrivateIpAddress,
+					Primary:     ipAddress.Primary != nil && *ipAddress.Primary,
 				}
 				ipAddressObjs = append(ipAddressObjs, ipAddressCRD)
 
 				association := ipAddress.Association
 				if association != nil {
+					hasPublicIP = true
 					ipAddressCRD := runtimev1alpha1.IPAddress{
 						AddressType: runtimev1alpha1.AddressTypeExternalIP,
 						Address:     *association.PublicIp,
@@ -91,7 +94,10 @@ func ec2InstanceToInternalVirtualMachineObject(instance *ec2.Instance, vpcs map[
 	cloudNetwork := *instance.VpcId
 
 	vpcName := extractVpcName(vpcs, strings.ToLower(cloudNetwork))
-
+	var size string
+	if instance.InstanceType != nil {
+		size = *instance.InstanceType
+	}
 	vmStatus := &runtimev1alpha1.VirtualMachineStatus{
 		Provider:          runtimev1alpha1.AWSCloudProvider,
 		Tags:              importedTags,
@@ -103,6 +109,9 @@ func ec2InstanceToInternalVirtualMachineObject(instance *ec2.Instance, vpcs map[
 		CloudName:         strings.ToLower(cloudName),
 		CloudVpcId:        strings.ToLower(cloudNetwork),
 		CloudVpcName:      vpcName,
+		HasPublicIP:       hasPublicIP,
+		OSFamily:          getInstanceOSFamily(instance),
+		Size:              size,
 	}
 
 	labelsMap := map[string]string{
@@ -15,7 +15,9 @@
 package aws
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -28,6 +30,7 @@ import (
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 	nephetypes "antrea.io/nephe/pkg/types"
 )
 
@@ -37,9 +40,15 @@ type ec2ServiceConfig struct {
 	credentials           *awsAccountConfig
 	resourcesCache        *internal.CloudServiceResourcesCache
 	inventoryStats        *internal.CloudServiceStats
+	vmTombstones          *internal.VMTombstones
+	selectorHolds         *internal.SelectorHolds
 	instanceFilters       map[types.NamespacedName][][]*ec2.Filter
 	// selectors required for updating resource filters on account config update.
 	selectors map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector
+	// selectorAliases maps selectors identical to another selector to the selector holding their instanceFilters.
+	selectorAliases map[types.NamespacedName]types.NamespacedName
+	// permissionVpcIDs are the vpcs of the selected VMs, in which the permissions of the credentials are probed.
+	permissionVpcIDs []string
 }
 
 // ec2ResourcesCacheSnapshot holds the results from querying for all instances.
@@ -49,6 +58,7 @@ type ec2ResourcesCacheSnapshot struct {
 	managedVpcIDs map[string]struct{}
 	vpcNameToID   map[string]string
 	vpcPeers      map[string][]string
+	vpcPeerings   []nephetypes.VpcPeering
 }
 
 func newEC2ServiceConfig(accountNamespacedName types.NamespacedName, service awsServiceClientCreateInterface,
@@ -64,13 +74,19 @@ func newEC2ServiceConfig(accountNamespacedName types.NamespacedName, service aws
 		accountNamespacedName: accountNamespacedName,
 		resourcesCache:        &internal.CloudServiceResourcesCache{},
 		inventoryStats:        &internal.CloudServiceStats{},
+		vmTombstones:          internal.NewVMTombstones(),
+		selectorHolds:         internal.NewSelectorHolds(),
 		credentials:           credentials,
 		instanceFilters:       make(map[types.NamespacedName][][]*ec2.Filter),
 		selectors:             make(map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector),
+		selectorAliases:       make(map[types.NamespacedName]types.NamespacedName),
 	}
 
+	config.vmTombstones.SetPolls(credentials.inventoryTombstonePolls)
+	config.selectorHolds.SetThreshold(credentials.selectorMatchSpikeThreshold)
+
 	vmSnapshot := make(map[types.NamespacedName][]*ec2.Instance)
-	config.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{vmSnapshot, nil, nil, nil, nil})
+	config.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{vmSnapshot, nil, nil, nil, nil, nil})
 	return config, nil
 }
 
@@ -197,15 +213,32 @@ func (ec2Cfg *ec2ServiceConfig) getVpcPeers(vpcID string) []string {
 	return vpcPeersCopy
 }
 
+// getVpcPeerings returns the peering connections of the cached vpcs.
+func (ec2Cfg *ec2ServiceConfig) getVpcPeerings() []nephetypes.VpcPeering {
+	snapshot, ok := ec2Cfg.resourcesCache.GetSnapshot().(*ec2ResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return nil
+	}
+	return deepcopy.Copy(snapshot.vpcPeerings).([]nephetypes.VpcPeering)
+}
+
 // getInstances gets instances from cloud matching the given selector configuration.
-func (ec2Cfg *ec2ServiceConfig) getInstances(namespacedName *types.NamespacedName) ([]*ec2.Instance, error) {
-	var instances []*ec2.Instance
+func (ec2Cfg *ec2ServiceConfig) getInstances(ctx context.Context,
+	namespacedName *types.NamespacedName) ([]*ec2.Instance, error) {
 	filters, found := ec2Cfg.instanceFilters[*namespacedName]
 	if found && len(filters) != 0 {
 		awsPluginLogger().V(1).Info("Fetching vm resources from cloud", "account", ec2Cfg.accountNamespacedName,
 			"selector", namespacedName, "resource-filters", "configured")
 	}
+	return ec2Cfg.getInstancesByFilters(ctx, namespacedName, filters)
+}
+
+// getInstancesByFilters gets instances from cloud matching the given instance filters of a selector.
+func (ec2Cfg *ec2ServiceConfig) getInstancesByFilters(ctx context.Context, namespacedName *types.NamespacedName,
+	filters [][]*ec2.Filter) ([]*ec2.Instance, error) {
+	var instances []*ec2.Instance
 	for _, filter := range filters {
+		filter, osFamily := splitOSFamilyFilter(filter)
 		if len(filter) > 0 {
 			if *filter[0].Name == awsCustomFilterKeyVPCName {
 				filter = buildFilterForVPCIDFromFilterForVPCName(filter, ec2Cfg.getCachedVpcNameToID())
@@ -215,11 +248,16 @@ func (ec2Cfg *ec2ServiceConfig) getInstances(namespacedName *types.NamespacedNam
 			MaxResults: aws.Int64(internal.MaxCloudResourceResponse),
 			Filters:    filter,
 		}
-		filterInstances, err := ec2Cfg.apiClient.pagedDescribeInstancesWrapper(request)
+		filterInstances, err := ec2Cfg.apiClient.pagedDescribeInstancesWrapper(ctx, request)
 		if err != nil {
 			return nil, err
 		}
-		instances = append(instances, filterInstances...)
+		for _, instance := range filterInstances {
+			// os family is not supported by aws filters, instances are matched once fetched.
+			if len(osFamily) == 0 || getInstanceOSFamily(instance) == osFamily {
+				instances = append(instances, instance)
+			}
+		}
 	}
 	awsPluginLogger().Info("Vm instances from cloud", "account", ec2Cfg.accountNamespacedName,
 		"selector", namespacedName, "instances", len(instances))
@@ -228,8 +266,8 @@ func (ec2Cfg *ec2ServiceConfig) getInstances(namespacedName *types.NamespacedNam
 }
 
 // DoResourceInventory gets inventory from cloud for a given cloud account.
-func (ec2Cfg *ec2ServiceConfig) DoResourceInventory() error {
-	vpcs, err := ec2Cfg.getVpcs()
+func (ec2Cfg *ec2ServiceConfig) DoResourceInventory(ctx context.Context) error {
+	vpcs, err := ec2Cfg.getVpcs(ctx)
 	if err != nil {
 		awsPluginLogger().Error(err, "failed to fetch cloud resources", "account", ec2Cfg.accountNamespacedName)
 		return err
@@ -237,34 +275,161 @@ func (ec2Cfg *ec2ServiceConfig) DoResourceInventory() error {
 	awsPluginLogger().V(1).Info("Vpcs from cloud", "account", ec2Cfg.accountNamespacedName,
 		"vpcs", len(vpcs))
 	vpcNameToID := ec2Cfg.buildMapVpcNameToID(vpcs)
-	vpcPeers, _ := ec2Cfg.buildMapVpcPeers()
+	vpcPeers, vpcPeerings, _ := ec2Cfg.buildMapVpcPeers(ctx)
 	allInstances := make(map[types.NamespacedName][]*ec2.Instance)
 
 	// Call cloud APIs for the configured CloudEntitySelectors CRs.
 	if len(ec2Cfg.selectors) == 0 {
 		awsPluginLogger().V(1).Info("Fetching vm resources from cloud skipped",
 			"account", ec2Cfg.accountNamespacedName, "resource-filters", "not-configured")
-		ec2Cfg.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{allInstances, vpcs, nil, vpcNameToID, vpcPeers})
+		ec2Cfg.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{allInstances, vpcs, nil, vpcNameToID, vpcPeers,
+			vpcPeerings})
+		ec2Cfg.permissionVpcIDs = nil
 		return nil
 	}
 
-	managedVpcIDs := make(map[string]struct{})
 	for namespacedName := range ec2Cfg.selectors {
-		instances, err := ec2Cfg.getInstances(&namespacedName)
+		if _, isAlias := ec2Cfg.selectorAliases[namespacedName]; isAlias {
+			continue
+		}
+		instances, err := ec2Cfg.getInstances(ctx, &namespacedName)
 		if err != nil {
 			awsPluginLogger().Error(err, "failed to fetch cloud resources", "account", ec2Cfg.accountNamespacedName)
 			return err
 		}
+		instances = internal.RetainTombstonedVMs(ec2Cfg.vmTombstones, namespacedName,
+			ec2Cfg.getCachedInstances(&namespacedName), instances, func(instance *ec2.Instance) string {
+				return strings.ToLower(*instance.InstanceId)
+			})
+		allInstances[namespacedName] = instances
+	}
+	for alias, primary := range ec2Cfg.selectorAliases {
+		allInstances[alias] = allInstances[primary]
+	}
+	allInstances = ec2Cfg.holdSpikedSelectors(allInstances)
+	allInstances = ec2Cfg.capInstances(allInstances)
+
+	managedVpcIDs := make(map[string]struct{})
+	for _, instances := range allInstances {
 		for _, instance := range instances {
 			managedVpcIDs[strings.ToLower(*instance.VpcId)] = struct{}{}
 		}
-		allInstances[namespacedName] = instances
 	}
-	ec2Cfg.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{allInstances, vpcs, managedVpcIDs, vpcNameToID, vpcPeers})
+	ec2Cfg.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{allInstances, vpcs, managedVpcIDs, vpcNameToID,
+		vpcPeers, vpcPeerings})
+	ec2Cfg.permissionVpcIDs = getPermissionVpcIDs(managedVpcIDs)
 
 	return nil
 }
 
+// holdSpikedSelectors keeps the previous instances of selectors whose number of instances grew beyond the selector
+// match spike threshold of the account, so that their newly matched instances are not enforced until confirmed.
+func (ec2Cfg *ec2ServiceConfig) holdSpikedSelectors(
+	allInstances map[types.NamespacedName][]*ec2.Instance) map[types.NamespacedName][]*ec2.Instance {
+	var previous map[types.NamespacedName][]*ec2.Instance
+	if snapshot, ok := ec2Cfg.resourcesCache.GetSnapshot().(*ec2ResourcesCacheSnapshot); ok && snapshot != nil {
+		previous = snapshot.vms
+	}
+	allInstances, holds := internal.HoldSpikedSelectors(ec2Cfg.selectorHolds, ec2Cfg.selectors, previous, allInstances,
+		func(instance *ec2.Instance) string {
+			return strings.ToLower(*instance.InstanceId)
+		})
+	for _, hold := range holds {
+		awsPluginLogger().Info("Selector VM count spiked, holding its inventory until confirmed",
+			"account", ec2Cfg.accountNamespacedName, "selector", hold.Selector, "previousVMs", hold.PreviousVMs,
+			"vms", hold.VMs, "threshold", ec2Cfg.credentials.selectorMatchSpikeThreshold,
+			"annotation", crdv1alpha1.SelectorAnnotationConfirmVMCount)
+	}
+	return allInstances
+}
+
+// capInstances evicts instances beyond the inventory limit of the account, instances not attached to Nephe created
+// security groups first.
+func (ec2Cfg *ec2ServiceConfig) capInstances(
+	allInstances map[types.NamespacedName][]*ec2.Instance) map[types.NamespacedName][]*ec2.Instance {
+	maxVMs := ec2Cfg.credentials.maxInventoryVMs
+	allInstances, evicted := internal.CapVMs(allInstances, maxVMs, func(instance *ec2.Instance) string {
+		return strings.ToLower(*instance.InstanceId)
+	}, isNepheManagedInstance)
+	internal.EvictedInventoryVMsGauge.WithLabelValues(ec2Cfg.accountNamespacedName.String(), string(providerType)).
+		Set(float64(evicted))
+	if evicted > 0 {
+		awsPluginLogger().Info("Inventory VM limit exceeded, evicted VMs from inventory",
+			"account", ec2Cfg.accountNamespacedName, "limit", maxVMs, "evicted", evicted)
+	}
+	return allInstances
+}
+
+// isNepheManagedInstance returns true if instance is attached to a Nephe created security group.
+func isNepheManagedInstance(instance *ec2.Instance) bool {
+	for _, group := range instance.SecurityGroups {
+		if group.GroupName == nil {
+			continue
+		}
+		if _, isAddressGroup, isAppliedToGroup := utils.IsNepheControllerCreatedSG(*group.GroupName); isAddressGroup ||
+			isAppliedToGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshVpcResourceInventory gets instances of a vpc from cloud for each configured CloudEntitySelector and merges
+// them into the snapshot, tombstoning and capping instances as DoResourceInventory does.
+func (ec2Cfg *ec2ServiceConfig) RefreshVpcResourceInventory(ctx context.Context, vpcID string) error {
+	snapshot, ok := ec2Cfg.resourcesCache.GetSnapshot().(*ec2ResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return fmt.Errorf("inventory of account %v is not initialized", ec2Cfg.accountNamespacedName)
+	}
+
+	allInstances := make(map[types.NamespacedName][]*ec2.Instance)
+	for namespacedName := range ec2Cfg.selectors {
+		if _, isAlias := ec2Cfg.selectorAliases[namespacedName]; isAlias {
+			continue
+		}
+		if ec2Cfg.selectorHolds.IsHeld(namespacedName) {
+			// the inventory of a held selector is only updated by full polls.
+			allInstances[namespacedName] = snapshot.vms[namespacedName]
+			continue
+		}
+		var filters [][]*ec2.Filter
+		for _, filter := range ec2Cfg.instanceFilters[namespacedName] {
+			vpcFilter := append(append([]*ec2.Filter{}, filter...), &ec2.Filter{
+				Name:   aws.String(awsFilterKeyVPCID),
+				Values: []*string{aws.String(vpcID)},
+			})
+			filters = append(filters, vpcFilter)
+		}
+		instances, err := ec2Cfg.getInstancesByFilters(ctx, &namespacedName, filters)
+		if err != nil {
+			awsPluginLogger().Error(err, "failed to refresh cloud resources", "account", ec2Cfg.accountNamespacedName,
+				"vpcID", vpcID)
+			return err
+		}
+		allInstances[namespacedName] = internal.MergeVpcVMs(ec2Cfg.vmTombstones, namespacedName,
+			snapshot.vms[namespacedName], instances, func(instance *ec2.Instance) bool {
+				return instance.VpcId != nil && strings.EqualFold(*instance.VpcId, vpcID)
+			}, func(instance *ec2.Instance) string {
+				return strings.ToLower(*instance.InstanceId)
+			})
+	}
+	for alias, primary := range ec2Cfg.selectorAliases {
+		allInstances[alias] = allInstances[primary]
+	}
+	allInstances = ec2Cfg.capInstances(allInstances)
+
+	managedVpcIDs := make(map[string]struct{})
+	for _, instances := range allInstances {
+		for _, instance := range instances {
+			managedVpcIDs[strings.ToLower(*instance.VpcId)] = struct{}{}
+		}
+	}
+	ec2Cfg.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{allInstances, snapshot.vpcs, managedVpcIDs,
+		snapshot.vpcNameToID, snapshot.vpcPeers, snapshot.vpcPeerings})
+	ec2Cfg.permissionVpcIDs = getPermissionVpcIDs(managedVpcIDs)
+	return nil
+}
+
 // AddResourceFilters add/updates instances resource filter for the service.
 func (ec2Cfg *ec2ServiceConfig) AddResourceFilters(selector *crdv1alpha1.CloudEntitySelector) error {
 	namespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
@@ -274,12 +439,80 @@ func (ec2Cfg *ec2ServiceConfig) AddResourceFilters(selector *crdv1alpha1.CloudEn
 	} else {
 		return fmt.Errorf("error creating resource query filters")
 	}
+	ec2Cfg.coalesceSelectors()
+	if primary, isAlias := ec2Cfg.selectorAliases[namespacedName]; isAlias {
+		awsPluginLogger().Info("Selector is identical to another selector of the account, sharing its resource filters",
+			"account", ec2Cfg.accountNamespacedName, "selector", namespacedName, "identicalSelector", primary)
+	}
 	return nil
 }
 
+// coalesceSelectors keeps the instanceFilters of a single selector among identical selectors.
+func (ec2Cfg *ec2ServiceConfig) coalesceSelectors() {
+	ec2Cfg.selectorAliases = internal.CoalesceSelectorFilters(ec2Cfg.selectors, ec2Cfg.instanceFilters,
+		convertSelectorToEC2InstanceFilters)
+}
+
+// PreviewResourceFilters fetches instances matching the selector from cloud and converts them to internal
+// runtimev1alpha1.VirtualMachine format, without configuring the selector filters.
+func (ec2Cfg *ec2ServiceConfig) PreviewResourceFilters(
+	selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error) {
+	namespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+	filters, ok := convertSelectorToEC2InstanceFilters(selector)
+	if !ok {
+		return nil, fmt.Errorf("error creating resource query filters")
+	}
+
+	instances, err := ec2Cfg.getInstancesByFilters(context.Background(), &namespacedName, filters)
+	if err != nil {
+		return nil, err
+	}
+	vpcs := ec2Cfg.getCachedVpcsMap()
+	vmObjects := map[string]*runtimev1alpha1.VirtualMachine{}
+	for _, instance := range instances {
+		vmObject := ec2InstanceToInternalVirtualMachineObject(instance, vpcs, &namespacedName,
+			&ec2Cfg.accountNamespacedName, ec2Cfg.credentials.region)
+		vmObjects[vmObject.Name] = vmObject
+	}
+
+	vms := make([]*runtimev1alpha1.VirtualMachine, 0, len(vmObjects))
+	for _, vmObject := range vmObjects {
+		vms = append(vms, vmObject)
+	}
+	return vms, nil
+}
+
 func (ec2Cfg *ec2ServiceConfig) RemoveResourceFilters(namespacedName *types.NamespacedName) {
 	delete(ec2Cfg.instanceFilters, *namespacedName)
 	delete(ec2Cfg.selectors, *namespacedName)
+	ec2Cfg.vmTombstones.RemoveSelector(*namespacedName)
+	ec2Cfg.selectorHolds.RemoveSelector(*namespacedName)
+	ec2Cfg.coalesceSelectors()
+}
+
+// GetResourceFilterSelectors returns the namespaced names of the selectors whose instance filters are configured.
+func (ec2Cfg *ec2ServiceConfig) GetResourceFilterSelectors() []types.NamespacedName {
+	selectors := make([]types.NamespacedName, 0, len(ec2Cfg.selectors))
+	for namespacedName := range ec2Cfg.selectors {
+		selectors = append(selectors, namespacedName)
+	}
+	return selectors
+}
+
+// RemoveAllResourceFilters removes all selectors and recomputes the snapshot without their instances, vpcs are kept.
+func (ec2Cfg *ec2ServiceConfig) RemoveAllResourceFilters() {
+	ec2Cfg.instanceFilters = make(map[types.NamespacedName][][]*ec2.Filter)
+	ec2Cfg.selectors = make(map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector)
+	ec2Cfg.selectorAliases = nil
+	ec2Cfg.vmTombstones.Reset()
+	ec2Cfg.selectorHolds.Reset()
+
+	snapshot, ok := ec2Cfg.resourcesCache.GetSnapshot().(*ec2ResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return
+	}
+	ec2Cfg.resourcesCache.UpdateSnapshot(&ec2ResourcesCacheSnapshot{make(map[types.NamespacedName][]*ec2.Instance),
+		snapshot.vpcs, make(map[string]struct{}), snapshot.vpcNameToID, snapshot.vpcPeers, snapshot.vpcPeerings})
 }
 
 // getVirtualMachineObjects converts cached virtual machines in cloud format to internal runtimev1alpha1.VirtualMachine format.
@@ -303,18 +536,37 @@ func (ec2Cfg *ec2ServiceConfig) GetInventoryStats() *internal.CloudServiceStats
 	return ec2Cfg.inventoryStats
 }
 
+// GetSnapshotFootprint returns nil, the footprint of the service cache snapshot is not estimated.
+func (ec2Cfg *ec2ServiceConfig) GetSnapshotFootprint() *nephetypes.SnapshotFootprint {
+	return nil
+}
+
 func (ec2Cfg *ec2ServiceConfig) ResetInventoryCache() {
 	ec2Cfg.resourcesCache.UpdateSnapshot(nil)
 	ec2Cfg.inventoryStats.ResetInventoryPollStats()
+	ec2Cfg.vmTombstones.Reset()
+	ec2Cfg.selectorHolds.Reset()
 }
 
 func (ec2Cfg *ec2ServiceConfig) UpdateServiceConfig(newConfig internal.CloudServiceInterface) error {
 	newEc2ServiceConfig := newConfig.(*ec2ServiceConfig)
 	ec2Cfg.apiClient = newEc2ServiceConfig.apiClient
 	ec2Cfg.credentials = newEc2ServiceConfig.credentials
+	ec2Cfg.vmTombstones.SetPolls(ec2Cfg.credentials.inventoryTombstonePolls)
+	ec2Cfg.selectorHolds.SetThreshold(ec2Cfg.credentials.selectorMatchSpikeThreshold)
 	return nil
 }
 
+// UpdateServiceOptions applies the account options of credentials in place. Egress allow CIDRs change how security
+// groups are enforced.
+func (ec2Cfg *ec2ServiceConfig) UpdateServiceOptions(credentials interface{}) (bool, error) {
+	previous := ec2Cfg.credentials
+	ec2Cfg.credentials = credentials.(*awsAccountConfig)
+	ec2Cfg.vmTombstones.SetPolls(ec2Cfg.credentials.inventoryTombstonePolls)
+	ec2Cfg.selectorHolds.SetThreshold(ec2Cfg.credentials.selectorMatchSpikeThreshold)
+	return !reflect.DeepEqual(previous.egressAllowCIDRs, ec2Cfg.credentials.egressAllowCIDRs), nil
+}
+
 func (ec2Cfg *ec2ServiceConfig) buildMapVpcNameToID(vpcs []*ec2.Vpc) map[string]string {
 	vpcNameToID := make(map[string]string)
 	for _, vpc := range vpcs {
@@ -334,24 +586,37 @@ func (ec2Cfg *ec2ServiceConfig) buildMapVpcNameToID(vpcs []*ec2.Vpc) map[string]
 	return vpcNameToID
 }
 
-func (ec2Cfg *ec2ServiceConfig) buildMapVpcPeers() (map[string][]string, error) {
+// buildMapVpcPeers returns the IDs of the vpcs peered with each vpc, along with the peerings they are built from.
+func (ec2Cfg *ec2ServiceConfig) buildMapVpcPeers(ctx context.Context) (map[string][]string, []nephetypes.VpcPeering,
+	error) {
 	vpcPeers := make(map[string][]string)
-	result, err := ec2Cfg.apiClient.describeVpcPeeringConnectionsWrapper(nil)
+	var vpcPeerings []nephetypes.VpcPeering
+	result, err := ec2Cfg.apiClient.describeVpcPeeringConnectionsWrapper(ctx, nil)
 	if err != nil {
 		awsPluginLogger().V(0).Info("Failed to get peering connections", "error", err)
-		return nil, err
+		return nil, nil, err
 	}
 	for _, peerConn := range result.VpcPeeringConnections {
 		accepterID, requesterID := *peerConn.AccepterVpcInfo.VpcId, *peerConn.RequesterVpcInfo.VpcId
 		vpcPeers[accepterID] = append(vpcPeers[accepterID], requesterID)
 		vpcPeers[requesterID] = append(vpcPeers[requesterID], accepterID)
+		peering := nephetypes.VpcPeering{
+			AccepterID:      accepterID,
+			RequesterID:     requesterID,
+			SourceCIDR:      aws.StringValue(peerConn.AccepterVpcInfo.CidrBlock),
+			DestinationCIDR: aws.StringValue(peerConn.RequesterVpcInfo.CidrBlock),
+		}
+		if peerConn.Status != nil {
+			peering.State = aws.StringValue(peerConn.Status.Code)
+		}
+		vpcPeerings = append(vpcPeerings, peering)
 	}
-	return vpcPeers, nil
+	return vpcPeers, vpcPeerings, nil
 }
 
 // getVpcs invokes cloud API to fetch the list of vpcs.
-func (ec2Cfg *ec2ServiceConfig) getVpcs() ([]*ec2.Vpc, error) {
-	result, err := ec2Cfg.apiClient.describeVpcsWrapper(nil)
+func (ec2Cfg *ec2ServiceConfig) getVpcs(ctx context.Context) ([]*ec2.Vpc, error) {
+	result, err := ec2Cfg.apiClient.describeVpcsWrapper(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -22,6 +22,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
 // aws instance resource filter keys.
@@ -33,7 +35,8 @@ const (
 	awsFilterKeyInstanceState = "instance-state-code"
 
 	// Not supported by aws, internal use only.
-	awsCustomFilterKeyVPCName = "vpc-name"
+	awsCustomFilterKeyVPCName  = "vpc-name"
+	awsCustomFilterKeyOSFamily = "os-family"
 )
 
 var (
@@ -62,6 +65,7 @@ func buildEc2Filters(vmSelector []crdv1alpha1.VirtualMachineSelector) [][]*ec2.F
 	var vmIDOnlyMatches []crdv1alpha1.EntityMatch
 	var vmNameOnlyMatches []crdv1alpha1.EntityMatch
 	var vpcNameOnlyMatches []crdv1alpha1.VirtualMachineSelector
+	var osFamilyMatches []crdv1alpha1.VirtualMachineSelector
 
 	// vpcMatch contains VpcID and vmMatch contains nil:
 	// vpcIDsWithVpcIDOnlyMatches map contains the corresponding vmSelector section.
@@ -77,8 +81,16 @@ func buildEc2Filters(vmSelector []crdv1alpha1.VirtualMachineSelector) [][]*ec2.F
 	// vpcMatch contains nil and vmMatch contains only vmName:
 	// vmNameOnlyMatches slice contains the specific vmMatch section(EntityMatch).
 	// ec2.Filter is created to match only vms matching the matchName.
+	// osFamilyMatch is configured:
+	// osFamilyMatches slice contains the corresponding vmSelector section.
+	// ec2.Filters are created for the other matches of the section alone, along with an internal os family filter.
 
 	for _, match := range vmSelector {
+		if len(strings.TrimSpace(match.OSFamilyMatch)) > 0 {
+			osFamilyMatches = append(osFamilyMatches, match)
+			continue
+		}
+
 		isVpcIDPresent := false
 		isVpcNamePresent := false
 
@@ -142,7 +154,8 @@ func buildEc2Filters(vmSelector []crdv1alpha1.VirtualMachineSelector) [][]*ec2.F
 
 	awsPluginLogger().Info("Selector stats", "VpcIdOnlyMatch", len(vpcIDsWithVpcIDOnlyMatches),
 		"VpcIdWithOtherMatches", len(vpcIDWithOtherMatches), "VmIdOnlyMatches", len(vmIDOnlyMatches),
-		"VmNameOnlyMatches", len(vmNameOnlyMatches), "VpcNameOnlyMatches", len(vpcNameOnlyMatches))
+		"VmNameOnlyMatches", len(vmNameOnlyMatches), "VpcNameOnlyMatches", len(vpcNameOnlyMatches),
+		"OSFamilyMatches", len(osFamilyMatches))
 
 	var allEc2Filters [][]*ec2.Filter
 
@@ -171,9 +184,54 @@ func buildEc2Filters(vmSelector []crdv1alpha1.VirtualMachineSelector) [][]*ec2.F
 	if vpcNameOnlyEc2Filter != nil {
 		allEc2Filters = append(allEc2Filters, vpcNameOnlyEc2Filter)
 	}
+
+	allEc2Filters = append(allEc2Filters, buildAwsEc2FilterForOSFamilyMatches(osFamilyMatches)...)
 	return allEc2Filters
 }
 
+func buildAwsEc2FilterForOSFamilyMatches(osFamilyMatches []crdv1alpha1.VirtualMachineSelector) [][]*ec2.Filter {
+	var allFilters [][]*ec2.Filter
+	for _, match := range osFamilyMatches {
+		osFamily := strings.ToLower(strings.TrimSpace(match.OSFamilyMatch))
+		match.OSFamilyMatch = ""
+		filters := buildEc2Filters([]crdv1alpha1.VirtualMachineSelector{match})
+		if filters == nil {
+			// os family only match, all vms of the os family are selected.
+			filters = [][]*ec2.Filter{{buildEc2FilterForValidInstanceStates()}}
+		}
+		for _, filter := range filters {
+			allFilters = append(allFilters, append(filter, &ec2.Filter{
+				Name:   aws.String(awsCustomFilterKeyOSFamily),
+				Values: []*string{aws.String(osFamily)},
+			}))
+		}
+	}
+	return allFilters
+}
+
+// splitOSFamilyFilter removes the internal os family filter from filters, and returns the os family it matches,
+// empty if none.
+func splitOSFamilyFilter(filters []*ec2.Filter) ([]*ec2.Filter, runtimev1alpha1.OSFamily) {
+	var osFamily runtimev1alpha1.OSFamily
+	var cloudFilters []*ec2.Filter
+	for _, filter := range filters {
+		if *filter.Name == awsCustomFilterKeyOSFamily {
+			osFamily = runtimev1alpha1.OSFamily(*filter.Values[0])
+			continue
+		}
+		cloudFilters = append(cloudFilters, filter)
+	}
+	return cloudFilters, osFamily
+}
+
+// getInstanceOSFamily returns the os family of an instance, platform is only reported for Windows instances.
+func getInstanceOSFamily(instance *ec2.Instance) runtimev1alpha1.OSFamily {
+	if instance.Platform == nil {
+		return runtimev1alpha1.OSFamilyLinux
+	}
+	return utils.GetOSFamily(*instance.Platform)
+}
+
 func buildAwsEc2FilterForVpcIDOnlyMatches(vpcIDsWithVpcIDOnlyMatches map[string]struct{}) []*ec2.Filter {
 	if len(vpcIDsWithVpcIDOnlyMatches) == 0 {
 		return nil
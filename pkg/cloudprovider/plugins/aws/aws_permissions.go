@@ -0,0 +1,113 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+)
+
+const (
+	actionDescribeInstances             = "ec2:DescribeInstances"
+	actionDescribeVpcs                  = "ec2:DescribeVpcs"
+	actionDescribeVpcPeeringConnections = "ec2:DescribeVpcPeeringConnections"
+	actionDescribeSecurityGroups        = "ec2:DescribeSecurityGroups"
+	actionDescribeNetworkInterfaces     = "ec2:DescribeNetworkInterfaces"
+	actionCreateSecurityGroup           = "ec2:CreateSecurityGroup"
+
+	// permissionProbeGroupName is the name of the security group whose creation is dry run by a permission probe.
+	permissionProbeGroupName = "nephe-permission-probe"
+)
+
+var (
+	// inventoryActions are the actions required to read the cloud inventory.
+	inventoryActions = []string{
+		actionDescribeInstances,
+		actionDescribeVpcs,
+		actionDescribeVpcPeeringConnections,
+	}
+	// securityActions are the actions required to program security rules, which can be dry run without a security
+	// group. Authorizing, revoking and deleting rules and groups, and modifying network interfaces, require an existing
+	// security group, and are not probed.
+	securityActions = []string{
+		actionDescribeSecurityGroups,
+		actionDescribeNetworkInterfaces,
+	}
+)
+
+// GetPermissionProbe returns the probe of the permissions of the credentials, dry running the EC2 actions used by the
+// inventory and the security operations. Security group creation is dry run in each vpc of the selected VMs.
+func (ec2Cfg *ec2ServiceConfig) GetPermissionProbe() *internal.PermissionProbe {
+	client := ec2Cfg.apiClient
+	vpcIDs := ec2Cfg.permissionVpcIDs
+	account := ec2Cfg.accountNamespacedName
+	return &internal.PermissionProbe{
+		Scopes: vpcIDs,
+		Probe: func(ctx context.Context) (*internal.MissingPermissions, error) {
+			return probePermissions(ctx, client, vpcIDs, account)
+		},
+	}
+}
+
+// probePermissions dry runs the inventory and security actions, and returns the actions not permitted.
+func probePermissions(ctx context.Context, client awsEC2Wrapper, vpcIDs []string,
+	account types.NamespacedName) (*internal.MissingPermissions, error) {
+	missing := &internal.MissingPermissions{}
+	for _, action := range inventoryActions {
+		permitted, err := client.dryRun(ctx, action, "")
+		if err != nil {
+			return nil, err
+		}
+		if !permitted {
+			missing.Inventory = append(missing.Inventory, action)
+		}
+	}
+	for _, action := range securityActions {
+		permitted, err := client.dryRun(ctx, action, "")
+		if err != nil {
+			return nil, err
+		}
+		if !permitted {
+			missing.Security = append(missing.Security, action)
+		}
+	}
+	for _, vpcID := range vpcIDs {
+		permitted, err := client.dryRun(ctx, actionCreateSecurityGroup, vpcID)
+		if err != nil {
+			return nil, err
+		}
+		if !permitted {
+			missing.Security = append(missing.Security, actionCreateSecurityGroup)
+			break
+		}
+	}
+	awsPluginLogger().V(1).Info("Probed credential permissions", "account", account,
+		"vpcs", vpcIDs, "missingInventory", missing.Inventory, "missingSecurity", missing.Security)
+	return missing, nil
+}
+
+// getPermissionVpcIDs returns the sorted vpc IDs.
+func getPermissionVpcIDs(vpcIDs map[string]struct{}) []string {
+	var sorted []string
+	for vpcID := range vpcIDs {
+		sorted = append(sorted, vpcID)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
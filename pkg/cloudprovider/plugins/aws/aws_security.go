@@ -16,6 +16,7 @@ package aws
 
 import (
 	"fmt"
+	"net"
 	"reflect"
 	"strconv"
 	"strings"
@@ -43,14 +44,6 @@ var (
 	tcpUDPPortEnd       = 65535
 )
 
-var protocolNameNumMap = map[string]int{
-	"icmp":   1,
-	"igmp":   2,
-	"tcp":    6,
-	"udp":    17,
-	"icmpv6": 58,
-}
-
 var vpcIDToDefaultSecurityGroup = make(map[string]string)
 
 func buildEc2UserIDGroupPairs(addressGroupIdentifiers []*cloudresource.CloudResourceID,
@@ -259,6 +252,21 @@ func (ec2Cfg *ec2ServiceConfig) realizeEgressIPPermissions(cloudSgObj *ec2.Secur
 	}
 }
 
+// ipPermissionsUpdate is a batch of ipPermissions to authorize or revoke on a cloud security group.
+type ipPermissionsUpdate struct {
+	ipPermissions []*ec2.IpPermission
+	isEgress      bool
+	isDelete      bool
+}
+
+// realizeIPPermissions invokes cloud api and realizes an ingress or egress ipPermissions update.
+func (ec2Cfg *ec2ServiceConfig) realizeIPPermissions(cloudSgObj *ec2.SecurityGroup, update ipPermissionsUpdate) error {
+	if update.isEgress {
+		return ec2Cfg.realizeEgressIPPermissions(cloudSgObj, update.ipPermissions, update.isDelete)
+	}
+	return ec2Cfg.realizeIngressIPPermissions(cloudSgObj, update.ipPermissions, update.isDelete)
+}
+
 func (ec2Cfg *ec2ServiceConfig) getVpcDefaultSecurityGroupID(vpcID string) (string, error) {
 	sgID, found := vpcIDToDefaultSecurityGroup[vpcID]
 	if found {
@@ -484,14 +492,14 @@ func (ec2Cfg *ec2ServiceConfig) getNepheControllerManagedSecurityGroupsCloudView
 	networkInterfaces, err := ec2Cfg.getNetworkInterfacesOfVpc(vpcIDs)
 	if err != nil {
 		awsPluginLogger().Error(err, "failed to get network interfaces of vpcs", "vpc-ids", vpcIDs)
-		return []cloudresource.SynchronizationContent{}
+		return nil
 	}
 
 	// get all security groups for managed vpcs and build cloud-sg-id to sgObj map by sg managed/unmanaged type
 	cloudSecurityGroups, err := ec2Cfg.getSecurityGroupsOfVpc(vpcIDs)
 	if err != nil {
 		awsPluginLogger().Error(err, "failed to get security groups of vpcs", "vpc-ids", vpcIDs)
-		return []cloudresource.SynchronizationContent{}
+		return nil
 	}
 	managedSgIDToCloudSGObj, unmanagedSgIDToCloudSGObj := getCloudSecurityGroupsByType(cloudSecurityGroups)
 
@@ -533,7 +541,7 @@ func (ec2Cfg *ec2ServiceConfig) getNepheControllerManagedSecurityGroupsCloudView
 	}
 
 	// build sync objects for managed security groups.
-	var enforcedSecurityCloudView []cloudresource.SynchronizationContent
+	enforcedSecurityCloudView := make([]cloudresource.SynchronizationContent, 0, len(managedSgIDToCloudSGObj))
 	for sgID, cloudSgObj := range managedSgIDToCloudSGObj {
 		cloudSgName := *cloudSgObj.GroupName
 		vpcID := *cloudSgObj.VpcId
@@ -576,6 +584,7 @@ func (ec2Cfg *ec2ServiceConfig) getNepheControllerManagedSecurityGroupsCloudView
 			MembersWithOtherSGAttached: membersWithOtherSGAttached,
 			IngressRules:               inRules,
 			EgressRules:                egRules,
+			CloudID:                    sgID,
 		}
 
 		enforcedSecurityCloudView = append(enforcedSecurityCloudView, groupSyncObj)
@@ -631,7 +640,7 @@ func getMemberNicCloudResourcesAttachedToOtherSGs(members []cloudresource.CloudR
 func normalizeIpPermissions(ipPermissions []*ec2.IpPermission) []*ec2.IpPermission {
 	normalizedList := make([]*ec2.IpPermission, 0)
 	for _, ipPermission := range ipPermissions {
-		if protocol, ok := protocolNameNumMap[*ipPermission.IpProtocol]; ok {
+		if protocol, err := utils.ProtocolFromAWS(*ipPermission.IpProtocol); err == nil {
 			ipPermission.IpProtocol = aws.String(strconv.Itoa(protocol))
 		}
 		for _, ipv4 := range ipPermission.IpRanges {
@@ -665,6 +674,160 @@ func normalizeIpPermissions(ipPermissions []*ec2.IpPermission) []*ec2.IpPermissi
 	return normalizedList
 }
 
+// dropUnchangedIpPermissions removes ipPermissions present in both add and remove, which are left untouched in cloud.
+func dropUnchangedIpPermissions(add, remove []*ec2.IpPermission) ([]*ec2.IpPermission, []*ec2.IpPermission) {
+	var changedAdd, changedRemove []*ec2.IpPermission
+	unchanged := make([]bool, len(remove))
+	for _, addIpPermission := range add {
+		found := false
+		for idx, rmIpPermission := range remove {
+			if !unchanged[idx] && reflect.DeepEqual(addIpPermission, rmIpPermission) {
+				unchanged[idx] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			changedAdd = append(changedAdd, addIpPermission)
+		}
+	}
+	for idx, rmIpPermission := range remove {
+		if !unchanged[idx] {
+			changedRemove = append(changedRemove, rmIpPermission)
+		}
+	}
+	return changedAdd, changedRemove
+}
+
+// splitReplacedIpPermissions splits the ipPermissions to remove into the ones replaced by an ipPermission to add
+// differing only in description, and the others.
+func splitReplacedIpPermissions(remove, add []*ec2.IpPermission) ([]*ec2.IpPermission, []*ec2.IpPermission) {
+	var replaced, others []*ec2.IpPermission
+	for _, rmIpPermission := range remove {
+		isReplaced := false
+		for _, addIpPermission := range add {
+			if reflect.DeepEqual(ipPermissionWithoutDescription(rmIpPermission), ipPermissionWithoutDescription(addIpPermission)) {
+				isReplaced = true
+				break
+			}
+		}
+		if isReplaced {
+			replaced = append(replaced, rmIpPermission)
+		} else {
+			others = append(others, rmIpPermission)
+		}
+	}
+	return replaced, others
+}
+
+// ipPermissionWithoutDescription returns a copy of ipPermission with the descriptions of its peers cleared.
+func ipPermissionWithoutDescription(ipPermission *ec2.IpPermission) *ec2.IpPermission {
+	stripped := &ec2.IpPermission{
+		FromPort:      ipPermission.FromPort,
+		IpProtocol:    ipPermission.IpProtocol,
+		PrefixListIds: ipPermission.PrefixListIds,
+		ToPort:        ipPermission.ToPort,
+	}
+	for _, ipv4 := range ipPermission.IpRanges {
+		stripped.IpRanges = append(stripped.IpRanges, &ec2.IpRange{CidrIp: ipv4.CidrIp})
+	}
+	for _, ipv6 := range ipPermission.Ipv6Ranges {
+		stripped.Ipv6Ranges = append(stripped.Ipv6Ranges, &ec2.Ipv6Range{CidrIpv6: ipv6.CidrIpv6})
+	}
+	for _, group := range ipPermission.UserIdGroupPairs {
+		pair := *group
+		pair.Description = nil
+		stripped.UserIdGroupPairs = append(stripped.UserIdGroupPairs, &pair)
+	}
+	return stripped
+}
+
+// isEgressAllowListIpPermission checks if the given normalized ipPermission is built from the egress allow CIDRs of the
+// account.
+func isEgressAllowListIpPermission(ipPermission *ec2.IpPermission) bool {
+	var description *string
+	if len(ipPermission.IpRanges) > 0 {
+		description = ipPermission.IpRanges[0].Description
+	} else if len(ipPermission.Ipv6Ranges) > 0 {
+		description = ipPermission.Ipv6Ranges[0].Description
+	}
+	return utils.IsEgressAllowListRuleDescription(description)
+}
+
+// containsIpPermission checks if ipPermissions contains the given ipPermission.
+func containsIpPermission(ipPermissions []*ec2.IpPermission, ipPermission *ec2.IpPermission) bool {
+	for _, p := range ipPermissions {
+		if reflect.DeepEqual(p, ipPermission) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildEgressAllowListIpPermissions returns the egress ipPermissions to authorize and to revoke, so that the appliedTo
+// security group allows egress to the egress allow CIDRs of the account. The current ipPermissions of the security
+// group are normalized. CIDRs already allowed by a policy ipPermission, identical but for the description, which is
+// current and not removed, or added, are not allowed again.
+func buildEgressAllowListIpPermissions(appliedToGroupID *cloudresource.CloudResourceID, cidrs []*net.IPNet,
+	current, add, remove []*ec2.IpPermission) ([]*ec2.IpPermission, []*ec2.IpPermission, error) {
+	var desired []*ec2.IpPermission
+	if rule := utils.NewEgressAllowListRule(appliedToGroupID, cidrs); rule != nil {
+		ipPermissions, err := convertEgressToIpPermission([]*cloudresource.CloudRule{rule}, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		desired = normalizeIpPermissions(ipPermissions)
+	}
+
+	var existing, policy []*ec2.IpPermission
+	removed := normalizeIpPermissions(remove)
+	for _, ipPermission := range current {
+		if isEgressAllowListIpPermission(ipPermission) {
+			existing = append(existing, ipPermission)
+		} else if !containsIpPermission(removed, ipPermission) {
+			policy = append(policy, ipPermissionWithoutDescription(ipPermission))
+		}
+	}
+	for _, ipPermission := range normalizeIpPermissions(add) {
+		policy = append(policy, ipPermissionWithoutDescription(ipPermission))
+	}
+
+	var kept, toAdd, toRemove []*ec2.IpPermission
+	for _, ipPermission := range desired {
+		if containsIpPermission(policy, ipPermissionWithoutDescription(ipPermission)) {
+			continue
+		}
+		kept = append(kept, ipPermission)
+		if !containsIpPermission(existing, ipPermission) {
+			toAdd = append(toAdd, ipPermission)
+		}
+	}
+	for _, ipPermission := range existing {
+		if !containsIpPermission(kept, ipPermission) {
+			toRemove = append(toRemove, ipPermission)
+		}
+	}
+	return toAdd, toRemove, nil
+}
+
+// countIpPermissionsAfterUpdate returns the number of normalized ipPermissions of a security group with the normalized
+// ipPermissions current, once add are authorized and remove are revoked.
+func countIpPermissionsAfterUpdate(current, add, remove []*ec2.IpPermission) int {
+	removed := normalizeIpPermissions(remove)
+	var kept []*ec2.IpPermission
+	for _, ipPermission := range current {
+		if !containsIpPermission(removed, ipPermission) {
+			kept = append(kept, ipPermission)
+		}
+	}
+	for _, ipPermission := range normalizeIpPermissions(add) {
+		if !containsIpPermission(kept, ipPermission) {
+			kept = append(kept, ipPermission)
+		}
+	}
+	return len(kept)
+}
+
 // dedupIpPermissions identifies and returns a list of unique ipPermissions in local compared to cloud.
 func dedupIpPermissions(local, cloud []*ec2.IpPermission) []*ec2.IpPermission {
 	uniqueIpPermissions := local[:0]
@@ -17,6 +17,7 @@ package aws
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"k8s.io/apimachinery/pkg/types"
@@ -33,8 +34,14 @@ func (c *awsCloud) CreateSecurityGroup(securityGroupIdentifier *cloudresource.Cl
 	if !found {
 		return nil, fmt.Errorf("aws account not found managing virtual private cloud [%v]", vpcID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return nil, fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return nil, err
+	}
+	accCfg.LockVpcSecurity(vpcID)
+	defer accCfg.UnlockVpcSecurity(vpcID)
 
 	cloudSgName := securityGroupIdentifier.GetCloudName(membershipOnly)
 	ec2Service := accCfg.GetServiceConfig().(*ec2ServiceConfig)
@@ -43,6 +50,8 @@ func (c *awsCloud) CreateSecurityGroup(securityGroupIdentifier *cloudresource.Cl
 		return nil, err
 	}
 	securityGroupObj := resp[cloudSgName]
+	internal.SecurityMetrics.AddGroup(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeOf(membershipOnly), &securityGroupIdentifier.CloudResourceID)
 
 	return securityGroupObj.GroupId, nil
 }
@@ -50,6 +59,11 @@ func (c *awsCloud) CreateSecurityGroup(securityGroupIdentifier *cloudresource.Cl
 // UpdateSecurityGroupRules invokes cloud api and updates cloud security group with addRules and rmRules.
 func (c *awsCloud) UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudresource.CloudResource,
 	addRules, rmRules []*cloudresource.CloudRule) error {
+	// invalid rules are rejected before calling cloud api, the valid rules are updated regardless.
+	addRules, invalidRulesErr := utils.SplitInvalidRules(providerType, appliedToGroupIdentifier, addRules)
+	if invalidRulesErr != nil && len(addRules) == 0 && len(rmRules) == 0 {
+		return invalidRulesErr
+	}
 	addIRule, addERule := utils.SplitCloudRulesByDirection(addRules)
 	rmIRule, rmERule := utils.SplitCloudRulesByDirection(rmRules)
 
@@ -58,8 +72,14 @@ func (c *awsCloud) UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudresou
 	if !found {
 		return fmt.Errorf("aws account not found managing virtual private cloud [%v]", vpcID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return err
+	}
+	accCfg.LockVpcSecurity(vpcID)
+	defer accCfg.UnlockVpcSecurity(vpcID)
 
 	// build from addressGroups, cloudSgNames from rules
 	cloudSgNames := buildEc2CloudSgNamesFromRules(&appliedToGroupIdentifier.CloudResourceID, append(addIRule, rmIRule...),
@@ -99,46 +119,56 @@ func (c *awsCloud) UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudresou
 		return err
 	}
 
+	addIngressRules, removeIngressRules = dropUnchangedIpPermissions(addIngressRules, removeIngressRules)
+	addEgressRules, removeEgressRules = dropUnchangedIpPermissions(addEgressRules, removeEgressRules)
+	// allow-list permissions are rebuilt on each rule update from the egress allow CIDRs of the account.
+	addAllowListRules, removeAllowListRules, err := buildEgressAllowListIpPermissions(
+		&appliedToGroupIdentifier.CloudResourceID, ec2Service.credentials.egressAllowCIDRs,
+		cloudSGObjToAddRules.IpPermissionsEgress, addEgressRules, removeEgressRules)
+	if err != nil {
+		return err
+	}
+	addEgressRules = append(addEgressRules, addAllowListRules...)
+	removeEgressRules = append(removeEgressRules, removeAllowListRules...)
+	ruleCount := countIpPermissionsAfterUpdate(cloudSGObjToAddRules.IpPermissions, addIngressRules, removeIngressRules) +
+		countIpPermissionsAfterUpdate(cloudSGObjToAddRules.IpPermissionsEgress, addEgressRules, removeEgressRules)
 	addIngressRules = dedupIpPermissions(addIngressRules, cloudSGObjToAddRules.IpPermissions)
 	addEgressRules = dedupIpPermissions(addEgressRules, cloudSGObjToAddRules.IpPermissionsEgress)
 
-	// rollback operation for cloud api failures
-	rollbackRmIngress := false
-	rollbackAddIngress := false
-	rollbackRmEgress := false
-	defer func() {
-		if rollbackRmIngress {
-			_ = ec2Service.realizeIngressIPPermissions(cloudSGObjToAddRules, removeIngressRules, false)
-		}
-		if rollbackAddIngress {
-			_ = ec2Service.realizeIngressIPPermissions(cloudSGObjToAddRules, addIngressRules, true)
-		}
-		if rollbackRmEgress {
-			_ = ec2Service.realizeEgressIPPermissions(cloudSGObjToAddRules, removeEgressRules, false)
-		}
-	}()
-
-	// realize security group ingress and egress permissions
-	if err = ec2Service.realizeIngressIPPermissions(cloudSGObjToAddRules, removeIngressRules, true); err != nil {
-		return err
-	}
-	if err = ec2Service.realizeIngressIPPermissions(cloudSGObjToAddRules, addIngressRules, false); err != nil {
-		rollbackRmIngress = true
-		return err
-	}
-	if err = ec2Service.realizeEgressIPPermissions(cloudSGObjToAddRules, removeEgressRules, true); err != nil {
-		rollbackRmIngress = true
-		rollbackAddIngress = true
-		return err
+	// New permissions are authorized before the stale ones are revoked, so that traffic allowed by both is never
+	// interrupted. Only permissions replaced with a new description are revoked first, as cloud rejects duplicates.
+	replacedIngressRules, staleIngressRules := splitReplacedIpPermissions(removeIngressRules, addIngressRules)
+	replacedEgressRules, staleEgressRules := splitReplacedIpPermissions(removeEgressRules, addEgressRules)
+	updates := []ipPermissionsUpdate{
+		{ipPermissions: replacedIngressRules, isDelete: true},
+		{ipPermissions: addIngressRules},
+		{ipPermissions: staleIngressRules, isDelete: true},
+		{ipPermissions: replacedEgressRules, isEgress: true, isDelete: true},
+		{ipPermissions: addEgressRules, isEgress: true},
+		{ipPermissions: staleEgressRules, isEgress: true, isDelete: true},
 	}
-	if err = ec2Service.realizeEgressIPPermissions(cloudSGObjToAddRules, addEgressRules, false); err != nil {
-		rollbackRmIngress = true
-		rollbackAddIngress = true
-		rollbackRmEgress = true
-		return err
+	for i, update := range updates {
+		if err = ec2Service.realizeIPPermissions(cloudSGObjToAddRules, update); err != nil {
+			// rollback operation for cloud api failures, in reverse order.
+			for j := i - 1; j >= 0; j-- {
+				rollback := updates[j]
+				rollback.isDelete = !rollback.isDelete
+				_ = ec2Service.realizeIPPermissions(cloudSGObjToAddRules, rollback)
+			}
+			return err
+		}
 	}
 
-	return nil
+	internal.SecurityMetrics.SetRules(string(providerType), accCfg.GetNamespacedName().String(),
+		&appliedToGroupIdentifier.CloudResourceID, ruleCount)
+	internal.SecurityMetrics.SetReconciled(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeAppliedTo, &appliedToGroupIdentifier.CloudResourceID, time.Now())
+	return invalidRulesErr
+}
+
+// UpdateSecurityGroupRulesBatch invokes UpdateSecurityGroupRules for each appliedTo group in updates.
+func (c *awsCloud) UpdateSecurityGroupRulesBatch(updates []cloudresource.GroupRuleUpdate) error {
+	return utils.UpdateSecurityGroupRulesInBatch(updates, c.UpdateSecurityGroupRules)
 }
 
 // UpdateSecurityGroupMembers invokes cloud api and attaches/detaches nics to/from the cloud security group.
@@ -149,8 +179,19 @@ func (c *awsCloud) UpdateSecurityGroupMembers(securityGroupIdentifier *cloudreso
 	if !found {
 		return fmt.Errorf("aws account not found managing virtual private cloud [%v]", vpcID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return err
+	}
+	accCfg.LockVpcSecurity(vpcID)
+	defer accCfg.UnlockVpcSecurity(vpcID)
+
+	if accCfg.IsSecurityGroupMembershipUnchanged(securityGroupIdentifier, cloudResourceIdentifiers, membershipOnly) {
+		awsPluginLogger().V(1).Info("Security group members unchanged", "security group", securityGroupIdentifier.Name)
+		return nil
+	}
 
 	// get addressGroup cloudSgID
 	cloudSgName := securityGroupIdentifier.GetCloudName(membershipOnly)
@@ -169,8 +210,13 @@ func (c *awsCloud) UpdateSecurityGroupMembers(securityGroupIdentifier *cloudreso
 
 	err = ec2Service.updateSecurityGroupMembers(cloudSgID, cloudSgName, vpcID, cloudResourceIdentifiers, membershipOnly)
 	if err != nil {
+		// members may be partially applied.
+		accCfg.ForgetSecurityGroupMembership(securityGroupIdentifier, membershipOnly)
 		return err
 	}
+	accCfg.SetSecurityGroupMembership(securityGroupIdentifier, cloudResourceIdentifiers, membershipOnly)
+	internal.SecurityMetrics.SetReconciled(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeOf(membershipOnly), &securityGroupIdentifier.CloudResourceID, time.Now())
 
 	return nil
 }
@@ -182,8 +228,15 @@ func (c *awsCloud) DeleteSecurityGroup(securityGroupIdentifier *cloudresource.Cl
 	if !found {
 		return fmt.Errorf("aws account not found managing virtual private cloud [%v]", vpcID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return err
+	}
+	accCfg.LockVpcSecurity(vpcID)
+	defer accCfg.UnlockVpcSecurity(vpcID)
+	accCfg.ForgetSecurityGroupMembership(securityGroupIdentifier, membershipOnly)
 
 	// check if sg exists in cloud and get its cloud sg id to delete
 	vpcIDs := []string{vpcID}
@@ -209,10 +262,17 @@ func (c *awsCloud) DeleteSecurityGroup(securityGroupIdentifier *cloudresource.Cl
 	if err != nil {
 		return err
 	}
+	internal.SecurityMetrics.DeleteGroup(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeOf(membershipOnly), &securityGroupIdentifier.CloudResourceID)
 
 	return nil
 }
 
+// Shutdown waits up to timeout for in-progress security operations, and those waiting on their vpc, to complete.
+func (c *awsCloud) Shutdown(timeout time.Duration) error {
+	return c.cloudCommon.Shutdown(timeout)
+}
+
 func (c *awsCloud) GetEnforcedSecurity() []cloudresource.SynchronizationContent {
 	var accNamespacedNames []types.NamespacedName
 	accountConfigs := c.cloudCommon.GetCloudAccounts()
@@ -243,6 +303,12 @@ func (c *awsCloud) GetEnforcedSecurity() []cloudresource.SynchronizationContent
 				awsPluginLogger().Info("Enforced-security-cloud-view GET for account skipped (account no longer exists)", "account", name)
 				return
 			}
+			// security groups of a paused account are reported as last seen, so that they are not recreated.
+			if accCfg.IsPaused() {
+				awsPluginLogger().V(1).Info("Enforced-security-cloud-view GET for account skipped (account paused)", "account", name)
+				sendCh <- accCfg.GetCachedEnforcedSecurity()
+				return
+			}
 			accCfg.LockMutex()
 			defer accCfg.UnlockMutex()
 
@@ -251,7 +317,15 @@ func (c *awsCloud) GetEnforcedSecurity() []cloudresource.SynchronizationContent
 				awsPluginLogger().Error(err, "Enforced-security-cloud-view GET for account skipped", "account", accCfg.GetNamespacedName())
 				return
 			}
-			sendCh <- ec2Service.getNepheControllerManagedSecurityGroupsCloudView()
+			cloudView := ec2Service.getNepheControllerManagedSecurityGroupsCloudView()
+			// a nil view indicates failure to fetch it from cloud, keep the previous metrics.
+			if cloudView != nil {
+				accCfg.CacheEnforcedSecurity(cloudView)
+				internal.SecurityMetrics.Sync(string(providerType), accCfg.GetNamespacedName().String(), cloudView)
+				// memberships drifted in cloud are re-applied after the view is synced, they must not be skipped.
+				accCfg.ResetSecurityGroupMemberships()
+			}
+			sendCh <- cloudView
 		}(accNamespacedNameCopy, ch)
 	}
 
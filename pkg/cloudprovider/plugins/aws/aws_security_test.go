@@ -16,6 +16,7 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sort"
@@ -26,6 +27,7 @@ import (
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -34,6 +36,7 @@ import (
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
 	"antrea.io/nephe/pkg/cloudprovider/utils"
 	"antrea.io/nephe/pkg/config"
 )
@@ -113,14 +116,16 @@ var _ = Describe("AWS Cloud Security", func() {
 		mockawsService = NewMockawsServiceClientCreateInterface(mockCtrl)
 		mockawsEC2 = NewMockawsEC2Wrapper(mockCtrl)
 
-		mockawsCloudHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any()).Return(mockawsService, nil).Times(1)
+		mockawsCloudHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any(), gomock.Any()).Return(mockawsService, nil).Times(1)
 		mockawsService.EXPECT().compute().Return(mockawsEC2, nil).AnyTimes()
+		mockawsEC2.EXPECT().dryRun(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
 
 		instanceIds := []string{testVMID01, testVMID02}
-		mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
+		mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
 		mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).AnyTimes()
-		mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
-		mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{}, nil).AnyTimes()
+		mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
+		mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(
+			&ec2.DescribeVpcPeeringConnectionsOutput{}, nil).AnyTimes()
 
 		fakeClient := fake.NewClientBuilder().Build()
 		_ = fakeClient.Create(context.Background(), secret)
@@ -291,6 +296,55 @@ var _ = Describe("AWS Cloud Security", func() {
 			err := cloudInterface.UpdateSecurityGroupRules(webSgIdentifier, addRule, []*cloudresource.CloudRule{})
 			Expect(err).Should(BeNil())
 		})
+		It("Should authorize new ingress rules before revoking stale ones and keep unchanged rules", func() {
+			webSgIdentifier := &cloudresource.CloudResource{
+				Type: cloudresource.CloudResourceTypeVM,
+				CloudResourceID: cloudresource.CloudResourceID{
+					Name: "Web",
+					Vpc:  testVpcID01,
+				},
+				AccountID:     testAccountNamespacedName.String(),
+				CloudProvider: string(runtimev1alpha1.AWSCloudProvider),
+			}
+			getRule := func(port int, cidr string) *cloudresource.CloudRule {
+				_, srcIP, _ := net.ParseCIDR(cidr)
+				return &cloudresource.CloudRule{
+					Rule: &cloudresource.IngressRule{
+						FromPort:  aws.Int(port),
+						FromSrcIP: []*net.IPNet{srcIP},
+						Protocol:  aws.Int(6),
+					}, NpNamespacedName: testAnpNamespacedName.String(),
+				}
+			}
+			unchangedRule := getRule(22, "10.0.0.0/24")
+			addRules := []*cloudresource.CloudRule{unchangedRule, getRule(80, "10.0.1.0/24")}
+			rmRules := []*cloudresource.CloudRule{getRule(8080, "10.0.2.0/24"), unchangedRule}
+			output := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier.CloudResourceID, false, false)
+
+			mockawsEC2.EXPECT().describeSecurityGroups(gomock.Any()).Return(output, nil).Times(1)
+			gomock.InOrder(
+				mockawsEC2.EXPECT().authorizeSecurityGroupIngress(gomock.Any()).Times(1).
+					Do(func(req *ec2.AuthorizeSecurityGroupIngressInput) {
+						Expect(len(req.IpPermissions)).To(Equal(1))
+						Expect(*req.IpPermissions[0].FromPort).To(Equal(int64(80)))
+					}),
+				mockawsEC2.EXPECT().revokeSecurityGroupIngress(gomock.Any()).Times(1).
+					Do(func(req *ec2.RevokeSecurityGroupIngressInput) {
+						Expect(len(req.IpPermissions)).To(Equal(1))
+						Expect(*req.IpPermissions[0].FromPort).To(Equal(int64(8080)))
+					}),
+			)
+			mockawsEC2.EXPECT().revokeSecurityGroupEgress(gomock.Any()).Times(0)
+			mockawsEC2.EXPECT().authorizeSecurityGroupEgress(gomock.Any()).Times(0)
+
+			provider, account := string(runtimev1alpha1.AWSCloudProvider), testAccountNamespacedName.String()
+			internal.SecurityMetrics.DeleteAccount(provider, account)
+			defer internal.SecurityMetrics.DeleteAccount(provider, account)
+			err := cloudInterface.UpdateSecurityGroupRules(webSgIdentifier, addRules, rmRules)
+			Expect(err).Should(BeNil())
+			// the revoked rule not present in cloud is not counted.
+			Expect(testutil.ToFloat64(internal.SecurityRulesGauge.WithLabelValues(account, provider))).To(Equal(float64(1)))
+		})
 		// Ingress rules without a description field is not allowed.
 		It("Should fail to create ingress rules", func() {
 			webSgIdentifier := &cloudresource.CloudResource{
@@ -328,6 +382,91 @@ var _ = Describe("AWS Cloud Security", func() {
 			err := cloudInterface.UpdateSecurityGroupRules(webSgIdentifier, addRule, []*cloudresource.CloudRule{})
 			Expect(err).ShouldNot(BeNil())
 		})
+		It("Should reject invalid rules before calling cloud api", func() {
+			webSgIdentifier := &cloudresource.CloudResource{
+				Type: cloudresource.CloudResourceTypeVM,
+				CloudResourceID: cloudresource.CloudResourceID{
+					Name: "Web",
+					Vpc:  testVpcID01,
+				},
+				AccountID:     testAccountNamespacedName.String(),
+				CloudProvider: string(runtimev1alpha1.AWSCloudProvider),
+			}
+			invalidRules := map[string]cloudresource.Rule{
+				"port on icmp rule": &cloudresource.IngressRule{
+					FromPort: aws.Int(22),
+					Protocol: aws.Int(1),
+				},
+				"invalid protocol": &cloudresource.IngressRule{
+					Protocol: aws.Int(300),
+				},
+				"invalid port": &cloudresource.EgressRule{
+					ToPort:   aws.Int(70000),
+					Protocol: aws.Int(6),
+				},
+				"source end port without source port": &cloudresource.IngressRule{
+					Protocol:   aws.Int(17),
+					SrcEndPort: aws.Int(2000),
+				},
+				"cidr with bad mask": &cloudresource.EgressRule{
+					ToDstIP:  []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(64, 128)}},
+					Protocol: aws.Int(6),
+				},
+				"source port": &cloudresource.EgressRule{
+					ToPort:   aws.Int(22),
+					Protocol: aws.Int(6),
+					SrcPort:  aws.Int(1024),
+				},
+			}
+			mockawsEC2.EXPECT().describeSecurityGroups(gomock.Any()).Times(0)
+			for name, rule := range invalidRules {
+				err := cloudInterface.UpdateSecurityGroupRules(webSgIdentifier, []*cloudresource.CloudRule{{Rule: rule}},
+					[]*cloudresource.CloudRule{})
+				Expect(err).Should(HaveOccurred(), name)
+			}
+		})
+		It("Should update valid rules and reject invalid rules of the same update", func() {
+			webSgIdentifier := &cloudresource.CloudResource{
+				Type: cloudresource.CloudResourceTypeVM,
+				CloudResourceID: cloudresource.CloudResourceID{
+					Name: "Web",
+					Vpc:  testVpcID01,
+				},
+				AccountID:     testAccountNamespacedName.String(),
+				CloudProvider: string(runtimev1alpha1.AWSCloudProvider),
+			}
+			invalidRule := &cloudresource.CloudRule{
+				Rule: &cloudresource.EgressRule{
+					ToPort:   aws.Int(22),
+					ToDstIP:  []*net.IPNet{},
+					Protocol: aws.Int(6),
+					SrcPort:  aws.Int(1024),
+				}, NpNamespacedName: testAnpNamespacedName.String()}
+			addRule := []*cloudresource.CloudRule{{
+				Rule: &cloudresource.EgressRule{
+					ToPort:           aws.Int(22),
+					ToDstIP:          []*net.IPNet{},
+					ToSecurityGroups: []*cloudresource.CloudResourceID{&webSgIdentifier.CloudResourceID},
+					Protocol:         aws.Int(6),
+				}, NpNamespacedName: testAnpNamespacedName.String()}, invalidRule}
+			output := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier.CloudResourceID, true, false)
+			outputAt := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier.CloudResourceID, false, false)
+			output.SecurityGroups = append(output.SecurityGroups, outputAt.SecurityGroups...)
+
+			mockawsEC2.EXPECT().describeSecurityGroups(gomock.Any()).Return(output, nil).Times(1)
+			mockawsEC2.EXPECT().revokeSecurityGroupEgress(gomock.Any()).Times(0)
+			mockawsEC2.EXPECT().authorizeSecurityGroupEgress(gomock.Any()).Times(1).
+				Do(func(req *ec2.AuthorizeSecurityGroupEgressInput) {
+					Expect(len(req.IpPermissions)).To(Equal(1))
+					Expect(req.IpPermissions[0].UserIdGroupPairs).To(HaveLen(1))
+				})
+
+			err := cloudInterface.UpdateSecurityGroupRules(webSgIdentifier, addRule, []*cloudresource.CloudRule{})
+			var invalidRulesErr *cloudresource.InvalidRulesError
+			Expect(errors.As(err, &invalidRulesErr)).To(BeTrue())
+			Expect(invalidRulesErr.Rejected).To(HaveLen(1))
+			Expect(invalidRulesErr.Rejected).To(HaveKey(invalidRule))
+		})
 		It("Should create egress rules successfully", func() {
 			webSgIdentifier := &cloudresource.CloudResource{
 				Type: cloudresource.CloudResourceTypeVM,
@@ -459,7 +598,7 @@ var _ = Describe("AWS Cloud Security", func() {
 			output1 := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier1.CloudResourceID, true, false)
 			output2 := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier2.CloudResourceID, true, false)
 			outputAt := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier1.CloudResourceID, false, false)
-			desc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String())
+			desc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String(), "")
 			outputAt.SecurityGroups[0].IpPermissions = []*ec2.IpPermission{
 				{
 					FromPort:   aws.Int64(22),
@@ -561,7 +700,7 @@ var _ = Describe("AWS Cloud Security", func() {
 			output1 := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier1.CloudResourceID, true, false)
 			output2 := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier2.CloudResourceID, true, false)
 			outputAt := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier1.CloudResourceID, false, false)
-			desc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String())
+			desc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String(), "")
 			outputAt.SecurityGroups[0].IpPermissionsEgress = []*ec2.IpPermission{
 				{
 					FromPort:   aws.Int64(22),
@@ -608,6 +747,63 @@ var _ = Describe("AWS Cloud Security", func() {
 			err := cloudInterface.UpdateSecurityGroupRules(webSgIdentifier1, addRule, []*cloudresource.CloudRule{})
 			Expect(err).Should(BeNil())
 		})
+		It("Should allow egress to account allow CIDRs not allowed by policy rules", func() {
+			webSgIdentifier := &cloudresource.CloudResource{
+				Type: cloudresource.CloudResourceTypeVM,
+				CloudResourceID: cloudresource.CloudResourceID{
+					Name: "Web",
+					Vpc:  testVpcID01,
+				},
+				AccountID:     testAccountNamespacedName.String(),
+				CloudProvider: string(runtimev1alpha1.AWSCloudProvider),
+			}
+			accCfg, _ := cloudInterface.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+			ec2Service := accCfg.GetServiceConfig().(*ec2ServiceConfig)
+			var err error
+			ec2Service.credentials.egressAllowCIDRs, err = utils.ParseCIDRs([]string{"10.10.0.0/16", "172.16.0.0/12",
+				"192.168.0.0/16"})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			policyDesc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String(), "")
+			allowListDesc, _ := utils.GenerateCloudDescription(utils.GetEgressAllowListRuleOwner(), "")
+			outputAt := constructEc2DescribeSecurityGroupsOutput(&webSgIdentifier.CloudResourceID, false, false)
+			outputAt.SecurityGroups[0].IpPermissionsEgress = []*ec2.IpPermission{
+				{
+					IpProtocol: aws.String(awsAnyProtocolValue),
+					IpRanges: []*ec2.IpRange{
+						{CidrIp: aws.String("172.16.0.0/12"), Description: aws.String(policyDesc)},
+						{CidrIp: aws.String("192.168.0.0/16"), Description: aws.String(allowListDesc)},
+						{CidrIp: aws.String("10.20.0.0/16"), Description: aws.String(allowListDesc)},
+					},
+				},
+			}
+			mockawsEC2.EXPECT().describeSecurityGroups(gomock.Any()).Return(outputAt, nil).Times(1)
+			mockawsEC2.EXPECT().revokeSecurityGroupIngress(gomock.Any()).Times(0)
+			mockawsEC2.EXPECT().authorizeSecurityGroupIngress(gomock.Any()).Times(0)
+			mockawsEC2.EXPECT().authorizeSecurityGroupEgress(gomock.Any()).Times(1).
+				Do(func(req *ec2.AuthorizeSecurityGroupEgressInput) {
+					Expect(req.IpPermissions).To(Equal([]*ec2.IpPermission{{
+						IpProtocol: aws.String(awsAnyProtocolValue),
+						IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("10.10.0.0/16"), Description: aws.String(allowListDesc)}},
+					}}))
+				})
+			mockawsEC2.EXPECT().revokeSecurityGroupEgress(gomock.Any()).Times(1).
+				Do(func(req *ec2.RevokeSecurityGroupEgressInput) {
+					Expect(req.IpPermissions).To(Equal([]*ec2.IpPermission{{
+						IpProtocol: aws.String(awsAnyProtocolValue),
+						IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("10.20.0.0/16"), Description: aws.String(allowListDesc)}},
+					}}))
+				})
+
+			err = cloudInterface.UpdateSecurityGroupRules(webSgIdentifier, []*cloudresource.CloudRule{}, []*cloudresource.CloudRule{})
+			Expect(err).Should(BeNil())
+
+			// allow-list rules are not owned by network policies.
+			cloudRules := convertFromEgressIpPermissionToCloudRule(webSgIdentifier.String(),
+				outputAt.SecurityGroups[0].IpPermissionsEgress, nil, nil)
+			Expect(cloudRules).To(HaveLen(1))
+			Expect(cloudRules[0].NpNamespacedName).To(Equal(testAnpNamespacedName.String()))
+		})
 	})
 
 	Context("GetEnforcedSecurity", func() {
@@ -790,6 +986,96 @@ var _ = Describe("AWS Cloud Security", func() {
 			}
 		})
 	})
+
+	Context("Rule description", func() {
+		const (
+			testAnpUID        = "0b8e5e6e-4e0f-4f3c-a4f4-6a5b2f3c1d01"
+			testRecreatedUID  = "9d1c2b3a-7f6e-4d5c-b4a3-2e1f0a9b8c02"
+			testSgID          = "sg-0123456789"
+			testRuleCIDR      = "1.1.1.1/32"
+			testRuleProtocol  = "6"
+			testRulePortValue = 22
+		)
+
+		It("Should round trip policy uid in rule description", func() {
+			descString, err := utils.GenerateCloudDescription(testAnpNamespacedName.String(), testAnpUID)
+			Expect(err).ShouldNot(HaveOccurred())
+			desc, ok := utils.ExtractCloudDescription(&descString)
+			Expect(ok).To(BeTrue())
+			Expect(*desc).To(Equal(cloudresource.CloudRuleDescription{
+				Name:      testAnpNamespacedName.Name,
+				Namespace: testAnpNamespacedName.Namespace,
+				UID:       testAnpUID,
+			}))
+
+			descString, err = utils.GenerateCloudDescriptionWithLogging(testAnpNamespacedName.String(), testAnpUID, true)
+			Expect(err).ShouldNot(HaveOccurred())
+			desc, ok = utils.ExtractCloudDescription(&descString)
+			Expect(ok).To(BeTrue())
+			Expect(desc.UID).To(Equal(testAnpUID))
+			Expect(desc.Logging).To(BeTrue())
+
+			// descriptions without uid are still accepted.
+			descString, err = utils.GenerateCloudDescription(testAnpNamespacedName.String(), "")
+			Expect(err).ShouldNot(HaveOccurred())
+			desc, ok = utils.ExtractCloudDescription(&descString)
+			Expect(ok).To(BeTrue())
+			Expect(desc.UID).To(BeEmpty())
+		})
+
+		It("Should detect stale rules of a recreated policy", func() {
+			staleDesc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String(), testAnpUID)
+			legacyDesc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String(), "")
+			ipPermissions := []*ec2.IpPermission{
+				{
+					FromPort:   aws.Int64(testRulePortValue),
+					IpProtocol: aws.String(testRuleProtocol),
+					IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(testRuleCIDR), Description: &staleDesc}},
+					ToPort:     aws.Int64(testRulePortValue),
+				},
+				{
+					FromPort:   aws.Int64(testRulePortValue),
+					IpProtocol: aws.String(testRuleProtocol),
+					IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(testRuleCIDR), Description: &legacyDesc}},
+					ToPort:     aws.Int64(testRulePortValue),
+				},
+			}
+			rules := convertFromIngressIpPermissionToCloudRule(testSgID, ipPermissions, nil, nil)
+			Expect(rules).To(HaveLen(2))
+			staleRule, legacyRule := rules[0], rules[1]
+			Expect(staleRule.NpUID).To(Equal(testAnpUID))
+			// the uid is not part of the rule hash, the rule of the recreated policy is the same rule.
+			Expect(staleRule.Hash).To(Equal(legacyRule.Hash))
+
+			Expect(staleRule.IsStale(testAnpNamespacedName.String(), testRecreatedUID)).To(BeTrue())
+			Expect(staleRule.IsStale(testAnpNamespacedName.String(), testAnpUID)).To(BeFalse())
+			Expect(staleRule.IsStale("other-ns/other-anp", testRecreatedUID)).To(BeFalse())
+			Expect(legacyRule.IsStale(testAnpNamespacedName.String(), testRecreatedUID)).To(BeFalse())
+		})
+		It("Should skip rules with an unsupported protocol", func() {
+			desc, _ := utils.GenerateCloudDescription(testAnpNamespacedName.String(), testAnpUID)
+			ipPermissions := []*ec2.IpPermission{
+				{
+					FromPort:   aws.Int64(testRulePortValue),
+					IpProtocol: aws.String("unknown"),
+					IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(testRuleCIDR), Description: &desc}},
+					ToPort:     aws.Int64(testRulePortValue),
+				},
+				{
+					FromPort:   aws.Int64(testRulePortValue),
+					IpProtocol: aws.String(testRuleProtocol),
+					IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(testRuleCIDR), Description: &desc}},
+					ToPort:     aws.Int64(testRulePortValue),
+				},
+			}
+			ingressRules := convertFromIngressIpPermissionToCloudRule(testSgID, ipPermissions, nil, nil)
+			Expect(ingressRules).To(HaveLen(1))
+			Expect(ingressRules[0].Rule.(*cloudresource.IngressRule).Protocol).ShouldNot(BeNil())
+			egressRules := convertFromEgressIpPermissionToCloudRule(testSgID, ipPermissions, nil, nil)
+			Expect(egressRules).To(HaveLen(1))
+			Expect(egressRules[0].Rule.(*cloudresource.EgressRule).Protocol).ShouldNot(BeNil())
+		})
+	})
 })
 
 func constructEc2DescribeSecurityGroupsInput(vpcID string, sgNamesSet map[string]struct{}) *ec2.DescribeSecurityGroupsInput {
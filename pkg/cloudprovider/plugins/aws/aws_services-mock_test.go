@@ -23,6 +23,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	types "k8s.io/apimachinery/pkg/types"
 )
 
 // MockawsServiceClientCreateInterface is a mock of awsServiceClientCreateInterface interface.
@@ -87,16 +88,16 @@ func (m *MockawsServicesHelper) EXPECT() *MockawsServicesHelperMockRecorder {
 }
 
 // newServiceSdkConfigProvider mocks base method.
-func (m *MockawsServicesHelper) newServiceSdkConfigProvider(accCfg *awsAccountConfig) (awsServiceClientCreateInterface, error) {
+func (m *MockawsServicesHelper) newServiceSdkConfigProvider(accountNamespacedName *types.NamespacedName, accCfg *awsAccountConfig) (awsServiceClientCreateInterface, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "newServiceSdkConfigProvider", accCfg)
+	ret := m.ctrl.Call(m, "newServiceSdkConfigProvider", accountNamespacedName, accCfg)
 	ret0, _ := ret[0].(awsServiceClientCreateInterface)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // newServiceSdkConfigProvider indicates an expected call of newServiceSdkConfigProvider.
-func (mr *MockawsServicesHelperMockRecorder) newServiceSdkConfigProvider(accCfg interface{}) *gomock.Call {
+func (mr *MockawsServicesHelperMockRecorder) newServiceSdkConfigProvider(accountNamespacedName, accCfg interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "newServiceSdkConfigProvider", reflect.TypeOf((*MockawsServicesHelper)(nil).newServiceSdkConfigProvider), accCfg)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "newServiceSdkConfigProvider", reflect.TypeOf((*MockawsServicesHelper)(nil).newServiceSdkConfigProvider), accountNamespacedName, accCfg)
 }
@@ -20,11 +20,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"k8s.io/apimachinery/pkg/types"
 
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
 // awsServiceClientCreateInterface provides interface to create aws service clients.
@@ -42,15 +44,22 @@ type awsServiceSdkConfigProvider struct {
 
 // awsServicesHelper.
 type awsServicesHelper interface {
-	newServiceSdkConfigProvider(accCfg *awsAccountConfig) (awsServiceClientCreateInterface, error)
+	newServiceSdkConfigProvider(accountNamespacedName *types.NamespacedName, accCfg *awsAccountConfig) (
+		awsServiceClientCreateInterface, error)
 }
 
 type awsServicesHelperImpl struct{}
 
 // newServiceSdkConfigProvider returns config to create aws services clients.
-func (h *awsServicesHelperImpl) newServiceSdkConfigProvider(accConfig *awsAccountConfig) (awsServiceClientCreateInterface, error) {
+func (h *awsServicesHelperImpl) newServiceSdkConfigProvider(accountNamespacedName *types.NamespacedName,
+	accConfig *awsAccountConfig) (awsServiceClientCreateInterface, error) {
 	var creds *credentials.Credentials
 	var err error
+	// A nil client uses the default HTTP client of the SDK.
+	httpClient, err := utils.NewProxyHTTPClient(accConfig.proxy)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing AWS HTTP client: %v", err)
+	}
 	if len(accConfig.RoleArn) != 0 {
 		var sess *session.Session
 		// If credentials are specified too, create a session with these credentials.
@@ -60,6 +69,7 @@ func (h *awsServicesHelperImpl) newServiceSdkConfigProvider(accConfig *awsAccoun
 				Region:                        &accConfig.region,
 				Credentials:                   tempCreds,
 				CredentialsChainVerboseErrors: aws.Bool(true),
+				HTTPClient:                    httpClient,
 			}); err != nil {
 				return nil, fmt.Errorf("error initializing AWS session: %v", err)
 			}
@@ -69,6 +79,7 @@ func (h *awsServicesHelperImpl) newServiceSdkConfigProvider(accConfig *awsAccoun
 			if sess, err = session.NewSession(&aws.Config{
 				Region:                        &accConfig.region,
 				CredentialsChainVerboseErrors: aws.Bool(true),
+				HTTPClient:                    httpClient,
 			}); err != nil {
 				return nil, fmt.Errorf("error initializing AWS session: %v", err)
 			}
@@ -95,12 +106,20 @@ func (h *awsServicesHelperImpl) newServiceSdkConfigProvider(accConfig *awsAccoun
 		Endpoint:                      &accConfig.endpoint,
 		Credentials:                   creds,
 		CredentialsChainVerboseErrors: aws.Bool(true),
+		HTTPClient:                    httpClient,
 	}
 
 	sess, err := session.NewSession(awsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing AWS session: %v", err)
 	}
+	// Count the failed API calls of the account, once retries are exhausted.
+	account := accountNamespacedName.String()
+	sess.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error != nil {
+			internal.RecordAPIError(string(providerType), account, classifyAWSError(r.Error))
+		}
+	})
 	configProvider := &awsServiceSdkConfigProvider{
 		session: sess,
 	}
@@ -112,7 +131,7 @@ func newAwsServiceConfigs(accountNamespacedName *types.NamespacedName, accCreden
 	awsServicesHelper := awsSpecificHelper.(awsServicesHelper)
 	awsAccountCredentials := accCredentials.(*awsAccountConfig)
 
-	awsServiceClientCreator, err := awsServicesHelper.newServiceSdkConfigProvider(awsAccountCredentials)
+	awsServiceClientCreator, err := awsServicesHelper.newServiceSdkConfigProvider(accountNamespacedName, awsAccountCredentials)
 	if err != nil {
 		return nil, err
 	}
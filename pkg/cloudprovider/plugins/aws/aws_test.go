@@ -18,15 +18,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
 	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -35,6 +39,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"antrea.io/nephe/apis/crd/v1alpha1"
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	nephetypes "antrea.io/nephe/pkg/types"
+	"antrea.io/nephe/pkg/util"
 )
 
 var (
@@ -125,8 +133,9 @@ var _ = Describe("AWS cloud", func() {
 				mockawsService = NewMockawsServiceClientCreateInterface(mockCtrl)
 				mockawsEC2 = NewMockawsEC2Wrapper(mockCtrl)
 
-				mockawsCloudHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any()).Return(mockawsService, nil)
+				mockawsCloudHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any(), gomock.Any()).Return(mockawsService, nil)
 				mockawsService.EXPECT().compute().Return(mockawsEC2, nil).AnyTimes()
+				mockawsEC2.EXPECT().dryRun(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
 			})
 			It("On account add expect cloud api call for retrieving vpc list", func() {
 				credential := `{"accessKeyId": "keyId","accessKeySecret": "keySecret"}`
@@ -142,10 +151,10 @@ var _ = Describe("AWS cloud", func() {
 				}
 				instanceIds := []string{}
 				vpcIDs := []string{"testVpcID01", "testVpcID02"}
-				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
+				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
 				mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).Times(0)
-				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(createVpcObject(vpcIDs), nil).AnyTimes()
-				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
+				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(createVpcObject(vpcIDs), nil).AnyTimes()
+				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
 					nil).AnyTimes()
 
 				_ = fakeClient.Create(context.Background(), secret)
@@ -177,10 +186,10 @@ var _ = Describe("AWS cloud", func() {
 				}
 				instanceIds := []string{}
 				vpcIDs := []string{"testVpcID01", "testVpcID02"}
-				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
+				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
 				mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).Times(0)
-				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(createVpcObject(vpcIDs), nil).AnyTimes()
-				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
+				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(createVpcObject(vpcIDs), nil).AnyTimes()
+				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
 					nil).AnyTimes()
 
 				_ = fakeClient.Create(context.Background(), secret)
@@ -199,6 +208,53 @@ var _ = Describe("AWS cloud", func() {
 				Expect(err).Should(BeNil())
 				Expect(len(cloudInventory.VpcMap)).Should(Equal(len(vpcIDs)))
 			})
+			It("Fetch vpc peerings from snapshot", func() {
+				credential := `{"accessKeyId": "keyId","accessKeySecret": "keySecret"}`
+
+				secret = &corev1.Secret{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      testAccountNamespacedName.Name,
+						Namespace: testAccountNamespacedName.Namespace,
+					},
+					Data: map[string][]byte{
+						"credentials": []byte(credential),
+					},
+				}
+				vpcIDs := []string{"testVpcID01", "testVpcID02"}
+				peerings := &ec2.DescribeVpcPeeringConnectionsOutput{
+					VpcPeeringConnections: []*ec2.VpcPeeringConnection{{
+						AccepterVpcInfo:  &ec2.VpcPeeringConnectionVpcInfo{VpcId: aws.String(vpcIDs[0]), CidrBlock: aws.String("10.0.0.0/16")},
+						RequesterVpcInfo: &ec2.VpcPeeringConnectionVpcInfo{VpcId: aws.String(vpcIDs[1]), CidrBlock: aws.String("10.1.0.0/16")},
+						Status:           &ec2.VpcPeeringConnectionStateReason{Code: aws.String(ec2.VpcPeeringConnectionStateReasonCodeActive)},
+					}},
+				}
+				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(nil), nil).AnyTimes()
+				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(createVpcObject(vpcIDs), nil).AnyTimes()
+				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(peerings, nil).AnyTimes()
+
+				_ = fakeClient.Create(context.Background(), secret)
+				c := newAWSCloud(mockawsCloudHelper)
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(c.DoInventoryPoll(&testAccountNamespacedName)).Should(BeNil())
+
+				vpcPeerings, err := c.GetVpcPeerings(&testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(vpcPeerings).To(Equal([]nephetypes.VpcPeering{{
+					AccepterID:      vpcIDs[0],
+					RequesterID:     vpcIDs[1],
+					SourceCIDR:      "10.0.0.0/16",
+					DestinationCIDR: "10.1.0.0/16",
+					State:           ec2.VpcPeeringConnectionStateReasonCodeActive,
+				}}))
+				// the typed peering matches the raw peers of both vpcs.
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(&testAccountNamespacedName)
+				ec2Cfg := accCfg.GetServiceConfig().(*ec2ServiceConfig)
+				Expect(ec2Cfg.getVpcPeers(vpcIDs[0])).To(Equal([]string{vpcPeerings[0].RequesterID}))
+				Expect(ec2Cfg.getVpcPeers(vpcIDs[1])).To(Equal([]string{vpcPeerings[0].AccepterID}))
+
+				_, err = c.GetVpcPeerings(&types.NamespacedName{Namespace: "notexist", Name: "notexist"})
+				Expect(err).ShouldNot(BeNil())
+			})
 			It("StopPoller cloud inventory poll on poller delete", func() {
 				credential := `{"accessKeyId": "keyId","accessKeySecret": "keySecret", "sessionToken": "token"}`
 
@@ -213,10 +269,10 @@ var _ = Describe("AWS cloud", func() {
 				}
 				instanceIds := []string{}
 				vpcIDs := []string{"testVpcID01", "testVpcID02"}
-				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
+				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
 				mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).Times(0)
-				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(createVpcObject(vpcIDs), nil).AnyTimes()
-				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
+				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(createVpcObject(vpcIDs), nil).AnyTimes()
+				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
 					nil).AnyTimes()
 
 				_ = fakeClient.Create(context.Background(), secret)
@@ -234,10 +290,11 @@ var _ = Describe("AWS cloud", func() {
 				errPolDel := c.ResetInventoryCache(&testAccountNamespacedName)
 				Expect(errPolDel).Should(BeNil())
 
-				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).Times(0)
+				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).Times(0)
 				mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).Times(0)
-				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).Times(0)
-				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{}, nil).Times(0)
+				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).Times(0)
+				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(
+					&ec2.DescribeVpcPeeringConnectionsOutput{}, nil).Times(0)
 			})
 			It("Should discover instances when selector is in different namespace from account", func() {
 				instanceIds := []string{"i-01", "i-02"}
@@ -271,10 +328,10 @@ var _ = Describe("AWS cloud", func() {
 					},
 				}
 
-				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
+				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
 				mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).AnyTimes()
-				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
-				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
+				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
+				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
 					nil).AnyTimes()
 
 				_ = fakeClient.Create(context.Background(), secret)
@@ -297,10 +354,10 @@ var _ = Describe("AWS cloud", func() {
 			})
 			It("Should discover no instances with get ALL selector", func() {
 				instanceIds := []string{}
-				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
+				mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
 				mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).AnyTimes()
-				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
-				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
+				mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
+				mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{},
 					nil).AnyTimes()
 				_ = fakeClient.Create(context.Background(), secret)
 				c := newAWSCloud(mockawsCloudHelper)
@@ -401,14 +458,16 @@ var _ = Describe("AWS cloud", func() {
 			mockawsService = NewMockawsServiceClientCreateInterface(mockCtrl)
 			mockawsEC2 = NewMockawsEC2Wrapper(mockCtrl)
 
-			mockawsCloudHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any()).Return(mockawsService, nil).Times(1)
+			mockawsCloudHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any(), gomock.Any()).Return(mockawsService, nil).Times(1)
 			mockawsService.EXPECT().compute().Return(mockawsEC2, nil).AnyTimes()
+			mockawsEC2.EXPECT().dryRun(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
 
 			instanceIds := []string{}
-			mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
+			mockawsEC2.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), gomock.Any()).Return(getEc2InstanceObject(instanceIds), nil).AnyTimes()
 			mockawsEC2.EXPECT().pagedDescribeNetworkInterfaces(gomock.Any()).Return([]*ec2.NetworkInterface{}, nil).AnyTimes()
-			mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
-			mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any()).Return(&ec2.DescribeVpcPeeringConnectionsOutput{}, nil).AnyTimes()
+			mockawsEC2.EXPECT().describeVpcsWrapper(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVpcsOutput{}, nil).AnyTimes()
+			mockawsEC2.EXPECT().describeVpcPeeringConnectionsWrapper(gomock.Any(), gomock.Any()).Return(
+				&ec2.DescribeVpcPeeringConnectionsOutput{}, nil).AnyTimes()
 		})
 
 		AfterEach(func() {
@@ -654,6 +713,176 @@ var _ = Describe("AWS cloud", func() {
 			filters := getFilters(c, testSelectorNamespacedName)
 			Expect(filters).To(Equal(expectedFilters))
 		})
+		It("Should select all Linux VMs - osFamily only match", func() {
+			c := setAwsAccount(mockawsCloudHelper)
+			osFamilyFilter := &ec2.Filter{
+				Name:   aws.String(awsCustomFilterKeyOSFamily),
+				Values: []*string{aws.String(string(runtimev1alpha1.OSFamilyLinux))},
+			}
+			expectedFilters := [][]*ec2.Filter{{buildEc2FilterForValidInstanceStates(), osFamilyFilter}}
+
+			selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+				{OSFamilyMatch: string(runtimev1alpha1.OSFamilyLinux)},
+			}
+			err := c.AddAccountResourceSelector(&testAccountNamespacedName, selector)
+			Expect(err).Should(BeNil())
+			filters := getFilters(c, testSelectorNamespacedName)
+			Expect(filters).To(Equal(expectedFilters))
+
+			// the internal os family filter is not sent to cloud, instances are matched by their platform.
+			instances := getEc2InstanceObject([]string{testVMID01, testVMID02})
+			instances[1].Platform = aws.String(ec2.PlatformValuesWindows)
+			ec2Mock := NewMockawsEC2Wrapper(mockCtrl)
+			ec2Mock.EXPECT().pagedDescribeInstancesWrapper(gomock.Any(), &ec2.DescribeInstancesInput{
+				MaxResults: aws.Int64(internal.MaxCloudResourceResponse),
+				Filters:    []*ec2.Filter{buildEc2FilterForValidInstanceStates()},
+			}).Return(instances, nil).Times(1)
+			ec2Cfg := &ec2ServiceConfig{apiClient: ec2Mock}
+			linuxInstances, err := ec2Cfg.getInstancesByFilters(context.Background(), &testSelectorNamespacedName, filters)
+			Expect(err).Should(BeNil())
+			Expect(linuxInstances).To(Equal(instances[:1]))
+		})
+		Context("Allowed selector namespace scenarios", func() {
+			It("Should add selector from an allowed namespace", func() {
+				account.Spec.AllowedSelectorNamespaces = []string{"namespace02", testSelectorNamespacedName.Namespace}
+				c := setAwsAccount(mockawsCloudHelper)
+				err := c.AddAccountResourceSelector(&testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				Expect(getFilters(c, testSelectorNamespacedName)).ShouldNot(BeNil())
+			})
+			It("Should reject selector from a disallowed namespace", func() {
+				account.Spec.AllowedSelectorNamespaces = []string{"namespace02"}
+				c := setAwsAccount(mockawsCloudHelper)
+				err := c.AddAccountResourceSelector(&testAccountNamespacedName, selector)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("selector namespace namespace01 is not allowed"))
+				Expect(getFilters(c, testSelectorNamespacedName)).Should(BeNil())
+
+				// selector is accepted once its namespace is allowed by an account update.
+				account.Spec.AllowedSelectorNamespaces = append(account.Spec.AllowedSelectorNamespaces,
+					testSelectorNamespacedName.Namespace)
+				_ = c.AddProviderAccount(fakeClient, account)
+				err = c.AddAccountResourceSelector(&testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+			})
+			It("Should remove selectors of namespaces no longer allowed", func() {
+				account.Spec.AllowedSelectorNamespaces = nil
+				c := setAwsAccount(mockawsCloudHelper)
+				Expect(c.AddAccountResourceSelector(&testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(getFilters(c, testSelectorNamespacedName)).ShouldNot(BeNil())
+
+				account.Spec.AllowedSelectorNamespaces = []string{"namespace02"}
+				_ = c.AddProviderAccount(fakeClient, account)
+				Expect(getFilters(c, testSelectorNamespacedName)).Should(BeNil())
+			})
+		})
+	})
+
+	Context("Proxy", func() {
+		It("Should send API calls through the account proxy", func() {
+			accConfig := &awsAccountConfig{
+				AwsAccountCredential: v1alpha1.AwsAccountCredential{AccessKeyID: "keyId", AccessKeySecret: "keySecret"},
+				region:               "us-east-1",
+				proxy: &v1alpha1.ProxyConfig{
+					URL:     "http://proxy.example.com:3128",
+					NoProxy: []string{".internal.example.com"},
+				},
+			}
+			provider, err := (&awsServicesHelperImpl{}).newServiceSdkConfigProvider(&testAccountNamespacedName, accConfig)
+			Expect(err).Should(BeNil())
+			httpClient := provider.(*awsServiceSdkConfigProvider).session.Config.HTTPClient
+			transport, ok := httpClient.Transport.(*http.Transport)
+			Expect(ok).To(BeTrue())
+
+			req, _ := http.NewRequest(http.MethodPost, "https://ec2.us-east-1.amazonaws.com/", nil)
+			proxyURL, err := transport.Proxy(req)
+			Expect(err).Should(BeNil())
+			Expect(proxyURL.String()).To(Equal("http://proxy.example.com:3128"))
+
+			req, _ = http.NewRequest(http.MethodPost, "https://ec2.internal.example.com/", nil)
+			proxyURL, err = transport.Proxy(req)
+			Expect(err).Should(BeNil())
+			Expect(proxyURL).To(BeNil())
+		})
+	})
+
+	Context("Permission probe scenarios", func() {
+		It("Should report the actions denied by a dry run as missing", func() {
+			mockCtrl := gomock.NewController(GinkgoT())
+			defer mockCtrl.Finish()
+			mockawsEC2 := NewMockawsEC2Wrapper(mockCtrl)
+			vpcIDs := []string{testVpcID01, "vpc-0a1b2c3d"}
+			createdIn := []string{}
+			mockawsEC2.EXPECT().dryRun(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+				func(_ context.Context, action string, vpcID string) (bool, error) {
+					if action != actionCreateSecurityGroup {
+						return true, nil
+					}
+					createdIn = append(createdIn, vpcID)
+					// creation permitted in the first vpc only.
+					return vpcID == testVpcID01, nil
+				})
+
+			missing, err := probePermissions(context.Background(), mockawsEC2, vpcIDs, testAccountNamespacedName)
+			Expect(err).Should(BeNil())
+			Expect(missing.Inventory).To(BeEmpty())
+			Expect(missing.Security).To(Equal([]string{actionCreateSecurityGroup}))
+			Expect(createdIn).To(Equal(vpcIDs))
+		})
+		It("Should fail the probe on errors other than authorization failures", func() {
+			mockCtrl := gomock.NewController(GinkgoT())
+			defer mockCtrl.Finish()
+			mockawsEC2 := NewMockawsEC2Wrapper(mockCtrl)
+			mockawsEC2.EXPECT().dryRun(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, errors.New("connection reset")).Times(1)
+
+			_, err := probePermissions(context.Background(), mockawsEC2, nil, testAccountNamespacedName)
+			Expect(err).ShouldNot(BeNil())
+		})
+	})
+
+	Context("API error scenarios", func() {
+		AfterEach(func() {
+			internal.DeleteAPIErrors(string(providerType), testAccountNamespacedName.String())
+		})
+
+		It("Should classify representative AWS errors", func() {
+			errs := map[error]internal.APIErrorClass{
+				awserr.New("AuthFailure", "invalid credentials", nil):                                  internal.APIErrorClassAuth,
+				awserr.New("UnauthorizedOperation", "not authorized", nil):                             internal.APIErrorClassAuth,
+				awserr.New("RequestLimitExceeded", "request limit exceeded", nil):                      internal.APIErrorClassThrottle,
+				awserr.New("InvalidInstanceID.NotFound", "instance does not exist", nil):               internal.APIErrorClassNotFound,
+				awserr.New("InvalidGroup.NotFound", "security group does not exist", nil):              internal.APIErrorClassNotFound,
+				awserr.New("InternalError", "internal error", nil):                                     internal.APIErrorClassServerError,
+				awserr.NewRequestFailure(awserr.New("Forbidden", "", nil), http.StatusForbidden, "id"): internal.APIErrorClassAuth,
+				awserr.NewRequestFailure(awserr.New("Unknown", "", nil), http.StatusBadGateway, "id"):  internal.APIErrorClassServerError,
+				awserr.New("InvalidParameterValue", "invalid value", nil):                              internal.APIErrorClassOther,
+				errors.New("connection reset by peer"):                                                 internal.APIErrorClassOther,
+			}
+			for err, class := range errs {
+				Expect(classifyAWSError(err)).To(Equal(class), "error %v", err)
+			}
+		})
+
+		It("Should count failed API calls of the account session", func() {
+			accConfig := &awsAccountConfig{
+				AwsAccountCredential: v1alpha1.AwsAccountCredential{AccessKeyID: "keyId", AccessKeySecret: "keySecret"},
+				region:               "us-east-1",
+			}
+			provider, err := (&awsServicesHelperImpl{}).newServiceSdkConfigProvider(&testAccountNamespacedName, accConfig)
+			Expect(err).Should(BeNil())
+			handlers := provider.(*awsServiceSdkConfigProvider).session.Handlers.Complete
+			handlers.Run(&request.Request{Error: awserr.New("AuthFailure", "invalid credentials", nil)})
+			handlers.Run(&request.Request{Error: awserr.New("Throttling", "rate exceeded", nil)})
+			handlers.Run(&request.Request{})
+
+			account := testAccountNamespacedName.String()
+			Expect(testutil.ToFloat64(internal.APIErrorsCounter.WithLabelValues(account, string(providerType),
+				string(internal.APIErrorClassAuth)))).To(Equal(float64(1)))
+			Expect(testutil.ToFloat64(internal.APIErrorsCounter.WithLabelValues(account, string(providerType),
+				string(internal.APIErrorClassThrottle)))).To(Equal(float64(1)))
+			Expect(testutil.ToFloat64(internal.APIErrorsCounter.WithLabelValues(account, string(providerType),
+				string(internal.APIErrorClassOther)))).To(BeZero())
+		})
 	})
 })
 
@@ -754,3 +983,60 @@ func getFilters(c *awsCloud, selectorNamespacedName types.NamespacedName) [][]*e
 	}
 	return nil
 }
+
+var _ = Describe("AWS account config validation", func() {
+	newAccount := func(regions ...string) *v1alpha1.CloudProviderAccount {
+		return &v1alpha1.CloudProviderAccount{
+			Spec: v1alpha1.CloudProviderAccountSpec{
+				AWSConfig: &v1alpha1.CloudProviderAccountAWSConfig{
+					Region:    regions,
+					SecretRef: &v1alpha1.SecretReference{Name: "secret01", Namespace: "namespace01", Key: "credentials"},
+				},
+			},
+		}
+	}
+
+	It("Should accept valid account configs", func() {
+		Expect(ValidateAccountConfig(newAccount("us-east-1"))).Should(Succeed())
+		Expect(ValidateAccountConfig(newAccount("us-gov-west-1"))).Should(Succeed())
+	})
+
+	It("Should reject account configs with missing or malformed regions", func() {
+		Expect(ValidateAccountConfig(newAccount())).Should(MatchError(ContainSubstring("region cannot be empty")))
+		Expect(ValidateAccountConfig(newAccount(" "))).Should(MatchError(ContainSubstring("invalid region")))
+		Expect(ValidateAccountConfig(newAccount("US-EAST-1"))).Should(MatchError(ContainSubstring("invalid region")))
+		Expect(ValidateAccountConfig(newAccount("us-east"))).Should(MatchError(ContainSubstring("invalid region")))
+	})
+
+	It("Should reject account configs with missing or incomplete Secret references", func() {
+		account := newAccount("us-east-1")
+		account.Spec.AWSConfig.SecretRef = nil
+		Expect(ValidateAccountConfig(account)).Should(MatchError(ContainSubstring("secretRef cannot be empty")))
+		account.Spec.AWSConfig.FallbackSecretRefs = []v1alpha1.SecretReference{{Name: "secret02", Namespace: "namespace01"}}
+		Expect(ValidateAccountConfig(account)).Should(MatchError(ContainSubstring("must specify name, namespace and key")))
+		account.Spec.AWSConfig = nil
+		Expect(ValidateAccountConfig(account)).Should(HaveOccurred())
+	})
+
+	It("Should accept either static credentials or a role", func() {
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{AccessKeyID: "id", AccessKeySecret: "secret",
+			SessionToken: "token"})).Should(Succeed())
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{RoleArn: "arn", ExternalID: "id"})).Should(Succeed())
+		// fields carried along with static credentials or a role are not validated.
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{AccessKeySecret: "secret",
+			RoleArn: "arn"})).Should(Succeed())
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{RoleArn: "arn",
+			SessionToken: "token"})).Should(Succeed())
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{AccessKeyID: "id", AccessKeySecret: "secret",
+			ExternalID: "id"})).Should(Succeed())
+	})
+
+	It("Should reject missing or conflicting credentials", func() {
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{})).Should(
+			MatchError(util.ErrorMsgMissingCredential))
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{AccessKeyID: "id"})).Should(
+			MatchError(util.ErrorMsgMissingCredential))
+		Expect(ValidateAccountCredential(&v1alpha1.AwsAccountCredential{AccessKeyID: "id", AccessKeySecret: "secret",
+			RoleArn: "arn"})).Should(HaveOccurred())
+	})
+})
@@ -19,16 +19,24 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
 // AddProviderAccount adds and initializes given account of a cloud provider.
 func (c *azureCloud) AddProviderAccount(client client.Client, account *crdv1alpha1.CloudProviderAccount) error {
-	return c.cloudCommon.AddCloudAccount(client, account, account.Spec.AzureConfig)
+	return c.cloudCommon.AddCloudAccount(client, account, account)
 }
 
 // RemoveProviderAccount removes and cleans up any resources of given account of a cloud provider.
 func (c *azureCloud) RemoveProviderAccount(namespacedName *types.NamespacedName) {
 	c.cloudCommon.RemoveCloudAccount(namespacedName)
+	internal.SecurityMetrics.DeleteAccount(string(providerType), namespacedName.String())
+	internal.APIQuotaMetrics.DeleteAccount(string(providerType), namespacedName.String())
+	internal.DeleteAPIErrors(string(providerType), namespacedName.String())
+	internal.UnresolvedVpcPeersGauge.DeleteLabelValues(namespacedName.String(), string(providerType))
+	internal.EvictedInventoryVMsGauge.DeleteLabelValues(namespacedName.String(), string(providerType))
+	internal.DeleteSnapshotFootprint(string(providerType), namespacedName.String())
 }
 
 // AddAccountResourceSelector adds account specific resource selector.
@@ -42,7 +50,22 @@ func (c *azureCloud) RemoveAccountResourcesSelector(accNamespacedName, selectorN
 }
 
 func (c *azureCloud) GetAccountStatus(accNamespacedName *types.NamespacedName) (*crdv1alpha1.CloudProviderAccountStatus, error) {
-	return c.cloudCommon.GetStatus(accNamespacedName)
+	status, err := c.cloudCommon.GetStatus(accNamespacedName)
+	if err != nil || status == nil {
+		return status, err
+	}
+	status.APIQuotas = internal.APIQuotaMetrics.Get(string(providerType), accNamespacedName.String())
+	if accCfg, found := c.cloudCommon.GetCloudAccountByName(accNamespacedName); found {
+		computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+		status.UnresolvedVpcPeers = computeCfg.getUnresolvedVnetPeers()
+		status.HeldSelectors = computeCfg.selectorHolds.Get()
+		// identifiers are only known once credentials are resolved from a Secret, the client key is never exposed.
+		if computeCfg.credentials.SubscriptionID != internal.AccountCredentialsDefault {
+			status.SubscriptionID = utils.RedactIdentifier(computeCfg.credentials.SubscriptionID)
+			status.TenantID = utils.RedactIdentifier(computeCfg.credentials.TenantID)
+		}
+	}
+	return status, nil
 }
 
 // DoInventoryPoll calls cloud API to get cloud resources.
@@ -50,7 +73,33 @@ func (c *azureCloud) DoInventoryPoll(accountNamespacedName *types.NamespacedName
 	return c.cloudCommon.DoInventoryPoll(accountNamespacedName)
 }
 
+// RefreshVpc calls cloud API to get the VMs of a single VPC and merges them into the cloud resources.
+func (c *azureCloud) RefreshVpc(accountNamespacedName *types.NamespacedName, vpcID string) error {
+	return c.cloudCommon.RefreshVpc(accountNamespacedName, vpcID)
+}
+
 // ResetInventoryCache resets cloud snapshot and poll stats to nil.
 func (c *azureCloud) ResetInventoryCache(accountNamespacedName *types.NamespacedName) error {
 	return c.cloudCommon.ResetInventoryCache(accountNamespacedName)
 }
+
+// SetCredentialRotationHook sets the hook invoked after the credentials of an account are rotated.
+func (c *azureCloud) SetCredentialRotationHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetCredentialRotationHook(hook)
+}
+
+// SetVpcDeletedHook sets the hook invoked after an inventory poll finds vpcs of an account deleted from cloud.
+func (c *azureCloud) SetVpcDeletedHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetVpcDeletedHook(hook)
+}
+
+// SetAccountResumedHook sets the hook invoked after a paused account is resumed.
+func (c *azureCloud) SetAccountResumedHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetAccountResumedHook(hook)
+}
+
+// SetSecurityOptionsChangedHook sets the hook invoked after account options changing how security groups are enforced
+// are updated in place.
+func (c *azureCloud) SetSecurityOptionsChangedHook(hook func(accountNamespacedName *types.NamespacedName)) {
+	c.cloudCommon.SetSecurityOptionsChangedHook(hook)
+}
@@ -19,29 +19,106 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
+	"reflect"
 	"strings"
 
+	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 	"antrea.io/nephe/pkg/util"
 )
 
 type azureAccountConfig struct {
 	crdv1alpha1.AzureAccountCredential
-	region string
+	region                      string
+	detachPolicy                crdv1alpha1.SecurityGroupDetachPolicy
+	inventoryTombstonePolls     int
+	egressAllowCIDRs            []*net.IPNet
+	proxy                       *crdv1alpha1.ProxyConfig
+	fallbackEndpoints           []string
+	maxInventoryVMs             int
+	inventoryConsistencyRetries int
+	inventoryFields             []string
+	denyRulePlacement           crdv1alpha1.DenyRulePlacement
+	selectorMatchSpikeThreshold int
+	peerAddressSpaceFallback    bool
+	// credentialFingerprint identifies the Secret credential, nil when it could not be resolved.
+	credentialFingerprint *utils.CredentialFingerprint
 }
 
-// setAccountCredentials sets account credentials.
+// ValidateAccountConfig checks the Azure specific invariants of an account config, which do not depend on the Secret
+// content or cloud access, so that they can be enforced by the validating webhook.
+func ValidateAccountConfig(account *crdv1alpha1.CloudProviderAccount) error {
+	azureConfig := account.Spec.AzureConfig
+	if azureConfig == nil {
+		return fmt.Errorf("%v: missing Azure config", util.ErrorMsgUnknownCloudProvider)
+	}
+	if err := utils.ValidateSecretRefs(azureConfig.GetSecretRefs()); err != nil {
+		return err
+	}
+	if len(azureConfig.Region) == 0 {
+		return fmt.Errorf("at least one region must be specified")
+	}
+	for _, region := range azureConfig.Region {
+		if strings.TrimSpace(region) == "" {
+			return fmt.Errorf("region cannot be blank")
+		}
+	}
+	return nil
+}
+
+// setAccountCredentials sets account credentials and the options of the account annotations. Invalid annotations,
+// egress allow CIDRs, proxy and fallback endpoints are ignored and reported as error.
 func setAccountCredentials(client client.Client, credentials interface{}) (interface{}, error) {
-	azureProviderConfig := credentials.(*crdv1alpha1.CloudProviderAccountAzureConfig)
+	account := credentials.(*crdv1alpha1.CloudProviderAccount)
+	azureProviderConfig := account.Spec.AzureConfig
+	options, annotationErr := utils.ParseAccountAnnotations(account.Annotations)
+	if annotationErr != nil {
+		options = &utils.AccountOptions{}
+	}
 	azureConfig := &azureAccountConfig{
-		region: strings.TrimSpace(azureProviderConfig.Region[0]),
+		region:                      strings.TrimSpace(azureProviderConfig.Region[0]),
+		detachPolicy:                azureProviderConfig.DetachPolicy,
+		inventoryTombstonePolls:     options.InventoryTombstonePolls,
+		maxInventoryVMs:             options.MaxInventoryVMs,
+		inventoryConsistencyRetries: options.InventoryConsistencyRetries,
+		inventoryFields:             options.InventoryFields,
+		denyRulePlacement:           options.DenyRulePlacement,
+		selectorMatchSpikeThreshold: options.SelectorMatchSpikeThreshold,
+		peerAddressSpaceFallback:    options.PeerAddressSpaceFallback,
+	}
+	if azureConfig.detachPolicy == "" {
+		azureConfig.detachPolicy = options.DetachPolicy
+	}
+	if azureConfig.detachPolicy == "" {
+		azureConfig.detachPolicy = crdv1alpha1.SecurityGroupDetachPolicyMoveToDefault
+	}
+	if azureConfig.denyRulePlacement == "" {
+		azureConfig.denyRulePlacement = crdv1alpha1.DenyRulePlacementPriorityFloor
 	}
-	accCred, err := extractSecret(client, azureProviderConfig.SecretRef)
+	egressAllowCIDRs, cidrErr := utils.ParseCIDRs(azureProviderConfig.EgressAllowCIDRs)
+	if cidrErr == nil {
+		azureConfig.egressAllowCIDRs = egressAllowCIDRs
+	}
+	var proxyErr error
+	if azureProviderConfig.Proxy != nil {
+		if _, proxyErr = utils.ParseProxyURL(azureProviderConfig.Proxy.URL); proxyErr == nil {
+			azureConfig.proxy = azureProviderConfig.Proxy.DeepCopy()
+		}
+	}
+	fallbackEndpoints, endpointErr := utils.ParseEndpointURLs(azureProviderConfig.FallbackEndpoints)
+	if endpointErr == nil {
+		azureConfig.fallbackEndpoints = fallbackEndpoints
+	}
+	accCred, fingerprint, err := extractSecret(client, &types.NamespacedName{Namespace: account.Namespace, Name: account.Name},
+		azureProviderConfig.GetSecretRefs())
 	if err != nil {
 		accCred.SubscriptionID = internal.AccountCredentialsDefault
 		accCred.TenantID = internal.AccountCredentialsDefault
@@ -51,39 +128,134 @@ func setAccountCredentials(client client.Client, credentials interface{}) (inter
 
 	// As only single region is supported right now, use 0th index in awsProviderConfig.Region as the configured region.
 	azureConfig.AzureAccountCredential = *accCred
-	return azureConfig, err
+	azureConfig.credentialFingerprint = fingerprint
+	return azureConfig, multierr.Combine(err, annotationErr, cidrErr, proxyErr, endpointErr)
+}
+
+// getCredentialIdentity returns the identity of the credentials of the account, which is the same for accounts using
+// the same Secret credential.
+func (accCfg *azureAccountConfig) getCredentialIdentity() string {
+	identity := strings.ToLower(accCfg.TenantID + "/" + accCfg.ClientID)
+	if accCfg.credentialFingerprint != nil {
+		identity += "/" + accCfg.credentialFingerprint.Hash
+	}
+	return identity
 }
 
-func compareAccountCredentials(accountName string, existing interface{}, new interface{}) bool {
+// compareAccountCredentials returns whether the effective credentials, resolved from the primary or a fallback
+// Secret, or other account parameters the cloud clients are created with changed, and whether account options
+// applied in place changed.
+func compareAccountCredentials(accountName string, existing interface{}, new interface{}) (bool, bool) {
 	existingConfig := existing.(*azureAccountConfig)
 	newConfig := new.(*azureAccountConfig)
 
 	credsChanged := false
-	if strings.Compare(existingConfig.SubscriptionID, newConfig.SubscriptionID) != 0 {
+	if !existingConfig.credentialFingerprint.Equal(newConfig.credentialFingerprint) {
 		credsChanged = true
-		azurePluginLogger().Info("Subscription ID updated", "account", accountName)
+		azurePluginLogger().Info("Account credentials updated", "account", accountName,
+			"fields", utils.ChangedCredentialFields(existingConfig.credentialFingerprint, newConfig.credentialFingerprint))
 	}
-	if strings.Compare(existingConfig.ClientID, newConfig.ClientID) != 0 {
+	if strings.Compare(existingConfig.region, newConfig.region) != 0 {
 		credsChanged = true
-		azurePluginLogger().Info("Client ID updated", "account", accountName)
+		azurePluginLogger().Info("Account region updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.TenantID, newConfig.TenantID) != 0 {
+	if !reflect.DeepEqual(existingConfig.proxy, newConfig.proxy) {
 		credsChanged = true
-		azurePluginLogger().Info("Account tenant ID updated", "account", accountName)
+		azurePluginLogger().Info("Account proxy updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.ClientKey, newConfig.ClientKey) != 0 {
+	if !reflect.DeepEqual(existingConfig.fallbackEndpoints, newConfig.fallbackEndpoints) {
 		credsChanged = true
-		azurePluginLogger().Info("Account client key updated", "account", accountName)
+		azurePluginLogger().Info("Account fallback endpoints updated", "account", accountName)
 	}
-	if strings.Compare(existingConfig.region, newConfig.region) != 0 {
-		credsChanged = true
-		azurePluginLogger().Info("Account region updated", "account", accountName)
+
+	optionsChanged := false
+	if existingConfig.detachPolicy != newConfig.detachPolicy {
+		optionsChanged = true
+		azurePluginLogger().Info("Account detach policy updated", "account", accountName)
+	}
+	if existingConfig.inventoryTombstonePolls != newConfig.inventoryTombstonePolls {
+		optionsChanged = true
+		azurePluginLogger().Info("Account inventory tombstone polls updated", "account", accountName)
+	}
+	if existingConfig.maxInventoryVMs != newConfig.maxInventoryVMs {
+		optionsChanged = true
+		azurePluginLogger().Info("Account max inventory VMs updated", "account", accountName)
+	}
+	if existingConfig.inventoryConsistencyRetries != newConfig.inventoryConsistencyRetries {
+		optionsChanged = true
+		azurePluginLogger().Info("Account inventory consistency retries updated", "account", accountName)
+	}
+	if !reflect.DeepEqual(existingConfig.inventoryFields, newConfig.inventoryFields) {
+		optionsChanged = true
+		azurePluginLogger().Info("Account inventory fields updated", "account", accountName)
+	}
+	if existingConfig.denyRulePlacement != newConfig.denyRulePlacement {
+		optionsChanged = true
+		azurePluginLogger().Info("Account deny rule placement updated", "account", accountName)
+	}
+	if existingConfig.selectorMatchSpikeThreshold != newConfig.selectorMatchSpikeThreshold {
+		optionsChanged = true
+		azurePluginLogger().Info("Account selector match spike threshold updated", "account", accountName)
+	}
+	if existingConfig.peerAddressSpaceFallback != newConfig.peerAddressSpaceFallback {
+		optionsChanged = true
+		azurePluginLogger().Info("Account peer address space fallback updated", "account", accountName)
+	}
+	if !reflect.DeepEqual(existingConfig.egressAllowCIDRs, newConfig.egressAllowCIDRs) {
+		optionsChanged = true
+		azurePluginLogger().Info("Account egress allow CIDRs updated", "account", accountName)
 	}
-	return credsChanged
+	return credsChanged, optionsChanged
 }
 
-// extractSecret extracts credentials from a Kubernetes secret.
-func extractSecret(c client.Client, s *crdv1alpha1.SecretReference) (*crdv1alpha1.AzureAccountCredential, error) {
+// extractSecret extracts credentials from the first valid Kubernetes secret in secretRefs, which starts with the
+// primary secret followed by the fallback secrets. Credentials rejected by the cloud for the account are skipped,
+// unless the credentials of every valid secret were rejected, in which case the rejections are forgotten and the
+// first valid secret is used again.
+func extractSecret(c client.Client, account *types.NamespacedName, secretRefs []*crdv1alpha1.SecretReference) (
+	*crdv1alpha1.AzureAccountCredential, *utils.CredentialFingerprint, error) {
+	if len(secretRefs) == 0 {
+		return &crdv1alpha1.AzureAccountCredential{}, nil, fmt.Errorf("%w, no Secret configured", util.ErrSecretReference)
+	}
+
+	var errs error
+	var firstRejectedCred *crdv1alpha1.AzureAccountCredential
+	var firstRejectedFingerprint *utils.CredentialFingerprint
+	for i, s := range secretRefs {
+		cred, fingerprint, err := extractSecretFromReference(c, s)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		if internal.RejectedCredentials.IsRejected(account, fingerprint) {
+			errs = multierr.Append(errs, fmt.Errorf("credentials rejected by cloud: %v/%v", s.Namespace, s.Name))
+			if firstRejectedCred == nil {
+				firstRejectedCred, firstRejectedFingerprint = cred, fingerprint
+			}
+			continue
+		}
+		if i > 0 {
+			azurePluginLogger().Info("Using fallback Secret credentials", "secret", s.Namespace+"/"+s.Name, "error", errs)
+		}
+		return cred, fingerprint, nil
+	}
+	if firstRejectedCred != nil {
+		azurePluginLogger().Info("Credentials of all Secrets rejected by cloud, retrying from the first one", "account", account)
+		internal.RejectedCredentials.Forget(account)
+		return firstRejectedCred, firstRejectedFingerprint, nil
+	}
+	return &crdv1alpha1.AzureAccountCredential{}, nil, errs
+}
+
+// GetCredentialFingerprint returns the fingerprint of the Secret credentials, nil when they could not be resolved.
+func (c *azureAccountConfig) GetCredentialFingerprint() *utils.CredentialFingerprint {
+	return c.credentialFingerprint
+}
+
+// extractSecretFromReference extracts credentials from a Kubernetes secret, along with the fingerprint of the
+// credentials.
+func extractSecretFromReference(c client.Client, s *crdv1alpha1.SecretReference) (*crdv1alpha1.AzureAccountCredential,
+	*utils.CredentialFingerprint, error) {
 	cred := &crdv1alpha1.AzureAccountCredential{}
 	u := &unstructured.Unstructured{}
 	u.SetGroupVersionKind(schema.GroupVersionKind{
@@ -92,29 +264,33 @@ func extractSecret(c client.Client, s *crdv1alpha1.SecretReference) (*crdv1alpha
 		Version: "v1",
 	})
 	if err := c.Get(context.Background(), client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, u); err != nil {
-		return cred, fmt.Errorf("%v, failed to get Secret object: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, failed to get Secret object: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
 	data, ok := u.Object["data"].(map[string]interface{})
 	if !ok {
-		return cred, fmt.Errorf("%v, failed to get Secret data: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, failed to get Secret data: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 	key, ok := data[s.Key].(string)
 	if !ok {
-		return cred, fmt.Errorf("%v, failed to get Secret key: %v/%v, key: %v", util.ErrorMsgSecretReference, s.Namespace, s.Name, s.Key)
+		return cred, nil, fmt.Errorf("%w, failed to get Secret key: %v/%v, key: %v", util.ErrSecretReference, s.Namespace, s.Name, s.Key)
 	}
 	decode, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
-		return cred, fmt.Errorf("%v, failed to decode Secret key: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, failed to decode Secret key: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
 	if err = json.Unmarshal(decode, cred); err != nil {
-		return cred, fmt.Errorf("%v, failed to unmarshall Secret credentials: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, failed to unmarshall Secret credentials: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
 	if cred.SubscriptionID == "" || cred.TenantID == "" || cred.ClientID == "" || cred.ClientKey == "" {
-		return cred, fmt.Errorf("%v, Secret credentials cannot be empty: %v/%v", util.ErrorMsgSecretReference, s.Namespace, s.Name)
+		return cred, nil, fmt.Errorf("%w, Secret credentials cannot be empty: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
 	}
 
-	return cred, nil
+	fingerprint, err := utils.NewCredentialFingerprint(decode)
+	if err != nil {
+		return cred, nil, fmt.Errorf("%w, failed to fingerprint Secret credentials: %v/%v", util.ErrSecretReference, s.Namespace, s.Name)
+	}
+	return cred, fingerprint, nil
 }
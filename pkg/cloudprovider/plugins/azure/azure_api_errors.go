@@ -0,0 +1,83 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"go.uber.org/multierr"
+
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+)
+
+// apiErrorPolicy is an Azure SDK pipeline policy which counts the failed API calls of an account by error class.
+type apiErrorPolicy struct {
+	account string
+}
+
+func (p *apiErrorPolicy) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	if class, ok := classifyAzureError(resp, err); ok {
+		internal.RecordAPIError(string(providerType), p.account, class)
+	}
+	return resp, err
+}
+
+// classifyAzureError returns the error class of an Azure API call from its response and error, false is returned
+// when the call succeeded.
+func classifyAzureError(resp *http.Response, err error) (internal.APIErrorClass, bool) {
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) {
+		return internal.APIErrorClassAuth, true
+	}
+	if resp != nil {
+		if class, ok := internal.ClassifyHTTPStatus(resp.StatusCode); ok {
+			return class, true
+		}
+	}
+	if err != nil {
+		return internal.APIErrorClassOther, true
+	}
+	return "", false
+}
+
+// isCredentialsRejectedError returns true if err reports that Azure rejected the credentials of the account.
+func isCredentialsRejectedError(err error) bool {
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) {
+		return true
+	}
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusUnauthorized
+}
+
+// isNotFoundError returns true if err, and every error combined into it, is an Azure API error reporting that the
+// resource does not exist.
+func isNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range multierr.Errors(err) {
+		var respErr *azcore.ResponseError
+		if !errors.As(e, &respErr) || respErr.StatusCode != http.StatusNotFound {
+			return false
+		}
+	}
+	return true
+}
@@ -335,3 +335,41 @@ func (mr *MockazureVirtualNetworksWrapperMockRecorder) listAllComplete(ctx inter
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "listAllComplete", reflect.TypeOf((*MockazureVirtualNetworksWrapper)(nil).listAllComplete), ctx)
 }
+
+// MockazurePermissionsWrapper is a mock of azurePermissionsWrapper interface.
+type MockazurePermissionsWrapper struct {
+	ctrl     *gomock.Controller
+	recorder *MockazurePermissionsWrapperMockRecorder
+}
+
+// MockazurePermissionsWrapperMockRecorder is the mock recorder for MockazurePermissionsWrapper.
+type MockazurePermissionsWrapperMockRecorder struct {
+	mock *MockazurePermissionsWrapper
+}
+
+// NewMockazurePermissionsWrapper creates a new mock instance.
+func NewMockazurePermissionsWrapper(ctrl *gomock.Controller) *MockazurePermissionsWrapper {
+	mock := &MockazurePermissionsWrapper{ctrl: ctrl}
+	mock.recorder = &MockazurePermissionsWrapperMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockazurePermissionsWrapper) EXPECT() *MockazurePermissionsWrapperMockRecorder {
+	return m.recorder
+}
+
+// list mocks base method.
+func (m *MockazurePermissionsWrapper) list(ctx context.Context, resourceGroup string) ([]azurePermission, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "list", ctx, resourceGroup)
+	ret0, _ := ret[0].([]azurePermission)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// list indicates an expected call of list.
+func (mr *MockazurePermissionsWrapperMockRecorder) list(ctx, resourceGroup interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "list", reflect.TypeOf((*MockazurePermissionsWrapper)(nil).list), ctx, resourceGroup)
+}
@@ -19,10 +19,15 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	resourcegraph "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"github.com/cenkalti/backoff/v4"
 )
 
 type azureNwIntfWrapper interface {
@@ -38,7 +43,11 @@ func (nwIntf *azureNwIntfWrapperImpl) createOrUpdate(ctx context.Context, resour
 	parameters armnetwork.Interface) (armnetwork.Interface, error) {
 	var nwInterface armnetwork.Interface
 	nwIntfClient := nwIntf.nwIntfAPIClient
-	op, err := nwIntfClient.BeginCreateOrUpdate(ctx, resourceGroupName, networkIntfName, parameters, nil)
+	var op *runtime.Poller[armnetwork.InterfacesClientCreateOrUpdateResponse]
+	err := retryOnThrottle(ctx, func() (err error) {
+		op, err = nwIntfClient.BeginCreateOrUpdate(ctx, resourceGroupName, networkIntfName, parameters, nil)
+		return err
+	})
 	if err != nil {
 		return nwInterface, fmt.Errorf("cannot create %v, reason: %v", networkIntfName, err)
 	}
@@ -55,7 +64,11 @@ func (nwIntf *azureNwIntfWrapperImpl) listAllComplete(ctx context.Context) ([]ar
 	var networkInterfaces []armnetwork.Interface
 	listResultIterator := nwIntf.nwIntfAPIClient.NewListAllPager(nil)
 	for listResultIterator.More() {
-		nextResult, err := listResultIterator.NextPage(ctx)
+		var nextResult armnetwork.InterfacesClientListAllResponse
+		err := retryOnThrottle(ctx, func() (err error) {
+			nextResult, err = listResultIterator.NextPage(ctx)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to iterate list of network interface, reason %v", err)
 		}
@@ -84,7 +97,11 @@ func (sg *azureNsgWrapperImpl) createOrUpdate(ctx context.Context, resourceGroup
 	parameters armnetwork.SecurityGroup) (armnetwork.SecurityGroup, error) {
 	var nsg armnetwork.SecurityGroup
 	nsgClient := sg.nsgAPIClient
-	op, err := nsgClient.BeginCreateOrUpdate(ctx, resourceGroupName, networkSecurityGroupName, parameters, nil)
+	var op *runtime.Poller[armnetwork.SecurityGroupsClientCreateOrUpdateResponse]
+	err := retryOnThrottle(ctx, func() (err error) {
+		op, err = nsgClient.BeginCreateOrUpdate(ctx, resourceGroupName, networkSecurityGroupName, parameters, nil)
+		return err
+	})
 	if err != nil {
 		return nsg, fmt.Errorf("cannot create nsg %v, reason: %v", networkSecurityGroupName, err)
 	}
@@ -100,8 +117,12 @@ func (sg *azureNsgWrapperImpl) createOrUpdate(ctx context.Context, resourceGroup
 func (sg *azureNsgWrapperImpl) get(ctx context.Context, resourceGroupName string, networkSecurityGroupName string,
 	expand string) (result armnetwork.SecurityGroup, err error) {
 	var nsg armnetwork.SecurityGroup
-	res, err := sg.nsgAPIClient.Get(ctx, resourceGroupName, networkSecurityGroupName,
-		&armnetwork.SecurityGroupsClientGetOptions{Expand: nil})
+	var res armnetwork.SecurityGroupsClientGetResponse
+	err = retryOnThrottle(ctx, func() (err error) {
+		res, err = sg.nsgAPIClient.Get(ctx, resourceGroupName, networkSecurityGroupName,
+			&armnetwork.SecurityGroupsClientGetOptions{Expand: nil})
+		return err
+	})
 	if err != nil {
 		return nsg, fmt.Errorf("cannot retrieve nsg %v, reason %v", networkSecurityGroupName, err)
 	}
@@ -112,7 +133,11 @@ func (sg *azureNsgWrapperImpl) get(ctx context.Context, resourceGroupName string
 func (sg *azureNsgWrapperImpl) delete(ctx context.Context, resourceGroupName string, networkSecurityGroupName string) error {
 	var respErr *azcore.ResponseError
 	nsgClient := sg.nsgAPIClient
-	op, err := nsgClient.BeginDelete(ctx, resourceGroupName, networkSecurityGroupName, nil)
+	var op *runtime.Poller[armnetwork.SecurityGroupsClientDeleteResponse]
+	err := retryOnThrottle(ctx, func() (err error) {
+		op, err = nsgClient.BeginDelete(ctx, resourceGroupName, networkSecurityGroupName, nil)
+		return err
+	})
 	if err != nil {
 		if errors.As(err, &respErr) {
 			if respErr.StatusCode != http.StatusNotFound {
@@ -133,7 +158,11 @@ func (sg *azureNsgWrapperImpl) listAllComplete(ctx context.Context) ([]armnetwor
 	var nsgs []armnetwork.SecurityGroup
 	pager := sg.nsgAPIClient.NewListAllPager(nil)
 	for pager.More() {
-		nextResult, err := pager.NextPage(ctx)
+		var nextResult armnetwork.SecurityGroupsClientListAllResponse
+		err := retryOnThrottle(ctx, func() (err error) {
+			nextResult, err = pager.NextPage(ctx)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to iterate list of security groups, reason %v", err)
 		}
@@ -162,7 +191,11 @@ func (asg *azureAsgWrapperImpl) createOrUpdate(ctx context.Context, resourceGrou
 	applicationSecurityGroupName string, parameters armnetwork.ApplicationSecurityGroup) (armnetwork.ApplicationSecurityGroup, error) {
 	var appsg armnetwork.ApplicationSecurityGroup
 	asgClient := asg.asgAPIClient
-	op, err := asgClient.BeginCreateOrUpdate(ctx, resourceGroupName, applicationSecurityGroupName, parameters, nil)
+	var op *runtime.Poller[armnetwork.ApplicationSecurityGroupsClientCreateOrUpdateResponse]
+	err := retryOnThrottle(ctx, func() (err error) {
+		op, err = asgClient.BeginCreateOrUpdate(ctx, resourceGroupName, applicationSecurityGroupName, parameters, nil)
+		return err
+	})
 	if err != nil {
 		return appsg, fmt.Errorf("cannot create asg %v, reason: %v", applicationSecurityGroupName, err)
 	}
@@ -179,7 +212,11 @@ func (asg *azureAsgWrapperImpl) createOrUpdate(ctx context.Context, resourceGrou
 func (asg *azureAsgWrapperImpl) get(ctx context.Context, resourceGroupName string,
 	applicationSecurityGroupName string) (armnetwork.ApplicationSecurityGroup, error) {
 	var appsg armnetwork.ApplicationSecurityGroup
-	res, err := asg.asgAPIClient.Get(ctx, resourceGroupName, applicationSecurityGroupName, nil)
+	var res armnetwork.ApplicationSecurityGroupsClientGetResponse
+	err := retryOnThrottle(ctx, func() (err error) {
+		res, err = asg.asgAPIClient.Get(ctx, resourceGroupName, applicationSecurityGroupName, nil)
+		return err
+	})
 	if err != nil {
 		return appsg, fmt.Errorf("cannot retrieve asg %v, reason %v", applicationSecurityGroupName, err)
 	}
@@ -193,7 +230,11 @@ func (asg *azureAsgWrapperImpl) listComplete(ctx context.Context,
 	var asgs []armnetwork.ApplicationSecurityGroup
 	listResultIterator := asg.asgAPIClient.NewListPager(resourceGroupName, nil)
 	for listResultIterator.More() {
-		nextResult, err := listResultIterator.NextPage(ctx)
+		var nextResult armnetwork.ApplicationSecurityGroupsClientListResponse
+		err := retryOnThrottle(ctx, func() (err error) {
+			nextResult, err = listResultIterator.NextPage(ctx)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to iterate list of asgs for"+
 				"resource-group: %v, reason %v", resourceGroupName, err)
@@ -210,7 +251,11 @@ func (asg *azureAsgWrapperImpl) listAllComplete(ctx context.Context) ([]armnetwo
 	var asgs []armnetwork.ApplicationSecurityGroup
 	listResultIterator := asg.asgAPIClient.NewListAllPager(nil)
 	for listResultIterator.More() {
-		nextResult, err := listResultIterator.NextPage(ctx)
+		var nextResult armnetwork.ApplicationSecurityGroupsClientListAllResponse
+		err := retryOnThrottle(ctx, func() (err error) {
+			nextResult, err = listResultIterator.NextPage(ctx)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to iterate list of asgs, reason %v", err)
 		}
@@ -225,7 +270,11 @@ func (asg *azureAsgWrapperImpl) listAllComplete(ctx context.Context) ([]armnetwo
 func (asg *azureAsgWrapperImpl) delete(ctx context.Context, resourceGroupName string, applicationSecurityGroupName string) error {
 	asgClient := asg.asgAPIClient
 	var respErr *azcore.ResponseError
-	op, err := asgClient.BeginDelete(ctx, resourceGroupName, applicationSecurityGroupName, nil)
+	var op *runtime.Poller[armnetwork.ApplicationSecurityGroupsClientDeleteResponse]
+	err := retryOnThrottle(ctx, func() (err error) {
+		op, err = asgClient.BeginDelete(ctx, resourceGroupName, applicationSecurityGroupName, nil)
+		return err
+	})
 	if err != nil {
 		if errors.As(err, &respErr) {
 			if respErr.StatusCode != http.StatusNotFound {
@@ -252,7 +301,11 @@ type azureResourceGraphWrapperImpl struct {
 
 func (rg *azureResourceGraphWrapperImpl) resources(ctx context.Context,
 	query resourcegraph.QueryRequest) (result resourcegraph.ClientResourcesResponse, err error) {
-	return rg.resourceGraphAPIClient.Resources(ctx, query, nil)
+	err = retryOnThrottle(ctx, func() (err error) {
+		result, err = rg.resourceGraphAPIClient.Resources(ctx, query, nil)
+		return err
+	})
+	return result, err
 }
 
 type azureVirtualNetworksWrapper interface {
@@ -267,9 +320,13 @@ func (vnet *azureVirtualNetworksWrapperImpl) listAllComplete(ctx context.Context
 	var VNListResultIterators []armnetwork.VirtualNetwork
 	pager := vnet.virtualNetworksClient.NewListAllPager(nil)
 	for pager.More() {
-		nextResult, err := pager.NextPage(ctx)
+		var nextResult armnetwork.VirtualNetworksClientListAllResponse
+		err := retryOnThrottle(ctx, func() (err error) {
+			nextResult, err = pager.NextPage(ctx)
+			return err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("error iterating over a list of virtual networks: %v", err)
+			return nil, fmt.Errorf("error iterating over a list of virtual networks: %w", err)
 		}
 		for _, v := range nextResult.Value {
 			VNListResultIterators = append(VNListResultIterators, *v)
@@ -278,3 +335,151 @@ func (vnet *azureVirtualNetworksWrapperImpl) listAllComplete(ctx context.Context
 
 	return VNListResultIterators, nil
 }
+
+// azurePermission is a set of actions granted to the credentials by their role assignments, minus its notActions.
+type azurePermission struct {
+	Actions    []string `json:"actions"`
+	NotActions []string `json:"notActions"`
+}
+
+type azurePermissionsWrapper interface {
+	// list returns the permissions of the credentials on a resource group of the subscription, or on the subscription
+	// when resourceGroup is empty.
+	list(ctx context.Context, resourceGroup string) ([]azurePermission, error)
+}
+
+type azurePermissionsWrapperImpl struct {
+	host           string
+	subscriptionID string
+	pl             runtime.Pipeline
+}
+
+func (p *azurePermissionsWrapperImpl) list(ctx context.Context, resourceGroup string) ([]azurePermission, error) {
+	var permissions []azurePermission
+	scope := "/subscriptions/" + url.PathEscape(p.subscriptionID)
+	if resourceGroup != "" {
+		scope += "/resourceGroups/" + url.PathEscape(resourceGroup)
+	}
+	nextLink := runtime.JoinPaths(p.host, scope+"/providers/Microsoft.Authorization/permissions") +
+		"?api-version=" + permissionsAPIVersion
+	for nextLink != "" {
+		var result struct {
+			Value    []azurePermission `json:"value"`
+			NextLink *string           `json:"nextLink"`
+		}
+		err := retryOnThrottle(ctx, func() error {
+			req, err := runtime.NewRequest(ctx, http.MethodGet, nextLink)
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+			req.Raw().Header["Accept"] = []string{"application/json"}
+			resp, err := p.pl.Do(req)
+			if err != nil {
+				return err
+			}
+			if !runtime.HasStatusCode(resp, http.StatusOK) {
+				return runtime.NewResponseError(resp)
+			}
+			return runtime.UnmarshalAsJSON(resp, &result)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list permissions of %v, reason %v", scope, err)
+		}
+		permissions = append(permissions, result.Value...)
+		nextLink = ""
+		if result.NextLink != nil {
+			nextLink = *result.NextLink
+		}
+	}
+
+	return permissions, nil
+}
+
+const (
+	// throttleRetryMaxElapsedTime bounds the total time spent retrying a throttled call.
+	throttleRetryMaxElapsedTime = 2 * time.Minute
+	// throttleRetryMaxInterval bounds the wait between retries of a throttled call, including the wait requested by
+	// the Retry-After header.
+	throttleRetryMaxInterval = 30 * time.Second
+	retryAfterHeader         = "Retry-After"
+)
+
+// newThrottleRetryTimer returns the timer used to wait between retries of a throttled call. A nil timer means
+// the backoff default timer.
+var newThrottleRetryTimer = func() backoff.Timer {
+	return nil
+}
+
+// retryAfterBackOff is an exponential backoff which, when set, waits for the duration requested by the Retry-After
+// header of the last throttled response instead of the next exponential interval, up to MaxInterval.
+type retryAfterBackOff struct {
+	*backoff.ExponentialBackOff
+	retryAfter time.Duration
+}
+
+func (b *retryAfterBackOff) NextBackOff() time.Duration {
+	next := b.ExponentialBackOff.NextBackOff()
+	if next == backoff.Stop || b.retryAfter <= 0 {
+		return next
+	}
+	next, b.retryAfter = b.retryAfter, 0
+	if next > b.MaxInterval {
+		next = b.MaxInterval
+	}
+	return next
+}
+
+// retryOnThrottle invokes operation and retries it as long as Azure throttles it with 429 responses. The wait between
+// retries honors the Retry-After header of the response, and falls back to exponential backoff when it is absent. It
+// is capped to throttleRetryMaxInterval. Any other error is returned right away.
+func retryOnThrottle(ctx context.Context, operation func() error) error {
+	b := &retryAfterBackOff{ExponentialBackOff: backoff.NewExponentialBackOff()}
+	b.MaxElapsedTime = throttleRetryMaxElapsedTime
+	b.MaxInterval = throttleRetryMaxInterval
+
+	throttledOperation := func() error {
+		err := operation()
+		if err == nil {
+			return nil
+		}
+		retryAfter, throttled := getThrottleRetryAfter(err)
+		if !throttled {
+			return backoff.Permanent(err)
+		}
+		b.retryAfter = retryAfter
+		return err
+	}
+	notify := func(err error, wait time.Duration) {
+		azurePluginLogger().V(1).Info("Azure call throttled, retrying", "wait", wait, "error", err)
+	}
+	return backoff.RetryNotifyWithTimer(throttledOperation, backoff.WithContext(b, ctx), notify, newThrottleRetryTimer())
+}
+
+// getThrottleRetryAfter returns true if err is a throttled response, along with the wait requested by its Retry-After
+// header. Returned wait is zero when the header is absent or invalid.
+func getThrottleRetryAfter(err error) (time.Duration, bool) {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if respErr.RawResponse == nil {
+		return 0, true
+	}
+	retryAfter := respErr.RawResponse.Header.Get(retryAfterHeader)
+	if retryAfter == "" {
+		return 0, true
+	}
+	// Retry-After is either a number of seconds or an HTTP date.
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		if seconds < 0 {
+			return 0, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+	}
+	return 0, true
+}
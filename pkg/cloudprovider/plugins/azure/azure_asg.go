@@ -19,16 +19,18 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
 // applicationSecurityGroups returns application-security-groups apiClient.
 func (p *azureServiceSdkConfigProvider) applicationSecurityGroups(subscriptionID string) (azureAsgWrapper, error) {
-	applicationSecurityGroupsClient, err := armnetwork.NewApplicationSecurityGroupsClient(subscriptionID, p.cred, nil)
+	applicationSecurityGroupsClient, err := armnetwork.NewApplicationSecurityGroupsClient(subscriptionID, p.cred, p.options)
 	if err != nil {
 		return nil, err
 	}
@@ -85,3 +87,130 @@ func getNepheControllerCreatedAsgByNameForResourceGroup(asgAPIClient azureAsgWra
 
 	return agAsgByNepheControllerName, atAsgByNepheControllerName, nil
 }
+
+// getRemoteGroupKey returns the key of a security group in a vnet other than the vnet of the appliedTo group.
+func getRemoteGroupKey(securityGroup *cloudresource.CloudResourceID) string {
+	return strings.ToLower(securityGroup.Vpc + "/" + securityGroup.Name)
+}
+
+// getReferencedSecurityGroups returns the security groups referenced by rules.
+func getReferencedSecurityGroups(rules ...[]*cloudresource.CloudRule) []*cloudresource.CloudResourceID {
+	var referencedSecurityGroups []*cloudresource.CloudResourceID
+	for _, cloudRules := range rules {
+		for _, cloudRule := range cloudRules {
+			var securityGroups []*cloudresource.CloudResourceID
+			switch rule := cloudRule.Rule.(type) {
+			case *cloudresource.IngressRule:
+				if rule != nil {
+					securityGroups = rule.FromSecurityGroups
+				}
+			case *cloudresource.EgressRule:
+				if rule != nil {
+					securityGroups = rule.ToSecurityGroups
+				}
+			}
+			referencedSecurityGroups = append(referencedSecurityGroups, securityGroups...)
+		}
+	}
+	return referencedSecurityGroups
+}
+
+// asgReference is an ASG created on cloud along with the references to it by logical groups.
+type asgReference struct {
+	id string
+	// counts are the number of references to the ASG by each logical group name.
+	counts map[string]int
+}
+
+// asgReferences counts the references to an ASG per logical group, as groups from different selectors may map to the
+// same ASG name in a vnet, including groups whose names only differ in case as ASG names are lowercased. The ASG is
+// created for the first reference and only deleted after the last one is released.
+type asgReferences struct {
+	mutex sync.Mutex
+	refs  map[string]*asgReference
+}
+
+func newAsgReferences() *asgReferences {
+	return &asgReferences{refs: make(map[string]*asgReference)}
+}
+
+func asgReferenceKey(vnetID, cloudAsgName string) string {
+	return strings.ToLower(vnetID + "/" + cloudAsgName)
+}
+
+// get returns the cloud ID of a referenced ASG.
+func (r *asgReferences) get(vnetID, cloudAsgName string) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ref, found := r.refs[asgReferenceKey(vnetID, cloudAsgName)]
+	if !found {
+		return "", false
+	}
+	return ref.id, true
+}
+
+// add records a reference to an ASG by a logical group.
+func (r *asgReferences) add(vnetID, cloudAsgName, name, id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := asgReferenceKey(vnetID, cloudAsgName)
+	ref, found := r.refs[key]
+	if !found {
+		ref = &asgReference{id: id, counts: make(map[string]int)}
+		r.refs[key] = ref
+	}
+	ref.counts[name]++
+}
+
+// release drops a reference to an ASG by a logical group unless it is the last reference to the ASG, which is kept
+// until the ASG is deleted from cloud. Returns true if the ASG is still referenced, by other logical groups or by
+// other references of the same one.
+func (r *asgReferences) release(vnetID, cloudAsgName, name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ref, found := r.refs[asgReferenceKey(vnetID, cloudAsgName)]
+	if !found {
+		return false
+	}
+	total := 0
+	for _, count := range ref.counts {
+		total += count
+	}
+	if ref.counts[name] == 0 {
+		return total > 0
+	}
+	if total <= 1 {
+		return false
+	}
+	if ref.counts[name]--; ref.counts[name] == 0 {
+		delete(ref.counts, name)
+	}
+	return true
+}
+
+// remove forgets an ASG deleted from cloud.
+func (r *asgReferences) remove(vnetID, cloudAsgName string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.refs, asgReferenceKey(vnetID, cloudAsgName))
+}
+
+// removeVnet forgets the ASGs of a vnet deleted from cloud, and returns the number of ASGs forgotten.
+func (r *asgReferences) removeVnet(vnetID string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prefix := strings.ToLower(vnetID) + "/"
+	removed := 0
+	for key := range r.refs {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.refs, key)
+			removed++
+		}
+	}
+	return removed
+}
@@ -31,3 +31,7 @@ func (h *azureCloudCommonHelperImpl) SetAccountCredentialsFunc() internal.CloudC
 func (h *azureCloudCommonHelperImpl) GetCloudCredentialsComparatorFunc() internal.CloudCredentialComparatorFunc {
 	return compareAccountCredentials
 }
+
+func (h *azureCloudCommonHelperImpl) GetCredentialsRejectedFunc() internal.CredentialsRejectedFunc {
+	return isCredentialsRejectedError
+}
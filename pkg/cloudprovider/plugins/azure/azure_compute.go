@@ -17,6 +17,10 @@ package azure
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"net"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,10 +31,22 @@ import (
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
 	nephetypes "antrea.io/nephe/pkg/types"
 )
 
+var (
+	// inventoryConsistencyRetryDelay is the delay between retries of a selector query missing VMs selected by ID.
+	inventoryConsistencyRetryDelay = 2 * time.Second
+	// inventoryConsistencyMaxWait caps the total time an inventory poll retries selector queries missing VMs selected
+	// by ID, which is further capped to half the inventory poll timeout.
+	inventoryConsistencyMaxWait = 30 * time.Second
+	// resourceGraphMaxIDsPerQuery caps the number of IDs a resource graph query is scoped to, more IDs are queried in
+	// batches.
+	resourceGraphMaxIDsPerQuery = 500
+)
+
 type computeServiceConfig struct {
 	accountNamespacedName  types.NamespacedName
 	nwIntfAPIClient        azureNwIntfWrapper
@@ -38,12 +54,35 @@ type computeServiceConfig struct {
 	asgAPIClient           azureAsgWrapper
 	vnetAPIClient          azureVirtualNetworksWrapper
 	resourceGraphAPIClient azureResourceGraphWrapper
+	permissionsAPIClient   azurePermissionsWrapper
 	resourcesCache         *internal.CloudServiceResourcesCache
+	snapshotHistory        *internal.SnapshotHistory
 	inventoryStats         *internal.CloudServiceStats
+	vmTombstones           *internal.VMTombstones
+	selectorHolds          *internal.SelectorHolds
+	asgRefs                *asgReferences
+	realizedRemoteGroups   *realizedRemoteGroups
 	credentials            *azureAccountConfig
 	computeFilters         map[types.NamespacedName][]*string
 	// selectors required for updating resource filters on account config update.
 	selectors map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector
+	// vnetPeersCache keeps the vnet peering map across inventory polls.
+	vnetPeersCache vnetPeersCache
+	// selectorAliases maps selectors identical to another selector to the selector holding their computeFilters.
+	selectorAliases map[types.NamespacedName]types.NamespacedName
+	// settledVMIDs are the lower case IDs of the VMs selected by ID of each selector which were found, or retried for
+	// in vain, since the selector was added. Selector queries are not retried for them anymore.
+	settledVMIDs map[types.NamespacedName]map[string]struct{}
+	// permissionResourceGroups are the lower case resource groups of the vnets and nics of the selected VMs, on which the
+	// permissions of the credentials are probed.
+	permissionResourceGroups []string
+}
+
+// vnetPeersCache is the vnet peering map built by the last inventory poll, along with a hash of the peerings it was
+// built from.
+type vnetPeersCache struct {
+	hash  uint64
+	peers map[string][][]string
 }
 
 type computeResourcesCacheSnapshot struct {
@@ -83,6 +122,12 @@ func newComputeServiceConfig(account types.NamespacedName, service azureServiceC
 		return nil, fmt.Errorf("error creating virtual networks sdk api client for account : %v, err: %v", account, err)
 	}
 
+	// create permissions api client
+	permissionsAPIClient, err := service.permissions(credentials.SubscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating permissions api client for account : %v, err: %v", account, err)
+	}
+
 	config := &computeServiceConfig{
 		accountNamespacedName:  account,
 		nwIntfAPIClient:        nwIntfAPIClient,
@@ -90,13 +135,24 @@ func newComputeServiceConfig(account types.NamespacedName, service azureServiceC
 		asgAPIClient:           applicationSecurityGroupsAPIClient,
 		vnetAPIClient:          vnetAPIClient,
 		resourceGraphAPIClient: resourceGraphAPIClient,
+		permissionsAPIClient:   permissionsAPIClient,
 		resourcesCache:         &internal.CloudServiceResourcesCache{},
+		snapshotHistory:        &internal.SnapshotHistory{},
 		inventoryStats:         &internal.CloudServiceStats{},
+		vmTombstones:           internal.NewVMTombstones(),
+		selectorHolds:          internal.NewSelectorHolds(),
+		asgRefs:                newAsgReferences(),
+		realizedRemoteGroups:   newRealizedRemoteGroups(),
 		credentials:            credentials,
 		computeFilters:         make(map[types.NamespacedName][]*string),
 		selectors:              make(map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector),
+		selectorAliases:        make(map[types.NamespacedName]types.NamespacedName),
+		settledVMIDs:           make(map[types.NamespacedName]map[string]struct{}),
 	}
 
+	config.vmTombstones.SetPolls(credentials.inventoryTombstonePolls)
+	config.selectorHolds.SetThreshold(credentials.selectorMatchSpikeThreshold)
+
 	vmSnapshot := make(map[types.NamespacedName][]*virtualMachineTable)
 	config.resourcesCache.UpdateSnapshot(&computeResourcesCacheSnapshot{vmSnapshot, nil, nil, nil})
 	return config, nil
@@ -207,18 +263,125 @@ func (computeCfg *computeServiceConfig) getVnetPeers(vnetID string) [][]string {
 	return vnetPeersCopy
 }
 
+// getVnetPeerAddressPrefixes returns the remote address space of each vnet peered with vnetID, keyed by the remote
+// vnet ID. The remote address space is reported by the peering itself, hence it is available for global and
+// cross-account peerings as well, where the remote vnet is not managed by this account. Remote vnets of peerings
+// without address space have no prefixes.
+func (computeCfg *computeServiceConfig) getVnetPeerAddressPrefixes(vnetID string) map[string][]*net.IPNet {
+	vnet, found := computeCfg.getCachedVnetsMap()[strings.ToLower(vnetID)]
+	if !found || vnet.Properties == nil {
+		return nil
+	}
+
+	peerAddressPrefixes := make(map[string][]*net.IPNet)
+	for _, peerConn := range vnet.Properties.VirtualNetworkPeerings {
+		peerProperties := peerConn.Properties
+		if peerProperties == nil || peerProperties.RemoteVirtualNetwork == nil ||
+			peerProperties.RemoteVirtualNetwork.ID == nil {
+			continue
+		}
+		peerID := strings.ToLower(*peerProperties.RemoteVirtualNetwork.ID)
+		prefixes := peerAddressPrefixes[peerID]
+		if peerProperties.RemoteAddressSpace != nil {
+			for _, prefix := range peerProperties.RemoteAddressSpace.AddressPrefixes {
+				if prefix == nil {
+					continue
+				}
+				_, cidr, err := net.ParseCIDR(*prefix)
+				if err != nil {
+					azurePluginLogger().Error(err, "invalid remote address prefix of vnet peering",
+						"vnet", vnetID, "peer", peerID)
+					continue
+				}
+				prefixes = append(prefixes, cidr)
+			}
+		}
+		peerAddressPrefixes[peerID] = prefixes
+	}
+	return peerAddressPrefixes
+}
+
+// getVnetPeerings returns the peerings of the cached vnets.
+func (computeCfg *computeServiceConfig) getVnetPeerings() []nephetypes.VpcPeering {
+	snapshot, ok := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return nil
+	}
+	return buildVnetPeerings(snapshot.vnets)
+}
+
+// getUnresolvedVnetPeers returns the IDs of vnets peered with the cached vnets, which could not be resolved.
+func (computeCfg *computeServiceConfig) getUnresolvedVnetPeers() []string {
+	snapshot, ok := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return nil
+	}
+	return findUnresolvedVnetPeers(snapshot.vnets, computeCfg.credentials.peerAddressSpaceFallback)
+}
+
+// findUnresolvedVnetPeers returns the sorted IDs of remote vnets of peerings, which are not visible to the account, and
+// of which the address space reported in the peering is not used, i.e. peerAddressSpaceFallback is off or no address
+// space is reported. Rules referencing such vnets silently miss their CIDRs.
+func findUnresolvedVnetPeers(vnets []armnetwork.VirtualNetwork, peerAddressSpaceFallback bool) []string {
+	vnetIDs := make(map[string]struct{}, len(vnets))
+	for _, vnet := range vnets {
+		if vnet.ID != nil {
+			vnetIDs[strings.ToLower(*vnet.ID)] = struct{}{}
+		}
+	}
+
+	unresolved := make(map[string]struct{})
+	for _, vnet := range vnets {
+		if vnet.Properties == nil {
+			continue
+		}
+		for _, peerConn := range vnet.Properties.VirtualNetworkPeerings {
+			peerProperties := peerConn.Properties
+			if peerProperties == nil || peerProperties.RemoteVirtualNetwork == nil ||
+				peerProperties.RemoteVirtualNetwork.ID == nil {
+				continue
+			}
+			peerID := strings.ToLower(*peerProperties.RemoteVirtualNetwork.ID)
+			if _, found := vnetIDs[peerID]; found {
+				continue
+			}
+			if peerAddressSpaceFallback && peerProperties.RemoteAddressSpace != nil &&
+				len(peerProperties.RemoteAddressSpace.AddressPrefixes) > 0 {
+				continue
+			}
+			unresolved[peerID] = struct{}{}
+		}
+	}
+
+	peerIDs := make([]string, 0, len(unresolved))
+	for peerID := range unresolved {
+		peerIDs = append(peerIDs, peerID)
+	}
+	sort.Strings(peerIDs)
+	return peerIDs
+}
+
 // getVirtualMachines gets virtual machines from cloud matching the given selector configuration.
-func (computeCfg *computeServiceConfig) getVirtualMachines(namespacedName *types.NamespacedName) ([]*virtualMachineTable, error) {
+func (computeCfg *computeServiceConfig) getVirtualMachines(ctx context.Context,
+	namespacedName *types.NamespacedName) ([]*virtualMachineTable, error) {
 	filters, found := computeCfg.computeFilters[*namespacedName]
 	if found && len(filters) != 0 {
 		azurePluginLogger().V(1).Info("Fetching vm resources from cloud",
 			"account", computeCfg.accountNamespacedName, "selector", namespacedName, "resource-filters", "configured")
 	}
+	return computeCfg.getVirtualMachinesByFilters(ctx, namespacedName, filters)
+}
+
+// getVirtualMachinesByFilters gets virtual machines from cloud matching the given query filters of a selector. Their
+// extensions and management locks are set afterwards for the VMs of all selectors, see setVirtualMachineDetails.
+func (computeCfg *computeServiceConfig) getVirtualMachinesByFilters(ctx context.Context,
+	namespacedName *types.NamespacedName, filters []*string) ([]*virtualMachineTable, error) {
 	var subscriptions []*string
 	subscriptions = append(subscriptions, &computeCfg.credentials.SubscriptionID)
 	var virtualMachines []*virtualMachineTable
 	for _, filter := range filters {
-		virtualMachineRows, _, err := getVirtualMachineTable(computeCfg.resourceGraphAPIClient, filter, subscriptions)
+		virtualMachineRows, _, err := getVirtualMachineTable(ctx, computeCfg.resourceGraphAPIClient,
+			computeCfg.credentials.getCredentialIdentity(), filter, subscriptions)
 		if err != nil {
 			azurePluginLogger().Error(err, "failed to fetch cloud resources",
 				"account", computeCfg.accountNamespacedName, "selector", namespacedName)
@@ -232,59 +395,586 @@ func (computeCfg *computeServiceConfig) getVirtualMachines(namespacedName *types
 	return virtualMachines, nil
 }
 
-func (computeCfg *computeServiceConfig) DoResourceInventory() error {
-	vnets, err := computeCfg.getVpcs()
+// setVirtualMachineDetails sets the extensions and the management lock status of the VMs of all selectors, querying
+// each of them once for all VMs, and drops the VMs not satisfying the extension match of their selector.
+func (computeCfg *computeServiceConfig) setVirtualMachineDetails(ctx context.Context,
+	allVirtualMachines map[types.NamespacedName][]*virtualMachineTable) error {
+	var virtualMachines []*virtualMachineTable
+	for _, vms := range allVirtualMachines {
+		virtualMachines = append(virtualMachines, vms...)
+	}
+	if err := computeCfg.setVirtualMachineExtensions(ctx, virtualMachines); err != nil {
+		return fmt.Errorf("failed to fetch vm extensions: %w", err)
+	}
+	if err := computeCfg.setVirtualMachineLocks(ctx, virtualMachines); err != nil {
+		return fmt.Errorf("failed to fetch management locks: %w", err)
+	}
+	for namespacedName, vms := range allVirtualMachines {
+		matchedVirtualMachines := make([]*virtualMachineTable, 0, len(vms))
+		for _, vm := range vms {
+			if matchesExtension(vm) {
+				matchedVirtualMachines = append(matchedVirtualMachines, vm)
+			}
+		}
+		allVirtualMachines[namespacedName] = matchedVirtualMachines
+	}
+	return nil
+}
+
+// setVirtualMachineExtensions sets the extensions of the given virtual machines. Extensions are fetched with a separate
+// query scoped to the VMs, since joining them into the VM query counts against the join limit of Azure Resource Graph.
+func (computeCfg *computeServiceConfig) setVirtualMachineExtensions(ctx context.Context,
+	virtualMachines []*virtualMachineTable) error {
+	extensionMatched := false
+	for _, vm := range virtualMachines {
+		if !emptyString(vm.ExtensionMatchName) {
+			extensionMatched = true
+			break
+		}
+	}
+	if len(virtualMachines) == 0 ||
+		(!extensionMatched && !isInventoryFieldSelected(computeCfg.credentials.inventoryFields, "extensions")) {
+		return nil
+	}
+	var vmIDs []string
+	for _, vm := range virtualMachines {
+		if !emptyString(vm.ID) {
+			vmIDs = append(vmIDs, strings.ToLower(*vm.ID))
+		}
+	}
+	extensionsByVM := make(map[string][]*string, len(vmIDs))
+	for _, batch := range splitIntoBatches(uniqueStrings(vmIDs), resourceGraphMaxIDsPerQuery) {
+		query, err := getVMExtensionsByVMIDsQuery([]string{computeCfg.credentials.SubscriptionID}, batch)
+		if err != nil {
+			return err
+		}
+		vmExtensions, err := getVMExtensionTable(ctx, computeCfg.resourceGraphAPIClient,
+			computeCfg.credentials.getCredentialIdentity(), query, []*string{&computeCfg.credentials.SubscriptionID})
+		if err != nil {
+			return err
+		}
+		for _, vmExtension := range vmExtensions {
+			if !emptyString(vmExtension.VMID) {
+				extensionsByVM[strings.ToLower(*vmExtension.VMID)] = vmExtension.Extensions
+			}
+		}
+	}
+	for _, vm := range virtualMachines {
+		if !emptyString(vm.ID) {
+			vm.Extensions = extensionsByVM[strings.ToLower(*vm.ID)]
+		}
+	}
+	return nil
+}
+
+// setVirtualMachineLocks sets the management lock status of the given virtual machines. Locks are resolved when the
+// locked inventory field is selected, or when any VM is matched by a selector excluding locked VMs. Locks are fetched
+// with a separate query scoped to the lock scopes of the VMs, since joining them into the VM query counts against the
+// join limit of Azure Resource Graph.
+func (computeCfg *computeServiceConfig) setVirtualMachineLocks(ctx context.Context,
+	virtualMachines []*virtualMachineTable) error {
+	excludeLocked := false
+	for _, vm := range virtualMachines {
+		if vm.ExcludeLocked != nil && *vm.ExcludeLocked {
+			excludeLocked = true
+			break
+		}
+	}
+	if len(virtualMachines) == 0 ||
+		(!excludeLocked && !isInventoryFieldSelected(computeCfg.credentials.inventoryFields, "locked")) {
+		return nil
+	}
+	var scopes []string
+	for _, vm := range virtualMachines {
+		scopes = append(scopes, getVirtualMachineLockScopes(vm)...)
+	}
+	lockScopes := make(map[string]struct{})
+	for _, batch := range splitIntoBatches(uniqueStrings(scopes), resourceGraphMaxIDsPerQuery) {
+		query, err := getManagementLocksByScopesQuery([]string{computeCfg.credentials.SubscriptionID}, batch)
+		if err != nil {
+			return err
+		}
+		locks, err := getManagementLockTable(ctx, computeCfg.resourceGraphAPIClient,
+			computeCfg.credentials.getCredentialIdentity(), query, []*string{&computeCfg.credentials.SubscriptionID})
+		if err != nil {
+			return err
+		}
+		for _, lock := range locks {
+			if !emptyString(lock.Scope) {
+				lockScopes[strings.ToLower(*lock.Scope)] = struct{}{}
+			}
+		}
+	}
+	for _, vm := range virtualMachines {
+		locked := isVirtualMachineLocked(vm, lockScopes)
+		vm.Locked = &locked
+	}
+	return nil
+}
+
+// getInventoryConsistencyDeadline returns the time until which an inventory poll starting now may retry selector
+// queries missing VMs selected by ID.
+func getInventoryConsistencyDeadline() time.Time {
+	maxWait := inventoryConsistencyMaxWait
+	if timeout := cloudresource.InventoryPollTimeout; timeout > 0 && timeout/2 < maxWait {
+		maxWait = timeout / 2
+	}
+	return time.Now().Add(maxWait)
+}
+
+// getVirtualMachinesWithConsistencyRetries gets virtual machines matching the given selector configuration, retrying
+// the query up to the configured inventory consistency retries while VMs selected by ID are absent from the results.
+// Azure Resource Graph is eventually consistent, so newly created VMs may be missing for a while. Only VMs not found
+// since the selector was added are waited for, and not beyond deadline. VMs still missing after the retries are logged
+// and the last results are returned; they are not waited for by later polls.
+func (computeCfg *computeServiceConfig) getVirtualMachinesWithConsistencyRetries(ctx context.Context,
+	namespacedName *types.NamespacedName, deadline time.Time) ([]*virtualMachineTable, error) {
+	retries := computeCfg.credentials.inventoryConsistencyRetries
+	expectedIDs := getExpectedVirtualMachineIDs(computeCfg.selectors[*namespacedName])
+	settledIDs := computeCfg.settledVMIDs[*namespacedName]
+	if settledIDs == nil {
+		settledIDs = make(map[string]struct{})
+		computeCfg.settledVMIDs[*namespacedName] = settledIDs
+	}
+	for id := range settledIDs {
+		delete(expectedIDs, id)
+	}
+	if retries == 0 || len(expectedIDs) == 0 {
+		return computeCfg.getVirtualMachines(ctx, namespacedName)
+	}
+
+	var virtualMachines []*virtualMachineTable
+	var missingIDs []string
+	operation := func() error {
+		var err error
+		virtualMachines, err = computeCfg.getVirtualMachines(ctx, namespacedName)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		missingIDs = findMissingVirtualMachineIDs(expectedIDs, virtualMachines)
+		if len(missingIDs) == 0 {
+			return nil
+		}
+		err = fmt.Errorf("virtual machines %v not found", missingIDs)
+		if time.Now().Add(inventoryConsistencyRetryDelay).After(deadline) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+	b := backoff.WithMaxRetries(backoff.NewConstantBackOff(inventoryConsistencyRetryDelay), uint64(retries))
+	if err := backoff.Retry(operation, backoff.WithContext(b, ctx)); err != nil && len(missingIDs) == 0 {
+		return nil, err
+	}
+	for id := range expectedIDs {
+		settledIDs[id] = struct{}{}
+	}
+	if len(missingIDs) != 0 {
+		azurePluginLogger().Info("Virtual machines selected by ID not found after retries", "account",
+			computeCfg.accountNamespacedName, "selector", namespacedName, "retries", retries, "vms", missingIDs)
+	}
+	return virtualMachines, nil
+}
+
+// getExpectedVirtualMachineIDs returns the lower case IDs of the VMs selected by vmMatch matchID in the selector.
+func getExpectedVirtualMachineIDs(selector *crdv1alpha1.CloudEntitySelector) map[string]struct{} {
+	expectedIDs := make(map[string]struct{})
+	if selector == nil {
+		return expectedIDs
+	}
+	for _, vmSelector := range selector.Spec.VMSelector {
+		for _, vmMatch := range vmSelector.VMMatch {
+			if vmMatch.MatchID != "" {
+				expectedIDs[strings.ToLower(vmMatch.MatchID)] = struct{}{}
+			}
+		}
+	}
+	return expectedIDs
+}
+
+// findMissingVirtualMachineIDs returns the sorted expected IDs absent from the virtual machines.
+func findMissingVirtualMachineIDs(expectedIDs map[string]struct{}, virtualMachines []*virtualMachineTable) []string {
+	found := make(map[string]struct{}, len(virtualMachines))
+	for _, vm := range virtualMachines {
+		found[strings.ToLower(*vm.ID)] = struct{}{}
+	}
+	var missingIDs []string
+	for id := range expectedIDs {
+		if _, ok := found[id]; !ok {
+			missingIDs = append(missingIDs, id)
+		}
+	}
+	sort.Strings(missingIDs)
+	return missingIDs
+}
+
+func (computeCfg *computeServiceConfig) DoResourceInventory(ctx context.Context) error {
+	vnets, err := computeCfg.getVpcs(ctx)
 	if err != nil {
 		azurePluginLogger().Error(err, "failed to fetch cloud resources", "account", computeCfg.accountNamespacedName)
 		return err
 	}
 	azurePluginLogger().V(1).Info("Vpcs from cloud", "account", computeCfg.accountNamespacedName,
 		"vpcs", len(vnets))
-	vnetPeers := computeCfg.buildMapVpcPeers(vnets)
+	computeCfg.cleanupDeletedVnets(vnets)
+	vnetPeers := computeCfg.getMapVpcPeers(vnets)
+	internal.UnresolvedVpcPeersGauge.WithLabelValues(computeCfg.accountNamespacedName.String(), string(providerType)).
+		Set(float64(len(findUnresolvedVnetPeers(vnets, computeCfg.credentials.peerAddressSpaceFallback))))
 	allVirtualMachines := make(map[types.NamespacedName][]*virtualMachineTable)
 
 	// Make cloud API calls for fetching vm inventory for each configured CES.
 	if len(computeCfg.selectors) == 0 {
-		computeCfg.resourcesCache.UpdateSnapshot(&computeResourcesCacheSnapshot{allVirtualMachines, vnets, nil, vnetPeers})
+		computeCfg.updateSnapshot(&computeResourcesCacheSnapshot{allVirtualMachines, vnets, nil, vnetPeers})
+		computeCfg.permissionResourceGroups = nil
 		azurePluginLogger().V(1).Info("Fetching vm resources from cloud skipped",
 			"account", computeCfg.accountNamespacedName, "resource-filters", "not-configured")
 		return nil
 	}
 
-	managedVnetIDs := make(map[string]struct{})
+	consistencyDeadline := getInventoryConsistencyDeadline()
 	for namespacedName := range computeCfg.selectors {
-		virtualMachines, err := computeCfg.getVirtualMachines(&namespacedName)
+		if _, isAlias := computeCfg.selectorAliases[namespacedName]; isAlias {
+			continue
+		}
+		virtualMachines, err := computeCfg.getVirtualMachinesWithConsistencyRetries(ctx, &namespacedName,
+			consistencyDeadline)
 		if err != nil {
 			azurePluginLogger().Error(err, "failed to fetch cloud resources", "account", computeCfg.accountNamespacedName)
 			return err
 		}
+		allVirtualMachines[namespacedName] = virtualMachines
+	}
+	if err := computeCfg.setVirtualMachineDetails(ctx, allVirtualMachines); err != nil {
+		azurePluginLogger().Error(err, "failed to fetch cloud resources", "account", computeCfg.accountNamespacedName)
+		return err
+	}
+	for namespacedName, virtualMachines := range allVirtualMachines {
+		allVirtualMachines[namespacedName] = internal.RetainTombstonedVMs(computeCfg.vmTombstones, namespacedName,
+			computeCfg.getCachedVirtualMachines(&namespacedName), virtualMachines, func(vm *virtualMachineTable) string {
+				return strings.ToLower(*vm.ID)
+			})
+	}
+	for alias, primary := range computeCfg.selectorAliases {
+		allVirtualMachines[alias] = allVirtualMachines[primary]
+	}
+	allVirtualMachines = computeCfg.holdSpikedSelectors(allVirtualMachines)
+	allVirtualMachines = computeCfg.capVirtualMachines(allVirtualMachines)
+
+	managedVnetIDs := make(map[string]struct{})
+	// security groups are programmed in the resource groups of the vnets, and attached to the nics of the VMs, which
+	// may be in other resource groups.
+	permissionResourceIDs := make(map[string]struct{})
+	for _, virtualMachines := range allVirtualMachines {
 		for _, vm := range virtualMachines {
 			managedVnetIDs[*vm.VnetID] = struct{}{}
+			permissionResourceIDs[*vm.VnetID] = struct{}{}
+			for _, nic := range vm.NetworkInterfaces {
+				if nic.ID != nil {
+					permissionResourceIDs[*nic.ID] = struct{}{}
+				}
+			}
+		}
+	}
+	computeCfg.updateSnapshot(&computeResourcesCacheSnapshot{allVirtualMachines, vnets, managedVnetIDs, vnetPeers})
+	computeCfg.permissionResourceGroups = getPermissionResourceGroups(permissionResourceIDs)
+	return nil
+}
+
+// holdSpikedSelectors keeps the previous VMs of selectors whose number of VMs grew beyond the selector match spike
+// threshold of the account, so that their newly matched VMs are not enforced until confirmed.
+func (computeCfg *computeServiceConfig) holdSpikedSelectors(
+	allVirtualMachines map[types.NamespacedName][]*virtualMachineTable) map[types.NamespacedName][]*virtualMachineTable {
+	var previous map[types.NamespacedName][]*virtualMachineTable
+	if snapshot, ok := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot); ok && snapshot != nil {
+		previous = snapshot.vms
+	}
+	allVirtualMachines, holds := internal.HoldSpikedSelectors(computeCfg.selectorHolds, computeCfg.selectors, previous,
+		allVirtualMachines, func(vm *virtualMachineTable) string {
+			return strings.ToLower(*vm.ID)
+		})
+	for _, hold := range holds {
+		azurePluginLogger().Info("Selector VM count spiked, holding its inventory until confirmed",
+			"account", computeCfg.accountNamespacedName, "selector", hold.Selector, "previousVMs", hold.PreviousVMs,
+			"vms", hold.VMs, "threshold", computeCfg.credentials.selectorMatchSpikeThreshold,
+			"annotation", crdv1alpha1.SelectorAnnotationConfirmVMCount)
+	}
+	return allVirtualMachines
+}
+
+// capVirtualMachines evicts VMs beyond the inventory limit of the account, VMs not attached to Nephe created NSGs
+// first.
+func (computeCfg *computeServiceConfig) capVirtualMachines(
+	allVirtualMachines map[types.NamespacedName][]*virtualMachineTable) map[types.NamespacedName][]*virtualMachineTable {
+	maxVMs := computeCfg.credentials.maxInventoryVMs
+	allVirtualMachines, evicted := internal.CapVMs(allVirtualMachines, maxVMs, func(vm *virtualMachineTable) string {
+		return strings.ToLower(*vm.ID)
+	}, isNepheManagedVirtualMachine)
+	internal.EvictedInventoryVMsGauge.WithLabelValues(computeCfg.accountNamespacedName.String(), string(providerType)).
+		Set(float64(evicted))
+	if evicted > 0 {
+		azurePluginLogger().Info("Inventory VM limit exceeded, evicted VMs from inventory",
+			"account", computeCfg.accountNamespacedName, "limit", maxVMs, "evicted", evicted)
+	}
+	return allVirtualMachines
+}
+
+// isNepheManagedVirtualMachine returns true if any network interface of vm is attached to a Nephe created NSG.
+func isNepheManagedVirtualMachine(vm *virtualMachineTable) bool {
+	nsgPrefix := strings.ToLower(getPerVnetDefaultNsgName(""))
+	for _, nic := range vm.NetworkInterfaces {
+		for _, nsgID := range nic.NsgIDs {
+			if nsgID == nil {
+				continue
+			}
+			nsgName := (*nsgID)[strings.LastIndex(*nsgID, "/")+1:]
+			if strings.HasPrefix(strings.ToLower(nsgName), nsgPrefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cleanupDeletedVnets drops the ASG references and security group metrics of vnets in the current snapshot which are
+// no longer in vnets. The logical groups of a deleted vnet are recreated or removed by the controller, which is
+// notified of the deleted vnet once the inventory poll completes; without references, a recreated group looks up its
+// ASG on cloud again, and a removed group deletes its ASG even if other removed groups shared it.
+func (computeCfg *computeServiceConfig) cleanupDeletedVnets(vnets []armnetwork.VirtualNetwork) {
+	snapshot, ok := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return
+	}
+	vnetIDs := make(map[string]struct{}, len(vnets))
+	for _, vnet := range vnets {
+		if vnet.ID != nil {
+			vnetIDs[strings.ToLower(*vnet.ID)] = struct{}{}
+		}
+	}
+	for _, vnet := range snapshot.vnets {
+		if vnet.ID == nil {
+			continue
+		}
+		vnetID := strings.ToLower(*vnet.ID)
+		if _, found := vnetIDs[vnetID]; found {
+			continue
+		}
+		asgs := computeCfg.asgRefs.removeVnet(vnetID)
+		internal.SecurityMetrics.DeleteVpc(string(providerType), computeCfg.accountNamespacedName.String(), vnetID)
+		azurePluginLogger().Info("Cleaned up security groups of deleted vnet", "account", computeCfg.accountNamespacedName,
+			"vnetID", vnetID, "asgs", asgs)
+	}
+}
+
+// updateSnapshot updates the snapshot of the service cache and records it in the snapshot history.
+func (computeCfg *computeServiceConfig) updateSnapshot(snapshot *computeResourcesCacheSnapshot) {
+	footprint := snapshot.footprint()
+	computeCfg.resourcesCache.UpdateSnapshot(snapshot)
+	computeCfg.snapshotHistory.Add(snapshot, footprint.Bytes)
+	footprint.HistorySnapshots, footprint.HistoryBytes = computeCfg.snapshotHistory.Footprint(snapshot)
+	internal.RecordSnapshotFootprint(string(providerType), computeCfg.accountNamespacedName.String(), footprint)
+}
+
+// GetSnapshotFootprint returns the approximate memory footprint of the snapshot of the service cache and of the
+// previous snapshots kept in the snapshot history.
+func (computeCfg *computeServiceConfig) GetSnapshotFootprint() *nephetypes.SnapshotFootprint {
+	footprint := &nephetypes.SnapshotFootprint{}
+	snapshot, ok := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+	if ok && snapshot != nil {
+		*footprint = snapshot.footprint()
+	}
+	footprint.HistorySnapshots, footprint.HistoryBytes = computeCfg.snapshotHistory.Footprint(snapshot)
+	return footprint
+}
+
+// footprint counts the resources of the snapshot and estimates the memory they hold, including their properties.
+// VMs selected by several selectors are counted once per selector, as each selector holds its own copy.
+func (snapshot *computeResourcesCacheSnapshot) footprint() nephetypes.SnapshotFootprint {
+	footprint := nephetypes.SnapshotFootprint{Vpcs: len(snapshot.vnets), Bytes: internal.EstimateSize(snapshot)}
+	for _, vms := range snapshot.vms {
+		footprint.VMs += len(vms)
+	}
+	for _, peers := range snapshot.vnetPeers {
+		footprint.VpcPeers += len(peers)
+	}
+	return footprint
+}
+
+// RefreshVpcResourceInventory re-queries the vms of a vnet for each configured CES and merges them into the snapshot,
+// tombstoning and capping vms as DoResourceInventory does.
+func (computeCfg *computeServiceConfig) RefreshVpcResourceInventory(ctx context.Context, vpcID string) error {
+	snapshot, ok := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return fmt.Errorf("inventory of account %v is not initialized", computeCfg.accountNamespacedName)
+	}
+	vnetID := strings.ToLower(vpcID)
+	vnetPredicate := fmt.Sprintf("| where vnetId == %v", quoteKqlString(vnetID))
+
+	allVirtualMachines := make(map[types.NamespacedName][]*virtualMachineTable)
+	vnetVirtualMachines := make(map[types.NamespacedName][]*virtualMachineTable)
+	for namespacedName := range computeCfg.selectors {
+		if _, isAlias := computeCfg.selectorAliases[namespacedName]; isAlias {
+			continue
+		}
+		if computeCfg.selectorHolds.IsHeld(namespacedName) {
+			// the inventory of a held selector is only updated by full polls.
+			allVirtualMachines[namespacedName] = snapshot.vms[namespacedName]
+			continue
+		}
+		var filters []*string
+		for _, filter := range computeCfg.computeFilters[namespacedName] {
+			if filter == nil {
+				continue
+			}
+			vnetFilter := *filter + vnetPredicate
+			filters = append(filters, &vnetFilter)
+		}
+		virtualMachines, err := computeCfg.getVirtualMachinesByFilters(ctx, &namespacedName, filters)
+		if err != nil {
+			azurePluginLogger().Error(err, "failed to refresh cloud resources", "account", computeCfg.accountNamespacedName,
+				"vnetID", vpcID)
+			return err
+		}
+		vnetVirtualMachines[namespacedName] = virtualMachines
+	}
+	if err := computeCfg.setVirtualMachineDetails(ctx, vnetVirtualMachines); err != nil {
+		azurePluginLogger().Error(err, "failed to refresh cloud resources", "account", computeCfg.accountNamespacedName,
+			"vnetID", vpcID)
+		return err
+	}
+	for namespacedName, virtualMachines := range vnetVirtualMachines {
+		allVirtualMachines[namespacedName] = internal.MergeVpcVMs(computeCfg.vmTombstones, namespacedName,
+			snapshot.vms[namespacedName], virtualMachines, func(vm *virtualMachineTable) bool {
+				return vm.VnetID != nil && strings.EqualFold(*vm.VnetID, vnetID)
+			}, func(vm *virtualMachineTable) string {
+				return strings.ToLower(*vm.ID)
+			})
+	}
+	for alias, primary := range computeCfg.selectorAliases {
+		allVirtualMachines[alias] = allVirtualMachines[primary]
+	}
+	allVirtualMachines = computeCfg.capVirtualMachines(allVirtualMachines)
+
+	managedVnetIDs := make(map[string]struct{})
+	permissionResourceIDs := make(map[string]struct{})
+	for _, virtualMachines := range allVirtualMachines {
+		for _, vm := range virtualMachines {
+			managedVnetIDs[*vm.VnetID] = struct{}{}
+			permissionResourceIDs[*vm.VnetID] = struct{}{}
+			for _, nic := range vm.NetworkInterfaces {
+				if nic.ID != nil {
+					permissionResourceIDs[*nic.ID] = struct{}{}
+				}
+			}
 		}
-		allVirtualMachines[namespacedName] = virtualMachines
 	}
-	computeCfg.resourcesCache.UpdateSnapshot(&computeResourcesCacheSnapshot{allVirtualMachines, vnets, managedVnetIDs, vnetPeers})
+	computeCfg.updateSnapshot(&computeResourcesCacheSnapshot{allVirtualMachines, snapshot.vnets,
+		managedVnetIDs, snapshot.vnetPeers})
+	computeCfg.permissionResourceGroups = getPermissionResourceGroups(permissionResourceIDs)
 	return nil
 }
 
 func (computeCfg *computeServiceConfig) AddResourceFilters(selector *crdv1alpha1.CloudEntitySelector) error {
-	subscriptionIDs := []string{computeCfg.credentials.SubscriptionID}
-	tenantIDs := []string{computeCfg.credentials.TenantID}
-	locations := []string{computeCfg.credentials.region}
 	namespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
-	if filters, ok := convertSelectorToComputeQuery(selector, subscriptionIDs, tenantIDs, locations); ok {
+	if filters, ok := computeCfg.convertSelectorToComputeQuery(selector); ok {
 		computeCfg.computeFilters[namespacedName] = filters
 		computeCfg.selectors[namespacedName] = selector.DeepCopy()
+		delete(computeCfg.settledVMIDs, namespacedName)
 	} else {
 		return fmt.Errorf("error creating resource query filters")
 	}
+	computeCfg.coalesceSelectors()
+	if primary, isAlias := computeCfg.selectorAliases[namespacedName]; isAlias {
+		azurePluginLogger().Info("Selector is identical to another selector of the account, sharing its resource filters",
+			"account", computeCfg.accountNamespacedName, "selector", namespacedName, "identicalSelector", primary)
+	}
 
 	return nil
 }
 
+// convertSelectorToComputeQuery converts selector to resource graph queries of the account.
+func (computeCfg *computeServiceConfig) convertSelectorToComputeQuery(
+	selector *crdv1alpha1.CloudEntitySelector) ([]*string, bool) {
+	subscriptionIDs := []string{computeCfg.credentials.SubscriptionID}
+	tenantIDs := []string{computeCfg.credentials.TenantID}
+	locations := []string{computeCfg.credentials.region}
+	return convertSelectorToComputeQuery(selector, computeCfg.credentials.inventoryFields, subscriptionIDs, tenantIDs,
+		locations)
+}
+
+// coalesceSelectors keeps the computeFilters of a single selector among identical selectors.
+func (computeCfg *computeServiceConfig) coalesceSelectors() {
+	computeCfg.selectorAliases = internal.CoalesceSelectorFilters(computeCfg.selectors, computeCfg.computeFilters,
+		computeCfg.convertSelectorToComputeQuery)
+}
+
+// PreviewResourceFilters fetches virtual machines matching the selector from cloud and converts them to internal
+// runtimev1alpha1.VirtualMachine format, without configuring the selector filters.
+func (computeCfg *computeServiceConfig) PreviewResourceFilters(
+	selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error) {
+	namespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+	filters, ok := computeCfg.convertSelectorToComputeQuery(selector)
+	if !ok {
+		return nil, fmt.Errorf("error creating resource query filters")
+	}
+
+	virtualMachines, err := computeCfg.getVirtualMachinesByFilters(context.Background(), &namespacedName, filters)
+	if err != nil {
+		return nil, err
+	}
+	previewVirtualMachines := map[types.NamespacedName][]*virtualMachineTable{namespacedName: virtualMachines}
+	if err := computeCfg.setVirtualMachineDetails(context.Background(), previewVirtualMachines); err != nil {
+		return nil, err
+	}
+	virtualMachines = previewVirtualMachines[namespacedName]
+	vnets := computeCfg.getCachedVnetsMap()
+	vmObjects := map[string]*runtimev1alpha1.VirtualMachine{}
+	for _, virtualMachine := range virtualMachines {
+		vmObject := computeInstanceToInternalVirtualMachineObject(virtualMachine, vnets, &namespacedName,
+			&computeCfg.accountNamespacedName, computeCfg.credentials.region)
+		if vmObject != nil {
+			vmObjects[vmObject.Name] = vmObject
+		}
+	}
+
+	vms := make([]*runtimev1alpha1.VirtualMachine, 0, len(vmObjects))
+	for _, vmObject := range vmObjects {
+		vms = append(vms, vmObject)
+	}
+	return vms, nil
+}
+
 func (computeCfg *computeServiceConfig) RemoveResourceFilters(selectorNamespacedName *types.NamespacedName) {
 	delete(computeCfg.computeFilters, *selectorNamespacedName)
 	delete(computeCfg.selectors, *selectorNamespacedName)
+	delete(computeCfg.settledVMIDs, *selectorNamespacedName)
+	computeCfg.vmTombstones.RemoveSelector(*selectorNamespacedName)
+	computeCfg.selectorHolds.RemoveSelector(*selectorNamespacedName)
+	computeCfg.coalesceSelectors()
+}
+
+// GetResourceFilterSelectors returns the namespaced names of the selectors whose compute filters are configured.
+func (computeCfg *computeServiceConfig) GetResourceFilterSelectors() []types.NamespacedName {
+	selectors := make([]types.NamespacedName, 0, len(computeCfg.selectors))
+	for namespacedName := range computeCfg.selectors {
+		selectors = append(selectors, namespacedName)
+	}
+	return selectors
+}
+
+// RemoveAllResourceFilters removes all selectors and recomputes the snapshot without their vms, vnets are kept.
+func (computeCfg *computeServiceConfig) RemoveAllResourceFilters() {
+	computeCfg.computeFilters = make(map[types.NamespacedName][]*string)
+	computeCfg.selectors = make(map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector)
+	computeCfg.selectorAliases = nil
+	computeCfg.settledVMIDs = make(map[types.NamespacedName]map[string]struct{})
+	computeCfg.vmTombstones.Reset()
+	computeCfg.selectorHolds.Reset()
+
+	snapshot, ok := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+	if !ok || snapshot == nil {
+		return
+	}
+	computeCfg.updateSnapshot(&computeResourcesCacheSnapshot{make(map[types.NamespacedName][]*virtualMachineTable),
+		snapshot.vnets, make(map[string]struct{}), snapshot.vnetPeers})
 }
 
 // getVirtualMachineObjects converts cached virtual machines in cloud format to internal runtimev1alpha1.VirtualMachine format.
@@ -309,7 +999,10 @@ func (computeCfg *computeServiceConfig) GetInventoryStats() *internal.CloudServi
 
 func (computeCfg *computeServiceConfig) ResetInventoryCache() {
 	computeCfg.resourcesCache.UpdateSnapshot(nil)
+	computeCfg.snapshotHistory.Reset()
 	computeCfg.inventoryStats.ResetInventoryPollStats()
+	computeCfg.vmTombstones.Reset()
+	computeCfg.selectorHolds.Reset()
 }
 
 func (computeCfg *computeServiceConfig) UpdateServiceConfig(newConfig internal.CloudServiceInterface) error {
@@ -319,7 +1012,10 @@ func (computeCfg *computeServiceConfig) UpdateServiceConfig(newConfig internal.C
 	computeCfg.asgAPIClient = newComputeServiceConfig.asgAPIClient
 	computeCfg.vnetAPIClient = newComputeServiceConfig.vnetAPIClient
 	computeCfg.resourceGraphAPIClient = newComputeServiceConfig.resourceGraphAPIClient
+	computeCfg.permissionsAPIClient = newComputeServiceConfig.permissionsAPIClient
 	computeCfg.credentials = newComputeServiceConfig.credentials
+	computeCfg.vmTombstones.SetPolls(computeCfg.credentials.inventoryTombstonePolls)
+	computeCfg.selectorHolds.SetThreshold(computeCfg.credentials.selectorMatchSpikeThreshold)
 	for _, selector := range computeCfg.selectors {
 		if err := computeCfg.AddResourceFilters(selector); err != nil {
 			return err
@@ -328,10 +1024,36 @@ func (computeCfg *computeServiceConfig) UpdateServiceConfig(newConfig internal.C
 	return nil
 }
 
+// UpdateServiceOptions applies the account options of credentials in place. The resource filters of selectors are
+// rendered again when the inventory fields changed. Egress allow CIDRs, deny rule placement, peer address space
+// fallback and detach policy change how security groups are enforced.
+func (computeCfg *computeServiceConfig) UpdateServiceOptions(credentials interface{}) (bool, error) {
+	previous := computeCfg.credentials
+	computeCfg.credentials = credentials.(*azureAccountConfig)
+	computeCfg.vmTombstones.SetPolls(computeCfg.credentials.inventoryTombstonePolls)
+	computeCfg.selectorHolds.SetThreshold(computeCfg.credentials.selectorMatchSpikeThreshold)
+	securityChanged := !reflect.DeepEqual(previous.egressAllowCIDRs, computeCfg.credentials.egressAllowCIDRs) ||
+		previous.denyRulePlacement != computeCfg.credentials.denyRulePlacement ||
+		previous.peerAddressSpaceFallback != computeCfg.credentials.peerAddressSpaceFallback ||
+		previous.detachPolicy != computeCfg.credentials.detachPolicy
+	if reflect.DeepEqual(previous.inventoryFields, computeCfg.credentials.inventoryFields) {
+		return securityChanged, nil
+	}
+	for namespacedName, selector := range computeCfg.selectors {
+		filters, ok := computeCfg.convertSelectorToComputeQuery(selector)
+		if !ok {
+			return securityChanged, fmt.Errorf("error creating resource query filters")
+		}
+		computeCfg.computeFilters[namespacedName] = filters
+	}
+	computeCfg.coalesceSelectors()
+	return securityChanged, nil
+}
+
 // getVpcs invokes cloud API to fetch the list of vnets.
-func (computeCfg *computeServiceConfig) getVpcs() ([]armnetwork.VirtualNetwork, error) {
+func (computeCfg *computeServiceConfig) getVpcs(ctx context.Context) ([]armnetwork.VirtualNetwork, error) {
 	vnets := make([]armnetwork.VirtualNetwork, 0)
-	allVnets, err := computeCfg.vnetAPIClient.listAllComplete(context.Background())
+	allVnets, err := computeCfg.vnetAPIClient.listAllComplete(ctx)
 	if err != nil {
 		return vnets, err
 	}
@@ -344,35 +1066,93 @@ func (computeCfg *computeServiceConfig) getVpcs() ([]armnetwork.VirtualNetwork,
 	return vnets, nil
 }
 
-func (computeCfg *computeServiceConfig) buildMapVpcPeers(results []armnetwork.VirtualNetwork) map[string][][]string {
-	vpcPeers := make(map[string][][]string)
+// getMapVpcPeers returns the vnet peering map of vnets, which is only rebuilt when the peerings changed since the last
+// inventory poll. The returned map is shared by snapshots and must not be modified.
+func (computeCfg *computeServiceConfig) getMapVpcPeers(vnets []armnetwork.VirtualNetwork) map[string][][]string {
+	hash := hashVnetPeerings(vnets)
+	if computeCfg.vnetPeersCache.peers != nil && computeCfg.vnetPeersCache.hash == hash {
+		return computeCfg.vnetPeersCache.peers
+	}
+	azurePluginLogger().V(1).Info("Vnet peerings changed, rebuilding peering map", "account", computeCfg.accountNamespacedName)
+	computeCfg.vnetPeersCache = vnetPeersCache{hash: hash, peers: computeCfg.buildMapVpcPeers(vnets)}
+	return computeCfg.vnetPeersCache.peers
+}
 
-	for _, result := range results {
-		if result.Properties == nil {
+// hashVnetPeerings returns a hash of the vnet fields the peering map is built from.
+func hashVnetPeerings(vnets []armnetwork.VirtualNetwork) uint64 {
+	h := fnv.New64a()
+	write := func(s *string) {
+		if s != nil {
+			_, _ = h.Write([]byte(strings.ToLower(*s)))
+		}
+		_, _ = h.Write([]byte{0})
+	}
+	firstPrefix := func(addressSpace *armnetwork.AddressSpace) *string {
+		if addressSpace == nil || len(addressSpace.AddressPrefixes) == 0 {
+			return nil
+		}
+		return addressSpace.AddressPrefixes[0]
+	}
+	for _, vnet := range vnets {
+		if vnet.Properties == nil || len(vnet.Properties.VirtualNetworkPeerings) == 0 {
 			continue
 		}
-		properties := result.Properties
-		if len(properties.VirtualNetworkPeerings) > 0 {
-			for _, peerConn := range properties.VirtualNetworkPeerings {
-				var requesterID, destinationID, sourceID string
-				accepterID := strings.ToLower(*result.ID)
-				peerProperties := peerConn.Properties
-				if peerProperties != nil && peerProperties.RemoteVirtualNetwork != nil {
-					requesterID = strings.ToLower(*peerConn.Properties.RemoteVirtualNetwork.ID)
-				}
-
-				if peerProperties != nil && peerProperties.RemoteAddressSpace != nil &&
-					len(peerProperties.RemoteAddressSpace.AddressPrefixes) > 0 {
-					destinationID = strings.ToLower(*peerProperties.RemoteAddressSpace.AddressPrefixes[0])
-				}
-				if properties.AddressSpace != nil && len(properties.AddressSpace.AddressPrefixes) > 0 {
-					sourceID = strings.ToLower(*properties.AddressSpace.AddressPrefixes[0])
+		write(vnet.ID)
+		write(firstPrefix(vnet.Properties.AddressSpace))
+		for _, peerConn := range vnet.Properties.VirtualNetworkPeerings {
+			var remoteID, remotePrefix *string
+			if peerConn.Properties != nil {
+				if peerConn.Properties.RemoteVirtualNetwork != nil {
+					remoteID = peerConn.Properties.RemoteVirtualNetwork.ID
 				}
+				remotePrefix = firstPrefix(peerConn.Properties.RemoteAddressSpace)
+			}
+			write(remoteID)
+			write(remotePrefix)
+		}
+		_, _ = h.Write([]byte{1})
+	}
+	return h.Sum64()
+}
 
-				vpcPeers[accepterID] = append(vpcPeers[accepterID], []string{requesterID, destinationID, sourceID})
+// buildVnetPeerings returns the peerings of vnets, in the order of vnets and of their peerings.
+func buildVnetPeerings(vnets []armnetwork.VirtualNetwork) []nephetypes.VpcPeering {
+	var peerings []nephetypes.VpcPeering
+	for _, vnet := range vnets {
+		if vnet.Properties == nil {
+			continue
+		}
+		properties := vnet.Properties
+		for _, peerConn := range properties.VirtualNetworkPeerings {
+			peering := nephetypes.VpcPeering{AccepterID: strings.ToLower(*vnet.ID)}
+			peerProperties := peerConn.Properties
+			if peerProperties != nil && peerProperties.RemoteVirtualNetwork != nil {
+				peering.RequesterID = strings.ToLower(*peerProperties.RemoteVirtualNetwork.ID)
 			}
+			if peerProperties != nil && peerProperties.RemoteAddressSpace != nil &&
+				len(peerProperties.RemoteAddressSpace.AddressPrefixes) > 0 {
+				peering.DestinationCIDR = strings.ToLower(*peerProperties.RemoteAddressSpace.AddressPrefixes[0])
+			}
+			if peerProperties != nil && peerProperties.PeeringState != nil {
+				peering.State = string(*peerProperties.PeeringState)
+			}
+			if properties.AddressSpace != nil && len(properties.AddressSpace.AddressPrefixes) > 0 {
+				peering.SourceCIDR = strings.ToLower(*properties.AddressSpace.AddressPrefixes[0])
+			}
+			peerings = append(peerings, peering)
 		}
 	}
+	return peerings
+}
+
+// buildMapVpcPeers returns the peerings of vnets keyed by the accepter vnet ID, as (requester ID, destination CIDR,
+// source CIDR) tuples.
+func (computeCfg *computeServiceConfig) buildMapVpcPeers(results []armnetwork.VirtualNetwork) map[string][][]string {
+	vpcPeers := make(map[string][][]string)
+	for _, peering := range buildVnetPeerings(results) {
+		vpcPeers[peering.AccepterID] = append(vpcPeers[peering.AccepterID],
+			[]string{peering.RequesterID, peering.DestinationCIDR, peering.SourceCIDR})
+	}
 	return vpcPeers
 }
 
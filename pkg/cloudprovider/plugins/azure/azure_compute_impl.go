@@ -15,8 +15,12 @@
 package azure
 
 import (
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/types"
 
+	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	nephetypes "antrea.io/nephe/pkg/types"
 )
 
@@ -24,3 +28,34 @@ import (
 func (c *azureCloud) GetCloudInventory(accountNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, error) {
 	return c.cloudCommon.GetCloudInventory(accountNamespacedName)
 }
+
+// GetSnapshotFootprint returns the approximate memory footprint of the internal snapshot and of its history.
+func (c *azureCloud) GetSnapshotFootprint(accountNamespacedName *types.NamespacedName) (*nephetypes.SnapshotFootprint, error) {
+	return c.cloudCommon.GetSnapshotFootprint(accountNamespacedName)
+}
+
+// GetMatchingSelectors returns the selectors which matched the VM in internal snapshot.
+func (c *azureCloud) GetMatchingSelectors(accNamespacedName *types.NamespacedName, instanceID string) ([]string, error) {
+	return c.cloudCommon.GetMatchingSelectors(accNamespacedName, instanceID)
+}
+
+// GetSelectorCloudInventory pulls the VMs matched by the selector and their vpcs from internal snapshot.
+func (c *azureCloud) GetSelectorCloudInventory(accNamespacedName, selectorNamespacedName *types.NamespacedName) (
+	*nephetypes.CloudInventory, error) {
+	return c.cloudCommon.GetSelectorCloudInventory(accNamespacedName, selectorNamespacedName)
+}
+
+// PreviewSelector returns the VMs the selector would match, without adding the selector.
+func (c *azureCloud) PreviewSelector(accNamespacedName *types.NamespacedName,
+	selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error) {
+	return c.cloudCommon.PreviewSelector(accNamespacedName, selector)
+}
+
+// GetVpcPeerings returns the peerings of the vpcs of the account from internal snapshot.
+func (c *azureCloud) GetVpcPeerings(accNamespacedName *types.NamespacedName) ([]nephetypes.VpcPeering, error) {
+	accCfg, found := c.cloudCommon.GetCloudAccountByName(accNamespacedName)
+	if !found {
+		return nil, fmt.Errorf("unable to find cloud account config")
+	}
+	return accCfg.GetServiceConfig().(*computeServiceConfig).getVnetPeerings(), nil
+}
@@ -15,8 +15,10 @@
 package azure
 
 import (
+	"sort"
 	"strings"
 
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -29,6 +31,13 @@ import (
 	"antrea.io/nephe/pkg/util/k8s/tags"
 )
 
+const (
+	// provisioningStateSucceeded is the provisioning state of a VM which is successfully created or updated.
+	provisioningStateSucceeded = "Succeeded"
+	// provisioningStateUpdating is the provisioning state of a provisioned VM being updated.
+	provisioningStateUpdating = "Updating"
+)
+
 var azureStateMap = map[string]runtimev1alpha1.VMState{
 	"PowerState/running":      runtimev1alpha1.Running,
 	"PowerState/deallocated":  runtimev1alpha1.Stopped,
@@ -52,18 +61,38 @@ func computeInstanceToInternalVirtualMachineObject(instance *virtualMachineTable
 	// Network interfaces associated with Virtual machine
 	instNetworkInterfaces := instance.NetworkInterfaces
 	networkInterfaces := make([]runtimev1alpha1.NetworkInterface, 0, len(instNetworkInterfaces))
+	hasPublicIP := instance.HasPublicIP != nil && *instance.HasPublicIP
+	var nsgIDs []string
+	nsgIDSet := make(map[string]struct{})
 	for _, nwInf := range instNetworkInterfaces {
+		for _, nsgID := range nwInf.NsgIDs {
+			if emptyString(nsgID) {
+				continue
+			}
+			id := strings.ToLower(*nsgID)
+			if _, found := nsgIDSet[id]; !found {
+				nsgIDSet[id] = struct{}{}
+				nsgIDs = append(nsgIDs, id)
+			}
+		}
 		var ipAddressObjs []runtimev1alpha1.IPAddress
 		if len(nwInf.PrivateIps) > 0 {
+			primaryIP := nwInf.primaryPrivateIP()
 			for _, ipAddress := range nwInf.PrivateIps {
 				ipAddresObj := runtimev1alpha1.IPAddress{
 					AddressType: runtimev1alpha1.AddressTypeInternalIP,
 					Address:     *ipAddress,
+					Primary:     primaryIP != nil && *ipAddress == *primaryIP,
+				}
+				// only one IP is primary when the primary IP is listed more than once.
+				if ipAddresObj.Primary {
+					primaryIP = nil
 				}
 				ipAddressObjs = append(ipAddressObjs, ipAddresObj)
 			}
 		}
 		if len(nwInf.PublicIps) > 0 {
+			hasPublicIP = true
 			for _, publicIP := range nwInf.PublicIps {
 				ipAddressObj := runtimev1alpha1.IPAddress{
 					AddressType: runtimev1alpha1.AddressTypeExternalIP,
@@ -88,7 +117,8 @@ func computeInstanceToInternalVirtualMachineObject(instance *virtualMachineTable
 	cloudNetworkID := strings.ToLower(*instance.VnetID)
 	cloudID := strings.ToLower(*instance.ID)
 	cloudName := strings.ToLower(*instance.Name)
-	crdName := utils.GenerateShortResourceIdentifier(cloudID, cloudName)
+	// VMSS instance names are of the form <scale set>_<instance ID>, underscores are not allowed in object names.
+	crdName := utils.GenerateShortResourceIdentifier(cloudID, strings.ReplaceAll(cloudName, "_", "-"))
 	var vmUid string
 	if instance.Properties != nil && instance.Properties.VMID != nil {
 		vmUid = strings.ToLower(*instance.Properties.VMID)
@@ -113,17 +143,85 @@ func computeInstanceToInternalVirtualMachineObject(instance *virtualMachineTable
 		state = runtimev1alpha1.Unknown
 	}
 
+	var createdAt *v1.Time
+	if instance.CreatedAt != nil {
+		createdAt = &v1.Time{Time: *instance.CreatedAt}
+	} else if instance.Properties != nil && instance.Properties.TimeCreated != nil {
+		createdAt = &v1.Time{Time: *instance.Properties.TimeCreated}
+	}
+	var lastModifiedAt *v1.Time
+	if instance.LastModifiedAt != nil {
+		lastModifiedAt = &v1.Time{Time: *instance.LastModifiedAt}
+	}
+	var encryptionAtHost bool
+	if instance.EncryptionAtHost != nil {
+		encryptionAtHost = *instance.EncryptionAtHost
+	} else if instance.Properties != nil && instance.Properties.SecurityProfile != nil &&
+		instance.Properties.SecurityProfile.EncryptionAtHost != nil {
+		encryptionAtHost = *instance.Properties.SecurityProfile.EncryptionAtHost
+	}
+	dataDiskCount, dataDiskSizeGB := getDataDisks(instance)
+	secureBootEnabled, vTpmEnabled := getBootIntegrity(instance)
+	locked := instance.Locked != nil && *instance.Locked
+
+	var size string
+	if instance.Properties != nil && instance.Properties.HardwareProfile != nil &&
+		instance.Properties.HardwareProfile.VMSize != nil {
+		size = string(*instance.Properties.HardwareProfile.VMSize)
+	}
+
+	var osFamily runtimev1alpha1.OSFamily
+	if instance.Properties != nil && instance.Properties.StorageProfile != nil &&
+		instance.Properties.StorageProfile.OSDisk != nil && instance.Properties.StorageProfile.OSDisk.OSType != nil {
+		osFamily = utils.GetOSFamily(string(*instance.Properties.StorageProfile.OSDisk.OSType))
+	}
+
+	var provisioningState string
+	if instance.Properties != nil && instance.Properties.ProvisioningState != nil {
+		provisioningState = *instance.Properties.ProvisioningState
+	}
+
+	var extensions []string
+	for _, extension := range instance.Extensions {
+		if extension != nil {
+			extensions = append(extensions, strings.ToLower(*extension))
+		}
+	}
+	sort.Strings(extensions)
+
+	var scaleSetID string
+	if !emptyString(instance.ScaleSetID) {
+		scaleSetID = strings.ToLower(*instance.ScaleSetID)
+	}
+
 	vmStatus := &runtimev1alpha1.VirtualMachineStatus{
-		Provider:          runtimev1alpha1.AzureCloudProvider,
-		Tags:              importedTags,
-		State:             state,
-		NetworkInterfaces: networkInterfaces,
-		Region:            strings.ToLower(region),
-		Agented:           false,
-		CloudId:           strings.ToLower(cloudID),
-		CloudName:         strings.ToLower(cloudName),
-		CloudVpcId:        strings.ToLower(cloudNetworkID),
-		CloudVpcName:      nwResName,
+		Provider:              runtimev1alpha1.AzureCloudProvider,
+		Tags:                  importedTags,
+		State:                 state,
+		NetworkInterfaces:     networkInterfaces,
+		Region:                strings.ToLower(region),
+		Agented:               false,
+		CloudId:               strings.ToLower(cloudID),
+		CloudName:             strings.ToLower(cloudName),
+		CloudVpcId:            strings.ToLower(cloudNetworkID),
+		CloudVpcName:          nwResName,
+		CreatedAt:             createdAt,
+		LastModifiedAt:        lastModifiedAt,
+		EncryptionAtHost:      encryptionAtHost,
+		DataDiskCount:         dataDiskCount,
+		DataDiskSizeGB:        dataDiskSizeGB,
+		SecureBootEnabled:     secureBootEnabled,
+		VTPMEnabled:           vTpmEnabled,
+		Locked:                locked,
+		Extensions:            extensions,
+		HasPublicIP:           hasPublicIP,
+		NetworkSecurityGroups: nsgIDs,
+		OSFamily:              osFamily,
+		ProvisioningState:     provisioningState,
+		Size:                  size,
+		ScaleSetId:            scaleSetID,
+		// the network interfaces of uniform scale set instances are not enforced, see updateSecurityGroupMembers.
+		EnforcementUnsupported: isUniformScaleSetInstance(cloudID),
 	}
 
 	labelsMap := map[string]string{
@@ -153,6 +251,35 @@ func computeInstanceToInternalVirtualMachineObject(instance *virtualMachineTable
 	return vmObj
 }
 
+// getDataDisks returns the number and total size in GB of the data disks attached to a VM, falling back to the VM
+// properties when the data disk fields are not queried.
+func getDataDisks(instance *virtualMachineTable) (int32, int32) {
+	if instance.DataDiskCount != nil || instance.DataDiskSizeGB != nil {
+		var count, sizeGB int32
+		if instance.DataDiskCount != nil {
+			count = *instance.DataDiskCount
+		}
+		if instance.DataDiskSizeGB != nil {
+			sizeGB = *instance.DataDiskSizeGB
+		}
+		return count, sizeGB
+	}
+	if instance.Properties == nil || instance.Properties.StorageProfile == nil {
+		return 0, 0
+	}
+	var count, sizeGB int32
+	for _, dataDisk := range instance.Properties.StorageProfile.DataDisks {
+		if dataDisk == nil {
+			continue
+		}
+		count++
+		if dataDisk.DiskSizeGB != nil {
+			sizeGB += *dataDisk.DiskSizeGB
+		}
+	}
+	return count, sizeGB
+}
+
 // ComputeVpcToInternalVpcObject converts vnet object from cloud format(network.VirtualNetwork) to vpc runtime object.
 func ComputeVpcToInternalVpcObject(vnet *armnetwork.VirtualNetwork, accountNamespace, accountName,
 	region string, managed bool) *runtimev1alpha1.Vpc {
@@ -204,3 +331,21 @@ func ComputeVpcToInternalVpcObject(vnet *armnetwork.VirtualNetwork, accountNames
 
 	return vpcObj
 }
+
+// getBootIntegrity returns whether Secure Boot and vTPM are enabled on a VM, falling back to the VM properties when the
+// fields are not queried. Generation 1 VMs do not have UEFI settings, both are reported as disabled.
+func getBootIntegrity(instance *virtualMachineTable) (bool, bool) {
+	var uefiSettings *compute.UefiSettings
+	if instance.Properties != nil && instance.Properties.SecurityProfile != nil {
+		uefiSettings = instance.Properties.SecurityProfile.UefiSettings
+	}
+	secureBootEnabled := instance.SecureBootEnabled != nil && *instance.SecureBootEnabled
+	if instance.SecureBootEnabled == nil && uefiSettings != nil && uefiSettings.SecureBootEnabled != nil {
+		secureBootEnabled = *uefiSettings.SecureBootEnabled
+	}
+	vTpmEnabled := instance.VTpmEnabled != nil && *instance.VTpmEnabled
+	if instance.VTpmEnabled == nil && uefiSettings != nil && uefiSettings.VTpmEnabled != nil {
+		vTpmEnabled = *uefiSettings.VTpmEnabled
+	}
+	return secureBootEnabled, vTpmEnabled
+}
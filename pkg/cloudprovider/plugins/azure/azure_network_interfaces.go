@@ -27,7 +27,7 @@ import (
 
 // networkInterfaces returns network interfaces SDK api client.
 func (p *azureServiceSdkConfigProvider) networkInterfaces(subscriptionID string) (azureNwIntfWrapper, error) {
-	interfacesClient, _ := armnetwork.NewInterfacesClient(subscriptionID, p.cred, nil)
+	interfacesClient, _ := armnetwork.NewInterfacesClient(subscriptionID, p.cred, p.options)
 	return &azureNwIntfWrapperImpl{nwIntfAPIClient: *interfacesClient}, nil
 }
 
@@ -51,10 +51,11 @@ func updateNetworkInterfaceAsg(nwIntfAPIClient azureNwIntfWrapper, nwIntfObj *ar
 	return err
 }
 
-// updateNetworkInterfaceNsg updates network interface on cloud with new set of NSGs.
+// updateNetworkInterfaceNsg updates network interface on cloud with new set of NSGs. When keepNsgOnDetach is set, the
+// NSG stays associated with the network interface even if it is no longer a member of any appliedTo group.
 func updateNetworkInterfaceNsg(nwIntfAPIClient azureNwIntfWrapper, nwIntfObj *armnetwork.Interface,
 	nsgObjToAttachOrDetach armnetwork.SecurityGroup, asgObjToAttachOrDetach armnetwork.ApplicationSecurityGroup,
-	isAttach bool, tagKey string) error {
+	isAttach bool, tagKey string, keepNsgOnDetach bool) error {
 	if nwIntfObj.ID == nil {
 		return fmt.Errorf("network interface object is empty")
 	}
@@ -65,7 +66,7 @@ func updateNetworkInterfaceNsg(nwIntfAPIClient azureNwIntfWrapper, nwIntfObj *ar
 
 	_, rgName, resName, _ := extractFieldsFromAzureResourceID(*nwIntfObj.ID)
 
-	nsg, tags := getUpdatedNetworkInterfaceNsgAndTags(nwIntfObj, nsgObjToAttachOrDetach, isAttach, tagKey)
+	nsg, tags := getUpdatedNetworkInterfaceNsgAndTags(nwIntfObj, nsgObjToAttachOrDetach, isAttach, tagKey, keepNsgOnDetach)
 	ipConfigurations := getAsgUpdatedIPConfigurations(nwIntfObj, asgObjToAttachOrDetach, isAttach)
 
 	nwIntfObj.Properties.IPConfigurations = ipConfigurations
@@ -125,7 +126,7 @@ func getAsgUpdatedIPConfigurations(nwIntfObj *armnetwork.Interface, asgObjToAtta
 
 // getUpdatedNetworkInterfaceNsgAndTags adds/deletes NSG from network interface object bssed on isAttach parameter.
 func getUpdatedNetworkInterfaceNsgAndTags(nwIntfObj *armnetwork.Interface, nsgObjToAttachOrDetach armnetwork.SecurityGroup,
-	isAttach bool, tagKey string) (*armnetwork.SecurityGroup, map[string]*string) {
+	isAttach bool, tagKey string, keepNsgOnDetach bool) (*armnetwork.SecurityGroup, map[string]*string) {
 	currentTags := nwIntfObj.Tags
 
 	if isAttach {
@@ -136,7 +137,7 @@ func getUpdatedNetworkInterfaceNsgAndTags(nwIntfObj *armnetwork.Interface, nsgOb
 		currentTags[tagKey] = to.StringPtr("true")
 	} else {
 		delete(currentTags, tagKey)
-		if !hasAnyNepheControllerSecurityGroupTags(currentTags) {
+		if !keepNsgOnDetach && !hasAnyNepheControllerSecurityGroupTags(currentTags) {
 			nwIntfObj.Properties.NetworkSecurityGroup = nil
 		}
 	}
@@ -26,7 +26,7 @@ import (
 
 // securityGroups returns security-groups apiClient.
 func (p *azureServiceSdkConfigProvider) securityGroups(subscriptionID string) (azureNsgWrapper, error) {
-	securityGroupsClient, err := armnetwork.NewSecurityGroupsClient(subscriptionID, p.cred, nil)
+	securityGroupsClient, err := armnetwork.NewSecurityGroupsClient(subscriptionID, p.cred, p.options)
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +58,8 @@ func createOrGetNetworkSecurityGroup(nsgAPIClient azureNsgWrapper, location stri
 	return strings.ToLower(*nsg.ID), nil
 }
 
+// updateNetworkSecurityGroupRules replaces all rules of a network security group. The rule set is written with a single
+// network security group update, which Azure applies atomically, hence no transient rule set is exposed.
 func updateNetworkSecurityGroupRules(nsgAPIClient azureNsgWrapper, location string, rgName string, cloudSgName string,
 	rules []*armnetwork.SecurityRule) error {
 	securityGroupParams := armnetwork.SecurityGroup{
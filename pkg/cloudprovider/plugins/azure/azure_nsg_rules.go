@@ -25,6 +25,7 @@ import (
 	"github.com/Azure/go-autorest/autorest/to"
 	"k8s.io/apimachinery/pkg/types"
 
+	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
@@ -37,17 +38,12 @@ const (
 	virtualnetworkAddressPrefix = "VirtualNetwork"
 )
 
-var protoNumAzureNameMap = map[int]armnetwork.SecurityRuleProtocol{
-	1:  armnetwork.SecurityRuleProtocolIcmp,
-	6:  armnetwork.SecurityRuleProtocolTCP,
-	17: armnetwork.SecurityRuleProtocolUDP,
-}
-
-var azureProtoNameToNumMap = map[string]int{
-	strings.ToLower(string(armnetwork.SecurityRuleProtocolIcmp)): 1,
-	strings.ToLower(string(armnetwork.SecurityRuleProtocolTCP)):  6,
-	strings.ToLower(string(armnetwork.SecurityRuleProtocolUDP)):  17,
-}
+const (
+	// fullPortRange covers every port, it is equivalent to emptyPort.
+	fullPortRange = "0-65535"
+	minPort       = 0
+	maxPort       = 65535
+)
 
 func getDefaultDenyRuleName() string {
 	return cloudresource.ControllerPrefix + "-default-deny"
@@ -69,6 +65,94 @@ func isAzureRuleAttachedToAtSg(rule *armnetwork.SecurityRule, asg string) bool {
 	return false
 }
 
+// isEgressAllowListRule checks if the given Azure security rule is built from the egress allow CIDRs of the account.
+func isEgressAllowListRule(rule *armnetwork.SecurityRule) bool {
+	if *rule.Properties.Direction != armnetwork.SecurityRuleDirectionOutbound {
+		return false
+	}
+	return utils.IsEgressAllowListRuleDescription(rule.Properties.Description)
+}
+
+// buildEgressAllowListRules returns the current allow-list rules of the appliedTo sg to keep, and the allow-list rules
+// to add, so that the appliedTo sg allows egress to the given CIDRs with any protocol and port. CIDRs which a policy
+// egress rule of the appliedTo sg, current or to add, already allows with any protocol and port are left out.
+func buildEgressAllowListRules(appliedToGroupID *cloudresource.CloudResourceID, cidrs []*net.IPNet,
+	currentAllowListRules, currentRules, addRules []*armnetwork.SecurityRule,
+	atAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup) ([]*armnetwork.SecurityRule,
+	[]*armnetwork.SecurityRule, error) {
+	asg := getCloudName(appliedToGroupID, false)
+	policyPrefixes := make(map[string]struct{})
+	for _, rules := range [][]*armnetwork.SecurityRule{currentRules, addRules} {
+		for _, rule := range rules {
+			if rule == nil || !isAzureRuleAttachedToAtSg(rule, asg) || !isAnyProtocolAndPortAllowRule(rule) {
+				continue
+			}
+			if rule.Properties.DestinationAddressPrefix != nil {
+				policyPrefixes[*rule.Properties.DestinationAddressPrefix] = struct{}{}
+			}
+			for _, prefix := range rule.Properties.DestinationAddressPrefixes {
+				policyPrefixes[*prefix] = struct{}{}
+			}
+		}
+	}
+	var allowCIDRs []*net.IPNet
+	for _, cidr := range cidrs {
+		if _, ok := policyPrefixes[cidr.String()]; !ok {
+			allowCIDRs = append(allowCIDRs, cidr)
+		}
+	}
+
+	var allowListRules []*armnetwork.SecurityRule
+	if rule := utils.NewEgressAllowListRule(appliedToGroupID, allowCIDRs); rule != nil {
+		var err error
+		allowListRules, err = convertEgressToNsgSecurityRules(appliedToGroupID, []*cloudresource.CloudRule{rule}, nil,
+			atAsgMapByNepheControllerName, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// current allow-list rules still built from the CIDRs are kept as is.
+	var keptRules []*armnetwork.SecurityRule
+	for _, rule := range currentAllowListRules {
+		if idx, found := findSecurityRule(allowListRules, normalizeAzureSecurityRule(rule)); found {
+			keptRules = append(keptRules, rule)
+			allowListRules[idx] = nil
+		}
+	}
+	return keptRules, allowListRules, nil
+}
+
+// isAnyProtocolAndPortAllowRule checks if the given Azure security rule allows traffic of any protocol and port.
+func isAnyProtocolAndPortAllowRule(rule *armnetwork.SecurityRule) bool {
+	property := rule.Properties
+	if property.Access == nil || *property.Access != armnetwork.SecurityRuleAccessAllow ||
+		property.Protocol == nil || *property.Protocol != armnetwork.SecurityRuleProtocolAsterisk {
+		return false
+	}
+	srcPort := normalizeAzurePortRange(property.SourcePortRange)
+	dstPort := normalizeAzurePortRange(property.DestinationPortRange)
+	return srcPort != nil && *srcPort == emptyPort && dstPort != nil && *dstPort == emptyPort
+}
+
+// countNepheRulesOfAtSg returns the number of Nephe rules attached to the specified appliedTo sg, excluding the
+// default deny rules.
+func countNepheRulesOfAtSg(rules []*armnetwork.SecurityRule, asg string) int {
+	count := 0
+	for _, rule := range rules {
+		if rule == nil || rule.Properties == nil || rule.Properties.Priority == nil ||
+			*rule.Properties.Priority < ruleStartPriority {
+			continue
+		}
+		if _, ok := utils.ExtractCloudDescription(rule.Properties.Description); !ok {
+			continue
+		}
+		if isAzureRuleAttachedToAtSg(rule, asg) {
+			count++
+		}
+	}
+	return count
+}
+
 // getEmptyCloudRule returns a *securitygroup.CloudRule object with valid fields based on sync content, except nil for the rule field.
 // If no valid options are available, nil is returned.
 func getEmptyCloudRule(syncContent *cloudresource.SynchronizationContent) *cloudresource.CloudRule {
@@ -76,6 +160,7 @@ func getEmptyCloudRule(syncContent *cloudresource.SynchronizationContent) *cloud
 		if rule.NpNamespacedName != "" {
 			emptyRule := &cloudresource.CloudRule{
 				NpNamespacedName: rule.NpNamespacedName,
+				NpUID:            rule.NpUID,
 				AppliedToGrp:     rule.AppliedToGrp,
 			}
 			emptyRule.Hash = emptyRule.GetHash()
@@ -95,13 +180,38 @@ func getUnusedPriority(existingRulePriority map[int32]struct{}, startPriority in
 	return startPriority
 }
 
+// getSecurityRulePolicy returns the namespaced name of the policy owning a Nephe security rule, or an empty string.
+func getSecurityRulePolicy(rule *armnetwork.SecurityRule) string {
+	desc, ok := utils.ExtractCloudDescription(rule.Properties.Description)
+	if !ok {
+		return ""
+	}
+	return types.NamespacedName{Namespace: desc.Namespace, Name: desc.Name}.String()
+}
+
+// policyDirection identifies the rules of a policy in one direction.
+type policyDirection struct {
+	policy    string
+	direction armnetwork.SecurityRuleDirection
+}
+
 // updateSecurityRuleNameAndPriority updates rule name and priority for new security rules based on existing security rules
-// and returns them combined.
+// and returns them combined. New rules of a policy are assigned increasing priorities in their given order, after the
+// existing rules of the same policy, so that rules of other policies do not interleave with the intra-policy order.
+// Azure evaluates inbound and outbound rules separately, so each direction has its own priority space, and rules of
+// one direction never consume the priorities of the other.
 func updateSecurityRuleNameAndPriority(existingRules []*armnetwork.SecurityRule,
 	newRules []*armnetwork.SecurityRule) []*armnetwork.SecurityRule {
 	var rules []*armnetwork.SecurityRule
-	existingRulePriority := make(map[int32]struct{})
-	rulePriority := int32(ruleStartPriority)
+	existingRulePriority := make(map[armnetwork.SecurityRuleDirection]map[int32]struct{})
+	getExistingRulePriority := func(direction armnetwork.SecurityRuleDirection) map[int32]struct{} {
+		if _, ok := existingRulePriority[direction]; !ok {
+			existingRulePriority[direction] = make(map[int32]struct{})
+		}
+		return existingRulePriority[direction]
+	}
+	// highest priority of existing rules of each policy, per direction.
+	policyRulePriority := make(map[policyDirection]int32)
 
 	for _, rule := range existingRules {
 		if rule.Properties == nil {
@@ -109,39 +219,107 @@ func updateSecurityRuleNameAndPriority(existingRules []*armnetwork.SecurityRule,
 		}
 		// record priority for existing rules in Nephe priority range.
 		if *rule.Properties.Priority >= ruleStartPriority {
-			existingRulePriority[*rule.Properties.Priority] = struct{}{}
+			direction := getSecurityRuleDirection(rule)
+			getExistingRulePriority(direction)[*rule.Properties.Priority] = struct{}{}
+			key := policyDirection{policy: getSecurityRulePolicy(rule), direction: direction}
+			if *rule.Properties.Priority > policyRulePriority[key] {
+				policyRulePriority[key] = *rule.Properties.Priority
+			}
 		}
 		rules = append(rules, rule)
 	}
 
+	// group new rules by policy and direction, keeping the order of rules within a policy and of first appearance of
+	// policies.
+	var policies []policyDirection
+	policyNewRules := make(map[policyDirection][]*armnetwork.SecurityRule)
 	for _, rule := range newRules {
 		if rule == nil || rule.Properties == nil {
 			continue
 		}
+		key := policyDirection{policy: getSecurityRulePolicy(rule), direction: getSecurityRuleDirection(rule)}
+		if _, ok := policyNewRules[key]; !ok {
+			policies = append(policies, key)
+		}
+		policyNewRules[key] = append(policyNewRules[key], rule)
+	}
 
-		// update priority for new rules.
-		rulePriority = getUnusedPriority(existingRulePriority, rulePriority)
-		rule.Properties.Priority = to.Int32Ptr(rulePriority)
-		ruleName := fmt.Sprintf("%v-%v", rulePriority, *rule.Properties.Direction)
-		rule.Name = &ruleName
-
-		rules = append(rules, rule)
-		rulePriority++
+	rulePriority := int32(ruleStartPriority)
+	for _, key := range policies {
+		policyPriority := rulePriority
+		if existingPriority, ok := policyRulePriority[key]; ok && existingPriority >= policyPriority {
+			policyPriority = existingPriority + 1
+		}
+		directionRulePriority := getExistingRulePriority(key.direction)
+		for _, rule := range policyNewRules[key] {
+			// update priority for new rules.
+			policyPriority = getUnusedPriority(directionRulePriority, policyPriority)
+			rule.Properties.Priority = to.Int32Ptr(policyPriority)
+			ruleName := fmt.Sprintf("%v-%v", policyPriority, key.direction)
+			rule.Name = &ruleName
+			directionRulePriority[policyPriority] = struct{}{}
+
+			rules = append(rules, rule)
+			policyPriority++
+		}
 	}
 
 	return rules
 }
 
-// addDefaultDenyRule adds vnet to vnet deny all rule to ingress and egress rule list.
-func addDefaultDenyRule(ingressRules, egressRules []*armnetwork.SecurityRule) (
+// getSecurityRuleDirection returns the direction of a security rule, inbound when not set.
+func getSecurityRuleDirection(rule *armnetwork.SecurityRule) armnetwork.SecurityRuleDirection {
+	if rule.Properties.Direction == nil {
+		return armnetwork.SecurityRuleDirectionInbound
+	}
+	return *rule.Properties.Direction
+}
+
+// isDefaultDenyRule returns true if the rule is a vnet to vnet deny all rule added by nephe, either at the priority
+// floor or, based on its description, after the allow rules.
+func isDefaultDenyRule(rule *armnetwork.SecurityRule) bool {
+	if rule.Properties.Priority != nil && *rule.Properties.Priority == vnetToVnetDenyRulePriority {
+		return true
+	}
+	return rule.Properties.Access != nil && *rule.Properties.Access == armnetwork.SecurityRuleAccessDeny &&
+		rule.Properties.Description != nil && *rule.Properties.Description == getDefaultDenyRuleName()
+}
+
+// getDefaultDenyRulePriority returns the priority of the default deny rule of a rule list based on placement. Rules
+// are placed after the lowest priority Nephe rule of the list for DenyRulePlacementAfterAllowRules, and at the
+// priority floor otherwise.
+func getDefaultDenyRulePriority(rules []*armnetwork.SecurityRule, placement crdv1alpha1.DenyRulePlacement) int32 {
+	if placement != crdv1alpha1.DenyRulePlacementAfterAllowRules {
+		return vnetToVnetDenyRulePriority
+	}
+	priority := int32(ruleStartPriority)
+	for _, rule := range rules {
+		if rule == nil || rule.Properties == nil || rule.Properties.Priority == nil {
+			continue
+		}
+		if *rule.Properties.Priority >= priority {
+			priority = *rule.Properties.Priority + 1
+		}
+	}
+	if priority > vnetToVnetDenyRulePriority {
+		return vnetToVnetDenyRulePriority
+	}
+	return priority
+}
+
+// addDefaultDenyRule adds vnet to vnet deny all rule to ingress and egress rule list, with priorities based on
+// placement.
+func addDefaultDenyRule(ingressRules, egressRules []*armnetwork.SecurityRule, placement crdv1alpha1.DenyRulePlacement) (
 	[]*armnetwork.SecurityRule, []*armnetwork.SecurityRule) {
-	ingressDeny := buildSecurityRule(to.Int32Ptr(vnetToVnetDenyRulePriority), armnetwork.SecurityRuleProtocolAsterisk,
+	ingressPriority := getDefaultDenyRulePriority(ingressRules, placement)
+	ingressDeny := buildSecurityRule(to.Int32Ptr(ingressPriority), armnetwork.SecurityRuleProtocolAsterisk,
 		armnetwork.SecurityRuleDirectionInbound, to.StringPtr(emptyPort), to.StringPtr(virtualnetworkAddressPrefix), nil, nil,
 		to.StringPtr(emptyPort), to.StringPtr(virtualnetworkAddressPrefix), nil, nil, to.StringPtr(getDefaultDenyRuleName()),
 		armnetwork.SecurityRuleAccessDeny)
 	ingressRules = append(ingressRules, &ingressDeny)
 
-	egressDeny := buildSecurityRule(to.Int32Ptr(vnetToVnetDenyRulePriority), armnetwork.SecurityRuleProtocolAsterisk,
+	egressPriority := getDefaultDenyRulePriority(egressRules, placement)
+	egressDeny := buildSecurityRule(to.Int32Ptr(egressPriority), armnetwork.SecurityRuleProtocolAsterisk,
 		armnetwork.SecurityRuleDirectionOutbound, to.StringPtr(emptyPort), to.StringPtr(virtualnetworkAddressPrefix), nil, nil,
 		to.StringPtr(emptyPort), to.StringPtr(virtualnetworkAddressPrefix), nil, nil, to.StringPtr(getDefaultDenyRuleName()),
 		armnetwork.SecurityRuleAccessDeny)
@@ -152,7 +330,8 @@ func addDefaultDenyRule(ingressRules, egressRules []*armnetwork.SecurityRule) (
 // convertIngressToNsgSecurityRules converts ingress rules from securitygroup.CloudRule to azure rules.
 func convertIngressToNsgSecurityRules(appliedToGroupID *cloudresource.CloudResourceID, rules []*cloudresource.CloudRule,
 	agAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup,
-	atAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup) ([]*armnetwork.SecurityRule, error) {
+	atAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup,
+	remoteGroupAddressPrefixes map[string][]*net.IPNet) ([]*armnetwork.SecurityRule, error) {
 	var securityRules []*armnetwork.SecurityRule
 
 	asg, found := atAsgMapByNepheControllerName[strings.ToLower(appliedToGroupID.Name)]
@@ -167,7 +346,10 @@ func convertIngressToNsgSecurityRules(appliedToGroupID *cloudresource.CloudResou
 		if rule == nil {
 			continue
 		}
-		description, err := utils.GenerateCloudDescription(obj.NpNamespacedName)
+		fromSecurityGroups, fromSrcIP := resolveRemoteVnetSecurityGroups(rule.FromSecurityGroups, rule.FromSrcIP,
+			remoteGroupAddressPrefixes)
+		description, err := utils.GenerateCloudDescriptionWithAnnotations(obj.NpNamespacedName, obj.NpUID, rule.EnableLogging,
+			obj.Annotations)
 		if err != nil {
 			return []*armnetwork.SecurityRule{}, fmt.Errorf("unable to generate rule description, err: %v", err)
 		}
@@ -176,39 +358,40 @@ func convertIngressToNsgSecurityRules(appliedToGroupID *cloudresource.CloudResou
 			return []*armnetwork.SecurityRule{}, err
 		}
 
-		srcPort := convertToAzurePortRange(rule.FromPort)
+		srcPort := convertToAzurePortRange(rule.Protocol, rule.FromPort)
+		sourcePortRange := convertToAzureSourcePortRange(rule.Protocol, rule.SrcPort, rule.SrcEndPort)
 
-		if len(rule.FromSrcIP) != 0 || len(rule.FromSecurityGroups) == 0 {
-			srcAddrPrefix, srcAddrPrefixes := convertToAzureAddressPrefix(rule.FromSrcIP)
+		if len(fromSrcIP) != 0 || len(rule.FromSecurityGroups) == 0 {
+			srcAddrPrefix, srcAddrPrefixes := convertToAzureAddressPrefix(fromSrcIP)
 			if srcAddrPrefix != nil || srcAddrPrefixes != nil {
 				securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionInbound,
-					to.StringPtr(emptyPort), srcAddrPrefix, srcAddrPrefixes, nil,
+					&sourcePortRange, srcAddrPrefix, srcAddrPrefixes, nil,
 					&srcPort, nil, nil, []*armnetwork.ApplicationSecurityGroup{&dstAsgObj}, &description,
 					armnetwork.SecurityRuleAccessAllow)
 				securityRules = append(securityRules, &securityRule)
 			}
 		}
 
-		srcApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(rule.FromSecurityGroups, agAsgMapByNepheControllerName)
+		srcApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(fromSecurityGroups, agAsgMapByNepheControllerName)
 		if err != nil {
 			return []*armnetwork.SecurityRule{}, err
 		}
 		if len(srcApplicationSecurityGroups) != 0 {
 			securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionInbound,
-				to.StringPtr(emptyPort), nil, nil, srcApplicationSecurityGroups,
+				&sourcePortRange, nil, nil, srcApplicationSecurityGroups,
 				&srcPort, nil, nil, []*armnetwork.ApplicationSecurityGroup{&dstAsgObj}, &description,
 				armnetwork.SecurityRuleAccessAllow)
 			securityRules = append(securityRules, &securityRule)
 		}
 	}
 
-	return securityRules, nil
+	return splitSecurityRulesByAddressPrefixes(securityRules), nil
 }
 
 // convertIngressToPeerNsgSecurityRules converts ingress rules that require peering from securitygroup.CloudRule to azure rules.
 func convertIngressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudResourceID, rules []*cloudresource.CloudRule,
 	agAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup,
-	ruleIP *string) ([]*armnetwork.SecurityRule, error) {
+	ruleIP *string, remoteGroupAddressPrefixes map[string][]*net.IPNet) ([]*armnetwork.SecurityRule, error) {
 	var securityRules []*armnetwork.SecurityRule
 
 	for _, obj := range rules {
@@ -216,7 +399,10 @@ func convertIngressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudR
 		if rule == nil {
 			continue
 		}
-		description, err := utils.GenerateCloudDescription(obj.NpNamespacedName)
+		fromSecurityGroups, fromSrcIP := resolveRemoteVnetSecurityGroups(rule.FromSecurityGroups, rule.FromSrcIP,
+			remoteGroupAddressPrefixes)
+		description, err := utils.GenerateCloudDescriptionWithAnnotations(obj.NpNamespacedName, obj.NpUID, rule.EnableLogging,
+			obj.Annotations)
 		if err != nil {
 			return []*armnetwork.SecurityRule{}, fmt.Errorf("unable to generate rule description, err: %v", err)
 		}
@@ -225,28 +411,29 @@ func convertIngressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudR
 			return []*armnetwork.SecurityRule{}, err
 		}
 
-		srcPort := convertToAzurePortRange(rule.FromPort)
+		srcPort := convertToAzurePortRange(rule.Protocol, rule.FromPort)
+		sourcePortRange := convertToAzureSourcePortRange(rule.Protocol, rule.SrcPort, rule.SrcEndPort)
 
-		if len(rule.FromSrcIP) != 0 || len(rule.FromSecurityGroups) == 0 {
-			srcAddrPrefix, srcAddrPrefixes := convertToAzureAddressPrefix(rule.FromSrcIP)
+		if len(fromSrcIP) != 0 || len(rule.FromSecurityGroups) == 0 {
+			srcAddrPrefix, srcAddrPrefixes := convertToAzureAddressPrefix(fromSrcIP)
 			if srcAddrPrefix != nil || srcAddrPrefixes != nil {
 				securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionInbound,
-					to.StringPtr(emptyPort), srcAddrPrefix, srcAddrPrefixes, nil,
+					&sourcePortRange, srcAddrPrefix, srcAddrPrefixes, nil,
 					&srcPort, to.StringPtr(emptyPort), nil, nil, &description,
 					armnetwork.SecurityRuleAccessAllow)
 				securityRules = append(securityRules, &securityRule)
 			}
 		}
 		flag := 0
-		for _, fromSecurityGroup := range rule.FromSecurityGroups {
+		for _, fromSecurityGroup := range fromSecurityGroups {
 			if fromSecurityGroup.Vpc == appliedToGroupID.Vpc {
-				srcApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(rule.FromSecurityGroups, agAsgMapByNepheControllerName)
+				srcApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(fromSecurityGroups, agAsgMapByNepheControllerName)
 				if err != nil {
 					return []*armnetwork.SecurityRule{}, err
 				}
 				if len(srcApplicationSecurityGroups) != 0 {
 					securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionInbound,
-						to.StringPtr(emptyPort), nil, nil, srcApplicationSecurityGroups,
+						&sourcePortRange, nil, nil, srcApplicationSecurityGroups,
 						&srcPort, to.StringPtr(emptyPort), nil, nil, &description,
 						armnetwork.SecurityRuleAccessAllow)
 					securityRules = append(securityRules, &securityRule)
@@ -255,22 +442,24 @@ func convertIngressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudR
 				}
 			}
 		}
-		if flag == 0 {
+		// security groups of remote vnets resolved to address prefixes must not be widened to the peer address.
+		if flag == 0 && (len(fromSecurityGroups) != 0 || len(rule.FromSecurityGroups) == 0) {
 			securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionInbound,
-				to.StringPtr(emptyPort), ruleIP, nil, nil,
+				&sourcePortRange, ruleIP, nil, nil,
 				&srcPort, to.StringPtr(emptyPort), nil, nil, &description,
 				armnetwork.SecurityRuleAccessAllow)
 			securityRules = append(securityRules, &securityRule)
 		}
 	}
 
-	return securityRules, nil
+	return splitSecurityRulesByAddressPrefixes(securityRules), nil
 }
 
 // convertEgressToNsgSecurityRules converts egress rules from securitygroup.CloudRule to azure rules.
 func convertEgressToNsgSecurityRules(appliedToGroupID *cloudresource.CloudResourceID, rules []*cloudresource.CloudRule,
 	agAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup,
-	atAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup) ([]*armnetwork.SecurityRule, error) {
+	atAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup,
+	remoteGroupAddressPrefixes map[string][]*net.IPNet) ([]*armnetwork.SecurityRule, error) {
 	var securityRules []*armnetwork.SecurityRule
 
 	asg, found := atAsgMapByNepheControllerName[strings.ToLower(appliedToGroupID.Name)]
@@ -285,7 +474,10 @@ func convertEgressToNsgSecurityRules(appliedToGroupID *cloudresource.CloudResour
 		if rule == nil {
 			continue
 		}
-		description, err := utils.GenerateCloudDescription(obj.NpNamespacedName)
+		toSecurityGroups, toDstIP := resolveRemoteVnetSecurityGroups(rule.ToSecurityGroups, rule.ToDstIP,
+			remoteGroupAddressPrefixes)
+		description, err := utils.GenerateCloudDescriptionWithAnnotations(obj.NpNamespacedName, obj.NpUID, rule.EnableLogging,
+			obj.Annotations)
 		if err != nil {
 			return []*armnetwork.SecurityRule{}, fmt.Errorf("unable to generate rule description, err: %v", err)
 		}
@@ -294,37 +486,38 @@ func convertEgressToNsgSecurityRules(appliedToGroupID *cloudresource.CloudResour
 			return []*armnetwork.SecurityRule{}, err
 		}
 
-		dstPort := convertToAzurePortRange(rule.ToPort)
+		dstPort := convertToAzurePortRange(rule.Protocol, rule.ToPort)
+		sourcePortRange := convertToAzureSourcePortRange(rule.Protocol, rule.SrcPort, rule.SrcEndPort)
 
-		if len(rule.ToDstIP) != 0 || len(rule.ToSecurityGroups) == 0 {
-			dstAddrPrefix, dstAddrPrefixes := convertToAzureAddressPrefix(rule.ToDstIP)
+		if len(toDstIP) != 0 || len(rule.ToSecurityGroups) == 0 {
+			dstAddrPrefix, dstAddrPrefixes := convertToAzureAddressPrefix(toDstIP)
 			if dstAddrPrefix != nil || dstAddrPrefixes != nil {
 				securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionOutbound,
-					to.StringPtr(emptyPort), nil, nil, []*armnetwork.ApplicationSecurityGroup{&srcAsgObj},
+					&sourcePortRange, nil, nil, []*armnetwork.ApplicationSecurityGroup{&srcAsgObj},
 					&dstPort, dstAddrPrefix, dstAddrPrefixes, nil, &description, armnetwork.SecurityRuleAccessAllow)
 				securityRules = append(securityRules, &securityRule)
 			}
 		}
 
-		dstApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(rule.ToSecurityGroups, agAsgMapByNepheControllerName)
+		dstApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(toSecurityGroups, agAsgMapByNepheControllerName)
 		if err != nil {
 			return []*armnetwork.SecurityRule{}, err
 		}
 		if len(dstApplicationSecurityGroups) != 0 {
 			securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionOutbound,
-				to.StringPtr(emptyPort), nil, nil, []*armnetwork.ApplicationSecurityGroup{&srcAsgObj},
+				&sourcePortRange, nil, nil, []*armnetwork.ApplicationSecurityGroup{&srcAsgObj},
 				&dstPort, nil, nil, dstApplicationSecurityGroups, &description, armnetwork.SecurityRuleAccessAllow)
 			securityRules = append(securityRules, &securityRule)
 		}
 	}
 
-	return securityRules, nil
+	return splitSecurityRulesByAddressPrefixes(securityRules), nil
 }
 
 // convertEgressToPeerNsgSecurityRules converts egress rules that require peering from securitygroup.CloudRule to azure rules.
 func convertEgressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudResourceID, rules []*cloudresource.CloudRule,
 	agAsgMapByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup,
-	ruleIP *string) ([]*armnetwork.SecurityRule, error) {
+	ruleIP *string, remoteGroupAddressPrefixes map[string][]*net.IPNet) ([]*armnetwork.SecurityRule, error) {
 	var securityRules []*armnetwork.SecurityRule
 
 	for _, obj := range rules {
@@ -332,7 +525,10 @@ func convertEgressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudRe
 		if rule == nil {
 			continue
 		}
-		description, err := utils.GenerateCloudDescription(obj.NpNamespacedName)
+		toSecurityGroups, toDstIP := resolveRemoteVnetSecurityGroups(rule.ToSecurityGroups, rule.ToDstIP,
+			remoteGroupAddressPrefixes)
+		description, err := utils.GenerateCloudDescriptionWithAnnotations(obj.NpNamespacedName, obj.NpUID, rule.EnableLogging,
+			obj.Annotations)
 		if err != nil {
 			return []*armnetwork.SecurityRule{}, fmt.Errorf("unable to generate rule description, err: %v", err)
 		}
@@ -341,27 +537,28 @@ func convertEgressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudRe
 			return []*armnetwork.SecurityRule{}, err
 		}
 
-		dstPort := convertToAzurePortRange(rule.ToPort)
+		dstPort := convertToAzurePortRange(rule.Protocol, rule.ToPort)
+		sourcePortRange := convertToAzureSourcePortRange(rule.Protocol, rule.SrcPort, rule.SrcEndPort)
 
-		if len(rule.ToDstIP) != 0 || len(rule.ToSecurityGroups) == 0 {
-			dstAddrPrefix, dstAddrPrefixes := convertToAzureAddressPrefix(rule.ToDstIP)
+		if len(toDstIP) != 0 || len(rule.ToSecurityGroups) == 0 {
+			dstAddrPrefix, dstAddrPrefixes := convertToAzureAddressPrefix(toDstIP)
 			if dstAddrPrefix != nil || dstAddrPrefixes != nil {
 				securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionOutbound,
-					to.StringPtr(emptyPort), to.StringPtr(emptyPort), nil, nil,
+					&sourcePortRange, to.StringPtr(emptyPort), nil, nil,
 					&dstPort, dstAddrPrefix, dstAddrPrefixes, nil, &description, armnetwork.SecurityRuleAccessAllow)
 				securityRules = append(securityRules, &securityRule)
 			}
 		}
 		flag := 0
-		for _, toSecurityGroup := range rule.ToSecurityGroups {
+		for _, toSecurityGroup := range toSecurityGroups {
 			if toSecurityGroup.Vpc == appliedToGroupID.Vpc {
-				dstApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(rule.ToSecurityGroups, agAsgMapByNepheControllerName)
+				dstApplicationSecurityGroups, err := convertToAzureApplicationSecurityGroups(toSecurityGroups, agAsgMapByNepheControllerName)
 				if err != nil {
 					return []*armnetwork.SecurityRule{}, err
 				}
 				if len(dstApplicationSecurityGroups) != 0 {
 					securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionOutbound,
-						to.StringPtr(emptyPort), to.StringPtr(emptyPort), nil, nil,
+						&sourcePortRange, to.StringPtr(emptyPort), nil, nil,
 						&dstPort, nil, nil, dstApplicationSecurityGroups, &description, armnetwork.SecurityRuleAccessAllow)
 					securityRules = append(securityRules, &securityRule)
 					flag = 1
@@ -369,15 +566,16 @@ func convertEgressToPeerNsgSecurityRules(appliedToGroupID *cloudresource.CloudRe
 				}
 			}
 		}
-		if flag == 0 {
+		// security groups of remote vnets resolved to address prefixes must not be widened to the peer address.
+		if flag == 0 && (len(toSecurityGroups) != 0 || len(rule.ToSecurityGroups) == 0) {
 			securityRule := buildSecurityRule(nil, protoName, armnetwork.SecurityRuleDirectionOutbound,
-				to.StringPtr(emptyPort), to.StringPtr(emptyPort), nil, nil,
+				&sourcePortRange, to.StringPtr(emptyPort), nil, nil,
 				&dstPort, ruleIP, nil, nil, &description, armnetwork.SecurityRuleAccessAllow)
 			securityRules = append(securityRules, &securityRule)
 		}
 	}
 
-	return securityRules, nil
+	return splitSecurityRulesByAddressPrefixes(securityRules), nil
 }
 
 // nolint:whitespace
@@ -413,6 +611,50 @@ func buildSecurityRule(rulePriority *int32, protoName armnetwork.SecurityRulePro
 	return securityRule
 }
 
+// splitSecurityRulesByAddressPrefixes splits rules with more source or destination address prefixes than
+// cloudresource.MaxRuleAddressPrefixes into multiple rules, each carrying a chunk of the prefixes along with the same
+// ports, ASGs and description. Prefixes are split in order, so the same rule always splits the same way.
+func splitSecurityRulesByAddressPrefixes(rules []*armnetwork.SecurityRule) []*armnetwork.SecurityRule {
+	maxPrefixes := cloudresource.MaxRuleAddressPrefixes
+	if maxPrefixes <= 0 {
+		return rules
+	}
+	var splitRules []*armnetwork.SecurityRule
+	for _, rule := range rules {
+		if len(rule.Properties.SourceAddressPrefixes) <= maxPrefixes &&
+			len(rule.Properties.DestinationAddressPrefixes) <= maxPrefixes {
+			splitRules = append(splitRules, rule)
+			continue
+		}
+		for _, srcAddrPrefixes := range chunkAddressPrefixes(rule.Properties.SourceAddressPrefixes, maxPrefixes) {
+			for _, dstAddrPrefixes := range chunkAddressPrefixes(rule.Properties.DestinationAddressPrefixes, maxPrefixes) {
+				property := *rule.Properties
+				property.SourceAddressPrefixes = srcAddrPrefixes
+				property.DestinationAddressPrefixes = dstAddrPrefixes
+				splitRules = append(splitRules, &armnetwork.SecurityRule{Name: rule.Name, Properties: &property})
+			}
+		}
+	}
+	return splitRules
+}
+
+// chunkAddressPrefixes splits address prefixes into chunks of at most size prefixes. An empty list yields a single
+// empty chunk.
+func chunkAddressPrefixes(prefixes []*string, size int) [][]*string {
+	if len(prefixes) == 0 {
+		return [][]*string{prefixes}
+	}
+	var chunks [][]*string
+	for start := 0; start < len(prefixes); start += size {
+		end := start + size
+		if end > len(prefixes) {
+			end = len(prefixes)
+		}
+		chunks = append(chunks, prefixes[start:end])
+	}
+	return chunks
+}
+
 // findSecurityRule finds the security rule in the given slice and return the index with boolean indicating found or not.
 func findSecurityRule(ruleList []*armnetwork.SecurityRule, rule *armnetwork.SecurityRule) (int, bool) {
 	for idx, newRule := range ruleList {
@@ -426,14 +668,17 @@ func findSecurityRule(ruleList []*armnetwork.SecurityRule, rule *armnetwork.Secu
 // normalizeAzureSecurityRule normalizes and ignores certain Azure rule properties, allowing easy comparison with Nephe rules.
 func normalizeAzureSecurityRule(rule *armnetwork.SecurityRule) *armnetwork.SecurityRule {
 	property := *rule.Properties
-	normalizedProtocolNum := azureProtoNameToNumMap[strings.ToLower(string(*rule.Properties.Protocol))]
-	normalizedProtocol := protoNumAzureNameMap[normalizedProtocolNum]
+	normalizedProtocol := *rule.Properties.Protocol
+	if protocolNum, err := utils.ProtocolFromAzure(normalizedProtocol); err == nil {
+		normalizedProtocol, _ = utils.ProtocolToAzure(protocolNum)
+	}
 
 	property.Protocol = &normalizedProtocol
 	property.Priority = nil
 	property.ProvisioningState = nil
 	property.SourcePortRanges = nil
 	property.DestinationPortRanges = nil
+	property.SourcePortRange = normalizeAzurePortRange(property.SourcePortRange)
 	if len(property.SourceAddressPrefixes) == 0 {
 		property.SourceAddressPrefixes = nil
 	}
@@ -444,6 +689,14 @@ func normalizeAzureSecurityRule(rule *armnetwork.SecurityRule) *armnetwork.Secur
 	return &armnetwork.SecurityRule{Properties: &property}
 }
 
+// normalizeAzurePortRange returns emptyPort for a port range covering every port.
+func normalizeAzurePortRange(portRange *string) *string {
+	if portRange != nil && *portRange == fullPortRange {
+		return to.StringPtr(emptyPort)
+	}
+	return portRange
+}
+
 // convertToAzureApplicationSecurityGroups converts Nephe security groups to Azure Asgs based on sg cloud resource id.
 func convertToAzureApplicationSecurityGroups(securityGroups []*cloudresource.CloudResourceID,
 	asgByNepheControllerName map[string]armnetwork.ApplicationSecurityGroup) ([]*armnetwork.ApplicationSecurityGroup, error) {
@@ -460,26 +713,65 @@ func convertToAzureApplicationSecurityGroups(securityGroups []*cloudresource.Clo
 	return asgsToReturn, nil
 }
 
+// convertToAzureProtocolName converts protocol number to Azure protocol name. A nil protocol number is any protocol.
 func convertToAzureProtocolName(protoNum *int) (armnetwork.SecurityRuleProtocol, error) {
 	if protoNum == nil {
 		return armnetwork.SecurityRuleProtocolAsterisk, nil
 	}
 
-	protocolName, found := protoNumAzureNameMap[*protoNum]
-	if !found {
-		return "", fmt.Errorf("unsupported protocol number %v", *protoNum)
+	return utils.ProtocolToAzure(*protoNum)
+}
+
+// resolveRemoteVnetSecurityGroups replaces security groups of vnets other than the appliedTo vnet by their address
+// prefixes in remoteGroupAddressPrefixes, and appends them to ips. Application security groups cannot be referenced
+// across vnets.
+func resolveRemoteVnetSecurityGroups(securityGroups []*cloudresource.CloudResourceID, ips []*net.IPNet,
+	remoteGroupAddressPrefixes map[string][]*net.IPNet) ([]*cloudresource.CloudResourceID, []*net.IPNet) {
+	if len(remoteGroupAddressPrefixes) == 0 {
+		return securityGroups, ips
 	}
 
-	return protocolName, nil
+	var localSecurityGroups []*cloudresource.CloudResourceID
+	var peerIPs []*net.IPNet
+	resolvedGroups := make(map[string]struct{})
+	for _, sg := range securityGroups {
+		key := getRemoteGroupKey(sg)
+		prefixes, found := remoteGroupAddressPrefixes[key]
+		if !found {
+			localSecurityGroups = append(localSecurityGroups, sg)
+			continue
+		}
+		if _, resolved := resolvedGroups[key]; !resolved {
+			resolvedGroups[key] = struct{}{}
+			peerIPs = append(peerIPs, prefixes...)
+		}
+	}
+	if len(peerIPs) == 0 {
+		return localSecurityGroups, ips
+	}
+	return localSecurityGroups, append(append([]*net.IPNet{}, ips...), peerIPs...)
 }
 
-func convertToAzurePortRange(port *int) string {
-	if port == nil {
+// convertToAzurePortRange converts port to Azure port range. Port is ignored when protocol is nil, i.e. any protocol.
+func convertToAzurePortRange(protoNum *int, port *int) string {
+	if protoNum == nil || port == nil {
 		return emptyPort
 	}
 	return strconv.Itoa(*port)
 }
 
+// convertToAzureSourcePortRange converts source port range to Azure port range, any source port when port is nil or
+// the range covers every port.
+func convertToAzureSourcePortRange(protoNum *int, port *int, endPort *int) string {
+	if endPort == nil || port == nil || *endPort == *port {
+		return convertToAzurePortRange(protoNum, port)
+	}
+	if protoNum == nil || (*port <= minPort && *endPort >= maxPort) {
+		return emptyPort
+	}
+	return fmt.Sprintf("%d-%d", *port, *endPort)
+}
+
 func convertToAzureAddressPrefix(ruleIPs []*net.IPNet) (*string, []*string) {
 	var prefixes []*string
 	for _, ip := range ruleIPs {
@@ -505,7 +797,7 @@ func convertToCloudRulesByAppliedToSGName(azureSecurityRules []*armnetwork.Secur
 	nepheControllerATSgNameToEgressRules := make(map[string][]cloudresource.CloudRule)
 	removeUserRules := false
 	for _, azureSecurityRule := range azureSecurityRules {
-		if azureSecurityRule.Properties == nil || *azureSecurityRule.Properties.Priority == vnetToVnetDenyRulePriority {
+		if azureSecurityRule.Properties == nil || isDefaultDenyRule(azureSecurityRule) {
 			continue
 		}
 
@@ -522,6 +814,10 @@ func convertToCloudRulesByAppliedToSGName(azureSecurityRules []*armnetwork.Secur
 
 		// Nephe rule has correct description.
 		desc, ok := utils.ExtractCloudDescription(azureSecurityRule.Properties.Description)
+		// allow-list rules are not owned by any network policy, they are rebuilt on each rule update.
+		if ok && isEgressAllowListRule(azureSecurityRule) {
+			continue
+		}
 		if !ok {
 			removeUserRules = removeUserRules || isInNephePriorityRange
 			// Skip converting user rule that is in Nephe priority range, as they will be removed.
@@ -576,7 +872,11 @@ func convertFromAzureIngressSecurityRuleToCloudRule(rule armnetwork.SecurityRule
 	desc *cloudresource.CloudRuleDescription) ([]cloudresource.CloudRule, error) {
 	ingressList := make([]cloudresource.CloudRule, 0)
 
-	port := convertFromAzurePortToNepheControllerPort(rule.Properties.DestinationPortRange)
+	port, err := convertFromAzureDestinationPortRangeToNepheControllerPort(rule.Properties.DestinationPortRange)
+	if err != nil {
+		return nil, err
+	}
+	srcPort, srcEndPort := convertFromAzurePortRangeToNepheControllerPorts(rule.Properties.SourcePortRange)
 	srcIP := convertFromAzurePrefixesToNepheControllerIPs(rule.Properties.SourceAddressPrefix, rule.Properties.SourceAddressPrefixes)
 	securityGroups := convertFromAzureASGsToNepheControllerSecurityGroups(rule.Properties.SourceApplicationSecurityGroups, vnetID)
 	protoNum, err := convertFromAzureProtocolToNepheControllerProtocol(rule.Properties.Protocol)
@@ -587,14 +887,19 @@ func convertFromAzureIngressSecurityRuleToCloudRule(rule armnetwork.SecurityRule
 	for _, ip := range srcIP {
 		ingressRule := cloudresource.CloudRule{
 			Rule: &cloudresource.IngressRule{
-				FromPort:  port,
-				FromSrcIP: []*net.IPNet{ip},
-				Protocol:  protoNum,
+				FromPort:   port,
+				FromSrcIP:  []*net.IPNet{ip},
+				Protocol:   protoNum,
+				SrcPort:    srcPort,
+				SrcEndPort: srcEndPort,
 			},
 			AppliedToGrp: sgID,
 		}
 		if desc != nil {
 			ingressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+			ingressRule.NpUID = desc.UID
+			ingressRule.Annotations = desc.Annotations
+			ingressRule.Rule.(*cloudresource.IngressRule).EnableLogging = desc.Logging
 		}
 		ingressRule.Hash = ingressRule.GetHash()
 		ingressList = append(ingressList, ingressRule)
@@ -605,11 +910,16 @@ func convertFromAzureIngressSecurityRuleToCloudRule(rule armnetwork.SecurityRule
 				FromPort:           port,
 				FromSecurityGroups: []*cloudresource.CloudResourceID{sg},
 				Protocol:           protoNum,
+				SrcPort:            srcPort,
+				SrcEndPort:         srcEndPort,
 			},
 			AppliedToGrp: sgID,
 		}
 		if desc != nil {
 			ingressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+			ingressRule.NpUID = desc.UID
+			ingressRule.Annotations = desc.Annotations
+			ingressRule.Rule.(*cloudresource.IngressRule).EnableLogging = desc.Logging
 		}
 		ingressRule.Hash = ingressRule.GetHash()
 		ingressList = append(ingressList, ingressRule)
@@ -623,7 +933,11 @@ func convertFromAzureEgressSecurityRuleToCloudRule(rule armnetwork.SecurityRule,
 	desc *cloudresource.CloudRuleDescription) ([]cloudresource.CloudRule, error) {
 	egressList := make([]cloudresource.CloudRule, 0)
 
-	port := convertFromAzurePortToNepheControllerPort(rule.Properties.DestinationPortRange)
+	port, err := convertFromAzureDestinationPortRangeToNepheControllerPort(rule.Properties.DestinationPortRange)
+	if err != nil {
+		return nil, err
+	}
+	srcPort, srcEndPort := convertFromAzurePortRangeToNepheControllerPorts(rule.Properties.SourcePortRange)
 	dstIP := convertFromAzurePrefixesToNepheControllerIPs(rule.Properties.DestinationAddressPrefix, rule.Properties.DestinationAddressPrefixes)
 	securityGroups := convertFromAzureASGsToNepheControllerSecurityGroups(rule.Properties.DestinationApplicationSecurityGroups, vnetID)
 	protoNum, err := convertFromAzureProtocolToNepheControllerProtocol(rule.Properties.Protocol)
@@ -634,14 +948,19 @@ func convertFromAzureEgressSecurityRuleToCloudRule(rule armnetwork.SecurityRule,
 	for _, ip := range dstIP {
 		egressRule := cloudresource.CloudRule{
 			Rule: &cloudresource.EgressRule{
-				ToPort:   port,
-				ToDstIP:  []*net.IPNet{ip},
-				Protocol: protoNum,
+				ToPort:     port,
+				ToDstIP:    []*net.IPNet{ip},
+				Protocol:   protoNum,
+				SrcPort:    srcPort,
+				SrcEndPort: srcEndPort,
 			},
 			AppliedToGrp: sgID,
 		}
 		if desc != nil {
 			egressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+			egressRule.NpUID = desc.UID
+			egressRule.Annotations = desc.Annotations
+			egressRule.Rule.(*cloudresource.EgressRule).EnableLogging = desc.Logging
 		}
 		egressRule.Hash = egressRule.GetHash()
 		egressList = append(egressList, egressRule)
@@ -652,11 +971,16 @@ func convertFromAzureEgressSecurityRuleToCloudRule(rule armnetwork.SecurityRule,
 				ToPort:           port,
 				ToSecurityGroups: []*cloudresource.CloudResourceID{sg},
 				Protocol:         protoNum,
+				SrcPort:          srcPort,
+				SrcEndPort:       srcEndPort,
 			},
 			AppliedToGrp: sgID,
 		}
 		if desc != nil {
 			egressRule.NpNamespacedName = types.NamespacedName{Name: desc.Name, Namespace: desc.Namespace}.String()
+			egressRule.NpUID = desc.UID
+			egressRule.Annotations = desc.Annotations
+			egressRule.Rule.(*cloudresource.EgressRule).EnableLogging = desc.Logging
 		}
 		egressRule.Hash = egressRule.GetHash()
 		egressList = append(egressList, egressRule)
@@ -670,11 +994,9 @@ func convertFromAzureProtocolToNepheControllerProtocol(azureProtoName *armnetwor
 		return nil, nil
 	}
 
-	// out-of-band modify on Azure rules will cause the protocol name change, not matching Azure own constants, so lowercase is needed.
-	// e.g. Tcp will change to TCP after out-of-band modify, even if protocol is not touched at all.
-	protocolNum, found := azureProtoNameToNumMap[strings.ToLower(string(*azureProtoName))]
-	if !found {
-		return nil, fmt.Errorf("unsupported azure protocol %v", *azureProtoName)
+	protocolNum, err := utils.ProtocolFromAzure(*azureProtoName)
+	if err != nil {
+		return nil, err
 	}
 
 	return &protocolNum, nil
@@ -739,3 +1061,28 @@ func convertFromAzurePortToNepheControllerPort(port *string) *int {
 	}
 	return to.IntPtr(int(portNum))
 }
+
+// convertFromAzureDestinationPortRangeToNepheControllerPort converts Azure destination port range into a port, nil for
+// any port. A range of several ports, other than every port, is not supported by Nephe rules.
+func convertFromAzureDestinationPortRangeToNepheControllerPort(portRange *string) (*int, error) {
+	port, endPort := convertFromAzurePortRangeToNepheControllerPorts(portRange)
+	if endPort != nil && (port == nil || *endPort != *port) {
+		return nil, fmt.Errorf("unsupported destination port range %v", *portRange)
+	}
+	return port, nil
+}
+
+// convertFromAzurePortRangeToNepheControllerPorts converts Azure port range into start and end port. End port is nil
+// for a single port, both are nil for any port.
+func convertFromAzurePortRangeToNepheControllerPorts(portRange *string) (*int, *int) {
+	portRange = normalizeAzurePortRange(portRange)
+	if portRange == nil {
+		return nil, nil
+	}
+	tokens := strings.SplitN(*portRange, "-", 2)
+	port := convertFromAzurePortToNepheControllerPort(&tokens[0])
+	if len(tokens) == 1 || port == nil {
+		return port, nil
+	}
+	return port, convertFromAzurePortToNepheControllerPort(&tokens[1])
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	armruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+)
+
+const (
+	permissionsAPIVersion    = "2022-04-01"
+	permissionsClientModule  = "nephe"
+	permissionsClientVersion = "v0.0.0"
+)
+
+var (
+	// inventoryActions are the actions required to read the cloud inventory.
+	inventoryActions = []string{
+		"Microsoft.ResourceGraph/resources/read",
+		"Microsoft.Compute/virtualMachines/read",
+		"Microsoft.Network/networkInterfaces/read",
+		"Microsoft.Network/virtualNetworks/read",
+	}
+	// securityActions are the actions required to program security rules with network and application security groups.
+	securityActions = []string{
+		"Microsoft.Network/networkSecurityGroups/read",
+		"Microsoft.Network/networkSecurityGroups/write",
+		"Microsoft.Network/networkSecurityGroups/delete",
+		"Microsoft.Network/networkSecurityGroups/join/action",
+		"Microsoft.Network/applicationSecurityGroups/read",
+		"Microsoft.Network/applicationSecurityGroups/write",
+		"Microsoft.Network/applicationSecurityGroups/delete",
+		"Microsoft.Network/applicationSecurityGroups/joinIpConfiguration/action",
+		"Microsoft.Network/networkInterfaces/write",
+	}
+)
+
+// permissions returns the client listing the permissions of the credentials on the subscription.
+func (p *azureServiceSdkConfigProvider) permissions(subscriptionID string) (azurePermissionsWrapper, error) {
+	host := cloud.AzurePublic.Services[cloud.ResourceManager].Endpoint
+	if c, ok := p.options.Cloud.Services[cloud.ResourceManager]; ok {
+		host = c.Endpoint
+	}
+	pl, err := armruntime.NewPipeline(permissionsClientModule, permissionsClientVersion, p.cred, runtime.PipelineOptions{},
+		p.options)
+	if err != nil {
+		return nil, err
+	}
+	return &azurePermissionsWrapperImpl{host: host, subscriptionID: subscriptionID, pl: pl}, nil
+}
+
+// GetPermissionProbe returns the probe of the permissions of the credentials on the resource groups of the vnets and
+// nics of the selected VMs, where security groups are programmed and attached, or on the subscription when no VM is
+// selected.
+func (computeCfg *computeServiceConfig) GetPermissionProbe() *internal.PermissionProbe {
+	client := computeCfg.permissionsAPIClient
+	resourceGroups := computeCfg.permissionResourceGroups
+	account := computeCfg.accountNamespacedName
+	return &internal.PermissionProbe{
+		Scopes: resourceGroups,
+		Probe: func(ctx context.Context) (*internal.MissingPermissions, error) {
+			return probePermissions(ctx, client, resourceGroups, account)
+		},
+	}
+}
+
+// probePermissions lists the permissions of the credentials on every resource group, or on the subscription when
+// there is none, and returns the inventory and security actions not granted on all of them.
+func probePermissions(ctx context.Context, client azurePermissionsWrapper, resourceGroups []string,
+	account types.NamespacedName) (*internal.MissingPermissions, error) {
+	scopes := resourceGroups
+	if len(scopes) == 0 {
+		scopes = []string{""}
+	}
+	var scopePermissions [][]azurePermission
+	for _, resourceGroup := range scopes {
+		permissions, err := client.list(ctx, resourceGroup)
+		if err != nil {
+			return nil, err
+		}
+		scopePermissions = append(scopePermissions, permissions)
+	}
+	missing := &internal.MissingPermissions{
+		Inventory: getMissingActions(scopePermissions, inventoryActions),
+		Security:  getMissingActions(scopePermissions, securityActions),
+	}
+	azurePluginLogger().V(1).Info("Probed credential permissions", "account", account,
+		"resourceGroups", resourceGroups, "missingInventory", missing.Inventory, "missingSecurity", missing.Security)
+	return missing, nil
+}
+
+// getPermissionResourceGroups returns the sorted lower case resource groups of resources.
+func getPermissionResourceGroups(resourceIDs map[string]struct{}) []string {
+	resourceGroupSet := make(map[string]struct{})
+	for resourceID := range resourceIDs {
+		if _, resourceGroup, _, err := extractFieldsFromAzureResourceID(resourceID); err == nil {
+			resourceGroupSet[strings.ToLower(resourceGroup)] = struct{}{}
+		}
+	}
+	var resourceGroups []string
+	for resourceGroup := range resourceGroupSet {
+		resourceGroups = append(resourceGroups, resourceGroup)
+	}
+	sort.Strings(resourceGroups)
+	return resourceGroups
+}
+
+// getMissingActions returns the actions not granted by the permissions of every scope.
+func getMissingActions(scopePermissions [][]azurePermission, actions []string) []string {
+	var missing []string
+	for _, action := range actions {
+		for _, permissions := range scopePermissions {
+			if !isActionPermitted(permissions, action) {
+				missing = append(missing, action)
+				break
+			}
+		}
+	}
+	return missing
+}
+
+// isActionPermitted returns true if a permission grants action, i.e. one of its actions matches action and none of
+// its notActions does.
+func isActionPermitted(permissions []azurePermission, action string) bool {
+	for _, permission := range permissions {
+		if matchAnyAction(permission.Actions, action) && !matchAnyAction(permission.NotActions, action) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyAction(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		if matchAction(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAction returns true if action matches pattern, case insensitively. A wildcard in pattern matches any sequence
+// of characters, e.g. Microsoft.Network/* or */read.
+func matchAction(pattern string, action string) bool {
+	parts := strings.Split(strings.ToLower(pattern), "*")
+	action = strings.ToLower(action)
+	if len(parts) == 1 {
+		return parts[0] == action
+	}
+	if !strings.HasPrefix(action, parts[0]) {
+		return false
+	}
+	action = action[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(action, part)
+		if idx < 0 {
+			return false
+		}
+		action = action[idx+len(part):]
+	}
+	return strings.HasSuffix(action, parts[len(parts)-1])
+}
@@ -15,14 +15,17 @@
 package azure
 
 import (
+	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
-func convertSelectorToComputeQuery(selector *crdv1alpha1.CloudEntitySelector, subscriptionIDs []string,
-	tenantIDs []string, locations []string) ([]*string, bool) {
+func convertSelectorToComputeQuery(selector *crdv1alpha1.CloudEntitySelector, inventoryFields []string,
+	subscriptionIDs []string, tenantIDs []string, locations []string) ([]*string, bool) {
 	if selector == nil {
 		return nil, false
 	}
@@ -30,7 +33,7 @@ func convertSelectorToComputeQuery(selector *crdv1alpha1.CloudEntitySelector, su
 		return nil, true
 	}
 
-	allQueryStrings, err := buildQueries(selector.Spec.VMSelector, subscriptionIDs, tenantIDs, locations)
+	allQueryStrings, err := buildQueries(selector.Spec.VMSelector, inventoryFields, subscriptionIDs, tenantIDs, locations)
 	if err != nil {
 		azurePluginLogger().Error(err, "selector conversion to query failed",
 			"selectorName", selector.Name, "selectorNamespace", selector.Namespace)
@@ -40,13 +43,14 @@ func convertSelectorToComputeQuery(selector *crdv1alpha1.CloudEntitySelector, su
 	return allQueryStrings, true
 }
 
-func buildQueries(vmSelector []crdv1alpha1.VirtualMachineSelector, subscriptionIDs []string, tenantIDs []string,
-	locations []string) ([]*string, error) {
+func buildQueries(vmSelector []crdv1alpha1.VirtualMachineSelector, inventoryFields []string, subscriptionIDs []string,
+	tenantIDs []string, locations []string) ([]*string, error) {
 	vpcIDsWithVpcIDOnlyMatches := make(map[string]struct{})
 	var vpcIDWithOtherMatches []crdv1alpha1.VirtualMachineSelector
 	var vmIDOnlyMatches []crdv1alpha1.EntityMatch
 	var vmIDAndVMNameMatches []crdv1alpha1.EntityMatch
 	var vmNameOnlyMatches []crdv1alpha1.EntityMatch
+	var attributeMatches []crdv1alpha1.VirtualMachineSelector
 
 	// vpcMatch contains VpcID and vmMatch contains nil:
 	// vpcIDsWithVpcIDOnlyMatches map contains the corresponding vmSelector section.
@@ -61,8 +65,16 @@ func buildQueries(vmSelector []crdv1alpha1.VirtualMachineSelector, subscriptionI
 	// vpcMatch contains nil and vmMatch contains only vmName:
 	// vmNameOnlyMatches slice contains the specific vmMatch section(EntityMatch).
 	// Azure query is created to match only vms matching the matchName.
+	// vmSelector contains attribute matches(e.g. tagMatch):
+	// attributeMatches slice contains the corresponding vmSelector section. As the attribute matches are ANDed with
+	// vpcMatch and vmMatch of the same vmSelector, a separate query is created for each such vmSelector section.
 
 	for _, match := range vmSelector {
+		if hasAttributeMatches(match) {
+			attributeMatches = append(attributeMatches, match)
+			continue
+		}
+
 		isVpcIDPresent := false
 
 		networkMatch := match.VpcMatch
@@ -121,46 +133,51 @@ func buildQueries(vmSelector []crdv1alpha1.VirtualMachineSelector, subscriptionI
 
 	azurePluginLogger().Info("Selector stats", "VpcIdOnlyMatch", len(vpcIDsWithVpcIDOnlyMatches),
 		"VpcIdWithOtherMatches", len(vpcIDWithOtherMatches), "VmIdOnlyMatches", len(vmIDOnlyMatches),
-		"VmIdAndVmNameMatches", len(vmIDAndVMNameMatches), "VmNameOnlyMatches", len(vmNameOnlyMatches))
+		"VmIdAndVmNameMatches", len(vmIDAndVMNameMatches), "VmNameOnlyMatches", len(vmNameOnlyMatches),
+		"AttributeMatches", len(attributeMatches))
 
 	var allQueries []*string
 
-	vpcIDOnlyQuery, err := buildQueryForVpcIDOnlyMatches(vpcIDsWithVpcIDOnlyMatches, subscriptionIDs, tenantIDs, locations)
+	vpcIDOnlyQuery, err := buildQueryForVpcIDOnlyMatches(vpcIDsWithVpcIDOnlyMatches, inventoryFields,
+		subscriptionIDs, tenantIDs, locations)
 	if err != nil {
 		return nil, err
 	}
-	if vpcIDOnlyQuery != nil {
-		allQueries = append(allQueries, vpcIDOnlyQuery)
-	}
+	allQueries = append(allQueries, vpcIDOnlyQuery...)
 
 	vpcIDWithOtherQuery, err := buildFilterForVpcIDWithOtherMatches(vpcIDWithOtherMatches, vpcIDsWithVpcIDOnlyMatches,
-		subscriptionIDs, tenantIDs, locations)
+		inventoryFields, subscriptionIDs, tenantIDs, locations)
 	if err != nil {
 		return nil, err
 	}
 	allQueries = append(allQueries, vpcIDWithOtherQuery...)
 
-	vmNameOnlyQuery, err := buildQueryForVMNameOnlyMatches(vmNameOnlyMatches, subscriptionIDs, tenantIDs, locations)
+	vmNameOnlyQuery, err := buildQueryForVMNameOnlyMatches(vmNameOnlyMatches, inventoryFields,
+		subscriptionIDs, tenantIDs, locations)
 	if err != nil {
 		return nil, err
 	}
-	if vmNameOnlyQuery != nil {
-		allQueries = append(allQueries, vmNameOnlyQuery)
-	}
+	allQueries = append(allQueries, vmNameOnlyQuery...)
 
-	vmIDOnlyQuery, err := buildQueryForVMIDOnlyMatches(vmIDOnlyMatches, subscriptionIDs, tenantIDs, locations)
+	vmIDOnlyQuery, err := buildQueryForVMIDOnlyMatches(vmIDOnlyMatches, inventoryFields,
+		subscriptionIDs, tenantIDs, locations)
 	if err != nil {
 		return nil, err
 	}
-	if vmIDOnlyQuery != nil {
-		allQueries = append(allQueries, vmIDOnlyQuery)
+	allQueries = append(allQueries, vmIDOnlyQuery...)
+
+	attributeMatchQueries, err := buildQueriesForAttributeMatches(attributeMatches, inventoryFields,
+		subscriptionIDs, tenantIDs, locations)
+	if err != nil {
+		return nil, err
 	}
+	allQueries = append(allQueries, attributeMatchQueries...)
 
 	return allQueries, nil
 }
 
-func buildQueryForVpcIDOnlyMatches(vpcIDsWithVpcIDOnlyMatches map[string]struct{}, subscriptionIDs []string, tenantIDs []string,
-	locations []string) (*string, error) {
+func buildQueryForVpcIDOnlyMatches(vpcIDsWithVpcIDOnlyMatches map[string]struct{}, inventoryFields []string,
+	subscriptionIDs []string, tenantIDs []string, locations []string) ([]*string, error) {
 	if len(vpcIDsWithVpcIDOnlyMatches) == 0 {
 		return nil, nil
 	}
@@ -175,11 +192,11 @@ func buildQueryForVpcIDOnlyMatches(vpcIDsWithVpcIDOnlyMatches map[string]struct{
 		return strings.Compare(vpcIDs[i], vpcIDs[j]) < 0
 	})
 
-	return getVMsByVnetIDsMatchQuery(vpcIDs, subscriptionIDs, tenantIDs, locations)
+	return getVMsByVnetIDsMatchQuery(vpcIDs, inventoryFields, subscriptionIDs, tenantIDs, locations)
 }
 
-func buildQueryForVMNameOnlyMatches(vmNameOnlyMatches []crdv1alpha1.EntityMatch, subscriptionIDs []string, tenantIDs []string,
-	locations []string) (*string, error) {
+func buildQueryForVMNameOnlyMatches(vmNameOnlyMatches []crdv1alpha1.EntityMatch, inventoryFields []string,
+	subscriptionIDs []string, tenantIDs []string, locations []string) ([]*string, error) {
 	if len(vmNameOnlyMatches) == 0 {
 		return nil, nil
 	}
@@ -194,11 +211,11 @@ func buildQueryForVMNameOnlyMatches(vmNameOnlyMatches []crdv1alpha1.EntityMatch,
 		return strings.Compare(vmNames[i], vmNames[j]) < 0
 	})
 
-	return getVMsByVMNamesMatchQuery(vmNames, subscriptionIDs, tenantIDs, locations)
+	return getVMsByVMNamesMatchQuery(vmNames, inventoryFields, subscriptionIDs, tenantIDs, locations)
 }
 
-func buildQueryForVMIDOnlyMatches(vmIDOnlyMatches []crdv1alpha1.EntityMatch, subscriptionIDs []string, tenantIDs []string,
-	locations []string) (*string, error) {
+func buildQueryForVMIDOnlyMatches(vmIDOnlyMatches []crdv1alpha1.EntityMatch, inventoryFields []string,
+	subscriptionIDs []string, tenantIDs []string, locations []string) ([]*string, error) {
 	if len(vmIDOnlyMatches) == 0 {
 		return nil, nil
 	}
@@ -213,12 +230,12 @@ func buildQueryForVMIDOnlyMatches(vmIDOnlyMatches []crdv1alpha1.EntityMatch, sub
 		return strings.Compare(vmIDs[i], vmIDs[j]) < 0
 	})
 
-	return getVMsByVMIDsMatchQuery(vmIDs, subscriptionIDs, tenantIDs, locations)
+	return getVMsByVMIDsMatchQuery(vmIDs, inventoryFields, subscriptionIDs, tenantIDs, locations)
 }
 
 func buildFilterForVpcIDWithOtherMatches(vpcIDWithOtherMatches []crdv1alpha1.VirtualMachineSelector,
-	vpcIDsWithVpcIDOnlyMatches map[string]struct{}, subscriptionIDs []string, tenantIDs []string,
-	locations []string) ([]*string, error) {
+	vpcIDsWithVpcIDOnlyMatches map[string]struct{}, inventoryFields []string, subscriptionIDs []string,
+	tenantIDs []string, locations []string) ([]*string, error) {
 	if len(vpcIDWithOtherMatches) == 0 {
 		return nil, nil
 	}
@@ -254,11 +271,186 @@ func buildFilterForVpcIDWithOtherMatches(vpcIDWithOtherMatches []crdv1alpha1.Vir
 			sort.Slice(vmNames, func(i, j int) bool {
 				return strings.Compare(vmNames[i], vmNames[j]) < 0
 			})
-			queryString, err := getVMsByVnetAndOtherMatchesQuery(vpcIDs, vmNames, vmIDs, subscriptionIDs, tenantIDs, locations)
+			queryStrings, err := getVMsByVnetAndOtherMatchesQuery(vpcIDs, vmNames, vmIDs, inventoryFields,
+				subscriptionIDs, tenantIDs, locations)
+			if err != nil {
+				return nil, err
+			}
+			allQueries = append(allQueries, queryStrings...)
+		}
+	}
+	return allQueries, nil
+}
+
+// hasAttributeMatches returns true if the vmSelector section has any match on VM attributes other than vpc and vm
+// identity.
+func hasAttributeMatches(match crdv1alpha1.VirtualMachineSelector) bool {
+	return len(match.TagMatch) > 0 || match.HasPublicIP || match.NsgMatch != nil ||
+		len(strings.TrimSpace(match.SizeMatch)) > 0 || match.ProvisionedOnly || len(strings.TrimSpace(match.CustomQueryFilter)) > 0 ||
+		match.ExtensionMatch != nil || len(strings.TrimSpace(match.OSFamilyMatch)) > 0 || match.SubnetMatch != nil ||
+		match.ModifiedWithinSeconds > 0 || match.EncryptionAtHostOnly || match.DataDiskMatch != nil ||
+		match.BootIntegrityMatch != nil || match.ExcludeLocked
+}
+
+// buildAttributeFilters converts attribute matches of a vmSelector section to KQL where clauses.
+func buildAttributeFilters(match crdv1alpha1.VirtualMachineSelector) ([]string, error) {
+	var filters []string
+	for _, tagMatch := range match.TagMatch {
+		key := strings.TrimSpace(tagMatch.Key)
+		if len(key) == 0 {
+			continue
+		}
+		if len(tagMatch.Value) == 0 {
+			filters = append(filters, fmt.Sprintf("| where isnotnull(tags[%v])", quoteKqlString(key)))
+		} else {
+			filters = append(filters, fmt.Sprintf("| where tostring(tags[%v]) == %v", quoteKqlString(key),
+				quoteKqlString(tagMatch.Value)))
+		}
+	}
+	if sizeMatch := strings.TrimSpace(match.SizeMatch); len(sizeMatch) > 0 {
+		filters = append(filters, buildSizeFilter(sizeMatch))
+	}
+	if match.ProvisionedOnly {
+		filters = append(filters, fmt.Sprintf("| where tostring(properties.provisioningState) in~ (%v, %v)",
+			quoteKqlString(provisioningStateSucceeded), quoteKqlString(provisioningStateUpdating)))
+	}
+	if osFamily := strings.TrimSpace(match.OSFamilyMatch); len(osFamily) > 0 {
+		filters = append(filters, fmt.Sprintf("| where tostring(properties.storageProfile.osDisk.osType) =~ %v",
+			quoteKqlString(osFamily)))
+	}
+	if match.ModifiedWithinSeconds > 0 {
+		// VMs without a last modification time are compared as null, and are not matched.
+		filters = append(filters, fmt.Sprintf("| where lastModifiedAt >= ago(%vs)", match.ModifiedWithinSeconds))
+	}
+	if match.EncryptionAtHostOnly {
+		// unset encryption at host is coalesced to false by the query.
+		filters = append(filters, "| where encryptionAtHost == true")
+	}
+	if match.DataDiskMatch != nil {
+		// VMs without data disks have a data disk count and size of 0.
+		if match.DataDiskMatch.MinCount > 0 {
+			filters = append(filters, fmt.Sprintf("| where dataDiskCount >= %v", match.DataDiskMatch.MinCount))
+		}
+		if match.DataDiskMatch.MinTotalSizeGB > 0 {
+			filters = append(filters, fmt.Sprintf("| where dataDiskSizeGB >= %v", match.DataDiskMatch.MinTotalSizeGB))
+		}
+	}
+	if match.BootIntegrityMatch != nil {
+		// unset UEFI settings of generation 1 VMs are coalesced to false by the query.
+		if match.BootIntegrityMatch.SecureBootEnabled != nil {
+			filters = append(filters, fmt.Sprintf("| where secureBootEnabled == %v", *match.BootIntegrityMatch.SecureBootEnabled))
+		}
+		if match.BootIntegrityMatch.VTPMEnabled != nil {
+			filters = append(filters, fmt.Sprintf("| where vTpmEnabled == %v", *match.BootIntegrityMatch.VTPMEnabled))
+		}
+	}
+	if customQueryFilter := strings.TrimSpace(match.CustomQueryFilter); len(customQueryFilter) > 0 {
+		// custom filter is validated by the webhook, validate again as it is injected into the query as is.
+		if err := utils.ValidateKqlPredicate(customQueryFilter); err != nil {
+			return nil, fmt.Errorf("invalid customQueryFilter %q: %w", customQueryFilter, err)
+		}
+		filters = append(filters, fmt.Sprintf("| where (%v)", customQueryFilter))
+	}
+	return filters, nil
+}
+
+// withFilteredInventoryFields returns inventoryFields along with the optional VM fields the attribute filters of the
+// vmSelector section are evaluated on, where nil selects all fields. A custom query filter may refer to any field.
+func withFilteredInventoryFields(inventoryFields []string, match crdv1alpha1.VirtualMachineSelector) []string {
+	if inventoryFields == nil || len(strings.TrimSpace(match.CustomQueryFilter)) > 0 {
+		return nil
+	}
+	fields := append([]string{}, inventoryFields...)
+	if match.ModifiedWithinSeconds > 0 {
+		fields = append(fields, "lastModifiedAt")
+	}
+	if match.EncryptionAtHostOnly {
+		fields = append(fields, "encryptionAtHost")
+	}
+	if match.DataDiskMatch != nil {
+		fields = append(fields, "dataDiskCount", "dataDiskSizeGB")
+	}
+	if match.BootIntegrityMatch != nil {
+		fields = append(fields, "secureBootEnabled", "vTpmEnabled")
+	}
+	return fields
+}
+
+// buildSizeFilter converts sizeMatch, which may be a glob pattern, to a KQL where clause on the VM size.
+// Exact sizes and prefix patterns are matched with =~ and startswith, other patterns with a case-insensitive regex.
+func buildSizeFilter(sizeMatch string) string {
+	const vmSize = "tostring(properties.hardwareProfile.vmSize)"
+	if !strings.ContainsAny(sizeMatch, "*?") {
+		return fmt.Sprintf("| where %v =~ %v", vmSize, quoteKqlString(sizeMatch))
+	}
+	prefix := strings.TrimSuffix(sizeMatch, "*")
+	if !strings.ContainsAny(prefix, "*?") {
+		return fmt.Sprintf("| where %v startswith %v", vmSize, quoteKqlString(prefix))
+	}
+
+	var pattern strings.Builder
+	for _, c := range sizeMatch {
+		switch c {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return fmt.Sprintf("| where %v matches regex %v", vmSize, quoteKqlString("(?i)^"+pattern.String()+"$"))
+}
+
+// quoteKqlString returns str as a single-quoted KQL string literal.
+func quoteKqlString(str string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(str) + "'"
+}
+
+func buildQueriesForAttributeMatches(attributeMatches []crdv1alpha1.VirtualMachineSelector, inventoryFields []string,
+	subscriptionIDs []string, tenantIDs []string, locations []string) ([]*string, error) {
+	var allQueries []*string
+	for _, match := range attributeMatches {
+		var vpcIDs []string
+		if match.VpcMatch != nil && len(strings.TrimSpace(match.VpcMatch.MatchID)) > 0 {
+			vpcIDs = append(vpcIDs, match.VpcMatch.MatchID)
+		}
+		var subnetIDs []string
+		if match.SubnetMatch != nil && len(strings.TrimSpace(match.SubnetMatch.MatchID)) > 0 {
+			subnetIDs = append(subnetIDs, match.SubnetMatch.MatchID)
+		}
+		filters, err := buildAttributeFilters(match)
+		if err != nil {
+			return nil, err
+		}
+		fields := withFilteredInventoryFields(inventoryFields, match)
+
+		if len(match.VMMatch) == 0 {
+			queryStrings, err := getVMsByAttributeMatchesQuery(vpcIDs, subnetIDs, nil, nil, filters, match.HasPublicIP,
+				match.NsgMatch, match.ExcludeLocked, match.ExtensionMatch, fields, subscriptionIDs, tenantIDs, locations)
+			if err != nil {
+				return nil, err
+			}
+			allQueries = append(allQueries, queryStrings...)
+			continue
+		}
+
+		// Build query for each vmMatch along with vpcMatch and attribute matches.
+		for _, vmMatch := range match.VMMatch {
+			var vmIDs []string
+			var vmNames []string
+			if len(strings.TrimSpace(vmMatch.MatchID)) > 0 {
+				vmIDs = append(vmIDs, vmMatch.MatchID)
+			}
+			if len(strings.TrimSpace(vmMatch.MatchName)) > 0 {
+				vmNames = append(vmNames, vmMatch.MatchName)
+			}
+			queryStrings, err := getVMsByAttributeMatchesQuery(vpcIDs, subnetIDs, vmNames, vmIDs, filters, match.HasPublicIP,
+				match.NsgMatch, match.ExcludeLocked, match.ExtensionMatch, fields, subscriptionIDs, tenantIDs, locations)
 			if err != nil {
 				return nil, err
 			}
-			allQueries = append(allQueries, queryString)
+			allQueries = append(allQueries, queryStrings...)
 		}
 	}
 	return allQueries, nil
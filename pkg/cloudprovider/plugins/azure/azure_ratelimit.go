@@ -0,0 +1,77 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+)
+
+const (
+	// rateLimitRemainingHeaderPrefix is the prefix of Azure Resource Manager headers carrying the remaining requests
+	// of a quota, e.g. x-ms-ratelimit-remaining-subscription-reads.
+	rateLimitRemainingHeaderPrefix = "x-ms-ratelimit-remaining-"
+	// resourceGraphQuotaRemainingHeader carries the remaining Azure Resource Graph queries of the caller.
+	resourceGraphQuotaRemainingHeader = "x-ms-user-quota-remaining"
+	resourceGraphQuotaName            = "resource-graph"
+	// rateLimitRemainingWarnThreshold is the remaining quota below which a warning is logged.
+	rateLimitRemainingWarnThreshold = 100
+)
+
+// rateLimitPolicy is an Azure SDK pipeline policy which records the remaining API quota reported in responses.
+type rateLimitPolicy struct {
+	account string
+}
+
+func (p *rateLimitPolicy) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	if resp != nil {
+		recordRateLimitRemaining(p.account, resp.Header)
+	}
+	return resp, err
+}
+
+// recordRateLimitRemaining updates the API quota of an account from the rate limit headers of a response, and warns
+// once a quota drops below rateLimitRemainingWarnThreshold.
+func recordRateLimitRemaining(account string, header http.Header) {
+	for name, values := range header {
+		var quota string
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, rateLimitRemainingHeaderPrefix) {
+			quota = strings.TrimPrefix(name, rateLimitRemainingHeaderPrefix)
+		} else if name == resourceGraphQuotaRemainingHeader {
+			quota = resourceGraphQuotaName
+		} else {
+			continue
+		}
+		if quota == "" || len(values) == 0 {
+			continue
+		}
+		remaining, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 64)
+		if err != nil {
+			continue
+		}
+		previous, found := internal.APIQuotaMetrics.Set(string(providerType), account, quota, remaining)
+		if remaining < rateLimitRemainingWarnThreshold && (!found || previous >= rateLimitRemainingWarnThreshold) {
+			azurePluginLogger().Info("Azure API quota is running low", "account", account, "quota", quota,
+				"remaining", remaining)
+		}
+	}
+}
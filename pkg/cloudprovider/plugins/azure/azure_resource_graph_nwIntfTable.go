@@ -16,6 +16,7 @@ package azure
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"text/template"
 
@@ -71,9 +72,9 @@ const (
 		"tostring(virtualMachineID), tostring(networkSecurityGroupID), tostring(vnetId)"
 )
 
-func getNetworkInterfaceTable(resourceGraphAPIClient azureResourceGraphWrapper, query *string,
-	subscriptions []*string) ([]*networkInterfaceTable, int64, error) {
-	data, count, err := invokeResourceGraphQuery(resourceGraphAPIClient, query, subscriptions)
+func getNetworkInterfaceTable(ctx context.Context, resourceGraphAPIClient azureResourceGraphWrapper, credentialIdentity string,
+	query *string, subscriptions []*string) ([]*networkInterfaceTable, int64, error) {
+	data, count, err := invokeResourceGraphQuery(ctx, resourceGraphAPIClient, credentialIdentity, query, subscriptions)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -16,10 +16,17 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	resourcegraph "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
 )
 
@@ -32,20 +39,192 @@ const (
 	vmIDsNotFoundErrorMsg           = "vm ID(s) required for the query"
 	vmNamesNotFoundErrorMsg         = "vm name(s) required for the query"
 	vmIDorNameNotFoundErrorMsg      = "vm ID(s) or name(s) required for the query"
+
+	// resourceGraphQueryCoalesceWindow is the duration for which a coalesced query result is shared.
+	resourceGraphQueryCoalesceWindow = 10 * time.Second
 )
 
-// resourceGraph returns resource-graph SDK apiClient.
+// resourceGraphQueryResult is the result of a resource graph query shared among accounts.
+type resourceGraphQueryResult struct {
+	done      chan struct{}
+	data      []interface{}
+	count     int64
+	err       error
+	expiresAt time.Time
+}
+
+// resourceGraphQueryCoalescer shares the result of a resource graph query among accounts issuing the same query on
+// the same set of subscriptions with the same credentials. Queries are compared after collapsing whitespace, and
+// subscriptions regardless of case and order. As queries are built from the subscription, region and selector,
+// accounts on the same subscription and region share one result per selector; queries built from different selectors
+// are not shared, even if they select the same resources. Results are never shared across credentials, which may be
+// granted access to different resources of the subscription, or be rejected. Concurrent queries wait for the
+// in-flight query, and completed results are shared within resourceGraphQueryCoalesceWindow.
+type resourceGraphQueryCoalescer struct {
+	mutex   sync.Mutex
+	results map[string]*resourceGraphQueryResult
+	now     func() time.Time
+}
+
+var queryCoalescer = newResourceGraphQueryCoalescer()
+
+func newResourceGraphQueryCoalescer() *resourceGraphQueryCoalescer {
+	return &resourceGraphQueryCoalescer{
+		results: make(map[string]*resourceGraphQueryResult),
+		now:     time.Now,
+	}
+}
+
+// do returns the shared result of the query identified by key, invoking query if there is none. Waiting for the
+// in-flight query is aborted when ctx is done, and the query is invoked again if the in-flight one was cancelled by
+// its own caller.
+func (q *resourceGraphQueryCoalescer) do(ctx context.Context, key string,
+	query func() ([]interface{}, int64, error)) ([]interface{}, int64, error) {
+	for {
+		data, count, retry, err := q.tryDo(ctx, key, query)
+		if !retry {
+			return data, count, err
+		}
+	}
+}
+
+// tryDo returns the shared result of the query identified by key, invoking query if there is none. It returns true if
+// the in-flight query waited for was cancelled while ctx is not done.
+func (q *resourceGraphQueryCoalescer) tryDo(ctx context.Context, key string,
+	query func() ([]interface{}, int64, error)) ([]interface{}, int64, bool, error) {
+	q.mutex.Lock()
+	for k, result := range q.results {
+		if result.isExpired(q.now()) {
+			delete(q.results, k)
+		}
+	}
+	result, found := q.results[key]
+	if !found {
+		result = &resourceGraphQueryResult{done: make(chan struct{})}
+		q.results[key] = result
+	}
+	q.mutex.Unlock()
+
+	if found {
+		select {
+		case <-result.done:
+		case <-ctx.Done():
+			return nil, 0, false, ctx.Err()
+		}
+		if isContextError(result.err) && ctx.Err() == nil {
+			return nil, 0, true, nil
+		}
+		return result.data, result.count, false, result.err
+	}
+
+	result.data, result.count, result.err = query()
+	q.mutex.Lock()
+	if result.err != nil {
+		// failed queries are not shared beyond the in-flight callers.
+		delete(q.results, key)
+	} else {
+		result.expiresAt = q.now().Add(resourceGraphQueryCoalesceWindow)
+	}
+	close(result.done)
+	q.mutex.Unlock()
+	return result.data, result.count, false, result.err
+}
+
+// isContextError returns true if the error is the result of a cancelled or timed out context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isExpired returns true if result is completed and not shared anymore. Must be called with mutex held.
+func (r *resourceGraphQueryResult) isExpired(now time.Time) bool {
+	return !r.expiresAt.IsZero() && now.After(r.expiresAt)
+}
+
+// resourceGraph returns resource-graph SDK apiClient. Queries fail over to the clients of the fallback endpoints, if
+// any.
 func (p *azureServiceSdkConfigProvider) resourceGraph() (azureResourceGraphWrapper, error) {
-	baseClient, err := resourcegraph.NewClient(p.cred, nil)
+	baseClient, err := resourcegraph.NewClient(p.cred, p.options)
 	if err != nil {
 		return nil, err
 	}
+	if len(p.fallbackOptions) == 0 {
+		return &azureResourceGraphWrapperImpl{resourceGraphAPIClient: baseClient}, nil
+	}
+
+	failover := &azureResourceGraphFailoverWrapper{
+		clients: []azureResourceGraphWrapper{&azureResourceGraphWrapperImpl{resourceGraphAPIClient: baseClient}},
+	}
+	for _, options := range p.fallbackOptions {
+		fallbackClient, err := resourcegraph.NewClient(p.cred, options)
+		if err != nil {
+			return nil, err
+		}
+		failover.clients = append(failover.clients, &azureResourceGraphWrapperImpl{resourceGraphAPIClient: fallbackClient})
+	}
+	return failover, nil
+}
+
+// azureResourceGraphFailoverWrapper sends resource graph queries to the first client, and to the following clients in
+// order when the previous one is unreachable. Errors returned by a reachable endpoint are not retried.
+type azureResourceGraphFailoverWrapper struct {
+	clients []azureResourceGraphWrapper
+}
+
+func (f *azureResourceGraphFailoverWrapper) resources(ctx context.Context,
+	query resourcegraph.QueryRequest) (result resourcegraph.ClientResourcesResponse, err error) {
+	for i, client := range f.clients {
+		result, err = client.resources(ctx, query)
+		if !isConnectivityError(err) {
+			return result, err
+		}
+		if i+1 < len(f.clients) {
+			azurePluginLogger().Info("Resource graph endpoint unreachable, trying fallback endpoint", "fallback", i+1,
+				"error", err)
+		}
+	}
+	return result, err
+}
+
+// isConnectivityError returns true if the error occurred before a response was received from the endpoint, other
+// than by cancellation of the query.
+func isConnectivityError(err error) bool {
+	var netErr net.Error
+	return err != nil && errors.As(err, &netErr) && !errors.Is(err, context.Canceled)
+}
+
+// invokeResourceGraphQuery invokes resource graph query, sharing its result with the accounts issuing the same query
+// with the same credentials, identified by credentialIdentity, when inventory queries are coalesced.
+func invokeResourceGraphQuery(ctx context.Context, resourceGraphAPIClient azureResourceGraphWrapper,
+	credentialIdentity string, query *string, subscriptions []*string) ([]interface{}, int64, error) {
+	if !cloudresource.CoalesceInventoryQueries {
+		return invokeResourceGraphQueryPages(ctx, resourceGraphAPIClient, query, subscriptions)
+	}
+
+	key := resourceGraphQueryKey(credentialIdentity, query, subscriptions)
+	return queryCoalescer.do(ctx, key, func() ([]interface{}, int64, error) {
+		return invokeResourceGraphQueryPages(ctx, resourceGraphAPIClient, query, subscriptions)
+	})
+}
+
+// resourceGraphQueryKey returns the key identifying the query among coalesced queries. Whitespace in the query is
+// collapsed, and subscriptions are compared regardless of case and order.
+func resourceGraphQueryKey(credentialIdentity string, query *string, subscriptions []*string) string {
+	subscriptionKeys := make([]string, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		subscriptionKeys = append(subscriptionKeys, strings.ToLower(*subscription))
+	}
+	sort.Strings(subscriptionKeys)
 
-	return &azureResourceGraphWrapperImpl{resourceGraphAPIClient: baseClient}, nil
+	keys := make([]string, 0, len(subscriptionKeys)+2)
+	keys = append(keys, credentialIdentity)
+	keys = append(keys, subscriptionKeys...)
+	keys = append(keys, strings.Join(strings.Fields(*query), " "))
+	return strings.Join(keys, "|")
 }
 
-func invokeResourceGraphQuery(resourceGraphAPIClient azureResourceGraphWrapper, query *string,
-	subscriptions []*string) ([]interface{}, int64, error) {
+// invokeResourceGraphQueryPages invokes resource graph query and fetches all pages of the response.
+func invokeResourceGraphQueryPages(ctx context.Context, resourceGraphAPIClient azureResourceGraphWrapper,
+	query *string, subscriptions []*string) ([]interface{}, int64, error) {
 	var data []interface{}
 	var currentRecords int64
 	var totalRecords int64 = math.MaxInt64
@@ -66,7 +245,7 @@ func invokeResourceGraphQuery(resourceGraphAPIClient azureResourceGraphWrapper,
 
 	// invoke resource graph API till all pages from response are fetched.
 	for currentRecords < totalRecords {
-		results, queryErr := resourceGraphAPIClient.resources(context.Background(), request)
+		results, queryErr := resourceGraphAPIClient.resources(ctx, request)
 		if queryErr == nil {
 			if results.Data != nil {
 				data = append(data, results.Data.([]interface{})...)
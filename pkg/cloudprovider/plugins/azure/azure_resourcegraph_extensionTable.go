@@ -0,0 +1,101 @@
+// Copyright 2022 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+type vmExtensionTable struct {
+	VMID       *string
+	Extensions []*string
+}
+
+type extensionTableQueryParameters struct {
+	SubscriptionIDs *string
+	VMIDs           *string
+}
+
+const (
+	// extensionTableQueryTemplate returns the lowercase names of the extensions installed on each of the given VMs,
+	// keyed by the lowercase VM ID.
+	extensionTableQueryTemplate = "Resources" +
+		"| where type =~ 'microsoft.compute/virtualmachines/extensions'" +
+		"| where tolower(subscriptionId) in ({{ .SubscriptionIDs }})" +
+		"| extend idArray = split(tolower(id), \"/\")" +
+		"| extend vmId = strcat_array(array_slice(idArray, 0, 8), \"/\")" +
+		"| where vmId in ({{ .VMIDs }})" +
+		"| summarize extensions = make_set(tostring(idArray[10])) by vmId"
+)
+
+func getVMExtensionTable(ctx context.Context, resourceGraphAPIClient azureResourceGraphWrapper, credentialIdentity string,
+	query *string, subscriptions []*string) ([]*vmExtensionTable, error) {
+	data, _, err := invokeResourceGraphQuery(ctx, resourceGraphAPIClient, credentialIdentity, query, subscriptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var vmExtensions []*vmExtensionTable
+	for _, vmExtensionRow := range data {
+		var vmExtension vmExtensionTable
+		err = mapstructure.Decode(vmExtensionRow, &vmExtension)
+		if err != nil {
+			return nil, err
+		}
+		vmExtensions = append(vmExtensions, &vmExtension)
+	}
+	return vmExtensions, nil
+}
+
+func getVMExtensionsByVMIDsQuery(subscriptionIDs []string, vmIDs []string) (*string, error) {
+	commaSeparatedSubscriptionIDs := convertStrSliceToLowercaseCommaSeparatedStr(subscriptionIDs)
+	if len(commaSeparatedSubscriptionIDs) == 0 {
+		return nil, fmt.Errorf(subscriptionIDsNotFoundErrorMsg)
+	}
+	commaSeparatedVMIDs := convertStrSliceToLowercaseCommaSeparatedStr(vmIDs)
+
+	queryParams := &extensionTableQueryParameters{
+		SubscriptionIDs: &commaSeparatedSubscriptionIDs,
+		VMIDs:           &commaSeparatedVMIDs,
+	}
+	var queryBuffer bytes.Buffer
+	extensionTemplate := template.Must(template.New("extensionTableQuery").Parse(extensionTableQueryTemplate))
+	if err := extensionTemplate.Execute(&queryBuffer, queryParams); err != nil {
+		return nil, err
+	}
+	queryString := queryBuffer.String()
+	return &queryString, nil
+}
+
+// matchesExtension returns true if the VM satisfies the extension match it is marked with, if any.
+func matchesExtension(vm *virtualMachineTable) bool {
+	if emptyString(vm.ExtensionMatchName) {
+		return true
+	}
+	hasExtension := false
+	for _, extension := range vm.Extensions {
+		if extension != nil && *extension == *vm.ExtensionMatchName {
+			hasExtension = true
+			break
+		}
+	}
+	matchMissing := vm.ExtensionMatchMissing != nil && *vm.ExtensionMatchMissing
+	return hasExtension != matchMissing
+}
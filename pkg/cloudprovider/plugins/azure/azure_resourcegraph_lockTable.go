@@ -0,0 +1,128 @@
+// Copyright 2022 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+type managementLockTable struct {
+	Scope *string
+}
+
+type lockTableQueryParameters struct {
+	SubscriptionIDs *string
+	Scopes          *string
+}
+
+const (
+	// lockTableQueryTemplate returns the distinct lowercase scopes among the given ones holding a management lock. The
+	// scope of a lock is the ID of the resource, resource group or subscription it is applied to.
+	lockTableQueryTemplate = "Resources" +
+		"| where type =~ 'microsoft.authorization/locks'" +
+		"| where tolower(subscriptionId) in ({{ .SubscriptionIDs }})" +
+		"| project scope = tostring(split(tolower(id), '/providers/microsoft.authorization/locks/')[0])" +
+		"| where scope in ({{ .Scopes }})" +
+		"| distinct scope"
+)
+
+func getManagementLockTable(ctx context.Context, resourceGraphAPIClient azureResourceGraphWrapper,
+	credentialIdentity string, query *string, subscriptions []*string) ([]*managementLockTable, error) {
+	data, _, err := invokeResourceGraphQuery(ctx, resourceGraphAPIClient, credentialIdentity, query, subscriptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []*managementLockTable
+	for _, lockRow := range data {
+		var lock managementLockTable
+		err = mapstructure.Decode(lockRow, &lock)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, &lock)
+	}
+	return locks, nil
+}
+
+func getManagementLocksByScopesQuery(subscriptionIDs []string, scopes []string) (*string, error) {
+	commaSeparatedSubscriptionIDs := convertStrSliceToLowercaseCommaSeparatedStr(subscriptionIDs)
+	if len(commaSeparatedSubscriptionIDs) == 0 {
+		return nil, fmt.Errorf(subscriptionIDsNotFoundErrorMsg)
+	}
+	commaSeparatedScopes := convertStrSliceToLowercaseCommaSeparatedStr(scopes)
+
+	queryParams := &lockTableQueryParameters{
+		SubscriptionIDs: &commaSeparatedSubscriptionIDs,
+		Scopes:          &commaSeparatedScopes,
+	}
+	var queryBuffer bytes.Buffer
+	lockTemplate := template.Must(template.New("lockTableQuery").Parse(lockTableQueryTemplate))
+	if err := lockTemplate.Execute(&queryBuffer, queryParams); err != nil {
+		return nil, err
+	}
+	queryString := queryBuffer.String()
+	return &queryString, nil
+}
+
+// getLockScopes returns the scopes whose management locks apply to the given resource, i.e. the resource itself, its
+// resource group and its subscription.
+func getLockScopes(resourceID string) []string {
+	resourceID = strings.ToLower(resourceID)
+	tokens := strings.Split(resourceID, "/")
+	scopes := []string{resourceID}
+	// resource IDs are of the form /subscriptions/<id>/resourcegroups/<name>/providers/...
+	if len(tokens) > 5 {
+		scopes = append(scopes, strings.Join(tokens[:5], "/"))
+	}
+	if len(tokens) > 3 {
+		scopes = append(scopes, strings.Join(tokens[:3], "/"))
+	}
+	return scopes
+}
+
+// getVirtualMachineLockScopes returns the scopes whose management locks apply to the VM, or to any network interface or
+// network security group of the VM, since the security enforcement of the VM modifies them.
+func getVirtualMachineLockScopes(vm *virtualMachineTable) []string {
+	resourceIDs := []*string{vm.ID}
+	for _, nwIntf := range vm.NetworkInterfaces {
+		resourceIDs = append(resourceIDs, nwIntf.ID)
+		resourceIDs = append(resourceIDs, nwIntf.NsgIDs...)
+	}
+	var scopes []string
+	for _, resourceID := range resourceIDs {
+		if !emptyString(resourceID) {
+			scopes = append(scopes, getLockScopes(*resourceID)...)
+		}
+	}
+	return scopes
+}
+
+// isVirtualMachineLocked returns true if a management lock applies to the VM, or to any network interface or network
+// security group of the VM.
+func isVirtualMachineLocked(vm *virtualMachineTable, lockScopes map[string]struct{}) bool {
+	for _, scope := range getVirtualMachineLockScopes(vm) {
+		if _, ok := lockScopes[scope]; ok {
+			return true
+		}
+	}
+	return false
+}
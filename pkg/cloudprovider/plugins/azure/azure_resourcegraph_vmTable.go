@@ -16,13 +16,18 @@ package azure
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"text/template"
 	"time"
 
 	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/mitchellh/mapstructure"
+
+	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
 type virtualMachineTable struct {
@@ -33,6 +38,26 @@ type virtualMachineTable struct {
 	Tags              map[string]*string
 	Status            *string
 	VnetID            *string
+	CreatedAt         *time.Time
+	LastModifiedAt    *time.Time
+	EncryptionAtHost  *bool
+	DataDiskCount     *int32
+	DataDiskSizeGB    *int32
+	SecureBootEnabled *bool
+	VTpmEnabled       *bool
+	// Locked is set once the management locks of the VM are resolved by setVirtualMachineLocks.
+	Locked *bool
+	// ExcludeLocked is set if the VM is matched by a selector excluding locked VMs from security enforcement.
+	ExcludeLocked *bool
+	HasPublicIP   *bool
+	// Extensions is set once the extensions of the VM are resolved by setVirtualMachineExtensions.
+	Extensions []*string
+	// ExtensionMatchName and ExtensionMatchMissing are set if the VM is matched by a selector with an extension match,
+	// which is evaluated by setVirtualMachineExtensions.
+	ExtensionMatchName    *string
+	ExtensionMatchMissing *bool
+	// ScaleSetID is the ID of the scale set a VMSS instance belongs to, empty for a standalone VM.
+	ScaleSetID *string
 }
 type networkInterface struct {
 	ID         *string
@@ -42,6 +67,21 @@ type networkInterface struct {
 	PublicIps  []*string
 	Tags       map[string]*string
 	VnetID     *string
+	NsgIDs     []*string
+	// PrimaryPrivateIP is the private IP of the primary IP configuration.
+	PrimaryPrivateIP *string
+}
+
+// primaryPrivateIP returns the private IP of the primary IP configuration, or the first private IP when the primary
+// IP configuration is unknown.
+func (n *networkInterface) primaryPrivateIP() *string {
+	if !emptyString(n.PrimaryPrivateIP) {
+		return n.PrimaryPrivateIP
+	}
+	if len(n.PrivateIps) > 0 {
+		return n.PrivateIps[0]
+	}
+	return nil
 }
 
 type vmTableQueryParameters struct {
@@ -49,13 +89,34 @@ type vmTableQueryParameters struct {
 	TenantIDs       *string
 	Locations       *string
 	VnetIDs         *string
+	SubnetIDs       *string
 	VMNames         *string
 	VMIDs           *string
+	Filters         *string
+	PublicIPOnly    bool
+	NsgIDs          *string
+	NoNsgOnly       bool
+	ExcludeLocked   bool
+	// ExtensionMatchName is the quoted lowercase extension name of an extension match.
+	ExtensionMatchName    *string
+	ExtensionMatchMissing bool
+	// ScaleSetInstances selects instances of uniform scale sets from the ComputeResources table instead of VMs.
+	ScaleSetInstances bool
+	// Fields are the optional VM fields computed and projected by the query.
+	Fields map[string]bool
 }
 
 const (
-	vmsTableQueryTemplate = "Resources" +
+	// Instances of uniform scale sets, along with their network interfaces and public IPs, are only available in the
+	// ComputeResources table, hence they are queried separately from the Resources table. Instances of flexible scale
+	// sets are regular VMs of the Resources table.
+	vmsTableQueryTemplate = "{{ if .ScaleSetInstances }}" +
+		"ComputeResources" +
+		"| where type =~ 'microsoft.compute/virtualmachinescalesets/virtualmachines'" +
+		"{{ else }}" +
+		"Resources" +
 		"| where type =~ 'microsoft.compute/virtualmachines'" +
+		"{{ end }}" +
 		"| extend subscriptionIdLowerCase = tolower(subscriptionId)" +
 		"{{ if .SubscriptionIDs }} " +
 		"| where subscriptionIdLowerCase in ({{ .SubscriptionIDs }}) " +
@@ -76,12 +137,49 @@ const (
 		"{{ if .VMIDs}} " +
 		"| where id in ({{ .VMIDs }})" +
 		"{{ end }}" +
+		"{{ if .Fields.scaleSetId }}" +
+		"{{ if .ScaleSetInstances }}" +
+		"| extend scaleSetId = strcat_array(array_slice(split(id, \"/\"), 0, 8), \"/\")" +
+		"{{ else }}" +
+		"| extend scaleSetId = tolower(tostring(properties.virtualMachineScaleSet.id))" +
+		"{{ end }}" +
+		"{{ end }}" +
+		"{{ if or .Fields.dataDiskCount .Fields.dataDiskSizeGB }}" +
+		"| extend dataDisks = properties.storageProfile.dataDisks" +
+		"| extend dataDiskCount = coalesce(array_length(dataDisks), 0)" +
+		// a placeholder disk is applied for VMs without data disks, so that they are not dropped by mv-apply.
+		"| mv-apply dataDisk = iff(dataDiskCount > 0, dataDisks, dynamic([{}])) on (" +
+		"	summarize dataDiskSizeGB = sum(toint(dataDisk.diskSizeGB))" +
+		")" +
+		"| extend dataDiskSizeGB = coalesce(dataDiskSizeGB, 0)" +
+		"{{ end }}" +
+		"{{ if .Fields.lastModifiedAt }}" +
+		"| extend lastModifiedAt = todatetime(systemData.lastModifiedAt)" +
+		"{{ end }}" +
+		"{{ if .Fields.encryptionAtHost }}" +
+		"| extend encryptionAtHost = coalesce(tobool(properties.securityProfile.encryptionAtHost), false)" +
+		"{{ end }}" +
+		"{{ if .Fields.secureBootEnabled }}" +
+		"| extend secureBootEnabled = coalesce(tobool(properties.securityProfile.uefiSettings.secureBootEnabled), false)" +
+		"{{ end }}" +
+		"{{ if .Fields.vTpmEnabled }}" +
+		"| extend vTpmEnabled = coalesce(tobool(properties.securityProfile.uefiSettings.vTpmEnabled), false)" +
+		"{{ end }}" +
+		"{{ if .Filters }} " +
+		"{{ .Filters }}" +
+		"{{ end }}" +
 		"| mvexpand nic = properties.networkProfile.networkInterfaces" +
 		"| extend nicId = tolower(tostring(nic.id))" +
 		"| join kind = innerunique (" +
+		"	{{ if .ScaleSetInstances }}" +
+		"	ComputeResources" +
+		"	| where type =~ 'microsoft.compute/virtualmachinescalesets/virtualmachines/networkinterfaces'" +
+		"	{{ else }}" +
 		"	Resources" +
 		"	| where type =~ 'microsoft.network/networkinterfaces'" +
+		"	{{ end }}" +
 		"	| extend macAddress = properties.macAddress" +
+		"	| extend nicNsgId = tolower(tostring(properties.networkSecurityGroup.id))" +
 		"	| mvexpand ipconfig = properties.ipConfigurations" +
 		"	| extend vnetIdArray = array_slice(split(ipconfig.properties.subnet.id, \"/\"), 0, 8)" +
 		"	| extend vnetId = tolower(strcat_array(vnetIdArray, \"/\"))" +
@@ -90,20 +188,83 @@ const (
 		"	{{ end }}" +
 		"	| extend publicIpId = tolower(tostring(ipconfig.properties.publicIPAddress.id))" +
 		"	| extend nicPrivateIp = ipconfig.properties.privateIPAddress" +
+		"	| extend nicPrimaryPrivateIp = iff(tobool(ipconfig.properties.primary), tostring(nicPrivateIp), '')" +
+		"	| extend subnetId = tolower(tostring(ipconfig.properties.subnet.id))" +
+		"	{{ if .SubnetIDs }} " +
+		"	| where subnetId in ({{ .SubnetIDs }}) " +
+		"	{{ end }}" +
 		"	| join kind = leftouter (" +
+		"		{{ if .ScaleSetInstances }}" +
+		"		ComputeResources" +
+		"		| where type =~ " +
+		"'microsoft.compute/virtualmachinescalesets/virtualmachines/networkinterfaces/ipconfigurations/publicipaddresses'" +
+		"		{{ else }}" +
 		"		Resources" +
 		"		| where type =~ 'microsoft.network/publicipaddresses'" +
+		"		{{ end }}" +
 		"		| project publicIpId = tolower(id), nicPublicIp = properties.ipAddress" +
 		"	) on publicIpId" +
+		"	| join kind = leftouter (" +
+		"		Resources" +
+		"		| where type =~ 'microsoft.network/virtualnetworks'" +
+		"		| mvexpand subnet = properties.subnets" +
+		"		| project subnetId = tolower(tostring(subnet.id)), " +
+		"subnetNsgId = tolower(tostring(subnet.properties.networkSecurityGroup.id))" +
+		"	) on subnetId" +
 		"	| summarize nicTags = any(tags), macAddress = any(macAddress), vnetId = any(vnetId), " +
-		"nicPublicIps = make_list(nicPublicIp), nicPrivateIps = make_list(nicPrivateIp) by id, name" +
-		"	| project nicId = tolower(id), nicName = name, nicPublicIps, nicPrivateIps, vnetId, macAddress, nicTags" +
+		"nicPublicIps = make_list(nicPublicIp), nicPrivateIps = make_list(nicPrivateIp), " +
+		"nicPrimaryPrivateIp = max(nicPrimaryPrivateIp), " +
+		"nicPublicIpCount = countif(isnotempty(publicIpId)), nicNsgIds = make_set(nicNsgId), " +
+		"subnetNsgIds = make_set(subnetNsgId) by id, name" +
+		"	| extend nicNsgIds = set_difference(set_union(nicNsgIds, subnetNsgIds), dynamic(['']))" +
+		"	| project nicId = tolower(id), nicName = name, nicPublicIps, nicPrivateIps, nicPrimaryPrivateIp, vnetId, " +
+		"macAddress, nicTags, nicPublicIpCount, nicNsgIds" +
 		") on nicId" +
 		"| extend networkInterfaceDetails = pack(\"id\", nicId, \"name\", nicName, \"macAddress\", macAddress, \"privateIps\"," +
-		"nicPrivateIps, \"publicIps\", nicPublicIps, \"tags\", nicTags, \"vnetId\", vnetId)" +
-		"| summarize vnetId = any(vnetId), properties = make_bag(properties), tags = make_bag(tags), " +
-		"networkInterfaces = make_list(networkInterfaceDetails) by id, name" +
-		"| project id, name, properties, status=properties.extended.instanceView.powerState.code, networkInterfaces, tags, vnetId"
+		"nicPrivateIps, \"primaryPrivateIp\", nicPrimaryPrivateIp, \"publicIps\", nicPublicIps, \"tags\", nicTags, " +
+		"\"vnetId\", vnetId, \"nsgIds\", nicNsgIds)" +
+		"| summarize vnetId = any(vnetId), properties = make_bag(properties), " +
+		"{{ if .Fields.tags }}tags = make_bag(tags), {{ end }}" +
+		"{{ if .Fields.lastModifiedAt }}lastModifiedAt = max(lastModifiedAt), {{ end }}" +
+		"{{ if .Fields.encryptionAtHost }}encryptionAtHost = any(encryptionAtHost), {{ end }}" +
+		"{{ if .Fields.dataDiskCount }}dataDiskCount = any(dataDiskCount), {{ end }}" +
+		"{{ if .Fields.dataDiskSizeGB }}dataDiskSizeGB = any(dataDiskSizeGB), {{ end }}" +
+		"{{ if .Fields.scaleSetId }}scaleSetId = any(scaleSetId), {{ end }}" +
+		"{{ if .Fields.secureBootEnabled }}secureBootEnabled = any(secureBootEnabled), {{ end }}" +
+		"{{ if .Fields.vTpmEnabled }}vTpmEnabled = any(vTpmEnabled), {{ end }}" +
+		"networkInterfaces = make_list(networkInterfaceDetails), publicIpCount = sum(nicPublicIpCount), " +
+		"nsgCount = sum(array_length(nicNsgIds))" +
+		"{{ if .NsgIDs }}" +
+		", nsgMatchCount = countif(array_length(set_intersect(nicNsgIds, dynamic([{{ .NsgIDs }}]))) > 0)" +
+		"{{ end }}" +
+		" by id, name" +
+		"{{ if .PublicIPOnly }} " +
+		"| where publicIpCount > 0" +
+		"{{ end }}" +
+		"{{ if .NoNsgOnly }} " +
+		"| where nsgCount == 0" +
+		"{{ end }}" +
+		"{{ if .NsgIDs }} " +
+		"| where nsgMatchCount > 0" +
+		"{{ end }}" +
+		"| project id, name, properties" +
+		"{{ if .Fields.status }}, status=properties.extended.instanceView.powerState.code{{ end }}" +
+		", networkInterfaces{{ if .Fields.tags }}, tags{{ end }}, vnetId" +
+		"{{ if .Fields.createdAt }}, createdAt=properties.timeCreated{{ end }}" +
+		"{{ if .Fields.lastModifiedAt }}, lastModifiedAt{{ end }}" +
+		"{{ if .Fields.encryptionAtHost }}, encryptionAtHost{{ end }}" +
+		"{{ if .Fields.dataDiskCount }}, dataDiskCount{{ end }}" +
+		"{{ if .Fields.dataDiskSizeGB }}, dataDiskSizeGB{{ end }}" +
+		"{{ if .Fields.secureBootEnabled }}, secureBootEnabled{{ end }}" +
+		"{{ if .Fields.vTpmEnabled }}, vTpmEnabled{{ end }}" +
+		"{{ if .Fields.hasPublicIp }}, hasPublicIp=publicIpCount > 0{{ end }}" +
+		"{{ if .Fields.scaleSetId }}, scaleSetId{{ end }}" +
+		"{{ if .ExcludeLocked }} " +
+		"| extend excludeLocked = true" +
+		"{{ end }}" +
+		"{{ if .ExtensionMatchName }} " +
+		"| extend extensionMatchName = {{ .ExtensionMatchName }}, extensionMatchMissing = {{ .ExtensionMatchMissing }}" +
+		"{{ end }}"
 )
 
 func ToTimeHookFunc() mapstructure.DecodeHookFunc {
@@ -146,9 +307,9 @@ func customDecode(input map[string]interface{}, result interface{}) error {
 	return decoder.Decode(input)
 }
 
-func getVirtualMachineTable(resourceGraphAPIClient azureResourceGraphWrapper, query *string,
-	subscriptions []*string) ([]*virtualMachineTable, int64, error) {
-	data, count, err := invokeResourceGraphQuery(resourceGraphAPIClient, query, subscriptions)
+func getVirtualMachineTable(ctx context.Context, resourceGraphAPIClient azureResourceGraphWrapper, credentialIdentity string,
+	query *string, subscriptions []*string) ([]*virtualMachineTable, int64, error) {
+	data, count, err := invokeResourceGraphQuery(ctx, resourceGraphAPIClient, credentialIdentity, query, subscriptions)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error invoking Azure resource graph query: %v", err)
 	}
@@ -166,8 +327,22 @@ func getVirtualMachineTable(resourceGraphAPIClient azureResourceGraphWrapper, qu
 	return virtualMachines, count, nil
 }
 
-func getVMsByVnetIDsMatchQuery(vnetIDs []string, subscriptionIDs []string, tenantIDs []string,
-	locations []string) (*string, error) {
+// isInventoryFieldSelected returns true if the optional inventory field is selected by the given inventory fields, where
+// nil selects all fields.
+func isInventoryFieldSelected(fields []string, field string) bool {
+	if fields == nil {
+		return true
+	}
+	for _, selected := range fields {
+		if selected == field {
+			return true
+		}
+	}
+	return false
+}
+
+func getVMsByVnetIDsMatchQuery(vnetIDs []string, inventoryFields []string, subscriptionIDs []string, tenantIDs []string,
+	locations []string) ([]*string, error) {
 	commaSeparatedVnetIDs := convertStrSliceToLowercaseCommaSeparatedStr(vnetIDs)
 	if len(commaSeparatedVnetIDs) == 0 {
 		return nil, fmt.Errorf(vnetIDsNotFoundErrorMsg)
@@ -195,15 +370,15 @@ func getVMsByVnetIDsMatchQuery(vnetIDs []string, subscriptionIDs []string, tenan
 		VnetIDs:         &commaSeparatedVnetIDs,
 	}
 
-	queryString, err := buildVmsTableQueryWithParams("getVMsByVnetIDsMatchQuery", queryParams)
+	queryStrings, err := buildVmsTableQueryWithParams("getVMsByVnetIDsMatchQuery", inventoryFields, queryParams)
 	if err != nil {
 		return nil, err
 	}
-	return queryString, nil
+	return queryStrings, nil
 }
 
-func getVMsByVMNamesMatchQuery(vmNames []string, subscriptionIDs []string, tenantIDs []string,
-	locations []string) (*string, error) {
+func getVMsByVMNamesMatchQuery(vmNames []string, inventoryFields []string, subscriptionIDs []string, tenantIDs []string,
+	locations []string) ([]*string, error) {
 	commaSeparatedVMNames := convertStrSliceToLowercaseCommaSeparatedStr(vmNames)
 	if len(commaSeparatedVMNames) == 0 {
 		return nil, fmt.Errorf(vmNamesNotFoundErrorMsg)
@@ -231,15 +406,15 @@ func getVMsByVMNamesMatchQuery(vmNames []string, subscriptionIDs []string, tenan
 		VMNames:         &commaSeparatedVMNames,
 	}
 
-	queryString, err := buildVmsTableQueryWithParams("getVMsByVMNamesMatchQuery", queryParams)
+	queryStrings, err := buildVmsTableQueryWithParams("getVMsByVMNamesMatchQuery", inventoryFields, queryParams)
 	if err != nil {
 		return nil, err
 	}
-	return queryString, nil
+	return queryStrings, nil
 }
 
-func getVMsByVMIDsMatchQuery(vmIDs []string, subscriptionIDs []string, tenantIDs []string,
-	locations []string) (*string, error) {
+func getVMsByVMIDsMatchQuery(vmIDs []string, inventoryFields []string, subscriptionIDs []string, tenantIDs []string,
+	locations []string) ([]*string, error) {
 	commaSeparatedVMIDs := convertStrSliceToLowercaseCommaSeparatedStr(vmIDs)
 	if len(commaSeparatedVMIDs) == 0 {
 		return nil, fmt.Errorf(vmIDsNotFoundErrorMsg)
@@ -267,15 +442,15 @@ func getVMsByVMIDsMatchQuery(vmIDs []string, subscriptionIDs []string, tenantIDs
 		VMIDs:           &commaSeparatedVMIDs,
 	}
 
-	queryString, err := buildVmsTableQueryWithParams("getVMsByVMIDsMatchQuery", queryParams)
+	queryStrings, err := buildVmsTableQueryWithParams("getVMsByVMIDsMatchQuery", inventoryFields, queryParams)
 	if err != nil {
 		return nil, err
 	}
-	return queryString, nil
+	return queryStrings, nil
 }
 
-func getVMsByVnetAndOtherMatchesQuery(vnetIDs []string, vmNames []string, vmIDs []string, subscriptionIDs []string,
-	tenantIDs []string, locations []string) (*string, error) {
+func getVMsByVnetAndOtherMatchesQuery(vnetIDs []string, vmNames []string, vmIDs []string, inventoryFields []string,
+	subscriptionIDs []string, tenantIDs []string, locations []string) ([]*string, error) {
 	var queryParams *vmTableQueryParameters
 	commaSeparatedSubscriptionIDs := convertStrSliceToLowercaseCommaSeparatedStr(subscriptionIDs)
 	if len(commaSeparatedSubscriptionIDs) == 0 {
@@ -322,25 +497,107 @@ func getVMsByVnetAndOtherMatchesQuery(vnetIDs []string, vmNames []string, vmIDs
 		}
 	}
 
-	queryString, err := buildVmsTableQueryWithParams("getVMsByVMIDsMatchQuery", queryParams)
+	queryStrings, err := buildVmsTableQueryWithParams("getVMsByVMIDsMatchQuery", inventoryFields, queryParams)
 	if err != nil {
 		return nil, err
 	}
-	return queryString, nil
+	return queryStrings, nil
 }
 
-func buildVmsTableQueryWithParams(name string, queryParams *vmTableQueryParameters) (*string, error) {
-	var vmTableData bytes.Buffer
-	queryTemplate, err := template.New(name).Parse(vmsTableQueryTemplate)
+// getVMsByAttributeMatchesQuery builds a query matching VMs in vnetIDs with vmNames or vmIDs, which also satisfy all
+// the given filters. vnetIDs, vmNames and vmIDs are optional, filters are KQL where clauses on the VM resource.
+// If subnetIDs is set, only network interfaces in those subnets are matched, hence VMs without any are not matched.
+// If publicIPOnly is set, only VMs having a public IP associated with any network interface are matched. If nsgMatch
+// is set, only VMs associated with the matching network security group, or with none, are matched. If excludeLocked is
+// set, the matched VMs are marked so that the locked ones are excluded from security enforcement. If extensionMatch is
+// set, the matched VMs are marked with it, so that it is evaluated once their extensions are resolved.
+func getVMsByAttributeMatchesQuery(vnetIDs []string, subnetIDs []string, vmNames []string, vmIDs []string,
+	filters []string, publicIPOnly bool, nsgMatch *crdv1alpha1.NetworkSecurityGroupMatch, excludeLocked bool,
+	extensionMatch *crdv1alpha1.ExtensionMatch, inventoryFields []string, subscriptionIDs []string, tenantIDs []string,
+	locations []string) ([]*string, error) {
+	commaSeparatedSubscriptionIDs := convertStrSliceToLowercaseCommaSeparatedStr(subscriptionIDs)
+	if len(commaSeparatedSubscriptionIDs) == 0 {
+		return nil, fmt.Errorf(subscriptionIDsNotFoundErrorMsg)
+	}
+
+	commaSeparatedTenantIDs := convertStrSliceToLowercaseCommaSeparatedStr(tenantIDs)
+	if len(commaSeparatedTenantIDs) == 0 {
+		return nil, fmt.Errorf(tenantIDsNotFoundErrorMsg)
+	}
+
+	commaSeparatedLocations := convertStrSliceToLowercaseCommaSeparatedStr(locations)
+	if len(commaSeparatedLocations) == 0 {
+		return nil, fmt.Errorf(locationsNotFoundErrorMsg)
+	}
+
+	queryParams := &vmTableQueryParameters{
+		SubscriptionIDs: &commaSeparatedSubscriptionIDs,
+		TenantIDs:       &commaSeparatedTenantIDs,
+		Locations:       &commaSeparatedLocations,
+		PublicIPOnly:    publicIPOnly,
+		ExcludeLocked:   excludeLocked,
+	}
+	if commaSeparatedVnetIDs := convertStrSliceToLowercaseCommaSeparatedStr(vnetIDs); len(commaSeparatedVnetIDs) > 0 {
+		queryParams.VnetIDs = &commaSeparatedVnetIDs
+	}
+	if commaSeparatedSubnetIDs := convertStrSliceToLowercaseCommaSeparatedStr(subnetIDs); len(commaSeparatedSubnetIDs) > 0 {
+		queryParams.SubnetIDs = &commaSeparatedSubnetIDs
+	}
+	if commaSeparatedVMNames := convertStrSliceToLowercaseCommaSeparatedStr(vmNames); len(commaSeparatedVMNames) > 0 {
+		queryParams.VMNames = &commaSeparatedVMNames
+	}
+	if commaSeparatedVMIDs := convertStrSliceToLowercaseCommaSeparatedStr(vmIDs); len(commaSeparatedVMIDs) > 0 {
+		queryParams.VMIDs = &commaSeparatedVMIDs
+	}
+	if nsgMatch != nil {
+		queryParams.NoNsgOnly = nsgMatch.MatchNone
+		if commaSeparatedNsgIDs := convertStrSliceToLowercaseCommaSeparatedStr(
+			[]string{nsgMatch.MatchID}); len(commaSeparatedNsgIDs) > 0 {
+			queryParams.NsgIDs = &commaSeparatedNsgIDs
+		}
+	}
+	if extensionMatch != nil && len(strings.TrimSpace(extensionMatch.MatchName)) > 0 {
+		extensionMatchName := quoteKqlString(strings.ToLower(strings.TrimSpace(extensionMatch.MatchName)))
+		queryParams.ExtensionMatchName = &extensionMatchName
+		queryParams.ExtensionMatchMissing = extensionMatch.MatchMissing
+	}
+	if len(filters) > 0 {
+		joinedFilters := strings.Join(filters, " ")
+		queryParams.Filters = &joinedFilters
+	}
+
+	queryStrings, err := buildVmsTableQueryWithParams("getVMsByAttributeMatchesQuery", inventoryFields, queryParams)
 	if err != nil {
 		return nil, err
 	}
+	return queryStrings, nil
+}
 
-	err = queryTemplate.Execute(&vmTableData, queryParams)
+// buildVmsTableQueryWithParams returns the query of VMs from the Resources table, followed by the query of uniform scale
+// set instances from the ComputeResources table, as the two tables cannot be combined in a single query. Only the
+// optional VM fields selected by inventoryFields are computed, where nil selects all.
+func buildVmsTableQueryWithParams(name string, inventoryFields []string,
+	queryParams *vmTableQueryParameters) ([]*string, error) {
+	queryTemplate, err := template.New(name).Parse(vmsTableQueryTemplate)
 	if err != nil {
 		return nil, err
 	}
 
-	queryString := vmTableData.String()
-	return &queryString, nil
+	queryParams.Fields = make(map[string]bool, len(utils.AzureInventoryOptionalFields))
+	for _, field := range utils.AzureInventoryOptionalFields {
+		queryParams.Fields[field] = isInventoryFieldSelected(inventoryFields, field)
+	}
+
+	var queryStrings []*string
+	for _, scaleSetInstances := range []bool{false, true} {
+		var vmTableData bytes.Buffer
+		queryParams.ScaleSetInstances = scaleSetInstances
+		err = queryTemplate.Execute(&vmTableData, queryParams)
+		if err != nil {
+			return nil, err
+		}
+		queryString := vmTableData.String()
+		queryStrings = append(queryStrings, &queryString)
+	}
+	return queryStrings, nil
 }
@@ -0,0 +1,92 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
+)
+
+// nsgRuleTranslator translates cloud rules of an appliedTo group into azure network security rules.
+type nsgRuleTranslator struct {
+	appliedToGroupID *cloudresource.CloudResourceID
+	agAsgMap         map[string]armnetwork.ApplicationSecurityGroup
+	atAsgMap         map[string]armnetwork.ApplicationSecurityGroup
+	// remoteGroupAddressPrefixes are the address prefixes of security groups of vnets other than the appliedTo vnet,
+	// which cannot be referenced by their ASGs, keyed by getRemoteGroupKey.
+	remoteGroupAddressPrefixes map[string][]*net.IPNet
+	// peerRuleIP is the address of the appliedTo VM when rules are translated for an NSG of peered vnets, rules of
+	// which cannot reference the appliedTo ASG.
+	peerRuleIP *string
+}
+
+var _ internal.RuleTranslator = &nsgRuleTranslator{}
+
+// Translate returns the azure security rules of the ingress rules followed by those of the egress rules.
+func (t *nsgRuleTranslator) Translate(rules []*cloudresource.CloudRule) ([]internal.ProviderRule, error) {
+	ingressRules, egressRules := utils.SplitCloudRulesByDirection(rules)
+	var ingressSecurityRules, egressSecurityRules []*armnetwork.SecurityRule
+	var err error
+	if t.peerRuleIP != nil {
+		ingressSecurityRules, err = convertIngressToPeerNsgSecurityRules(t.appliedToGroupID, ingressRules, t.agAsgMap,
+			t.peerRuleIP, t.remoteGroupAddressPrefixes)
+		if err != nil {
+			return nil, err
+		}
+		egressSecurityRules, err = convertEgressToPeerNsgSecurityRules(t.appliedToGroupID, egressRules, t.agAsgMap,
+			t.peerRuleIP, t.remoteGroupAddressPrefixes)
+	} else {
+		ingressSecurityRules, err = convertIngressToNsgSecurityRules(t.appliedToGroupID, ingressRules, t.agAsgMap,
+			t.atAsgMap, t.remoteGroupAddressPrefixes)
+		if err != nil {
+			return nil, err
+		}
+		egressSecurityRules, err = convertEgressToNsgSecurityRules(t.appliedToGroupID, egressRules, t.agAsgMap,
+			t.atAsgMap, t.remoteGroupAddressPrefixes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	providerRules := make([]internal.ProviderRule, 0, len(ingressSecurityRules)+len(egressSecurityRules))
+	for _, rule := range append(ingressSecurityRules, egressSecurityRules...) {
+		providerRules = append(providerRules, rule)
+	}
+	return providerRules, nil
+}
+
+// translateToNsgSecurityRules translates rules with translator and returns the resulting azure security rules.
+func translateToNsgSecurityRules(translator internal.RuleTranslator,
+	rules []*cloudresource.CloudRule) ([]*armnetwork.SecurityRule, error) {
+	providerRules, err := translator.Translate(rules)
+	if err != nil {
+		return nil, err
+	}
+	securityRules := make([]*armnetwork.SecurityRule, 0, len(providerRules))
+	for _, providerRule := range providerRules {
+		securityRule, ok := providerRule.(*armnetwork.SecurityRule)
+		if !ok {
+			return nil, fmt.Errorf("unexpected provider rule type %T", providerRule)
+		}
+		securityRules = append(securityRules, securityRule)
+	}
+	return securityRules, nil
+}
@@ -17,12 +17,15 @@ package azure
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"go.uber.org/multierr"
 
+	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/utils"
@@ -38,6 +41,11 @@ func getPerVnetDefaultNsgName(vnetName string) string {
 	return cloudresource.ControllerPrefix + "-at-default-" + vnetName
 }
 
+// getCloudName returns the Azure cloud name of a security group.
+func getCloudName(id *cloudresource.CloudResourceID, membershipOnly bool) string {
+	return id.GetCloudNameOfProvider(runtimev1alpha1.AzureCloudProvider, membershipOnly)
+}
+
 // getNetworkInterfacesOfVnet fetch network interfaces for a set of VNET-IDs.
 func (computeCfg *computeServiceConfig) getNetworkInterfacesOfVnet(vnetIDSet map[string]struct{}) ([]*networkInterfaceInternal, error) {
 	location := computeCfg.credentials.region
@@ -56,7 +64,8 @@ func (computeCfg *computeServiceConfig) getNetworkInterfacesOfVnet(vnetIDSet map
 		return nil, err
 	}
 	// Required just for vnet-id to interface mapping.
-	nwInterfacesFromRGQuery, _, err := getNetworkInterfaceTable(computeCfg.resourceGraphAPIClient, query, []*string{&subscriptionID})
+	nwInterfacesFromRGQuery, _, err := getNetworkInterfaceTable(context.Background(), computeCfg.resourceGraphAPIClient,
+		computeCfg.credentials.getCredentialIdentity(), query, []*string{&subscriptionID})
 	if err != nil {
 		return nil, err
 	}
@@ -87,10 +96,10 @@ func (computeCfg *computeServiceConfig) processAppliedToMembership(appliedToGrou
 	networkInterfaces []*networkInterfaceInternal, rgName string, memberVirtualMachines map[string]struct{},
 	memberNetworkInterfaces map[string]struct{}, isPeer bool) error {
 	// appliedTo sg has asg as well as nsg created corresponding to it. Hence, update membership for both asg and nsg.
-	appliedToGroupOriginalNameToBeUsedAsTag := appliedToGroupIdentifier.GetCloudName(false)
+	appliedToGroupOriginalNameToBeUsedAsTag := getCloudName(appliedToGroupIdentifier, false)
 	tokens := strings.Split(appliedToGroupIdentifier.Vpc, "/")
 	vnetName := tokens[len(tokens)-1]
-	cloudSgNameLowercase := appliedToGroupIdentifier.GetCloudName(isPeer)
+	cloudSgNameLowercase := getCloudName(appliedToGroupIdentifier, isPeer)
 
 	// get NSG and ASG details corresponding to applied to group.
 	nsgObj, err := computeCfg.nsgAPIClient.get(context.Background(), rgName, getPerVnetDefaultNsgName(vnetName), "")
@@ -177,16 +186,19 @@ func (computeCfg *computeServiceConfig) processNsgAttachDetachConcurrently(nsgOb
 	}()
 
 	nwIntfAPIClient := computeCfg.nwIntfAPIClient
+	keepNsgOnDetach := computeCfg.credentials.detachPolicy == crdv1alpha1.SecurityGroupDetachPolicyLeaveUnattached
 	for _, nwIntfObj := range nwIntfIDSetNsgToDetach {
 		go func(nwIntfObj *armnetwork.Interface, nsgObj armnetwork.SecurityGroup, isAttach bool, ch chan error) {
 			defer wg.Done()
-			ch <- updateNetworkInterfaceNsg(nwIntfAPIClient, nwIntfObj, nsgObj, asgObj, isAttach, nwIntfTagKeyToUpdate)
+			ch <- updateNetworkInterfaceNsg(nwIntfAPIClient, nwIntfObj, nsgObj, asgObj, isAttach, nwIntfTagKeyToUpdate,
+				keepNsgOnDetach)
 		}(nwIntfObj, nsgObj, false, ch)
 	}
 	for _, nwIntfObj := range nwIntfIDSetNsgToAttach {
 		go func(nwIntfObj *armnetwork.Interface, nsgObj armnetwork.SecurityGroup, isAttach bool, ch chan error) {
 			defer wg.Done()
-			ch <- updateNetworkInterfaceNsg(nwIntfAPIClient, nwIntfObj, nsgObj, asgObj, isAttach, nwIntfTagKeyToUpdate)
+			ch <- updateNetworkInterfaceNsg(nwIntfAPIClient, nwIntfObj, nsgObj, asgObj, isAttach, nwIntfTagKeyToUpdate,
+				keepNsgOnDetach)
 		}(nwIntfObj, nsgObj, true, ch)
 	}
 	for e := range ch {
@@ -201,7 +213,7 @@ func (computeCfg *computeServiceConfig) processNsgAttachDetachConcurrently(nsgOb
 func (computeCfg *computeServiceConfig) processAddressGroupMembership(addressGroupIdentifier *cloudresource.CloudResourceID,
 	networkInterfaces []*networkInterfaceInternal, rgName string, memberVirtualMachines map[string]struct{},
 	memberNetworkInterfaces map[string]struct{}) error {
-	cloudAsgNameLowercase := addressGroupIdentifier.GetCloudName(true)
+	cloudAsgNameLowercase := getCloudName(addressGroupIdentifier, true)
 
 	// get ASG details
 	asgObj, err := computeCfg.asgAPIClient.get(context.Background(), rgName, cloudAsgNameLowercase)
@@ -292,8 +304,11 @@ func (computeCfg *computeServiceConfig) processAsgAttachDetachConcurrently(asgOb
 }
 
 // buildEffectiveNSGSecurityRulesToApply prepares the update rule cloud api payload from internal rules.
+// Security groups of vnets other than the appliedTo vnet are resolved to remoteGroupAddressPrefixes in added rules, and
+// to the prefixes they were realized with in removed rules.
 func (computeCfg *computeServiceConfig) buildEffectiveNSGSecurityRulesToApply(appliedToGroupID *cloudresource.CloudResourceID,
-	addRules, rmRules []*cloudresource.CloudRule, perVnetAppliedToNsgName, rgName string) ([]*armnetwork.SecurityRule, error) {
+	addRules, rmRules []*cloudresource.CloudRule, perVnetAppliedToNsgName, rgName string,
+	remoteGroupAddressPrefixes map[string][]*net.IPNet) ([]*armnetwork.SecurityRule, error) {
 	// get current rules for applied to SG azure NSG
 	nsgObj, err := computeCfg.nsgAPIClient.get(context.Background(), rgName, perVnetAppliedToNsgName, "")
 	if err != nil {
@@ -310,30 +325,37 @@ func (computeCfg *computeServiceConfig) buildEffectiveNSGSecurityRulesToApply(ap
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	addIngressRules, err := convertIngressToNsgSecurityRules(appliedToGroupID, addIRule, agAsgMapByNepheName, atAsgMapByNepheName)
+	translator := &nsgRuleTranslator{
+		appliedToGroupID:           appliedToGroupID,
+		agAsgMap:                   agAsgMapByNepheName,
+		atAsgMap:                   atAsgMapByNepheName,
+		remoteGroupAddressPrefixes: remoteGroupAddressPrefixes,
+	}
+	addIngressRules, err := translateToNsgSecurityRules(translator, addIRule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	addEgressRules, err := convertEgressToNsgSecurityRules(appliedToGroupID, addERule, agAsgMapByNepheName, atAsgMapByNepheName)
+	addEgressRules, err := translateToNsgSecurityRules(translator, addERule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	rmIngressRules, err := convertIngressToNsgSecurityRules(appliedToGroupID, rmIRule, agAsgMapByNepheName, atAsgMapByNepheName)
+	rmIngressRules, err := computeCfg.translateRemovedRules(translator, rmIRule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	rmEgressRules, err := convertEgressToNsgSecurityRules(appliedToGroupID, rmERule, agAsgMapByNepheName, atAsgMapByNepheName)
+	rmEgressRules, err := computeCfg.translateRemovedRules(translator, rmERule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
 
 	var currentNsgIngressRules []*armnetwork.SecurityRule
 	var currentNsgEgressRules []*armnetwork.SecurityRule
+	var currentAllowListRules []*armnetwork.SecurityRule
 	currentNsgSecurityRules := nsgObj.Properties.SecurityRules
-	appliedToGroupNepheControllerName := appliedToGroupID.GetCloudName(false)
+	appliedToGroupNepheControllerName := getCloudName(appliedToGroupID, false)
 	azurePluginLogger().Info("Building security rules", "applied to security group", appliedToGroupNepheControllerName)
 	for _, rule := range currentNsgSecurityRules {
-		if rule.Properties == nil || *rule.Properties.Priority == vnetToVnetDenyRulePriority {
+		if rule.Properties == nil || isDefaultDenyRule(rule) {
 			continue
 		}
 
@@ -344,6 +366,11 @@ func (computeCfg *computeServiceConfig) buildEffectiveNSGSecurityRulesToApply(ap
 			if !ok {
 				continue
 			}
+			// allow-list rules of current processing appliedToGroup are rebuilt from the account egress allow CIDRs.
+			if isEgressAllowListRule(rule) && isAzureRuleAttachedToAtSg(rule, appliedToGroupNepheControllerName) {
+				currentAllowListRules = append(currentAllowListRules, rule)
+				continue
+			}
 			// check if the rule is created by current processing appliedToGroup.
 			if isAzureRuleAttachedToAtSg(rule, appliedToGroupNepheControllerName) {
 				removeAzureRules := rmIngressRules
@@ -376,16 +403,26 @@ func (computeCfg *computeServiceConfig) buildEffectiveNSGSecurityRulesToApply(ap
 		}
 	}
 
+	keptAllowListRules, allowListRules, err := buildEgressAllowListRules(appliedToGroupID,
+		computeCfg.credentials.egressAllowCIDRs, currentAllowListRules, currentNsgEgressRules, addEgressRules,
+		atAsgMapByNepheName)
+	if err != nil {
+		return []*armnetwork.SecurityRule{}, err
+	}
+	currentNsgEgressRules = append(currentNsgEgressRules, keptAllowListRules...)
 	allIngressRules := updateSecurityRuleNameAndPriority(currentNsgIngressRules, addIngressRules)
-	allEgressRules := updateSecurityRuleNameAndPriority(currentNsgEgressRules, addEgressRules)
-	allIngressRules, allEgressRules = addDefaultDenyRule(allIngressRules, allEgressRules)
+	// allow-list rules are added ahead of policy rules, all of them take precedence over the default deny rules.
+	allEgressRules := updateSecurityRuleNameAndPriority(currentNsgEgressRules, append(allowListRules, addEgressRules...))
+	allIngressRules, allEgressRules = addDefaultDenyRule(allIngressRules, allEgressRules,
+		computeCfg.credentials.denyRulePlacement)
 
 	return append(allIngressRules, allEgressRules...), nil
 }
 
 // buildEffectivePeerNSGSecurityRulesToApply prepares the update rule cloud api payload from internal rules that require peering.
 func (computeCfg *computeServiceConfig) buildEffectivePeerNSGSecurityRulesToApply(appliedToGroupID *cloudresource.CloudResourceID,
-	addRules, rmRules []*cloudresource.CloudRule, perVnetAppliedToNsgName, rgName string, ruleIP *string) ([]*armnetwork.SecurityRule, error) {
+	addRules, rmRules []*cloudresource.CloudRule, perVnetAppliedToNsgName, rgName string, ruleIP *string,
+	remoteGroupAddressPrefixes map[string][]*net.IPNet) ([]*armnetwork.SecurityRule, error) {
 	// get current rules for applied to SG azure NSG
 	nsgObj, err := computeCfg.nsgAPIClient.get(context.Background(), rgName, perVnetAppliedToNsgName, "")
 	if err != nil {
@@ -398,34 +435,41 @@ func (computeCfg *computeServiceConfig) buildEffectivePeerNSGSecurityRulesToAppl
 	addIRule, addERule := utils.SplitCloudRulesByDirection(addRules)
 	rmIRule, rmERule := utils.SplitCloudRulesByDirection(rmRules)
 
-	agAsgMapByNepheName, _, err := getNepheControllerCreatedAsgByNameForResourceGroup(computeCfg.asgAPIClient, rgName)
+	agAsgMapByNepheName, atAsgMapByNepheName, err := getNepheControllerCreatedAsgByNameForResourceGroup(computeCfg.asgAPIClient, rgName)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	addIngressRules, err := convertIngressToPeerNsgSecurityRules(appliedToGroupID, addIRule, agAsgMapByNepheName, ruleIP)
+	translator := &nsgRuleTranslator{
+		appliedToGroupID:           appliedToGroupID,
+		agAsgMap:                   agAsgMapByNepheName,
+		peerRuleIP:                 ruleIP,
+		remoteGroupAddressPrefixes: remoteGroupAddressPrefixes,
+	}
+	addIngressRules, err := translateToNsgSecurityRules(translator, addIRule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	addEgressRules, err := convertEgressToPeerNsgSecurityRules(appliedToGroupID, addERule, agAsgMapByNepheName, ruleIP)
+	addEgressRules, err := translateToNsgSecurityRules(translator, addERule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	rmIngressRules, err := convertIngressToPeerNsgSecurityRules(appliedToGroupID, rmIRule, agAsgMapByNepheName, ruleIP)
+	rmIngressRules, err := computeCfg.translateRemovedRules(translator, rmIRule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
-	rmEgressRules, err := convertEgressToPeerNsgSecurityRules(appliedToGroupID, rmERule, agAsgMapByNepheName, ruleIP)
+	rmEgressRules, err := computeCfg.translateRemovedRules(translator, rmERule)
 	if err != nil {
 		return []*armnetwork.SecurityRule{}, err
 	}
 
 	var currentNsgIngressRules []*armnetwork.SecurityRule
 	var currentNsgEgressRules []*armnetwork.SecurityRule
+	var currentAllowListRules []*armnetwork.SecurityRule
 	currentNsgSecurityRules := nsgObj.Properties.SecurityRules
-	appliedToGroupNepheControllerName := appliedToGroupID.GetCloudName(false)
+	appliedToGroupNepheControllerName := getCloudName(appliedToGroupID, false)
 	azurePluginLogger().Info("Building peering security rules", "applied to security group", appliedToGroupNepheControllerName)
 	for _, rule := range currentNsgSecurityRules {
-		if rule.Properties == nil || *rule.Properties.Priority == vnetToVnetDenyRulePriority {
+		if rule.Properties == nil || isDefaultDenyRule(rule) {
 			continue
 		}
 		// check if the rule is Nephe rules based on ruleStartPriority and description.
@@ -435,6 +479,11 @@ func (computeCfg *computeServiceConfig) buildEffectivePeerNSGSecurityRulesToAppl
 			if !ok {
 				continue
 			}
+			// allow-list rules of current processing appliedToGroup are rebuilt from the account egress allow CIDRs.
+			if isEgressAllowListRule(rule) && isAzureRuleAttachedToAtSg(rule, appliedToGroupNepheControllerName) {
+				currentAllowListRules = append(currentAllowListRules, rule)
+				continue
+			}
 			// check if the rule is created by current processing appliedToGroup.
 			if isAzureRuleAttachedToAtSg(rule, appliedToGroupNepheControllerName) {
 				removeAzureRules := rmIngressRules
@@ -467,24 +516,37 @@ func (computeCfg *computeServiceConfig) buildEffectivePeerNSGSecurityRulesToAppl
 		}
 	}
 
+	keptAllowListRules, allowListRules, err := buildEgressAllowListRules(appliedToGroupID,
+		computeCfg.credentials.egressAllowCIDRs, currentAllowListRules, currentNsgEgressRules, addEgressRules,
+		atAsgMapByNepheName)
+	if err != nil {
+		return []*armnetwork.SecurityRule{}, err
+	}
+	currentNsgEgressRules = append(currentNsgEgressRules, keptAllowListRules...)
 	allIngressRules := updateSecurityRuleNameAndPriority(currentNsgIngressRules, addIngressRules)
-	allEgressRules := updateSecurityRuleNameAndPriority(currentNsgEgressRules, addEgressRules)
-	allIngressRules, allEgressRules = addDefaultDenyRule(allIngressRules, allEgressRules)
+	// allow-list rules are added ahead of policy rules, all of them take precedence over the default deny rules.
+	allEgressRules := updateSecurityRuleNameAndPriority(currentNsgEgressRules, append(allowListRules, addEgressRules...))
+	allIngressRules, allEgressRules = addDefaultDenyRule(allIngressRules, allEgressRules,
+		computeCfg.credentials.denyRulePlacement)
 
 	return append(allIngressRules, allEgressRules...), nil
 }
 
 // updateSecurityGroupMembers processes cloud appliedTo and address security group members.
 func (computeCfg *computeServiceConfig) updateSecurityGroupMembers(securityGroupIdentifier *cloudresource.CloudResourceID,
-	computeResourceIdentifier []*cloudresource.CloudResource, membershipOnly bool) error {
+	computeResourceIdentifier []*cloudresource.CloudResource, membershipOnly bool, skipLocked bool) error {
 	vnetID := securityGroupIdentifier.Vpc
 	vnetNetworkInterfaces, err := computeCfg.getNetworkInterfacesOfVnet(map[string]struct{}{vnetID: {}})
 	if err != nil {
 		return err
 	}
+	if skipLocked {
+		vnetNetworkInterfaces = computeCfg.withoutLockedNetworkInterfaces(vnetNetworkInterfaces)
+	}
 
 	// find all network interfaces which needs to be attached to SG
 	memberVirtualMachines, memberNetworkInterfaces := utils.FindResourcesBasedOnKind(computeResourceIdentifier)
+	computeCfg.logUnsupportedMembers(securityGroupIdentifier, memberVirtualMachines)
 
 	// extract resource-group-name from vnet ID
 	_, rgName, _, err := extractFieldsFromAzureResourceID(securityGroupIdentifier.Vpc)
@@ -508,6 +570,283 @@ func (computeCfg *computeServiceConfig) updateSecurityGroupMembers(securityGroup
 	return err
 }
 
+// logUnsupportedMembers logs the member VMs of a security group which are instances of uniform scale sets. Their
+// network interfaces are not listed by the network interfaces API, hence security groups are neither attached to nor
+// detached from them, and they are reported with EnforcementUnsupported in the inventory.
+func (computeCfg *computeServiceConfig) logUnsupportedMembers(securityGroupIdentifier *cloudresource.CloudResourceID,
+	memberVirtualMachines map[string]struct{}) {
+	var unsupported []string
+	for vmID := range memberVirtualMachines {
+		if isUniformScaleSetInstance(vmID) {
+			unsupported = append(unsupported, vmID)
+		}
+	}
+	if len(unsupported) == 0 {
+		return
+	}
+	sort.Strings(unsupported)
+	azurePluginLogger().Info("Instances of uniform scale sets are not enforced", "account",
+		computeCfg.accountNamespacedName, "security group", securityGroupIdentifier.Name, "vms", unsupported)
+}
+
+// withoutLockedNetworkInterfaces returns the network interfaces, leaving out the ones of locked VMs matched by a selector
+// excluding locked VMs. Security groups are neither attached to nor detached from them, so that their security is not
+// modified by membership or rule changes.
+func (computeCfg *computeServiceConfig) withoutLockedNetworkInterfaces(
+	networkInterfaces []*networkInterfaceInternal) []*networkInterfaceInternal {
+	lockedNwIntfIDs := make(map[string]struct{})
+	for _, vm := range computeCfg.getAllCachedVirtualMachines() {
+		if vm.Locked == nil || !*vm.Locked || vm.ExcludeLocked == nil || !*vm.ExcludeLocked {
+			continue
+		}
+		for _, nwIntf := range vm.NetworkInterfaces {
+			if !emptyString(nwIntf.ID) {
+				lockedNwIntfIDs[strings.ToLower(*nwIntf.ID)] = struct{}{}
+			}
+		}
+	}
+	if len(lockedNwIntfIDs) == 0 {
+		return networkInterfaces
+	}
+
+	filtered := make([]*networkInterfaceInternal, 0, len(networkInterfaces))
+	for _, networkInterface := range networkInterfaces {
+		if networkInterface.ID != nil {
+			if _, ok := lockedNwIntfIDs[strings.ToLower(*networkInterface.ID)]; ok {
+				azurePluginLogger().V(1).Info("Skip network interface of locked vm", "nic", *networkInterface.ID)
+				continue
+			}
+		}
+		filtered = append(filtered, networkInterface)
+	}
+	return filtered
+}
+
+// getNetworkInterfacesAttachedToAsg returns IDs of network interfaces in the vnet which have the ASG attached.
+func (computeCfg *computeServiceConfig) getNetworkInterfacesAttachedToAsg(vnetID string, cloudAsgName string) ([]string, error) {
+	networkInterfaces, err := computeCfg.getNetworkInterfacesOfVnet(map[string]struct{}{vnetID: {}})
+	if err != nil {
+		return nil, err
+	}
+
+	var attachedNwIntfIDs []string
+	for _, networkInterface := range networkInterfaces {
+		if networkInterface.Properties == nil {
+			continue
+		}
+		// the asg may be attached to any ip configuration of the network interface.
+		if isAsgAttachedToNetworkInterface(networkInterface.Properties.IPConfigurations, cloudAsgName) {
+			attachedNwIntfIDs = append(attachedNwIntfIDs, *networkInterface.ID)
+		}
+	}
+	return attachedNwIntfIDs, nil
+}
+
+// isAsgAttachedToNetworkInterface returns true if the ASG is attached to any of the ip configurations.
+func isAsgAttachedToNetworkInterface(ipConfigs []*armnetwork.InterfaceIPConfiguration, cloudAsgName string) bool {
+	for _, ipConfig := range ipConfigs {
+		if ipConfig.Properties == nil {
+			continue
+		}
+		for _, asg := range ipConfig.Properties.ApplicationSecurityGroups {
+			if asg.ID == nil {
+				continue
+			}
+			_, _, asgNameLowercase, err := extractFieldsFromAzureResourceID(strings.ToLower(*asg.ID))
+			if err != nil {
+				continue
+			}
+			if strings.Compare(asgNameLowercase, strings.ToLower(cloudAsgName)) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getRemoteVnetGroupAddressPrefixes returns the address prefixes of the security groups referenced by rules, which are
+// in vnets other than vnetID, keyed by getRemoteGroupKey. Rules cannot reference ASGs whose members are in another
+// vnet, hence such a group is resolved to the private IPs of its member network interfaces. A group of a vnet not
+// visible to the account is resolved to the remote address space of a peering of vnetID only if the account opts in
+// to it, otherwise it has no prefixes, so that rules referencing it are not widened, and it is returned as unresolved.
+func (computeCfg *computeServiceConfig) getRemoteVnetGroupAddressPrefixes(vnetID string,
+	rules ...[]*cloudresource.CloudRule) (map[string][]*net.IPNet, []*cloudresource.CloudResourceID, error) {
+	var unresolvedGroups []*cloudresource.CloudResourceID
+	var peerAddressPrefixes map[string][]*net.IPNet
+	var cachedVnets map[string]armnetwork.VirtualNetwork
+	groupAddressPrefixes := make(map[string][]*net.IPNet)
+	visibleVnetIDs := make(map[string]struct{})
+	var visibleGroups []*cloudresource.CloudResourceID
+	for _, securityGroup := range getReferencedSecurityGroups(rules...) {
+		remoteID := strings.ToLower(securityGroup.Vpc)
+		if remoteID == "" || remoteID == strings.ToLower(vnetID) {
+			continue
+		}
+		key := getRemoteGroupKey(securityGroup)
+		if _, found := groupAddressPrefixes[key]; found {
+			continue
+		}
+		if cachedVnets == nil {
+			cachedVnets = computeCfg.getCachedVnetsMap()
+			peerAddressPrefixes = computeCfg.getVnetPeerAddressPrefixes(vnetID)
+		}
+		groupAddressPrefixes[key] = nil
+		_, peered := peerAddressPrefixes[remoteID]
+		if _, visible := cachedVnets[remoteID]; visible {
+			visibleVnetIDs[remoteID] = struct{}{}
+			visibleGroups = append(visibleGroups, securityGroup)
+		} else if peered && computeCfg.credentials.peerAddressSpaceFallback {
+			groupAddressPrefixes[key] = peerAddressPrefixes[remoteID]
+		} else {
+			azurePluginLogger().Info("Security group of a vnet not visible to the account is left out of rules",
+				"account", computeCfg.accountNamespacedName, "securityGroup", securityGroup.Name, "vnet", remoteID)
+			unresolvedGroups = append(unresolvedGroups, securityGroup)
+		}
+	}
+	if len(visibleVnetIDs) == 0 {
+		return groupAddressPrefixes, unresolvedGroups, nil
+	}
+
+	networkInterfaces, err := computeCfg.getNetworkInterfacesOfVnet(visibleVnetIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, securityGroup := range visibleGroups {
+		groupAddressPrefixes[getRemoteGroupKey(securityGroup)] = getAsgMemberAddressPrefixes(networkInterfaces,
+			securityGroup.Vpc, getCloudName(securityGroup, true))
+	}
+	return groupAddressPrefixes, unresolvedGroups, nil
+}
+
+// translateRemovedRules translates rules removed from the appliedTo group of translator, each one resolving security
+// groups of remote vnets to the address prefixes it was realized with, so that the rule is still found in the NSG
+// after the members of such a group changed.
+func (computeCfg *computeServiceConfig) translateRemovedRules(translator *nsgRuleTranslator,
+	rules []*cloudresource.CloudRule) ([]*armnetwork.SecurityRule, error) {
+	securityRules := make([]*armnetwork.SecurityRule, 0, len(rules))
+	for _, rule := range rules {
+		ruleTranslator := *translator
+		ruleTranslator.remoteGroupAddressPrefixes = computeCfg.realizedRemoteGroups.get(translator.appliedToGroupID,
+			rule, translator.remoteGroupAddressPrefixes)
+		ruleSecurityRules, err := translateToNsgSecurityRules(&ruleTranslator, []*cloudresource.CloudRule{rule})
+		if err != nil {
+			return nil, err
+		}
+		securityRules = append(securityRules, ruleSecurityRules...)
+	}
+	return securityRules, nil
+}
+
+// realizedRemoteGroups keeps the address prefixes to which the security groups of remote vnets referenced by realized
+// rules were resolved, keyed by getRealizedRuleKey and then by getRemoteGroupKey.
+type realizedRemoteGroups struct {
+	mutex    sync.Mutex
+	prefixes map[string]map[string][]*net.IPNet
+}
+
+func newRealizedRemoteGroups() *realizedRemoteGroups {
+	return &realizedRemoteGroups{prefixes: make(map[string]map[string][]*net.IPNet)}
+}
+
+// getRealizedRuleKey returns the key of a rule realized for an appliedTo group.
+func getRealizedRuleKey(appliedToGroupID *cloudresource.CloudResourceID, rule *cloudresource.CloudRule) string {
+	return strings.ToLower(appliedToGroupID.String()) + "/" + rule.GetHash()
+}
+
+// get returns remoteGroupAddressPrefixes, with the prefixes of the groups the rule was realized with in place of the
+// current ones.
+func (r *realizedRemoteGroups) get(appliedToGroupID *cloudresource.CloudResourceID, rule *cloudresource.CloudRule,
+	remoteGroupAddressPrefixes map[string][]*net.IPNet) map[string][]*net.IPNet {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	realized, found := r.prefixes[getRealizedRuleKey(appliedToGroupID, rule)]
+	if !found {
+		return remoteGroupAddressPrefixes
+	}
+	prefixes := make(map[string][]*net.IPNet, len(remoteGroupAddressPrefixes))
+	for key, groupPrefixes := range remoteGroupAddressPrefixes {
+		prefixes[key] = groupPrefixes
+	}
+	for key, groupPrefixes := range realized {
+		prefixes[key] = groupPrefixes
+	}
+	return prefixes
+}
+
+// update forgets the rules removed from the appliedTo group, and records the prefixes the added rules are realized
+// with.
+func (r *realizedRemoteGroups) update(appliedToGroupID *cloudresource.CloudResourceID, addRules,
+	rmRules []*cloudresource.CloudRule, remoteGroupAddressPrefixes map[string][]*net.IPNet) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, rule := range rmRules {
+		delete(r.prefixes, getRealizedRuleKey(appliedToGroupID, rule))
+	}
+	for _, rule := range addRules {
+		realized := make(map[string][]*net.IPNet)
+		for _, securityGroup := range getReferencedSecurityGroups([]*cloudresource.CloudRule{rule}) {
+			key := getRemoteGroupKey(securityGroup)
+			if groupPrefixes, found := remoteGroupAddressPrefixes[key]; found {
+				realized[key] = groupPrefixes
+			}
+		}
+		if len(realized) > 0 {
+			r.prefixes[getRealizedRuleKey(appliedToGroupID, rule)] = realized
+		}
+	}
+}
+
+// forget forgets all rules of the appliedTo group.
+func (r *realizedRemoteGroups) forget(appliedToGroupID *cloudresource.CloudResourceID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	prefix := strings.ToLower(appliedToGroupID.String()) + "/"
+	for key := range r.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.prefixes, key)
+		}
+	}
+}
+
+// getAsgMemberAddressPrefixes returns the private IPs of the IP configurations of network interfaces in the vnet which
+// have the ASG attached.
+func getAsgMemberAddressPrefixes(networkInterfaces []*networkInterfaceInternal, vnetID string,
+	cloudAsgName string) []*net.IPNet {
+	var prefixes []*net.IPNet
+	for _, networkInterface := range networkInterfaces {
+		if !strings.EqualFold(networkInterface.vnetID, vnetID) || networkInterface.Properties == nil {
+			continue
+		}
+		for _, ipConfig := range networkInterface.Properties.IPConfigurations {
+			if ipConfig.Properties == nil || emptyString(ipConfig.Properties.PrivateIPAddress) {
+				continue
+			}
+			for _, asg := range ipConfig.Properties.ApplicationSecurityGroups {
+				if asg.ID == nil {
+					continue
+				}
+				_, _, asgNameLowercase, err := extractFieldsFromAzureResourceID(strings.ToLower(*asg.ID))
+				if err != nil || asgNameLowercase != strings.ToLower(cloudAsgName) {
+					continue
+				}
+				if ip := net.ParseIP(*ipConfig.Properties.PrivateIPAddress); ip != nil {
+					prefixes = append(prefixes, getHostAddressPrefix(ip))
+				}
+				break
+			}
+		}
+	}
+	return prefixes
+}
+
+// getHostAddressPrefix returns the single address prefix of ip.
+func getHostAddressPrefix(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}
+}
+
 // removeReferencesToSecurityGroup removes rules attached to nsg which reference the ASG which is getting deleted.
 func (computeCfg *computeServiceConfig) removeReferencesToSecurityGroup(id *cloudresource.CloudResourceID, rgName string,
 	location string, membershiponly bool) error {
@@ -526,9 +865,9 @@ func (computeCfg *computeServiceConfig) removeReferencesToSecurityGroup(id *clou
 	var asgName string
 	vnetID := id.Vpc
 	if isPeer := computeCfg.ifPeerProcessing(vnetID); isPeer {
-		asgName = id.GetCloudName(false)
+		asgName = getCloudName(id, false)
 	} else {
-		asgName = id.GetCloudName(membershiponly)
+		asgName = getCloudName(id, membershiponly)
 	}
 	currentNsgRules := nsgObj.Properties.SecurityRules
 	var rulesToKeep []*armnetwork.SecurityRule
@@ -733,6 +1072,7 @@ func (computeCfg *computeServiceConfig) getATGroupView(nepheControllerATSGNameTo
 				Members:        nepheControllerATSGNameToCloudResourcesMap[atSgName],
 				IngressRules:   nepheControllerATSgNameToIngressRulesMap[atSgName],
 				EgressRules:    nepheControllerATSgNameToEgressRulesMap[atSgName],
+				CloudID:        nsgIDLowercase,
 			}
 			// If there are user rules needs to be removed, trick the sync to trigger a rule update by adding an empty valid rule.
 			// In case of no AT or NP for valid rule, it implies Nephe is not actively managing the Vnet, therefore user rules are ignored.
@@ -860,6 +1200,7 @@ func (computeCfg *computeServiceConfig) getAGGroupView(nepheControllerAGSgNameTo
 			Resource:       resource,
 			MembershipOnly: true,
 			Members:        nepheControllerAGSgNameToCloudResourcesMap[asgName],
+			CloudID:        strings.ToLower(*appSecurityGroup.ID),
 		}
 		enforcedSecurityCloudView = append(enforcedSecurityCloudView, groupSyncObj)
 	}
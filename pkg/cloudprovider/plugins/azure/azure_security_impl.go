@@ -19,13 +19,16 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/go-autorest/autorest/to"
+	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/types"
 
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
 // CreateSecurityGroup invokes cloud api and creates the cloud security group based on securityGroupIdentifier.
@@ -39,8 +42,14 @@ func (c *azureCloud) CreateSecurityGroup(securityGroupIdentifier *cloudresource.
 		azurePluginLogger().Info("Azure account not found managing virtual network", vnetID, "vnetID")
 		return nil, fmt.Errorf("azure account not found managing virtual network [%v]", vnetID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return nil, fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return nil, err
+	}
+	accCfg.LockVpcSecurity(vnetID)
+	defer accCfg.UnlockVpcSecurity(vnetID)
 
 	// extract resource-group-name from vnet ID
 	_, rgName, _, err := extractFieldsFromAzureResourceID(securityGroupIdentifier.Vpc)
@@ -63,19 +72,31 @@ func (c *azureCloud) CreateSecurityGroup(securityGroupIdentifier *cloudresource.
 		}
 
 		// create azure asg corresponding to AT sg.
-		cloudAsgName := securityGroupIdentifier.GetCloudName(false)
-		_, err = createOrGetApplicationSecurityGroup(computeService.asgAPIClient, location, rgName, cloudAsgName)
-		if err != nil {
-			return nil, fmt.Errorf("azure asg %v create failed for AT sg %v, reason: %w", cloudAsgName, securityGroupIdentifier.Name, err)
+		cloudAsgName := getCloudName(&securityGroupIdentifier.CloudResourceID, false)
+		asgID, found := computeService.asgRefs.get(vnetID, cloudAsgName)
+		if !found {
+			asgID, err = createOrGetApplicationSecurityGroup(computeService.asgAPIClient, location, rgName, cloudAsgName)
+			if err != nil {
+				return nil, fmt.Errorf("azure asg %v create failed for AT sg %v, reason: %w", cloudAsgName, securityGroupIdentifier.Name, err)
+			}
 		}
+		computeService.asgRefs.add(vnetID, cloudAsgName, securityGroupIdentifier.Name, asgID)
+		internal.SecurityMetrics.AddGroup(string(providerType), accCfg.GetNamespacedName().String(),
+			internal.SecurityGroupTypeNetworkSecurityGroup, &cloudresource.CloudResourceID{Name: cloudNsgName, Vpc: vnetID})
 	} else {
 		// create azure asg corresponding to AG sg.
-		cloudAsgName := securityGroupIdentifier.GetCloudName(true)
-		cloudSecurityGroupID, err = createOrGetApplicationSecurityGroup(computeService.asgAPIClient, location, rgName, cloudAsgName)
-		if err != nil {
-			return nil, fmt.Errorf("azure asg %v create failed for AG sg %v, reason: %w", cloudAsgName, securityGroupIdentifier.Name, err)
+		cloudAsgName := getCloudName(&securityGroupIdentifier.CloudResourceID, true)
+		var found bool
+		if cloudSecurityGroupID, found = computeService.asgRefs.get(vnetID, cloudAsgName); !found {
+			cloudSecurityGroupID, err = createOrGetApplicationSecurityGroup(computeService.asgAPIClient, location, rgName, cloudAsgName)
+			if err != nil {
+				return nil, fmt.Errorf("azure asg %v create failed for AG sg %v, reason: %w", cloudAsgName, securityGroupIdentifier.Name, err)
+			}
 		}
+		computeService.asgRefs.add(vnetID, cloudAsgName, securityGroupIdentifier.Name, cloudSecurityGroupID)
 	}
+	internal.SecurityMetrics.AddGroup(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeOf(membershipOnly), &securityGroupIdentifier.CloudResourceID)
 
 	return to.StringPtr(cloudSecurityGroupID), nil
 }
@@ -83,14 +104,25 @@ func (c *azureCloud) CreateSecurityGroup(securityGroupIdentifier *cloudresource.
 // UpdateSecurityGroupRules invokes cloud api and updates cloud security group with allRules.
 func (c *azureCloud) UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudresource.CloudResource,
 	addRules, rmRules []*cloudresource.CloudRule) error {
+	// invalid rules are rejected before calling cloud api, the valid rules are updated regardless.
+	addRules, invalidRulesErr := utils.SplitInvalidRules(providerType, appliedToGroupIdentifier, addRules)
+	if invalidRulesErr != nil && len(addRules) == 0 && len(rmRules) == 0 {
+		return invalidRulesErr
+	}
 	// find account managing the vnet and get compute service config
 	vnetID := appliedToGroupIdentifier.Vpc
 	accCfg, found := c.cloudCommon.GetCloudAccountByAccountId(&appliedToGroupIdentifier.AccountID)
 	if !found {
 		return fmt.Errorf("azure account not found managing virtual network [%v]", vnetID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return err
+	}
+	accCfg.LockVpcSecurity(vnetID)
+	defer accCfg.UnlockVpcSecurity(vnetID)
 
 	computeService := accCfg.GetServiceConfig().(*computeServiceConfig)
 	location := computeService.credentials.region
@@ -110,6 +142,11 @@ func (c *azureCloud) UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudres
 	tokens := strings.Split(appliedToGroupIdentifier.Vpc, "/")
 	vnetName := tokens[len(tokens)-1]
 	appliedToGroupPerVnetNsgName := getPerVnetDefaultNsgName(vnetName)
+	remoteGroupAddressPrefixes, unresolvedGroups, err := computeService.getRemoteVnetGroupAddressPrefixes(vnetID, addRules,
+		rmRules)
+	if err != nil {
+		return err
+	}
 	// convert to azure security rules and build effective rules to be applied to AT sg azure NSG
 	var rules []*armnetwork.SecurityRule
 	flag := 0
@@ -121,13 +158,13 @@ func (c *azureCloud) UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudres
 			for _, vnetVM := range vnetVMs {
 				azurePluginLogger().Info("Accessing VM network interfaces", "VM", vnetVM.Name)
 				if *vnetVM.VnetID == vnetID {
-					ruleIP = vnetVM.NetworkInterfaces[0].PrivateIps[0]
+					ruleIP = vnetVM.NetworkInterfaces[0].primaryPrivateIP()
 				}
 				flag = 1
 				break
 			}
 			rules, err = computeService.buildEffectivePeerNSGSecurityRulesToApply(&appliedToGroupIdentifier.CloudResourceID, addRules,
-				rmRules, appliedToGroupPerVnetNsgName, rgName, ruleIP)
+				rmRules, appliedToGroupPerVnetNsgName, rgName, ruleIP, remoteGroupAddressPrefixes)
 			if err != nil {
 				azurePluginLogger().Error(err, "fail to build effective rules to be applied")
 				return err
@@ -137,14 +174,38 @@ func (c *azureCloud) UpdateSecurityGroupRules(appliedToGroupIdentifier *cloudres
 	}
 	if flag == 0 {
 		rules, err = computeService.buildEffectiveNSGSecurityRulesToApply(&appliedToGroupIdentifier.CloudResourceID, addRules,
-			rmRules, appliedToGroupPerVnetNsgName, rgName)
+			rmRules, appliedToGroupPerVnetNsgName, rgName, remoteGroupAddressPrefixes)
 		if err != nil {
 			azurePluginLogger().Error(err, "fail to build effective rules to be applied")
 			return err
 		}
 	}
 	// update network security group with rules
-	return updateNetworkSecurityGroupRules(computeService.nsgAPIClient, location, rgName, appliedToGroupPerVnetNsgName, rules)
+	if err = updateNetworkSecurityGroupRules(computeService.nsgAPIClient, location, rgName, appliedToGroupPerVnetNsgName,
+		rules); err != nil {
+		return err
+	}
+	computeService.realizedRemoteGroups.update(&appliedToGroupIdentifier.CloudResourceID, addRules, rmRules,
+		remoteGroupAddressPrefixes)
+	internal.SecurityMetrics.SetRules(string(providerType), accCfg.GetNamespacedName().String(),
+		&appliedToGroupIdentifier.CloudResourceID,
+		countNepheRulesOfAtSg(rules, getCloudName(&appliedToGroupIdentifier.CloudResourceID, false)))
+	internal.SecurityMetrics.SetReconciled(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeAppliedTo, &appliedToGroupIdentifier.CloudResourceID, time.Now())
+	if len(unresolvedGroups) == 0 {
+		return invalidRulesErr
+	}
+	// rules are realized without the unresolved groups, which is reported along with the rules rejected as invalid.
+	unresolvedGroupsErr := &cloudresource.UnresolvedGroupsError{AppliedToGroup: appliedToGroupIdentifier.Name}
+	for _, securityGroup := range unresolvedGroups {
+		unresolvedGroupsErr.Groups = append(unresolvedGroupsErr.Groups, securityGroup.String())
+	}
+	return multierr.Append(invalidRulesErr, unresolvedGroupsErr)
+}
+
+// UpdateSecurityGroupRulesBatch invokes UpdateSecurityGroupRules for each appliedTo group in updates.
+func (c *azureCloud) UpdateSecurityGroupRulesBatch(updates []cloudresource.GroupRuleUpdate) error {
+	return utils.UpdateSecurityGroupRulesInBatch(updates, c.UpdateSecurityGroupRules)
 }
 
 // UpdateSecurityGroupMembers invokes cloud api and attaches/detaches nics to/from the cloud security group.
@@ -155,30 +216,85 @@ func (c *azureCloud) UpdateSecurityGroupMembers(securityGroupIdentifier *cloudre
 	if !found {
 		return fmt.Errorf("azure account not found managing virtual network [%v]", vnetID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return err
+	}
+	accCfg.LockVpcSecurity(vnetID)
+	defer accCfg.UnlockVpcSecurity(vnetID)
+
+	if accCfg.IsSecurityGroupMembershipUnchanged(securityGroupIdentifier, computeResourceIdentifier, membershipOnly) {
+		azurePluginLogger().V(1).Info("Security group members unchanged", "security group", securityGroupIdentifier.Name)
+		return nil
+	}
 
 	computeService := accCfg.GetServiceConfig().(*computeServiceConfig)
-	return computeService.updateSecurityGroupMembers(&securityGroupIdentifier.CloudResourceID, computeResourceIdentifier, membershipOnly)
+	if err := computeService.updateSecurityGroupMembers(&securityGroupIdentifier.CloudResourceID, computeResourceIdentifier,
+		membershipOnly, true); err != nil {
+		// members may be partially applied.
+		accCfg.ForgetSecurityGroupMembership(securityGroupIdentifier, membershipOnly)
+		return err
+	}
+	accCfg.SetSecurityGroupMembership(securityGroupIdentifier, computeResourceIdentifier, membershipOnly)
+	internal.SecurityMetrics.SetReconciled(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeOf(membershipOnly), &securityGroupIdentifier.CloudResourceID, time.Now())
+	return nil
 }
 
 // DeleteSecurityGroup invokes cloud api and deletes the cloud application security group.
+// Members are detached from the cloud security group first, and the security group is deleted only after verifying
+// that no network interface is attached to it anymore.
 func (c *azureCloud) DeleteSecurityGroup(securityGroupIdentifier *cloudresource.CloudResource, membershipOnly bool) error {
 	vnetID := securityGroupIdentifier.Vpc
 	accCfg, found := c.cloudCommon.GetCloudAccountByAccountId(&securityGroupIdentifier.AccountID)
 	if !found {
 		return fmt.Errorf("azure account not found managing virtual network [%v]", vnetID)
 	}
-	accCfg.LockMutex()
-	defer accCfg.UnlockMutex()
+	if accCfg.IsPaused() {
+		return fmt.Errorf("%w: %v", internal.ErrAccountPaused, *accCfg.GetNamespacedName())
+	}
+	if err := accCfg.CheckSecurityPermitted(); err != nil {
+		return err
+	}
+	accCfg.LockVpcSecurity(vnetID)
+	defer accCfg.UnlockVpcSecurity(vnetID)
+	accCfg.ForgetSecurityGroupMembership(securityGroupIdentifier, membershipOnly)
 
 	computeService := accCfg.GetServiceConfig().(*computeServiceConfig)
 	location := computeService.credentials.region
 
-	_ = computeService.updateSecurityGroupMembers(&securityGroupIdentifier.CloudResourceID, nil, membershipOnly)
+	var cloudAsgName string
+	if isPeer := computeService.ifPeerProcessing(vnetID); isPeer {
+		cloudAsgName = getCloudName(&securityGroupIdentifier.CloudResourceID, false)
+	} else {
+		cloudAsgName = getCloudName(&securityGroupIdentifier.CloudResourceID, membershipOnly)
+	}
+	// a shared asg is left on cloud, along with its members and rules, until the last logical group is deleted.
+	if computeService.asgRefs.release(vnetID, cloudAsgName, securityGroupIdentifier.Name) {
+		azurePluginLogger().V(1).Info("Azure asg still referenced, skip deletion", "asg", cloudAsgName, "vnetID", vnetID)
+		return nil
+	}
+
+	if err := computeService.updateSecurityGroupMembers(&securityGroupIdentifier.CloudResourceID, nil, membershipOnly,
+		false); err != nil {
+		// a not found asg or network interface has no members left to detach.
+		if !isNotFoundError(err) {
+			return fmt.Errorf("failed to detach members from azure asg %v, reason: %w", cloudAsgName, err)
+		}
+		azurePluginLogger().Info("Azure asg members already detached", "asg", cloudAsgName, "reason", err)
+	}
+	attachedNwIntfIDs, err := computeService.getNetworkInterfacesAttachedToAsg(vnetID, cloudAsgName)
+	if err != nil {
+		return fmt.Errorf("failed to verify members detached from azure asg %v, reason: %w", cloudAsgName, err)
+	}
+	if len(attachedNwIntfIDs) != 0 {
+		return fmt.Errorf("azure asg %v is still attached to network interfaces %v", cloudAsgName, attachedNwIntfIDs)
+	}
 
 	var rgName string
-	_, rgName, _, err := extractFieldsFromAzureResourceID(securityGroupIdentifier.Vpc)
+	_, rgName, _, err = extractFieldsFromAzureResourceID(securityGroupIdentifier.Vpc)
 	if err != nil {
 		return err
 	}
@@ -188,17 +304,21 @@ func (c *azureCloud) DeleteSecurityGroup(securityGroupIdentifier *cloudresource.
 		if err != nil {
 			return err
 		}
+		computeService.realizedRemoteGroups.forget(&securityGroupIdentifier.CloudResourceID)
 	}
 
-	var cloudAsgName string
-	if isPeer := computeService.ifPeerProcessing(vnetID); isPeer {
-		cloudAsgName = securityGroupIdentifier.GetCloudName(false)
-	} else {
-		cloudAsgName = securityGroupIdentifier.GetCloudName(membershipOnly)
+	if err = computeService.asgAPIClient.delete(context.Background(), rgName, cloudAsgName); err != nil {
+		return err
 	}
-	err = computeService.asgAPIClient.delete(context.Background(), rgName, cloudAsgName)
+	computeService.asgRefs.remove(vnetID, cloudAsgName)
+	internal.SecurityMetrics.DeleteGroup(string(providerType), accCfg.GetNamespacedName().String(),
+		internal.SecurityGroupTypeOf(membershipOnly), &securityGroupIdentifier.CloudResourceID)
+	return nil
+}
 
-	return err
+// Shutdown waits up to timeout for in-progress security operations, and those waiting on their vpc, to complete.
+func (c *azureCloud) Shutdown(timeout time.Duration) error {
+	return c.cloudCommon.Shutdown(timeout)
 }
 
 func (c *azureCloud) GetEnforcedSecurity() []cloudresource.SynchronizationContent {
@@ -231,13 +351,27 @@ func (c *azureCloud) GetEnforcedSecurity() []cloudresource.SynchronizationConten
 				azurePluginLogger().Info("Enforced-security-cloud-view GET for account skipped (account no longer exists)", "account", name)
 				return
 			}
+			// security groups of a paused account are reported as last seen, so that they are not recreated.
+			if accCfg.IsPaused() {
+				azurePluginLogger().V(1).Info("Enforced-security-cloud-view GET for account skipped (account paused)", "account", name)
+				sendCh <- accCfg.GetCachedEnforcedSecurity()
+				return
+			}
 
 			computeService := accCfg.GetServiceConfig().(*computeServiceConfig)
 			if err := computeService.waitForInventoryInit(internal.InventoryInitWaitDuration); err != nil {
 				azurePluginLogger().Error(err, "enforced-security-cloud-view GET for account skipped", "account", accCfg.GetNamespacedName())
 				return
 			}
-			sendCh <- computeService.getNepheControllerManagedSecurityGroupsCloudView()
+			cloudView := computeService.getNepheControllerManagedSecurityGroupsCloudView()
+			// a nil view indicates failure to fetch it from cloud, keep the previous metrics.
+			if cloudView != nil {
+				accCfg.CacheEnforcedSecurity(cloudView)
+				internal.SecurityMetrics.Sync(string(providerType), accCfg.GetNamespacedName().String(), cloudView)
+				// memberships drifted in cloud are re-applied after the view is synced, they must not be skipped.
+				accCfg.ResetSecurityGroupMemberships()
+			}
+			sendCh <- cloudView
 		}(accNamespacedNameCopy, ch)
 	}
 
@@ -257,20 +391,21 @@ func (computeCfg *computeServiceConfig) getNepheControllerManagedSecurityGroupsC
 
 	networkInterfaces, err := computeCfg.getNetworkInterfacesOfVnet(vnetIDs)
 	if err != nil {
-		return []cloudresource.SynchronizationContent{}
+		return nil
 	}
 
 	appliedToSgEnforcedView, err := computeCfg.processAndBuildATSgView(networkInterfaces)
 	if err != nil {
-		return []cloudresource.SynchronizationContent{}
+		return nil
 	}
 
 	addressGroupSgEnforcedView, err := computeCfg.processAndBuildAGSgView(networkInterfaces)
 	if err != nil {
-		return []cloudresource.SynchronizationContent{}
+		return nil
 	}
 
-	var enforcedSecurityCloudView []cloudresource.SynchronizationContent
+	enforcedSecurityCloudView := make([]cloudresource.SynchronizationContent, 0,
+		len(appliedToSgEnforcedView)+len(addressGroupSgEnforcedView))
 	enforcedSecurityCloudView = append(enforcedSecurityCloudView, appliedToSgEnforcedView...)
 	enforcedSecurityCloudView = append(enforcedSecurityCloudView, addressGroupSgEnforcedView...)
 
@@ -16,18 +16,26 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/seancfoley/ipaddress-go/ipaddr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -36,6 +44,7 @@ import (
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	"antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
 	"antrea.io/nephe/pkg/cloudprovider/utils"
 	"antrea.io/nephe/pkg/config"
 )
@@ -174,13 +183,17 @@ var _ = Describe("Azure Cloud Security", func() {
 			mockazureAsgWrapper = NewMockazureAsgWrapper(mockCtrl)
 			mockazureVirtualNetworksWrapper = NewMockazureVirtualNetworksWrapper(mockCtrl)
 			mockazureResourceGraph = NewMockazureResourceGraphWrapper(mockCtrl)
+			mockazurePermissions := NewMockazurePermissionsWrapper(mockCtrl)
 
-			mockAzureServiceHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any()).Return(mockazureService, nil).Times(1)
+			mockAzureServiceHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any(), gomock.Any()).Return(mockazureService, nil).Times(1)
 			mockazureService.EXPECT().networkInterfaces(gomock.Any()).Return(mockazureNwIntfWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().securityGroups(gomock.Any()).Return(mockazureNsgWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().applicationSecurityGroups(gomock.Any()).Return(mockazureAsgWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().virtualNetworks(gomock.Any()).Return(mockazureVirtualNetworksWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().resourceGraph().Return(mockazureResourceGraph, nil)
+			mockazureService.EXPECT().permissions(gomock.Any()).Return(mockazurePermissions, nil).AnyTimes()
+			mockazurePermissions.EXPECT().list(gomock.Any(), gomock.Any()).Return(
+				[]azurePermission{{Actions: []string{"*"}}}, nil).AnyTimes()
 			mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes()
 			mockazureResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).Return(getResourceGraphResult(), nil).AnyTimes()
 			atAsg := &network.ApplicationSecurityGroup{ID: &testATAsgID, Name: &atAsgID}
@@ -240,6 +253,10 @@ var _ = Describe("Azure Cloud Security", func() {
 			Expect(err).Should(BeNil())
 
 			accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+			// wait for the permission probe started at account add, which takes the account mutex once done.
+			Eventually(func() bool {
+				return meta.FindStatusCondition(accCfg.GetStatus().Conditions, crdv1alpha1.AccountConditionSecurityPermitted) != nil
+			}).Should(BeTrue())
 			serviceConfig := accCfg.GetServiceConfig()
 			selectorNamespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
 			inventory := serviceConfig.(*computeServiceConfig).GetCloudInventory()
@@ -397,6 +414,110 @@ var _ = Describe("Azure Cloud Security", func() {
 			})
 		})
 
+		Context("Detach policy", func() {
+			var (
+				webAppliedToGroupIdentifier *cloudresource.CloudResource
+				nwIntfID                    string
+				mockNwIntfWrapper           *MockazureNwIntfWrapper
+				computeService              *computeServiceConfig
+			)
+
+			BeforeEach(func() {
+				vnetID := strings.ToLower(testVnetID01)
+				webAppliedToGroupIdentifier = &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: "Web",
+						Vpc:  vnetID,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				webAsgName := webAppliedToGroupIdentifier.GetCloudName(false)
+				webAsg := network.ApplicationSecurityGroup{
+					ID: to.StringPtr(fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/"+
+						"applicationSecurityGroups/%v", testSubID, testRG, webAsgName)),
+					Name: &webAsgName,
+				}
+				nsgName := getPerVnetDefaultNsgName(strings.ToLower(testVnet01))
+				nsgIDAttached := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/"+
+					"networkSecurityGroups/%v", testSubID, testRG, nsgName)
+				nwIntfID = fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/networkInterfaces/nic1",
+					testSubID, testRG)
+				records := int64(1)
+
+				mockNwIntfWrapper = NewMockazureNwIntfWrapper(mockCtrl)
+				mockAsgWrapper := NewMockazureAsgWrapper(mockCtrl)
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().Return(
+					armresourcegraph.ClientResourcesResponse{QueryResponse: armresourcegraph.QueryResponse{
+						TotalRecords: &records, Count: &records,
+						Data: []interface{}{map[string]interface{}{"id": nwIntfID, "vnetId": vnetID}}}}, nil)
+				mockAsgWrapper.EXPECT().get(gomock.Any(), gomock.Any(), gomock.Any()).Return(webAsg, nil).AnyTimes()
+				mockNwIntfWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes().Return([]network.Interface{{
+					ID:   to.StringPtr(nwIntfID),
+					Tags: map[string]*string{webAsgName: to.StringPtr("true")},
+					Properties: &network.InterfacePropertiesFormat{
+						VirtualMachine:       &network.SubResource{ID: to.StringPtr("vm1")},
+						NetworkSecurityGroup: &network.SecurityGroup{ID: to.StringPtr(nsgIDAttached)},
+						IPConfigurations: []*network.InterfaceIPConfiguration{{
+							Properties: &network.InterfaceIPConfigurationPropertiesFormat{
+								Primary:                   to.BoolPtr(true),
+								ApplicationSecurityGroups: []*network.ApplicationSecurityGroup{{ID: webAsg.ID}},
+							},
+						}},
+					},
+				}}, nil)
+
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeService = accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeService.nwIntfAPIClient = mockNwIntfWrapper
+				computeService.asgAPIClient = mockAsgWrapper
+				computeService.resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should move member to default on detach by default", func() {
+				Expect(computeService.credentials.detachPolicy).To(Equal(crdv1alpha1.SecurityGroupDetachPolicyMoveToDefault))
+				mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+						Expect(*nwIntf.ID).To(Equal(nwIntfID))
+						Expect(nwIntf.Properties.NetworkSecurityGroup).To(BeNil())
+						Expect(nwIntf.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups).To(BeEmpty())
+						return nwIntf, nil
+					})
+
+				err := c.UpdateSecurityGroupMembers(webAppliedToGroupIdentifier, nil, false)
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should leave network security group as is on detach", func() {
+				computeService.credentials.detachPolicy = crdv1alpha1.SecurityGroupDetachPolicyLeaveUnattached
+				mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+						Expect(*nwIntf.ID).To(Equal(nwIntfID))
+						Expect(nwIntf.Properties.NetworkSecurityGroup).NotTo(BeNil())
+						Expect(nwIntf.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups).To(BeEmpty())
+						return nwIntf, nil
+					})
+
+				err := c.UpdateSecurityGroupMembers(webAppliedToGroupIdentifier, nil, false)
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should skip cloud update when security group members are unchanged", func() {
+				// the network interface stays attached in cloud, a second update would detach it again.
+				mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+						return nwIntf, nil
+					})
+
+				err := c.UpdateSecurityGroupMembers(webAppliedToGroupIdentifier, nil, false)
+				Expect(err).Should(BeNil())
+				err = c.UpdateSecurityGroupMembers(webAppliedToGroupIdentifier, []*cloudresource.CloudResource{}, false)
+				Expect(err).Should(BeNil())
+			})
+		})
+
 		Context("UpdateSecurityRules", func() {
 			It("Should update Security rules successfully", func() {
 				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
@@ -435,6 +556,493 @@ var _ = Describe("Azure Cloud Security", func() {
 				Expect(err).Should(BeNil())
 			})
 
+			It("Should advance the last reconcile timestamp after a successful update", func() {
+				provider := string(v1alpha1.AzureCloudProvider)
+				account := testAccountNamespacedName.String()
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     account,
+					CloudProvider: provider,
+				}
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							Protocol:  &testProtocol,
+							FromPort:  &testFromPort,
+							FromSrcIP: getFromSrcIP(testCidrStr),
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+				internal.SecurityMetrics.DeleteAccount(provider, account)
+				defer internal.SecurityMetrics.DeleteAccount(provider, account)
+				getReconciled := func() time.Time {
+					reconciledAt, found := internal.SecurityMetrics.GetReconciled(provider, account,
+						internal.SecurityGroupTypeAppliedTo, &webAddressGroupIdentifier03.CloudResourceID)
+					Expect(found).To(BeTrue())
+					return reconciledAt
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nsg, nil).Times(2)
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+				first := getReconciled()
+				err = c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+				second := getReconciled()
+				Expect(second.After(first)).To(BeTrue())
+				Expect(testutil.ToFloat64(internal.SecurityGroupLastReconcileGauge.WithLabelValues(account, provider,
+					string(internal.SecurityGroupTypeAppliedTo), strings.ToLower(webAddressGroupIdentifier03.CloudResourceID.String())))).
+					To(Equal(float64(second.UnixNano()) / float64(time.Second)))
+
+				// a failed update does not advance the timestamp.
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nsg, fmt.Errorf("update failed")).Times(1)
+				err = c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).ShouldNot(BeNil())
+				Expect(getReconciled()).To(Equal(second))
+
+				// a sync not finding the group forgets its timestamp.
+				internal.SecurityMetrics.Sync(provider, account, nil)
+				_, found := internal.SecurityMetrics.GetReconciled(provider, account,
+					internal.SecurityGroupTypeAppliedTo, &webAddressGroupIdentifier03.CloudResourceID)
+				Expect(found).To(BeFalse())
+				Expect(internal.SecurityGroupLastReconcileGauge.DeleteLabelValues(account, provider,
+					string(internal.SecurityGroupTypeAppliedTo), strings.ToLower(webAddressGroupIdentifier03.CloudResourceID.String()))).
+					To(BeFalse())
+			})
+
+			It("Should carry rule logging flag into Security rules", func() {
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							Protocol:      &testProtocol,
+							FromPort:      &testFromPort,
+							FromSrcIP:     getFromSrcIP(testCidrStr),
+							EnableLogging: true,
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						found := false
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionInbound ||
+								rule.Properties.SourceAddressPrefixes == nil {
+								continue
+							}
+							desc, ok := utils.ExtractCloudDescription(rule.Properties.Description)
+							Expect(ok).To(BeTrue())
+							Expect(desc.Logging).To(BeTrue())
+
+							cloudRules, err := convertFromAzureIngressSecurityRuleToCloudRule(*rule, atAsgName, testVnetID01, desc)
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(cloudRules).To(HaveLen(1))
+							Expect(cloudRules[0].Rule.(*cloudresource.IngressRule).EnableLogging).To(BeTrue())
+							found = true
+						}
+						Expect(found).To(BeTrue())
+					})
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should carry rule annotations into Security rules", func() {
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				annotations := map[string]string{"team": "web", "app.kubernetes.io/part-of": "shop"}
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							Protocol:  &testProtocol,
+							FromPort:  &testFromPort,
+							FromSrcIP: getFromSrcIP(testCidrStr),
+						}, NpNamespacedName: testAnpNamespace.String(), Annotations: annotations,
+					},
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						found := false
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionInbound ||
+								rule.Properties.SourceAddressPrefixes == nil {
+								continue
+							}
+							desc, ok := utils.ExtractCloudDescription(rule.Properties.Description)
+							Expect(ok).To(BeTrue())
+
+							cloudRules, err := convertFromAzureIngressSecurityRuleToCloudRule(*rule, atAsgName, testVnetID01, desc)
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(cloudRules).To(HaveLen(1))
+							Expect(cloudRules[0].NpNamespacedName).To(Equal(testAnpNamespace.String()))
+							Expect(cloudRules[0].Annotations).To(Equal(annotations))
+							found = true
+						}
+						Expect(found).To(BeTrue())
+					})
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should carry source port range into Security rules", func() {
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				srcPort, srcEndPort := 1000, 2000
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.EgressRule{
+							Protocol:   &testProtocol,
+							ToPort:     &testFromPort,
+							ToDstIP:    getFromSrcIP(testCidrStr),
+							SrcPort:    &srcPort,
+							SrcEndPort: &srcEndPort,
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						found := false
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionOutbound ||
+								rule.Properties.DestinationAddressPrefixes == nil {
+								continue
+							}
+							Expect(*rule.Properties.SourcePortRange).To(Equal("1000-2000"))
+
+							desc, ok := utils.ExtractCloudDescription(rule.Properties.Description)
+							Expect(ok).To(BeTrue())
+							cloudRules, err := convertFromAzureEgressSecurityRuleToCloudRule(*rule, atAsgName, testVnetID01, desc)
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(cloudRules).To(HaveLen(1))
+							Expect(cloudRules[0].Rule.(*cloudresource.EgressRule).SrcPort).To(Equal(&srcPort))
+							Expect(cloudRules[0].Rule.(*cloudresource.EgressRule).SrcEndPort).To(Equal(&srcEndPort))
+							found = true
+						}
+						Expect(found).To(BeTrue())
+					})
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should collapse a full source port range into any port", func() {
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				srcPort, srcEndPort := 0, 65535
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.EgressRule{
+							Protocol:   &testProtocol,
+							ToPort:     &testFromPort,
+							ToDstIP:    getFromSrcIP(testCidrStr),
+							SrcPort:    &srcPort,
+							SrcEndPort: &srcEndPort,
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						found := false
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionOutbound ||
+								rule.Properties.DestinationAddressPrefixes == nil {
+								continue
+							}
+							Expect(*rule.Properties.SourcePortRange).To(Equal("*"))
+
+							// an explicit full range on cloud is a duplicate of the any port rule.
+							cloudRule := *rule
+							cloudProperties := *rule.Properties
+							cloudProperties.SourcePortRange = to.StringPtr("0-65535")
+							cloudRule.Properties = &cloudProperties
+							_, duplicate := findSecurityRule([]*network.SecurityRule{normalizeAzureSecurityRule(rule)},
+								normalizeAzureSecurityRule(&cloudRule))
+							Expect(duplicate).To(BeTrue())
+							found = true
+						}
+						Expect(found).To(BeTrue())
+					})
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should keep the destination port range when reconverting a full source port range", func() {
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				srcPort, srcEndPort := 0, 65535
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.EgressRule{
+							Protocol:   &testProtocol,
+							ToPort:     &testToPort,
+							ToDstIP:    getFromSrcIP(testCidrStr),
+							SrcPort:    &srcPort,
+							SrcEndPort: &srcEndPort,
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						found := false
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionOutbound ||
+								rule.Properties.DestinationAddressPrefixes == nil {
+								continue
+							}
+							Expect(*rule.Properties.DestinationPortRange).To(Equal(strconv.Itoa(testToPort)))
+
+							// an explicit full source range on cloud reconverts into any source port, same destination port.
+							cloudRule := *rule
+							cloudProperties := *rule.Properties
+							cloudProperties.SourcePortRange = to.StringPtr("0-65535")
+							cloudRule.Properties = &cloudProperties
+							desc, ok := utils.ExtractCloudDescription(rule.Properties.Description)
+							Expect(ok).To(BeTrue())
+							cloudRules, err := convertFromAzureEgressSecurityRuleToCloudRule(cloudRule, atAsgName, testVnetID01, desc)
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(cloudRules).To(HaveLen(1))
+							egressRule := cloudRules[0].Rule.(*cloudresource.EgressRule)
+							Expect(egressRule.ToPort).To(Equal(&testToPort))
+							Expect(egressRule.SrcPort).To(BeNil())
+							Expect(egressRule.SrcEndPort).To(BeNil())
+
+							// a destination range is not normalized into any port, nor reconverted into any port.
+							cloudProperties.DestinationPortRange = to.StringPtr(fmt.Sprintf("%d-%d", testToPort, testToPort+10))
+							_, duplicate := findSecurityRule([]*network.SecurityRule{normalizeAzureSecurityRule(rule)},
+								normalizeAzureSecurityRule(&cloudRule))
+							Expect(duplicate).To(BeFalse())
+							_, err = convertFromAzureEgressSecurityRuleToCloudRule(cloudRule, atAsgName, testVnetID01, desc)
+							Expect(err).Should(HaveOccurred())
+							found = true
+						}
+						Expect(found).To(BeTrue())
+					})
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should split Security rules exceeding the maximum address prefixes per rule", func() {
+				defer cloudresource.SetMaxRuleAddressPrefixes(cloudresource.MaxRuleAddressPrefixes)
+				cloudresource.SetMaxRuleAddressPrefixes(2)
+
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				var fromSrcIP []*net.IPNet
+				expectedPrefixes := make(map[string]struct{})
+				for i := 1; i <= 5; i++ {
+					cidr := fmt.Sprintf("10.0.%d.0/24", i)
+					fromSrcIP = append(fromSrcIP, getFromSrcIP(cidr)...)
+					expectedPrefixes[cidr] = struct{}{}
+				}
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							Protocol:  &testProtocol,
+							FromPort:  &testFromPort,
+							FromSrcIP: fromSrcIP,
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						splitRules := 0
+						priorities := make(map[int32]struct{})
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionInbound ||
+								rule.Properties.SourceAddressPrefixes == nil {
+								continue
+							}
+							splitRules++
+							Expect(len(rule.Properties.SourceAddressPrefixes)).To(BeNumerically("<=", 2))
+							Expect(*rule.Properties.DestinationPortRange).To(Equal(strconv.Itoa(testFromPort)))
+							Expect(rule.Properties.DestinationApplicationSecurityGroups).To(HaveLen(1))
+							priorities[*rule.Properties.Priority] = struct{}{}
+							for _, prefix := range rule.Properties.SourceAddressPrefixes {
+								Expect(expectedPrefixes).To(HaveKey(*prefix))
+								delete(expectedPrefixes, *prefix)
+							}
+						}
+						Expect(splitRules).To(Equal(3))
+						Expect(priorities).To(HaveLen(3))
+						Expect(expectedPrefixes).To(BeEmpty())
+					})
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should allow egress to account allow CIDRs from every appliedTo group", func() {
+				dbAsgName := "dbapplicationsgID"
+				dbAsgID := "nephe-at-" + dbAsgName
+				testDBAsgID := strings.Replace(testATAsgID, atAsgID, dbAsgID, 1)
+				asglist = append(asglist, network.ApplicationSecurityGroup{ID: &testDBAsgID, Name: &dbAsgID})
+				allowCIDRs := []string{"10.10.0.0/16", "172.16.0.0/12", "10.10.0.0/16"}
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeService := accCfg.GetServiceConfig().(*computeServiceConfig)
+				var err error
+				computeService.credentials.egressAllowCIDRs, err = utils.ParseCIDRs(allowCIDRs)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				// returns the allow-list rules of each appliedTo group and the number of the other egress rules.
+				allowListRulesByAsg := func(rules []*network.SecurityRule) (map[string][]*network.SecurityRule, int) {
+					allowListRules := make(map[string][]*network.SecurityRule)
+					otherRules := 0
+					for _, rule := range rules {
+						if *rule.Properties.Direction != network.SecurityRuleDirectionOutbound ||
+							*rule.Properties.Priority == vnetToVnetDenyRulePriority {
+							continue
+						}
+						if !isEgressAllowListRule(rule) {
+							otherRules++
+							continue
+						}
+						Expect(rule.Properties.SourceApplicationSecurityGroups).To(HaveLen(1))
+						asgID := *rule.Properties.SourceApplicationSecurityGroups[0].ID
+						allowListRules[asgID] = append(allowListRules[asgID], rule)
+					}
+					return allowListRules, otherRules
+				}
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						nsg.Properties.SecurityRules = parameters.Properties.SecurityRules
+					})
+
+				groupIdentifiers := []*cloudresource.CloudResource{}
+				for _, name := range []string{atAsgName, dbAsgName} {
+					groupIdentifier := &cloudresource.CloudResource{
+						Type: cloudresource.CloudResourceTypeVM,
+						CloudResourceID: cloudresource.CloudResourceID{
+							Name: name,
+							Vpc:  testVnetID01,
+						},
+						AccountID:     testAccountNamespacedName.String(),
+						CloudProvider: string(v1alpha1.AzureCloudProvider),
+					}
+					groupIdentifiers = append(groupIdentifiers, groupIdentifier)
+					addRules := []*cloudresource.CloudRule{
+						{
+							Rule: &cloudresource.EgressRule{
+								Protocol: &testProtocol,
+								ToPort:   &testFromPort,
+								ToDstIP:  getFromSrcIP(testCidrStr),
+							}, NpNamespacedName: testAnpNamespace.String(),
+						},
+					}
+					err = c.UpdateSecurityGroupRules(groupIdentifier, addRules, []*cloudresource.CloudRule{})
+					Expect(err).Should(BeNil())
+				}
+
+				allowListRules, otherRules := allowListRulesByAsg(nsg.Properties.SecurityRules)
+				Expect(otherRules).To(Equal(2))
+				Expect(allowListRules).To(HaveLen(2))
+				for _, asgID := range []string{testATAsgID, testDBAsgID} {
+					Expect(allowListRules[asgID]).To(HaveLen(1))
+					rule := allowListRules[asgID][0]
+					Expect(*rule.Properties.Access).To(Equal(network.SecurityRuleAccessAllow))
+					Expect(*rule.Properties.Protocol).To(Equal(network.SecurityRuleProtocolAsterisk))
+					Expect(*rule.Properties.Priority).To(BeNumerically("<", vnetToVnetDenyRulePriority))
+					Expect(rule.Properties.DestinationAddressPrefixes).To(ConsistOf(to.StringPtr("10.10.0.0/16"),
+						to.StringPtr("172.16.0.0/12")))
+				}
+
+				// an existing allow-list rule is kept as is and not duplicated.
+				priority := *allowListRules[testATAsgID][0].Properties.Priority
+				err = c.UpdateSecurityGroupRules(groupIdentifiers[0], []*cloudresource.CloudRule{}, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+				allowListRules, otherRules = allowListRulesByAsg(nsg.Properties.SecurityRules)
+				Expect(otherRules).To(Equal(2))
+				Expect(allowListRules[testATAsgID]).To(HaveLen(1))
+				Expect(*allowListRules[testATAsgID][0].Properties.Priority).To(Equal(priority))
+
+				// a CIDR allowed by a policy rule with any protocol and port is not allowed again.
+				policyRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.EgressRule{
+							ToDstIP: getFromSrcIP("10.10.0.0/16"),
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						nsg.Properties.SecurityRules = parameters.Properties.SecurityRules
+					})
+				err = c.UpdateSecurityGroupRules(groupIdentifiers[0], policyRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+				allowListRules, otherRules = allowListRulesByAsg(nsg.Properties.SecurityRules)
+				Expect(otherRules).To(Equal(3))
+				Expect(allowListRules[testATAsgID]).To(HaveLen(1))
+				rule := allowListRules[testATAsgID][0]
+				var prefixes []string
+				if rule.Properties.DestinationAddressPrefix != nil {
+					prefixes = append(prefixes, *rule.Properties.DestinationAddressPrefix)
+				}
+				for _, prefix := range rule.Properties.DestinationAddressPrefixes {
+					prefixes = append(prefixes, *prefix)
+				}
+				Expect(prefixes).To(ConsistOf("172.16.0.0/12"))
+				Expect(allowListRules[testDBAsgID]).To(HaveLen(1))
+
+				// allow-list rules are removed once the account has no egress allow CIDRs.
+				computeService.credentials.egressAllowCIDRs = nil
+				err = c.UpdateSecurityGroupRules(groupIdentifiers[0], []*cloudresource.CloudRule{}, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+				allowListRules, otherRules = allowListRulesByAsg(nsg.Properties.SecurityRules)
+				Expect(otherRules).To(Equal(3))
+				Expect(allowListRules).NotTo(HaveKey(testATAsgID))
+				Expect(allowListRules[testDBAsgID]).To(HaveLen(1))
+			})
+
 			It("Should update IPv6 Security rules successfully", func() {
 				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
 					Type: cloudresource.CloudResourceTypeVM,
@@ -464,6 +1072,186 @@ var _ = Describe("Azure Cloud Security", func() {
 				Expect(err).Should(BeNil())
 			})
 
+			It("Should expand security groups in globally peered vnets to the remote address space when opted in", func() {
+				remoteVnetID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/virtualNetworks/%v",
+					"remoteSubscription", "remoteRG", "remoteVnet")
+				remoteCidr := "172.16.0.0/16"
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				remoteSg := cloudresource.CloudResourceID{Name: agAsgName, Vpc: remoteVnetID}
+
+				// Global peering to a vnet in another region and subscription, which is not managed by the account.
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				snapshot := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+				vnet := network.VirtualNetwork{
+					Name: &testVnet01,
+					ID:   &testVnetID01,
+					Properties: &network.VirtualNetworkPropertiesFormat{
+						VirtualNetworkPeerings: []*network.VirtualNetworkPeering{{
+							Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+								RemoteVirtualNetwork: &network.SubResource{ID: &remoteVnetID},
+								RemoteAddressSpace:   &network.AddressSpace{AddressPrefixes: []*string{&remoteCidr}},
+							},
+						}},
+					},
+				}
+				computeCfg.resourcesCache.UpdateSnapshot(&computeResourcesCacheSnapshot{snapshot.vms,
+					[]network.VirtualNetwork{vnet}, snapshot.managedVnetIDs, snapshot.vnetPeers})
+
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							Protocol:           &testProtocol,
+							FromPort:           &testFromPort,
+							FromSecurityGroups: []*cloudresource.CloudResourceID{&remoteSg},
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+
+				// the members of a vnet not visible to the account are unknown, the rule is not widened by default.
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionInbound {
+								continue
+							}
+							Expect(rule.Properties.SourceAddressPrefixes).To(BeNil())
+							Expect(rule.Properties.SourceApplicationSecurityGroups).To(BeNil())
+						}
+					})
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				var unresolvedGroupsErr *cloudresource.UnresolvedGroupsError
+				Expect(errors.As(err, &unresolvedGroupsErr)).To(BeTrue())
+				Expect(unresolvedGroupsErr.Groups).To(Equal([]string{remoteSg.String()}))
+
+				computeCfg.credentials.peerAddressSpaceFallback = true
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						found := false
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionInbound ||
+								rule.Properties.SourceAddressPrefixes == nil {
+								continue
+							}
+							Expect(rule.Properties.SourceApplicationSecurityGroups).To(BeNil())
+							Expect(*rule.Properties.SourceAddressPrefixes[0]).To(Equal(remoteCidr))
+							found = true
+						}
+						Expect(found).To(BeTrue())
+					})
+				err = c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should resolve security groups in peered vnets to the private IPs of their members", func() {
+				peerSg := &cloudresource.CloudResourceID{Name: agAsgName, Vpc: testVnetPeerID01}
+				peerAsgID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/"+
+					"applicationSecurityGroups/%v", testSubID, testRG, getCloudName(peerSg, true))
+				otherAsgID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/"+
+					"applicationSecurityGroups/%v", testSubID, testRG, "other")
+				memberIP, secondaryIP, otherIP := "10.10.0.4", "10.10.0.5", "10.10.0.6"
+				newNetworkInterface := func(vnetID string, asgIDs []string, ips ...string) *networkInterfaceInternal {
+					var asgs []*network.ApplicationSecurityGroup
+					for i := range asgIDs {
+						asgs = append(asgs, &network.ApplicationSecurityGroup{ID: &asgIDs[i]})
+					}
+					nwIntf := &networkInterfaceInternal{vnetID: vnetID}
+					nwIntf.Properties = &network.InterfacePropertiesFormat{}
+					for i := range ips {
+						nwIntf.Properties.IPConfigurations = append(nwIntf.Properties.IPConfigurations,
+							&network.InterfaceIPConfiguration{Properties: &network.InterfaceIPConfigurationPropertiesFormat{
+								PrivateIPAddress: &ips[i], ApplicationSecurityGroups: asgs}})
+					}
+					return nwIntf
+				}
+				networkInterfaces := []*networkInterfaceInternal{
+					newNetworkInterface(strings.ToLower(testVnetPeerID01), []string{otherAsgID, peerAsgID}, memberIP, secondaryIP),
+					newNetworkInterface(strings.ToLower(testVnetPeerID01), []string{otherAsgID}, otherIP),
+					// same ASG name in another vnet.
+					newNetworkInterface(strings.ToLower(testVnetID01), []string{peerAsgID}, otherIP),
+				}
+
+				prefixes := getAsgMemberAddressPrefixes(networkInterfaces, testVnetPeerID01, getCloudName(peerSg, true))
+				var prefixStrs []string
+				for _, prefix := range prefixes {
+					prefixStrs = append(prefixStrs, prefix.String())
+				}
+				Expect(prefixStrs).To(Equal([]string{memberIP + "/32", secondaryIP + "/32"}))
+
+				securityGroups, ips := resolveRemoteVnetSecurityGroups(
+					[]*cloudresource.CloudResourceID{peerSg, {Name: agAsgName, Vpc: testVnetID01}}, nil,
+					map[string][]*net.IPNet{getRemoteGroupKey(peerSg): prefixes})
+				Expect(securityGroups).To(HaveLen(1))
+				Expect(securityGroups[0].Vpc).To(Equal(testVnetID01))
+				Expect(ips).To(Equal(prefixes))
+			})
+
+			It("Should remove rules resolving security groups in peered vnets with the members they were realized with", func() {
+				appliedToGroupID := &cloudresource.CloudResourceID{Name: atAsgName, Vpc: testVnetID01}
+				peerSg := &cloudresource.CloudResourceID{Name: agAsgName, Vpc: testVnetPeerID01}
+				rule := &cloudresource.CloudRule{
+					Rule: &cloudresource.IngressRule{
+						Protocol:           &testProtocol,
+						FromPort:           &testFromPort,
+						FromSecurityGroups: []*cloudresource.CloudResourceID{peerSg},
+					}, NpNamespacedName: testAnpNamespace.String(),
+				}
+				prefixesOf := func(ips ...string) map[string][]*net.IPNet {
+					var prefixes []*net.IPNet
+					for _, ip := range ips {
+						_, prefix, _ := net.ParseCIDR(ip + "/32")
+						prefixes = append(prefixes, prefix)
+					}
+					return map[string][]*net.IPNet{getRemoteGroupKey(peerSg): prefixes}
+				}
+				sourcePrefixes := func(securityRules []*network.SecurityRule) []string {
+					var prefixes []string
+					for _, securityRule := range securityRules {
+						for _, prefix := range securityRule.Properties.SourceAddressPrefixes {
+							prefixes = append(prefixes, *prefix)
+						}
+					}
+					return prefixes
+				}
+				atAsgID := "atAsgID"
+				computeCfg := &computeServiceConfig{realizedRemoteGroups: newRealizedRemoteGroups()}
+				translator := &nsgRuleTranslator{
+					appliedToGroupID: appliedToGroupID,
+					atAsgMap: map[string]network.ApplicationSecurityGroup{
+						strings.ToLower(atAsgName): {ID: &atAsgID},
+					},
+					remoteGroupAddressPrefixes: prefixesOf("10.10.0.5"),
+				}
+				computeCfg.realizedRemoteGroups.update(appliedToGroupID, []*cloudresource.CloudRule{rule}, nil,
+					prefixesOf("10.10.0.4"))
+
+				// the members of the group changed since the rule was realized.
+				removed, err := computeCfg.translateRemovedRules(translator, []*cloudresource.CloudRule{rule})
+				Expect(err).Should(BeNil())
+				Expect(sourcePrefixes(removed)).To(Equal([]string{"10.10.0.4/32"}))
+				added, err := translateToNsgSecurityRules(translator, []*cloudresource.CloudRule{rule})
+				Expect(err).Should(BeNil())
+				Expect(sourcePrefixes(added)).To(Equal([]string{"10.10.0.5/32"}))
+
+				// the rule is realized again with the new members.
+				computeCfg.realizedRemoteGroups.update(appliedToGroupID, []*cloudresource.CloudRule{rule},
+					[]*cloudresource.CloudRule{rule}, translator.remoteGroupAddressPrefixes)
+				removed, err = computeCfg.translateRemovedRules(translator, []*cloudresource.CloudRule{rule})
+				Expect(err).Should(BeNil())
+				Expect(sourcePrefixes(removed)).To(Equal([]string{"10.10.0.5/32"}))
+
+				computeCfg.realizedRemoteGroups.forget(appliedToGroupID)
+				Expect(computeCfg.realizedRemoteGroups.prefixes).To(BeEmpty())
+			})
+
 			It("Should remove duplicate ingress security rules and update successfully", func() {
 				access := network.SecurityRuleAccessAllow
 				protocol := network.SecurityRuleProtocolTCP
@@ -518,7 +1306,7 @@ var _ = Describe("Azure Cloud Security", func() {
 						}, NpNamespacedName: testAnpNamespace.String(),
 					},
 				}
-				desc, _ := utils.GenerateCloudDescription(testAnpNamespace.String())
+				desc, _ := utils.GenerateCloudDescription(testAnpNamespace.String(), "")
 				nsgrules := []*network.SecurityRule{
 					{
 						ID: &nsgID,
@@ -641,7 +1429,7 @@ var _ = Describe("Azure Cloud Security", func() {
 						}, NpNamespacedName: testAnpNamespace.String(),
 					},
 				}
-				desc, _ := utils.GenerateCloudDescription(testAnpNamespace.String())
+				desc, _ := utils.GenerateCloudDescription(testAnpNamespace.String(), "")
 				nsgrules := []*network.SecurityRule{
 					{
 						ID: &nsgID,
@@ -686,29 +1474,369 @@ var _ = Describe("Azure Cloud Security", func() {
 						},
 					},
 				}
-
+
+				nsg = network.SecurityGroup{
+					Properties: &network.SecurityGroupPropertiesFormat{
+						SecurityRules: nsgrules,
+					},
+					ID:   &testNsgID,
+					Name: &nsgID,
+				}
+				asglist = []network.ApplicationSecurityGroup{
+					{ID: to.StringPtr(testAGAsgID + "1"), Name: to.StringPtr(agAsgID + "1")},
+					{ID: to.StringPtr(testAGAsgID + "2"), Name: to.StringPtr(agAsgID + "2")},
+					{ID: to.StringPtr(testATAsgID), Name: to.StringPtr(atAsgID)},
+				}
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						// 4 rules and 2 deny rule.
+						Expect(len(parameters.Properties.SecurityRules)).To(Equal(6))
+					})
+
+				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should update any protocol Security rules with wildcard ports and skip duplicates", func() {
+				access := network.SecurityRuleAccessAllow
+				protocol := network.SecurityRuleProtocolAsterisk
+				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							FromSrcIP: []*net.IPNet{{
+								IP:   net.ParseIP("2600:1f16:c77:a001:fb97:21b2:a8dc:dc60"),
+								Mask: net.CIDRMask(128, 128)},
+							},
+						}, NpNamespacedName: testAnpNamespace.String(),
+					}, {
+						// port is ignored for any protocol rule.
+						Rule: &cloudresource.IngressRule{
+							FromPort: &testFromPort,
+							FromSrcIP: []*net.IPNet{{
+								IP:   net.ParseIP("2600:1f16:c77:a001:fb97:21b2:a8dc:dc61"),
+								Mask: net.CIDRMask(128, 128)},
+							},
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+				desc, _ := utils.GenerateCloudDescription(testAnpNamespace.String(), "")
 				nsg = network.SecurityGroup{
 					Properties: &network.SecurityGroupPropertiesFormat{
-						SecurityRules: nsgrules,
+						SecurityRules: []*network.SecurityRule{
+							{
+								ID: &nsgID,
+								Properties: &network.SecurityRulePropertiesFormat{
+									Access:                               &access,
+									Protocol:                             &protocol,
+									DestinationApplicationSecurityGroups: []*network.ApplicationSecurityGroup{{ID: &testATAsgID}},
+									SourceAddressPrefixes:                []*string{to.StringPtr("2600:1f16:c77:a001:fb97:21b2:a8dc:dc60/128")},
+									Priority:                             &testPriority,
+									SourcePortRange:                      &testSourcePortRange,
+									DestinationPortRange:                 &testSourcePortRange,
+									Direction:                            &testDirection,
+									Description:                          &desc,
+								},
+							},
+						},
 					},
 					ID:   &testNsgID,
 					Name: &nsgID,
 				}
 				asglist = []network.ApplicationSecurityGroup{
-					{ID: to.StringPtr(testAGAsgID + "1"), Name: to.StringPtr(agAsgID + "1")},
-					{ID: to.StringPtr(testAGAsgID + "2"), Name: to.StringPtr(agAsgID + "2")},
 					{ID: to.StringPtr(testATAsgID), Name: to.StringPtr(atAsgID)},
 				}
 				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
 					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
-						// 4 rules and 2 deny rule.
-						Expect(len(parameters.Properties.SecurityRules)).To(Equal(6))
+						// existing rule, new rule and 2 deny rules.
+						Expect(len(parameters.Properties.SecurityRules)).To(Equal(4))
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Priority == vnetToVnetDenyRulePriority {
+								continue
+							}
+							Expect(*rule.Properties.Protocol).To(Equal(network.SecurityRuleProtocolAsterisk))
+							Expect(*rule.Properties.SourcePortRange).To(Equal(emptyPort))
+							Expect(*rule.Properties.DestinationPortRange).To(Equal(emptyPort))
+						}
 					})
 
 				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
 				Expect(err).Should(BeNil())
 			})
 
+			It("Should resolve security group of a vnet in another resource group to the private IPs of its members", func() {
+				webAppliedToGroupIdentifier := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				otherRG := "testRG2"
+				otherVnetID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/virtualNetworks/%v",
+					testSubID, otherRG, "testVnetB")
+				dbSg := cloudresource.CloudResourceID{Name: "db", Vpc: otherVnetID}
+				dbAsgID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/applicationSecurityGroups/%v",
+					testSubID, otherRG, getCloudName(&dbSg, true))
+				nwIntfID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/networkInterfaces/%v",
+					testSubID, otherRG, "db-nic")
+				memberIP := "10.20.0.4"
+
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				snapshot := computeCfg.resourcesCache.GetSnapshot().(*computeResourcesCacheSnapshot)
+				vnets := append(snapshot.vnets, network.VirtualNetwork{ID: &otherVnetID})
+				computeCfg.resourcesCache.UpdateSnapshot(&computeResourcesCacheSnapshot{snapshot.vms, vnets,
+					snapshot.managedVnetIDs, snapshot.vnetPeers})
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, _ armresourcegraph.QueryRequest) (armresourcegraph.ClientResourcesResponse, error) {
+						records := int64(1)
+						rows := []interface{}{map[string]interface{}{"id": nwIntfID, "vnetId": otherVnetID}}
+						return armresourcegraph.ClientResourcesResponse{QueryResponse: armresourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				mockNwIntfWrapper := NewMockazureNwIntfWrapper(mockCtrl)
+				mockNwIntfWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes().Return([]network.Interface{{
+					ID: &nwIntfID,
+					Properties: &network.InterfacePropertiesFormat{IPConfigurations: []*network.InterfaceIPConfiguration{{
+						Properties: &network.InterfaceIPConfigurationPropertiesFormat{
+							PrivateIPAddress:          &memberIP,
+							ApplicationSecurityGroups: []*network.ApplicationSecurityGroup{{ID: &dbAsgID}},
+						},
+					}}},
+				}}, nil)
+				computeCfg.nwIntfAPIClient = mockNwIntfWrapper
+
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							FromPort:           &testFromPort,
+							FromSecurityGroups: []*cloudresource.CloudResourceID{&dbSg},
+							Protocol:           &testProtocol,
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+				// the ASG of the referenced security group cannot be referenced by rules of the NSG of another vnet.
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						var srcAsgIDs, srcPrefixes []string
+						for _, rule := range parameters.Properties.SecurityRules {
+							if isDefaultDenyRule(rule) || *rule.Properties.Priority < ruleStartPriority {
+								continue
+							}
+							for _, asg := range rule.Properties.SourceApplicationSecurityGroups {
+								srcAsgIDs = append(srcAsgIDs, *asg.ID)
+							}
+							if rule.Properties.SourceAddressPrefix != nil {
+								srcPrefixes = append(srcPrefixes, *rule.Properties.SourceAddressPrefix)
+							}
+							for _, prefix := range rule.Properties.SourceAddressPrefixes {
+								srcPrefixes = append(srcPrefixes, *prefix)
+							}
+						}
+						Expect(srcAsgIDs).To(BeEmpty())
+						Expect(srcPrefixes).To(ConsistOf(memberIP + "/32"))
+					})
+
+				err := c.UpdateSecurityGroupRules(webAppliedToGroupIdentifier, addRules, []*cloudresource.CloudRule{})
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should update Security rules of different vnets in the same account concurrently", func() {
+				vnetIDs := []string{testVnetID01, testVnetID02}
+				var arrived sync.WaitGroup
+				arrived.Add(len(vnetIDs))
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(len(vnetIDs)).
+					DoAndReturn(func(_ context.Context, _, _ string, _ network.SecurityGroup) (network.SecurityGroup, error) {
+						// block until updates of all vnets are in progress, which fails if they are serialized.
+						arrived.Done()
+						allArrived := make(chan struct{})
+						go func() {
+							arrived.Wait()
+							close(allArrived)
+						}()
+						select {
+						case <-allArrived:
+							return nsg, nil
+						case <-time.After(5 * time.Second):
+							return nsg, fmt.Errorf("security rules updates serialized across vnets")
+						}
+					})
+
+				fromSrcIP := getFromSrcIP(testCidrStr)
+				var wg sync.WaitGroup
+				errs := make(chan error, len(vnetIDs))
+				for _, vnetID := range vnetIDs {
+					wg.Add(1)
+					go func(vnetID string) {
+						defer GinkgoRecover()
+						defer wg.Done()
+						appliedToGroup := &cloudresource.CloudResource{
+							Type:            cloudresource.CloudResourceTypeVM,
+							CloudResourceID: cloudresource.CloudResourceID{Name: atAsgName, Vpc: vnetID},
+							AccountID:       testAccountNamespacedName.String(),
+							CloudProvider:   string(v1alpha1.AzureCloudProvider),
+						}
+						addRules := []*cloudresource.CloudRule{
+							{
+								Rule: &cloudresource.IngressRule{
+									Protocol:  &testProtocol,
+									FromPort:  &testFromPort,
+									FromSrcIP: fromSrcIP,
+								}, NpNamespacedName: testAnpNamespace.String(),
+							},
+						}
+						errs <- c.UpdateSecurityGroupRules(appliedToGroup, addRules, []*cloudresource.CloudRule{})
+					}(vnetID)
+				}
+				wg.Wait()
+				close(errs)
+				for err := range errs {
+					Expect(err).Should(BeNil())
+				}
+			})
+
+			It("Should wait for in-flight Security rules update on shutdown", func() {
+				started := make(chan struct{})
+				release := make(chan struct{})
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _, _ string, _ network.SecurityGroup) (network.SecurityGroup, error) {
+						close(started)
+						<-release
+						return nsg, nil
+					})
+
+				appliedToGroup := &cloudresource.CloudResource{
+					Type:            cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{Name: atAsgName, Vpc: testVnetID01},
+					AccountID:       testAccountNamespacedName.String(),
+					CloudProvider:   string(v1alpha1.AzureCloudProvider),
+				}
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							Protocol:  &testProtocol,
+							FromPort:  &testFromPort,
+							FromSrcIP: getFromSrcIP(testCidrStr),
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+				updateErr := make(chan error, 1)
+				go func() {
+					updateErr <- c.UpdateSecurityGroupRules(appliedToGroup, addRules, []*cloudresource.CloudRule{})
+				}()
+				Eventually(started).Should(BeClosed())
+
+				// the in-flight update is reported when it outlives the shutdown timeout.
+				err := c.Shutdown(200 * time.Millisecond)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("1 security operations"))
+
+				// the in-flight update completes within the shutdown timeout.
+				go func() {
+					time.Sleep(200 * time.Millisecond)
+					close(release)
+				}()
+				Expect(c.Shutdown(5 * time.Second)).Should(Succeed())
+				Expect(<-updateErr).Should(BeNil())
+			})
+
+			It("Should reject invalid Security rules before calling cloud api", func() {
+				appliedToGroup := &cloudresource.CloudResource{
+					Type:            cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{Name: atAsgName, Vpc: testVnetID01},
+					AccountID:       testAccountNamespacedName.String(),
+					CloudProvider:   string(v1alpha1.AzureCloudProvider),
+				}
+				icmp, gre, tcp := 1, 47, 6
+				invalidPort, srcPort, srcEndPort := 70000, 2000, 1000
+				invalidRules := map[string]cloudresource.Rule{
+					"port on icmp rule": &cloudresource.IngressRule{
+						FromPort: &testFromPort,
+						Protocol: &icmp,
+					},
+					"unsupported protocol": &cloudresource.EgressRule{
+						Protocol: &gre,
+					},
+					"invalid port": &cloudresource.IngressRule{
+						FromPort: &invalidPort,
+						Protocol: &tcp,
+					},
+					"inverted source port range": &cloudresource.EgressRule{
+						Protocol:   &tcp,
+						SrcPort:    &srcPort,
+						SrcEndPort: &srcEndPort,
+					},
+					"cidr with bad mask": &cloudresource.IngressRule{
+						FromSrcIP: []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(64, 128)}},
+						Protocol:  &tcp,
+					},
+				}
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				for name, rule := range invalidRules {
+					err := c.UpdateSecurityGroupRules(appliedToGroup, []*cloudresource.CloudRule{{Rule: rule}},
+						[]*cloudresource.CloudRule{})
+					Expect(err).Should(HaveOccurred(), name)
+				}
+			})
+
+			It("Should update valid Security rules and reject invalid rules of the same update", func() {
+				appliedToGroup := &cloudresource.CloudResource{
+					Type:            cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{Name: atAsgName, Vpc: testVnetID01},
+					AccountID:       testAccountNamespacedName.String(),
+					CloudProvider:   string(v1alpha1.AzureCloudProvider),
+				}
+				gre := 47
+				invalidRule := &cloudresource.CloudRule{
+					Rule:             &cloudresource.EgressRule{Protocol: &gre, ToDstIP: getFromSrcIP(testCidrStr)},
+					NpNamespacedName: testAnpNamespace.String(),
+				}
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.EgressRule{
+							Protocol: &testProtocol,
+							ToPort:   &testFromPort,
+							ToDstIP:  getFromSrcIP(testCidrStr),
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+					invalidRule,
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+						count := 0
+						for _, rule := range parameters.Properties.SecurityRules {
+							if *rule.Properties.Direction != network.SecurityRuleDirectionOutbound ||
+								rule.Properties.DestinationAddressPrefixes == nil {
+								continue
+							}
+							Expect(*rule.Properties.Protocol).To(Equal(network.SecurityRuleProtocolTCP))
+							count++
+						}
+						Expect(count).To(Equal(1))
+					})
+				err := c.UpdateSecurityGroupRules(appliedToGroup, addRules, []*cloudresource.CloudRule{})
+				var invalidRulesErr *cloudresource.InvalidRulesError
+				Expect(errors.As(err, &invalidRulesErr)).To(BeTrue())
+				Expect(invalidRulesErr.Rejected).To(HaveLen(1))
+				Expect(invalidRulesErr.Rejected).To(HaveKey(invalidRule))
+			})
+
 			//  Creating cloud security rules without a description field is not allowed.
 			It("Should fail to update Security rules -- invalid namespacedname", func() {
 				webAddressGroupIdentifier03 := &cloudresource.CloudResource{
@@ -871,6 +1999,214 @@ var _ = Describe("Azure Cloud Security", func() {
 				err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
 				Expect(err).ShouldNot(BeNil())
 			})
+
+			It("Should report partial success of batch Security rules update", func() {
+				webAddressGroupIdentifier01 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				webAddressGroupIdentifier02 := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: atAsgName,
+						Vpc:  testVnetID03,
+					},
+					AccountID:     testAccountNamespacedNameNotExist.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+
+				addRules := []*cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							Protocol:  &testProtocol,
+							FromPort:  &testFromPort,
+							FromSrcIP: getFromSrcIP(testCidrStr),
+						}, NpNamespacedName: testAnpNamespace.String(),
+					},
+				}
+				updates := []cloudresource.GroupRuleUpdate{
+					{AppliedToGroup: webAddressGroupIdentifier01, AddRules: addRules},
+					{AppliedToGroup: webAddressGroupIdentifier02, AddRules: addRules},
+				}
+
+				mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nsg, nil).Times(1)
+				err := c.UpdateSecurityGroupRulesBatch(updates)
+				Expect(err).ShouldNot(BeNil())
+				batchErr, ok := err.(*cloudresource.GroupRuleUpdateBatchError)
+				Expect(ok).To(BeTrue())
+				Expect(batchErr.Succeeded).To(Equal([]cloudresource.CloudResource{*webAddressGroupIdentifier01}))
+				Expect(batchErr.Failed).To(HaveLen(1))
+				Expect(batchErr.Failed).To(HaveKey(*webAddressGroupIdentifier02))
+			})
+
+			Context("Deny rule placement", func() {
+				var webAddressGroupIdentifier03 *cloudresource.CloudResource
+
+				BeforeEach(func() {
+					webAddressGroupIdentifier03 = &cloudresource.CloudResource{
+						Type: cloudresource.CloudResourceTypeVM,
+						CloudResourceID: cloudresource.CloudResourceID{
+							Name: atAsgName,
+							Vpc:  testVnetID01,
+						},
+						AccountID:     testAccountNamespacedName.String(),
+						CloudProvider: string(v1alpha1.AzureCloudProvider),
+					}
+					mockazureNsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+						Do(func(_ context.Context, _, _ string, parameters network.SecurityGroup) {
+							nsg.Properties.SecurityRules = parameters.Properties.SecurityRules
+						})
+				})
+
+				// updates the Security rules twice, so that the second update starts from the rules of the first one, and
+				// returns the default deny and allow rules of each direction.
+				updateRules := func(placement crdv1alpha1.DenyRulePlacement) (map[network.SecurityRuleDirection]*network.SecurityRule,
+					map[network.SecurityRuleDirection][]*network.SecurityRule) {
+					accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+					accCfg.GetServiceConfig().(*computeServiceConfig).credentials.denyRulePlacement = placement
+					for _, port := range []int{testFromPort, testToPort} {
+						port := port
+						addRules := []*cloudresource.CloudRule{
+							{
+								Rule: &cloudresource.IngressRule{
+									Protocol:  &testProtocol,
+									FromPort:  &port,
+									FromSrcIP: getFromSrcIP(testCidrStr),
+								}, NpNamespacedName: testAnpNamespace.String(),
+							}, {
+								Rule: &cloudresource.EgressRule{
+									Protocol: &testProtocol,
+									ToPort:   &port,
+									ToDstIP:  getFromSrcIP(testCidrStr),
+								}, NpNamespacedName: testAnpNamespace.String(),
+							},
+						}
+						err := c.UpdateSecurityGroupRules(webAddressGroupIdentifier03, addRules, []*cloudresource.CloudRule{})
+						Expect(err).Should(BeNil())
+					}
+
+					denyRules := make(map[network.SecurityRuleDirection]*network.SecurityRule)
+					allowRules := make(map[network.SecurityRuleDirection][]*network.SecurityRule)
+					for _, rule := range nsg.Properties.SecurityRules {
+						direction := *rule.Properties.Direction
+						if isDefaultDenyRule(rule) {
+							Expect(denyRules).NotTo(HaveKey(direction))
+							denyRules[direction] = rule
+							continue
+						}
+						if *rule.Properties.Access == network.SecurityRuleAccessAllow &&
+							*rule.Properties.Priority >= ruleStartPriority {
+							allowRules[direction] = append(allowRules[direction], rule)
+						}
+					}
+					Expect(denyRules).To(HaveLen(2))
+					return denyRules, allowRules
+				}
+
+				It("Should place default deny rules at the priority floor", func() {
+					denyRules, allowRules := updateRules(crdv1alpha1.DenyRulePlacementPriorityFloor)
+					for direction, denyRule := range denyRules {
+						Expect(*denyRule.Properties.Priority).To(Equal(int32(vnetToVnetDenyRulePriority)))
+						Expect(allowRules[direction]).To(HaveLen(2))
+					}
+				})
+
+				It("Should place default deny rules immediately after allow rules", func() {
+					denyRules, allowRules := updateRules(crdv1alpha1.DenyRulePlacementAfterAllowRules)
+					for direction, denyRule := range denyRules {
+						Expect(allowRules[direction]).To(HaveLen(2))
+						lowestAllowPriority := int32(0)
+						for _, rule := range allowRules[direction] {
+							if *rule.Properties.Priority > lowestAllowPriority {
+								lowestAllowPriority = *rule.Properties.Priority
+							}
+						}
+						Expect(*denyRule.Properties.Priority).To(Equal(lowestAllowPriority + 1))
+						Expect(*denyRule.Properties.Priority).To(BeNumerically("<", vnetToVnetDenyRulePriority))
+						Expect(*denyRule.Properties.Access).To(Equal(network.SecurityRuleAccessDeny))
+					}
+				})
+			})
+
+			It("Should preserve intra-policy order of Security rules combined from multiple policies", func() {
+				otherAnpNamespace := &types.NamespacedName{Namespace: "test-anp-ns", Name: "test-anp-other"}
+				newRule := func(policy string, priority int32) *network.SecurityRule {
+					description, err := utils.GenerateCloudDescription(policy, "")
+					Expect(err).Should(BeNil())
+					direction := network.SecurityRuleDirectionInbound
+					rule := &network.SecurityRule{Properties: &network.SecurityRulePropertiesFormat{
+						Description: &description,
+						Direction:   &direction,
+					}}
+					if priority != 0 {
+						rule.Properties.Priority = &priority
+					}
+					return rule
+				}
+
+				existingRules := []*network.SecurityRule{
+					newRule(otherAnpNamespace.String(), ruleStartPriority),
+					newRule(testAnpNamespace.String(), ruleStartPriority+1),
+				}
+				// rules of the two policies interleave in the added rules.
+				anpRule01 := newRule(testAnpNamespace.String(), 0)
+				otherAnpRule := newRule(otherAnpNamespace.String(), 0)
+				anpRule02 := newRule(testAnpNamespace.String(), 0)
+				rules := updateSecurityRuleNameAndPriority(existingRules, []*network.SecurityRule{anpRule01, otherAnpRule,
+					anpRule02})
+				Expect(rules).To(HaveLen(5))
+
+				// added rules of a policy are ordered after its existing rules, in their given order.
+				Expect(*anpRule01.Properties.Priority).To(Equal(int32(ruleStartPriority + 2)))
+				Expect(*anpRule02.Properties.Priority).To(Equal(int32(ruleStartPriority + 3)))
+				Expect(*anpRule02.Name).To(Equal(fmt.Sprintf("%v-%v", ruleStartPriority+3, network.SecurityRuleDirectionInbound)))
+				Expect(*otherAnpRule.Properties.Priority).To(Equal(int32(ruleStartPriority + 4)))
+			})
+			It("Should assign independent priorities to ingress and egress Security rules", func() {
+				description, err := utils.GenerateCloudDescription(testAnpNamespace.String(), "")
+				Expect(err).Should(BeNil())
+				newRule := func(direction network.SecurityRuleDirection, priority int32) *network.SecurityRule {
+					rule := &network.SecurityRule{Properties: &network.SecurityRulePropertiesFormat{
+						Description: &description,
+						Direction:   &direction,
+					}}
+					if priority != 0 {
+						rule.Properties.Priority = &priority
+					}
+					return rule
+				}
+
+				// existing egress rules do not consume ingress priorities.
+				existingRules := []*network.SecurityRule{
+					newRule(network.SecurityRuleDirectionOutbound, ruleStartPriority),
+					newRule(network.SecurityRuleDirectionOutbound, ruleStartPriority+1),
+				}
+				const numRules = 50
+				var ingressRules, egressRules, newRules []*network.SecurityRule
+				for i := 0; i < numRules; i++ {
+					ingressRule := newRule(network.SecurityRuleDirectionInbound, 0)
+					egressRule := newRule(network.SecurityRuleDirectionOutbound, 0)
+					ingressRules = append(ingressRules, ingressRule)
+					egressRules = append(egressRules, egressRule)
+					newRules = append(newRules, ingressRule, egressRule)
+				}
+				rules := updateSecurityRuleNameAndPriority(existingRules, newRules)
+				Expect(rules).To(HaveLen(len(existingRules) + 2*numRules))
+
+				for i := 0; i < numRules; i++ {
+					ingressPriority := int32(ruleStartPriority + i)
+					Expect(*ingressRules[i].Properties.Priority).To(Equal(ingressPriority))
+					Expect(*ingressRules[i].Name).To(Equal(fmt.Sprintf("%v-%v", ingressPriority, network.SecurityRuleDirectionInbound)))
+					egressPriority := int32(ruleStartPriority + len(existingRules) + i)
+					Expect(*egressRules[i].Properties.Priority).To(Equal(egressPriority))
+					Expect(*egressRules[i].Name).To(Equal(fmt.Sprintf("%v-%v", egressPriority, network.SecurityRuleDirectionOutbound)))
+				}
+			})
 		})
 
 		Context("Update VM snapshot", func() {
@@ -939,6 +2275,292 @@ var _ = Describe("Azure Cloud Security", func() {
 				Expect(err).Should(BeNil())
 			})
 
+			Context("With attached members", func() {
+				var (
+					webAddressGroupIdentifier *cloudresource.CloudResource
+					webAsg                    network.ApplicationSecurityGroup
+					nwIntfIDs                 []string
+					attachedNwIntfs           map[string]bool
+					secondaryAttachedNwIntfs  map[string]bool
+					deletedNwIntfs            map[string]bool
+					// nwIntfsMutex guards the network interface maps, updated by concurrent detaches.
+					nwIntfsMutex      sync.Mutex
+					mockNwIntfWrapper *MockazureNwIntfWrapper
+					mockAsgWrapper    *MockazureAsgWrapper
+					mockResourceGraph *MockazureResourceGraphWrapper
+				)
+
+				BeforeEach(func() {
+					webAddressGroupIdentifier = &cloudresource.CloudResource{
+						Type: cloudresource.CloudResourceTypeVM,
+						CloudResourceID: cloudresource.CloudResourceID{
+							Name: "Web",
+							Vpc:  testVnetID01,
+						},
+						AccountID:     testAccountNamespacedName.String(),
+						CloudProvider: string(v1alpha1.AzureCloudProvider),
+					}
+					webAsgName := webAddressGroupIdentifier.GetCloudName(true)
+					webAsg = network.ApplicationSecurityGroup{
+						ID: to.StringPtr(fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/"+
+							"applicationSecurityGroups/%v", testSubID, testRG, webAsgName)),
+						Name: &webAsgName,
+					}
+					nwIntfIDs = nil
+					attachedNwIntfs = make(map[string]bool)
+					secondaryAttachedNwIntfs = make(map[string]bool)
+					deletedNwIntfs = make(map[string]bool)
+					var nwIntfRows []interface{}
+					for i := 1; i <= 2; i++ {
+						nwIntfID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/"+
+							"networkInterfaces/nic%d", testSubID, testRG, i)
+						nwIntfIDs = append(nwIntfIDs, nwIntfID)
+						attachedNwIntfs[nwIntfID] = true
+						nwIntfRows = append(nwIntfRows, map[string]interface{}{"id": nwIntfID, "vnetId": strings.ToLower(testVnetID01)})
+					}
+					records := int64(len(nwIntfRows))
+
+					mockNwIntfWrapper = NewMockazureNwIntfWrapper(mockCtrl)
+					mockAsgWrapper = NewMockazureAsgWrapper(mockCtrl)
+					mockResourceGraph = NewMockazureResourceGraphWrapper(mockCtrl)
+					mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().Return(
+						armresourcegraph.ClientResourcesResponse{QueryResponse: armresourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: nwIntfRows}}, nil)
+					mockAsgWrapper.EXPECT().get(gomock.Any(), gomock.Any(), gomock.Any()).Return(webAsg, nil).AnyTimes()
+					// network interfaces are built from the current attachment state on each list.
+					mockNwIntfWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes().DoAndReturn(
+						func(_ context.Context) ([]network.Interface, error) {
+							nwIntfsMutex.Lock()
+							defer nwIntfsMutex.Unlock()
+							var nwIntfs []network.Interface
+							for i, nwIntfID := range nwIntfIDs {
+								if deletedNwIntfs[nwIntfID] {
+									continue
+								}
+								var asgs []*network.ApplicationSecurityGroup
+								if attachedNwIntfs[nwIntfID] {
+									asgs = append(asgs, &network.ApplicationSecurityGroup{ID: webAsg.ID})
+								}
+								ipConfigs := []*network.InterfaceIPConfiguration{{
+									Properties: &network.InterfaceIPConfigurationPropertiesFormat{
+										Primary:                   to.BoolPtr(true),
+										ApplicationSecurityGroups: asgs,
+									},
+								}}
+								if secondaryAttachedNwIntfs[nwIntfID] {
+									ipConfigs = append(ipConfigs, &network.InterfaceIPConfiguration{
+										Properties: &network.InterfaceIPConfigurationPropertiesFormat{
+											Primary:                   to.BoolPtr(false),
+											ApplicationSecurityGroups: []*network.ApplicationSecurityGroup{{ID: webAsg.ID}},
+										},
+									})
+								}
+								nwIntfs = append(nwIntfs, network.Interface{
+									ID: to.StringPtr(nwIntfID),
+									Properties: &network.InterfacePropertiesFormat{
+										VirtualMachine:   &network.SubResource{ID: to.StringPtr(fmt.Sprintf("vm%d", i))},
+										IPConfigurations: ipConfigs,
+									},
+								})
+							}
+							return nwIntfs, nil
+						})
+
+					accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+					computeService := accCfg.GetServiceConfig().(*computeServiceConfig)
+					computeService.nwIntfAPIClient = mockNwIntfWrapper
+					computeService.asgAPIClient = mockAsgWrapper
+					computeService.resourceGraphAPIClient = mockResourceGraph
+				})
+
+				It("Should detach all members before deleting security group", func() {
+					mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+						DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+							nwIntfsMutex.Lock()
+							defer nwIntfsMutex.Unlock()
+							Expect(attachedNwIntfs[*nwIntf.ID]).To(BeTrue())
+							attachedNwIntfs[*nwIntf.ID] = len(nwIntf.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups) != 0
+							return nwIntf, nil
+						})
+					mockAsgWrapper.EXPECT().delete(gomock.Any(), gomock.Any(), *webAsg.Name).Times(1).
+						DoAndReturn(func(_ context.Context, _ string, _ string) error {
+							for _, nwIntfID := range nwIntfIDs {
+								Expect(attachedNwIntfs[nwIntfID]).To(BeFalse())
+							}
+							return nil
+						})
+
+					err := c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+					Expect(err).Should(BeNil())
+				})
+
+				It("Should not delete security group when members are still attached", func() {
+					// Cloud accepts the update but the network interface remains attached.
+					mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+						DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+							nwIntfsMutex.Lock()
+							defer nwIntfsMutex.Unlock()
+							if *nwIntf.ID == nwIntfIDs[0] {
+								attachedNwIntfs[*nwIntf.ID] = false
+							}
+							return nwIntf, nil
+						})
+					mockAsgWrapper.EXPECT().delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+					err := c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+					Expect(err).ShouldNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring(nwIntfIDs[1]))
+				})
+
+				It("Should treat members of a deleted network interface as detached", func() {
+					mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+						DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+							nwIntfsMutex.Lock()
+							defer nwIntfsMutex.Unlock()
+							if *nwIntf.ID == nwIntfIDs[1] {
+								deletedNwIntfs[*nwIntf.ID] = true
+								return network.Interface{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+							}
+							attachedNwIntfs[*nwIntf.ID] = false
+							return nwIntf, nil
+						})
+					mockAsgWrapper.EXPECT().delete(gomock.Any(), gomock.Any(), *webAsg.Name).Times(1).Return(nil)
+
+					err := c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+					Expect(err).Should(BeNil())
+				})
+
+				It("Should not delete security group when members fail to detach", func() {
+					mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+						DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+							nwIntfsMutex.Lock()
+							defer nwIntfsMutex.Unlock()
+							if *nwIntf.ID == nwIntfIDs[1] {
+								return network.Interface{}, &azcore.ResponseError{StatusCode: http.StatusInternalServerError}
+							}
+							attachedNwIntfs[*nwIntf.ID] = false
+							return nwIntf, nil
+						})
+					mockAsgWrapper.EXPECT().delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+					err := c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+					Expect(err).ShouldNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("failed to detach members"))
+				})
+
+				It("Should not delete security group attached to a secondary ip configuration", func() {
+					attachedNwIntfs[nwIntfIDs[1]] = false
+					secondaryAttachedNwIntfs[nwIntfIDs[1]] = true
+					mockNwIntfWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+						DoAndReturn(func(_ context.Context, _ string, _ string, nwIntf network.Interface) (network.Interface, error) {
+							nwIntfsMutex.Lock()
+							defer nwIntfsMutex.Unlock()
+							attachedNwIntfs[*nwIntf.ID] = false
+							return nwIntf, nil
+						})
+					mockAsgWrapper.EXPECT().delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+					err := c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+					Expect(err).ShouldNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring(nwIntfIDs[1]))
+				})
+			})
+
+			It("Should create shared asg once and delete it after the last reference", func() {
+				webAddressGroupIdentifier := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: "Web",
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				deleted := false
+				var webAsg network.ApplicationSecurityGroup
+				mockAsgWrapper := NewMockazureAsgWrapper(mockCtrl)
+				mockAsgWrapper.EXPECT().get(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, _ string, _ string) (network.ApplicationSecurityGroup, error) {
+						return webAsg, nil
+					})
+				mockAsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), webAddressGroupIdentifier.GetCloudName(true),
+					gomock.Any()).Times(1).DoAndReturn(func(_ context.Context, _ string, name string,
+					_ network.ApplicationSecurityGroup) (network.ApplicationSecurityGroup, error) {
+					webAsg = network.ApplicationSecurityGroup{ID: &testAGAsgID, Name: &name}
+					return webAsg, nil
+				})
+				mockAsgWrapper.EXPECT().delete(gomock.Any(), gomock.Any(), webAddressGroupIdentifier.GetCloudName(true)).Times(1).
+					DoAndReturn(func(_ context.Context, _ string, _ string) error {
+						deleted = true
+						return nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).asgAPIClient = mockAsgWrapper
+
+				// the same group is created from two selectors.
+				cloudSgID01, err := c.CreateSecurityGroup(webAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				cloudSgID02, err := c.CreateSecurityGroup(webAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(*cloudSgID02).To(Equal(*cloudSgID01))
+
+				err = c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(deleted).To(BeFalse())
+				err = c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(deleted).To(BeTrue())
+			})
+
+			It("Should share the asg of groups whose names only differ in case", func() {
+				webAddressGroupIdentifier := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: "Web",
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(v1alpha1.AzureCloudProvider),
+				}
+				collidingAddressGroupIdentifier := *webAddressGroupIdentifier
+				collidingAddressGroupIdentifier.Name = "WEB"
+				Expect(collidingAddressGroupIdentifier.GetCloudName(true)).To(Equal(webAddressGroupIdentifier.GetCloudName(true)))
+
+				deleted := false
+				var webAsg network.ApplicationSecurityGroup
+				mockAsgWrapper := NewMockazureAsgWrapper(mockCtrl)
+				mockAsgWrapper.EXPECT().get(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, _ string, _ string) (network.ApplicationSecurityGroup, error) {
+						return webAsg, nil
+					})
+				mockAsgWrapper.EXPECT().createOrUpdate(gomock.Any(), gomock.Any(), webAddressGroupIdentifier.GetCloudName(true),
+					gomock.Any()).Times(1).DoAndReturn(func(_ context.Context, _ string, name string,
+					_ network.ApplicationSecurityGroup) (network.ApplicationSecurityGroup, error) {
+					webAsg = network.ApplicationSecurityGroup{ID: &testAGAsgID, Name: &name}
+					return webAsg, nil
+				})
+				mockAsgWrapper.EXPECT().delete(gomock.Any(), gomock.Any(), webAddressGroupIdentifier.GetCloudName(true)).Times(1).
+					DoAndReturn(func(_ context.Context, _ string, _ string) error {
+						deleted = true
+						return nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).asgAPIClient = mockAsgWrapper
+
+				cloudSgID01, err := c.CreateSecurityGroup(webAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				cloudSgID02, err := c.CreateSecurityGroup(&collidingAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(*cloudSgID02).To(Equal(*cloudSgID01))
+
+				err = c.DeleteSecurityGroup(webAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(deleted).To(BeFalse())
+				err = c.DeleteSecurityGroup(&collidingAddressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(deleted).To(BeTrue())
+			})
+
 			It("Should fail to delete security group)", func() {
 				webAddressGroupIdentifier01 := &cloudresource.CloudResource{
 					Type: cloudresource.CloudResourceTypeVM,
@@ -954,6 +2576,132 @@ var _ = Describe("Azure Cloud Security", func() {
 				Expect(err).Should(Not(BeNil()))
 			})
 		})
+
+		Context("Security metrics", func() {
+			var (
+				provider = string(v1alpha1.AzureCloudProvider)
+				account  = testAccountNamespacedName.String()
+			)
+
+			BeforeEach(func() {
+				internal.SecurityMetrics.DeleteAccount(provider, account)
+			})
+
+			AfterEach(func() {
+				internal.SecurityMetrics.DeleteAccount(provider, account)
+			})
+
+			It("Should update security group gauges on create and delete", func() {
+				appliedToGroupIdentifier := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: "Web",
+						Vpc:  testVnetID01,
+					},
+					AccountID:     account,
+					CloudProvider: provider,
+				}
+				addressGroupIdentifier := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: "Db",
+						Vpc:  testVnetID01,
+					},
+					AccountID:     account,
+					CloudProvider: provider,
+				}
+				groupsGauge := func(sgType internal.SecurityGroupType) float64 {
+					return testutil.ToFloat64(internal.SecurityGroupsGauge.WithLabelValues(account, provider, string(sgType)))
+				}
+
+				_, err := c.CreateSecurityGroup(appliedToGroupIdentifier, false)
+				Expect(err).Should(BeNil())
+				_, err = c.CreateSecurityGroup(addressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				// creating an existing security group again must not be counted twice.
+				_, err = c.CreateSecurityGroup(addressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(groupsGauge(internal.SecurityGroupTypeAppliedTo)).To(Equal(float64(1)))
+				Expect(groupsGauge(internal.SecurityGroupTypeAddressGroup)).To(Equal(float64(1)))
+				Expect(groupsGauge(internal.SecurityGroupTypeNetworkSecurityGroup)).To(Equal(float64(1)))
+
+				internal.SecurityMetrics.SetRules(provider, account, &appliedToGroupIdentifier.CloudResourceID, 3)
+				Expect(testutil.ToFloat64(internal.SecurityRulesGauge.WithLabelValues(account, provider))).To(Equal(float64(3)))
+
+				// the address group was referenced twice, it is kept until both references are deleted.
+				err = c.DeleteSecurityGroup(addressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(groupsGauge(internal.SecurityGroupTypeAddressGroup)).To(Equal(float64(1)))
+				err = c.DeleteSecurityGroup(addressGroupIdentifier, true)
+				Expect(err).Should(BeNil())
+				Expect(groupsGauge(internal.SecurityGroupTypeAddressGroup)).To(Equal(float64(0)))
+				Expect(groupsGauge(internal.SecurityGroupTypeAppliedTo)).To(Equal(float64(1)))
+
+				err = c.DeleteSecurityGroup(appliedToGroupIdentifier, false)
+				Expect(err).Should(BeNil())
+				Expect(groupsGauge(internal.SecurityGroupTypeAppliedTo)).To(Equal(float64(0)))
+				Expect(testutil.ToFloat64(internal.SecurityRulesGauge.WithLabelValues(account, provider))).To(Equal(float64(0)))
+			})
+		})
+	})
+
+	Context("RuleTranslator", func() {
+		var (
+			appliedToGroupID cloudresource.CloudResourceID
+			translator       internal.RuleTranslator
+		)
+
+		BeforeEach(func() {
+			appliedToGroupID = cloudresource.CloudResourceID{Name: atAsgName, Vpc: testVnetID01}
+			translator = &nsgRuleTranslator{
+				appliedToGroupID: &appliedToGroupID,
+				agAsgMap:         map[string]network.ApplicationSecurityGroup{strings.ToLower(agAsgName): {ID: &testAGAsgID}},
+				atAsgMap:         map[string]network.ApplicationSecurityGroup{strings.ToLower(atAsgName): {ID: &testATAsgID}},
+			}
+		})
+
+		It("Should translate cloud rules to ingress and egress NSG security rules", func() {
+			toSg := cloudresource.CloudResourceID{Name: agAsgName, Vpc: testVnetID01}
+			rules := []*cloudresource.CloudRule{
+				{
+					Rule: &cloudresource.EgressRule{
+						Protocol:         &testProtocol,
+						ToPort:           &testToPort,
+						ToSecurityGroups: []*cloudresource.CloudResourceID{&toSg},
+					}, NpNamespacedName: testAnpNamespace.String(),
+				}, {
+					Rule: &cloudresource.IngressRule{
+						Protocol:  &testProtocol,
+						FromPort:  &testFromPort,
+						FromSrcIP: getFromSrcIP(testCidrStr),
+					}, NpNamespacedName: testAnpNamespace.String(),
+				},
+			}
+
+			providerRules, err := translator.Translate(rules)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(providerRules).To(HaveLen(2))
+
+			ingressRule, ok := providerRules[0].(*network.SecurityRule)
+			Expect(ok).To(BeTrue())
+			Expect(*ingressRule.Properties.Direction).To(Equal(network.SecurityRuleDirectionInbound))
+			Expect(*ingressRule.Properties.SourceAddressPrefixes[0]).To(Equal("192.168.1.0/24"))
+			Expect(*ingressRule.Properties.DestinationPortRange).To(Equal(strconv.Itoa(testFromPort)))
+			Expect(*ingressRule.Properties.DestinationApplicationSecurityGroups[0].ID).To(Equal(testATAsgID))
+
+			egressRule, ok := providerRules[1].(*network.SecurityRule)
+			Expect(ok).To(BeTrue())
+			Expect(*egressRule.Properties.Direction).To(Equal(network.SecurityRuleDirectionOutbound))
+			Expect(*egressRule.Properties.DestinationPortRange).To(Equal(strconv.Itoa(testToPort)))
+			Expect(*egressRule.Properties.SourceApplicationSecurityGroups[0].ID).To(Equal(testATAsgID))
+			Expect(*egressRule.Properties.DestinationApplicationSecurityGroups[0].ID).To(Equal(testAGAsgID))
+		})
+
+		It("Should fail to translate cloud rules of an appliedTo group without ASG", func() {
+			appliedToGroupID.Name = "unknown"
+			_, err := translator.Translate([]*cloudresource.CloudRule{})
+			Expect(err).Should(HaveOccurred())
+		})
 	})
 })
 
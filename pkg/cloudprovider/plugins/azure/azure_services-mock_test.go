@@ -23,6 +23,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	types "k8s.io/apimachinery/pkg/types"
 )
 
 // MockazureServiceClientCreateInterface is a mock of azureServiceClientCreateInterface interface.
@@ -78,6 +79,21 @@ func (mr *MockazureServiceClientCreateInterfaceMockRecorder) networkInterfaces(s
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "networkInterfaces", reflect.TypeOf((*MockazureServiceClientCreateInterface)(nil).networkInterfaces), subscriptionID)
 }
 
+// permissions mocks base method.
+func (m *MockazureServiceClientCreateInterface) permissions(subscriptionID string) (azurePermissionsWrapper, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "permissions", subscriptionID)
+	ret0, _ := ret[0].(azurePermissionsWrapper)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// permissions indicates an expected call of permissions.
+func (mr *MockazureServiceClientCreateInterfaceMockRecorder) permissions(subscriptionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "permissions", reflect.TypeOf((*MockazureServiceClientCreateInterface)(nil).permissions), subscriptionID)
+}
+
 // resourceGraph mocks base method.
 func (m *MockazureServiceClientCreateInterface) resourceGraph() (azureResourceGraphWrapper, error) {
 	m.ctrl.T.Helper()
@@ -147,16 +163,16 @@ func (m *MockazureServicesHelper) EXPECT() *MockazureServicesHelperMockRecorder
 }
 
 // newServiceSdkConfigProvider mocks base method.
-func (m *MockazureServicesHelper) newServiceSdkConfigProvider(accCfg *azureAccountConfig) (azureServiceClientCreateInterface, error) {
+func (m *MockazureServicesHelper) newServiceSdkConfigProvider(accountNamespacedName *types.NamespacedName, accCfg *azureAccountConfig) (azureServiceClientCreateInterface, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "newServiceSdkConfigProvider", accCfg)
+	ret := m.ctrl.Call(m, "newServiceSdkConfigProvider", accountNamespacedName, accCfg)
 	ret0, _ := ret[0].(azureServiceClientCreateInterface)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // newServiceSdkConfigProvider indicates an expected call of newServiceSdkConfigProvider.
-func (mr *MockazureServicesHelperMockRecorder) newServiceSdkConfigProvider(accCfg interface{}) *gomock.Call {
+func (mr *MockazureServicesHelperMockRecorder) newServiceSdkConfigProvider(accountNamespacedName, accCfg interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "newServiceSdkConfigProvider", reflect.TypeOf((*MockazureServicesHelper)(nil).newServiceSdkConfigProvider), accCfg)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "newServiceSdkConfigProvider", reflect.TypeOf((*MockazureServicesHelper)(nil).newServiceSdkConfigProvider), accountNamespacedName, accCfg)
 }
@@ -17,10 +17,14 @@ package azure
 import (
 	"fmt"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"k8s.io/apimachinery/pkg/types"
 
 	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 )
 
 // azureServiceClientCreateInterface provides interface to create azure service clients.
@@ -30,35 +34,74 @@ type azureServiceClientCreateInterface interface {
 	securityGroups(subscriptionID string) (azureNsgWrapper, error)
 	applicationSecurityGroups(subscriptionID string) (azureAsgWrapper, error)
 	virtualNetworks(subscriptionID string) (azureVirtualNetworksWrapper, error)
+	permissions(subscriptionID string) (azurePermissionsWrapper, error)
 	// Add any azure service api client creation methods here
 }
 
 // azureServiceSdkConfigProvider provides config required to create azure service clients.
 // Implements azureServiceClientCreateInterface interface.
 type azureServiceSdkConfigProvider struct {
-	cred *azidentity.ClientSecretCredential
+	cred    *azidentity.ClientSecretCredential
+	options *arm.ClientOptions
+	// fallbackOptions point clients at the fallback endpoints of the account, in order.
+	fallbackOptions []*arm.ClientOptions
 }
 
 // azureServicesHelper.
 type azureServicesHelper interface {
-	newServiceSdkConfigProvider(accCfg *azureAccountConfig) (azureServiceClientCreateInterface, error)
+	newServiceSdkConfigProvider(accountNamespacedName *types.NamespacedName, accCfg *azureAccountConfig) (
+		azureServiceClientCreateInterface, error)
 }
 
 type azureServicesHelperImpl struct{}
 
 // newServiceSdkConfigProvider returns config to create azure services clients.
-func (h *azureServicesHelperImpl) newServiceSdkConfigProvider(accCreds *azureAccountConfig) (
+func (h *azureServicesHelperImpl) newServiceSdkConfigProvider(accountNamespacedName *types.NamespacedName,
+	accCreds *azureAccountConfig) (
 	azureServiceClientCreateInterface, error) {
 	var err error
 
+	// Token requests and API calls of the account go through the account proxy, if configured.
+	var transport policy.Transporter
+	httpClient, err := utils.NewProxyHTTPClient(accCreds.proxy)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Azure HTTP client: %v", err)
+	}
+	if httpClient != nil {
+		transport = httpClient
+	}
+
 	// TODO: Expose an option in CPA to specify the cloud type, AzurePublic, AzureGovernment and AzureChina.
-	cred, err := azidentity.NewClientSecretCredential(accCreds.TenantID, accCreds.ClientID, accCreds.ClientKey, nil)
+	cred, err := azidentity.NewClientSecretCredential(accCreds.TenantID, accCreds.ClientID, accCreds.ClientKey,
+		&azidentity.ClientSecretCredentialOptions{ClientOptions: policy.ClientOptions{Transport: transport}})
 	if err != nil {
 		return nil, fmt.Errorf("error initializing Azure authorizer from credentials: %v", err)
 	}
 
+	// Record the remaining API quota reported by every response of the account, and count its failed calls.
+	options := &arm.ClientOptions{ClientOptions: policy.ClientOptions{
+		PerCallPolicies: []policy.Policy{
+			&rateLimitPolicy{account: accountNamespacedName.String()},
+			&apiErrorPolicy{account: accountNamespacedName.String()},
+		},
+		Transport: transport,
+	}}
 	configProvider := &azureServiceSdkConfigProvider{
-		cred: cred,
+		cred:    cred,
+		options: options,
+	}
+	for _, endpoint := range accCreds.fallbackEndpoints {
+		fallbackOptions := *options
+		fallbackOptions.Cloud = cloud.Configuration{
+			ActiveDirectoryAuthorityHost: cloud.AzurePublic.ActiveDirectoryAuthorityHost,
+			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+				cloud.ResourceManager: {
+					Endpoint: endpoint,
+					Audience: cloud.AzurePublic.Services[cloud.ResourceManager].Audience,
+				},
+			},
+		}
+		configProvider.fallbackOptions = append(configProvider.fallbackOptions, &fallbackOptions)
 	}
 	return configProvider, nil
 }
@@ -68,7 +111,7 @@ func newAzureServiceConfigs(accountNamespacedName *types.NamespacedName, accCred
 	azureServicesHelper := azureSpecificHelper.(azureServicesHelper)
 	azureAccountCredentials := accCredentials.(*azureAccountConfig)
 
-	azureServiceClientCreator, err := azureServicesHelper.newServiceSdkConfigProvider(azureAccountCredentials)
+	azureServiceClientCreator, err := azureServicesHelper.newServiceSdkConfigProvider(accountNamespacedName, azureAccountCredentials)
 	if err != nil {
 		return nil, err
 	}
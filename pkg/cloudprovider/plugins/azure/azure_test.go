@@ -16,14 +16,30 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	compute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	network "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	resourcegraph "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/cenkalti/backoff/v4"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -31,6 +47,12 @@ import (
 
 	"antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+	"antrea.io/nephe/pkg/cloudprovider/plugins/internal"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
+	"antrea.io/nephe/pkg/config"
+	"antrea.io/nephe/pkg/labels"
+	nephetypes "antrea.io/nephe/pkg/types"
 )
 
 var (
@@ -76,8 +98,11 @@ var _ = Describe("Azure", func() {
 			mockazureAsgWrapper             *MockazureAsgWrapper
 			mockazureVirtualNetworksWrapper *MockazureVirtualNetworksWrapper
 			mockazureResourceGraph          *MockazureResourceGraphWrapper
+			mockazurePermissions            *MockazurePermissionsWrapper
 			mockazureService                *MockazureServiceClientCreateInterface
 			testSelectorNamespacedName      = &types.NamespacedName{Namespace: "namespace01", Name: "selector-VnetID"}
+			grantedPermissions              []azurePermission
+			resourceGroupPermissions        map[string][]azurePermission
 
 			subIDs    []string
 			tenantIDs []string
@@ -144,20 +169,33 @@ var _ = Describe("Azure", func() {
 			mockazureAsgWrapper = NewMockazureAsgWrapper(mockCtrl)
 			mockazureVirtualNetworksWrapper = NewMockazureVirtualNetworksWrapper(mockCtrl)
 			mockazureResourceGraph = NewMockazureResourceGraphWrapper(mockCtrl)
+			mockazurePermissions = NewMockazurePermissionsWrapper(mockCtrl)
+			grantedPermissions = []azurePermission{{Actions: []string{"*"}}}
+			resourceGroupPermissions = nil
 
-			mockAzureServiceHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any()).Return(mockazureService, nil).AnyTimes()
+			mockAzureServiceHelper.EXPECT().newServiceSdkConfigProvider(gomock.Any(), gomock.Any()).Return(mockazureService, nil).AnyTimes()
 			mockazureService.EXPECT().networkInterfaces(gomock.Any()).Return(mockazureNwIntfWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().securityGroups(gomock.Any()).Return(mockazureNsgWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().applicationSecurityGroups(gomock.Any()).Return(mockazureAsgWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().virtualNetworks(gomock.Any()).Return(mockazureVirtualNetworksWrapper, nil).AnyTimes()
 			mockazureService.EXPECT().resourceGraph().Return(mockazureResourceGraph, nil).AnyTimes()
+			mockazureService.EXPECT().permissions(gomock.Any()).Return(mockazurePermissions, nil).AnyTimes()
 			mockazureResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).Return(getResourceGraphResult(), nil).AnyTimes()
+			mockazurePermissions.EXPECT().list(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+				func(_ context.Context, resourceGroup string) ([]azurePermission, error) {
+					if permissions, ok := resourceGroupPermissions[resourceGroup]; ok {
+						return permissions, nil
+					}
+					return grantedPermissions, nil
+				})
 
 			fakeClient, c = setupClientAndCloud(mockAzureServiceHelper, account, secret)
 
 		})
 
 		AfterEach(func() {
+			// waits for the permission probe of the account, which reads the permissions set by the next test.
+			c.RemoveProviderAccount(testAccountNamespacedName)
 			mockCtrl.Finish()
 		})
 
@@ -204,6 +242,7 @@ var _ = Describe("Azure", func() {
 				cloudInventory, err := c.GetCloudInventory(testAccountNamespacedName)
 				Expect(err).Should(BeNil())
 				Expect(len(cloudInventory.VpcMap)).Should(Equal(len(vnetIDs)))
+				c.RemoveProviderAccount(testAccountNamespacedName)
 			})
 			It("StopPoller cloud inventory poll on poller delete", func() {
 				vnetIDs := []string{"testVnetID01", "testVnetID02"}
@@ -233,6 +272,7 @@ var _ = Describe("Azure", func() {
 				errPolDel := c.ResetInventoryCache(testAccountNamespacedName)
 				Expect(errPolDel).Should(BeNil())
 				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).MinTimes(0)
+				c.RemoveProviderAccount(testAccountNamespacedName)
 			})
 		})
 		Context("VM Selector scenarios", func() {
@@ -244,8 +284,8 @@ var _ = Describe("Azure", func() {
 				vnetIDs = []string{testVnetID01}
 				var expectedQueryStrs []*string
 				expectedQueryStr, _ := getVMsByVnetIDsMatchQuery(vnetIDs,
-					subIDs, tenantIDs, locations)
-				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr)
+					nil, subIDs, tenantIDs, locations)
+				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr...)
 				vmSelector := []v1alpha1.VirtualMachineSelector{
 					{
 						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
@@ -265,7 +305,7 @@ var _ = Describe("Azure", func() {
 				Expect(filters).To(Equal(expectedQueryStrs))
 
 				c.RemoveAccountResourcesSelector(testAccountNamespacedName, testSelectorNamespacedName)
-				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-1]
+				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-len(expectedQueryStr)]
 				filters = getFilters(c, testSelectorNamespacedName)
 				Expect(len(filters)).To(Equal(len(expectedQueryStrs)))
 
@@ -276,8 +316,8 @@ var _ = Describe("Azure", func() {
 				vnetIDs = []string{testVnetID01, testVnetID02}
 				var expectedQueryStrs []*string
 				expectedQueryStr, _ := getVMsByVnetIDsMatchQuery(vnetIDs,
-					subIDs, tenantIDs, locations)
-				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr)
+					nil, subIDs, tenantIDs, locations)
+				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr...)
 				vmSelector := []v1alpha1.VirtualMachineSelector{
 					{
 						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
@@ -299,7 +339,7 @@ var _ = Describe("Azure", func() {
 				Expect(filters).To(Equal(expectedQueryStrs))
 
 				c.RemoveAccountResourcesSelector(testAccountNamespacedName, testSelectorNamespacedName)
-				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-1]
+				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-len(expectedQueryStr)]
 				filters = getFilters(c, testSelectorNamespacedName)
 				Expect(len(filters)).To(Equal(len(expectedQueryStrs)))
 			})
@@ -329,8 +369,8 @@ var _ = Describe("Azure", func() {
 				vmIDs = []string{testVMID01}
 				var expectedQueryStrs []*string
 				expectedQueryStr, _ := getVMsByVMIDsMatchQuery(vmIDs,
-					subIDs, tenantIDs, locations)
-				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr)
+					nil, subIDs, tenantIDs, locations)
+				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr...)
 				vmSelector := []v1alpha1.VirtualMachineSelector{
 					{
 						VMMatch: []v1alpha1.EntityMatch{{MatchID: testVMID01}},
@@ -347,7 +387,7 @@ var _ = Describe("Azure", func() {
 				Expect(filters).To(Equal(expectedQueryStrs))
 
 				c.RemoveAccountResourcesSelector(testAccountNamespacedName, testSelectorNamespacedName)
-				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-1]
+				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-len(expectedQueryStr)]
 				filters = getFilters(c, testSelectorNamespacedName)
 				Expect(len(filters)).To(Equal(len(expectedQueryStrs)))
 			})
@@ -356,8 +396,8 @@ var _ = Describe("Azure", func() {
 				vmNames := []string{testVM01}
 				var expectedQueryStrs []*string
 				expectedQueryStr, _ := getVMsByVMNamesMatchQuery(vmNames,
-					subIDs, tenantIDs, locations)
-				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr)
+					nil, subIDs, tenantIDs, locations)
+				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr...)
 
 				vmSelector := []v1alpha1.VirtualMachineSelector{
 					{
@@ -375,7 +415,7 @@ var _ = Describe("Azure", func() {
 				Expect(filters).To(Equal(expectedQueryStrs))
 
 				c.RemoveAccountResourcesSelector(testAccountNamespacedName, testSelectorNamespacedName)
-				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-1]
+				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-len(expectedQueryStr)]
 				filters = getFilters(c, testSelectorNamespacedName)
 				Expect(len(filters)).To(Equal(len(expectedQueryStrs)))
 			})
@@ -385,9 +425,9 @@ var _ = Describe("Azure", func() {
 				vmIDs = []string{testVMID01}
 				var vmNames []string
 				var expectedQueryStrs []*string
-				expectedQueryStr, _ := getVMsByVnetAndOtherMatchesQuery(vnetIDs, vmNames, vmIDs,
+				expectedQueryStr, _ := getVMsByVnetAndOtherMatchesQuery(vnetIDs, vmNames, vmIDs, nil,
 					subIDs, tenantIDs, locations)
-				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr)
+				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr...)
 				vmSelector := []v1alpha1.VirtualMachineSelector{
 					{
 						VMMatch:  []v1alpha1.EntityMatch{{MatchID: testVMID01}},
@@ -405,7 +445,7 @@ var _ = Describe("Azure", func() {
 				Expect(filters).To(Equal(expectedQueryStrs))
 
 				c.RemoveAccountResourcesSelector(testAccountNamespacedName, testSelectorNamespacedName)
-				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-1]
+				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-len(expectedQueryStr)]
 				filters = getFilters(c, testSelectorNamespacedName)
 				Expect(len(filters)).To(Equal(len(expectedQueryStrs)))
 			})
@@ -416,9 +456,9 @@ var _ = Describe("Azure", func() {
 				vmNames := []string{testVM01}
 				var expectedQueryStrs []*string
 
-				expectedQueryStr, _ := getVMsByVnetAndOtherMatchesQuery(vnetIDs, vmNames, vmIDs,
+				expectedQueryStr, _ := getVMsByVnetAndOtherMatchesQuery(vnetIDs, vmNames, vmIDs, nil,
 					subIDs, tenantIDs, locations)
-				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr)
+				expectedQueryStrs = append(expectedQueryStrs, expectedQueryStr...)
 				vmSelector := []v1alpha1.VirtualMachineSelector{
 					{
 						VMMatch:  []v1alpha1.EntityMatch{{MatchName: testVM01}},
@@ -436,11 +476,53 @@ var _ = Describe("Azure", func() {
 				Expect(filters).To(Equal(expectedQueryStrs))
 
 				c.RemoveAccountResourcesSelector(testAccountNamespacedName, testSelectorNamespacedName)
-				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-1]
+				expectedQueryStrs = expectedQueryStrs[:len(expectedQueryStrs)-len(expectedQueryStr)]
 				filters = getFilters(c, testSelectorNamespacedName)
 				Expect(len(filters)).To(Equal(len(expectedQueryStrs)))
 			})
 
+			It("Should match expected filter - tag presence match", func() {
+				vmSelector := []v1alpha1.VirtualMachineSelector{
+					{
+						TagMatch: []v1alpha1.TagMatch{{Key: "owner"}},
+					},
+				}
+
+				selector.Spec.VMSelector = vmSelector
+				selector.Name = "tag-presence"
+				testSelectorNamespacedName = &types.NamespacedName{Namespace: "namespace01", Name: selector.Name}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+
+				filters := getFilters(c, testSelectorNamespacedName)
+				Expect(filters).To(HaveLen(2))
+				Expect(*filters[0]).To(ContainSubstring("| where isnotnull(tags['owner'])"))
+				Expect(*filters[0]).NotTo(ContainSubstring("tostring(tags['owner'])"))
+			})
+
+			It("Should match expected filter - tag presence with tag value and vpcID match", func() {
+				vmSelector := []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						TagMatch: []v1alpha1.TagMatch{{Key: "owner"}, {Key: "env", Value: "prod"}},
+					},
+				}
+
+				selector.Spec.VMSelector = vmSelector
+				selector.Name = "tag-presence-value-vpcID"
+				testSelectorNamespacedName = &types.NamespacedName{Namespace: "namespace01", Name: selector.Name}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+
+				expectedQueryStr, err := getVMsByAttributeMatchesQuery([]string{testVnetID01}, nil, nil, nil,
+					[]string{"| where isnotnull(tags['owner'])", "| where tostring(tags['env']) == 'prod'"}, false,
+					nil, false, nil, nil, subIDs, tenantIDs, locations)
+				Expect(err).Should(BeNil())
+				filters := getFilters(c, testSelectorNamespacedName)
+				Expect(filters).To(Equal(expectedQueryStr))
+				Expect(*filters[0]).To(ContainSubstring(strings.ToLower(testVnetID01)))
+			})
+
 			It("Update Secret", func() {
 				credential2 := fmt.Sprintf(`{"subscriptionId": "%s",
 				"clientId": "%s",
@@ -464,77 +546,3945 @@ var _ = Describe("Azure", func() {
 			})
 		})
 
-		Context("VM Provider scenarios", func() {
-			It("Remove Provider Account", func() {
-				c.RemoveProviderAccount(testAccountNamespacedName)
+		Context("Allowed selector namespace scenarios", func() {
+			BeforeEach(func() {
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes()
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+			})
 
-				accCfg, ok := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
-				Expect(accCfg).Should(BeNil())
-				Expect(ok).To(Equal(false))
+			selectorNamespacedName := &types.NamespacedName{Namespace: "namespace01", Name: "selector-VnetID"}
+
+			It("Should reject selector from a disallowed namespace", func() {
+				account.Spec.AllowedSelectorNamespaces = []string{"namespace02"}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("selector namespace namespace01 is not allowed"))
+				Expect(getFilters(c, selectorNamespacedName)).Should(BeNil())
+			})
+			It("Should remove selectors of namespaces no longer allowed", func() {
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(getFilters(c, selectorNamespacedName)).ShouldNot(BeNil())
+
+				account.Spec.AllowedSelectorNamespaces = []string{"namespace02", selectorNamespacedName.Namespace}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(getFilters(c, selectorNamespacedName)).ShouldNot(BeNil())
+
+				account.Spec.AllowedSelectorNamespaces = []string{"namespace02"}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(getFilters(c, selectorNamespacedName)).Should(BeNil())
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				Expect(accCfg.GetServiceConfig().GetResourceFilterSelectors()).To(BeEmpty())
 			})
 		})
-	})
-})
 
-func getResourceGraphResult() resourcegraph.ClientResourcesResponse {
-	var records int64 = 0
-	result := resourcegraph.ClientResourcesResponse{
-		QueryResponse: resourcegraph.QueryResponse{
-			TotalRecords:    &records,
-			Count:           &records,
-			ResultTruncated: nil,
-			SkipToken:       nil,
-			Data:            nil,
-			Facets:          nil,
-		},
-	}
+		Context("Public IP scenarios", func() {
+			var (
+				publicVMRow  map[string]interface{}
+				privateVMRow map[string]interface{}
+			)
 
-	return result
-}
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				publicVMRow = map[string]interface{}{
+					"id":          testVMID01,
+					"name":        testVM01,
+					"vnetId":      testVnetID01,
+					"hasPublicIp": true,
+					"networkInterfaces": []interface{}{map[string]interface{}{
+						"id":         testVMID01 + "-nic",
+						"privateIps": []interface{}{"10.0.0.4"},
+						"publicIps":  []interface{}{"20.0.0.4"},
+						"vnetId":     testVnetID01,
+					}},
+				}
+				privateVMRow = map[string]interface{}{
+					"id":          testVMID01 + "-private",
+					"name":        testVM01 + "-private",
+					"vnetId":      testVnetID01,
+					"hasPublicIp": false,
+					"networkInterfaces": []interface{}{map[string]interface{}{
+						"id":         testVMID01 + "-private-nic",
+						"privateIps": []interface{}{"10.0.0.5"},
+						"vnetId":     testVnetID01,
+					}},
+				}
 
-func getFilters(c *azureCloud, selectorNamespacedName *types.NamespacedName) []*string {
-	accCfg, _ := c.cloudCommon.GetCloudAccountByName(&types.NamespacedName{Namespace: "namespace01", Name: "account01"})
-	serviceConfig := accCfg.GetServiceConfig()
-	if filters, found := serviceConfig.(*computeServiceConfig).computeFilters[*selectorNamespacedName]; found {
-		return filters
-	}
-	return nil
-}
-func setupClientAndCloud(mockAzureServiceHelper *MockazureServicesHelper, account *v1alpha1.CloudProviderAccount, secret *corev1.Secret) (
-	client.WithWatch, *azureCloud) {
-	fakeClient := fake.NewClientBuilder().Build()
-	c := newAzureCloud(mockAzureServiceHelper)
+				// Resource graph mock emulating the public IP filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						rows := []interface{}{publicVMRow, privateVMRow}
+						if strings.Contains(*query.Query, "| where publicIpCount > 0") {
+							rows = []interface{}{publicVMRow}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
 
-	err := fakeClient.Create(context.Background(), secret)
-	Expect(err).Should(BeNil())
-	err = c.AddProviderAccount(fakeClient, account)
-	Expect(err).Should(BeNil())
-	return fakeClient, c
-}
+			It("Should only discover VMs with public IP", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:    &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						HasPublicIP: true,
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
 
-func createVnetObject(vnetIDs []string) []network.VirtualNetwork {
-	var vnets []network.VirtualNetwork
-	for i := range vnetIDs {
-		name := vnetIDs[i]
-		key := "Name"
-		value := vnetIDs[i]
-		tags := make(map[string]*string)
-		tags[key] = &value
-		addressPrefix := make([]*string, 0)
-		prefix := "192.16.0.0/24"
-		addressPrefix = append(addressPrefix, &prefix)
-		vnet := &network.VirtualNetwork{
-			Location: &region,
-			ID:       &vnetIDs[i],
-			Name:     &name,
-			Tags:     tags,
-			Properties: &network.VirtualNetworkPropertiesFormat{
-				AddressSpace:           &network.AddressSpace{AddressPrefixes: addressPrefix},
-				VirtualNetworkPeerings: []*network.VirtualNetworkPeering{},
-			},
-		}
-		vnets = append(vnets, *vnet)
-	}
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vmMap := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vmMap).To(HaveLen(1))
+				for _, vm := range vmMap {
+					Expect(vm.Status.CloudId).To(Equal(strings.ToLower(testVMID01)))
+					Expect(vm.Status.HasPublicIP).To(BeTrue())
+				}
+			})
 
-	return vnets
-}
+			It("Should discover all VMs without public IP match", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vmMap := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vmMap).To(HaveLen(2))
+				hasPublicIP := map[string]bool{}
+				for _, vm := range vmMap {
+					hasPublicIP[vm.Status.CloudId] = vm.Status.HasPublicIP
+				}
+				Expect(hasPublicIP).To(Equal(map[string]bool{
+					strings.ToLower(testVMID01):              true,
+					strings.ToLower(testVMID01 + "-private"): false,
+				}))
+			})
+		})
+
+		Context("Network security group scenarios", func() {
+			var (
+				testNsgID = fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/networkSecurityGroups/%v",
+					testSubID, testRG, "testNsg01")
+				nsgVMRow   map[string]interface{}
+				noNsgVMRow map[string]interface{}
+			)
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				nsgVMRow = map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": testVnetID01,
+					"networkInterfaces": []interface{}{map[string]interface{}{
+						"id":         testVMID01 + "-nic",
+						"privateIps": []interface{}{"10.0.0.4"},
+						"vnetId":     testVnetID01,
+						"nsgIds":     []interface{}{strings.ToLower(testNsgID)},
+					}},
+				}
+				noNsgVMRow = map[string]interface{}{
+					"id":     testVMID01 + "-nonsg",
+					"name":   testVM01 + "-nonsg",
+					"vnetId": testVnetID01,
+					"networkInterfaces": []interface{}{map[string]interface{}{
+						"id":         testVMID01 + "-nonsg-nic",
+						"privateIps": []interface{}{"10.0.0.5"},
+						"vnetId":     testVnetID01,
+					}},
+				}
+
+				// Resource graph mock emulating the network security group filters of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						rows := []interface{}{nsgVMRow, noNsgVMRow}
+						if strings.Contains(*query.Query, "| where nsgCount == 0") {
+							rows = []interface{}{noNsgVMRow}
+						} else if strings.Contains(*query.Query, "| where nsgMatchCount > 0") &&
+							strings.Contains(*query.Query, strings.ToLower(testNsgID)) {
+							rows = []interface{}{nsgVMRow}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredNsgs := func() map[string][]string {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				nsgs := map[string][]string{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					nsgs[vm.Status.CloudId] = vm.Status.NetworkSecurityGroups
+				}
+				return nsgs
+			}
+
+			It("Should populate network security groups of discovered VMs", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				Expect(getDiscoveredNsgs()).To(Equal(map[string][]string{
+					strings.ToLower(testVMID01):            {strings.ToLower(testNsgID)},
+					strings.ToLower(testVMID01 + "-nonsg"): nil,
+				}))
+			})
+
+			It("Should only discover VMs without network security group", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						NsgMatch: &v1alpha1.NetworkSecurityGroupMatch{MatchNone: true},
+					},
+				}
+				Expect(getDiscoveredNsgs()).To(Equal(map[string][]string{
+					strings.ToLower(testVMID01 + "-nonsg"): nil,
+				}))
+			})
+
+			It("Should only discover VMs with the network security group", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						NsgMatch: &v1alpha1.NetworkSecurityGroupMatch{MatchID: testNsgID},
+					},
+				}
+				Expect(getDiscoveredNsgs()).To(Equal(map[string][]string{
+					strings.ToLower(testVMID01): {strings.ToLower(testNsgID)},
+				}))
+			})
+		})
+
+		Context("Subnet match scenarios", func() {
+			var (
+				testSubnetID01 = testVnetID01 + "/subnets/testSubnet01"
+				testSubnetID02 = testVnetID01 + "/subnets/testSubnet02"
+			)
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				subnetVMRows := map[string]map[string]interface{}{
+					testSubnetID01: {
+						"id":     testVMID01,
+						"name":   testVM01,
+						"vnetId": strings.ToLower(testVnetID01),
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + "-nic",
+							"privateIps": []interface{}{"10.0.1.4"},
+							"vnetId":     strings.ToLower(testVnetID01),
+						}},
+					},
+					testSubnetID02: {
+						"id":     testVMID01 + "-subnet02",
+						"name":   testVM01 + "-subnet02",
+						"vnetId": strings.ToLower(testVnetID01),
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + "-subnet02-nic",
+							"privateIps": []interface{}{"10.0.2.4"},
+							"vnetId":     strings.ToLower(testVnetID01),
+						}},
+					},
+				}
+
+				// Resource graph mock emulating the subnet filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						for subnetID, row := range subnetVMRows {
+							if !strings.Contains(*query.Query, "| where subnetId in (") ||
+								strings.Contains(*query.Query, fmt.Sprintf("%q", strings.ToLower(subnetID))) {
+								rows = append(rows, row)
+							}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should only discover VMs in the subnet", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:    &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						SubnetMatch: &v1alpha1.EntityMatch{MatchID: testSubnetID01},
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				filters := getFilters(c, &types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name})
+				Expect(filters).To(HaveLen(2))
+				Expect(*filters[0]).To(ContainSubstring(fmt.Sprintf("| where subnetId in (%q)", strings.ToLower(testSubnetID01))))
+
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vms).To(HaveLen(1))
+				for _, vm := range vms {
+					Expect(vm.Status.CloudId).To(Equal(strings.ToLower(testVMID01)))
+				}
+				Expect(inventory.VpcMap[strings.ToLower(testVnetID01)].Status.Managed).To(BeTrue())
+			})
+		})
+
+		Context("VM size scenarios", func() {
+			var (
+				d4VMRow map[string]interface{}
+				b2VMRow map[string]interface{}
+			)
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, size string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":         testVMID01 + suffix,
+						"name":       testVM01 + suffix,
+						"vnetId":     testVnetID01,
+						"properties": map[string]interface{}{"hardwareProfile": map[string]interface{}{"vmSize": size}},
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				d4VMRow = getVMRow("-d4", "Standard_D4s_v3", "10.0.0.4")
+				b2VMRow = getVMRow("-b2", "Standard_B2s", "10.0.0.5")
+
+				// Resource graph mock emulating the size prefix filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						rows := []interface{}{d4VMRow, b2VMRow}
+						if strings.Contains(*query.Query, "tostring(properties.hardwareProfile.vmSize) startswith 'Standard_D'") {
+							rows = []interface{}{d4VMRow}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredSizes := func() map[string]string {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				sizes := map[string]string{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					sizes[vm.Status.CloudId] = vm.Status.Size
+				}
+				return sizes
+			}
+
+			It("Should only discover VMs matching the size prefix", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:  &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						SizeMatch: "Standard_D*",
+					},
+				}
+				Expect(getDiscoveredSizes()).To(Equal(map[string]string{
+					strings.ToLower(testVMID01 + "-d4"): "Standard_D4s_v3",
+				}))
+			})
+
+			It("Should build size filters for exact sizes and glob patterns", func() {
+				Expect(buildSizeFilter("Standard_B2s")).To(Equal(
+					"| where tostring(properties.hardwareProfile.vmSize) =~ 'Standard_B2s'"))
+				Expect(buildSizeFilter("Standard_D*_v3")).To(Equal(
+					`| where tostring(properties.hardwareProfile.vmSize) matches regex '(?i)^Standard_D.*_v3$'`))
+				Expect(buildSizeFilter("Standard_D?s.v3")).To(Equal(
+					`| where tostring(properties.hardwareProfile.vmSize) matches regex '(?i)^Standard_D.s\\.v3$'`))
+			})
+		})
+
+		Context("Last modified time scenarios", func() {
+			var vmRows []map[string]interface{}
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     testVMID01 + suffix,
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				recentVMRow := getVMRow("-recent", "10.0.0.4")
+				recentVMRow["lastModifiedAt"] = time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+				staleVMRow := getVMRow("-stale", "10.0.0.5")
+				staleVMRow["lastModifiedAt"] = time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+				vmRows = []map[string]interface{}{recentVMRow, staleVMRow, getVMRow("-unknown", "10.0.0.6")}
+
+				// Resource graph mock emulating the last modified time filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						for _, row := range vmRows {
+							if strings.Contains(*query.Query, "| where lastModifiedAt >= ago(3600s)") {
+								lastModifiedAt, ok := row["lastModifiedAt"].(string)
+								if !ok {
+									continue
+								}
+								if t, _ := time.Parse(time.RFC3339, lastModifiedAt); time.Since(t) > time.Hour {
+									continue
+								}
+							}
+							rows = append(rows, row)
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredVMs := func() map[string]*runtimev1alpha1.VirtualMachine {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := map[string]*runtimev1alpha1.VirtualMachine{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					vms[vm.Status.CloudId] = vm
+				}
+				return vms
+			}
+
+			It("Should expose last modified time of VMs when available", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(3))
+				recentVM := vms[strings.ToLower(testVMID01+"-recent")]
+				Expect(recentVM).NotTo(BeNil())
+				Expect(recentVM.Status.LastModifiedAt).NotTo(BeNil())
+				Expect(recentVM.Status.LastModifiedAt.Time).To(BeTemporally("~", time.Now().Add(-10*time.Minute), time.Minute))
+				unknownVM := vms[strings.ToLower(testVMID01+"-unknown")]
+				Expect(unknownVM).NotTo(BeNil())
+				Expect(unknownVM.Status.LastModifiedAt).To(BeNil())
+			})
+
+			It("Should select VMs modified within the window", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:              &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						ModifiedWithinSeconds: 3600,
+					},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(1))
+				Expect(vms).To(HaveKey(strings.ToLower(testVMID01 + "-recent")))
+			})
+		})
+
+		Context("Encryption at host scenarios", func() {
+			var vmRows []map[string]interface{}
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     testVMID01 + suffix,
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				enabledVMRow := getVMRow("-enabled", "10.0.0.4")
+				enabledVMRow["encryptionAtHost"] = true
+				disabledVMRow := getVMRow("-disabled", "10.0.0.5")
+				disabledVMRow["encryptionAtHost"] = false
+				// VM without the setting, reported with encryption at host disabled.
+				unsetVMRow := getVMRow("-unset", "10.0.0.6")
+				vmRows = []map[string]interface{}{enabledVMRow, disabledVMRow, unsetVMRow}
+
+				// Resource graph mock emulating the encryption at host filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						for _, row := range vmRows {
+							if strings.Contains(*query.Query, "| where encryptionAtHost == true") && row["encryptionAtHost"] != true {
+								continue
+							}
+							rows = append(rows, row)
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredVMs := func() map[string]*runtimev1alpha1.VirtualMachine {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := map[string]*runtimev1alpha1.VirtualMachine{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					vms[vm.Status.CloudId] = vm
+				}
+				return vms
+			}
+
+			It("Should expose encryption at host status of VMs", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(3))
+				Expect(vms[strings.ToLower(testVMID01+"-enabled")].Status.EncryptionAtHost).To(BeTrue())
+				Expect(vms[strings.ToLower(testVMID01+"-disabled")].Status.EncryptionAtHost).To(BeFalse())
+				Expect(vms[strings.ToLower(testVMID01+"-unset")].Status.EncryptionAtHost).To(BeFalse())
+			})
+
+			It("Should select VMs with encryption at host enabled", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:             &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						EncryptionAtHostOnly: true,
+					},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(1))
+				Expect(vms).To(HaveKey(strings.ToLower(testVMID01 + "-enabled")))
+			})
+		})
+
+		Context("Data disk scenarios", func() {
+			var vmRows []map[string]interface{}
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     testVMID01 + suffix,
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				largeVMRow := getVMRow("-large", "10.0.0.4")
+				largeVMRow["dataDiskCount"] = float64(2)
+				largeVMRow["dataDiskSizeGB"] = float64(1536)
+				smallVMRow := getVMRow("-small", "10.0.0.5")
+				smallVMRow["dataDiskCount"] = float64(1)
+				smallVMRow["dataDiskSizeGB"] = float64(128)
+				// VM without data disks.
+				noDiskVMRow := getVMRow("-nodisk", "10.0.0.6")
+				noDiskVMRow["dataDiskCount"] = float64(0)
+				noDiskVMRow["dataDiskSizeGB"] = float64(0)
+				vmRows = []map[string]interface{}{largeVMRow, smallVMRow, noDiskVMRow}
+
+				// Resource graph mock emulating the data disk filters of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var minCount, minSizeGB float64
+						if i := strings.Index(*query.Query, "| where dataDiskCount >= "); i >= 0 {
+							_, _ = fmt.Sscanf((*query.Query)[i:], "| where dataDiskCount >= %v", &minCount)
+						}
+						if i := strings.Index(*query.Query, "| where dataDiskSizeGB >= "); i >= 0 {
+							_, _ = fmt.Sscanf((*query.Query)[i:], "| where dataDiskSizeGB >= %v", &minSizeGB)
+						}
+						var rows []interface{}
+						for _, row := range vmRows {
+							if row["dataDiskCount"].(float64) < minCount || row["dataDiskSizeGB"].(float64) < minSizeGB {
+								continue
+							}
+							rows = append(rows, row)
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredVMs := func() map[string]*runtimev1alpha1.VirtualMachine {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := map[string]*runtimev1alpha1.VirtualMachine{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					vms[vm.Status.CloudId] = vm
+				}
+				return vms
+			}
+
+			It("Should expose data disk count and total size of VMs", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(3))
+				Expect(vms[strings.ToLower(testVMID01+"-large")].Status.DataDiskCount).To(Equal(int32(2)))
+				Expect(vms[strings.ToLower(testVMID01+"-large")].Status.DataDiskSizeGB).To(Equal(int32(1536)))
+				Expect(vms[strings.ToLower(testVMID01+"-nodisk")].Status.DataDiskCount).To(BeZero())
+				Expect(vms[strings.ToLower(testVMID01+"-nodisk")].Status.DataDiskSizeGB).To(BeZero())
+			})
+
+			It("Should select VMs above a data disk size threshold", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:      &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						DataDiskMatch: &v1alpha1.DataDiskMatch{MinTotalSizeGB: 1024},
+					},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(1))
+				Expect(vms).To(HaveKey(strings.ToLower(testVMID01 + "-large")))
+			})
+
+			It("Should fall back to the VM properties for the data disks", func() {
+				count, sizeGB := getDataDisks(&virtualMachineTable{})
+				Expect(count).To(BeZero())
+				Expect(sizeGB).To(BeZero())
+				count, sizeGB = getDataDisks(&virtualMachineTable{Properties: &compute.VirtualMachineProperties{
+					StorageProfile: &compute.StorageProfile{DataDisks: []*compute.DataDisk{
+						{DiskSizeGB: to.Int32Ptr(512)}, {DiskSizeGB: to.Int32Ptr(256)}, {}},
+					}}})
+				Expect(count).To(Equal(int32(3)))
+				Expect(sizeGB).To(Equal(int32(768)))
+			})
+		})
+
+		Context("Boot integrity scenarios", func() {
+			var vmRows []map[string]interface{}
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     testVMID01 + suffix,
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				trustedLaunchVMRow := getVMRow("-trusted", "10.0.0.4")
+				trustedLaunchVMRow["secureBootEnabled"] = true
+				trustedLaunchVMRow["vTpmEnabled"] = true
+				noSecureBootVMRow := getVMRow("-nosecureboot", "10.0.0.5")
+				noSecureBootVMRow["secureBootEnabled"] = false
+				noSecureBootVMRow["vTpmEnabled"] = true
+				// Generation 1 VM without UEFI settings, reported with Secure Boot and vTPM disabled.
+				gen1VMRow := getVMRow("-gen1", "10.0.0.6")
+				vmRows = []map[string]interface{}{trustedLaunchVMRow, noSecureBootVMRow, gen1VMRow}
+
+				// Resource graph mock emulating the Secure Boot filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						for _, row := range vmRows {
+							secureBootEnabled := row["secureBootEnabled"] == true
+							if strings.Contains(*query.Query, "| where secureBootEnabled == false") && secureBootEnabled {
+								continue
+							}
+							if strings.Contains(*query.Query, "| where secureBootEnabled == true") && !secureBootEnabled {
+								continue
+							}
+							rows = append(rows, row)
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredVMs := func() map[string]*runtimev1alpha1.VirtualMachine {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := map[string]*runtimev1alpha1.VirtualMachine{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					vms[vm.Status.CloudId] = vm
+				}
+				return vms
+			}
+
+			It("Should expose Secure Boot and vTPM status of VMs", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(3))
+				trustedLaunchVM := vms[strings.ToLower(testVMID01+"-trusted")]
+				Expect(trustedLaunchVM.Status.SecureBootEnabled).To(BeTrue())
+				Expect(trustedLaunchVM.Status.VTPMEnabled).To(BeTrue())
+				noSecureBootVM := vms[strings.ToLower(testVMID01+"-nosecureboot")]
+				Expect(noSecureBootVM.Status.SecureBootEnabled).To(BeFalse())
+				Expect(noSecureBootVM.Status.VTPMEnabled).To(BeTrue())
+				gen1VM := vms[strings.ToLower(testVMID01+"-gen1")]
+				Expect(gen1VM.Status.SecureBootEnabled).To(BeFalse())
+				Expect(gen1VM.Status.VTPMEnabled).To(BeFalse())
+			})
+
+			It("Should select VMs with Secure Boot disabled", func() {
+				secureBootEnabled := false
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:           &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						BootIntegrityMatch: &v1alpha1.BootIntegrityMatch{SecureBootEnabled: &secureBootEnabled},
+					},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(2))
+				Expect(vms).To(HaveKey(strings.ToLower(testVMID01 + "-nosecureboot")))
+				Expect(vms).To(HaveKey(strings.ToLower(testVMID01 + "-gen1")))
+			})
+		})
+
+		Context("Management lock scenarios", func() {
+			var (
+				vmRows      []map[string]interface{}
+				lockRows    []interface{}
+				lockQueries []string
+			)
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     testVMID01 + suffix,
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				vmRows = []map[string]interface{}{getVMRow("-locked", "10.0.0.4"), getVMRow("-unlocked", "10.0.0.5")}
+				lockRows = []interface{}{map[string]interface{}{"scope": strings.ToLower(testVMID01 + "-locked")}}
+				lockQueries = nil
+
+				// Resource graph mock serving management locks for the lock query, and VMs otherwise, emulating the
+				// excludeLocked column of the VM query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						if isManagementLockQuery(query) {
+							lockQueries = append(lockQueries, *query.Query)
+							rows = lockRows
+						} else if isScaleSetInstanceQuery(query) {
+							rows = []interface{}{}
+						} else {
+							for _, row := range vmRows {
+								if strings.Contains(*query.Query, "| extend excludeLocked = true") {
+									row["excludeLocked"] = true
+								}
+								rows = append(rows, row)
+							}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredVMs := func() map[string]*runtimev1alpha1.VirtualMachine {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := map[string]*runtimev1alpha1.VirtualMachine{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					vms[vm.Status.CloudId] = vm
+				}
+				return vms
+			}
+
+			It("Should expose management lock status of VMs", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(2))
+				Expect(vms[strings.ToLower(testVMID01+"-locked")].Status.Locked).To(BeTrue())
+				Expect(vms[strings.ToLower(testVMID01+"-unlocked")].Status.Locked).To(BeFalse())
+			})
+
+			It("Should report VMs locked through their resource group", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				resourceGroupScope := strings.Join(strings.Split(strings.ToLower(testVMID01), "/")[:5], "/")
+				lockRows = []interface{}{map[string]interface{}{"scope": resourceGroupScope}}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(2))
+				Expect(vms[strings.ToLower(testVMID01+"-locked")].Status.Locked).To(BeTrue())
+				Expect(vms[strings.ToLower(testVMID01+"-unlocked")].Status.Locked).To(BeTrue())
+			})
+
+			It("Should keep locked VMs in inventory and skip their membership changes", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:      &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						ExcludeLocked: true,
+					},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(2))
+				Expect(vms[strings.ToLower(testVMID01+"-locked")].Status.Locked).To(BeTrue())
+
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				getNwIntf := func(suffix string) *networkInterfaceInternal {
+					id := testVMID01 + suffix + "-nic"
+					return &networkInterfaceInternal{Interface: network.Interface{ID: &id}}
+				}
+				nwIntfs := computeCfg.withoutLockedNetworkInterfaces(
+					[]*networkInterfaceInternal{getNwIntf("-locked"), getNwIntf("-unlocked")})
+				Expect(nwIntfs).To(HaveLen(1))
+				Expect(*nwIntfs[0].ID).To(Equal(testVMID01 + "-unlocked-nic"))
+			})
+
+			It("Should query locks once per poll for the VMs of all selectors", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				otherSelector := selector.DeepCopy()
+				otherSelector.Name = "other-selector"
+				otherSelector.Spec.VMSelector[0].ExcludeLocked = true
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, otherSelector)).Should(BeNil())
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(2))
+				Expect(vms[strings.ToLower(testVMID01+"-locked")].Status.Locked).To(BeTrue())
+				Expect(lockQueries).To(HaveLen(1))
+				for _, suffix := range []string{"-locked", "-unlocked"} {
+					Expect(lockQueries[0]).To(ContainSubstring(fmt.Sprintf("%q", strings.ToLower(testVMID01+suffix))))
+				}
+			})
+
+			It("Should resolve locks of VMs excluding locked VMs when the locked inventory field is not selected", func() {
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.credentials.inventoryFields = []string{"tags"}
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms[strings.ToLower(testVMID01+"-locked")].Status.Locked).To(BeFalse())
+
+				selector.Spec.VMSelector[0].ExcludeLocked = true
+				vms = getDiscoveredVMs()
+				Expect(vms[strings.ToLower(testVMID01+"-locked")].Status.Locked).To(BeTrue())
+				getNwIntf := func(suffix string) *networkInterfaceInternal {
+					id := testVMID01 + suffix + "-nic"
+					return &networkInterfaceInternal{Interface: network.Interface{ID: &id}}
+				}
+				nwIntfs := computeCfg.withoutLockedNetworkInterfaces(
+					[]*networkInterfaceInternal{getNwIntf("-locked"), getNwIntf("-unlocked")})
+				Expect(nwIntfs).To(HaveLen(1))
+				Expect(*nwIntfs[0].ID).To(Equal(testVMID01 + "-unlocked-nic"))
+			})
+		})
+
+		Context("Provisioning state scenarios", func() {
+			var (
+				succeededVMRow map[string]interface{}
+				updatingVMRow  map[string]interface{}
+				failedVMRow    map[string]interface{}
+			)
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, provisioningState string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":         testVMID01 + suffix,
+						"name":       testVM01 + suffix,
+						"vnetId":     testVnetID01,
+						"properties": map[string]interface{}{"provisioningState": provisioningState},
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				succeededVMRow = getVMRow("-succeeded", "Succeeded", "10.0.0.4")
+				updatingVMRow = getVMRow("-updating", "Updating", "10.0.0.6")
+				failedVMRow = getVMRow("-failed", "Failed", "10.0.0.5")
+
+				// Resource graph mock emulating the provisioning state filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						rows := []interface{}{succeededVMRow, updatingVMRow, failedVMRow}
+						if strings.Contains(*query.Query, "tostring(properties.provisioningState) in~ ('Succeeded', 'Updating')") {
+							rows = []interface{}{succeededVMRow, updatingVMRow}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredProvisioningStates := func() map[string]string {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				states := map[string]string{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					states[vm.Status.CloudId] = vm.Status.ProvisioningState
+				}
+				return states
+			}
+
+			It("Should discover VMs of all provisioning states by default", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(getDiscoveredProvisioningStates()).To(Equal(map[string]string{
+					strings.ToLower(testVMID01 + "-succeeded"): "Succeeded",
+					strings.ToLower(testVMID01 + "-updating"):  "Updating",
+					strings.ToLower(testVMID01 + "-failed"):    "Failed",
+				}))
+			})
+
+			It("Should filter out VMs not provisioned, keeping VMs being updated", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:        &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						ProvisionedOnly: true,
+					},
+				}
+				Expect(getDiscoveredProvisioningStates()).To(Equal(map[string]string{
+					strings.ToLower(testVMID01 + "-succeeded"): "Succeeded",
+					strings.ToLower(testVMID01 + "-updating"):  "Updating",
+				}))
+			})
+		})
+
+		Context("Custom query filter scenarios", func() {
+			const linuxFilter = "properties.storageProfile.osDisk.osType =~ 'Linux'"
+			var (
+				linuxVMRow   map[string]interface{}
+				windowsVMRow map[string]interface{}
+			)
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     testVMID01 + suffix,
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				linuxVMRow = getVMRow("-linux", "10.0.0.4")
+				windowsVMRow = getVMRow("-windows", "10.0.0.5")
+
+				// Resource graph mock emulating the custom filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						rows := []interface{}{linuxVMRow, windowsVMRow}
+						if strings.Contains(*query.Query, "| where ("+linuxFilter+")") {
+							rows = []interface{}{linuxVMRow}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should only discover VMs matching the custom query filter", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:          &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						CustomQueryFilter: linuxFilter,
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vmMap := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vmMap).To(HaveLen(1))
+				for _, vm := range vmMap {
+					Expect(vm.Status.CloudId).To(Equal(strings.ToLower(testVMID01 + "-linux")))
+				}
+			})
+
+			It("Should reject malformed or unsafe custom query filters", func() {
+				for _, filter := range []string{
+					"name =~ 'vm' | project id",
+					"name =~ 'vm'; Resources",
+					"name =~ 'vm' // comment",
+					"(name =~ 'vm'",
+					"name =~ 'vm",
+					"tags['env'] == 'prod')",
+					// a backslash does not escape the closing quote of a verbatim string.
+					"name == @'vm\\' | project id //'",
+					"name == ```'``` | project id",
+					// a doubled quote is a quote within a verbatim string, not its end.
+					`name == @"x""\" | project id, name | where name != "\""`,
+					"name == @'x''\\' | project id, name | where name != '\\''",
+				} {
+					selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{{CustomQueryFilter: filter}}
+					_, ok := convertSelectorToComputeQuery(selector, nil, subIDs, tenantIDs, locations)
+					Expect(ok).To(BeFalse(), filter)
+				}
+				for _, filter := range []string{
+					"name has '|' or name has ';'",
+					"name has 'vm\\'|' or name has @'c:\\vm'",
+					"name has @'it''s|' or name has @\"say \"\"|\"\"\" or name has 'a''|'",
+				} {
+					selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{{CustomQueryFilter: filter}}
+					_, ok := convertSelectorToComputeQuery(selector, nil, subIDs, tenantIDs, locations)
+					Expect(ok).To(BeTrue(), filter)
+				}
+			})
+		})
+
+		Context("Extension match scenarios", func() {
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     strings.ToLower(testVMID01 + suffix),
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				extensionRows := []interface{}{
+					map[string]interface{}{
+						"vmId":       strings.ToLower(testVMID01 + "-agent"),
+						"extensions": []interface{}{"azuremonitorlinuxagent", "customscript"},
+					},
+					map[string]interface{}{
+						"vmId":       strings.ToLower(testVMID01 + "-noagent"),
+						"extensions": []interface{}{"customscript"},
+					},
+				}
+
+				// Resource graph mock serving extensions for the extension query, and VMs otherwise, emulating the
+				// extension match columns of the VM query.
+				extensionMatchColumns := regexp.MustCompile(`extensionMatchName = '([^']*)', extensionMatchMissing = (true|false)`)
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						if isManagementLockQuery(query) || isScaleSetInstanceQuery(query) {
+							rows = []interface{}{}
+						} else if isVMExtensionQuery(query) {
+							rows = extensionRows
+						} else {
+							for _, row := range []map[string]interface{}{getVMRow("-agent", "10.0.0.4"),
+								getVMRow("-noagent", "10.0.0.5")} {
+								if match := extensionMatchColumns.FindStringSubmatch(*query.Query); match != nil {
+									row["extensionMatchName"] = match[1]
+									row["extensionMatchMissing"] = match[2] == "true"
+								}
+								rows = append(rows, row)
+							}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			getDiscoveredVMs := func() map[string]*runtimev1alpha1.VirtualMachine {
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := map[string]*runtimev1alpha1.VirtualMachine{}
+				for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+					vms[vm.Status.CloudId] = vm
+				}
+				return vms
+			}
+
+			It("Should expose extensions of VMs", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(2))
+				Expect(vms[strings.ToLower(testVMID01+"-agent")].Status.Extensions).To(
+					Equal([]string{"azuremonitorlinuxagent", "customscript"}))
+			})
+
+			It("Should only discover VMs having the extension", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:       &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						ExtensionMatch: &v1alpha1.ExtensionMatch{MatchName: "AzureMonitorLinuxAgent"},
+					},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(1))
+				Expect(vms).To(HaveKey(strings.ToLower(testVMID01 + "-agent")))
+			})
+
+			It("Should only discover VMs missing the extension", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:       &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						ExtensionMatch: &v1alpha1.ExtensionMatch{MatchName: "AzureMonitorLinuxAgent", MatchMissing: true},
+					},
+				}
+				vms := getDiscoveredVMs()
+				Expect(vms).To(HaveLen(1))
+				vm, found := vms[strings.ToLower(testVMID01+"-noagent")]
+				Expect(found).To(BeTrue())
+				Expect(vm.Status.Extensions).To(Equal([]string{"customscript"}))
+			})
+		})
+
+		Context("OS family match scenarios", func() {
+			var (
+				linuxVMRow   map[string]interface{}
+				windowsVMRow map[string]interface{}
+			)
+
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				getVMRow := func(suffix string, osType string, ip string) map[string]interface{} {
+					return map[string]interface{}{
+						"id":     testVMID01 + suffix,
+						"name":   testVM01 + suffix,
+						"vnetId": testVnetID01,
+						"properties": map[string]interface{}{"storageProfile": map[string]interface{}{
+							"osDisk": map[string]interface{}{"osType": osType}}},
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + suffix + "-nic",
+							"privateIps": []interface{}{ip},
+							"vnetId":     testVnetID01,
+						}},
+					}
+				}
+				linuxVMRow = getVMRow("-linux", "Linux", "10.0.0.4")
+				windowsVMRow = getVMRow("-windows", "Windows", "10.0.0.5")
+
+				// Resource graph mock emulating the OS family filter of the query.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						rows := []interface{}{linuxVMRow, windowsVMRow}
+						if strings.Contains(*query.Query, "tostring(properties.storageProfile.osDisk.osType) =~ 'linux'") {
+							rows = []interface{}{linuxVMRow}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should only discover Linux VMs", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:      &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						OSFamilyMatch: string(runtimev1alpha1.OSFamilyLinux),
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vmMap := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vmMap).To(HaveLen(1))
+				for _, vm := range vmMap {
+					Expect(vm.Status.CloudId).To(Equal(strings.ToLower(testVMID01 + "-linux")))
+					Expect(vm.Status.OSFamily).To(Equal(runtimev1alpha1.OSFamilyLinux))
+				}
+			})
+		})
+
+		Context("Primary IP scenarios", func() {
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				vmRow := map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": testVnetID01,
+					"networkInterfaces": []interface{}{map[string]interface{}{
+						"id":               testVMID01 + "-nic",
+						"privateIps":       []interface{}{"10.0.0.4", "10.0.0.5"},
+						"primaryPrivateIp": "10.0.0.5",
+						"vnetId":           testVnetID01,
+					}},
+				}
+
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						rows := []interface{}{vmRow}
+						if isScaleSetInstanceQuery(query) {
+							rows = []interface{}{}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should mark the private IP of the primary IP configuration as primary", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vmMap := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vmMap).To(HaveLen(1))
+				for _, vm := range vmMap {
+					Expect(vm.Status.NetworkInterfaces).To(HaveLen(1))
+					Expect(vm.Status.NetworkInterfaces[0].IPs).To(ConsistOf(
+						runtimev1alpha1.IPAddress{AddressType: runtimev1alpha1.AddressTypeInternalIP, Address: "10.0.0.4"},
+						runtimev1alpha1.IPAddress{AddressType: runtimev1alpha1.AddressTypeInternalIP, Address: "10.0.0.5",
+							Primary: true},
+					))
+				}
+
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				cachedVMs := accCfg.GetServiceConfig().(*computeServiceConfig).getAllCachedVirtualMachines()
+				Expect(cachedVMs).To(HaveLen(1))
+				Expect(*cachedVMs[0].NetworkInterfaces[0].primaryPrivateIP()).To(Equal("10.0.0.5"))
+			})
+		})
+
+		Context("Scale set scenarios", func() {
+			It("Should discover VMSS instances with a reference to their scale set", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				scaleSetID := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Compute/virtualMachineScaleSets/%v",
+					testSubID, testRG, "testScaleSet")
+				vmssInstanceID := scaleSetID + "/virtualMachines/0"
+				vmRows := []interface{}{
+					map[string]interface{}{
+						"id":     testVMID01,
+						"name":   testVM01,
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         testVMID01 + "-nic",
+							"privateIps": []interface{}{"10.0.0.4"},
+							"vnetId":     testVnetID01,
+						}},
+						"scaleSetId": "",
+					},
+				}
+				scaleSetInstanceRows := []interface{}{
+					map[string]interface{}{
+						"id":     vmssInstanceID,
+						"name":   "testScaleSet_0",
+						"vnetId": testVnetID01,
+						"networkInterfaces": []interface{}{map[string]interface{}{
+							"id":         vmssInstanceID + "/networkInterfaces/testScaleSet-nic",
+							"privateIps": []interface{}{"10.0.0.5"},
+							"vnetId":     testVnetID01,
+						}},
+						"scaleSetId": strings.ToLower(scaleSetID),
+					},
+				}
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isManagementLockQuery(query) || isVMExtensionQuery(query) {
+							records := int64(0)
+							return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+								TotalRecords: &records, Count: &records, Data: []interface{}{}}}, nil
+						}
+						// uniform scale set instances are only available in the ComputeResources table.
+						rows := vmRows
+						if isScaleSetInstanceQuery(query) {
+							Expect(*query.Query).To(ContainSubstring(
+								"'microsoft.compute/virtualmachinescalesets/virtualmachines/networkinterfaces'"))
+							rows = scaleSetInstanceRows
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vmMap := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vmMap).To(HaveLen(2))
+				scaleSetIDs := make(map[string]string)
+				for _, vm := range vmMap {
+					Expect(vm.Name).NotTo(ContainSubstring("_"))
+					scaleSetIDs[vm.Status.CloudId] = vm.Status.ScaleSetId
+					// the network interfaces of uniform scale set instances are managed by the scale set model.
+					Expect(vm.Status.EnforcementUnsupported).To(Equal(vm.Status.CloudId == strings.ToLower(vmssInstanceID)))
+				}
+				Expect(scaleSetIDs).To(Equal(map[string]string{
+					strings.ToLower(testVMID01):     "",
+					strings.ToLower(vmssInstanceID): strings.ToLower(scaleSetID),
+				}))
+			})
+		})
+
+		Context("Recreated VM scenarios", func() {
+			It("Should report the new cloud ID of a VM recreated with the same name", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				vmUID := "11111111-1111-1111-1111-111111111111"
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						rows := []interface{}{
+							map[string]interface{}{
+								"id":         testVMID01,
+								"name":       testVM01,
+								"vnetId":     testVnetID01,
+								"properties": map[string]interface{}{"vmId": vmUID},
+								"networkInterfaces": []interface{}{map[string]interface{}{
+									"id":         testVMID01 + "-nic",
+									"privateIps": []interface{}{"10.0.0.4"},
+									"vnetId":     testVnetID01,
+								}},
+							},
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				selectorNamespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+				getVms := func() map[string]*runtimev1alpha1.VirtualMachine {
+					err := c.DoInventoryPoll(testAccountNamespacedName)
+					Expect(err).Should(BeNil())
+					inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+					Expect(err).Should(BeNil())
+					return inventory.VmMap[selectorNamespacedName]
+				}
+
+				vmMap := getVms()
+				Expect(vmMap).To(HaveLen(1))
+				var vmName string
+				for name, vm := range vmMap {
+					vmName = name
+					Expect(vm.Labels[labels.CloudVmUID]).To(Equal(vmUID))
+				}
+
+				// The VM is deleted and recreated with the same name, Azure assigns it a new vmId.
+				vmUID = "22222222-2222-2222-2222-222222222222"
+				vmMap = getVms()
+				Expect(vmMap).To(HaveLen(1))
+				Expect(vmMap).To(HaveKey(vmName))
+				Expect(vmMap[vmName].Labels[labels.CloudVmUID]).To(Equal(vmUID))
+			})
+		})
+
+		Context("Inventory VM limit scenarios", func() {
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				nepheNsgID := strings.ToLower(fmt.Sprintf(
+					"/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/networkSecurityGroups/%v",
+					testSubID, testRG, getPerVnetDefaultNsgName(testVnet01)))
+				var rows []interface{}
+				for _, name := range []string{"testVM01", "testVM02", "testVM03"} {
+					vmID := strings.Replace(testVMID01, testVM01, name, 1)
+					nic := map[string]interface{}{
+						"id":         vmID + "-nic",
+						"privateIps": []interface{}{"10.0.0.4"},
+						"vnetId":     testVnetID01,
+					}
+					// Only the VM with the highest ID is attached to the Nephe default NSG.
+					if name == "testVM03" {
+						nic["nsgIds"] = []interface{}{nepheNsgID}
+					}
+					rows = append(rows, map[string]interface{}{
+						"id":                vmID,
+						"name":              name,
+						"vnetId":            testVnetID01,
+						"networkInterfaces": []interface{}{nic},
+					})
+				}
+
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should evict unmanaged VMs first when the inventory VM limit is exceeded", func() {
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.credentials.maxInventoryVMs = 2
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				err := c.AddAccountResourceSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+
+				var names []string
+				for _, vm := range computeCfg.getAllCachedVirtualMachines() {
+					names = append(names, *vm.Name)
+				}
+				Expect(names).To(ConsistOf("testVM01", "testVM03"))
+				Expect(testutil.ToFloat64(internal.EvictedInventoryVMsGauge.WithLabelValues(
+					testAccountNamespacedName.String(), string(providerType)))).To(Equal(float64(1)))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Selector match spike scenarios", func() {
+			It("Should hold the inventory of a selector whose VM count spikes until confirmed", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				var vmRows []interface{}
+				setVMs := func(count int) {
+					vmRows = nil
+					for i := 0; i < count; i++ {
+						vmRows = append(vmRows, map[string]interface{}{
+							"id": fmt.Sprintf("%v-%d", testVMID01, i), "name": fmt.Sprintf("%v-%d", testVM01, i),
+							"vnetId": testVnetID01,
+						})
+					}
+				}
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(len(vmRows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: vmRows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				computeCfg.selectorHolds.SetThreshold(2)
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				selectorNamespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+				getInventoryVMCount := func() int {
+					Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+					inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+					Expect(err).Should(BeNil())
+					return len(inventory.VmMap[selectorNamespacedName])
+				}
+				getHeldSelectors := func() []string {
+					status, err := c.GetAccountStatus(testAccountNamespacedName)
+					Expect(err).Should(BeNil())
+					return status.HeldSelectors
+				}
+
+				setVMs(1)
+				Expect(getInventoryVMCount()).To(Equal(1))
+				// growth within the threshold is not held.
+				setVMs(3)
+				Expect(getInventoryVMCount()).To(Equal(3))
+				Expect(getHeldSelectors()).To(BeEmpty())
+
+				// growth beyond the threshold holds the previous VMs, across polls.
+				setVMs(10)
+				Expect(getInventoryVMCount()).To(Equal(3))
+				Expect(getHeldSelectors()).To(Equal([]string{selectorNamespacedName.String()}))
+				Expect(getInventoryVMCount()).To(Equal(3))
+
+				// a confirmed VM count lower than the number of VMs keeps the hold.
+				selector.Annotations = map[string]string{v1alpha1.SelectorAnnotationConfirmVMCount: "5"}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(getInventoryVMCount()).To(Equal(3))
+
+				selector.Annotations = map[string]string{v1alpha1.SelectorAnnotationConfirmVMCount: "10"}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(getInventoryVMCount()).To(Equal(10))
+				Expect(getHeldSelectors()).To(BeEmpty())
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+
+			It("Should hold the inventory of a selector whose VM count spiked since its last confirmed VM count", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				var vmRows []interface{}
+				for i := 0; i < 10; i++ {
+					vmRows = append(vmRows, map[string]interface{}{
+						"id": fmt.Sprintf("%v-%d", testVMID01, i), "name": fmt.Sprintf("%v-%d", testVM01, i),
+						"vnetId": testVnetID01,
+					})
+				}
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(len(vmRows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: vmRows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				computeCfg.selectorHolds.SetThreshold(2)
+
+				// the selector is added after a restart, with the VMs confirmed before the restart in its status.
+				confirmedVMCount := 3
+				selector.Status.LastConfirmedVMCount = &confirmedVMCount
+				for i := 0; i < confirmedVMCount; i++ {
+					selector.Status.LastConfirmedVMIDs = append(selector.Status.LastConfirmedVMIDs,
+						strings.ToLower(fmt.Sprintf("%v-%d", testVMID01, i)))
+				}
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				selectorNamespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				// only the last confirmed VMs are kept while held.
+				var vmIDs []string
+				for _, vm := range inventory.VmMap[selectorNamespacedName] {
+					vmIDs = append(vmIDs, vm.Status.CloudId)
+				}
+				Expect(vmIDs).To(ConsistOf(selector.Status.LastConfirmedVMIDs))
+				status, err := c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.HeldSelectors).To(Equal([]string{selectorNamespacedName.String()}))
+				// the status of the cached selector is left to the account poller.
+				Expect(*computeCfg.selectors[selectorNamespacedName].Status.LastConfirmedVMCount).To(Equal(confirmedVMCount))
+
+				selector.Annotations = map[string]string{v1alpha1.SelectorAnnotationConfirmVMCount: "10"}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				inventory, err = c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap[selectorNamespacedName]).To(HaveLen(10))
+				status, err = c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.HeldSelectors).To(BeEmpty())
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Inventory consistency retry scenarios", func() {
+			It("Should retry the selector query until the VM selected by ID is found", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				// Resource graph mock missing the VM from the first query, as if not yet indexed.
+				queries := 0
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if !isManagementLockQuery(query) && !isVMExtensionQuery(query) && !isScaleSetInstanceQuery(query) {
+							queries++
+						}
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						var rows []interface{}
+						if queries > 1 {
+							rows = append(rows, map[string]interface{}{"id": testVMID01, "name": testVM01, "vnetId": testVnetID01})
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				computeCfg.credentials.inventoryConsistencyRetries = 3
+				defer func(delay time.Duration) { inventoryConsistencyRetryDelay = delay }(inventoryConsistencyRetryDelay)
+				inventoryConsistencyRetryDelay = time.Millisecond
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchID: testVMID01}}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+
+				var vms []string
+				for _, vm := range computeCfg.getAllCachedVirtualMachines() {
+					vms = append(vms, *vm.ID)
+				}
+				Expect(vms).To(ConsistOf(testVMID01))
+				Expect(queries).To(Equal(2))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+
+			It("Should retry the selector query only until the first poll missing the VM selected by ID", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				// Resource graph mock never returning the VM, as if it did not exist.
+				queries := 0
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if !isManagementLockQuery(query) && !isVMExtensionQuery(query) && !isScaleSetInstanceQuery(query) {
+							queries++
+						}
+						return getEmptyResourceGraphResult(), nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				computeCfg.credentials.inventoryConsistencyRetries = 3
+				defer func(delay time.Duration) { inventoryConsistencyRetryDelay = delay }(inventoryConsistencyRetryDelay)
+				inventoryConsistencyRetryDelay = time.Millisecond
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchID: testVMID01}}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(queries).To(Equal(4))
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(queries).To(Equal(5))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+
+			It("Should stop retrying the selector query at the inventory consistency deadline", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				queries := 0
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if !isManagementLockQuery(query) && !isVMExtensionQuery(query) && !isScaleSetInstanceQuery(query) {
+							queries++
+						}
+						return getEmptyResourceGraphResult(), nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				computeCfg.credentials.inventoryConsistencyRetries = 1000
+				defer func(delay, maxWait time.Duration) {
+					inventoryConsistencyRetryDelay = delay
+					inventoryConsistencyMaxWait = maxWait
+				}(inventoryConsistencyRetryDelay, inventoryConsistencyMaxWait)
+				inventoryConsistencyRetryDelay = 10 * time.Millisecond
+				inventoryConsistencyMaxWait = 50 * time.Millisecond
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchID: testVMID01}}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(queries).To(BeNumerically("<=", 6))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Resource graph join limit scenarios", func() {
+			// Azure Resource Graph rejects queries with more than 3 joins.
+			const maxJoins = 3
+			joinOperator := regexp.MustCompile(`\bjoin\b`)
+
+			It("Should not exceed the join limit with all matches configured", func() {
+				enabled := true
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes()
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:              &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						VMMatch:               []v1alpha1.EntityMatch{{MatchID: testVMID01}, {MatchName: testVM01}},
+						TagMatch:              []v1alpha1.TagMatch{{Key: "env", Value: "prod"}},
+						HasPublicIP:           true,
+						NsgMatch:              &v1alpha1.NetworkSecurityGroupMatch{MatchID: "nsgID"},
+						SizeMatch:             "Standard_D2s_v3",
+						ProvisionedOnly:       true,
+						CustomQueryFilter:     "name =~ 'vm'",
+						ExtensionMatch:        &v1alpha1.ExtensionMatch{MatchName: "AzureMonitorLinuxAgent"},
+						OSFamilyMatch:         "linux",
+						SubnetMatch:           &v1alpha1.EntityMatch{MatchID: testVnetID01 + "/subnets/subnet01"},
+						ModifiedWithinSeconds: 3600,
+						EncryptionAtHostOnly:  true,
+						DataDiskMatch:         &v1alpha1.DataDiskMatch{MinCount: 1, MinTotalSizeGB: 64},
+						BootIntegrityMatch:    &v1alpha1.BootIntegrityMatch{SecureBootEnabled: &enabled, VTPMEnabled: &enabled},
+						ExcludeLocked:         true,
+					},
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+					{VMMatch: []v1alpha1.EntityMatch{{MatchID: testVMID01}}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				queries := getFilters(c, &types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name})
+				Expect(queries).NotTo(BeEmpty())
+
+				lockQuery, err := getManagementLocksByScopesQuery(subIDs, getLockScopes(testVMID01))
+				Expect(err).Should(BeNil())
+				extensionQuery, err := getVMExtensionsByVMIDsQuery(subIDs, []string{testVMID01})
+				Expect(err).Should(BeNil())
+				queries = append(queries, lockQuery, extensionQuery)
+				for _, query := range queries {
+					Expect(len(joinOperator.FindAllString(*query, -1))).To(BeNumerically("<=", maxJoins), *query)
+				}
+			})
+		})
+
+		Context("Inventory fields scenarios", func() {
+			It("Should omit optional fields with a minimal projection", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				// Resource graph mock projecting away optional fields as requested by the query.
+				var queries []string
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if !isManagementLockQuery(query) && !isVMExtensionQuery(query) && !isScaleSetInstanceQuery(query) {
+							queries = append(queries, *query.Query)
+						}
+						row := map[string]interface{}{"id": testVMID01, "name": testVM01, "vnetId": testVnetID01}
+						if strings.Contains(*query.Query, "tags = make_bag(tags)") {
+							row["tags"] = map[string]interface{}{"Name": "web"}
+							row["status"] = "PowerState/running"
+						}
+						records := int64(1)
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: []interface{}{row}}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				computeCfg.credentials.inventoryFields = []string{}
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+
+				Expect(queries).To(HaveLen(1))
+				Expect(queries[0]).To(HaveSuffix("| project id, name, properties, networkInterfaces, vnetId"))
+				for _, field := range []string{"scaleSetId", "dataDiskCount", "dataDiskSizeGB", "lastModifiedAt",
+					"encryptionAtHost", "secureBootEnabled", "vTpmEnabled", "make_bag(tags)"} {
+					Expect(queries[0]).NotTo(ContainSubstring(field))
+				}
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				vms := inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}]
+				Expect(vms).To(HaveLen(1))
+				for _, vm := range vms {
+					Expect(vm.Status.CloudId).To(Equal(strings.ToLower(testVMID01)))
+					Expect(vm.Status.Tags).To(BeEmpty())
+				}
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+
+			It("Should compute optional fields used by attribute matches", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch:      &v1alpha1.EntityMatch{MatchID: testVnetID01},
+						DataDiskMatch: &v1alpha1.DataDiskMatch{MinCount: 1},
+					},
+				}
+				queries, ok := convertSelectorToComputeQuery(selector, []string{"tags"}, subIDs, tenantIDs, locations)
+				Expect(ok).To(BeTrue())
+				Expect(queries).To(HaveLen(2))
+				for _, query := range queries {
+					Expect(*query).To(ContainSubstring("| where dataDiskCount >= 1"))
+					Expect(*query).To(ContainSubstring("dataDiskCount = coalesce(array_length(dataDisks), 0)"))
+					Expect(*query).To(ContainSubstring("make_bag(tags)"))
+					Expect(*query).NotTo(ContainSubstring("encryptionAtHost"))
+				}
+			})
+		})
+
+		Context("Permission probe scenarios", func() {
+			BeforeEach(func() {
+				// the account added by the outer BeforeEach is probed with the permissions set by each test.
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+
+			getConditions := func(c *azureCloud) func() []v1.Condition {
+				return func() []v1.Condition {
+					accCfg, found := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+					if !found {
+						return nil
+					}
+					return accCfg.GetStatus().Conditions
+				}
+			}
+
+			It("Should report read-only capability when write permissions are missing", func() {
+				// Reader role, granting read actions only.
+				grantedPermissions = []azurePermission{{Actions: []string{"*/read"}}}
+				c := newAzureCloud(mockAzureServiceHelper)
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+
+				Eventually(getConditions(c)).Should(ContainElement(
+					HaveField("Type", v1alpha1.AccountConditionSecurityPermitted)))
+				conditions := getConditions(c)()
+				inventoryPermitted := meta.FindStatusCondition(conditions, v1alpha1.AccountConditionInventoryPermitted)
+				Expect(inventoryPermitted).NotTo(BeNil())
+				Expect(inventoryPermitted.Status).To(Equal(v1.ConditionTrue))
+				securityPermitted := meta.FindStatusCondition(conditions, v1alpha1.AccountConditionSecurityPermitted)
+				Expect(securityPermitted).NotTo(BeNil())
+				Expect(securityPermitted.Status).To(Equal(v1.ConditionFalse))
+				Expect(securityPermitted.Reason).To(Equal(v1alpha1.AccountReasonPermissionsMissing))
+				Expect(securityPermitted.Message).To(HavePrefix("read-only credentials"))
+				Expect(securityPermitted.Message).To(ContainSubstring("Microsoft.Network/networkSecurityGroups/write"))
+				Expect(securityPermitted.Message).NotTo(ContainSubstring("Microsoft.Network/networkSecurityGroups/read"))
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+			It("Should honor not actions of a permission", func() {
+				grantedPermissions = []azurePermission{{
+					Actions:    []string{"Microsoft.Network/*", "Microsoft.Compute/virtualMachines/read", "*/read"},
+					NotActions: []string{"Microsoft.Network/networkSecurityGroups/*"},
+				}}
+				c := newAzureCloud(mockAzureServiceHelper)
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+
+				Eventually(getConditions(c)).Should(ContainElement(
+					HaveField("Type", v1alpha1.AccountConditionSecurityPermitted)))
+				conditions := getConditions(c)()
+				Expect(meta.IsStatusConditionTrue(conditions, v1alpha1.AccountConditionInventoryPermitted)).To(BeTrue())
+				securityPermitted := meta.FindStatusCondition(conditions, v1alpha1.AccountConditionSecurityPermitted)
+				Expect(securityPermitted.Status).To(Equal(v1.ConditionFalse))
+				Expect(securityPermitted.Message).To(ContainSubstring("Microsoft.Network/networkSecurityGroups/read"))
+				Expect(securityPermitted.Message).NotTo(ContainSubstring("applicationSecurityGroups"))
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+			It("Should probe permissions on the resource groups of the selected VMs", func() {
+				// Reader role on the subscription, Contributor role on the resource group of the vnet.
+				grantedPermissions = []azurePermission{{Actions: []string{"*/read"}}}
+				resourceGroupPermissions = map[string][]azurePermission{
+					strings.ToLower(testRG): {{Actions: []string{"*"}}},
+				}
+				c := newAzureCloud(mockAzureServiceHelper)
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Eventually(func() bool {
+					return meta.IsStatusConditionFalse(getConditions(c)(), v1alpha1.AccountConditionSecurityPermitted)
+				}).Should(BeTrue())
+
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).
+					Return(createVnetObject([]string{testVnetID01}), nil).AnyTimes()
+				vmRow := map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": strings.ToLower(testVnetID01),
+				}
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isManagementLockQuery(query) || isVMExtensionQuery(query) || isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(1)
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: []interface{}{vmRow}}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+
+				Eventually(func() bool {
+					return meta.IsStatusConditionTrue(getConditions(c)(), v1alpha1.AccountConditionSecurityPermitted)
+				}).Should(BeTrue())
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+			It("Should probe permissions on the resource groups of the nics and reject security operations", func() {
+				// Contributor role on the resource group of the vnet only, the nic is in another resource group.
+				grantedPermissions = []azurePermission{{Actions: []string{"*/read"}}}
+				resourceGroupPermissions = map[string][]azurePermission{
+					strings.ToLower(testRG): {{Actions: []string{"*"}}},
+				}
+				c := newAzureCloud(mockAzureServiceHelper)
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).
+					Return(createVnetObject([]string{testVnetID01}), nil).AnyTimes()
+				vmRow := map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": strings.ToLower(testVnetID01),
+					"networkInterfaces": []interface{}{map[string]interface{}{
+						"id": fmt.Sprintf("/subscriptions/%v/resourceGroups/nicRG/providers/Microsoft.Network/networkInterfaces/nic01",
+							testSubID),
+						"privateIps": []interface{}{"10.0.0.4"},
+						"vnetId":     strings.ToLower(testVnetID01),
+					}},
+				}
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isManagementLockQuery(query) || isVMExtensionQuery(query) || isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(1)
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: []interface{}{vmRow}}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(accCfg.GetServiceConfig().(*computeServiceConfig).permissionResourceGroups).To(
+					Equal([]string{"nicrg", strings.ToLower(testRG)}))
+
+				Eventually(func() bool {
+					return meta.IsStatusConditionFalse(getConditions(c)(), v1alpha1.AccountConditionSecurityPermitted) &&
+						meta.IsStatusConditionTrue(getConditions(c)(), v1alpha1.AccountConditionInventoryPermitted)
+				}).Should(BeTrue())
+				securityGroup := &cloudresource.CloudResource{
+					Type: cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{
+						Name: "addressgroup",
+						Vpc:  testVnetID01,
+					},
+					AccountID:     testAccountNamespacedName.String(),
+					CloudProvider: string(runtimev1alpha1.AzureCloudProvider),
+				}
+				_, err := c.CreateSecurityGroup(securityGroup, true)
+				Expect(errors.Is(err, internal.ErrSecurityNotPermitted)).To(BeTrue())
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Identical selector scenarios", func() {
+			var queries int
+
+			BeforeEach(func() {
+				queries = 0
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				vmRow := map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": testVnetID01,
+				}
+
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if !isManagementLockQuery(query) && !isVMExtensionQuery(query) && !isScaleSetInstanceQuery(query) {
+							queries++
+						}
+						records := int64(1)
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: []interface{}{vmRow}}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should coalesce filters of identical selectors", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				identicalSelector := selector.DeepCopy()
+				identicalSelector.Name = selector.Name + "-identical"
+				selectorNamespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+				identicalNamespacedName := types.NamespacedName{Namespace: identicalSelector.Namespace,
+					Name: identicalSelector.Name}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, identicalSelector)).Should(BeNil())
+
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				Expect(computeCfg.computeFilters).To(HaveLen(1))
+				Expect(computeCfg.computeFilters).To(HaveKey(selectorNamespacedName))
+
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(queries).To(Equal(1))
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap[selectorNamespacedName]).To(HaveLen(1))
+				Expect(inventory.VmMap[identicalNamespacedName]).To(HaveLen(1))
+
+				// The identical selector takes over the filters once the selector is removed.
+				c.RemoveAccountResourcesSelector(testAccountNamespacedName, &selectorNamespacedName)
+				Expect(computeCfg.computeFilters).To(HaveLen(1))
+				Expect(computeCfg.computeFilters).To(HaveKey(identicalNamespacedName))
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				inventory, err = c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap[identicalNamespacedName]).To(HaveLen(1))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Remove all selectors scenarios", func() {
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				vmRow := map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": strings.ToLower(testVnetID01),
+				}
+
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(1)
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: []interface{}{vmRow}}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should remove filters and VMs of all selectors of the account", func() {
+				vmSelectors := [][]v1alpha1.VirtualMachineSelector{
+					{{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}}},
+					{{VMMatch: []v1alpha1.EntityMatch{{MatchID: testVMID01}}}},
+					{{VMMatch: []v1alpha1.EntityMatch{{MatchName: testVM01}}}},
+				}
+				for i, vmSelector := range vmSelectors {
+					s := selector.DeepCopy()
+					s.Name = fmt.Sprintf("%v-%v", selector.Name, i)
+					s.Spec.VMSelector = vmSelector
+					Expect(c.AddAccountResourceSelector(testAccountNamespacedName, s)).Should(BeNil())
+				}
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				Expect(computeCfg.computeFilters).To(HaveLen(len(vmSelectors)))
+
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap).To(HaveLen(len(vmSelectors)))
+				Expect(inventory.VpcMap[strings.ToLower(testVnetID01)].Status.Managed).To(BeTrue())
+
+				c.cloudCommon.RemoveAllResourceFilters(testAccountNamespacedName)
+				Expect(computeCfg.computeFilters).To(BeEmpty())
+				Expect(computeCfg.selectors).To(BeEmpty())
+				inventory, err = c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap).To(BeEmpty())
+				Expect(inventory.VpcMap).To(HaveKey(strings.ToLower(testVnetID01)))
+				Expect(inventory.VpcMap[strings.ToLower(testVnetID01)].Status.Managed).To(BeFalse())
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Paused account scenarios", func() {
+			var queryCount int
+
+			BeforeEach(func() {
+				queryCount = 0
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				vmRow := map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": strings.ToLower(testVnetID01),
+				}
+
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if !isManagementLockQuery(query) && !isVMExtensionQuery(query) && !isScaleSetInstanceQuery(query) {
+							queryCount++
+						}
+						records := int64(1)
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: []interface{}{vmRow}}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			It("Should skip polling and security operations of a paused account and resume on unpause", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(queryCount).To(Equal(1))
+
+				pausedAccount := account.DeepCopy()
+				pausedAccount.Spec.Paused = true
+				Expect(c.AddProviderAccount(fakeClient, pausedAccount)).Should(BeNil())
+				status, err := c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(meta.IsStatusConditionTrue(status.Conditions, v1alpha1.AccountConditionPaused)).To(BeTrue())
+
+				err = c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(errors.Is(err, internal.ErrAccountPaused)).To(BeTrue())
+				Expect(errors.Is(c.RefreshVpc(testAccountNamespacedName, testVnetID01), internal.ErrAccountPaused)).To(BeTrue())
+				Expect(queryCount).To(Equal(1))
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap).To(HaveLen(1))
+
+				sgIdentifier := &cloudresource.CloudResource{
+					Type:            cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{Name: "Web", Vpc: testVnetID01},
+					AccountID:       testAccountNamespacedName.String(),
+					CloudProvider:   string(runtimev1alpha1.AzureCloudProvider),
+				}
+				_, err = c.CreateSecurityGroup(sgIdentifier, false)
+				Expect(errors.Is(err, internal.ErrAccountPaused)).To(BeTrue())
+
+				By("Reporting the security groups of the paused account as last seen")
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				cloudView := []cloudresource.SynchronizationContent{{Resource: *sgIdentifier, CloudID: "nsgID"}}
+				accCfg.CacheEnforcedSecurity(cloudView)
+				Expect(c.GetEnforcedSecurity()).To(Equal(cloudView))
+
+				By("Resyncing security groups on unpause")
+				resumedCount := 0
+				c.SetAccountResumedHook(func(accountNamespacedName *types.NamespacedName) {
+					Expect(*accountNamespacedName).To(Equal(*testAccountNamespacedName))
+					resumedCount++
+				})
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(resumedCount).To(Equal(1))
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(resumedCount).To(Equal(1))
+				status, err = c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(meta.IsStatusConditionFalse(status.Conditions, v1alpha1.AccountConditionPaused)).To(BeTrue())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(queryCount).To(Equal(2))
+				inventory, err = c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap).To(HaveLen(1))
+			})
+		})
+
+		Context("Inventory poll timeout scenarios", func() {
+			var release chan struct{}
+			var pollTimeout time.Duration
+
+			BeforeEach(func() {
+				pollTimeout = cloudresource.InventoryPollTimeout
+				cloudresource.InventoryPollTimeout = 100 * time.Millisecond
+				release = make(chan struct{})
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(ctx context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						select {
+						case <-release:
+						case <-ctx.Done():
+							return resourcegraph.ClientResourcesResponse{}, ctx.Err()
+						}
+						records := int64(0)
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: []interface{}{}}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+			})
+
+			AfterEach(func() {
+				cloudresource.InventoryPollTimeout = pollTimeout
+			})
+
+			It("Should cancel an inventory poll exceeding the poll timeout with an error", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+
+				err := c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(errors.Is(err, internal.ErrInventoryPollTimeout)).To(BeTrue())
+				status, err := c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.Error).To(ContainSubstring(internal.ErrInventoryPollTimeout.Error()))
+
+				// the cancelled poll does not hold the account mutex anymore.
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				unlocked := make(chan struct{})
+				go func() {
+					accCfg.LockMutex()
+					accCfg.UnlockMutex()
+					close(unlocked)
+				}()
+				Eventually(unlocked, time.Second).Should(BeClosed())
+
+				close(release)
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				status, err = c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.Error).To(BeEmpty())
+			})
+		})
+
+		Context("Preview selector scenarios", func() {
+			BeforeEach(func() {
+				vnetIDs = []string{testVnetID01, testVnetID02}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+
+				// Resource graph mock returning a VM only for queries on testVnetID01.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						if strings.Contains(*query.Query, strings.ToLower(testVnetID01)) {
+							rows = append(rows, map[string]interface{}{
+								"id":     testVMID01,
+								"name":   testVM01,
+								"vnetId": testVnetID01,
+								"networkInterfaces": []interface{}{map[string]interface{}{
+									"id":         testVMID01 + "-nic",
+									"privateIps": []interface{}{"10.0.0.4"},
+									"vnetId":     testVnetID01,
+								}},
+							})
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+				err := c.DoInventoryPoll(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+			})
+
+			It("Should preview VMs matching a vnet selector without adding the selector", func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				vms, err := c.PreviewSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				Expect(vms).To(HaveLen(1))
+				Expect(vms[0].Status.CloudId).To(Equal(strings.ToLower(testVMID01)))
+				Expect(vms[0].Status.CloudVpcId).To(Equal(strings.ToLower(testVnetID01)))
+
+				selector.Spec.VMSelector[0].VpcMatch.MatchID = testVnetID02
+				vms, err = c.PreviewSelector(testAccountNamespacedName, selector)
+				Expect(err).Should(BeNil())
+				Expect(vms).To(BeEmpty())
+
+				Expect(getFilters(c, &types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name})).To(BeEmpty())
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap).To(BeEmpty())
+			})
+
+			It("Should fail to preview selector of an unknown account", func() {
+				_, err := c.PreviewSelector(&types.NamespacedName{Namespace: "namespace01", Name: "unknown"}, selector)
+				Expect(err).ShouldNot(BeNil())
+			})
+		})
+
+		Context("Inventory tombstone scenarios", func() {
+			AfterEach(func() {
+				cloudresource.SetInventoryTombstonePolls(config.DefaultInventoryTombstonePolls)
+			})
+
+			It("Should remove VM only after it is absent from consecutive polls", func() {
+				cloudresource.SetInventoryTombstonePolls(2)
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				vmRows := []interface{}{
+					map[string]interface{}{"id": testVMID01, "name": testVM01, "vnetId": testVnetID01},
+					map[string]interface{}{"id": testVMID01 + "-2", "name": testVM01 + "-2", "vnetId": testVnetID01},
+				}
+				// Resource graph mock returning the VMs of the current poll.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(len(vmRows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: vmRows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				getInventoryVMs := func() []string {
+					Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+					inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+					Expect(err).Should(BeNil())
+					var vms []string
+					for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+						vms = append(vms, vm.Status.CloudId)
+					}
+					return vms
+				}
+
+				Expect(getInventoryVMs()).To(ConsistOf(strings.ToLower(testVMID01), strings.ToLower(testVMID01+"-2")))
+
+				// VM absent from one poll is tombstoned and retained.
+				vmRows = vmRows[:1]
+				Expect(getInventoryVMs()).To(ConsistOf(strings.ToLower(testVMID01), strings.ToLower(testVMID01+"-2")))
+
+				// VM absent from consecutive polls is removed.
+				Expect(getInventoryVMs()).To(ConsistOf(strings.ToLower(testVMID01)))
+			})
+
+			It("Should honor account annotations", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				account.Annotations = map[string]string{
+					v1alpha1.AccountAnnotationDetachPolicy:            string(v1alpha1.SecurityGroupDetachPolicyLeaveUnattached),
+					v1alpha1.AccountAnnotationInventoryTombstonePolls: "2",
+				}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+
+				vmRows := []interface{}{
+					map[string]interface{}{"id": testVMID01, "name": testVM01, "vnetId": testVnetID01},
+				}
+				// Resource graph mock returning the VMs of the current poll.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						records := int64(len(vmRows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: vmRows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.resourceGraphAPIClient = mockResourceGraph
+				Expect(computeCfg.credentials.detachPolicy).To(Equal(v1alpha1.SecurityGroupDetachPolicyLeaveUnattached))
+
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				getInventoryVMs := func() []string {
+					Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+					inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+					Expect(err).Should(BeNil())
+					var vms []string
+					for _, vm := range inventory.VmMap[types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}] {
+						vms = append(vms, vm.Status.CloudId)
+					}
+					return vms
+				}
+				Expect(getInventoryVMs()).To(ConsistOf(strings.ToLower(testVMID01)))
+
+				// VM absent from one poll is retained as per the account annotation.
+				vmRows = nil
+				Expect(getInventoryVMs()).To(ConsistOf(strings.ToLower(testVMID01)))
+				Expect(getInventoryVMs()).To(BeEmpty())
+
+				account.Annotations[v1alpha1.AccountAnnotationInventoryTombstonePolls] = "0"
+				Expect(c.AddProviderAccount(fakeClient, account)).ShouldNot(BeNil())
+			})
+		})
+
+		Context("Matching selectors scenarios", func() {
+			It("Should return only the selectors matching a VM", func() {
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				vmRow := map[string]interface{}{
+					"id":     testVMID01,
+					"name":   testVM01,
+					"vnetId": testVnetID01,
+				}
+				// Resource graph mock returning the VM only for queries matching its name.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						var rows []interface{}
+						if strings.Contains(*query.Query, fmt.Sprintf("%q", strings.ToLower(testVM01))) {
+							rows = append(rows, vmRow)
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+
+				matchingSelector := selector.DeepCopy()
+				matchingSelector.Name = "selector-matching"
+				matchingSelector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchName: testVM01}}},
+				}
+				otherSelector := selector.DeepCopy()
+				otherSelector.Name = "selector-other"
+				otherSelector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchName: "otherVM"}}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, matchingSelector)).Should(BeNil())
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, otherSelector)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+
+				selectors, err := c.GetMatchingSelectors(testAccountNamespacedName, testVMID01)
+				Expect(err).Should(BeNil())
+				Expect(selectors).To(Equal([]string{
+					types.NamespacedName{Namespace: matchingSelector.Namespace, Name: matchingSelector.Name}.String()}))
+
+				selectors, err = c.GetMatchingSelectors(testAccountNamespacedName, "unknownVM")
+				Expect(err).Should(BeNil())
+				Expect(selectors).To(BeEmpty())
+
+				_, err = c.GetMatchingSelectors(&types.NamespacedName{Namespace: "namespace01", Name: "unknown"}, testVMID01)
+				Expect(err).ShouldNot(BeNil())
+			})
+		})
+
+		Context("Selector inventory scenarios", func() {
+			It("Should return only the VMs and vnets of a selector", func() {
+				vnetIDs = []string{testVnetID01, testVnetID02}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				testVM02 := "testVM02"
+				testVMID02 := strings.Replace(testVMID01, testVM01, testVM02, 1)
+				vmRows := map[string]map[string]interface{}{
+					testVM01: {"id": testVMID01, "name": testVM01, "vnetId": testVnetID01},
+					testVM02: {"id": testVMID02, "name": testVM02, "vnetId": testVnetID02},
+				}
+				// Resource graph mock returning a VM only for queries matching its name.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						var rows []interface{}
+						for name, row := range vmRows {
+							if strings.Contains(*query.Query, fmt.Sprintf("%q", strings.ToLower(name))) {
+								rows = append(rows, row)
+							}
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+
+				selector01 := selector.DeepCopy()
+				selector01.Name = "selector01"
+				selector01.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchName: testVM01}}},
+				}
+				selector02 := selector.DeepCopy()
+				selector02.Name = "selector02"
+				selector02.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchName: testVM02}}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector01)).Should(BeNil())
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector02)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+
+				selectorNamespacedName01 := types.NamespacedName{Namespace: selector01.Namespace, Name: selector01.Name}
+				inventory, err := c.GetSelectorCloudInventory(testAccountNamespacedName, &selectorNamespacedName01)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap).To(HaveLen(1))
+				Expect(inventory.VmMap[selectorNamespacedName01]).To(HaveLen(1))
+				for _, vm := range inventory.VmMap[selectorNamespacedName01] {
+					Expect(vm.Status.CloudId).To(Equal(strings.ToLower(testVMID01)))
+				}
+				Expect(inventory.VpcMap).To(HaveLen(1))
+				Expect(inventory.VpcMap).To(HaveKey(strings.ToLower(testVnetID01)))
+
+				inventory, err = c.GetSelectorCloudInventory(testAccountNamespacedName,
+					&types.NamespacedName{Namespace: selector01.Namespace, Name: "unknown"})
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap).To(BeEmpty())
+				Expect(inventory.VpcMap).To(BeEmpty())
+
+				_, err = c.GetSelectorCloudInventory(&types.NamespacedName{Namespace: "namespace01", Name: "unknown"},
+					&selectorNamespacedName01)
+				Expect(err).ShouldNot(BeNil())
+			})
+		})
+
+		Context("Vpc refresh scenarios", func() {
+			It("Should refresh only the VMs of a vnet", func() {
+				vnetIDs = []string{testVnetID01, testVnetID02}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+				testVM02 := "testVM02"
+				testVMID02 := strings.Replace(testVMID01, testVM01, testVM02, 1)
+				vmRows := map[string]map[string]interface{}{
+					testVM01: {"id": testVMID01, "name": testVM01, "vnetId": testVnetID01, "tags": map[string]interface{}{"version": "v1"}},
+					testVM02: {"id": testVMID02, "name": testVM02, "vnetId": testVnetID02, "tags": map[string]interface{}{"version": "v1"}},
+				}
+				var vnetQueries []string
+				// Resource graph mock returning VMs matching names in the query, scoped to the vnet of the query if any.
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if isScaleSetInstanceQuery(query) {
+							return getEmptyResourceGraphResult(), nil
+						}
+						var rows []interface{}
+						for name, row := range vmRows {
+							if !strings.Contains(*query.Query, fmt.Sprintf("%q", strings.ToLower(name))) {
+								continue
+							}
+							if strings.Contains(*query.Query, "| where vnetId ==") {
+								vnetID := strings.ToLower(row["vnetId"].(string))
+								if !strings.Contains(*query.Query, fmt.Sprintf("| where vnetId == '%v'", vnetID)) {
+									continue
+								}
+								vnetQueries = append(vnetQueries, vnetID)
+							}
+							rows = append(rows, row)
+						}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+
+				selector01 := selector.DeepCopy()
+				selector01.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VMMatch: []v1alpha1.EntityMatch{{MatchName: testVM01}, {MatchName: testVM02}}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector01)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+
+				vmRows[testVM01]["tags"] = map[string]interface{}{"version": "v2"}
+				vmRows[testVM02]["tags"] = map[string]interface{}{"version": "v2"}
+				Expect(c.RefreshVpc(testAccountNamespacedName, testVnetID01)).Should(BeNil())
+				Expect(vnetQueries).To(Equal([]string{strings.ToLower(testVnetID01)}))
+				Expect(c.RefreshVpc(&types.NamespacedName{Namespace: "namespace01", Name: "unknown"}, testVnetID01)).ShouldNot(BeNil())
+
+				selectorNamespacedName := types.NamespacedName{Namespace: selector01.Namespace, Name: selector01.Name}
+				inventory, err := c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap[selectorNamespacedName]).To(HaveLen(2))
+				Expect(inventory.VpcMap).To(HaveLen(len(vnetIDs)))
+				for _, vm := range inventory.VmMap[selectorNamespacedName] {
+					if vm.Status.CloudVpcId == strings.ToLower(testVnetID01) {
+						Expect(vm.Status.Tags["version"]).To(Equal("v2"))
+					} else {
+						Expect(vm.Status.Tags["version"]).To(Equal("v1"))
+					}
+				}
+
+				// a VM of the vnet absent from refreshes is tombstoned as by inventory polls.
+				accCfg.GetServiceConfig().(*computeServiceConfig).vmTombstones.SetPolls(2)
+				delete(vmRows, testVM01)
+				Expect(c.RefreshVpc(testAccountNamespacedName, testVnetID01)).Should(BeNil())
+				inventory, err = c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap[selectorNamespacedName]).To(HaveLen(2))
+				Expect(c.RefreshVpc(testAccountNamespacedName, testVnetID01)).Should(BeNil())
+				inventory, err = c.GetCloudInventory(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(inventory.VmMap[selectorNamespacedName]).To(HaveLen(1))
+			})
+		})
+
+		Context("Snapshot history scenarios", func() {
+			It("Should keep the most recent snapshots", func() {
+				cloudresource.SetInventorySnapshotHistory(2)
+				defer cloudresource.SetInventorySnapshotHistory(0)
+				polledVnetIDs := [][]string{{testVnetID01}, {testVnetID01, testVnetID02}, {testVnetID02}}
+				poll := 0
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context) ([]network.VirtualNetwork, error) {
+						return createVnetObject(polledVnetIDs[poll]), nil
+					})
+				for poll = range polledVnetIDs {
+					Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				}
+
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				history := computeCfg.snapshotHistory.Get()
+				Expect(history).To(HaveLen(2))
+				Expect(history[0].Snapshot.(*computeResourcesCacheSnapshot).vnets).To(HaveLen(2))
+				Expect(history[1].Snapshot.(*computeResourcesCacheSnapshot).vnets).To(HaveLen(1))
+				Expect(history[1].Snapshot).To(BeIdenticalTo(computeCfg.resourcesCache.GetSnapshot()))
+				Expect(history[0].Time.After(history[1].Time)).To(BeFalse())
+
+				Expect(c.ResetInventoryCache(testAccountNamespacedName)).Should(BeNil())
+				Expect(computeCfg.snapshotHistory.Get()).To(BeEmpty())
+			})
+		})
+
+		Context("Aggregated inventory scenarios", func() {
+			It("Should return inventory of all accounts", func() {
+				vnetIDs = []string{testVnetID01, testVnetID02}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+
+				testAccountNamespacedName02 := &types.NamespacedName{Namespace: "namespace01", Name: "account02"}
+				account02 := account.DeepCopy()
+				account02.Name = testAccountNamespacedName02.Name
+				Expect(c.AddProviderAccount(fakeClient, account02)).Should(BeNil())
+
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName02)).Should(BeNil())
+
+				inventories, err := c.cloudCommon.GetAllCloudInventory()
+				Expect(err).Should(BeNil())
+				Expect(inventories).To(HaveLen(2))
+				Expect(inventories).To(HaveKey(*testAccountNamespacedName))
+				Expect(inventories).To(HaveKey(*testAccountNamespacedName02))
+				for _, inventory := range inventories {
+					Expect(inventory.VpcMap).To(HaveLen(len(vnetIDs)))
+				}
+			})
+
+			It("Should return status of all accounts", func() {
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(nil, fmt.Errorf("unauthorized")).AnyTimes()
+
+				testAccountNamespacedName02 := &types.NamespacedName{Namespace: "namespace01", Name: "account02"}
+				account02 := account.DeepCopy()
+				account02.Name = testAccountNamespacedName02.Name
+				Expect(c.AddProviderAccount(fakeClient, account02)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName02)).ShouldNot(BeNil())
+
+				statuses := c.cloudCommon.GetAllStatus()
+				Expect(statuses).To(HaveLen(2))
+				Expect(statuses).To(HaveKey(*testAccountNamespacedName))
+				Expect(statuses).To(HaveKey(*testAccountNamespacedName02))
+				for namespacedName, status := range statuses {
+					expected, err := c.cloudCommon.GetStatus(&namespacedName)
+					Expect(err).Should(BeNil())
+					Expect(status).To(Equal(expected))
+				}
+				Expect(meta.IsStatusConditionFalse(statuses[*testAccountNamespacedName02].Conditions,
+					v1alpha1.AccountConditionConnected)).To(BeTrue())
+				Expect(meta.FindStatusCondition(statuses[*testAccountNamespacedName].Conditions,
+					v1alpha1.AccountConditionConnected)).To(BeNil())
+
+				// statuses are copies, not the status of the accounts.
+				statuses[*testAccountNamespacedName02].Error = "modified"
+				status, err := c.cloudCommon.GetStatus(testAccountNamespacedName02)
+				Expect(err).Should(BeNil())
+				Expect(status.Error).NotTo(Equal("modified"))
+				c.RemoveProviderAccount(testAccountNamespacedName02)
+			})
+		})
+
+		Context("Query coalescing scenarios", func() {
+			var (
+				testAccountNamespacedName02 = &types.NamespacedName{Namespace: "namespace01", Name: "account02"}
+				queryCount                  int
+			)
+
+			BeforeEach(func() {
+				cloudresource.SetCoalesceInventoryQueries(true)
+				queryCoalescer = newResourceGraphQueryCoalescer()
+				vnetIDs = []string{testVnetID01}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(createVnetObject(vnetIDs), nil).AnyTimes()
+
+				account02 := account.DeepCopy()
+				account02.Name = testAccountNamespacedName02.Name
+				Expect(c.AddProviderAccount(fakeClient, account02)).Should(BeNil())
+
+				// Resource graph mock shared by both accounts, counting the underlying queries.
+				queryCount = 0
+				mockResourceGraph := NewMockazureResourceGraphWrapper(mockCtrl)
+				mockResourceGraph.EXPECT().resources(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context, query resourcegraph.QueryRequest) (resourcegraph.ClientResourcesResponse, error) {
+						if !isManagementLockQuery(query) && !isVMExtensionQuery(query) && !isScaleSetInstanceQuery(query) {
+							queryCount++
+						}
+						rows := []interface{}{map[string]interface{}{
+							"id":     testVMID01,
+							"name":   testVM01,
+							"vnetId": testVnetID01,
+							"networkInterfaces": []interface{}{map[string]interface{}{
+								"id":         testVMID01 + "-nic",
+								"privateIps": []interface{}{"10.0.0.4"},
+								"vnetId":     testVnetID01,
+							}},
+						}}
+						records := int64(len(rows))
+						return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+							TotalRecords: &records, Count: &records, Data: rows}}, nil
+					})
+				for _, namespacedName := range []*types.NamespacedName{testAccountNamespacedName, testAccountNamespacedName02} {
+					accCfg, _ := c.cloudCommon.GetCloudAccountByName(namespacedName)
+					accCfg.GetServiceConfig().(*computeServiceConfig).resourceGraphAPIClient = mockResourceGraph
+				}
+			})
+
+			AfterEach(func() {
+				c.RemoveProviderAccount(testAccountNamespacedName02)
+				cloudresource.SetCoalesceInventoryQueries(false)
+			})
+
+			pollAccounts := func() {
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{
+						VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01},
+					},
+				}
+				selector02 := selector.DeepCopy()
+				selector02.Spec.AccountName = testAccountNamespacedName02.Name
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName02, selector02)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(c.DoInventoryPoll(testAccountNamespacedName02)).Should(BeNil())
+			}
+
+			It("Should feed both accounts on the same subscription from one query", func() {
+				pollAccounts()
+				Expect(queryCount).To(Equal(1))
+
+				selectorNamespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+				for _, namespacedName := range []*types.NamespacedName{testAccountNamespacedName, testAccountNamespacedName02} {
+					inventory, err := c.GetCloudInventory(namespacedName)
+					Expect(err).Should(BeNil())
+					Expect(inventory.VmMap[selectorNamespacedName]).To(HaveLen(1))
+				}
+			})
+
+			It("Should query again once the shared result expires", func() {
+				pollAccounts()
+				queryCoalescer.now = func() time.Time {
+					return time.Now().Add(2 * resourceGraphQueryCoalesceWindow)
+				}
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(queryCount).To(Equal(2))
+			})
+
+			It("Should query for each account using different credentials", func() {
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName02)
+				accCfg.GetServiceConfig().(*computeServiceConfig).credentials.ClientID = "testClientID02"
+				pollAccounts()
+				Expect(queryCount).To(Equal(2))
+			})
+
+			It("Should query for each account when coalescing is disabled", func() {
+				cloudresource.SetCoalesceInventoryQueries(false)
+				pollAccounts()
+				Expect(queryCount).To(Equal(2))
+			})
+
+			It("Should share queries differing only in whitespace and subscription order", func() {
+				query01 := "Resources | where type =~ 'microsoft.compute/virtualmachines'"
+				query02 := " Resources\n| where type =~\t'microsoft.compute/virtualmachines' "
+				subscription01, subscription02 := "SUB01", "sub02"
+				Expect(resourceGraphQueryKey("cred", &query01, []*string{&subscription01, &subscription02})).To(
+					Equal(resourceGraphQueryKey("cred", &query02, []*string{&subscription02, &subscription01})))
+				Expect(resourceGraphQueryKey("cred", &query01, []*string{&subscription01})).NotTo(
+					Equal(resourceGraphQueryKey("cred02", &query01, []*string{&subscription01})))
+			})
+
+			It("Should stop waiting for the in-flight query when the context is done", func() {
+				started, release := make(chan struct{}), make(chan struct{})
+				go func() {
+					_, _, _ = queryCoalescer.do(context.Background(), "key", func() ([]interface{}, int64, error) {
+						close(started)
+						<-release
+						return nil, 0, nil
+					})
+				}()
+				<-started
+				defer close(release)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, _, err := queryCoalescer.do(ctx, "key", func() ([]interface{}, int64, error) {
+					return nil, 0, nil
+				})
+				Expect(err).To(MatchError(context.Canceled))
+			})
+
+			It("Should query again when the in-flight query is cancelled by its caller", func() {
+				started, release := make(chan struct{}), make(chan struct{})
+				go func() {
+					_, _, _ = queryCoalescer.do(context.Background(), "key", func() ([]interface{}, int64, error) {
+						close(started)
+						<-release
+						return nil, 0, context.Canceled
+					})
+				}()
+				<-started
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					close(release)
+				}()
+
+				_, count, err := queryCoalescer.do(context.Background(), "key", func() ([]interface{}, int64, error) {
+					return nil, 1, nil
+				})
+				Expect(err).Should(BeNil())
+				Expect(count).To(Equal(int64(1)))
+			})
+		})
+
+		Context("Credentials rotation scenarios", func() {
+			It("Should trigger drift check after credentials rotation", func() {
+				rotatedAccounts := make(chan types.NamespacedName, 1)
+				c.SetCredentialRotationHook(func(accountNamespacedName *types.NamespacedName) {
+					rotatedAccounts <- *accountNamespacedName
+				})
+
+				// Account add with unchanged credentials is not a rotation.
+				err := c.AddProviderAccount(fakeClient, account)
+				Expect(err).Should(BeNil())
+				Expect(rotatedAccounts).NotTo(Receive())
+
+				credential2 := fmt.Sprintf(`{"subscriptionId": "%s",
+				"clientId": "%s",
+				"tenantId": "%s",
+				"clientKey": "%s"
+			}`, testSubID, testClientID, testTenantID, "testClientKey02")
+				secret.Data = map[string][]byte{"credentials": []byte(credential2)}
+				err = fakeClient.Update(context.Background(), secret)
+				Expect(err).Should(BeNil())
+
+				// Connectivity is re-validated with the rotated credentials before the drift check is triggered.
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return([]network.VirtualNetwork{}, nil).Times(1)
+				err = c.AddProviderAccount(fakeClient, account)
+				Expect(err).Should(BeNil())
+				// the drift check is triggered asynchronously, not holding up the account update.
+				Eventually(rotatedAccounts).Should(Receive(Equal(*testAccountNamespacedName)))
+			})
+
+			It("Should not trigger drift check when connectivity fails after credentials rotation", func() {
+				hookCalled := make(chan struct{}, 1)
+				c.SetCredentialRotationHook(func(_ *types.NamespacedName) {
+					hookCalled <- struct{}{}
+				})
+
+				credential2 := fmt.Sprintf(`{"subscriptionId": "%s",
+				"clientId": "%s",
+				"tenantId": "%s",
+				"clientKey": "%s"
+			}`, testSubID, testClientID, testTenantID, "testClientKey02")
+				secret.Data = map[string][]byte{"credentials": []byte(credential2)}
+				err := fakeClient.Update(context.Background(), secret)
+				Expect(err).Should(BeNil())
+
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(nil, fmt.Errorf("unauthorized")).Times(1)
+				err = c.AddProviderAccount(fakeClient, account)
+				Expect(err).Should(BeNil())
+				Eventually(func() string {
+					status, err := c.GetAccountStatus(testAccountNamespacedName)
+					Expect(err).Should(BeNil())
+					return status.Error
+				}).Should(Equal("unauthorized"))
+				Expect(hookCalled).NotTo(Receive())
+			})
+
+			It("Should apply account option changes in place without credentials rotation", func() {
+				hookCalled := false
+				c.SetCredentialRotationHook(func(_ *types.NamespacedName) {
+					hookCalled = true
+				})
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				selector.Spec.VMSelector = []v1alpha1.VirtualMachineSelector{
+					{VpcMatch: &v1alpha1.EntityMatch{MatchID: testVnetID01}},
+				}
+				Expect(c.AddAccountResourceSelector(testAccountNamespacedName, selector)).Should(BeNil())
+				selectorNamespacedName := types.NamespacedName{Namespace: selector.Namespace, Name: selector.Name}
+				filters := computeCfg.computeFilters[selectorNamespacedName]
+				computeCfg.selectorHolds.SetThreshold(1)
+				internal.HoldSpikedSelectors(computeCfg.selectorHolds, computeCfg.selectors,
+					map[types.NamespacedName][]string{selectorNamespacedName: nil},
+					map[types.NamespacedName][]string{selectorNamespacedName: {testVMID01, testVMID01 + "-2"}},
+					func(vmID string) string { return vmID })
+				Expect(computeCfg.selectorHolds.IsHeld(selectorNamespacedName)).To(BeTrue())
+
+				account.Annotations = map[string]string{
+					v1alpha1.AccountAnnotationInventoryFields:             "tags",
+					v1alpha1.AccountAnnotationSelectorMatchSpikeThreshold: "5",
+				}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(hookCalled).To(BeFalse())
+				Expect(accCfg.GetServiceConfig()).To(BeIdenticalTo(computeCfg))
+				Expect(computeCfg.credentials.selectorMatchSpikeThreshold).To(Equal(5))
+				Expect(computeCfg.credentials.inventoryFields).To(Equal([]string{"tags"}))
+				Expect(computeCfg.computeFilters[selectorNamespacedName]).NotTo(Equal(filters))
+				Expect(computeCfg.selectorHolds.IsHeld(selectorNamespacedName)).To(BeTrue())
+			})
+
+			It("Should trigger drift check when account options changing security enforcement are updated", func() {
+				var changedAccounts []types.NamespacedName
+				c.SetSecurityOptionsChangedHook(func(accountNamespacedName *types.NamespacedName) {
+					changedAccounts = append(changedAccounts, *accountNamespacedName)
+				})
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+
+				// inventory options do not change how security groups are enforced.
+				account.Annotations = map[string]string{v1alpha1.AccountAnnotationInventoryFields: "tags"}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(changedAccounts).To(BeEmpty())
+
+				for _, annotation := range [][2]string{
+					{v1alpha1.AccountAnnotationDenyRulePlacement, string(v1alpha1.DenyRulePlacementAfterAllowRules)},
+					{v1alpha1.AccountAnnotationPeerAddressSpaceFallback, "true"},
+					{v1alpha1.AccountAnnotationDetachPolicy, string(v1alpha1.SecurityGroupDetachPolicyLeaveUnattached)},
+				} {
+					changedAccounts = nil
+					account.Annotations[annotation[0]] = annotation[1]
+					Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+					Expect(changedAccounts).To(Equal([]types.NamespacedName{*testAccountNamespacedName}), annotation[0])
+				}
+
+				changedAccounts = nil
+				account.Spec.AzureConfig.EgressAllowCIDRs = []string{"10.0.0.0/8"}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				Expect(changedAccounts).To(Equal([]types.NamespacedName{*testAccountNamespacedName}))
+			})
+		})
+
+		Context("Fallback secret scenarios", func() {
+			It("Should use fallback secret when primary secret is invalid", func() {
+				fallbackCredential := fmt.Sprintf(`{"subscriptionId": "%s",
+				"clientId": "%s",
+				"tenantId": "%s",
+				"clientKey": "%s"
+			}`, "testSubID02", testClientID, testTenantID, testClientKey)
+				fallbackSecret := &corev1.Secret{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      "fallback",
+						Namespace: testAccountNamespacedName.Namespace,
+					},
+					Data: map[string][]byte{
+						"credentials": []byte(fallbackCredential),
+					},
+				}
+				err := fakeClient.Create(context.Background(), fallbackSecret)
+				Expect(err).Should(BeNil())
+				secret.Data = map[string][]byte{"credentials": []byte(`{"subscriptionId": ""}`)}
+				err = fakeClient.Update(context.Background(), secret)
+				Expect(err).Should(BeNil())
+
+				account.Spec.AzureConfig.FallbackSecretRefs = []v1alpha1.SecretReference{
+					{Name: "fallback", Namespace: testAccountNamespacedName.Namespace, Key: credentials},
+				}
+				config, err := setAccountCredentials(fakeClient, account)
+				Expect(err).Should(BeNil())
+				Expect(config.(*azureAccountConfig).SubscriptionID).To(Equal("testSubID02"))
+
+				// credentials resolved from primary and fallback secrets are compared by content.
+				secret.Data = map[string][]byte{"credentials": []byte(fallbackCredential)}
+				err = fakeClient.Update(context.Background(), secret)
+				Expect(err).Should(BeNil())
+				primaryConfig, err := setAccountCredentials(fakeClient, account)
+				Expect(err).Should(BeNil())
+				credsChanged, _ := compareAccountCredentials(testAccountNamespacedName.String(), config, primaryConfig)
+				Expect(credsChanged).To(BeFalse())
+			})
+
+			It("Should fail over to fallback secret when cloud rejects primary credentials", func() {
+				fallbackCredential := fmt.Sprintf(`{"subscriptionId": "%s",
+				"clientId": "%s",
+				"tenantId": "%s",
+				"clientKey": "%s"
+			}`, "testSubID02", testClientID, testTenantID, testClientKey)
+				fallbackSecret := &corev1.Secret{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      "fallback",
+						Namespace: testAccountNamespacedName.Namespace,
+					},
+					Data: map[string][]byte{
+						"credentials": []byte(fallbackCredential),
+					},
+				}
+				Expect(fakeClient.Create(context.Background(), fallbackSecret)).Should(BeNil())
+				account.Spec.AzureConfig.FallbackSecretRefs = []v1alpha1.SecretReference{
+					{Name: "fallback", Namespace: testAccountNamespacedName.Namespace, Key: credentials},
+				}
+				Expect(c.AddProviderAccount(fakeClient, account)).Should(BeNil())
+				getCredentials := func() *azureAccountConfig {
+					accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+					return accCfg.GetServiceConfig().(*computeServiceConfig).credentials
+				}
+				Expect(getCredentials().SubscriptionID).To(Equal(testSubID))
+				primaryFingerprint := getCredentials().credentialFingerprint
+
+				rotated := make(chan struct{}, 1)
+				c.SetCredentialRotationHook(func(_ *types.NamespacedName) {
+					rotated <- struct{}{}
+				})
+				unauthorizedError := &azcore.ResponseError{StatusCode: http.StatusUnauthorized, RawResponse: &http.Response{
+					StatusCode: http.StatusUnauthorized,
+					Body:       http.NoBody,
+					Request:    &http.Request{Method: http.MethodGet, URL: &url.URL{Scheme: "https", Host: "management.azure.com"}},
+				}}
+				gomock.InOrder(
+					mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).
+						Return(nil, unauthorizedError).Times(1),
+					mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).
+						Return([]network.VirtualNetwork{}, nil).AnyTimes(),
+				)
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).ShouldNot(BeNil())
+				Expect(getCredentials().SubscriptionID).To(Equal("testSubID02"))
+				Eventually(rotated).Should(Receive())
+				Expect(internal.RejectedCredentials.IsRejected(testAccountNamespacedName, primaryFingerprint)).To(BeTrue())
+
+				// rejected credentials are forgotten with the account.
+				c.RemoveProviderAccount(testAccountNamespacedName)
+				Expect(internal.RejectedCredentials.IsRejected(testAccountNamespacedName, primaryFingerprint)).To(BeFalse())
+			})
+
+			It("Should fail when primary and fallback secrets are invalid", func() {
+				secret.Data = map[string][]byte{"credentials": []byte(`{"subscriptionId": ""}`)}
+				err := fakeClient.Update(context.Background(), secret)
+				Expect(err).Should(BeNil())
+
+				account.Spec.AzureConfig.FallbackSecretRefs = []v1alpha1.SecretReference{
+					{Name: "notexist", Namespace: testAccountNamespacedName.Namespace, Key: credentials},
+				}
+				config, err := setAccountCredentials(fakeClient, account)
+				Expect(err).ShouldNot(BeNil())
+				Expect(config.(*azureAccountConfig).SubscriptionID).To(Equal(internal.AccountCredentialsDefault))
+			})
+		})
+
+		Context("Credential fingerprint scenarios", func() {
+			It("Should detect a change of a secret field not known to the plugin", func() {
+				credentialWithField := func(value string) []byte {
+					return []byte(fmt.Sprintf(`{"subscriptionId": "%s", "clientId": "%s", "tenantId": "%s", "clientKey": "%s",
+				"clientCertificate": "%s"}`, testSubID, testClientID, testTenantID, testClientKey, value))
+				}
+				secret.Data = map[string][]byte{"credentials": credentialWithField("cert01")}
+				Expect(fakeClient.Update(context.Background(), secret)).Should(BeNil())
+				config, err := setAccountCredentials(fakeClient, account)
+				Expect(err).Should(BeNil())
+
+				secret.Data = map[string][]byte{"credentials": credentialWithField("cert02")}
+				Expect(fakeClient.Update(context.Background(), secret)).Should(BeNil())
+				newConfig, err := setAccountCredentials(fakeClient, account)
+				Expect(err).Should(BeNil())
+				Expect(newConfig.(*azureAccountConfig).AzureAccountCredential).To(
+					Equal(config.(*azureAccountConfig).AzureAccountCredential))
+				credsChanged, _ := compareAccountCredentials(testAccountNamespacedName.String(), config, newConfig)
+				Expect(credsChanged).To(BeTrue())
+				Expect(utils.ChangedCredentialFields(config.(*azureAccountConfig).credentialFingerprint,
+					newConfig.(*azureAccountConfig).credentialFingerprint)).To(Equal([]string{"clientCertificate"}))
+			})
+		})
+
+		Context("API quota scenarios", func() {
+			AfterEach(func() {
+				internal.APIQuotaMetrics.DeleteAccount(string(providerType), testAccountNamespacedName.String())
+			})
+
+			It("Should record remaining quota from rate limit headers", func() {
+				header := http.Header{}
+				header.Set("x-ms-ratelimit-remaining-subscription-reads", "11999")
+				header.Set("x-ms-ratelimit-remaining-subscription-writes", "42")
+				header.Set(resourceGraphQuotaRemainingHeader, "14")
+				header.Set("x-ms-ratelimit-remaining-invalid", "not-a-number")
+				pipeline := azruntime.NewPipeline("nephe", "test", azruntime.PipelineOptions{}, &policy.ClientOptions{
+					PerCallPolicies: []policy.Policy{&rateLimitPolicy{account: testAccountNamespacedName.String()}},
+					Transport:       &fakeQuotaTransport{header: header},
+				})
+				req, err := azruntime.NewRequest(context.Background(), http.MethodGet, "https://management.azure.com/test")
+				Expect(err).Should(BeNil())
+				_, err = pipeline.Do(req)
+				Expect(err).Should(BeNil())
+
+				account := testAccountNamespacedName.String()
+				Expect(testutil.ToFloat64(internal.APIQuotaRemainingGauge.WithLabelValues(account, string(providerType),
+					"subscription-reads"))).To(Equal(float64(11999)))
+				Expect(testutil.ToFloat64(internal.APIQuotaRemainingGauge.WithLabelValues(account, string(providerType),
+					"subscription-writes"))).To(Equal(float64(42)))
+
+				status, err := c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.APIQuotas).To(Equal([]v1alpha1.CloudAPIQuota{
+					{Name: resourceGraphQuotaName, Remaining: 14},
+					{Name: "subscription-reads", Remaining: 11999},
+					{Name: "subscription-writes", Remaining: 42},
+				}))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+				Expect(internal.APIQuotaMetrics.Get(string(providerType), account)).To(BeEmpty())
+			})
+		})
+
+		Context("API error scenarios", func() {
+			AfterEach(func() {
+				internal.DeleteAPIErrors(string(providerType), testAccountNamespacedName.String())
+			})
+
+			It("Should count failed API calls by error class", func() {
+				account := testAccountNamespacedName.String()
+				for _, statusCode := range []int{http.StatusOK, http.StatusUnauthorized, http.StatusForbidden,
+					http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError,
+					http.StatusServiceUnavailable, http.StatusConflict} {
+					pipeline := azruntime.NewPipeline("nephe", "test", azruntime.PipelineOptions{}, &policy.ClientOptions{
+						PerCallPolicies: []policy.Policy{&apiErrorPolicy{account: account}},
+						Retry:           policy.RetryOptions{MaxRetries: -1},
+						Transport:       &fakeStatusTransport{statusCode: statusCode},
+					})
+					req, err := azruntime.NewRequest(context.Background(), http.MethodGet, "https://management.azure.com/test")
+					Expect(err).Should(BeNil())
+					_, err = pipeline.Do(req)
+					Expect(err).Should(BeNil())
+				}
+
+				expected := map[internal.APIErrorClass]float64{
+					internal.APIErrorClassAuth:        2,
+					internal.APIErrorClassNotFound:    1,
+					internal.APIErrorClassThrottle:    1,
+					internal.APIErrorClassServerError: 2,
+					internal.APIErrorClassOther:       1,
+				}
+				for class, count := range expected {
+					Expect(testutil.ToFloat64(internal.APIErrorsCounter.WithLabelValues(account, string(providerType),
+						string(class)))).To(Equal(count), "class %s", class)
+				}
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+				for class := range expected {
+					Expect(internal.APIErrorsCounter.DeleteLabelValues(account, string(providerType), string(class))).To(BeFalse())
+				}
+			})
+
+			It("Should classify authentication and transport errors", func() {
+				class, ok := classifyAzureError(nil, fmt.Errorf("token: %w", &azidentity.AuthenticationFailedError{}))
+				Expect(ok).To(BeTrue())
+				Expect(class).To(Equal(internal.APIErrorClassAuth))
+
+				class, ok = classifyAzureError(nil, errors.New("connection reset by peer"))
+				Expect(ok).To(BeTrue())
+				Expect(class).To(Equal(internal.APIErrorClassOther))
+
+				_, ok = classifyAzureError(&http.Response{StatusCode: http.StatusNoContent}, nil)
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		Context("Account identity scenarios", func() {
+			It("Should report redacted subscription and tenant IDs in account status", func() {
+				status, err := c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.SubscriptionID).To(Equal("*ubID"))
+				Expect(status.TenantID).To(Equal("****ntID"))
+				Expect(fmt.Sprintf("%+v", *status)).ShouldNot(ContainSubstring(testClientKey))
+			})
+		})
+
+		Context("Account condition scenarios", func() {
+			It("Should transition Connected and InventoryReady conditions on poll failure and recovery", func() {
+				gomock.InOrder(
+					mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).
+						Return(nil, fmt.Errorf("unauthorized: %w", &azidentity.AuthenticationFailedError{})).Times(1),
+					mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).
+						Return(createVnetObject([]string{testVnetID01}), nil).AnyTimes(),
+				)
+
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).ShouldNot(BeNil())
+				status, err := c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				connected := meta.FindStatusCondition(status.Conditions, v1alpha1.AccountConditionConnected)
+				Expect(connected).ShouldNot(BeNil())
+				Expect(connected.Status).To(Equal(v1.ConditionFalse))
+				Expect(connected.Reason).To(Equal(v1alpha1.AccountReasonInventoryPollFailed))
+				Expect(connected.Message).To(ContainSubstring("unauthorized"))
+				Expect(meta.IsStatusConditionFalse(status.Conditions, v1alpha1.AccountConditionInventoryReady)).To(BeTrue())
+				credentialsValid := meta.FindStatusCondition(status.Conditions, v1alpha1.AccountConditionCredentialsValid)
+				Expect(credentialsValid).ShouldNot(BeNil())
+				Expect(credentialsValid.Status).To(Equal(v1.ConditionFalse))
+				Expect(credentialsValid.Reason).To(Equal(v1alpha1.AccountReasonCredentialsRejected))
+
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				status, err = c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(meta.IsStatusConditionTrue(status.Conditions, v1alpha1.AccountConditionConnected)).To(BeTrue())
+				inventoryReady := meta.FindStatusCondition(status.Conditions, v1alpha1.AccountConditionInventoryReady)
+				Expect(inventoryReady).ShouldNot(BeNil())
+				Expect(inventoryReady.Status).To(Equal(v1.ConditionTrue))
+				Expect(inventoryReady.Reason).To(Equal(v1alpha1.AccountReasonInventoryInitialized))
+				Expect(meta.IsStatusConditionTrue(status.Conditions, v1alpha1.AccountConditionCredentialsValid)).To(BeTrue())
+			})
+		})
+
+		Context("Cache snapshot footprint", func() {
+			It("Should report the resource counts of a populated snapshot", func() {
+				cloudresource.SetInventorySnapshotHistory(2)
+				defer cloudresource.SetInventorySnapshotHistory(0)
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				computeCfg.ResetInventoryCache()
+				Expect(*computeCfg.GetSnapshotFootprint()).To(BeZero())
+
+				otherSelector := types.NamespacedName{Namespace: "namespace01", Name: "selector02"}
+				vmIDs := []string{"vm01", "vm02", "vm03"}
+				vms := make([]*virtualMachineTable, 0, len(vmIDs))
+				for i := range vmIDs {
+					vms = append(vms, &virtualMachineTable{ID: &vmIDs[i], Name: &vmIDs[i], VnetID: &testVnetID01})
+				}
+				computeCfg.updateSnapshot(&computeResourcesCacheSnapshot{
+					vms: map[types.NamespacedName][]*virtualMachineTable{
+						*testSelectorNamespacedName: vms[:2],
+						otherSelector:               vms[2:],
+					},
+					vnets: createVnetObject([]string{testVnetID01, testVnetID02}),
+					vnetPeers: map[string][][]string{
+						strings.ToLower(testVnetID01): {{testVnetID02, "10.1.0.0/16"}, {"remoteVnet", "10.3.0.0/16"}},
+					},
+				})
+
+				footprint, err := c.GetSnapshotFootprint(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(footprint.VMs).To(Equal(3))
+				Expect(footprint.Vpcs).To(Equal(2))
+				Expect(footprint.VpcPeers).To(Equal(2))
+				Expect(footprint.Bytes).To(BeNumerically(">", 0))
+				Expect(footprint.HistorySnapshots).To(BeZero())
+
+				// properties of the cached VMs are accounted for.
+				vmSize := internal.EstimateSize(vms[0])
+				computerName := strings.Repeat("a", 1024)
+				vms[0].Properties = &compute.VirtualMachineProperties{
+					OSProfile: &compute.OSProfile{ComputerName: &computerName},
+				}
+				Expect(internal.EstimateSize(vms[0])).To(BeNumerically(">", vmSize+1024))
+
+				account, provider := testAccountNamespacedName.String(), string(providerType)
+				Expect(testutil.ToFloat64(internal.CacheSnapshotResourcesGauge.WithLabelValues(account, provider, "vm"))).
+					To(Equal(float64(3)))
+				Expect(testutil.ToFloat64(internal.CacheSnapshotResourcesGauge.WithLabelValues(account, provider,
+					"vpc_peer"))).To(Equal(float64(2)))
+				Expect(testutil.ToFloat64(internal.CacheSnapshotBytesGauge.WithLabelValues(account, provider))).
+					To(Equal(float64(footprint.Bytes)))
+
+				// the previous snapshot kept in the snapshot history is accounted for.
+				computeCfg.updateSnapshot(&computeResourcesCacheSnapshot{vms: map[types.NamespacedName][]*virtualMachineTable{}})
+				historyFootprint := computeCfg.GetSnapshotFootprint()
+				Expect(historyFootprint.VMs).To(BeZero())
+				Expect(historyFootprint.HistorySnapshots).To(Equal(1))
+				Expect(historyFootprint.HistoryBytes).To(Equal(footprint.Bytes))
+				Expect(testutil.ToFloat64(internal.CacheSnapshotBytesGauge.WithLabelValues(account, provider))).
+					To(Equal(float64(historyFootprint.Bytes + historyFootprint.HistoryBytes)))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Vnet peering scenarios", func() {
+			It("Should report unresolved vnet peers", func() {
+				unresolvedPeerID := "/subscriptions/otherSubID/resourceGroups/otherRG/providers/Microsoft.Network/virtualNetworks/unresolved"
+				remotePeerID := "/subscriptions/otherSubID/resourceGroups/otherRG/providers/Microsoft.Network/virtualNetworks/remote"
+				remotePrefix := "10.10.0.0/16"
+				vnets := createVnetObject([]string{testVnetID01, testVnetID02})
+				vnets[0].Properties.VirtualNetworkPeerings = []*network.VirtualNetworkPeering{
+					// peer visible to the account.
+					{Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+						RemoteVirtualNetwork: &network.SubResource{ID: &testVnetID02}}},
+					// peer not visible to the account, with address space reported by the peering.
+					{Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+						RemoteVirtualNetwork: &network.SubResource{ID: &remotePeerID},
+						RemoteAddressSpace:   &network.AddressSpace{AddressPrefixes: []*string{&remotePrefix}}}},
+					// peer not visible to the account, without address space.
+					{Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+						RemoteVirtualNetwork: &network.SubResource{ID: &unresolvedPeerID}}},
+				}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(vnets, nil).AnyTimes()
+
+				// the address space of the peering is not used unless the account opts in to it.
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(testutil.ToFloat64(internal.UnresolvedVpcPeersGauge.WithLabelValues(testAccountNamespacedName.String(),
+					string(providerType)))).To(Equal(float64(2)))
+				status, err := c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.UnresolvedVpcPeers).To(Equal([]string{strings.ToLower(remotePeerID),
+					strings.ToLower(unresolvedPeerID)}))
+
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				accCfg.GetServiceConfig().(*computeServiceConfig).credentials.peerAddressSpaceFallback = true
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(testutil.ToFloat64(internal.UnresolvedVpcPeersGauge.WithLabelValues(testAccountNamespacedName.String(),
+					string(providerType)))).To(Equal(float64(1)))
+				status, err = c.GetAccountStatus(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(status.UnresolvedVpcPeers).To(Equal([]string{strings.ToLower(unresolvedPeerID)}))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+
+			It("Should reuse the vnet peering map when peerings are unchanged", func() {
+				vnets := createVnetObject([]string{testVnetID01, testVnetID02})
+				vnets[0].Properties.VirtualNetworkPeerings = []*network.VirtualNetworkPeering{
+					{Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+						RemoteVirtualNetwork: &network.SubResource{ID: &testVnetID02}}},
+				}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(vnets, nil).AnyTimes()
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				peers := computeCfg.getVnetPeers(strings.ToLower(testVnetID01))
+				Expect(peers).To(HaveLen(1))
+				cachedPeers := computeCfg.vnetPeersCache.peers
+
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(reflect.ValueOf(computeCfg.vnetPeersCache.peers).Pointer()).
+					To(Equal(reflect.ValueOf(cachedPeers).Pointer()))
+
+				// a new peering rebuilds the map.
+				remotePeerID := "/subscriptions/otherSubID/resourceGroups/otherRG/providers/Microsoft.Network/virtualNetworks/remote"
+				vnets[1].Properties.VirtualNetworkPeerings = []*network.VirtualNetworkPeering{
+					{Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+						RemoteVirtualNetwork: &network.SubResource{ID: &remotePeerID}}},
+				}
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(reflect.ValueOf(computeCfg.vnetPeersCache.peers).Pointer()).
+					NotTo(Equal(reflect.ValueOf(cachedPeers).Pointer()))
+				Expect(computeCfg.getVnetPeers(strings.ToLower(testVnetID02))).To(HaveLen(1))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+
+			It("Should export vnet peerings matching the peering map", func() {
+				remotePrefix := "10.10.0.0/16"
+				connected := network.VirtualNetworkPeeringStateConnected
+				initiated := network.VirtualNetworkPeeringStateInitiated
+				vnets := createVnetObject([]string{testVnetID01, testVnetID02})
+				vnets[0].Properties.VirtualNetworkPeerings = []*network.VirtualNetworkPeering{
+					{Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+						RemoteVirtualNetwork: &network.SubResource{ID: &testVnetID02},
+						RemoteAddressSpace:   &network.AddressSpace{AddressPrefixes: []*string{&remotePrefix}},
+						PeeringState:         &connected}},
+				}
+				vnets[1].Properties.VirtualNetworkPeerings = []*network.VirtualNetworkPeering{
+					{Properties: &network.VirtualNetworkPeeringPropertiesFormat{
+						RemoteVirtualNetwork: &network.SubResource{ID: &testVnetID01},
+						PeeringState:         &initiated}},
+				}
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).Return(vnets, nil).AnyTimes()
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+
+				peerings, err := c.GetVpcPeerings(testAccountNamespacedName)
+				Expect(err).Should(BeNil())
+				Expect(peerings).To(Equal([]nephetypes.VpcPeering{
+					{
+						AccepterID:      strings.ToLower(testVnetID01),
+						RequesterID:     strings.ToLower(testVnetID02),
+						SourceCIDR:      "192.16.0.0/24",
+						DestinationCIDR: remotePrefix,
+						State:           string(connected),
+					},
+					{
+						AccepterID:  strings.ToLower(testVnetID02),
+						RequesterID: strings.ToLower(testVnetID01),
+						SourceCIDR:  "192.16.0.0/24",
+						State:       string(initiated),
+					},
+				}))
+				for _, peering := range peerings {
+					Expect(computeCfg.getVnetPeers(peering.AccepterID)).To(Equal([][]string{
+						{peering.RequesterID, peering.DestinationCIDR, peering.SourceCIDR}}))
+				}
+
+				_, err = c.GetVpcPeerings(&types.NamespacedName{Namespace: "notexist", Name: "notexist"})
+				Expect(err).ShouldNot(BeNil())
+				c.RemoveProviderAccount(testAccountNamespacedName)
+			})
+		})
+
+		Context("Vnet deletion scenarios", func() {
+			It("Should clean up security groups of a vnet deleted from cloud", func() {
+				var deletedVpcAccounts []types.NamespacedName
+				c.SetVpcDeletedHook(func(accountNamespacedName *types.NamespacedName) {
+					deletedVpcAccounts = append(deletedVpcAccounts, *accountNamespacedName)
+				})
+				vnets := createVnetObject([]string{testVnetID01, testVnetID02})
+				mockazureVirtualNetworksWrapper.EXPECT().listAllComplete(gomock.Any()).AnyTimes().DoAndReturn(
+					func(_ context.Context) ([]network.VirtualNetwork, error) {
+						return vnets, nil
+					})
+				accCfg, _ := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				computeCfg := accCfg.GetServiceConfig().(*computeServiceConfig)
+				account := testAccountNamespacedName.String()
+				provider := string(providerType)
+				groups := []*cloudresource.CloudResourceID{
+					{Name: "web", Vpc: testVnetID01},
+					{Name: "web", Vpc: testVnetID02},
+				}
+				for _, group := range groups {
+					cloudAsgName := group.GetCloudName(false)
+					computeCfg.asgRefs.add(group.Vpc, cloudAsgName, group.Name, group.Vpc+"/asg")
+					internal.SecurityMetrics.AddGroup(provider, account, internal.SecurityGroupTypeAppliedTo, group)
+					internal.SecurityMetrics.SetRules(provider, account, group, 2)
+				}
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(deletedVpcAccounts).To(BeEmpty())
+
+				// vnet 2 is deleted out-of-band.
+				vnets = vnets[:1]
+				Expect(c.DoInventoryPoll(testAccountNamespacedName)).Should(BeNil())
+				Expect(deletedVpcAccounts).To(Equal([]types.NamespacedName{*testAccountNamespacedName}))
+				_, found := computeCfg.asgRefs.get(testVnetID01, groups[0].GetCloudName(false))
+				Expect(found).To(BeTrue())
+				_, found = computeCfg.asgRefs.get(testVnetID02, groups[1].GetCloudName(false))
+				Expect(found).To(BeFalse())
+				Expect(testutil.ToFloat64(internal.SecurityGroupsGauge.WithLabelValues(account, provider,
+					string(internal.SecurityGroupTypeAppliedTo)))).To(Equal(float64(1)))
+				Expect(testutil.ToFloat64(internal.SecurityRulesGauge.WithLabelValues(account, provider))).To(Equal(float64(2)))
+
+				c.RemoveProviderAccount(testAccountNamespacedName)
+				internal.SecurityMetrics.DeleteAccount(provider, account)
+			})
+		})
+
+		Context("VM Provider scenarios", func() {
+			It("Remove Provider Account", func() {
+				c.RemoveProviderAccount(testAccountNamespacedName)
+
+				accCfg, ok := c.cloudCommon.GetCloudAccountByName(testAccountNamespacedName)
+				Expect(accCfg).Should(BeNil())
+				Expect(ok).To(Equal(false))
+			})
+		})
+	})
+
+	Context("VM creation time", func() {
+		var (
+			selectorNamespacedName = &types.NamespacedName{Namespace: "namespace01", Name: "selector01"}
+			vmRow                  map[string]interface{}
+		)
+
+		BeforeEach(func() {
+			vmRow = map[string]interface{}{
+				"id":     testVMID01,
+				"name":   testVM01,
+				"vnetId": testVnetID01,
+			}
+		})
+
+		It("Should parse VM creation time from resource graph response", func() {
+			vmRow["createdAt"] = "2023-04-05T10:20:30Z"
+
+			var vm virtualMachineTable
+			err := customDecode(vmRow, &vm)
+			Expect(err).Should(BeNil())
+			Expect(vm.CreatedAt).ShouldNot(BeNil())
+			expectedTime := time.Date(2023, time.April, 5, 10, 20, 30, 0, time.UTC)
+			Expect(vm.CreatedAt.Equal(expectedTime)).To(BeTrue())
+
+			vmObj := computeInstanceToInternalVirtualMachineObject(&vm, nil, selectorNamespacedName,
+				testAccountNamespacedName, testRegion)
+			Expect(vmObj).ShouldNot(BeNil())
+			Expect(vmObj.Status.CreatedAt).ShouldNot(BeNil())
+			Expect(vmObj.Status.CreatedAt.Time.Equal(expectedTime)).To(BeTrue())
+		})
+
+		It("Should handle VM without creation time", func() {
+			var vm virtualMachineTable
+			err := customDecode(vmRow, &vm)
+			Expect(err).Should(BeNil())
+			Expect(vm.CreatedAt).Should(BeNil())
+
+			vmObj := computeInstanceToInternalVirtualMachineObject(&vm, nil, selectorNamespacedName,
+				testAccountNamespacedName, testRegion)
+			Expect(vmObj).ShouldNot(BeNil())
+			Expect(vmObj.Status.CreatedAt).Should(BeNil())
+		})
+	})
+
+	Context("Throttled calls", func() {
+		var (
+			timer *fakeRetryTimer
+			calls int
+		)
+
+		throttledError := func(retryAfter string) error {
+			header := http.Header{}
+			if retryAfter != "" {
+				header.Set(retryAfterHeader, retryAfter)
+			}
+			return &azcore.ResponseError{
+				StatusCode:  http.StatusTooManyRequests,
+				RawResponse: &http.Response{StatusCode: http.StatusTooManyRequests, Header: header},
+			}
+		}
+
+		BeforeEach(func() {
+			calls = 0
+			timer = &fakeRetryTimer{}
+			newThrottleRetryTimer = func() backoff.Timer {
+				return timer
+			}
+		})
+
+		AfterEach(func() {
+			newThrottleRetryTimer = func() backoff.Timer {
+				return nil
+			}
+		})
+
+		It("Should wait as requested by Retry-After header of throttled response", func() {
+			err := retryOnThrottle(context.Background(), func() error {
+				calls++
+				if calls < 3 {
+					return throttledError("7")
+				}
+				return nil
+			})
+			Expect(err).Should(BeNil())
+			Expect(calls).To(Equal(3))
+			Expect(timer.waits).To(Equal([]time.Duration{7 * time.Second, 7 * time.Second}))
+		})
+
+		It("Should cap the wait requested by Retry-After header", func() {
+			err := retryOnThrottle(context.Background(), func() error {
+				calls++
+				if calls < 2 {
+					return throttledError("3600")
+				}
+				return nil
+			})
+			Expect(err).Should(BeNil())
+			Expect(calls).To(Equal(2))
+			Expect(timer.waits).To(Equal([]time.Duration{throttleRetryMaxInterval}))
+		})
+
+		It("Should fall back to exponential backoff without Retry-After header", func() {
+			err := retryOnThrottle(context.Background(), func() error {
+				calls++
+				if calls < 2 {
+					return throttledError("")
+				}
+				return nil
+			})
+			Expect(err).Should(BeNil())
+			Expect(calls).To(Equal(2))
+			Expect(timer.waits).To(HaveLen(1))
+			Expect(timer.waits[0]).To(BeNumerically("<=", 2*backoff.DefaultInitialInterval))
+		})
+
+		It("Should not retry errors other than throttling", func() {
+			err := retryOnThrottle(context.Background(), func() error {
+				calls++
+				return &azcore.ResponseError{StatusCode: http.StatusForbidden}
+			})
+			Expect(err).ShouldNot(BeNil())
+			Expect(calls).To(Equal(1))
+			Expect(timer.waits).To(BeEmpty())
+		})
+	})
+
+	Context("Fallback endpoints", func() {
+		var (
+			mockCtrl         *gomock.Controller
+			primaryClient    *MockazureResourceGraphWrapper
+			fallbackClient   *MockazureResourceGraphWrapper
+			failoverClient   *azureResourceGraphFailoverWrapper
+			query            = "Resources"
+			subscriptionID   = "SubID"
+			unreachableError = &url.Error{Op: "Post", URL: "https://management.azure.com", Err: errors.New("connection refused")}
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			primaryClient = NewMockazureResourceGraphWrapper(mockCtrl)
+			fallbackClient = NewMockazureResourceGraphWrapper(mockCtrl)
+			failoverClient = &azureResourceGraphFailoverWrapper{
+				clients: []azureResourceGraphWrapper{primaryClient, fallbackClient},
+			}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		It("Should query the fallback endpoint when the primary endpoint is unreachable", func() {
+			var records int64 = 1
+			primaryClient.EXPECT().resources(gomock.Any(), gomock.Any()).Times(1).
+				Return(resourcegraph.ClientResourcesResponse{}, unreachableError)
+			fallbackClient.EXPECT().resources(gomock.Any(), gomock.Any()).Times(1).
+				Return(resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+					TotalRecords: &records, Count: &records, Data: []interface{}{map[string]interface{}{"id": testVMID01}}}}, nil)
+
+			data, count, err := invokeResourceGraphQueryPages(context.Background(), failoverClient, &query, []*string{&subscriptionID})
+			Expect(err).Should(BeNil())
+			Expect(count).To(Equal(records))
+			Expect(data).To(HaveLen(1))
+		})
+
+		It("Should not query the fallback endpoint when the primary endpoint responds with an error", func() {
+			primaryClient.EXPECT().resources(gomock.Any(), gomock.Any()).Times(1).
+				Return(resourcegraph.ClientResourcesResponse{}, &azcore.ResponseError{StatusCode: http.StatusForbidden})
+			fallbackClient.EXPECT().resources(gomock.Any(), gomock.Any()).Times(0)
+
+			_, _, err := invokeResourceGraphQueryPages(context.Background(), failoverClient, &query, []*string{&subscriptionID})
+			Expect(err).ShouldNot(BeNil())
+		})
+
+		It("Should fail when all endpoints are unreachable", func() {
+			primaryClient.EXPECT().resources(gomock.Any(), gomock.Any()).Times(1).
+				Return(resourcegraph.ClientResourcesResponse{}, unreachableError)
+			fallbackClient.EXPECT().resources(gomock.Any(), gomock.Any()).Times(1).
+				Return(resourcegraph.ClientResourcesResponse{}, unreachableError)
+
+			_, _, err := invokeResourceGraphQueryPages(context.Background(), failoverClient, &query, []*string{&subscriptionID})
+			Expect(err).Should(MatchError(unreachableError))
+		})
+
+		It("Should list vnets from the fallback endpoint when the primary endpoint is unreachable", func() {
+			primaryVnetClient := NewMockazureVirtualNetworksWrapper(mockCtrl)
+			fallbackVnetClient := NewMockazureVirtualNetworksWrapper(mockCtrl)
+			vnetClient := &azureVirtualNetworksFailoverWrapper{
+				clients: []azureVirtualNetworksWrapper{primaryVnetClient, fallbackVnetClient},
+			}
+			primaryVnetClient.EXPECT().listAllComplete(gomock.Any()).Times(1).
+				Return(nil, fmt.Errorf("error iterating over a list of virtual networks: %w", unreachableError))
+			fallbackVnetClient.EXPECT().listAllComplete(gomock.Any()).Times(1).
+				Return(createVnetObject([]string{testVnetID01}), nil)
+
+			vnets, err := vnetClient.listAllComplete(context.Background())
+			Expect(err).Should(BeNil())
+			Expect(vnets).To(HaveLen(1))
+
+			primaryVnetClient.EXPECT().listAllComplete(gomock.Any()).Times(1).
+				Return(nil, &azcore.ResponseError{StatusCode: http.StatusForbidden})
+			fallbackVnetClient.EXPECT().listAllComplete(gomock.Any()).Times(0)
+			_, err = vnetClient.listAllComplete(context.Background())
+			Expect(err).ShouldNot(BeNil())
+		})
+	})
+})
+
+// fakeRetryTimer records the requested waits and fires right away.
+type fakeRetryTimer struct {
+	waits []time.Duration
+	c     chan time.Time
+}
+
+func (t *fakeRetryTimer) Start(duration time.Duration) {
+	t.waits = append(t.waits, duration)
+	t.c = make(chan time.Time, 1)
+	t.c <- time.Now()
+}
+
+func (t *fakeRetryTimer) Stop() {}
+
+func (t *fakeRetryTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func getEmptyResourceGraphResult() resourcegraph.ClientResourcesResponse {
+	records := int64(0)
+	return resourcegraph.ClientResourcesResponse{QueryResponse: resourcegraph.QueryResponse{
+		TotalRecords: &records, Count: &records, Data: []interface{}{}}}
+}
+
+func getResourceGraphResult() resourcegraph.ClientResourcesResponse {
+	var records int64 = 0
+	result := resourcegraph.ClientResourcesResponse{
+		QueryResponse: resourcegraph.QueryResponse{
+			TotalRecords:    &records,
+			Count:           &records,
+			ResultTruncated: nil,
+			SkipToken:       nil,
+			Data:            nil,
+			Facets:          nil,
+		},
+	}
+
+	return result
+}
+
+// isManagementLockQuery returns true for the management lock query, issued alongside the VM queries.
+func isManagementLockQuery(query resourcegraph.QueryRequest) bool {
+	return strings.Contains(*query.Query, "microsoft.authorization/locks")
+}
+
+// isScaleSetInstanceQuery returns true for the query of uniform scale set instances, issued alongside each VM query.
+func isScaleSetInstanceQuery(query resourcegraph.QueryRequest) bool {
+	return strings.HasPrefix(*query.Query, "ComputeResources")
+}
+
+// isVMExtensionQuery returns true for the VM extension query, issued alongside the VM queries.
+func isVMExtensionQuery(query resourcegraph.QueryRequest) bool {
+	return strings.HasPrefix(*query.Query, "Resources| where type =~ 'microsoft.compute/virtualmachines/extensions'")
+}
+
+func getFilters(c *azureCloud, selectorNamespacedName *types.NamespacedName) []*string {
+	accCfg, _ := c.cloudCommon.GetCloudAccountByName(&types.NamespacedName{Namespace: "namespace01", Name: "account01"})
+	serviceConfig := accCfg.GetServiceConfig()
+	if filters, found := serviceConfig.(*computeServiceConfig).computeFilters[*selectorNamespacedName]; found {
+		return filters
+	}
+	return nil
+}
+func setupClientAndCloud(mockAzureServiceHelper *MockazureServicesHelper, account *v1alpha1.CloudProviderAccount, secret *corev1.Secret) (
+	client.WithWatch, *azureCloud) {
+	fakeClient := fake.NewClientBuilder().Build()
+	c := newAzureCloud(mockAzureServiceHelper)
+
+	err := fakeClient.Create(context.Background(), secret)
+	Expect(err).Should(BeNil())
+	err = c.AddProviderAccount(fakeClient, account)
+	Expect(err).Should(BeNil())
+	return fakeClient, c
+}
+
+func createVnetObject(vnetIDs []string) []network.VirtualNetwork {
+	var vnets []network.VirtualNetwork
+	for i := range vnetIDs {
+		name := vnetIDs[i]
+		key := "Name"
+		value := vnetIDs[i]
+		tags := make(map[string]*string)
+		tags[key] = &value
+		addressPrefix := make([]*string, 0)
+		prefix := "192.16.0.0/24"
+		addressPrefix = append(addressPrefix, &prefix)
+		vnet := &network.VirtualNetwork{
+			Location: &region,
+			ID:       &vnetIDs[i],
+			Name:     &name,
+			Tags:     tags,
+			Properties: &network.VirtualNetworkPropertiesFormat{
+				AddressSpace:           &network.AddressSpace{AddressPrefixes: addressPrefix},
+				VirtualNetworkPeerings: []*network.VirtualNetworkPeering{},
+			},
+		}
+		vnets = append(vnets, *vnet)
+	}
+
+	return vnets
+}
+
+// fakeStatusTransport returns an empty response with the given status code.
+type fakeStatusTransport struct {
+	statusCode int
+}
+
+func (t *fakeStatusTransport) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: t.statusCode,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// fakeQuotaTransport returns an empty response carrying the given headers.
+type fakeQuotaTransport struct {
+	header http.Header
+}
+
+func (t *fakeQuotaTransport) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     t.header,
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+var _ = Describe("Azure account config validation", func() {
+	newAccount := func(regions ...string) *v1alpha1.CloudProviderAccount {
+		return &v1alpha1.CloudProviderAccount{
+			Spec: v1alpha1.CloudProviderAccountSpec{
+				AzureConfig: &v1alpha1.CloudProviderAccountAzureConfig{
+					Region:    regions,
+					SecretRef: &v1alpha1.SecretReference{Name: "secret01", Namespace: "namespace01", Key: "credentials"},
+				},
+			},
+		}
+	}
+
+	It("Should accept account configs with one or more regions", func() {
+		Expect(ValidateAccountConfig(newAccount("eastus"))).Should(Succeed())
+		Expect(ValidateAccountConfig(newAccount("eastus", "westus2"))).Should(Succeed())
+	})
+
+	It("Should reject account configs with missing or blank regions", func() {
+		Expect(ValidateAccountConfig(newAccount())).Should(MatchError(ContainSubstring("at least one region")))
+		Expect(ValidateAccountConfig(newAccount("eastus", " "))).Should(MatchError(ContainSubstring("region cannot be blank")))
+	})
+
+	It("Should reject account configs with missing or incomplete Secret references", func() {
+		account := newAccount("eastus")
+		account.Spec.AzureConfig.SecretRef = nil
+		Expect(ValidateAccountConfig(account)).Should(MatchError(ContainSubstring("secretRef cannot be empty")))
+		account.Spec.AzureConfig.SecretRef = &v1alpha1.SecretReference{Name: "secret01", Key: "credentials"}
+		Expect(ValidateAccountConfig(account)).Should(MatchError(ContainSubstring("must specify name, namespace and key")))
+		account.Spec.AzureConfig = nil
+		Expect(ValidateAccountConfig(account)).Should(HaveOccurred())
+	})
+})
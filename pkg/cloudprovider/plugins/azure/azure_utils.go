@@ -38,6 +38,12 @@ func extractFieldsFromAzureResourceID(resourceID string) (string, string, string
 	return subscriptionID, resourceGroupName, resourceName, nil
 }
 
+// isUniformScaleSetInstance returns true if resourceID is the ID of an instance of a uniform scale set, whose network
+// interfaces are managed by the model of the scale set and not listed by the network interfaces API.
+func isUniformScaleSetInstance(resourceID string) bool {
+	return strings.Contains(strings.ToLower(resourceID), "/virtualmachinescalesets/")
+}
+
 func convertStrSliceToLowercaseCommaSeparatedStr(strSlice []string) string {
 	var lowerCase []string
 	for _, str := range strSlice {
@@ -52,6 +58,32 @@ func convertStrSliceToLowercaseCommaSeparatedStr(strSlice []string) string {
 	return strings.Trim(strings.Join(tokens, ", "), "[]")
 }
 
+// uniqueStrings returns the distinct strings of strSlice in their order of first occurrence.
+func uniqueStrings(strSlice []string) []string {
+	seen := make(map[string]struct{}, len(strSlice))
+	var unique []string
+	for _, str := range strSlice {
+		if _, ok := seen[str]; !ok {
+			seen[str] = struct{}{}
+			unique = append(unique, str)
+		}
+	}
+	return unique
+}
+
+// splitIntoBatches splits strSlice into batches of at most size strings.
+func splitIntoBatches(strSlice []string, size int) [][]string {
+	var batches [][]string
+	for len(strSlice) > size {
+		batches = append(batches, strSlice[:size])
+		strSlice = strSlice[size:]
+	}
+	if len(strSlice) > 0 {
+		batches = append(batches, strSlice)
+	}
+	return batches
+}
+
 func mergeSet(ms ...map[string]struct{}) map[string]struct{} {
 	result := make(map[string]struct{})
 	for _, m := range ms {
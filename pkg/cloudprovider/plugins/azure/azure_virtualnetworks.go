@@ -15,15 +15,52 @@
 package azure
 
 import (
+	"context"
+
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 )
 
-// virtualNetworks returns virtual networks apiClient.
+// virtualNetworks returns virtual networks apiClient. Vnets are listed from the clients of the fallback endpoints, if
+// any, when the primary endpoint is unreachable.
 func (p *azureServiceSdkConfigProvider) virtualNetworks(subscriptionID string) (azureVirtualNetworksWrapper, error) {
-	virtualNetworkClient, err := armnetwork.NewVirtualNetworksClient(subscriptionID, p.cred, nil)
+	virtualNetworkClient, err := armnetwork.NewVirtualNetworksClient(subscriptionID, p.cred, p.options)
 	if err != nil {
 		return nil, err
 	}
+	if len(p.fallbackOptions) == 0 {
+		return &azureVirtualNetworksWrapperImpl{virtualNetworksClient: *virtualNetworkClient}, nil
+	}
 
-	return &azureVirtualNetworksWrapperImpl{virtualNetworksClient: *virtualNetworkClient}, nil
+	failover := &azureVirtualNetworksFailoverWrapper{
+		clients: []azureVirtualNetworksWrapper{&azureVirtualNetworksWrapperImpl{virtualNetworksClient: *virtualNetworkClient}},
+	}
+	for _, options := range p.fallbackOptions {
+		fallbackClient, err := armnetwork.NewVirtualNetworksClient(subscriptionID, p.cred, options)
+		if err != nil {
+			return nil, err
+		}
+		failover.clients = append(failover.clients, &azureVirtualNetworksWrapperImpl{virtualNetworksClient: *fallbackClient})
+	}
+	return failover, nil
+}
+
+// azureVirtualNetworksFailoverWrapper lists vnets from the first client, and from the following clients in order when
+// the previous one is unreachable. Errors returned by a reachable endpoint are not retried.
+type azureVirtualNetworksFailoverWrapper struct {
+	clients []azureVirtualNetworksWrapper
+}
+
+func (f *azureVirtualNetworksFailoverWrapper) listAllComplete(ctx context.Context) (vnets []armnetwork.VirtualNetwork,
+	err error) {
+	for i, client := range f.clients {
+		vnets, err = client.listAllComplete(ctx)
+		if !isConnectivityError(err) {
+			return vnets, err
+		}
+		if i+1 < len(f.clients) {
+			azurePluginLogger().Info("Virtual networks endpoint unreachable, trying fallback endpoint", "fallback", i+1,
+				"error", err)
+		}
+	}
+	return vnets, err
 }
@@ -15,40 +15,141 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/logging"
 )
 
+// permissionProbeTimeout bounds a permission probe.
+const permissionProbeTimeout = 30 * time.Second
+
+// Locks are acquired in the following order and released in the reverse order, to avoid deadlocks.
+//  1. cloudCommon mutex, protecting the account configs.
+//  2. account mutex, held exclusively via LockMutex by operations modifying the account, i.e. inventory snapshot,
+//     resource filters and service config; and shared via LockVpcSecurity by security operations.
+//  3. vpc mutex, held via LockVpcSecurity by security operations, serializing security operations on the same vpc
+//     while letting those on different vpcs of the account run concurrently.
+// Security operations must only modify cloud resources of the vpc they are locked on.
+
 type CloudAccountInterface interface {
 	GetNamespacedName() *types.NamespacedName
 	GetServiceConfig() CloudServiceInterface
 	GetStatus() *crdv1alpha1.CloudProviderAccountStatus
 	LockMutex()
 	UnlockMutex()
+	LockVpcSecurity(vpcID string)
+	UnlockVpcSecurity(vpcID string)
+	IsPaused() bool
+	CheckSecurityPermitted() error
+	IsSecurityGroupMembershipUnchanged(securityGroup *cloudresource.CloudResource, members []*cloudresource.CloudResource,
+		membershipOnly bool) bool
+	SetSecurityGroupMembership(securityGroup *cloudresource.CloudResource, members []*cloudresource.CloudResource,
+		membershipOnly bool)
+	ForgetSecurityGroupMembership(securityGroup *cloudresource.CloudResource, membershipOnly bool)
+	ResetSecurityGroupMemberships()
+	CacheEnforcedSecurity(contents []cloudresource.SynchronizationContent)
+	GetCachedEnforcedSecurity() []cloudresource.SynchronizationContent
+	getPendingSecurityOps() map[string]int
 	performInventorySync() error
+	runWithInventoryPollTimeout(poll func(ctx context.Context) error) error
+	invalidateChangedMemberships(pollErr error)
+	updateVpcs() []string
+	probePermissions()
+	stopPermissionProbe()
 	resetInventoryCache()
+	setAllowedSelectorNamespaces(namespaces []string)
+	isSelectorNamespaceAllowed(namespace string) bool
+	setPaused(paused bool) bool
 }
 
 type cloudAccountConfig struct {
-	mutex          sync.Mutex
+	mutex          sync.RWMutex
+	vpcMutexes     map[string]*sync.Mutex
+	vpcMutexesLock sync.Mutex
 	namespacedName *types.NamespacedName
 	credentials    interface{}
 	serviceConfig  CloudServiceInterface
-	logger         func() logging.Logger
-	Status         *crdv1alpha1.CloudProviderAccountStatus
+	// client and accountCredentials are those the credentials were last resolved with, so that they can be resolved
+	// again on failover.
+	client             client.Client
+	accountCredentials interface{}
+	// credentialsRejected classifies the poll errors reporting that the cloud rejected the credentials, may be nil.
+	credentialsRejected CredentialsRejectedFunc
+	logger              func() logging.Logger
+	// Status is guarded by statusMutex rather than by the account mutex, which is held for the whole of an inventory
+	// poll, so that the status can be read while the account is polled.
+	Status      *crdv1alpha1.CloudProviderAccountStatus
+	statusMutex sync.RWMutex
+	// allowedSelectorNamespaces is nil when selectors of any namespace are allowed.
+	allowedSelectorNamespaces map[string]struct{}
+	// paused is read without the account mutex, so that security operations and polls are rejected without waiting
+	// on a running inventory sync.
+	paused atomic.Bool
+	// pendingSecurityOps counts the security operations holding or waiting on each vpc mutex.
+	pendingSecurityOps map[string]int
+	// appliedMembers are the members last applied to each security group, keyed by getSecurityGroupMembershipKey.
+	appliedMembers     map[string][]*cloudresource.CloudResource
+	appliedMembersLock sync.Mutex
+	// memberFingerprints are the fingerprints of the VMs seen by the last inventory poll, keyed by lowercase VM ID.
+	memberFingerprints map[string]string
+	// vpcs are the keys of the vpcs seen by the last inventory poll, nil before the first poll.
+	vpcs map[string]struct{}
+	// enforcedSecurity is the last cloud view of the security groups managed by Nephe, reported while the account
+	// is paused.
+	enforcedSecurity     []cloudresource.SynchronizationContent
+	enforcedSecurityLock sync.Mutex
+	// permissionProbeScopes are the scopes of the last permission probe started, and permissionProbeGeneration counts
+	// the permission probes started, so that the result of a probe superseded by a later one is discarded.
+	permissionProbeScopes     []string
+	permissionProbeStarted    bool
+	permissionProbeGeneration uint64
+	// permissionProbeCancel cancels the last permission probe started, permissionProbeWg tracks the running probes,
+	// and permissionProbeStopped is set once the account is removed, after which no probe is started.
+	permissionProbeCancel  context.CancelFunc
+	permissionProbeWg      sync.WaitGroup
+	permissionProbeStopped bool
 }
 
 type CloudCredentialValidatorFunc func(client client.Client, credentials interface{}) (interface{}, error)
-type CloudCredentialComparatorFunc func(accountName string, existing interface{}, new interface{}) bool
+
+// CloudCredentialComparatorFunc returns whether the credentials, or other account parameters requiring new cloud
+// clients, changed, and whether account options applied in place changed.
+type CloudCredentialComparatorFunc func(accountName string, existing interface{}, new interface{}) (bool, bool)
+
+// CredentialsRejectedFunc returns true if err reports that the cloud rejected the credentials of the account.
+type CredentialsRejectedFunc func(err error) bool
 type CloudServiceConfigCreatorFunc func(namespacedName *types.NamespacedName, cloudConvertedCredentials interface{},
 	helper interface{}) (CloudServiceInterface, error)
 
+// CredentialRotationHookFunc is invoked after the credentials of an account are rotated and connectivity
+// with the new credentials is validated.
+type CredentialRotationHookFunc func(accountNamespacedName *types.NamespacedName)
+
+// VpcDeletedHookFunc is invoked after an inventory poll finds vpcs of the account deleted from cloud.
+type VpcDeletedHookFunc func(accountNamespacedName *types.NamespacedName)
+
+// AccountResumedHookFunc is invoked after a paused account is resumed.
+type AccountResumedHookFunc func(accountNamespacedName *types.NamespacedName)
+
+// SecurityOptionsChangedHookFunc is invoked after account options changing how security groups are enforced are
+// updated in place.
+type SecurityOptionsChangedHookFunc func(accountNamespacedName *types.NamespacedName)
+
 func (c *cloudCommon) newCloudAccountConfig(client client.Client, namespacedName *types.NamespacedName, credentials interface{},
 	loggerFunc func() logging.Logger) (CloudAccountInterface, error) {
 	credentialsValidatorFunc := c.commonHelper.SetAccountCredentialsFunc()
@@ -72,11 +173,14 @@ func (c *cloudCommon) newCloudAccountConfig(client client.Client, namespacedName
 
 	status := &crdv1alpha1.CloudProviderAccountStatus{}
 	return &cloudAccountConfig{
-		logger:         loggerFunc,
-		namespacedName: namespacedName,
-		serviceConfig:  serviceConfig,
-		credentials:    cloudConvertedCredential,
-		Status:         status,
+		logger:              loggerFunc,
+		namespacedName:      namespacedName,
+		serviceConfig:       serviceConfig,
+		credentials:         cloudConvertedCredential,
+		client:              client,
+		accountCredentials:  credentials,
+		credentialsRejected: c.commonHelper.GetCredentialsRejectedFunc(),
+		Status:              status,
 	}, nil
 }
 
@@ -97,9 +201,30 @@ func (c *cloudCommon) updateCloudAccountConfig(client client.Client, credentials
 		return fmt.Errorf("error updating account config, registered cloud services creator function cannot be nil")
 	}
 
+	currentConfig.client, currentConfig.accountCredentials = client, credentials
 	cloudConvertedNewCredential, err := credentialsValidatorFunc(client, credentials)
-	if !credentialsComparatorFunc(currentConfig.namespacedName.String(), cloudConvertedNewCredential, currentConfig.credentials) {
-		c.logger().Info("Credentials not changed", "account", currentConfig.namespacedName)
+	credsChanged, optionsChanged := credentialsComparatorFunc(currentConfig.namespacedName.String(),
+		cloudConvertedNewCredential, currentConfig.credentials)
+	if !credsChanged {
+		if !optionsChanged {
+			c.logger().Info("Credentials not changed", "account", currentConfig.namespacedName)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		// options are applied in place, the inventory, memberships and holds built with the same credentials are kept.
+		currentConfig.LockMutex()
+		currentConfig.credentials = cloudConvertedNewCredential
+		securityChanged, err := currentConfig.serviceConfig.UpdateServiceOptions(cloudConvertedNewCredential)
+		currentConfig.UnlockMutex()
+		c.logger().Info("Account options updated", "account", currentConfig.namespacedName)
+		// security groups enforced with the previous options are re-synced.
+		if securityChanged && c.securityOptionsChangedHook != nil {
+			c.logger().Info("Triggering security group drift check after security options changed",
+				"account", currentConfig.namespacedName)
+			c.securityOptionsChangedHook(currentConfig.namespacedName)
+		}
 		return err
 	}
 	currentConfig.credentials = cloudConvertedNewCredential
@@ -113,21 +238,240 @@ func (c *cloudCommon) updateCloudAccountConfig(client client.Client, credentials
 	if err != nil {
 		return err
 	}
-	return currentConfig.serviceConfig.UpdateServiceConfig(serviceConfig)
+	currentConfig.LockMutex()
+	err = currentConfig.serviceConfig.UpdateServiceConfig(serviceConfig)
+	currentConfig.UnlockMutex()
+	if err != nil {
+		return err
+	}
+	// memberships are re-applied by the drift check, which must not be skipped as unchanged.
+	currentConfig.ResetSecurityGroupMemberships()
+	// rotated credentials may be granted different permissions.
+	currentConfig.probePermissions()
+	// the inventory sync is not run under the cloud mutex held by the caller, blocking the other accounts.
+	go c.onCredentialsRotated(currentConfig)
+	return nil
 }
 
+// onCredentialsRotated re-validates cloud connectivity using the rotated credentials and on success, invokes the
+// registered credential rotation hook, so that security groups enforced using the old credentials are re-synced.
+func (c *cloudCommon) onCredentialsRotated(accCfg *cloudAccountConfig) {
+	err := accCfg.performInventorySync()
+	if err != nil {
+		c.logger().Error(err, "failed to validate connectivity after credentials rotation", "account", accCfg.namespacedName)
+		return
+	}
+	if c.credentialRotationHook != nil {
+		c.logger().Info("Triggering security group drift check after credentials rotation", "account", accCfg.namespacedName)
+		c.credentialRotationHook(accCfg.namespacedName)
+	}
+}
+
+// performInventorySync polls the cloud inventory of the account holding the account mutex, and records the poll
+// result in the account status. The cloud calls of a poll not completed within cloudresource.InventoryPollTimeout are
+// cancelled, and the poll fails with ErrInventoryPollTimeout.
 func (accCfg *cloudAccountConfig) performInventorySync() error {
-	err := accCfg.serviceConfig.DoResourceInventory()
+	accCfg.LockMutex()
+	defer accCfg.UnlockMutex()
+
+	err := accCfg.runWithInventoryPollTimeout(accCfg.serviceConfig.DoResourceInventory)
+	accCfg.invalidateChangedMemberships(err)
+	if err == nil {
+		// the scopes permissions are probed on may change with the inventory.
+		accCfg.startPermissionProbe(false)
+	}
+	return accCfg.recordInventorySync(err)
+}
+
+// runWithInventoryPollTimeout calls poll with a ctx cancelled after cloudresource.InventoryPollTimeout, the error of a
+// poll not completed in time wraps ErrInventoryPollTimeout.
+func (accCfg *cloudAccountConfig) runWithInventoryPollTimeout(poll func(ctx context.Context) error) error {
+	ctx := context.Background()
+	timeout := cloudresource.InventoryPollTimeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := poll(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %v, not completed within %v: %v", ErrInventoryPollTimeout, *accCfg.namespacedName,
+			timeout, err)
+	}
+	return err
+}
+
+// recordInventorySync sets the error status, stats and conditions of the account given the poll error.
+func (accCfg *cloudAccountConfig) recordInventorySync(err error) error {
+	accCfg.serviceConfig.GetInventoryStats().UpdateInventoryPollStats(err)
+
+	accCfg.statusMutex.Lock()
+	defer accCfg.statusMutex.Unlock()
 	// set the error status to be used later in `CloudProviderAccount` CR.
 	if err != nil {
 		accCfg.Status.Error = err.Error()
 	} else {
 		accCfg.Status.Error = ""
 	}
-	accCfg.serviceConfig.GetInventoryStats().UpdateInventoryPollStats(err)
+	accCfg.setInventoryConditions(err)
 	return err
 }
 
+// setInventoryConditions sets the Connected and InventoryReady conditions of the account given the poll error, and the
+// CredentialsValid condition unless the poll failed for another reason than the cloud rejecting the credentials. It
+// must be called with the status mutex held.
+func (accCfg *cloudAccountConfig) setInventoryConditions(err error) {
+	if err == nil || (accCfg.credentialsRejected != nil && accCfg.credentialsRejected(err)) {
+		credentialsValid := metav1.Condition{
+			Type:   crdv1alpha1.AccountConditionCredentialsValid,
+			Status: metav1.ConditionTrue,
+			Reason: crdv1alpha1.AccountReasonCredentialsAccepted,
+		}
+		if err != nil {
+			credentialsValid.Status = metav1.ConditionFalse
+			credentialsValid.Reason = crdv1alpha1.AccountReasonCredentialsRejected
+			credentialsValid.Message = err.Error()
+		}
+		meta.SetStatusCondition(&accCfg.Status.Conditions, credentialsValid)
+	}
+
+	connected := metav1.Condition{
+		Type:   crdv1alpha1.AccountConditionConnected,
+		Status: metav1.ConditionTrue,
+		Reason: crdv1alpha1.AccountReasonInventoryPollSucceeded,
+	}
+	if err != nil {
+		connected.Status = metav1.ConditionFalse
+		connected.Reason = crdv1alpha1.AccountReasonInventoryPollFailed
+		connected.Message = err.Error()
+	}
+	meta.SetStatusCondition(&accCfg.Status.Conditions, connected)
+
+	inventoryReady := metav1.Condition{
+		Type:   crdv1alpha1.AccountConditionInventoryReady,
+		Status: metav1.ConditionFalse,
+		Reason: crdv1alpha1.AccountReasonInventoryNotInitialized,
+	}
+	if accCfg.serviceConfig.GetInventoryStats().IsInventoryInitialized() {
+		inventoryReady.Status = metav1.ConditionTrue
+		inventoryReady.Reason = crdv1alpha1.AccountReasonInventoryInitialized
+	}
+	meta.SetStatusCondition(&accCfg.Status.Conditions, inventoryReady)
+}
+
+// probePermissions starts probing the permissions of the account credentials in background. It must not be called
+// with the account mutex held.
+func (accCfg *cloudAccountConfig) probePermissions() {
+	accCfg.LockMutex()
+	defer accCfg.UnlockMutex()
+	accCfg.startPermissionProbe(true)
+}
+
+// startPermissionProbe starts probing the permissions of the account credentials in background, unless force is
+// false and the scopes to probe did not change since the last probe. No probe is started when the cloud service does
+// not support probing permissions. It must be called with the account mutex held.
+func (accCfg *cloudAccountConfig) startPermissionProbe(force bool) {
+	probe := accCfg.serviceConfig.GetPermissionProbe()
+	if probe == nil {
+		return
+	}
+	if accCfg.permissionProbeStopped {
+		return
+	}
+	if !force && accCfg.permissionProbeStarted &&
+		strings.Join(probe.Scopes, ",") == strings.Join(accCfg.permissionProbeScopes, ",") {
+		return
+	}
+	accCfg.permissionProbeStarted = true
+	accCfg.permissionProbeScopes = probe.Scopes
+	accCfg.permissionProbeGeneration++
+	if accCfg.permissionProbeCancel != nil {
+		accCfg.permissionProbeCancel()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), permissionProbeTimeout)
+	accCfg.permissionProbeCancel = cancel
+	accCfg.permissionProbeWg.Add(1)
+	go accCfg.runPermissionProbe(ctx, cancel, probe, accCfg.permissionProbeGeneration)
+}
+
+// runPermissionProbe runs a permission probe outside the account mutex, as it may take up to permissionProbeTimeout,
+// and sets the permission conditions of the account unless the probe is superseded by a later one or cancelled.
+func (accCfg *cloudAccountConfig) runPermissionProbe(ctx context.Context, cancel context.CancelFunc, probe *PermissionProbe,
+	generation uint64) {
+	defer accCfg.permissionProbeWg.Done()
+	defer cancel()
+	missing, err := probe.Probe(ctx)
+
+	accCfg.LockMutex()
+	defer accCfg.UnlockMutex()
+	if generation != accCfg.permissionProbeGeneration || errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+	accCfg.setPermissionConditions(missing, err)
+}
+
+// stopPermissionProbe cancels the running permission probe and waits for it to return, no probe is started
+// afterwards. It is called when the account is removed and must not be called with the account mutex held.
+func (accCfg *cloudAccountConfig) stopPermissionProbe() {
+	accCfg.LockMutex()
+	accCfg.permissionProbeStopped = true
+	if accCfg.permissionProbeCancel != nil {
+		accCfg.permissionProbeCancel()
+	}
+	accCfg.UnlockMutex()
+	accCfg.permissionProbeWg.Wait()
+}
+
+// setPermissionConditions sets the InventoryPermitted and SecurityPermitted conditions of the account from the
+// missing permissions found by a permission probe, or from its error.
+func (accCfg *cloudAccountConfig) setPermissionConditions(missing *MissingPermissions, err error) {
+	accCfg.statusMutex.Lock()
+	defer accCfg.statusMutex.Unlock()
+	if err != nil {
+		accCfg.logger().Info("Failed to probe credential permissions", "account", accCfg.namespacedName, "error", err)
+		for _, conditionType := range []string{crdv1alpha1.AccountConditionInventoryPermitted,
+			crdv1alpha1.AccountConditionSecurityPermitted} {
+			meta.SetStatusCondition(&accCfg.Status.Conditions, metav1.Condition{
+				Type:    conditionType,
+				Status:  metav1.ConditionUnknown,
+				Reason:  crdv1alpha1.AccountReasonPermissionProbeFailed,
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+	if missing == nil {
+		return
+	}
+
+	inventoryPermitted := metav1.Condition{
+		Type:   crdv1alpha1.AccountConditionInventoryPermitted,
+		Status: metav1.ConditionTrue,
+		Reason: crdv1alpha1.AccountReasonPermissionsGranted,
+	}
+	if len(missing.Inventory) > 0 {
+		inventoryPermitted.Status = metav1.ConditionFalse
+		inventoryPermitted.Reason = crdv1alpha1.AccountReasonPermissionsMissing
+		inventoryPermitted.Message = fmt.Sprintf("missing permissions: %s", strings.Join(missing.Inventory, ", "))
+	}
+	meta.SetStatusCondition(&accCfg.Status.Conditions, inventoryPermitted)
+
+	securityPermitted := metav1.Condition{
+		Type:   crdv1alpha1.AccountConditionSecurityPermitted,
+		Status: metav1.ConditionTrue,
+		Reason: crdv1alpha1.AccountReasonPermissionsGranted,
+	}
+	if len(missing.Security) > 0 {
+		securityPermitted.Status = metav1.ConditionFalse
+		securityPermitted.Reason = crdv1alpha1.AccountReasonPermissionsMissing
+		securityPermitted.Message = fmt.Sprintf("read-only credentials, missing permissions: %s",
+			strings.Join(missing.Security, ", "))
+		accCfg.logger().Info("Credentials are read-only, security rules cannot be programmed",
+			"account", accCfg.namespacedName, "missing", missing.Security)
+	}
+	meta.SetStatusCondition(&accCfg.Status.Conditions, securityPermitted)
+}
+
 func (accCfg *cloudAccountConfig) GetNamespacedName() *types.NamespacedName {
 	return accCfg.namespacedName
 }
@@ -136,14 +480,95 @@ func (accCfg *cloudAccountConfig) GetServiceConfig() CloudServiceInterface {
 	return accCfg.serviceConfig
 }
 
+// GetStatus returns a copy of the account status.
 func (accCfg *cloudAccountConfig) GetStatus() *crdv1alpha1.CloudProviderAccountStatus {
-	return accCfg.Status
+	accCfg.statusMutex.RLock()
+	defer accCfg.statusMutex.RUnlock()
+	return accCfg.Status.DeepCopy()
+}
+
+// CheckSecurityPermitted returns ErrSecurityNotPermitted if the last permission probe found the account credentials
+// missing permissions to program security rules, i.e. the SecurityPermitted condition of the account is false.
+func (accCfg *cloudAccountConfig) CheckSecurityPermitted() error {
+	accCfg.statusMutex.RLock()
+	defer accCfg.statusMutex.RUnlock()
+	condition := meta.FindStatusCondition(accCfg.Status.Conditions, crdv1alpha1.AccountConditionSecurityPermitted)
+	if condition != nil && condition.Status == metav1.ConditionFalse {
+		return fmt.Errorf("%w: %v, %s", ErrSecurityNotPermitted, *accCfg.namespacedName, condition.Message)
+	}
+	return nil
 }
 
 func (accCfg *cloudAccountConfig) resetInventoryCache() {
 	accCfg.serviceConfig.ResetInventoryCache()
 }
 
+// setAllowedSelectorNamespaces sets the namespaces of selectors served by the account, any namespace if empty. Filters of
+// selectors of namespaces no longer allowed are removed, so that their VMs are dropped from the inventory on next poll.
+func (accCfg *cloudAccountConfig) setAllowedSelectorNamespaces(namespaces []string) {
+	var allowed map[string]struct{}
+	if len(namespaces) > 0 {
+		allowed = make(map[string]struct{}, len(namespaces))
+		for _, namespace := range namespaces {
+			allowed[namespace] = struct{}{}
+		}
+	}
+	accCfg.mutex.Lock()
+	defer accCfg.mutex.Unlock()
+	accCfg.allowedSelectorNamespaces = allowed
+	if allowed == nil {
+		return
+	}
+	for _, selectorNamespacedName := range accCfg.serviceConfig.GetResourceFilterSelectors() {
+		if accCfg.isSelectorNamespaceAllowed(selectorNamespacedName.Namespace) {
+			continue
+		}
+		accCfg.logger().Info("Removing selector of a namespace no longer allowed by the account", "account",
+			accCfg.namespacedName, "selector", selectorNamespacedName)
+		namespacedName := selectorNamespacedName
+		accCfg.serviceConfig.RemoveResourceFilters(&namespacedName)
+	}
+}
+
+// isSelectorNamespaceAllowed returns true if the account serves selectors of the namespace. Caller must hold the
+// account mutex.
+func (accCfg *cloudAccountConfig) isSelectorNamespaceAllowed(namespace string) bool {
+	if accCfg.allowedSelectorNamespaces == nil {
+		return true
+	}
+	_, found := accCfg.allowedSelectorNamespaces[namespace]
+	return found
+}
+
+// setPaused suspends or resumes inventory polling and security operations of the account, and sets the Paused
+// condition of the account. It returns true if the pause state changed.
+func (accCfg *cloudAccountConfig) setPaused(paused bool) bool {
+	changed := accCfg.paused.Swap(paused) != paused
+	if changed {
+		accCfg.logger().Info("Account pause state changed", "account", accCfg.namespacedName, "paused", paused)
+	}
+
+	condition := metav1.Condition{
+		Type:   crdv1alpha1.AccountConditionPaused,
+		Status: metav1.ConditionFalse,
+		Reason: crdv1alpha1.AccountReasonActive,
+	}
+	if paused {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = crdv1alpha1.AccountReasonPauseRequested
+		condition.Message = "inventory polling and security operations are suspended"
+	}
+	accCfg.statusMutex.Lock()
+	defer accCfg.statusMutex.Unlock()
+	meta.SetStatusCondition(&accCfg.Status.Conditions, condition)
+	return changed
+}
+
+// IsPaused returns true if inventory polling and security operations of the account are suspended.
+func (accCfg *cloudAccountConfig) IsPaused() bool {
+	return accCfg.paused.Load()
+}
+
 func (accCfg *cloudAccountConfig) LockMutex() {
 	accCfg.mutex.Lock()
 }
@@ -151,3 +576,246 @@ func (accCfg *cloudAccountConfig) LockMutex() {
 func (accCfg *cloudAccountConfig) UnlockMutex() {
 	accCfg.mutex.Unlock()
 }
+
+// LockVpcSecurity acquires the account mutex in shared mode followed by the mutex of vpcID.
+func (accCfg *cloudAccountConfig) LockVpcSecurity(vpcID string) {
+	accCfg.trackSecurityOp(vpcID, 1)
+	accCfg.mutex.RLock()
+	accCfg.getVpcMutex(vpcID).Lock()
+}
+
+// UnlockVpcSecurity releases the mutexes acquired by LockVpcSecurity.
+func (accCfg *cloudAccountConfig) UnlockVpcSecurity(vpcID string) {
+	accCfg.getVpcMutex(vpcID).Unlock()
+	accCfg.mutex.RUnlock()
+	accCfg.trackSecurityOp(vpcID, -1)
+}
+
+// trackSecurityOp adjusts the pending security operations count of vpcID by delta.
+func (accCfg *cloudAccountConfig) trackSecurityOp(vpcID string, delta int) {
+	accCfg.vpcMutexesLock.Lock()
+	defer accCfg.vpcMutexesLock.Unlock()
+
+	if accCfg.pendingSecurityOps == nil {
+		accCfg.pendingSecurityOps = make(map[string]int)
+	}
+	key := strings.ToLower(vpcID)
+	accCfg.pendingSecurityOps[key] += delta
+	if accCfg.pendingSecurityOps[key] <= 0 {
+		delete(accCfg.pendingSecurityOps, key)
+	}
+}
+
+// getPendingSecurityOps returns the number of security operations holding or waiting on the mutex of each vpc.
+func (accCfg *cloudAccountConfig) getPendingSecurityOps() map[string]int {
+	accCfg.vpcMutexesLock.Lock()
+	defer accCfg.vpcMutexesLock.Unlock()
+
+	pending := make(map[string]int, len(accCfg.pendingSecurityOps))
+	for vpcID, count := range accCfg.pendingSecurityOps {
+		pending[vpcID] = count
+	}
+	return pending
+}
+
+// getVpcMutex returns the mutex of vpcID, creating it if needed. vpc IDs are compared case-insensitively.
+func (accCfg *cloudAccountConfig) getVpcMutex(vpcID string) *sync.Mutex {
+	accCfg.vpcMutexesLock.Lock()
+	defer accCfg.vpcMutexesLock.Unlock()
+
+	if accCfg.vpcMutexes == nil {
+		accCfg.vpcMutexes = make(map[string]*sync.Mutex)
+	}
+	key := strings.ToLower(vpcID)
+	mutex, found := accCfg.vpcMutexes[key]
+	if !found {
+		mutex = &sync.Mutex{}
+		accCfg.vpcMutexes[key] = mutex
+	}
+	return mutex
+}
+
+// getSecurityGroupMembershipKey returns the key of the applied members of a security group.
+func getSecurityGroupMembershipKey(securityGroup *cloudresource.CloudResource, membershipOnly bool) string {
+	return fmt.Sprintf("%v/%v", strings.ToLower(securityGroup.GetCloudName(membershipOnly)),
+		strings.ToLower(securityGroup.Vpc))
+}
+
+// IsSecurityGroupMembershipUnchanged returns true if members equal the members last applied to the security group,
+// regardless of their order.
+func (accCfg *cloudAccountConfig) IsSecurityGroupMembershipUnchanged(securityGroup *cloudresource.CloudResource,
+	members []*cloudresource.CloudResource, membershipOnly bool) bool {
+	accCfg.appliedMembersLock.Lock()
+	defer accCfg.appliedMembersLock.Unlock()
+
+	applied, found := accCfg.appliedMembers[getSecurityGroupMembershipKey(securityGroup, membershipOnly)]
+	if !found {
+		return false
+	}
+	added, removed := diffMembers(applied, members)
+	return len(added) == 0 && len(removed) == 0
+}
+
+// SetSecurityGroupMembership records members as applied to the security group.
+func (accCfg *cloudAccountConfig) SetSecurityGroupMembership(securityGroup *cloudresource.CloudResource,
+	members []*cloudresource.CloudResource, membershipOnly bool) {
+	accCfg.appliedMembersLock.Lock()
+	defer accCfg.appliedMembersLock.Unlock()
+
+	if accCfg.appliedMembers == nil {
+		accCfg.appliedMembers = make(map[string][]*cloudresource.CloudResource)
+	}
+	applied := make([]*cloudresource.CloudResource, 0, len(members))
+	for _, member := range members {
+		if member != nil {
+			member := *member
+			applied = append(applied, &member)
+		}
+	}
+	accCfg.appliedMembers[getSecurityGroupMembershipKey(securityGroup, membershipOnly)] = applied
+}
+
+// ForgetSecurityGroupMembership removes the applied members of the security group, so that the next membership
+// update is pushed to cloud.
+func (accCfg *cloudAccountConfig) ForgetSecurityGroupMembership(securityGroup *cloudresource.CloudResource,
+	membershipOnly bool) {
+	accCfg.appliedMembersLock.Lock()
+	defer accCfg.appliedMembersLock.Unlock()
+
+	delete(accCfg.appliedMembers, getSecurityGroupMembershipKey(securityGroup, membershipOnly))
+}
+
+// ResetSecurityGroupMemberships removes the applied members of all security groups.
+func (accCfg *cloudAccountConfig) ResetSecurityGroupMemberships() {
+	accCfg.appliedMembersLock.Lock()
+	defer accCfg.appliedMembersLock.Unlock()
+
+	accCfg.appliedMembers = nil
+}
+
+// CacheEnforcedSecurity records the cloud view of the security groups managed by Nephe in the account.
+func (accCfg *cloudAccountConfig) CacheEnforcedSecurity(contents []cloudresource.SynchronizationContent) {
+	accCfg.enforcedSecurityLock.Lock()
+	defer accCfg.enforcedSecurityLock.Unlock()
+
+	accCfg.enforcedSecurity = contents
+}
+
+// GetCachedEnforcedSecurity returns the last cloud view of the security groups managed by Nephe in the account, nil
+// if none was recorded.
+func (accCfg *cloudAccountConfig) GetCachedEnforcedSecurity() []cloudresource.SynchronizationContent {
+	accCfg.enforcedSecurityLock.Lock()
+	defer accCfg.enforcedSecurityLock.Unlock()
+
+	return accCfg.enforcedSecurity
+}
+
+// getMemberFingerprint returns the fingerprint of the network interfaces of vm, which the members of security groups
+// are resolved to. The creation time distinguishes a VM recreated with the same ID.
+func getMemberFingerprint(vm *runtimev1alpha1.VirtualMachine) string {
+	nics := make([]string, 0, len(vm.Status.NetworkInterfaces))
+	for _, nic := range vm.Status.NetworkInterfaces {
+		nics = append(nics, strings.ToLower(nic.Name))
+	}
+	sort.Strings(nics)
+	fingerprint := strings.Join(nics, ",")
+	if vm.Status.CreatedAt != nil {
+		fingerprint += "@" + vm.Status.CreatedAt.UTC().String()
+	}
+	return fingerprint
+}
+
+// updateVpcs records the vpcs of the inventory, and returns the keys of the vpcs seen by the previous inventory poll
+// which are no longer in the inventory.
+func (accCfg *cloudAccountConfig) updateVpcs() []string {
+	accCfg.LockMutex()
+	defer accCfg.UnlockMutex()
+
+	vpcs := make(map[string]struct{})
+	for key := range accCfg.serviceConfig.GetCloudInventory().VpcMap {
+		vpcs[key] = struct{}{}
+	}
+	previous := accCfg.vpcs
+	accCfg.vpcs = vpcs
+	var deletedVpcs []string
+	for key := range previous {
+		if _, found := vpcs[key]; !found {
+			deletedVpcs = append(deletedVpcs, key)
+		}
+	}
+	sort.Strings(deletedVpcs)
+	return deletedVpcs
+}
+
+// invalidateChangedMemberships removes the applied members of the security groups having a member whose network
+// interfaces changed since the previous inventory poll, e.g. the VM was recreated or gained a network interface, so
+// that their next membership update is pushed to cloud. pollErr is the error of the inventory poll, on which nothing
+// is invalidated. No fingerprint is kept while no membership is applied. It must be called holding the account mutex.
+func (accCfg *cloudAccountConfig) invalidateChangedMemberships(pollErr error) {
+	if pollErr != nil {
+		return
+	}
+	accCfg.appliedMembersLock.Lock()
+	hasAppliedMembers := len(accCfg.appliedMembers) > 0
+	accCfg.appliedMembersLock.Unlock()
+	if !hasAppliedMembers {
+		accCfg.memberFingerprints = nil
+		return
+	}
+
+	fingerprints := make(map[string]string)
+	for _, vms := range accCfg.serviceConfig.GetCloudInventory().VmMap {
+		for _, vm := range vms {
+			fingerprints[strings.ToLower(vm.Status.CloudId)] = getMemberFingerprint(vm)
+		}
+	}
+	previous := accCfg.memberFingerprints
+	accCfg.memberFingerprints = fingerprints
+	if previous == nil {
+		return
+	}
+
+	accCfg.appliedMembersLock.Lock()
+	defer accCfg.appliedMembersLock.Unlock()
+	for key, members := range accCfg.appliedMembers {
+		for _, member := range members {
+			id := strings.ToLower(member.Name)
+			fingerprint, found := fingerprints[id]
+			if !found {
+				continue
+			}
+			if previousFingerprint, seen := previous[id]; !seen || previousFingerprint != fingerprint {
+				accCfg.logger().V(1).Info("Security group member changed, membership will be reapplied",
+					"account", accCfg.namespacedName, "member", member.Name)
+				delete(accCfg.appliedMembers, key)
+				break
+			}
+		}
+	}
+}
+
+// diffMembers returns the members of desired absent from current, and those of current absent from desired.
+func diffMembers(current, desired []*cloudresource.CloudResource) ([]*cloudresource.CloudResource,
+	[]*cloudresource.CloudResource) {
+	contains := func(members []*cloudresource.CloudResource, member *cloudresource.CloudResource) bool {
+		for _, m := range members {
+			if m.Equal(member) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var added, removed []*cloudresource.CloudResource
+	for _, member := range desired {
+		if member != nil && !contains(current, member) {
+			added = append(added, member)
+		}
+	}
+	for _, member := range current {
+		if !contains(desired, member) {
+			removed = append(removed, member)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// APIErrorClass is the category of a failed cloud API call.
+type APIErrorClass string
+
+const (
+	// APIErrorClassAuth is an authentication or authorization failure, e.g. invalid credentials or missing permissions.
+	APIErrorClassAuth APIErrorClass = "auth"
+	// APIErrorClassThrottle is a call rejected as the account exceeded its cloud API rate limits.
+	APIErrorClassThrottle APIErrorClass = "throttle"
+	// APIErrorClassNotFound is a call on a cloud resource which does not exist.
+	APIErrorClassNotFound APIErrorClass = "not-found"
+	// APIErrorClassServerError is a failure of the cloud service.
+	APIErrorClassServerError APIErrorClass = "server-error"
+	// APIErrorClassOther is any other failure, e.g. an invalid request or a network error.
+	APIErrorClassOther APIErrorClass = "other"
+)
+
+var (
+	APIErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nephe_cloud_api_errors_total",
+		Help: "Number of failed cloud API calls of the account by error class, auth, throttle, not-found, server-error or other.",
+	}, []string{"account", "provider", "class"})
+
+	apiErrorClasses = []APIErrorClass{APIErrorClassAuth, APIErrorClassThrottle, APIErrorClassNotFound,
+		APIErrorClassServerError, APIErrorClassOther}
+)
+
+func init() {
+	metrics.Registry.MustRegister(APIErrorsCounter)
+}
+
+// ClassifyHTTPStatus returns the error class of an HTTP status code, false is returned when statusCode is not an error.
+func ClassifyHTTPStatus(statusCode int) (APIErrorClass, bool) {
+	switch {
+	case statusCode < http.StatusBadRequest:
+		return "", false
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return APIErrorClassAuth, true
+	case statusCode == http.StatusTooManyRequests:
+		return APIErrorClassThrottle, true
+	case statusCode == http.StatusNotFound:
+		return APIErrorClassNotFound, true
+	case statusCode >= http.StatusInternalServerError:
+		return APIErrorClassServerError, true
+	default:
+		return APIErrorClassOther, true
+	}
+}
+
+// RecordAPIError counts a failed cloud API call of an account.
+func RecordAPIError(provider, account string, class APIErrorClass) {
+	APIErrorsCounter.WithLabelValues(account, provider, string(class)).Inc()
+}
+
+// DeleteAPIErrors removes the failed cloud API call counters of an account.
+func DeleteAPIErrors(provider, account string) {
+	for _, class := range apiErrorClasses {
+		APIErrorsCounter.DeleteLabelValues(account, provider, string(class))
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+)
+
+var (
+	APIQuotaRemainingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_api_quota_remaining",
+		Help: "Remaining cloud API requests before the cloud provider throttles the account, as last reported by the cloud.",
+	}, []string{"account", "provider", "quota"})
+
+	// APIQuotaMetrics is the global tracker backing the cloud API quota gauge.
+	APIQuotaMetrics = newAPIQuotaTracker()
+)
+
+func init() {
+	metrics.Registry.MustRegister(APIQuotaRemainingGauge)
+}
+
+// apiQuotaTracker keeps the last reported remaining quota per account, so that it can also be surfaced in the
+// account status.
+type apiQuotaTracker struct {
+	mutex    sync.Mutex
+	accounts map[securityMetricsAccount]map[string]int64
+}
+
+func newAPIQuotaTracker() *apiQuotaTracker {
+	return &apiQuotaTracker{accounts: make(map[securityMetricsAccount]map[string]int64)}
+}
+
+// Set records the remaining requests of a quota. Returns the previously recorded value, if any.
+func (t *apiQuotaTracker) Set(provider, account, quota string, remaining int64) (int64, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := securityMetricsAccount{provider: provider, account: account}
+	quotas, found := t.accounts[key]
+	if !found {
+		quotas = make(map[string]int64)
+		t.accounts[key] = quotas
+	}
+	previous, found := quotas[quota]
+	quotas[quota] = remaining
+	APIQuotaRemainingGauge.WithLabelValues(account, provider, quota).Set(float64(remaining))
+	return previous, found
+}
+
+// Get returns the recorded quotas of an account sorted by name.
+func (t *apiQuotaTracker) Get(provider, account string) []crdv1alpha1.CloudAPIQuota {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	quotas := t.accounts[securityMetricsAccount{provider: provider, account: account}]
+	if len(quotas) == 0 {
+		return nil
+	}
+	result := make([]crdv1alpha1.CloudAPIQuota, 0, len(quotas))
+	for name, remaining := range quotas {
+		result = append(result, crdv1alpha1.CloudAPIQuota{Name: name, Remaining: remaining})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// DeleteAccount removes all quotas of an account.
+func (t *apiQuotaTracker) DeleteAccount(provider, account string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := securityMetricsAccount{provider: provider, account: account}
+	for quota := range t.accounts[key] {
+		APIQuotaRemainingGauge.DeleteLabelValues(account, provider, quota)
+	}
+	delete(t.accounts, key)
+}
@@ -15,12 +15,16 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -37,6 +41,15 @@ var (
 	MaxCloudResourceResponse  int64 = 100
 	InventoryInitWaitDuration       = time.Second * 30
 	AccountCredentialsDefault       = "default"
+	ShutdownPollInterval            = time.Millisecond * 100
+
+	// ErrAccountPaused is returned by inventory polls and security operations of a paused account.
+	ErrAccountPaused = errors.New("cloud account is paused")
+	// ErrSecurityNotPermitted is returned by security operations of an account whose credentials are found missing
+	// permissions to program security rules.
+	ErrSecurityNotPermitted = errors.New("cloud account credentials are not permitted to program security rules")
+	// ErrInventoryPollTimeout is returned by inventory polls not completed within cloudresource.InventoryPollTimeout.
+	ErrInventoryPollTimeout = errors.New("inventory poll timed out")
 )
 
 type InstanceID string
@@ -48,6 +61,7 @@ type CloudCommonHelperInterface interface {
 	GetCloudServicesCreateFunc() CloudServiceConfigCreatorFunc
 	SetAccountCredentialsFunc() CloudCredentialValidatorFunc
 	GetCloudCredentialsComparatorFunc() CloudCredentialComparatorFunc
+	GetCredentialsRejectedFunc() CredentialsRejectedFunc
 }
 
 // CloudCommonInterface implements functionality common across all supported cloud-plugins. Each cloud plugin uses
@@ -62,14 +76,40 @@ type CloudCommonInterface interface {
 
 	AddResourceFilters(namespacedName *types.NamespacedName, selector *crdv1alpha1.CloudEntitySelector) error
 	RemoveResourceFilters(accNamespacedName, selectorNamespacedName *types.NamespacedName)
+	RemoveAllResourceFilters(accNamespacedName *types.NamespacedName)
 
 	GetStatus(accNamespacedName *types.NamespacedName) (*crdv1alpha1.CloudProviderAccountStatus, error)
 
+	GetAllStatus() map[types.NamespacedName]*crdv1alpha1.CloudProviderAccountStatus
+
 	DoInventoryPoll(accountNamespacedName *types.NamespacedName) error
 
+	RefreshVpc(accountNamespacedName *types.NamespacedName, vpcID string) error
+
 	ResetInventoryCache(accountNamespacedName *types.NamespacedName) error
 
 	GetCloudInventory(accountNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, error)
+
+	GetAllCloudInventory() (map[types.NamespacedName]*nephetypes.CloudInventory, error)
+
+	GetSnapshotFootprint(accountNamespacedName *types.NamespacedName) (*nephetypes.SnapshotFootprint, error)
+
+	GetMatchingSelectors(accountNamespacedName *types.NamespacedName, instanceID string) ([]string, error)
+
+	GetSelectorCloudInventory(accountNamespacedName, selectorNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, error)
+
+	PreviewSelector(accountNamespacedName *types.NamespacedName,
+		selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error)
+
+	SetCredentialRotationHook(hook CredentialRotationHookFunc)
+
+	SetVpcDeletedHook(hook VpcDeletedHookFunc)
+
+	SetAccountResumedHook(hook AccountResumedHookFunc)
+
+	SetSecurityOptionsChangedHook(hook SecurityOptionsChangedHookFunc)
+
+	Shutdown(timeout time.Duration) error
 }
 
 type cloudCommon struct {
@@ -79,6 +119,12 @@ type cloudCommon struct {
 	accountConfigs      map[types.NamespacedName]CloudAccountInterface
 	cloudSpecificHelper interface{}
 	Status              string
+
+	credentialRotationHook CredentialRotationHookFunc
+	vpcDeletedHook         VpcDeletedHookFunc
+	accountResumedHook     AccountResumedHookFunc
+
+	securityOptionsChangedHook SecurityOptionsChangedHookFunc
 }
 
 func NewCloudCommon(logger func() logging.Logger, commonHelper CloudCommonHelperInterface,
@@ -102,10 +148,17 @@ func (c *cloudCommon) AddCloudAccount(client client.Client, account *crdv1alpha1
 
 	existingConfig, found := c.accountConfigs[*namespacedName]
 	if found {
+		existingConfig.setAllowedSelectorNamespaces(account.Spec.AllowedSelectorNamespaces)
+		resumed := existingConfig.setPaused(account.Spec.Paused) && !account.Spec.Paused
 		err := c.updateCloudAccountConfig(client, credentials, existingConfig)
 		if err != nil {
 			c.logger().Info("Failed to update cloud account config", "account", namespacedName)
 		}
+		// security groups of the account were not synced while it was paused.
+		if resumed && c.accountResumedHook != nil {
+			c.logger().Info("Triggering security group drift check after account resumed", "account", namespacedName)
+			c.accountResumedHook(namespacedName)
+		}
 		return err
 	}
 
@@ -114,19 +167,24 @@ func (c *cloudCommon) AddCloudAccount(client client.Client, account *crdv1alpha1
 		c.logger().Info("Failed to create cloud account config", "account", namespacedName)
 		return err
 	}
+	config.setAllowedSelectorNamespaces(account.Spec.AllowedSelectorNamespaces)
+	config.setPaused(account.Spec.Paused)
+	config.probePermissions()
 
 	c.accountConfigs[*config.GetNamespacedName()] = config
 	return nil
 }
 
 func (c *cloudCommon) RemoveCloudAccount(namespacedName *types.NamespacedName) {
-	_, found := c.GetCloudAccountByName(namespacedName)
+	accCfg, found := c.GetCloudAccountByName(namespacedName)
 	if !found {
 		return
 	}
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
 	delete(c.accountConfigs, *namespacedName)
+	c.mutex.Unlock()
+	accCfg.stopPermissionProbe()
+	RejectedCredentials.Forget(namespacedName)
 }
 
 // GetCloudAccountByName finds accCfg matching the namespacedName.
@@ -171,6 +229,10 @@ func (c *cloudCommon) AddResourceFilters(accountNamespacedName *types.Namespaced
 	}
 	accCfg.LockMutex()
 	defer accCfg.UnlockMutex()
+	if !accCfg.isSelectorNamespaceAllowed(selector.Namespace) {
+		return fmt.Errorf("selector namespace %v is not allowed by cloud account %v", selector.Namespace,
+			*accountNamespacedName)
+	}
 	return accCfg.GetServiceConfig().AddResourceFilters(selector)
 }
 
@@ -185,6 +247,18 @@ func (c *cloudCommon) RemoveResourceFilters(accNamespacedName, selectorNamespace
 	accCfg.GetServiceConfig().RemoveResourceFilters(selectorNamespacedName)
 }
 
+// RemoveAllResourceFilters removes all selectors of an account, e.g. on account teardown.
+func (c *cloudCommon) RemoveAllResourceFilters(accNamespacedName *types.NamespacedName) {
+	accCfg, found := c.GetCloudAccountByName(accNamespacedName)
+	if !found {
+		c.logger().Info("Cloud account config not found", "account", *accNamespacedName)
+		return
+	}
+	accCfg.LockMutex()
+	defer accCfg.UnlockMutex()
+	accCfg.GetServiceConfig().RemoveAllResourceFilters()
+}
+
 func (c *cloudCommon) GetStatus(accountNamespacedName *types.NamespacedName) (*crdv1alpha1.CloudProviderAccountStatus, error) {
 	accCfg, found := c.GetCloudAccountByName(accountNamespacedName)
 	if !found {
@@ -194,16 +268,100 @@ func (c *cloudCommon) GetStatus(accountNamespacedName *types.NamespacedName) (*c
 	return accCfg.GetStatus(), nil
 }
 
-// DoInventoryPoll calls cloud API to get vm and vpc resources.
+// GetAllStatus returns a copy of the status of all accounts, each taken under the status lock of the account.
+func (c *cloudCommon) GetAllStatus() map[types.NamespacedName]*crdv1alpha1.CloudProviderAccountStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	statuses := make(map[types.NamespacedName]*crdv1alpha1.CloudProviderAccountStatus, len(c.accountConfigs))
+	for namespacedName, accCfg := range c.accountConfigs {
+		statuses[namespacedName] = accCfg.GetStatus()
+	}
+	return statuses
+}
+
+// DoInventoryPoll calls cloud API to get vm and vpc resources. Inventory of a paused account is left untouched.
 func (c *cloudCommon) DoInventoryPoll(accountNamespacedName *types.NamespacedName) error {
 	accCfg, found := c.GetCloudAccountByName(accountNamespacedName)
 	if !found {
 		return fmt.Errorf("unable to find cloud account config: %v", *accountNamespacedName)
 	}
+	if accCfg.IsPaused() {
+		c.logger().V(1).Info("Skipping inventory poll of paused account", "account", *accountNamespacedName)
+		return fmt.Errorf("%w: %v", ErrAccountPaused, *accountNamespacedName)
+	}
+	if err := accCfg.performInventorySync(); err != nil {
+		c.failOverCredentials(accCfg, err)
+		return err
+	}
+	c.onVpcsDeleted(accCfg)
+	return nil
+}
+
+// failOverCredentials resolves the credentials of an account again when the cloud rejected them, skipping the
+// rejected credentials, so that the credentials of the next fallback Secret, if any, are used. Credentials are
+// rotated as on a Secret update.
+func (c *cloudCommon) failOverCredentials(config CloudAccountInterface, pollErr error) {
+	accCfg := config.(*cloudAccountConfig)
+	if accCfg.credentialsRejected == nil || !accCfg.credentialsRejected(pollErr) {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// the account may have been removed or re-added while polled.
+	if current, found := c.accountConfigs[*accCfg.namespacedName]; !found || current != config {
+		return
+	}
+	secretCredentials, ok := accCfg.credentials.(SecretCredentials)
+	if !ok || secretCredentials.GetCredentialFingerprint() == nil || accCfg.client == nil {
+		return
+	}
+	RejectedCredentials.reject(accCfg.namespacedName, secretCredentials.GetCredentialFingerprint())
+	c.logger().Info("Account credentials rejected, failing over to fallback Secret credentials",
+		"account", accCfg.namespacedName)
+	if err := c.updateCloudAccountConfig(accCfg.client, accCfg.accountCredentials, accCfg); err != nil {
+		c.logger().Error(err, "failed to fail over account credentials", "account", accCfg.namespacedName)
+	}
+}
+
+// onVpcsDeleted invokes the registered vpc deleted hook when vpcs seen by the previous inventory poll are no longer
+// in the inventory, so that the security groups of the deleted vpcs are recreated or removed by the controller. Vpcs
+// are not tracked while no hook is registered.
+func (c *cloudCommon) onVpcsDeleted(accCfg CloudAccountInterface) {
+	c.mutex.RLock()
+	hook := c.vpcDeletedHook
+	c.mutex.RUnlock()
+	if hook == nil {
+		return
+	}
+
+	deletedVpcs := accCfg.updateVpcs()
+	if len(deletedVpcs) == 0 {
+		return
+	}
+	c.logger().Info("Vpcs deleted from cloud", "account", accCfg.GetNamespacedName(), "vpcs", deletedVpcs)
+	hook(accCfg.GetNamespacedName())
+}
+
+// RefreshVpc calls cloud API to get vm resources of a vpc, vm resources of other vpcs are left untouched. The refresh
+// is bounded by cloudresource.InventoryPollTimeout as inventory polls are.
+func (c *cloudCommon) RefreshVpc(accountNamespacedName *types.NamespacedName, vpcID string) error {
+	accCfg, found := c.GetCloudAccountByName(accountNamespacedName)
+	if !found {
+		return fmt.Errorf("unable to find cloud account config: %v", *accountNamespacedName)
+	}
+	if accCfg.IsPaused() {
+		return fmt.Errorf("%w: %v", ErrAccountPaused, *accountNamespacedName)
+	}
 	accCfg.LockMutex()
 	defer accCfg.UnlockMutex()
 
-	return accCfg.performInventorySync()
+	err := accCfg.runWithInventoryPollTimeout(func(ctx context.Context) error {
+		return accCfg.GetServiceConfig().RefreshVpcResourceInventory(ctx, vpcID)
+	})
+	accCfg.invalidateChangedMemberships(err)
+	return err
 }
 
 // ResetInventoryCache resets cloud snapshot and poll stats to nil.
@@ -230,3 +388,181 @@ func (c *cloudCommon) GetCloudInventory(accountNamespacedName *types.NamespacedN
 
 	return accCfg.GetServiceConfig().GetCloudInventory(), nil
 }
+
+// GetAllCloudInventory gets VPC and VM inventory from plugin snapshot for all cloud provider accounts. Failure to get
+// inventory of an account does not prevent inventory of other accounts from being returned, the per account errors
+// are returned combined.
+func (c *cloudCommon) GetAllCloudInventory() (map[types.NamespacedName]*nephetypes.CloudInventory, error) {
+	var err error
+	inventories := make(map[types.NamespacedName]*nephetypes.CloudInventory)
+	for namespacedName := range c.GetCloudAccounts() {
+		accountNamespacedName := namespacedName
+		inventory, e := c.GetCloudInventory(&accountNamespacedName)
+		if e != nil {
+			err = multierr.Append(err, fmt.Errorf("account %v: %w", accountNamespacedName, e))
+			continue
+		}
+		inventories[accountNamespacedName] = inventory
+	}
+	return inventories, err
+}
+
+// GetSnapshotFootprint returns the approximate memory footprint of the plugin snapshot and of its history for a given
+// cloud provider account, nil if the plugin does not estimate it.
+func (c *cloudCommon) GetSnapshotFootprint(accountNamespacedName *types.NamespacedName) (*nephetypes.SnapshotFootprint,
+	error) {
+	accCfg, found := c.GetCloudAccountByName(accountNamespacedName)
+	if !found {
+		return nil, fmt.Errorf("unable to find cloud account config")
+	}
+	accCfg.LockMutex()
+	defer accCfg.UnlockMutex()
+
+	return accCfg.GetServiceConfig().GetSnapshotFootprint(), nil
+}
+
+// GetMatchingSelectors returns the namespaced names of the selectors which matched the VM with given instanceID,
+// as per the plugin snapshot of a given cloud provider account.
+func (c *cloudCommon) GetMatchingSelectors(accountNamespacedName *types.NamespacedName, instanceID string) ([]string, error) {
+	inventory, err := c.GetCloudInventory(accountNamespacedName)
+	if err != nil {
+		return nil, err
+	}
+
+	selectors := make([]string, 0)
+	for selectorNamespacedName, vmMap := range inventory.VmMap {
+		for _, vm := range vmMap {
+			if strings.EqualFold(vm.Status.CloudId, instanceID) {
+				selectors = append(selectors, selectorNamespacedName.String())
+				break
+			}
+		}
+	}
+	sort.Strings(selectors)
+	return selectors, nil
+}
+
+// GetSelectorCloudInventory gets the VMs matched by a selector and the VPCs of those VMs from plugin snapshot of a
+// given cloud provider account. An empty inventory is returned if the selector has no matches.
+func (c *cloudCommon) GetSelectorCloudInventory(accountNamespacedName,
+	selectorNamespacedName *types.NamespacedName) (*nephetypes.CloudInventory, error) {
+	inventory, err := c.GetCloudInventory(accountNamespacedName)
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := &nephetypes.CloudInventory{
+		VmMap:  make(map[types.NamespacedName]map[string]*runtimev1alpha1.VirtualMachine),
+		VpcMap: make(map[string]*runtimev1alpha1.Vpc),
+	}
+	vmMap, found := inventory.VmMap[*selectorNamespacedName]
+	if !found {
+		return scoped, nil
+	}
+	scoped.VmMap[*selectorNamespacedName] = vmMap
+
+	// VPC IDs are not case-sensitive in Azure.
+	vpcs := make(map[string]string, len(inventory.VpcMap))
+	for key, vpc := range inventory.VpcMap {
+		vpcs[strings.ToLower(vpc.Status.CloudId)] = key
+	}
+	for _, vm := range vmMap {
+		if key, ok := vpcs[strings.ToLower(vm.Status.CloudVpcId)]; ok {
+			scoped.VpcMap[key] = inventory.VpcMap[key]
+		}
+	}
+	return scoped, nil
+}
+
+// PreviewSelector returns the VMs which the selector would match in a given cloud provider account. The selector is
+// evaluated with a fresh cloud query, it is not added to the account and the plugin snapshot is not updated.
+func (c *cloudCommon) PreviewSelector(accountNamespacedName *types.NamespacedName,
+	selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error) {
+	accCfg, found := c.GetCloudAccountByName(accountNamespacedName)
+	if !found {
+		return nil, fmt.Errorf("unable to find cloud account config")
+	}
+	accCfg.LockMutex()
+	defer accCfg.UnlockMutex()
+
+	vms, err := accCfg.GetServiceConfig().PreviewResourceFilters(selector)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(vms, func(i, j int) bool {
+		return vms[i].Name < vms[j].Name
+	})
+	return vms, nil
+}
+
+// SetCredentialRotationHook registers the hook invoked after account credentials are rotated.
+func (c *cloudCommon) SetCredentialRotationHook(hook CredentialRotationHookFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.credentialRotationHook = hook
+}
+
+// SetVpcDeletedHook registers the hook invoked after an inventory poll finds vpcs of an account deleted from cloud.
+func (c *cloudCommon) SetVpcDeletedHook(hook VpcDeletedHookFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.vpcDeletedHook = hook
+}
+
+// SetAccountResumedHook registers the hook invoked after a paused account is resumed.
+func (c *cloudCommon) SetAccountResumedHook(hook AccountResumedHookFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.accountResumedHook = hook
+}
+
+// SetSecurityOptionsChangedHook registers the hook invoked after account options changing how security groups are
+// enforced are updated in place.
+func (c *cloudCommon) SetSecurityOptionsChangedHook(hook SecurityOptionsChangedHookFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.securityOptionsChangedHook = hook
+}
+
+// Shutdown waits up to timeout for the security operations of all accounts holding or waiting on a vpc mutex to
+// complete. Operations still pending when timeout expires are logged and reported as dropped in the returned error.
+// Operations not yet waiting on a vpc mutex are not counted, hence not awaited.
+func (c *cloudCommon) Shutdown(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := c.getPendingSecurityOps()
+		if len(pending) == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			total := 0
+			for namespacedName, vpcOps := range pending {
+				for vpcID, count := range vpcOps {
+					c.logger().Info("Dropping pending security operations on shutdown", "account", namespacedName,
+						"vpc", vpcID, "operations", count)
+					total += count
+				}
+			}
+			return fmt.Errorf("%v security operations did not complete within %v", total, timeout)
+		}
+		time.Sleep(ShutdownPollInterval)
+	}
+}
+
+// getPendingSecurityOps returns the pending security operations of each vpc, of accounts which have any.
+func (c *cloudCommon) getPendingSecurityOps() map[types.NamespacedName]map[string]int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	pending := make(map[types.NamespacedName]map[string]int)
+	for namespacedName, accCfg := range c.accountConfigs {
+		if vpcOps := accCfg.getPendingSecurityOps(); len(vpcOps) > 0 {
+			pending[namespacedName] = vpcOps
+		}
+	}
+	return pending
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"antrea.io/nephe/pkg/cloudprovider/utils"
+)
+
+// SecretCredentials is implemented by the cloud converted credentials of accounts resolved from Secrets.
+type SecretCredentials interface {
+	// GetCredentialFingerprint returns the fingerprint of the Secret credentials, nil when they could not be resolved.
+	GetCredentialFingerprint() *utils.CredentialFingerprint
+}
+
+// RejectedCredentials is the global tracker of the Secret credentials rejected by the cloud, which are skipped in
+// favor of the credentials of the fallback Secrets of the account.
+var RejectedCredentials = newRejectedCredentialsTracker()
+
+// rejectedCredentialsTracker keeps the fingerprints of the rejected credentials of each account. Credentials are
+// identified by content, so that a Secret updated with new credentials is used again.
+type rejectedCredentialsTracker struct {
+	mutex    sync.Mutex
+	rejected map[types.NamespacedName]map[string]struct{}
+}
+
+func newRejectedCredentialsTracker() *rejectedCredentialsTracker {
+	return &rejectedCredentialsTracker{rejected: make(map[types.NamespacedName]map[string]struct{})}
+}
+
+// IsRejected returns true if the credentials of fingerprint were rejected by the cloud for the account.
+func (t *rejectedCredentialsTracker) IsRejected(account *types.NamespacedName,
+	fingerprint *utils.CredentialFingerprint) bool {
+	if fingerprint == nil {
+		return false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	_, found := t.rejected[*account][fingerprint.Hash]
+	return found
+}
+
+// Forget forgets the rejected credentials of the account.
+func (t *rejectedCredentialsTracker) Forget(account *types.NamespacedName) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.rejected, *account)
+}
+
+// reject records the credentials of fingerprint as rejected by the cloud for the account.
+func (t *rejectedCredentialsTracker) reject(account *types.NamespacedName, fingerprint *utils.CredentialFingerprint) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	rejected, found := t.rejected[*account]
+	if !found {
+		rejected = make(map[string]struct{})
+		t.rejected[*account] = rejected
+	}
+	rejected[fingerprint.Hash] = struct{}{}
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	nephetypes "antrea.io/nephe/pkg/types"
+)
+
+var (
+	UnresolvedVpcPeersGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_unresolved_vpc_peers",
+		Help: "Number of VPCs peered with the VPCs of the account, which could not be resolved.",
+	}, []string{"account", "provider"})
+	EvictedInventoryVMsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_inventory_evicted_vms",
+		Help: "Number of VMs evicted from the inventory of the account on last poll, as the account VM limit is exceeded.",
+	}, []string{"account", "provider"})
+	CacheSnapshotResourcesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_cache_snapshot_resources",
+		Help: "Number of resources of each type in the inventory cache snapshot of the account.",
+	}, []string{"account", "provider", "type"})
+	CacheSnapshotBytesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_cache_snapshot_bytes",
+		Help: "Estimated size in bytes of the inventory cache snapshot of the account and of its snapshot history.",
+	}, []string{"account", "provider"})
+)
+
+const (
+	snapshotResourceVM      = "vm"
+	snapshotResourceVpc     = "vpc"
+	snapshotResourceVpcPeer = "vpc_peer"
+)
+
+// RecordSnapshotFootprint exports the footprint of the inventory cache snapshot of an account.
+func RecordSnapshotFootprint(provider, account string, footprint nephetypes.SnapshotFootprint) {
+	CacheSnapshotResourcesGauge.WithLabelValues(account, provider, snapshotResourceVM).Set(float64(footprint.VMs))
+	CacheSnapshotResourcesGauge.WithLabelValues(account, provider, snapshotResourceVpc).Set(float64(footprint.Vpcs))
+	CacheSnapshotResourcesGauge.WithLabelValues(account, provider, snapshotResourceVpcPeer).Set(float64(footprint.VpcPeers))
+	CacheSnapshotBytesGauge.WithLabelValues(account, provider).Set(float64(footprint.Bytes + footprint.HistoryBytes))
+}
+
+// DeleteSnapshotFootprint removes the exported footprint of the inventory cache snapshot of an account.
+func DeleteSnapshotFootprint(provider, account string) {
+	for _, resource := range []string{snapshotResourceVM, snapshotResourceVpc, snapshotResourceVpcPeer} {
+		CacheSnapshotResourcesGauge.DeleteLabelValues(account, provider, resource)
+	}
+	CacheSnapshotBytesGauge.DeleteLabelValues(account, provider)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// EstimateSize returns the approximate memory held by v, the size of its value and of the strings, slices, maps and
+// pointed values it references. A value referenced several times is counted once per reference, and the location of
+// times, shared by all of them, is not counted.
+func EstimateSize(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	return estimateValueSize(reflect.ValueOf(v))
+}
+
+func estimateValueSize(v reflect.Value) int64 {
+	return int64(v.Type().Size()) + estimateReferencedSize(v)
+}
+
+// estimateReferencedSize returns the approximate memory referenced by v, excluding the size of v itself.
+func estimateReferencedSize(v reflect.Value) int64 {
+	var size int64
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			size = estimateValueSize(v.Elem())
+		}
+	case reflect.String:
+		size = int64(v.Len())
+	case reflect.Slice:
+		if !v.IsNil() {
+			size = int64(v.Cap()) * int64(v.Type().Elem().Size())
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			size += estimateReferencedSize(v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			size += estimateValueSize(iter.Key()) + estimateValueSize(iter.Value())
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			break
+		}
+		for i := 0; i < v.NumField(); i++ {
+			size += estimateReferencedSize(v.Field(i))
+		}
+	}
+	return size
+}
+
+func init() {
+	metrics.Registry.MustRegister(UnresolvedVpcPeersGauge, EvictedInventoryVMsGauge, CacheSnapshotResourcesGauge,
+		CacheSnapshotBytesGauge)
+}
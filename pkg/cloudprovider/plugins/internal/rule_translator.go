@@ -0,0 +1,29 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+)
+
+// ProviderRule is a security rule in the rule model of a cloud provider, e.g. an Azure network security rule.
+type ProviderRule interface{}
+
+// RuleTranslator translates cloud rules into the rule model of a cloud provider. Only the Azure plugin implements it
+// so far, each plugin still computes the provider rules to add and remove on its own.
+type RuleTranslator interface {
+	// Translate returns the provider rules realizing rules.
+	Translate(rules []*cloudresource.CloudRule) ([]ProviderRule, error)
+}
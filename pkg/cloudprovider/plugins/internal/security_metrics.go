@@ -0,0 +1,292 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+)
+
+// SecurityGroupType is the value of the type label of the security group gauge.
+type SecurityGroupType string
+
+const (
+	// SecurityGroupTypeAppliedTo is a security group created for an appliedTo group.
+	SecurityGroupTypeAppliedTo SecurityGroupType = "appliedTo"
+	// SecurityGroupTypeAddressGroup is a security group created for an address group.
+	SecurityGroupTypeAddressGroup SecurityGroupType = "addressGroup"
+	// SecurityGroupTypeNetworkSecurityGroup is a per vnet Azure network security group.
+	SecurityGroupTypeNetworkSecurityGroup SecurityGroupType = "nsg"
+)
+
+var (
+	SecurityGroupsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_security_groups",
+		Help: "Number of Nephe managed cloud security groups.",
+	}, []string{"account", "provider", "type"})
+	SecurityRulesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_security_rules",
+		Help: "Number of Nephe managed cloud security rules.",
+	}, []string{"account", "provider"})
+	SecurityGroupLastReconcileGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nephe_cloud_security_group_last_reconcile_timestamp_seconds",
+		Help: "Unix time of the last successful reconciliation of a Nephe managed cloud security group to the cloud.",
+	}, []string{"account", "provider", "type", "group"})
+
+	// SecurityMetrics is the global tracker backing the security group and rule gauges.
+	SecurityMetrics = newSecurityMetricsTracker()
+)
+
+func init() {
+	metrics.Registry.MustRegister(SecurityGroupsGauge, SecurityRulesGauge, SecurityGroupLastReconcileGauge)
+}
+
+type securityMetricsAccount struct {
+	provider string
+	account  string
+}
+
+type securityMetricsCounts struct {
+	groups map[SecurityGroupType]map[string]struct{}
+	// rules is keyed by appliedTo group.
+	rules map[string]int
+	// reconciled is the time of the last successful reconciliation of each group.
+	reconciled map[SecurityGroupType]map[string]time.Time
+}
+
+// securityMetricsTracker keeps the set of managed security groups and the rule count of each appliedTo group per
+// account, so that repeated operations on the same group are idempotent and deletions decrement the gauges.
+type securityMetricsTracker struct {
+	mutex    sync.Mutex
+	accounts map[securityMetricsAccount]*securityMetricsCounts
+}
+
+func newSecurityMetricsTracker() *securityMetricsTracker {
+	return &securityMetricsTracker{accounts: make(map[securityMetricsAccount]*securityMetricsCounts)}
+}
+
+// securityMetricsGroupKey returns the key of a security group, vnet IDs are not case-sensitive in Azure.
+func securityMetricsGroupKey(id *cloudresource.CloudResourceID) string {
+	return strings.ToLower(id.String())
+}
+
+// SecurityGroupTypeOf returns the security group type of an appliedTo or address group.
+func SecurityGroupTypeOf(membershipOnly bool) SecurityGroupType {
+	if membershipOnly {
+		return SecurityGroupTypeAddressGroup
+	}
+	return SecurityGroupTypeAppliedTo
+}
+
+func (t *securityMetricsTracker) getCounts(provider, account string) *securityMetricsCounts {
+	key := securityMetricsAccount{provider: provider, account: account}
+	counts, found := t.accounts[key]
+	if !found {
+		counts = &securityMetricsCounts{
+			groups:     make(map[SecurityGroupType]map[string]struct{}),
+			rules:      make(map[string]int),
+			reconciled: make(map[SecurityGroupType]map[string]time.Time),
+		}
+		t.accounts[key] = counts
+	}
+	return counts
+}
+
+// update sets the gauges of an account from its tracked counts. Types seen before are kept at zero.
+func (t *securityMetricsTracker) update(provider, account string, counts *securityMetricsCounts) {
+	for sgType, groups := range counts.groups {
+		SecurityGroupsGauge.WithLabelValues(account, provider, string(sgType)).Set(float64(len(groups)))
+	}
+	total := 0
+	for _, count := range counts.rules {
+		total += count
+	}
+	SecurityRulesGauge.WithLabelValues(account, provider).Set(float64(total))
+}
+
+// AddGroup records a created security group.
+func (t *securityMetricsTracker) AddGroup(provider, account string, sgType SecurityGroupType, id *cloudresource.CloudResourceID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts := t.getCounts(provider, account)
+	groups, found := counts.groups[sgType]
+	if !found {
+		groups = make(map[string]struct{})
+		counts.groups[sgType] = groups
+	}
+	groups[securityMetricsGroupKey(id)] = struct{}{}
+	t.update(provider, account, counts)
+}
+
+// DeleteGroup removes a deleted security group along with its rules.
+func (t *securityMetricsTracker) DeleteGroup(provider, account string, sgType SecurityGroupType, id *cloudresource.CloudResourceID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts := t.getCounts(provider, account)
+	key := securityMetricsGroupKey(id)
+	delete(counts.groups[sgType], key)
+	delete(counts.rules, key)
+	if _, found := counts.reconciled[sgType][key]; found {
+		delete(counts.reconciled[sgType], key)
+		SecurityGroupLastReconcileGauge.DeleteLabelValues(account, provider, string(sgType), key)
+	}
+	t.update(provider, account, counts)
+}
+
+// DeleteVpc removes the security groups of a vpc deleted from cloud along with their rules.
+func (t *securityMetricsTracker) DeleteVpc(provider, account, vpcID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts, found := t.accounts[securityMetricsAccount{provider: provider, account: account}]
+	if !found {
+		return
+	}
+	suffix := "/" + strings.ToLower(vpcID)
+	for _, groups := range counts.groups {
+		for key := range groups {
+			if strings.HasSuffix(key, suffix) {
+				delete(groups, key)
+			}
+		}
+	}
+	for key := range counts.rules {
+		if strings.HasSuffix(key, suffix) {
+			delete(counts.rules, key)
+		}
+	}
+	for sgType, reconciled := range counts.reconciled {
+		for key := range reconciled {
+			if strings.HasSuffix(key, suffix) {
+				delete(reconciled, key)
+				SecurityGroupLastReconcileGauge.DeleteLabelValues(account, provider, string(sgType), key)
+			}
+		}
+	}
+	t.update(provider, account, counts)
+}
+
+// SetRules records the number of rules of an appliedTo group.
+func (t *securityMetricsTracker) SetRules(provider, account string, id *cloudresource.CloudResourceID, count int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts := t.getCounts(provider, account)
+	if count < 0 {
+		count = 0
+	}
+	counts.rules[securityMetricsGroupKey(id)] = count
+	t.update(provider, account, counts)
+}
+
+// SetReconciled records the time of the last successful reconciliation of a security group to the cloud.
+func (t *securityMetricsTracker) SetReconciled(provider, account string, sgType SecurityGroupType,
+	id *cloudresource.CloudResourceID, reconciledAt time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts := t.getCounts(provider, account)
+	reconciled, found := counts.reconciled[sgType]
+	if !found {
+		reconciled = make(map[string]time.Time)
+		counts.reconciled[sgType] = reconciled
+	}
+	key := securityMetricsGroupKey(id)
+	reconciled[key] = reconciledAt
+	SecurityGroupLastReconcileGauge.WithLabelValues(account, provider, string(sgType), key).
+		Set(float64(reconciledAt.UnixNano()) / float64(time.Second))
+}
+
+// GetReconciled returns the time of the last successful reconciliation of a security group, if any.
+func (t *securityMetricsTracker) GetReconciled(provider, account string, sgType SecurityGroupType,
+	id *cloudresource.CloudResourceID) (time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts, found := t.accounts[securityMetricsAccount{provider: provider, account: account}]
+	if !found {
+		return time.Time{}, false
+	}
+	reconciledAt, found := counts.reconciled[sgType][securityMetricsGroupKey(id)]
+	return reconciledAt, found
+}
+
+// Sync replaces the tracked appliedTo and address groups and rules of an account with the enforced security view
+// returned by a drift check, and forgets the reconciliation time of groups no longer in it. Groups of other types are
+// left untouched.
+func (t *securityMetricsTracker) Sync(provider, account string, contents []cloudresource.SynchronizationContent) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts := t.getCounts(provider, account)
+	counts.groups[SecurityGroupTypeAppliedTo] = make(map[string]struct{})
+	counts.groups[SecurityGroupTypeAddressGroup] = make(map[string]struct{})
+	counts.rules = make(map[string]int)
+	for i := range contents {
+		content := &contents[i]
+		key := securityMetricsGroupKey(&content.Resource.CloudResourceID)
+		counts.groups[SecurityGroupTypeOf(content.MembershipOnly)][key] = struct{}{}
+		if content.MembershipOnly {
+			continue
+		}
+		count := 0
+		for _, rule := range append(append([]cloudresource.CloudRule{}, content.IngressRules...), content.EgressRules...) {
+			// skip placeholder rules without content.
+			if rule.Rule != nil {
+				count++
+			}
+		}
+		counts.rules[key] = count
+	}
+	for _, sgType := range []SecurityGroupType{SecurityGroupTypeAppliedTo, SecurityGroupTypeAddressGroup} {
+		for key := range counts.reconciled[sgType] {
+			if _, found := counts.groups[sgType][key]; !found {
+				delete(counts.reconciled[sgType], key)
+				SecurityGroupLastReconcileGauge.DeleteLabelValues(account, provider, string(sgType), key)
+			}
+		}
+	}
+	t.update(provider, account, counts)
+}
+
+// DeleteAccount removes all gauges of an account.
+func (t *securityMetricsTracker) DeleteAccount(provider, account string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := securityMetricsAccount{provider: provider, account: account}
+	counts, found := t.accounts[key]
+	if !found {
+		return
+	}
+	for sgType := range counts.groups {
+		SecurityGroupsGauge.DeleteLabelValues(account, provider, string(sgType))
+	}
+	for sgType, reconciled := range counts.reconciled {
+		for key := range reconciled {
+			SecurityGroupLastReconcileGauge.DeleteLabelValues(account, provider, string(sgType), key)
+		}
+	}
+	SecurityRulesGauge.DeleteLabelValues(account, provider)
+	delete(t.accounts, key)
+}
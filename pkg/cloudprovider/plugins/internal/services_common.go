@@ -15,12 +15,19 @@
 package internal
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/types"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 	nephetypes "antrea.io/nephe/pkg/types"
 )
 
@@ -31,20 +38,57 @@ type CloudServiceInterface interface {
 	// UpdateServiceConfig updates existing service config with new values. Each service can decide to update one or
 	// more fields of the service.
 	UpdateServiceConfig(newServiceConfig CloudServiceInterface) error
+	// UpdateServiceOptions applies the account options of the cloud converted credentials in place, without
+	// recreating cloud clients or dropping the inventory state built by the service. Returns true if options changing
+	// how security groups are enforced changed, so that enforced security groups are synced with cloud.
+	UpdateServiceOptions(credentials interface{}) (bool, error)
 	// AddResourceFilters will be used by service to get resources from cloud for the service. Each will convert
 	// CloudEntitySelector to service understandable filters.
 	AddResourceFilters(selector *crdv1alpha1.CloudEntitySelector) error
+	// PreviewResourceFilters fetches the resources matching the selector from cloud, without configuring the
+	// selector filters in the service.
+	PreviewResourceFilters(selector *crdv1alpha1.CloudEntitySelector) ([]*runtimev1alpha1.VirtualMachine, error)
 	// RemoveResourceFilters will be used by service to remove configured filter.
 	RemoveResourceFilters(selectorNamespacedName *types.NamespacedName)
+	// GetResourceFilterSelectors returns the namespaced names of the selectors whose filters are configured.
+	GetResourceFilterSelectors() []types.NamespacedName
+	// RemoveAllResourceFilters will be used by service to remove all configured filters, the resources of the removed
+	// filters are dropped from service cache at once.
+	RemoveAllResourceFilters()
 	// DoResourceInventory performs resource inventory for the cloud service based on configured filters. As part
-	// inventory, it is expected to save resources in service cache CloudServiceResourcesCache.
-	DoResourceInventory() error
+	// inventory, it is expected to save resources in service cache CloudServiceResourcesCache. Cloud calls are made
+	// with ctx, so that the inventory is aborted when ctx is done.
+	DoResourceInventory(ctx context.Context) error
+	// RefreshVpcResourceInventory re-fetches the resources of a vpc based on configured filters and merges them into
+	// the service cache, resources of other vpcs are kept as is. Cloud calls are made with ctx.
+	RefreshVpcResourceInventory(ctx context.Context, vpcID string) error
 	// GetInventoryStats returns Inventory statistics for the service.
 	GetInventoryStats() *CloudServiceStats
 	// ResetInventoryCache clears any internal state built by the service as part of cloud resource discovery.
 	ResetInventoryCache()
 	// GetCloudInventory copies VPCs and VMs stored in internal snapshot(in cloud specific format) to internal format.
 	GetCloudInventory() *nephetypes.CloudInventory
+	// GetPermissionProbe returns the probe of the permissions of the account credentials to read the inventory and
+	// to program security rules. Nil is returned when the service does not support probing permissions.
+	GetPermissionProbe() *PermissionProbe
+	// GetSnapshotFootprint returns the approximate memory footprint of the service cache snapshot and of its history.
+	// Nil is returned when the service does not estimate its footprint.
+	GetSnapshotFootprint() *nephetypes.SnapshotFootprint
+}
+
+// PermissionProbe checks the permissions of the account credentials on the cloud scopes, e.g. resource groups, the
+// account operates on. Probe is run without holding the account mutex and must not access the service config.
+type PermissionProbe struct {
+	Scopes []string
+	Probe  func(ctx context.Context) (*MissingPermissions, error)
+}
+
+// MissingPermissions are the cloud permissions found missing from the account credentials by a permission probe.
+type MissingPermissions struct {
+	// Inventory are the permissions missing to read the cloud inventory.
+	Inventory []string
+	// Security are the permissions missing to program security rules, the account is read-only when not empty.
+	Security []string
 }
 
 // CloudServiceResourcesCache is cache used by all services. Each service can maintain
@@ -75,6 +119,444 @@ func (cache *CloudServiceResourcesCache) GetSnapshot() interface{} {
 	return cache.snapshot
 }
 
+// SnapshotRecord is a service cache snapshot along with the time it was taken.
+type SnapshotRecord struct {
+	Snapshot interface{}
+	Time     time.Time
+	// Bytes is an estimate of the memory held by the snapshot.
+	Bytes int64
+}
+
+// SnapshotHistory keeps the most recent service cache snapshots in a ring buffer for debugging. Its depth is
+// cloudresource.InventorySnapshotHistory, no snapshot is kept when it is 0.
+type SnapshotHistory struct {
+	mutex   sync.Mutex
+	records []SnapshotRecord
+	// next is the index of records the next snapshot is stored at.
+	next int
+}
+
+// Add records a snapshot holding an estimated bytes of memory, evicting the oldest one when the history is full.
+func (h *SnapshotHistory) Add(snapshot interface{}, bytes int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	depth := cloudresource.InventorySnapshotHistory
+	if depth <= 0 {
+		h.records, h.next = nil, 0
+		return
+	}
+	if depth != cap(h.records) {
+		// keep the most recent snapshots when the depth changes.
+		records := h.list()
+		if len(records) > depth {
+			records = records[len(records)-depth:]
+		}
+		h.records = append(make([]SnapshotRecord, 0, depth), records...)
+		h.next = len(h.records) % depth
+	}
+	record := SnapshotRecord{Snapshot: snapshot, Time: time.Now(), Bytes: bytes}
+	if len(h.records) < depth {
+		h.records = append(h.records, record)
+	} else {
+		h.records[h.next] = record
+	}
+	h.next = (h.next + 1) % depth
+}
+
+// Get returns the recorded snapshots, oldest first.
+func (h *SnapshotHistory) Get() []SnapshotRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.list()
+}
+
+// Footprint returns the number of recorded snapshots other than current, and the estimated memory they hold.
+func (h *SnapshotHistory) Footprint(current interface{}) (int, int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var snapshots int
+	var bytes int64
+	for _, record := range h.records {
+		if record.Snapshot == current {
+			continue
+		}
+		snapshots++
+		bytes += record.Bytes
+	}
+	return snapshots, bytes
+}
+
+// Reset drops all recorded snapshots.
+func (h *SnapshotHistory) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.records, h.next = nil, 0
+}
+
+func (h *SnapshotHistory) list() []SnapshotRecord {
+	if len(h.records) < cap(h.records) {
+		return append([]SnapshotRecord{}, h.records...)
+	}
+	return append(append([]SnapshotRecord{}, h.records[h.next:]...), h.records[:h.next]...)
+}
+
+// VMTombstones protects service cache snapshots against partial inventory results. A VM absent from an inventory poll
+// is tombstoned and retained in the snapshot, and is only removed after it is absent from
+// cloudresource.InventoryTombstonePolls consecutive polls, unless overridden for the account.
+type VMTombstones struct {
+	// absentPolls holds the number of consecutive polls a tombstoned VM is absent from, indexed per selector and VM ID.
+	absentPolls map[types.NamespacedName]map[string]int
+	// polls overrides cloudresource.InventoryTombstonePolls when positive.
+	polls int
+}
+
+func NewVMTombstones() *VMTombstones {
+	return &VMTombstones{absentPolls: make(map[types.NamespacedName]map[string]int)}
+}
+
+// RemoveSelector drops tombstones of VMs of selector.
+func (t *VMTombstones) RemoveSelector(selector types.NamespacedName) {
+	delete(t.absentPolls, selector)
+}
+
+// SetPolls overrides cloudresource.InventoryTombstonePolls, a non-positive value restores it.
+func (t *VMTombstones) SetPolls(polls int) {
+	t.polls = polls
+}
+
+// Reset drops all tombstones.
+func (t *VMTombstones) Reset() {
+	t.absentPolls = make(map[types.NamespacedName]map[string]int)
+}
+
+// getPolls returns the number of consecutive polls a VM must be absent from to be removed.
+func (t *VMTombstones) getPolls() int {
+	if t.polls > 0 {
+		return t.polls
+	}
+	return cloudresource.InventoryTombstonePolls
+}
+
+// RetainTombstonedVMs returns current VMs of selector along with VMs of the previous snapshot which are absent from
+// current poll, but not yet for enough consecutive polls to be removed. getID returns the cloud ID of a VM.
+func RetainTombstonedVMs[T any](t *VMTombstones, selector types.NamespacedName, previous []T, current []T,
+	getID func(vm T) string) []T {
+	polls := t.getPolls()
+	currentIDs := make(map[string]struct{}, len(current))
+	for _, vm := range current {
+		currentIDs[getID(vm)] = struct{}{}
+	}
+
+	retained := current
+	absentPolls := make(map[string]int)
+	for _, vm := range previous {
+		id := getID(vm)
+		if _, found := currentIDs[id]; found {
+			continue
+		}
+		count := t.absentPolls[selector][id] + 1
+		if count >= polls {
+			continue
+		}
+		absentPolls[id] = count
+		retained = append(retained, vm)
+	}
+	if len(absentPolls) == 0 {
+		delete(t.absentPolls, selector)
+	} else {
+		t.absentPolls[selector] = absentPolls
+	}
+	return retained
+}
+
+// MergeVpcVMs returns the VMs of previous snapshot outside the refreshed vpc, along with the refreshed VMs of the vpc.
+// VMs of the vpc absent from the refresh are tombstoned as by RetainTombstonedVMs, the refresh counting as a poll for
+// them, while tombstones of VMs outside the vpc are left as is. inVpc returns whether a VM belongs to the refreshed
+// vpc, getID returns the cloud ID of a VM.
+func MergeVpcVMs[T any](t *VMTombstones, selector types.NamespacedName, previous []T, refreshed []T,
+	inVpc func(vm T) bool, getID func(vm T) string) []T {
+	polls := t.getPolls()
+	refreshedIDs := make(map[string]struct{}, len(refreshed))
+	for _, vm := range refreshed {
+		refreshedIDs[getID(vm)] = struct{}{}
+	}
+
+	absentPolls := make(map[string]int, len(t.absentPolls[selector]))
+	for id, count := range t.absentPolls[selector] {
+		absentPolls[id] = count
+	}
+	merged := make([]T, 0, len(previous)+len(refreshed))
+	for _, vm := range previous {
+		if !inVpc(vm) {
+			merged = append(merged, vm)
+			continue
+		}
+		id := getID(vm)
+		if _, found := refreshedIDs[id]; found {
+			delete(absentPolls, id)
+			continue
+		}
+		count := absentPolls[id] + 1
+		if count >= polls {
+			delete(absentPolls, id)
+			continue
+		}
+		absentPolls[id] = count
+		merged = append(merged, vm)
+	}
+	if len(absentPolls) == 0 {
+		delete(t.absentPolls, selector)
+	} else {
+		t.absentPolls[selector] = absentPolls
+	}
+	return append(merged, refreshed...)
+}
+
+// CapVMs limits the distinct VMs across selectors of vms to maxVMs when positive, and returns the VMs kept along with
+// the number of VMs evicted. Managed VMs are kept first, remaining VMs are kept in order of their cloud ID, so that the
+// same VMs are kept across polls. getID returns the cloud ID of a VM, isManaged returns whether a VM is attached to
+// security groups created by Nephe.
+func CapVMs[T any](vms map[types.NamespacedName][]T, maxVMs int, getID func(vm T) string,
+	isManaged func(vm T) bool) (map[types.NamespacedName][]T, int) {
+	managed := make(map[string]bool)
+	for _, selectorVMs := range vms {
+		for _, vm := range selectorVMs {
+			id := getID(vm)
+			if _, found := managed[id]; !found {
+				managed[id] = isManaged(vm)
+			}
+		}
+	}
+	if maxVMs <= 0 || len(managed) <= maxVMs {
+		return vms, 0
+	}
+
+	ids := make([]string, 0, len(managed))
+	for id := range managed {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if managed[ids[i]] != managed[ids[j]] {
+			return managed[ids[i]]
+		}
+		return ids[i] < ids[j]
+	})
+	kept := make(map[string]struct{}, maxVMs)
+	for _, id := range ids[:maxVMs] {
+		kept[id] = struct{}{}
+	}
+
+	capped := make(map[types.NamespacedName][]T, len(vms))
+	for selector, selectorVMs := range vms {
+		keptVMs := make([]T, 0, len(selectorVMs))
+		for _, vm := range selectorVMs {
+			if _, found := kept[getID(vm)]; found {
+				keptVMs = append(keptVMs, vm)
+			}
+		}
+		capped[selector] = keptVMs
+	}
+	return capped, len(ids) - maxVMs
+}
+
+// SelectorHold is a selector whose inventory is held, along with its number of VMs on the last poll.
+type SelectorHold struct {
+	Selector    types.NamespacedName
+	PreviousVMs int
+	VMs         int
+}
+
+// SelectorHolds guards against mass enforcement mistakes, e.g. a typo widening a selector. The inventory of a selector
+// whose number of VMs grows by more than a threshold between polls is held at its previous VMs, so that the newly
+// matched VMs are neither imported nor attached to security groups, until the new number of VMs is confirmed with the
+// crdv1alpha1.SelectorAnnotationConfirmVMCount annotation of the selector.
+type SelectorHolds struct {
+	mutex sync.Mutex
+	// threshold is the growth of the number of VMs of a selector holding it, selectors are not held when it is 0.
+	threshold int
+	held      map[types.NamespacedName]SelectorHold
+}
+
+func NewSelectorHolds() *SelectorHolds {
+	return &SelectorHolds{held: make(map[types.NamespacedName]SelectorHold)}
+}
+
+// SetThreshold sets the growth of the number of VMs of a selector holding it, a non-positive value disables holds.
+func (h *SelectorHolds) SetThreshold(threshold int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.threshold = threshold
+}
+
+// RemoveSelector releases the hold of selector.
+func (h *SelectorHolds) RemoveSelector(selector types.NamespacedName) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.held, selector)
+}
+
+// Reset releases all holds.
+func (h *SelectorHolds) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.held = make(map[types.NamespacedName]SelectorHold)
+}
+
+// IsHeld returns true if the inventory of selector is held.
+func (h *SelectorHolds) IsHeld(selector types.NamespacedName) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	_, found := h.held[selector]
+	return found
+}
+
+// Get returns the sorted namespaced names of the held selectors.
+func (h *SelectorHolds) Get() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var held []string
+	for selector := range h.held {
+		held = append(held, selector.String())
+	}
+	sort.Strings(held)
+	return held
+}
+
+// HoldSpikedSelectors returns current VMs, with the VMs of selectors spiking since previous snapshot replaced by their
+// previous VMs, along with the holds placed by this poll. A selector spikes when its number of VMs grows by more than
+// the threshold, unless the confirmed VM count annotation of the selector covers its new number of VMs. A selector
+// absent from previous snapshot, e.g. after a controller restart, is compared against the last confirmed VM count in
+// its status, and only its current VMs among the last confirmed VM IDs in its status, as returned by vmID, are kept
+// while held. Selectors without either, e.g. newly added, never spike. The status of selectors is not updated here,
+// it is persisted by the account poller.
+func HoldSpikedSelectors[T any](h *SelectorHolds, selectors map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector,
+	previous, current map[types.NamespacedName][]T, vmID func(T) string) (map[types.NamespacedName][]T, []SelectorHold) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	held := make(map[types.NamespacedName]SelectorHold)
+	var newHolds []SelectorHold
+	for selector, vms := range current {
+		if h.threshold <= 0 {
+			break
+		}
+		hold, spiked := isSpikedSelector(h.threshold, selectors[selector], selector, previous, len(vms))
+		if !spiked {
+			continue
+		}
+		if _, found := h.held[selector]; !found {
+			newHolds = append(newHolds, hold)
+		}
+		held[selector] = hold
+		if previousVMs, found := previous[selector]; found {
+			current[selector] = previousVMs
+		} else {
+			current[selector] = lastConfirmedVMs(selectors[selector], vms, vmID)
+		}
+	}
+	h.held = held
+	sort.Slice(newHolds, func(i, j int) bool {
+		return newHolds[i].Selector.String() < newHolds[j].Selector.String()
+	})
+	return current, newHolds
+}
+
+// lastConfirmedVMs returns the VMs among vms whose ID is in the last confirmed VM IDs of selector.
+func lastConfirmedVMs[T any](selector *crdv1alpha1.CloudEntitySelector, vms []T, vmID func(T) string) []T {
+	if selector == nil {
+		return nil
+	}
+	confirmed := make(map[string]struct{}, len(selector.Status.LastConfirmedVMIDs))
+	for _, id := range selector.Status.LastConfirmedVMIDs {
+		confirmed[id] = struct{}{}
+	}
+	var kept []T
+	for _, vm := range vms {
+		if _, found := confirmed[vmID(vm)]; found {
+			kept = append(kept, vm)
+		}
+	}
+	return kept
+}
+
+// isSpikedSelector returns the hold of selector if its number of VMs grew by more than threshold since previous
+// snapshot, or since its last confirmed VM count when absent from previous snapshot.
+func isSpikedSelector[T any](threshold int, selector *crdv1alpha1.CloudEntitySelector,
+	namespacedName types.NamespacedName, previous map[types.NamespacedName][]T, vms int) (SelectorHold, bool) {
+	previousVMs, found := previous[namespacedName]
+	previousCount := len(previousVMs)
+	if !found {
+		if selector == nil || selector.Status.LastConfirmedVMCount == nil {
+			return SelectorHold{}, false
+		}
+		previousCount = *selector.Status.LastConfirmedVMCount
+	}
+	if vms-previousCount <= threshold {
+		return SelectorHold{}, false
+	}
+	if selector != nil {
+		if confirmed, err := utils.ParseConfirmedVMCount(selector.Annotations); err == nil && confirmed >= vms {
+			return SelectorHold{}, false
+		}
+	}
+	return SelectorHold{Selector: namespacedName, PreviousVMs: previousCount, VMs: vms}, true
+}
+
+// CoalesceSelectorFilters keeps the resource filters of a single selector among selectors selecting the same VMs, so
+// that those VMs are fetched from cloud once, and returns the other selectors mapped to the selector holding the
+// filters, whose VMs they share. The first selector in namespaced name order holds the filters, newFilters creates
+// them when it does not have them yet.
+func CoalesceSelectorFilters[T any](selectors map[types.NamespacedName]*crdv1alpha1.CloudEntitySelector,
+	filters map[types.NamespacedName]T,
+	newFilters func(selector *crdv1alpha1.CloudEntitySelector) (T, bool)) map[types.NamespacedName]types.NamespacedName {
+	names := make([]types.NamespacedName, 0, len(selectors))
+	for namespacedName := range selectors {
+		names = append(names, namespacedName)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].String() < names[j].String()
+	})
+
+	aliases := make(map[types.NamespacedName]types.NamespacedName)
+	primaries := make(map[string]types.NamespacedName)
+	for _, namespacedName := range names {
+		key := selectorKey(selectors[namespacedName])
+		primary, found := primaries[key]
+		if !found {
+			primaries[key] = namespacedName
+			if _, found := filters[namespacedName]; !found {
+				if selectorFilters, ok := newFilters(selectors[namespacedName]); ok {
+					filters[namespacedName] = selectorFilters
+				}
+			}
+			continue
+		}
+		aliases[namespacedName] = primary
+		delete(filters, namespacedName)
+	}
+	return aliases
+}
+
+// selectorKey returns a key of the VMs selected by selector, independent of the order of its VMSelector items.
+func selectorKey(selector *crdv1alpha1.CloudEntitySelector) string {
+	items := make([]string, 0, len(selector.Spec.VMSelector))
+	for _, vmSelector := range selector.Spec.VMSelector {
+		item, _ := json.Marshal(vmSelector)
+		items = append(items, string(item))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
 type CloudServiceStats struct {
 	mutex           sync.Mutex
 	totalPollCnt    uint64
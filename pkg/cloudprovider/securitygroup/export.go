@@ -0,0 +1,236 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package securitygroup
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/types"
+
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+)
+
+const (
+	exportAPIVersion = "crd.antrea.io/v1alpha1"
+	exportKind       = "NetworkPolicy"
+	exportAction     = "Allow"
+)
+
+var exportProtocols = map[int]string{
+	6:   "TCP",
+	17:  "UDP",
+	132: "SCTP",
+}
+
+// exportICMPProtocol is the protocol number of ICMP, which Antrea expresses via protocols instead of ports.
+const exportICMPProtocol = 1
+
+// ExportedNetworkPolicy is an Antrea NetworkPolicy shaped representation of the enforced cloud security.
+type ExportedNetworkPolicy struct {
+	APIVersion string                    `yaml:"apiVersion"`
+	Kind       string                    `yaml:"kind"`
+	Metadata   ExportedPolicyMetadata    `yaml:"metadata"`
+	Spec       ExportedNetworkPolicySpec `yaml:"spec"`
+}
+
+type ExportedPolicyMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type ExportedNetworkPolicySpec struct {
+	AppliedTo []ExportedPeer `yaml:"appliedTo,omitempty"`
+	Ingress   []ExportedRule `yaml:"ingress,omitempty"`
+	Egress    []ExportedRule `yaml:"egress,omitempty"`
+}
+
+type ExportedRule struct {
+	Action    string             `yaml:"action"`
+	From      []ExportedPeer     `yaml:"from,omitempty"`
+	To        []ExportedPeer     `yaml:"to,omitempty"`
+	Ports     []ExportedPort     `yaml:"ports,omitempty"`
+	Protocols []ExportedProtocol `yaml:"protocols,omitempty"`
+}
+
+type ExportedPeer struct {
+	Group   string           `yaml:"group,omitempty"`
+	IPBlock *ExportedIPBlock `yaml:"ipBlock,omitempty"`
+}
+
+type ExportedIPBlock struct {
+	CIDR string `yaml:"cidr"`
+}
+
+type ExportedPort struct {
+	Protocol      string `yaml:"protocol"`
+	Port          *int   `yaml:"port,omitempty"`
+	SourcePort    *int   `yaml:"sourcePort,omitempty"`
+	SourceEndPort *int   `yaml:"sourceEndPort,omitempty"`
+}
+
+type ExportedProtocol struct {
+	ICMP struct{} `yaml:"icmp"`
+}
+
+// UnrepresentableRule is an enforced cloud rule which cannot be expressed as an Antrea NetworkPolicy rule.
+type UnrepresentableRule struct {
+	SecurityGroup string
+	Rule          cloudresource.CloudRule
+	Reason        string
+}
+
+// ExportEnforcedSecurityAsYAML converts the enforced security returned by GetEnforcedSecurity into Antrea
+// NetworkPolicy shaped YAML documents, one per NpNamespacedName. Conversion is best effort, rules which cannot be
+// represented are skipped and returned along with the reason.
+func ExportEnforcedSecurityAsYAML(contents []cloudresource.SynchronizationContent) ([]byte, []UnrepresentableRule, error) {
+	policies, unrepresentable := ExportEnforcedSecurity(contents)
+
+	docs := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		out, err := yaml.Marshal(policy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal policy %v/%v: %w", policy.Metadata.Namespace,
+				policy.Metadata.Name, err)
+		}
+		docs = append(docs, string(out))
+	}
+	return []byte(strings.Join(docs, "---\n")), unrepresentable, nil
+}
+
+// ExportEnforcedSecurity groups rules of the enforced security by NpNamespacedName and converts each group into an
+// Antrea NetworkPolicy shaped object. Returned policies are sorted by namespace and name.
+func ExportEnforcedSecurity(contents []cloudresource.SynchronizationContent) ([]*ExportedNetworkPolicy,
+	[]UnrepresentableRule) {
+	policies := make(map[string]*ExportedNetworkPolicy)
+	var unrepresentable []UnrepresentableRule
+
+	getPolicy := func(npNamespacedName string, appliedTo string) *ExportedNetworkPolicy {
+		policy, found := policies[npNamespacedName]
+		if !found {
+			policy = &ExportedNetworkPolicy{
+				APIVersion: exportAPIVersion,
+				Kind:       exportKind,
+				Metadata:   exportPolicyMetadata(npNamespacedName),
+			}
+			policies[npNamespacedName] = policy
+		}
+		for _, peer := range policy.Spec.AppliedTo {
+			if peer.Group == appliedTo {
+				return policy
+			}
+		}
+		policy.Spec.AppliedTo = append(policy.Spec.AppliedTo, ExportedPeer{Group: appliedTo})
+		return policy
+	}
+
+	for _, content := range contents {
+		if content.MembershipOnly {
+			continue
+		}
+		sgName := content.Resource.Name
+		for _, rule := range append(append([]cloudresource.CloudRule{}, content.IngressRules...), content.EgressRules...) {
+			if rule.NpNamespacedName == "" {
+				unrepresentable = append(unrepresentable, UnrepresentableRule{SecurityGroup: sgName, Rule: rule,
+					Reason: "rule is not associated with a network policy"})
+				continue
+			}
+			exported, reason := exportRule(rule.Rule)
+			if exported == nil {
+				unrepresentable = append(unrepresentable, UnrepresentableRule{SecurityGroup: sgName, Rule: rule,
+					Reason: reason})
+				continue
+			}
+			policy := getPolicy(rule.NpNamespacedName, sgName)
+			if _, ok := rule.Rule.(*cloudresource.IngressRule); ok {
+				policy.Spec.Ingress = append(policy.Spec.Ingress, *exported)
+			} else {
+				policy.Spec.Egress = append(policy.Spec.Egress, *exported)
+			}
+		}
+	}
+
+	result := make([]*ExportedNetworkPolicy, 0, len(policies))
+	for _, policy := range policies {
+		result = append(result, policy)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Metadata.Namespace != result[j].Metadata.Namespace {
+			return result[i].Metadata.Namespace < result[j].Metadata.Namespace
+		}
+		return result[i].Metadata.Name < result[j].Metadata.Name
+	})
+	return result, unrepresentable
+}
+
+// exportPolicyMetadata converts npNamespacedName in namespace/name form into policy metadata.
+func exportPolicyMetadata(npNamespacedName string) ExportedPolicyMetadata {
+	tokens := strings.SplitN(npNamespacedName, string(types.Separator), 2)
+	if len(tokens) != 2 {
+		return ExportedPolicyMetadata{Name: npNamespacedName}
+	}
+	return ExportedPolicyMetadata{Namespace: tokens[0], Name: tokens[1]}
+}
+
+// exportRule converts one cloud rule into an Antrea rule. Returns nil and the reason if rule cannot be represented.
+func exportRule(rule cloudresource.Rule) (*ExportedRule, string) {
+	exported := &ExportedRule{Action: exportAction}
+	var protocol, port, srcPort, srcEndPort *int
+	switch r := rule.(type) {
+	case *cloudresource.IngressRule:
+		protocol, port, srcPort, srcEndPort = r.Protocol, r.FromPort, r.SrcPort, r.SrcEndPort
+		exported.From = exportPeers(r.FromSecurityGroups, r.FromSrcIP)
+	case *cloudresource.EgressRule:
+		protocol, port, srcPort, srcEndPort = r.Protocol, r.ToPort, r.SrcPort, r.SrcEndPort
+		exported.To = exportPeers(r.ToSecurityGroups, r.ToDstIP)
+	default:
+		return nil, fmt.Sprintf("unknown rule type %T", rule)
+	}
+
+	if protocol == nil {
+		if port != nil || srcPort != nil {
+			return nil, "port without protocol"
+		}
+		return exported, ""
+	}
+	if *protocol == exportICMPProtocol {
+		if port != nil || srcPort != nil {
+			return nil, "ICMP with port"
+		}
+		exported.Protocols = []ExportedProtocol{{}}
+		return exported, ""
+	}
+	name, ok := exportProtocols[*protocol]
+	if !ok {
+		return nil, fmt.Sprintf("unsupported protocol %v", *protocol)
+	}
+	exported.Ports = []ExportedPort{{Protocol: name, Port: port, SourcePort: srcPort, SourceEndPort: srcEndPort}}
+	return exported, ""
+}
+
+// exportPeers converts security groups and IP blocks of a cloud rule into Antrea rule peers.
+func exportPeers(securityGroups []*cloudresource.CloudResourceID, ipBlocks []*net.IPNet) []ExportedPeer {
+	var peers []ExportedPeer
+	for _, sg := range securityGroups {
+		peers = append(peers, ExportedPeer{Group: sg.Name})
+	}
+	for _, ipBlock := range ipBlocks {
+		peers = append(peers, ExportedPeer{IPBlock: &ExportedIPBlock{CIDR: ipBlock.String()}})
+	}
+	return peers
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package securitygroup
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+)
+
+func TestSecurityGroup(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Security Group")
+}
+
+var _ = Describe("Export enforced security", func() {
+	var (
+		tcp           = 6
+		gre           = 47
+		port          = 22
+		npName        = "default/anp01"
+		appliedToName = "at01"
+		addrGroupName = "ag01"
+		vpc           = "vpc01"
+	)
+
+	It("Should serialize ingress and egress rules of one group into Antrea NetworkPolicy YAML", func() {
+		_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+		contents := []cloudresource.SynchronizationContent{
+			{
+				Resource: cloudresource.CloudResource{
+					Type:            cloudresource.CloudResourceTypeVM,
+					CloudResourceID: cloudresource.CloudResourceID{Name: appliedToName, Vpc: vpc},
+				},
+				IngressRules: []cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.IngressRule{
+							FromPort:  &port,
+							FromSrcIP: []*net.IPNet{cidr},
+							Protocol:  &tcp,
+						},
+						NpNamespacedName: npName,
+					},
+					{
+						Rule:             &cloudresource.IngressRule{Protocol: &gre},
+						NpNamespacedName: npName,
+					},
+				},
+				EgressRules: []cloudresource.CloudRule{
+					{
+						Rule: &cloudresource.EgressRule{
+							ToSecurityGroups: []*cloudresource.CloudResourceID{{Name: addrGroupName, Vpc: vpc}},
+						},
+						NpNamespacedName: npName,
+					},
+				},
+			},
+		}
+
+		expected := `apiVersion: crd.antrea.io/v1alpha1
+kind: NetworkPolicy
+metadata:
+  name: anp01
+  namespace: default
+spec:
+  appliedTo:
+  - group: at01
+  ingress:
+  - action: Allow
+    from:
+    - ipBlock:
+        cidr: 10.0.0.0/24
+    ports:
+    - protocol: TCP
+      port: 22
+  egress:
+  - action: Allow
+    to:
+    - group: ag01
+`
+		out, unrepresentable, err := ExportEnforcedSecurityAsYAML(contents)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(out)).To(Equal(expected))
+		Expect(unrepresentable).To(HaveLen(1))
+		Expect(unrepresentable[0].SecurityGroup).To(Equal(appliedToName))
+		Expect(unrepresentable[0].Reason).To(Equal("unsupported protocol 47"))
+	})
+})
@@ -111,6 +111,11 @@ type CloudSecurityGroupInterface interface {
 	// egressRules must have been already created.
 	UpdateSecurityGroupRules(name *cloudresource.CloudResource, addRules, rmRules []*cloudresource.CloudRule) <-chan error
 
+	// UpdateSecurityGroupRulesBatch updates ingress/egress rules of multiple SecurityGroups, SecurityGroups referred to
+	// by the rules of others first. SecurityGroups referred to in the rules must have been already created. On any
+	// failure a *cloudresource.GroupRuleUpdateBatchError reporting the failed SecurityGroups is returned.
+	UpdateSecurityGroupRulesBatch(updates []cloudresource.GroupRuleUpdate) <-chan error
+
 	// UpdateSecurityGroupMembers updates SecurityGroup name with members.
 	// SecurityGroup name must already have been created.
 	// For appliedSecurityGroup, UpdateSecurityGroupMembers is called only if SG has
@@ -205,6 +210,60 @@ func (sg *CloudSecurityGroupImpl) UpdateSecurityGroupRules(appliedToGroupIdentif
 	return ch
 }
 
+func (sg *CloudSecurityGroupImpl) UpdateSecurityGroupRulesBatch(updates []cloudresource.GroupRuleUpdate) <-chan error {
+	ch := make(chan error)
+
+	go func() {
+		defer close(ch)
+
+		// updates of each cloud provider are applied in a separate batch.
+		var providers []cloud.CloudInterface
+		providerUpdates := make(map[cloud.CloudInterface][]cloudresource.GroupRuleUpdate)
+		batchErr := &cloudresource.GroupRuleUpdateBatchError{Failed: make(map[cloudresource.CloudResource]error)}
+		for _, update := range updates {
+			cloudInterface, err := getCloudInterfaceForCloudResource(update.AppliedToGroup)
+			if err != nil {
+				batchErr.Failed[*update.AppliedToGroup] = err
+				continue
+			}
+			if _, ok := providerUpdates[cloudInterface]; !ok {
+				providers = append(providers, cloudInterface)
+			}
+			providerUpdates[cloudInterface] = append(providerUpdates[cloudInterface], update)
+		}
+
+		for _, cloudInterface := range providers {
+			err := cloudInterface.UpdateSecurityGroupRulesBatch(providerUpdates[cloudInterface])
+			if err == nil {
+				for _, update := range providerUpdates[cloudInterface] {
+					batchErr.Succeeded = append(batchErr.Succeeded, *update.AppliedToGroup)
+				}
+				continue
+			}
+			providerErr, ok := err.(*cloudresource.GroupRuleUpdateBatchError)
+			if !ok {
+				for _, update := range providerUpdates[cloudInterface] {
+					batchErr.Failed[*update.AppliedToGroup] = err
+				}
+				continue
+			}
+			batchErr.Succeeded = append(batchErr.Succeeded, providerErr.Succeeded...)
+			for group, groupErr := range providerErr.Failed {
+				batchErr.Failed[group] = groupErr
+			}
+		}
+
+		if len(batchErr.Failed) > 0 {
+			ch <- batchErr
+			return
+		}
+
+		ch <- nil
+	}()
+
+	return ch
+}
+
 func (sg *CloudSecurityGroupImpl) UpdateSecurityGroupMembers(securityGroupIdentifier *cloudresource.CloudResource,
 	members []*cloudresource.CloudResource, membershipOnly bool) <-chan error {
 	ch := make(chan error)
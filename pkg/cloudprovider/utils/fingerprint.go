@@ -0,0 +1,104 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// CredentialFingerprint identifies the content of a credential without retaining it. A hash is kept per credential
+// field, so that the fields changed between two fingerprints can be reported.
+type CredentialFingerprint struct {
+	Hash   string
+	Fields map[string]string
+}
+
+// NewCredentialFingerprint returns the fingerprint of a JSON credential. The credential is normalized before hashing,
+// so that formatting and field order do not change the fingerprint, while any field, including fields unknown to the
+// cloud plugin, does.
+func NewCredentialFingerprint(credential []byte) (*CredentialFingerprint, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(credential, &fields); err != nil {
+		return nil, err
+	}
+
+	fingerprint := &CredentialFingerprint{Fields: make(map[string]string, len(fields))}
+	names := make([]string, 0, len(fields))
+	for name, value := range fields {
+		// marshalling sorts the keys of nested objects.
+		normalized, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint.Fields[name] = hashOf([]byte(name), normalized)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hashes := make([][]byte, 0, len(names))
+	for _, name := range names {
+		hashes = append(hashes, []byte(fingerprint.Fields[name]))
+	}
+	fingerprint.Hash = hashOf(hashes...)
+	return fingerprint, nil
+}
+
+// Equal returns true if both fingerprints identify the same credential. A nil fingerprint, of an unresolved
+// credential, only equals another nil fingerprint.
+func (f *CredentialFingerprint) Equal(other *CredentialFingerprint) bool {
+	if f == nil || other == nil {
+		return f == other
+	}
+	return f.Hash == other.Hash
+}
+
+// ChangedCredentialFields returns the sorted names of the fields added, removed or modified between the credentials
+// of the existing and new fingerprints.
+func ChangedCredentialFields(existing, new *CredentialFingerprint) []string {
+	var existingFields, newFields map[string]string
+	if existing != nil {
+		existingFields = existing.Fields
+	}
+	if new != nil {
+		newFields = new.Fields
+	}
+
+	var changed []string
+	for name, hash := range existingFields {
+		if newFields[name] != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range newFields {
+		if _, found := existingFields[name]; !found {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// hashOf returns the hex encoded SHA-256 hash of the parts, which are separated so that moving bytes across parts
+// changes the hash.
+func hashOf(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
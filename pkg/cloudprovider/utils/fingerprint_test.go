@@ -0,0 +1,55 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credential fingerprint", func() {
+	It("Should not change with formatting or field order", func() {
+		fingerprint, err := NewCredentialFingerprint([]byte(`{"clientId": "id", "clientKey": "key"}`))
+		Expect(err).ToNot(HaveOccurred())
+		reordered, err := NewCredentialFingerprint([]byte(`{
+			"clientKey": "key",
+			"clientId":  "id"
+		}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fingerprint.Equal(reordered)).To(BeTrue())
+		Expect(ChangedCredentialFields(fingerprint, reordered)).To(BeEmpty())
+	})
+
+	It("Should report added, removed and modified fields", func() {
+		existing, err := NewCredentialFingerprint([]byte(`{"clientId": "id", "clientKey": "key", "tenantId": "tenant"}`))
+		Expect(err).ToNot(HaveOccurred())
+		updated, err := NewCredentialFingerprint([]byte(`{"clientId": "id", "clientKey": "key2", "region": "eastus"}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(existing.Equal(updated)).To(BeFalse())
+		Expect(ChangedCredentialFields(existing, updated)).To(Equal([]string{"clientKey", "region", "tenantId"}))
+		Expect(ChangedCredentialFields(nil, updated)).To(Equal([]string{"clientId", "clientKey", "region"}))
+	})
+
+	It("Should only equal a nil fingerprint when nil", func() {
+		var unresolved *CredentialFingerprint
+		fingerprint, err := NewCredentialFingerprint([]byte(`{}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(unresolved.Equal(nil)).To(BeTrue())
+		Expect(unresolved.Equal(fingerprint)).To(BeFalse())
+		Expect(fingerprint.Equal(unresolved)).To(BeFalse())
+		_, err = NewCredentialFingerprint([]byte(`not json`))
+		Expect(err).To(HaveOccurred())
+	})
+})
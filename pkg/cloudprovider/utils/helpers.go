@@ -16,9 +16,17 @@ package utils
 
 import (
 	"fmt"
-	"reflect"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
+	"golang.org/x/net/http/httpproxy"
+
+	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 )
@@ -54,6 +62,7 @@ func GetCloudResourceCRName(providerType, name string) string {
 
 // IsNepheControllerCreatedSG checks an SG is created by nephe
 // and returns if it's an AppliedToGroup/AddressGroup sg and the sg name.
+// The sg name of a shortened cloud name is the original name, when known.
 func IsNepheControllerCreatedSG(cloudSgName string) (string, bool, bool) {
 	var sgName string
 	isNepheControllerCreatedAddressGroup := false
@@ -72,6 +81,9 @@ func IsNepheControllerCreatedSG(cloudSgName string) (string, bool, bool) {
 			sgName = strings.ToLower(suffix)
 		}
 	}
+	if len(sgName) > 0 {
+		sgName = cloudresource.GetOriginalCloudName(sgName)
+	}
 	return sgName, isNepheControllerCreatedAddressGroup, isNepheControllerCreatedAppliedToGroup
 }
 
@@ -105,8 +117,119 @@ func SplitCloudRulesByDirection(rules []*cloudresource.CloudRule) ([]*cloudresou
 	return ingressRules, egressRules
 }
 
-// GenerateCloudDescription generates a CloudRuleDescription object and converts to string.
-func GenerateCloudDescription(namespacedName string) (string, error) {
+// statefulProviders are the cloud providers whose security rules always track connections, i.e. AWS security groups
+// and Azure network security groups, the return traffic of allowed connections needs no rules on them.
+var statefulProviders = map[runtimev1alpha1.CloudProvider]struct{}{
+	runtimev1alpha1.AWSCloudProvider:   {},
+	runtimev1alpha1.AzureCloudProvider: {},
+}
+
+// ExpandStatelessRules returns the given rules along with their return-direction rules when cloud security rules are
+// enforced statelessly, and the given rules unchanged otherwise. Return rules are marked as generated, and are not
+// expanded again, so that expanding rules is idempotent. As all supported cloud providers are stateful, rules are
+// returned unchanged today.
+func ExpandStatelessRules(provider runtimev1alpha1.CloudProvider,
+	rules []*cloudresource.CloudRule) []*cloudresource.CloudRule {
+	if _, ok := statefulProviders[provider]; ok || !cloudresource.StatelessRuleEnforcement || len(rules) == 0 {
+		return rules
+	}
+	hashes := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		hashes[rule.GetHash()] = struct{}{}
+	}
+	expanded := append(make([]*cloudresource.CloudRule, 0, 2*len(rules)), rules...)
+	for _, rule := range rules {
+		if rule.Generated {
+			continue
+		}
+		returnRule := getReturnRule(rule)
+		if returnRule == nil {
+			continue
+		}
+		hash := returnRule.GetHash()
+		if _, ok := hashes[hash]; ok {
+			continue
+		}
+		hashes[hash] = struct{}{}
+		returnRule.Hash = hash
+		returnRule.Generated = true
+		expanded = append(expanded, returnRule)
+	}
+	return expanded
+}
+
+// remoteGroupResolvingProviders are the providers whose security rules cannot reference security groups of other vpcs,
+// such groups are resolved to the addresses of their members instead.
+var remoteGroupResolvingProviders = map[runtimev1alpha1.CloudProvider]struct{}{
+	runtimev1alpha1.AzureCloudProvider: {},
+}
+
+// ResolvesRemoteSecurityGroups returns true if provider realizes rules referencing security groups of other vpcs with
+// the addresses of their members, hence such rules are to be realized again when the members change.
+func ResolvesRemoteSecurityGroups(provider runtimev1alpha1.CloudProvider) bool {
+	_, ok := remoteGroupResolvingProviders[provider]
+	return ok
+}
+
+// getReturnRule returns the rule allowing the return traffic of connections allowed by rule, the destination port of
+// rule becomes the source port of the return rule and vice versa. The return rule allows any destination port when
+// rule allows a source port range, as a rule allows a single destination port.
+func getReturnRule(rule *cloudresource.CloudRule) *cloudresource.CloudRule {
+	returnPort := func(srcPort, srcEndPort *int) *int {
+		if srcEndPort != nil && (srcPort == nil || *srcEndPort != *srcPort) {
+			return nil
+		}
+		return srcPort
+	}
+	returnRule := *rule
+	switch r := rule.Rule.(type) {
+	case *cloudresource.IngressRule:
+		returnRule.Rule = &cloudresource.EgressRule{
+			ToPort:           returnPort(r.SrcPort, r.SrcEndPort),
+			ToDstIP:          r.FromSrcIP,
+			ToSecurityGroups: r.FromSecurityGroups,
+			Protocol:         r.Protocol,
+			AppliedToGroup:   r.AppliedToGroup,
+			EnableLogging:    r.EnableLogging,
+			SrcPort:          r.FromPort,
+		}
+	case *cloudresource.EgressRule:
+		returnRule.Rule = &cloudresource.IngressRule{
+			FromPort:           returnPort(r.SrcPort, r.SrcEndPort),
+			FromSrcIP:          r.ToDstIP,
+			FromSecurityGroups: r.ToSecurityGroups,
+			Protocol:           r.Protocol,
+			AppliedToGroup:     r.AppliedToGroup,
+			EnableLogging:      r.EnableLogging,
+			SrcPort:            r.ToPort,
+		}
+	default:
+		return nil
+	}
+	return &returnRule
+}
+
+// maxCloudDescriptionLength is the maximum length of a rule description on all cloud providers, bounded by the
+// description of Azure security rules.
+const maxCloudDescriptionLength = 140
+
+// GenerateCloudDescription generates a CloudRuleDescription object and converts to string. The policy uid is
+// omitted when empty.
+func GenerateCloudDescription(namespacedName, uid string) (string, error) {
+	return GenerateCloudDescriptionWithLogging(namespacedName, uid, false)
+}
+
+// GenerateCloudDescriptionWithLogging generates a CloudRuleDescription object carrying the logging flag of the rule
+// and converts to string.
+func GenerateCloudDescriptionWithLogging(namespacedName, uid string, enableLogging bool) (string, error) {
+	return GenerateCloudDescriptionWithAnnotations(namespacedName, uid, enableLogging, nil)
+}
+
+// GenerateCloudDescriptionWithAnnotations generates a CloudRuleDescription object carrying the logging flag and the
+// annotations of the rule and converts to string. Annotations are added in key order, up to MaxRuleAnnotations and
+// as long as the description fits in maxCloudDescriptionLength; annotations which cannot be encoded are skipped.
+func GenerateCloudDescriptionWithAnnotations(namespacedName, uid string, enableLogging bool,
+	annotations map[string]string) (string, error) {
 	tokens := strings.Split(namespacedName, "/")
 	if len(tokens) != 2 {
 		return "", fmt.Errorf("invalid namespacedname %v", namespacedName)
@@ -114,27 +237,76 @@ func GenerateCloudDescription(namespacedName string) (string, error) {
 	desc := cloudresource.CloudRuleDescription{
 		Name:      tokens[1],
 		Namespace: tokens[0],
+		UID:       uid,
+		Logging:   enableLogging,
+	}
+
+	keys := make([]string, 0, len(annotations))
+	for key, value := range annotations {
+		if isValidDescriptionToken(key) && isValidDescriptionToken(value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	descLen := len(desc.String())
+	for _, key := range keys {
+		if len(desc.Annotations) == cloudresource.MaxRuleAnnotations {
+			break
+		}
+		// annotations are appended in key order, hence each one adds its own length to the description.
+		pairLen := len(", "+cloudresource.AnnotationPrefix+key+":") + len(annotations[key])
+		if descLen+pairLen > maxCloudDescriptionLength {
+			continue
+		}
+		if desc.Annotations == nil {
+			desc.Annotations = make(map[string]string)
+		}
+		desc.Annotations[key] = annotations[key]
+		descLen += pairLen
 	}
 	return desc.String(), nil
 }
 
+// isValidDescriptionToken returns true if s can be encoded as a key or value of a rule description, i.e. it is not
+// empty and has no separator or whitespace.
+func isValidDescriptionToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c == ',' || c == ':' || unicode.IsSpace(c) || c > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
 // ExtractCloudDescription converts a string to a CloudRuleDescription object.
 func ExtractCloudDescription(description *string) (*cloudresource.CloudRuleDescription, bool) {
 	if description == nil {
 		return nil, false
 	}
-	numKeyValuePair := reflect.TypeOf(cloudresource.CloudRuleDescription{}).NumField()
 	descMap := map[string]string{}
+	var annotations map[string]string
 	tempSlice := strings.Split(*description, ",")
-	if len(tempSlice) != numKeyValuePair {
+	// uid, logging and annotation key-value pairs are optional.
+	if len(tempSlice) < 2 || len(tempSlice) > 4+cloudresource.MaxRuleAnnotations {
 		return nil, false
 	}
 	// each key and value are separated by ":"
 	for i := range tempSlice {
 		keyValuePair := strings.Split(strings.TrimSpace(tempSlice[i]), ":")
-		if len(keyValuePair) == 2 {
-			descMap[keyValuePair[0]] = keyValuePair[1]
+		if len(keyValuePair) != 2 {
+			continue
 		}
+		if key := strings.TrimPrefix(keyValuePair[0], cloudresource.AnnotationPrefix); key != keyValuePair[0] {
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[key] = keyValuePair[1]
+			continue
+		}
+		descMap[keyValuePair[0]] = keyValuePair[1]
 	}
 
 	// check if any of the fields are empty.
@@ -143,8 +315,618 @@ func ExtractCloudDescription(description *string) (*cloudresource.CloudRuleDescr
 	}
 
 	desc := &cloudresource.CloudRuleDescription{
-		Name:      descMap[cloudresource.Name],
-		Namespace: descMap[cloudresource.Namespace],
+		Name:        descMap[cloudresource.Name],
+		Namespace:   descMap[cloudresource.Namespace],
+		UID:         descMap[cloudresource.UID],
+		Logging:     descMap[cloudresource.Logging] == "true",
+		Annotations: annotations,
 	}
 	return desc, true
 }
+
+// UpdateSecurityGroupRulesInBatch applies each rule update using updateFn. Updates of groups referenced by the added
+// rules of other updates are applied first. All updates are attempted even if some of them fail, except updates
+// referencing a group whose update failed, or on a dependency cycle. On any failure a GroupRuleUpdateBatchError
+// listing the succeeded and failed groups is returned.
+func UpdateSecurityGroupRulesInBatch(updates []cloudresource.GroupRuleUpdate,
+	updateFn func(*cloudresource.CloudResource, []*cloudresource.CloudRule, []*cloudresource.CloudRule) error) error {
+	batchErr := &cloudresource.GroupRuleUpdateBatchError{Failed: make(map[cloudresource.CloudResource]error)}
+	ordered, dependencies, cyclic := orderGroupRuleUpdates(updates)
+	if len(cyclic) > 0 {
+		var groups []string
+		for _, i := range cyclic {
+			groups = append(groups, updates[i].AppliedToGroup.String())
+		}
+		sort.Strings(groups)
+		err := fmt.Errorf("dependency cycle among security groups [%v]", strings.Join(groups, ", "))
+		for _, i := range cyclic {
+			batchErr.Failed[*updates[i].AppliedToGroup] = err
+		}
+	}
+	for _, i := range ordered {
+		update := updates[i]
+		var err error
+		for _, j := range dependencies[i] {
+			if _, failed := batchErr.Failed[*updates[j].AppliedToGroup]; failed {
+				err = fmt.Errorf("referenced security group %v failed to update", updates[j].AppliedToGroup.String())
+				break
+			}
+		}
+		if err == nil {
+			err = updateFn(update.AppliedToGroup, update.AddRules, update.RmRules)
+		}
+		if err != nil {
+			batchErr.Failed[*update.AppliedToGroup] = err
+			continue
+		}
+		batchErr.Succeeded = append(batchErr.Succeeded, *update.AppliedToGroup)
+	}
+	if len(batchErr.Failed) == 0 {
+		return nil
+	}
+	return batchErr
+}
+
+// orderGroupRuleUpdates returns the indexes of updates ordered so that an update follows the updates of the groups
+// referenced by its added rules, along with the indexes of the updates each update depends on. Updates on a dependency
+// cycle, or depending on one, are returned as cyclic instead. Updates without appliedTo group are dropped.
+func orderGroupRuleUpdates(updates []cloudresource.GroupRuleUpdate) (ordered []int, dependencies map[int][]int,
+	cyclic []int) {
+	groupIndexes := make(map[string]int)
+	for i, update := range updates {
+		if update.AppliedToGroup != nil {
+			groupIndexes[update.AppliedToGroup.CloudResourceID.String()] = i
+		}
+	}
+
+	dependencies = make(map[int][]int)
+	dependents := make(map[int][]int)
+	pending := make(map[int]int)
+	for i, update := range updates {
+		if update.AppliedToGroup == nil {
+			continue
+		}
+		referenced := make(map[int]struct{})
+		for _, rule := range update.AddRules {
+			var groups []*cloudresource.CloudResourceID
+			switch r := rule.Rule.(type) {
+			case *cloudresource.IngressRule:
+				groups = r.FromSecurityGroups
+			case *cloudresource.EgressRule:
+				groups = r.ToSecurityGroups
+			}
+			for _, group := range groups {
+				if j, found := groupIndexes[group.String()]; found && j != i {
+					referenced[j] = struct{}{}
+				}
+			}
+		}
+		for j := range referenced {
+			dependencies[i] = append(dependencies[i], j)
+			dependents[j] = append(dependents[j], i)
+		}
+		sort.Ints(dependencies[i])
+		pending[i] = len(referenced)
+	}
+
+	// Repeatedly take the updates whose dependencies are all ordered, keeping the order of independent updates.
+	for progressed := true; progressed; {
+		progressed = false
+		for i := range updates {
+			if count, found := pending[i]; !found || count > 0 {
+				continue
+			}
+			delete(pending, i)
+			ordered = append(ordered, i)
+			for _, dependent := range dependents[i] {
+				pending[dependent]--
+			}
+			progressed = true
+		}
+	}
+	for i := range updates {
+		if _, found := pending[i]; found {
+			cyclic = append(cyclic, i)
+		}
+	}
+	return ordered, dependencies, cyclic
+}
+
+// MaxKqlPredicateLength is the maximum length of a custom KQL predicate.
+const MaxKqlPredicateLength = 1024
+
+// kqlTokenKind is the kind of a token of a KQL predicate.
+type kqlTokenKind int
+
+const (
+	kqlTokenString kqlTokenKind = iota
+	kqlTokenMultiLineString
+	kqlTokenComment
+	kqlTokenLineBreak
+	kqlTokenPunctuation
+	kqlTokenOther
+)
+
+// kqlToken is a token of a KQL predicate.
+type kqlToken struct {
+	kind kqlTokenKind
+	text string
+}
+
+// tokenizeKql splits a KQL predicate into tokens. String literals are single tokens: regular string literals delimited
+// by ' or " honor backslash escapes, verbatim string literals prefixed with '@' have none and include their delimiter
+// by doubling it. Adjacent string literals, as a regular string literal with a doubled delimiter, are separate tokens.
+// Multi-line string delimiters, comment starts, line breaks and punctuation are tokens of their own, any other rune is
+// a token.
+func tokenizeKql(predicate string) ([]kqlToken, error) {
+	var tokens []kqlToken
+	runes := []rune(predicate)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		kind, end := kqlTokenOther, i+1
+		switch {
+		case c == '\'' || c == '"' || (c == '@' && i+1 < len(runes) && (runes[i+1] == '\'' || runes[i+1] == '"')):
+			var err error
+			if end, err = scanKqlString(runes, i); err != nil {
+				return nil, err
+			}
+			kind = kqlTokenString
+		case c == '`':
+			kind = kqlTokenMultiLineString
+		case c == '/' && i+1 < len(runes) && (runes[i+1] == '/' || runes[i+1] == '*'):
+			kind, end = kqlTokenComment, i+2
+		case c == '\n' || c == '\r':
+			kind = kqlTokenLineBreak
+		case strings.ContainsRune("|;()[]", c):
+			kind = kqlTokenPunctuation
+		}
+		tokens = append(tokens, kqlToken{kind: kind, text: string(runes[i:end])})
+		i = end
+	}
+	return tokens, nil
+}
+
+// scanKqlString returns the index following the string literal starting at start.
+func scanKqlString(runes []rune, start int) (int, error) {
+	i := start
+	verbatim := runes[i] == '@'
+	if verbatim {
+		i++
+	}
+	quote := runes[i]
+	for i++; i < len(runes); i++ {
+		switch runes[i] {
+		case '\n', '\r':
+			return 0, fmt.Errorf("unterminated string literal in query filter")
+		case '\\':
+			// skip escaped character.
+			if !verbatim {
+				i++
+			}
+		case quote:
+			// a doubled delimiter is a delimiter within a verbatim string literal.
+			if verbatim && i+1 < len(runes) && runes[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string literal in query filter")
+}
+
+// ValidateKqlPredicate validates a user provided KQL predicate to be appended as a where clause to a generated
+// query. Only a single boolean expression is accepted: pipes, statement separators, comments, multi-line string
+// delimiters and line breaks outside string literals are rejected, and string literals, parentheses and brackets must
+// be balanced. The predicate is tokenized by tokenizeKql, so that string literals are skipped as KQL parses them.
+func ValidateKqlPredicate(predicate string) error {
+	if len(strings.TrimSpace(predicate)) == 0 {
+		return fmt.Errorf("empty query filter")
+	}
+	if len(predicate) > MaxKqlPredicateLength {
+		return fmt.Errorf("query filter longer than %v characters", MaxKqlPredicateLength)
+	}
+
+	tokens, err := tokenizeKql(predicate)
+	if err != nil {
+		return err
+	}
+	var brackets []string
+	closing := map[string]string{")": "(", "]": "["}
+	for _, token := range tokens {
+		switch token.kind {
+		case kqlTokenMultiLineString:
+			return fmt.Errorf("multi-line string literal is not allowed in query filter")
+		case kqlTokenComment:
+			return fmt.Errorf("comment is not allowed in query filter")
+		case kqlTokenLineBreak:
+			return fmt.Errorf("line break is not allowed in query filter")
+		case kqlTokenPunctuation:
+			switch token.text {
+			case "|", ";":
+				return fmt.Errorf("%q is not allowed in query filter", token.text)
+			case "(", "[":
+				brackets = append(brackets, token.text)
+			case ")", "]":
+				if len(brackets) == 0 || brackets[len(brackets)-1] != closing[token.text] {
+					return fmt.Errorf("unbalanced %q in query filter", token.text)
+				}
+				brackets = brackets[:len(brackets)-1]
+			}
+		}
+	}
+	if len(brackets) != 0 {
+		return fmt.Errorf("unbalanced %q in query filter", brackets[len(brackets)-1])
+	}
+	return nil
+}
+
+const maxPort = 65535
+
+// SplitInvalidRules validates rules against the constraints of provider, and returns the valid rules along with an
+// InvalidRulesError holding the rejected ones, or nil if all rules are valid.
+func SplitInvalidRules(provider runtimev1alpha1.CloudProvider, appliedToGroup *cloudresource.CloudResource,
+	rules []*cloudresource.CloudRule) ([]*cloudresource.CloudRule, error) {
+	var valid []*cloudresource.CloudRule
+	rejected := make(map[*cloudresource.CloudRule]error)
+	for _, rule := range rules {
+		if err := ValidateRule(provider, rule); err != nil {
+			rejected[rule] = err
+			continue
+		}
+		valid = append(valid, rule)
+	}
+	if len(rejected) == 0 {
+		return rules, nil
+	}
+	return valid, &cloudresource.InvalidRulesError{AppliedToGroup: appliedToGroup.Name, Rejected: rejected}
+}
+
+// ValidateRule validates rule against the constraints of provider, so that rules the provider cannot realize are
+// rejected before translation instead of failing at the cloud API.
+func ValidateRule(provider runtimev1alpha1.CloudProvider, rule *cloudresource.CloudRule) error {
+	var protocol, port, srcPort, srcEndPort *int
+	var ips []*net.IPNet
+	switch r := rule.Rule.(type) {
+	case *cloudresource.IngressRule:
+		protocol, port, srcPort, srcEndPort, ips = r.Protocol, r.FromPort, r.SrcPort, r.SrcEndPort, r.FromSrcIP
+	case *cloudresource.EgressRule:
+		protocol, port, srcPort, srcEndPort, ips = r.Protocol, r.ToPort, r.SrcPort, r.SrcEndPort, r.ToDstIP
+	default:
+		return fmt.Errorf("unknown rule type %T", rule.Rule)
+	}
+
+	if protocol != nil {
+		if *protocol < 0 || *protocol > maxProtocolNumber {
+			return fmt.Errorf("invalid protocol number %v", *protocol)
+		}
+		if provider == runtimev1alpha1.AzureCloudProvider {
+			if _, err := ProtocolToAzure(*protocol); err != nil {
+				return fmt.Errorf("protocol number %v not supported by %v", *protocol, provider)
+			}
+		}
+	}
+	// ports are ignored on any protocol rules.
+	portSupported := protocol == nil || *protocol == ProtocolTCP || *protocol == ProtocolUDP
+	if port != nil {
+		if !portSupported {
+			return fmt.Errorf("port %v not allowed on rule with protocol %v", *port, *protocol)
+		}
+		if *port < 0 || *port > maxPort {
+			return fmt.Errorf("invalid port %v", *port)
+		}
+	}
+	if (srcPort != nil || srcEndPort != nil) && provider == runtimev1alpha1.AWSCloudProvider {
+		return fmt.Errorf("source port not supported by %v", provider)
+	}
+	if srcPort != nil {
+		if !portSupported {
+			return fmt.Errorf("source port %v not allowed on rule with protocol %v", *srcPort, *protocol)
+		}
+		if *srcPort < 0 || *srcPort > maxPort {
+			return fmt.Errorf("invalid source port %v", *srcPort)
+		}
+	}
+	if srcEndPort != nil {
+		if srcPort == nil {
+			return fmt.Errorf("source end port %v without source port", *srcEndPort)
+		}
+		if *srcEndPort < *srcPort || *srcEndPort > maxPort {
+			return fmt.Errorf("invalid source port range %v-%v", *srcPort, *srcEndPort)
+		}
+	}
+	for _, ip := range ips {
+		if ip == nil || ip.IP.Mask(ip.Mask) == nil {
+			return fmt.Errorf("invalid CIDR %v", ip)
+		}
+		if _, bits := ip.Mask.Size(); bits == 0 {
+			return fmt.Errorf("invalid mask of CIDR %v", ip)
+		}
+	}
+	return nil
+}
+
+// AzureInventoryOptionalFields are the optional VM fields queried from Azure Resource Graph, which can be left out of
+// the inventory query using the inventory fields annotation. The VM properties are always queried, as the network
+// interfaces and the attribute matches of selectors are derived from them.
+var AzureInventoryOptionalFields = []string{"status", "tags", "createdAt", "lastModifiedAt", "encryptionAtHost",
+	"dataDiskCount", "dataDiskSizeGB", "secureBootEnabled", "vTpmEnabled", "locked", "hasPublicIp", "extensions",
+	"scaleSetId"}
+
+// AccountOptions holds the plugin options of an account set via well-known CloudProviderAccount annotations.
+type AccountOptions struct {
+	// DetachPolicy is empty when not set.
+	DetachPolicy crdv1alpha1.SecurityGroupDetachPolicy
+	// InventoryTombstonePolls is 0 when not set, in which case the controller wide value applies.
+	InventoryTombstonePolls int
+	// MaxInventoryVMs is 0 when not set, in which case the inventory is not capped.
+	MaxInventoryVMs int
+	// InventoryConsistencyRetries is 0 when not set, in which case inventory queries are not retried.
+	InventoryConsistencyRetries int
+	// InventoryFields is nil when not set, in which case all optional VM fields are queried.
+	InventoryFields []string
+	// DenyRulePlacement is empty when not set.
+	DenyRulePlacement crdv1alpha1.DenyRulePlacement
+	// SelectorMatchSpikeThreshold is 0 when not set, in which case the inventory of selectors is never held.
+	SelectorMatchSpikeThreshold int
+	// PeerAddressSpaceFallback is false when not set.
+	PeerAddressSpaceFallback bool
+}
+
+// ParseAccountAnnotations parses and validates the well-known annotations of a CloudProviderAccount. Other
+// annotations are ignored.
+func ParseAccountAnnotations(annotations map[string]string) (*AccountOptions, error) {
+	options := &AccountOptions{}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationDetachPolicy]; ok {
+		policy := crdv1alpha1.SecurityGroupDetachPolicy(strings.TrimSpace(value))
+		if policy != crdv1alpha1.SecurityGroupDetachPolicyMoveToDefault &&
+			policy != crdv1alpha1.SecurityGroupDetachPolicyLeaveUnattached {
+			return nil, fmt.Errorf("invalid annotation %v value %q, supported values are %v and %v",
+				crdv1alpha1.AccountAnnotationDetachPolicy, value, crdv1alpha1.SecurityGroupDetachPolicyMoveToDefault,
+				crdv1alpha1.SecurityGroupDetachPolicyLeaveUnattached)
+		}
+		options.DetachPolicy = policy
+	}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationInventoryTombstonePolls]; ok {
+		polls, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || polls < 1 {
+			return nil, fmt.Errorf("invalid annotation %v value %q, must be a positive integer",
+				crdv1alpha1.AccountAnnotationInventoryTombstonePolls, value)
+		}
+		options.InventoryTombstonePolls = polls
+	}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationMaxInventoryVMs]; ok {
+		maxVMs, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || maxVMs < 1 {
+			return nil, fmt.Errorf("invalid annotation %v value %q, must be a positive integer",
+				crdv1alpha1.AccountAnnotationMaxInventoryVMs, value)
+		}
+		options.MaxInventoryVMs = maxVMs
+	}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationInventoryConsistencyRetries]; ok {
+		retries, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || retries < 1 {
+			return nil, fmt.Errorf("invalid annotation %v value %q, must be a positive integer",
+				crdv1alpha1.AccountAnnotationInventoryConsistencyRetries, value)
+		}
+		options.InventoryConsistencyRetries = retries
+	}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationInventoryFields]; ok {
+		fields, err := parseInventoryFields(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %v value %q, %v", crdv1alpha1.AccountAnnotationInventoryFields,
+				value, err)
+		}
+		options.InventoryFields = fields
+	}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationDenyRulePlacement]; ok {
+		placement := crdv1alpha1.DenyRulePlacement(strings.TrimSpace(value))
+		if placement != crdv1alpha1.DenyRulePlacementPriorityFloor &&
+			placement != crdv1alpha1.DenyRulePlacementAfterAllowRules {
+			return nil, fmt.Errorf("invalid annotation %v value %q, supported values are %v and %v",
+				crdv1alpha1.AccountAnnotationDenyRulePlacement, value, crdv1alpha1.DenyRulePlacementPriorityFloor,
+				crdv1alpha1.DenyRulePlacementAfterAllowRules)
+		}
+		options.DenyRulePlacement = placement
+	}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationSelectorMatchSpikeThreshold]; ok {
+		threshold, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || threshold < 1 {
+			return nil, fmt.Errorf("invalid annotation %v value %q, must be a positive integer",
+				crdv1alpha1.AccountAnnotationSelectorMatchSpikeThreshold, value)
+		}
+		options.SelectorMatchSpikeThreshold = threshold
+	}
+	if value, ok := annotations[crdv1alpha1.AccountAnnotationPeerAddressSpaceFallback]; ok {
+		fallback, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %v value %q, must be a boolean",
+				crdv1alpha1.AccountAnnotationPeerAddressSpaceFallback, value)
+		}
+		options.PeerAddressSpaceFallback = fallback
+	}
+	return options, nil
+}
+
+// ParseConfirmedVMCount parses and validates the confirmed VM count annotation of a CloudEntitySelector, it returns 0
+// when the annotation is not set.
+func ParseConfirmedVMCount(annotations map[string]string) (int, error) {
+	value, ok := annotations[crdv1alpha1.SelectorAnnotationConfirmVMCount]
+	if !ok {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid annotation %v value %q, must be a non-negative integer",
+			crdv1alpha1.SelectorAnnotationConfirmVMCount, value)
+	}
+	return count, nil
+}
+
+// parseInventoryFields parses comma separated optional VM fields into a non nil list in the order of
+// AzureInventoryOptionalFields, an empty value selects no optional field.
+func parseInventoryFields(value string) ([]string, error) {
+	selected := make(map[string]struct{})
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		// properties used to be optional, it is accepted and always queried.
+		if field == "" || strings.EqualFold(field, "properties") {
+			continue
+		}
+		known := false
+		for _, optionalField := range AzureInventoryOptionalFields {
+			if strings.EqualFold(field, optionalField) {
+				selected[optionalField] = struct{}{}
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("supported fields are %v", strings.Join(AzureInventoryOptionalFields, ", "))
+		}
+	}
+	fields := make([]string, 0, len(selected))
+	for _, field := range AzureInventoryOptionalFields {
+		if _, ok := selected[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// ValidateSecretRefs checks that at least one Secret is referenced and that every reference is complete.
+func ValidateSecretRefs(secretRefs []*crdv1alpha1.SecretReference) error {
+	if len(secretRefs) == 0 {
+		return fmt.Errorf("secretRef cannot be empty")
+	}
+	for _, secretRef := range secretRefs {
+		if strings.TrimSpace(secretRef.Name) == "" || strings.TrimSpace(secretRef.Namespace) == "" ||
+			strings.TrimSpace(secretRef.Key) == "" {
+			return fmt.Errorf("secretRef %v/%v must specify name, namespace and key", secretRef.Namespace, secretRef.Name)
+		}
+	}
+	return nil
+}
+
+// ParseCIDRs parses CIDRs into networks sorted by their string form, duplicated networks are returned once.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make(map[string]*net.IPNet)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		networks[network.String()] = network
+	}
+
+	keys := make([]string, 0, len(networks))
+	for key := range networks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*net.IPNet, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, networks[key])
+	}
+	return result, nil
+}
+
+// GetEgressAllowListRuleOwner returns the namespaced name in the description of rules built from the egress allow
+// CIDRs of an account, rather than from a network policy.
+func GetEgressAllowListRuleOwner() string {
+	return cloudresource.ControllerPrefix + "/egress-allow-list"
+}
+
+// IsEgressAllowListRuleDescription checks if the given cloud rule description is of a rule built from the egress allow
+// CIDRs of an account.
+func IsEgressAllowListRuleDescription(description *string) bool {
+	desc, ok := ExtractCloudDescription(description)
+	return ok && desc.Namespace+"/"+desc.Name == GetEgressAllowListRuleOwner()
+}
+
+// NewEgressAllowListRule returns the rule allowing egress to the egress allow CIDRs of an account, with any protocol
+// and port, from the appliedTo group. Returns nil if no CIDR is configured.
+func NewEgressAllowListRule(appliedToGroupID *cloudresource.CloudResourceID, cidrs []*net.IPNet) *cloudresource.CloudRule {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	return &cloudresource.CloudRule{
+		Rule:             &cloudresource.EgressRule{ToDstIP: cidrs},
+		NpNamespacedName: GetEgressAllowListRuleOwner(),
+		AppliedToGrp:     appliedToGroupID.String(),
+	}
+}
+
+// GetOSFamily normalizes the operating system type reported by a cloud provider, e.g. Linux in Azure or windows in
+// AWS, into an OS family. Returns an empty family for unknown types.
+func GetOSFamily(osType string) runtimev1alpha1.OSFamily {
+	switch family := runtimev1alpha1.OSFamily(strings.ToLower(strings.TrimSpace(osType))); family {
+	case runtimev1alpha1.OSFamilyLinux, runtimev1alpha1.OSFamilyWindows:
+		return family
+	}
+	return ""
+}
+
+// RedactIdentifier masks all but the last 4 characters of a cloud identifier.
+func RedactIdentifier(id string) string {
+	const visible = 4
+	if len(id) <= visible {
+		return strings.Repeat("*", len(id))
+	}
+	return strings.Repeat("*", len(id)-visible) + id[len(id)-visible:]
+}
+
+// ParseProxyURL parses the URL of an HTTP(S) proxy.
+func ParseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", proxyURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: must be an http or https URL with a host", proxyURL)
+	}
+	return u, nil
+}
+
+// ParseEndpointURLs parses the URLs of cloud API endpoints, which must be https URLs with a host.
+func ParseEndpointURLs(endpoints []string) ([]string, error) {
+	var parsed []string
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(strings.TrimSpace(endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint URL %q: %w", endpoint, err)
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint URL %q: must be an https URL with a host", endpoint)
+		}
+		parsed = append(parsed, u.String())
+	}
+	return parsed, nil
+}
+
+// NewProxyHTTPClient returns an HTTP client sending requests through the proxy, except for requests to the hosts of
+// the no-proxy list. Returns nil if proxy is not configured.
+func NewProxyHTTPClient(proxy *crdv1alpha1.ProxyConfig) (*http.Client, error) {
+	if proxy == nil {
+		return nil, nil
+	}
+	proxyURL, err := ParseProxyURL(proxy.URL)
+	if err != nil {
+		return nil, err
+	}
+	noProxy := make([]string, 0, len(proxy.NoProxy))
+	for _, host := range proxy.NoProxy {
+		noProxy = append(noProxy, strings.TrimSpace(host))
+	}
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    strings.Join(noProxy, ","),
+	}).ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+)
+
+func TestUtils(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cloud Provider Utils")
+}
+
+var _ = Describe("Batch security group rules update", func() {
+	var (
+		vpc     = "vpc01"
+		web     = &cloudresource.CloudResource{CloudResourceID: cloudresource.CloudResourceID{Name: "web", Vpc: vpc}}
+		db      = &cloudresource.CloudResource{CloudResourceID: cloudresource.CloudResourceID{Name: "db", Vpc: vpc}}
+		app     = &cloudresource.CloudResource{CloudResourceID: cloudresource.CloudResourceID{Name: "app", Vpc: vpc}}
+		applied []string
+	)
+
+	ingressFrom := func(groups ...*cloudresource.CloudResource) []*cloudresource.CloudRule {
+		rule := &cloudresource.IngressRule{}
+		for _, group := range groups {
+			rule.FromSecurityGroups = append(rule.FromSecurityGroups, &group.CloudResourceID)
+		}
+		return []*cloudresource.CloudRule{{Rule: rule}}
+	}
+
+	egressTo := func(groups ...*cloudresource.CloudResource) []*cloudresource.CloudRule {
+		rule := &cloudresource.EgressRule{}
+		for _, group := range groups {
+			rule.ToSecurityGroups = append(rule.ToSecurityGroups, &group.CloudResourceID)
+		}
+		return []*cloudresource.CloudRule{{Rule: rule}}
+	}
+
+	updateFn := func(failed ...*cloudresource.CloudResource) func(*cloudresource.CloudResource,
+		[]*cloudresource.CloudRule, []*cloudresource.CloudRule) error {
+		return func(group *cloudresource.CloudResource, _, _ []*cloudresource.CloudRule) error {
+			for _, f := range failed {
+				if f == group {
+					return fmt.Errorf("update failed")
+				}
+			}
+			applied = append(applied, group.Name)
+			return nil
+		}
+	}
+
+	BeforeEach(func() {
+		applied = nil
+	})
+
+	It("Should update referenced groups before the groups referencing them", func() {
+		updates := []cloudresource.GroupRuleUpdate{
+			{AppliedToGroup: web, AddRules: ingressFrom(db, web)},
+			{AppliedToGroup: app, AddRules: egressTo(web)},
+			{AppliedToGroup: db},
+		}
+		Expect(UpdateSecurityGroupRulesInBatch(updates, updateFn())).Should(BeNil())
+		Expect(applied).To(Equal([]string{"db", "web", "app"}))
+	})
+
+	It("Should fail groups on a dependency cycle", func() {
+		updates := []cloudresource.GroupRuleUpdate{
+			{AppliedToGroup: web, AddRules: ingressFrom(db)},
+			{AppliedToGroup: db, AddRules: egressTo(web)},
+			{AppliedToGroup: app},
+		}
+		err := UpdateSecurityGroupRulesInBatch(updates, updateFn())
+		batchErr, ok := err.(*cloudresource.GroupRuleUpdateBatchError)
+		Expect(ok).To(BeTrue())
+		Expect(batchErr.Succeeded).To(Equal([]cloudresource.CloudResource{*app}))
+		Expect(batchErr.Failed).To(HaveLen(2))
+		Expect(batchErr.Failed[*web]).To(MatchError(ContainSubstring("dependency cycle among security groups")))
+		Expect(batchErr.Failed[*db]).To(MatchError(ContainSubstring("dependency cycle among security groups")))
+		Expect(applied).To(Equal([]string{"app"}))
+	})
+
+	It("Should not update groups referencing a group failed to update", func() {
+		updates := []cloudresource.GroupRuleUpdate{
+			{AppliedToGroup: web, AddRules: ingressFrom(db)},
+			{AppliedToGroup: db},
+		}
+		err := UpdateSecurityGroupRulesInBatch(updates, updateFn(db))
+		batchErr, ok := err.(*cloudresource.GroupRuleUpdateBatchError)
+		Expect(ok).To(BeTrue())
+		Expect(batchErr.Succeeded).To(BeEmpty())
+		Expect(batchErr.Failed[*web]).To(MatchError(ContainSubstring("referenced security group")))
+		Expect(applied).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Cloud rule description", func() {
+	const (
+		namespacedName = "ns/anp"
+		uid            = "4f3c2b1a-0000-1111-2222-333344445555"
+	)
+
+	It("Should round trip annotations", func() {
+		annotations := map[string]string{"team": "web", "app.kubernetes.io/name": "shop"}
+		description, err := GenerateCloudDescriptionWithAnnotations(namespacedName, uid, true, annotations)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(description).To(Equal("Name:anp, Ns:ns, Uid:" + uid + ", Log:true, a.app.kubernetes.io/name:shop, a.team:web"))
+
+		desc, ok := ExtractCloudDescription(&description)
+		Expect(ok).To(BeTrue())
+		Expect(desc.Name).To(Equal("anp"))
+		Expect(desc.Namespace).To(Equal("ns"))
+		Expect(desc.UID).To(Equal(uid))
+		Expect(desc.Logging).To(BeTrue())
+		Expect(desc.Annotations).To(Equal(annotations))
+	})
+
+	It("Should skip annotations which cannot be encoded or exceed the description limits", func() {
+		annotations := map[string]string{
+			"a": "1", "b": "2", "c": "3", "d": "4", "e": "5",
+			"with:colon": "x", "comma": "x,y", "space": "x y", "empty": "",
+		}
+		description, err := GenerateCloudDescriptionWithAnnotations(namespacedName, uid, false, annotations)
+		Expect(err).ToNot(HaveOccurred())
+		desc, ok := ExtractCloudDescription(&description)
+		Expect(ok).To(BeTrue())
+		Expect(desc.Annotations).To(Equal(map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}))
+
+		long := strings.Repeat("v", maxCloudDescriptionLength)
+		description, err = GenerateCloudDescriptionWithAnnotations(namespacedName, uid, false,
+			map[string]string{"long": long, "short": "v"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(description)).To(BeNumerically("<=", maxCloudDescriptionLength))
+		desc, ok = ExtractCloudDescription(&description)
+		Expect(ok).To(BeTrue())
+		Expect(desc.Annotations).To(Equal(map[string]string{"short": "v"}))
+	})
+
+	It("Should extract descriptions without annotations", func() {
+		description, err := GenerateCloudDescription(namespacedName, "")
+		Expect(err).ToNot(HaveOccurred())
+		desc, ok := ExtractCloudDescription(&description)
+		Expect(ok).To(BeTrue())
+		Expect(desc.Annotations).To(BeNil())
+	})
+})
+
+var _ = Describe("Stateless rule expansion", func() {
+	var (
+		tcp        = ProtocolTCP
+		ssh        = 22
+		clientPort = 40000
+		peer       = cloudresource.CloudResourceID{Name: "db", Vpc: "vpc01"}
+		// provider enforcing security rules without connection tracking.
+		stateless = runtimev1alpha1.CloudProvider("Stateless")
+		cidr      *net.IPNet
+		rules     []*cloudresource.CloudRule
+	)
+
+	BeforeEach(func() {
+		_, cidr, _ = net.ParseCIDR("10.0.0.0/16")
+		rules = []*cloudresource.CloudRule{
+			{
+				Rule: &cloudresource.IngressRule{
+					FromPort:           &ssh,
+					FromSrcIP:          []*net.IPNet{cidr},
+					FromSecurityGroups: []*cloudresource.CloudResourceID{&peer},
+					Protocol:           &tcp,
+				},
+				NpNamespacedName: "default/np-web",
+				AppliedToGrp:     "web",
+			},
+			{
+				Rule: &cloudresource.EgressRule{
+					ToPort:   &ssh,
+					ToDstIP:  []*net.IPNet{cidr},
+					Protocol: &tcp,
+					SrcPort:  &clientPort,
+				},
+				NpNamespacedName: "default/np-web",
+				AppliedToGrp:     "web",
+			},
+		}
+	})
+
+	AfterEach(func() {
+		cloudresource.SetStatelessRuleEnforcement(false)
+	})
+
+	It("Should not expand rules of stateful enforcement", func() {
+		Expect(ExpandStatelessRules(stateless, rules)).To(Equal(rules))
+
+		cloudresource.SetStatelessRuleEnforcement(true)
+		Expect(ExpandStatelessRules(runtimev1alpha1.AWSCloudProvider, rules)).To(Equal(rules))
+		Expect(ExpandStatelessRules(runtimev1alpha1.AzureCloudProvider, rules)).To(Equal(rules))
+	})
+
+	It("Should generate the return-direction rules of stateless enforcement", func() {
+		cloudresource.SetStatelessRuleEnforcement(true)
+		expanded := ExpandStatelessRules(stateless, rules)
+		Expect(expanded).To(HaveLen(4))
+		Expect(expanded[:2]).To(Equal(rules))
+
+		Expect(expanded[2].Rule).To(Equal(&cloudresource.EgressRule{
+			ToDstIP:          []*net.IPNet{cidr},
+			ToSecurityGroups: []*cloudresource.CloudResourceID{&peer},
+			Protocol:         &tcp,
+			SrcPort:          &ssh,
+		}))
+		Expect(expanded[2].NpNamespacedName).To(Equal("default/np-web"))
+		Expect(expanded[2].AppliedToGrp).To(Equal("web"))
+		Expect(expanded[2].Hash).To(Equal(expanded[2].GetHash()))
+		Expect(expanded[2].Generated).To(BeTrue())
+
+		Expect(expanded[3].Rule).To(Equal(&cloudresource.IngressRule{
+			FromPort:  &clientPort,
+			FromSrcIP: []*net.IPNet{cidr},
+			Protocol:  &tcp,
+			SrcPort:   &ssh,
+		}))
+
+		// Rules already allowing their return traffic are not duplicated, and return rules are not expanded.
+		Expect(ExpandStatelessRules(stateless, expanded)).To(HaveLen(4))
+		Expect(ExpandStatelessRules(stateless, expanded[2:])).To(Equal(expanded[2:]))
+	})
+})
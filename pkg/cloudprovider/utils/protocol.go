@@ -0,0 +1,96 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+)
+
+// IANA numbers of the protocols of cloud security rules.
+const (
+	ProtocolICMP   = 1
+	ProtocolIGMP   = 2
+	ProtocolTCP    = 6
+	ProtocolUDP    = 17
+	ProtocolESP    = 50
+	ProtocolAH     = 51
+	ProtocolICMPv6 = 58
+
+	maxProtocolNumber = 255
+)
+
+var protocolToAzure = map[int]armnetwork.SecurityRuleProtocol{
+	ProtocolICMP: armnetwork.SecurityRuleProtocolIcmp,
+	ProtocolTCP:  armnetwork.SecurityRuleProtocolTCP,
+	ProtocolUDP:  armnetwork.SecurityRuleProtocolUDP,
+	ProtocolESP:  armnetwork.SecurityRuleProtocolEsp,
+	ProtocolAH:   armnetwork.SecurityRuleProtocolAh,
+}
+
+// awsProtocolNames are the protocol names AWS reports in security group rules instead of protocol numbers.
+var awsProtocolNames = map[string]int{
+	"icmp":   ProtocolICMP,
+	"igmp":   ProtocolIGMP,
+	"tcp":    ProtocolTCP,
+	"udp":    ProtocolUDP,
+	"icmpv6": ProtocolICMPv6,
+}
+
+// ProtocolToAzure converts a protocol number to the protocol of an Azure security rule. An error is returned for
+// protocols Azure security rules do not support.
+func ProtocolToAzure(protocol int) (armnetwork.SecurityRuleProtocol, error) {
+	azureProtocol, ok := protocolToAzure[protocol]
+	if !ok {
+		return "", fmt.Errorf("unsupported protocol number %v", protocol)
+	}
+	return azureProtocol, nil
+}
+
+// ProtocolFromAzure converts the protocol of an Azure security rule to its protocol number. Protocol is compared case
+// insensitively, as Azure may change its case on out-of-band modifications, e.g. Tcp to TCP.
+func ProtocolFromAzure(protocol armnetwork.SecurityRuleProtocol) (int, error) {
+	for number, azureProtocol := range protocolToAzure {
+		if strings.EqualFold(string(azureProtocol), string(protocol)) {
+			return number, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported azure protocol %v", protocol)
+}
+
+// ProtocolToAWS converts a protocol number to the IP protocol of an AWS security group rule. AWS accepts any protocol
+// number, an error is returned for numbers out of the protocol number range.
+func ProtocolToAWS(protocol int) (string, error) {
+	if protocol < 0 || protocol > maxProtocolNumber {
+		return "", fmt.Errorf("unsupported protocol number %v", protocol)
+	}
+	return strconv.Itoa(protocol), nil
+}
+
+// ProtocolFromAWS converts the IP protocol of an AWS security group rule, a protocol name or number, to its protocol
+// number.
+func ProtocolFromAWS(ipProtocol string) (int, error) {
+	if protocol, ok := awsProtocolNames[strings.ToLower(ipProtocol)]; ok {
+		return protocol, nil
+	}
+	protocol, err := strconv.Atoi(ipProtocol)
+	if err != nil || protocol < 0 || protocol > maxProtocolNumber {
+		return 0, fmt.Errorf("unsupported aws protocol %v", ipProtocol)
+	}
+	return protocol, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Protocol normalization", func() {
+	const sctp = 132
+
+	DescribeTable("Azure protocol of supported protocol numbers",
+		func(protocol int, expected armnetwork.SecurityRuleProtocol) {
+			azureProtocol, err := ProtocolToAzure(protocol)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(azureProtocol).To(Equal(expected))
+			protocolNum, err := ProtocolFromAzure(azureProtocol)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(protocolNum).To(Equal(protocol))
+		},
+		Entry("TCP", ProtocolTCP, armnetwork.SecurityRuleProtocolTCP),
+		Entry("UDP", ProtocolUDP, armnetwork.SecurityRuleProtocolUDP),
+		Entry("ICMP", ProtocolICMP, armnetwork.SecurityRuleProtocolIcmp),
+	)
+
+	It("Should reject protocol numbers unsupported by Azure", func() {
+		_, err := ProtocolToAzure(sctp)
+		Expect(err).To(MatchError("unsupported protocol number 132"))
+		_, err = ProtocolToAzure(-1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should convert Azure protocols case insensitively", func() {
+		protocolNum, err := ProtocolFromAzure("TCP")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(protocolNum).To(Equal(ProtocolTCP))
+		_, err = ProtocolFromAzure(armnetwork.SecurityRuleProtocolAsterisk)
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("AWS IP protocol of protocol numbers",
+		func(protocol int, expected string, name string) {
+			ipProtocol, err := ProtocolToAWS(protocol)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ipProtocol).To(Equal(expected))
+			protocolNum, err := ProtocolFromAWS(name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(protocolNum).To(Equal(protocol))
+			protocolNum, err = ProtocolFromAWS(ipProtocol)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(protocolNum).To(Equal(protocol))
+		},
+		Entry("TCP", ProtocolTCP, "6", "tcp"),
+		Entry("UDP", ProtocolUDP, "17", "udp"),
+		Entry("ICMP", ProtocolICMP, "1", "icmp"),
+		Entry("SCTP", sctp, "132", "132"),
+	)
+
+	It("Should reject protocol numbers out of range for AWS", func() {
+		_, err := ProtocolToAWS(256)
+		Expect(err).To(MatchError("unsupported protocol number 256"))
+		_, err = ProtocolToAWS(-1)
+		Expect(err).To(HaveOccurred())
+		_, err = ProtocolFromAWS("sctp")
+		Expect(err).To(HaveOccurred())
+		_, err = ProtocolFromAWS("-1")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,208 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+)
+
+// RuleMismatch is a rule enforced in cloud for another policy than desired.
+type RuleMismatch struct {
+	Desired  *cloudresource.CloudRule
+	Enforced *cloudresource.CloudRule
+}
+
+// SecurityGroupDiff is the difference between the desired rules of an appliedTo security group and the rules
+// enforced in cloud.
+type SecurityGroupDiff struct {
+	// Group is the CloudResourceID string of the appliedTo security group.
+	Group string
+	// CloudID is the cloud identifier of the security group, empty when the group is not enforced in cloud.
+	CloudID string
+	// Added are rules enforced in cloud but not desired.
+	Added []*cloudresource.CloudRule
+	// Removed are desired rules not enforced in cloud.
+	Removed []*cloudresource.CloudRule
+	// Mismatched are rules enforced in cloud with the desired content, but on behalf of another policy or another
+	// incarnation of the desired policy.
+	Mismatched []RuleMismatch
+}
+
+// SecurityGroupSyncReport lists the appliedTo security groups whose enforced cloud rules differ from the desired
+// rules, ordered by group.
+type SecurityGroupSyncReport struct {
+	Groups []*SecurityGroupDiff
+}
+
+// NewSecurityGroupSyncReport compares the desired rules with the security group content enforced in cloud, as returned
+// by GetEnforcedSecurity. Rules are matched by hash, i.e. by rule content and appliedTo group, within each appliedTo
+// group; membership only groups carry no rules and are ignored.
+func NewSecurityGroupSyncReport(desired []cloudresource.CloudRule,
+	enforced []cloudresource.SynchronizationContent) *SecurityGroupSyncReport {
+	diffs := make(map[string]*SecurityGroupDiff)
+	getDiff := func(group string) *SecurityGroupDiff {
+		key := strings.ToLower(group)
+		diff, found := diffs[key]
+		if !found {
+			diff = &SecurityGroupDiff{Group: group}
+			diffs[key] = diff
+		}
+		return diff
+	}
+
+	desiredRules := make(map[string]map[string][]*cloudresource.CloudRule)
+	for i := range desired {
+		rule := &desired[i]
+		key := strings.ToLower(rule.AppliedToGrp)
+		getDiff(rule.AppliedToGrp)
+		if desiredRules[key] == nil {
+			desiredRules[key] = make(map[string][]*cloudresource.CloudRule)
+		}
+		hash := rule.GetHash()
+		desiredRules[key][hash] = append(desiredRules[key][hash], rule)
+	}
+
+	for i := range enforced {
+		content := &enforced[i]
+		if content.MembershipOnly {
+			continue
+		}
+		group := content.Resource.CloudResourceID.String()
+		diff := getDiff(group)
+		diff.CloudID = content.CloudID
+		groupRules := desiredRules[strings.ToLower(group)]
+		for _, rules := range [][]cloudresource.CloudRule{content.IngressRules, content.EgressRules} {
+			for j := range rules {
+				rule := &rules[j]
+				hash := rule.GetHash()
+				matches := groupRules[hash]
+				if len(matches) == 0 {
+					diff.Added = append(diff.Added, rule)
+					continue
+				}
+				match := matches[0]
+				groupRules[hash] = matches[1:]
+				if rule.NpNamespacedName != match.NpNamespacedName || rule.IsStale(match.NpNamespacedName, match.NpUID) {
+					diff.Mismatched = append(diff.Mismatched, RuleMismatch{Desired: match, Enforced: rule})
+				}
+			}
+		}
+	}
+
+	for key, groupRules := range desiredRules {
+		hashes := make([]string, 0, len(groupRules))
+		for hash := range groupRules {
+			hashes = append(hashes, hash)
+		}
+		sort.Strings(hashes)
+		for _, hash := range hashes {
+			diffs[key].Removed = append(diffs[key].Removed, groupRules[hash]...)
+		}
+	}
+
+	report := &SecurityGroupSyncReport{}
+	for _, diff := range diffs {
+		if len(diff.Added) > 0 || len(diff.Removed) > 0 || len(diff.Mismatched) > 0 {
+			report.Groups = append(report.Groups, diff)
+		}
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i].Group < report.Groups[j].Group
+	})
+	return report
+}
+
+// IsEmpty returns true if the enforced cloud rules match the desired rules.
+func (r *SecurityGroupSyncReport) IsEmpty() bool {
+	return len(r.Groups) == 0
+}
+
+// String returns the report in a human-readable form, one line per group and per differing rule.
+func (r *SecurityGroupSyncReport) String() string {
+	var sb strings.Builder
+	for _, diff := range r.Groups {
+		sb.WriteString("group " + diff.Group)
+		if diff.CloudID != "" {
+			sb.WriteString(" (" + diff.CloudID + ")")
+		}
+		sb.WriteString(fmt.Sprintf(": %d added, %d removed, %d mismatched\n", len(diff.Added), len(diff.Removed),
+			len(diff.Mismatched)))
+		for _, rule := range diff.Added {
+			sb.WriteString("  + " + describeRule(rule) + "\n")
+		}
+		for _, rule := range diff.Removed {
+			sb.WriteString("  - " + describeRule(rule) + "\n")
+		}
+		for _, mismatch := range diff.Mismatched {
+			sb.WriteString("  ~ " + describeRule(mismatch.Enforced) + ", desired policy " +
+				describePolicy(mismatch.Desired) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// describeRule returns a one line description of the direction, protocol, port, peers and policy of a rule.
+func describeRule(rule *cloudresource.CloudRule) string {
+	var direction string
+	var protocol, port *int
+	var peers []string
+	switch r := rule.Rule.(type) {
+	case *cloudresource.IngressRule:
+		direction, protocol, port = "ingress", r.Protocol, r.FromPort
+		for _, ipNet := range r.FromSrcIP {
+			peers = append(peers, ipNet.String())
+		}
+		for _, sg := range r.FromSecurityGroups {
+			peers = append(peers, sg.String())
+		}
+	case *cloudresource.EgressRule:
+		direction, protocol, port = "egress", r.Protocol, r.ToPort
+		for _, ipNet := range r.ToDstIP {
+			peers = append(peers, ipNet.String())
+		}
+		for _, sg := range r.ToSecurityGroups {
+			peers = append(peers, sg.String())
+		}
+	default:
+		return "unknown rule, policy " + describePolicy(rule)
+	}
+
+	desc := direction + " protocol " + describeOptionalInt(protocol) + " port " + describeOptionalInt(port)
+	if len(peers) > 0 {
+		desc += " peers " + strings.Join(peers, ",")
+	}
+	return desc + ", policy " + describePolicy(rule)
+}
+
+func describePolicy(rule *cloudresource.CloudRule) string {
+	if rule.NpNamespacedName == "" {
+		return "none"
+	}
+	if rule.NpUID == "" {
+		return rule.NpNamespacedName
+	}
+	return rule.NpNamespacedName + "(" + rule.NpUID + ")"
+}
+
+func describeOptionalInt(value *int) string {
+	if value == nil {
+		return "any"
+	}
+	return fmt.Sprint(*value)
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
+)
+
+var _ = Describe("Security group sync report", func() {
+	var (
+		web      = cloudresource.CloudResourceID{Name: "web", Vpc: "vpc01"}
+		policy   = "default/np-web"
+		tcp      = ProtocolTCP
+		ssh      = 22
+		https    = 443
+		newRule  func(port *int, cidr string) cloudresource.CloudRule
+		enforced func(rules ...cloudresource.CloudRule) []cloudresource.SynchronizationContent
+	)
+
+	BeforeEach(func() {
+		newRule = func(port *int, cidr string) cloudresource.CloudRule {
+			_, ipNet, _ := net.ParseCIDR(cidr)
+			return cloudresource.CloudRule{
+				Rule: &cloudresource.IngressRule{
+					FromPort:  port,
+					FromSrcIP: []*net.IPNet{ipNet},
+					Protocol:  &tcp,
+				},
+				NpNamespacedName: policy,
+				AppliedToGrp:     web.String(),
+			}
+		}
+		enforced = func(rules ...cloudresource.CloudRule) []cloudresource.SynchronizationContent {
+			return []cloudresource.SynchronizationContent{{
+				Resource:     cloudresource.CloudResource{Type: cloudresource.CloudResourceTypeVM, CloudResourceID: web},
+				IngressRules: rules,
+				CloudID:      "sg-web",
+			}}
+		}
+	})
+
+	It("Should report an extra cloud rule as added and a missing rule as removed", func() {
+		sshRule := newRule(&ssh, "10.0.0.0/16")
+		httpsRule := newRule(&https, "0.0.0.0/0")
+		extraRule := newRule(&ssh, "0.0.0.0/0")
+
+		report := NewSecurityGroupSyncReport([]cloudresource.CloudRule{sshRule, httpsRule}, enforced(sshRule, extraRule))
+		Expect(report.IsEmpty()).To(BeFalse())
+		Expect(report.Groups).To(HaveLen(1))
+		diff := report.Groups[0]
+		Expect(diff.Group).To(Equal(web.String()))
+		Expect(diff.CloudID).To(Equal("sg-web"))
+		Expect(diff.Added).To(HaveLen(1))
+		Expect(*diff.Added[0]).To(Equal(extraRule))
+		Expect(diff.Removed).To(HaveLen(1))
+		Expect(*diff.Removed[0]).To(Equal(httpsRule))
+		Expect(diff.Mismatched).To(BeEmpty())
+		Expect(report.String()).To(Equal("group web/vpc01 (sg-web): 1 added, 1 removed, 0 mismatched\n" +
+			"  + ingress protocol 6 port 22 peers 0.0.0.0/0, policy default/np-web\n" +
+			"  - ingress protocol 6 port 443 peers 0.0.0.0/0, policy default/np-web\n"))
+	})
+
+	It("Should report a rule enforced for another policy as mismatched", func() {
+		desiredRule := newRule(&ssh, "10.0.0.0/16")
+		enforcedRule := desiredRule
+		enforcedRule.NpNamespacedName = "default/np-other"
+
+		report := NewSecurityGroupSyncReport([]cloudresource.CloudRule{desiredRule}, enforced(enforcedRule))
+		Expect(report.Groups).To(HaveLen(1))
+		Expect(report.Groups[0].Added).To(BeEmpty())
+		Expect(report.Groups[0].Removed).To(BeEmpty())
+		Expect(report.Groups[0].Mismatched).To(HaveLen(1))
+		Expect(report.Groups[0].Mismatched[0].Enforced.NpNamespacedName).To(Equal("default/np-other"))
+	})
+
+	It("Should report no difference when enforced rules match the desired rules", func() {
+		sshRule := newRule(&ssh, "10.0.0.0/16")
+		report := NewSecurityGroupSyncReport([]cloudresource.CloudRule{sshRule}, enforced(sshRule))
+		Expect(report.IsEmpty()).To(BeTrue())
+		Expect(report.String()).To(BeEmpty())
+	})
+})
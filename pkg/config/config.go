@@ -18,9 +18,42 @@ const (
 	DefaultCloudResourcePrefix = "nephe"
 	DefaultCloudSyncInterval   = 300
 	MinimumCloudSyncInterval   = 60
+
+	DefaultInventoryTombstonePolls  = 1
+	DefaultInventoryPollTimeout     = 300
+	MaximumInventorySnapshotHistory = 10
+	// MaximumRuleAddressPrefixes is the number of address prefixes allowed in an Azure security rule.
+	MaximumRuleAddressPrefixes = 4000
 )
 
 type ControllerConfig struct {
 	CloudResourcePrefix string `yaml:"cloudResourcePrefix,omitempty"`
 	CloudSyncInterval   int64  `yaml:"cloudSyncInterval,omitempty"`
+	// ReconcileMembershipOnInventoryChange enables reconciling security group membership as soon as cloud inventory
+	// discovers new VMs, instead of waiting for the next retry.
+	ReconcileMembershipOnInventoryChange bool `yaml:"reconcileMembershipOnInventoryChange,omitempty"`
+	// InventoryTombstonePolls is the number of consecutive inventory polls a VM must be absent from before it is
+	// removed from the cloud inventory, protecting against partial poll results.
+	InventoryTombstonePolls int `yaml:"inventoryTombstonePolls,omitempty"`
+	// InventoryPollTimeout is the timeout in seconds of a single inventory poll of an account, distinct from the wait
+	// for the inventory to be initialized.
+	InventoryPollTimeout int64 `yaml:"inventoryPollTimeout,omitempty"`
+	// CoalesceInventoryQueries enables accounts on the same subscription and region, using the same credentials, to
+	// share the results of identical inventory queries, instead of each account querying the cloud.
+	CoalesceInventoryQueries bool `yaml:"coalesceInventoryQueries,omitempty"`
+	// InventorySnapshotHistory is the number of recent inventory snapshots kept per account for debugging, none are
+	// kept when 0.
+	InventorySnapshotHistory int `yaml:"inventorySnapshotHistory,omitempty"`
+	// MaxRuleAddressPrefixes is the maximum number of CIDRs in a single cloud security rule, rules with more CIDRs are
+	// split into multiple rules sharing the same ports and security groups.
+	MaxRuleAddressPrefixes int `yaml:"maxRuleAddressPrefixes,omitempty"`
+	// TagLabels maps cloud tag keys to custom ExternalEntity label keys, the tag values are labeled with in addition
+	// to the nephe.antrea.io/tag-<tag key> labels.
+	TagLabels map[string]string `yaml:"tagLabels,omitempty"`
+	// LabelTruncationStrategy is how ExternalEntity label values longer than 63 characters are shortened, either
+	// truncate or hash-suffix. Over-length tag values are not labeled when unset.
+	LabelTruncationStrategy string `yaml:"labelTruncationStrategy,omitempty"`
+	// StatelessRuleEnforcement indicates cloud security rules do not track connections, so the return-direction rule
+	// of each rule is generated. It has no effect today, as AWS and Azure, the only supported clouds, are stateful.
+	StatelessRuleEnforcement bool `yaml:"statelessRuleEnforcement,omitempty"`
 }
@@ -17,16 +17,23 @@ package cloudentityselector
 import (
 	"context"
 	"fmt"
+	gosync "sync"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	"antrea.io/nephe/pkg/accountmanager"
@@ -40,6 +47,8 @@ type CloudEntitySelectorReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 
+	// mutex protects selectorToAccountMap, which is also read when an account is deleted.
+	mutex                gosync.Mutex
 	selectorToAccountMap map[types.NamespacedName]types.NamespacedName
 	AccManager           accountmanager.Interface
 	pendingSyncCount     int
@@ -79,9 +88,20 @@ func (r *CloudEntitySelectorReconciler) Reconcile(ctx context.Context, req ctrl.
 func (r *CloudEntitySelectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.selectorToAccountMap = make(map[types.NamespacedName]types.NamespacedName)
 	// Using GenerationChangedPredicate to allow CES controller to receive CES updates
-	// for all events except change in status.
+	// for all events except change in status. Annotation changes are received, so that a
+	// confirmed VM count releases a held selector inventory. The selectors of a deleted account are
+	// reconciled, so that they report the account is not found.
 	if err := ctrl.NewControllerManagedBy(mgr).
-		For(&crdv1alpha1.CloudEntitySelector{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		For(&crdv1alpha1.CloudEntitySelector{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{}))).
+		Watches(&source.Kind{Type: &crdv1alpha1.CloudProviderAccount{}},
+			handler.EnqueueRequestsFromMapFunc(r.getAccountSelectors),
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc:  func(event.CreateEvent) bool { return false },
+				UpdateFunc:  func(event.UpdateEvent) bool { return false },
+				DeleteFunc:  func(event.DeleteEvent) bool { return true },
+				GenericFunc: func(event.GenericEvent) bool { return false },
+			})).
 		Complete(r); err != nil {
 		return err
 	}
@@ -89,6 +109,20 @@ func (r *CloudEntitySelectorReconciler) SetupWithManager(mgr ctrl.Manager) error
 	return mgr.Add(r)
 }
 
+// getAccountSelectors returns a request for each selector referencing the given account.
+func (r *CloudEntitySelectorReconciler) getAccountSelectors(account client.Object) []reconcile.Request {
+	accountNamespacedName := types.NamespacedName{Namespace: account.GetNamespace(), Name: account.GetName()}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var requests []reconcile.Request
+	for selectorNamespacedName, selectorAccount := range r.selectorToAccountMap {
+		if selectorAccount == accountNamespacedName {
+			requests = append(requests, reconcile.Request{NamespacedName: selectorNamespacedName})
+		}
+	}
+	return requests
+}
+
 // Start performs the initialization of the controller.
 // A controller is said to be initialized only when the dependent controllers
 // are synced, and it keeps a count of pending CRs to be reconciled.
@@ -137,29 +171,69 @@ func (r *CloudEntitySelectorReconciler) processCreateOrUpdate(selector *crdv1alp
 		Namespace: accountNamespace,
 		Name:      selector.Spec.AccountName,
 	}
+	r.mutex.Lock()
 	r.selectorToAccountMap[*selectorNamespacedName] = *accountNamespacedName
+	r.mutex.Unlock()
+
+	// Report a stale selector whose account does not exist, and retry so that the selector is added once the
+	// account is created.
+	accountFound, err := r.newAccountFoundCondition(accountNamespacedName)
+	if err != nil {
+		return err
+	}
+	if accountFound.Status == metav1.ConditionFalse {
+		err = fmt.Errorf("failed to add or update selector %v: %v", selectorNamespacedName, accountFound.Message)
+		r.updateStatus(selectorNamespacedName, err, accountFound)
+		return err
+	}
+
 	retry, err := r.AccManager.AddResourceFiltersToAccount(accountNamespacedName, selectorNamespacedName,
 		selector, false)
 	if err != nil && retry {
 		return err
 	}
-	r.updateStatus(selectorNamespacedName, err)
+	r.updateStatus(selectorNamespacedName, err, accountFound)
 	return nil
 }
 
+// newAccountFoundCondition returns the AccountFound condition of a selector referencing the given account.
+func (r *CloudEntitySelectorReconciler) newAccountFoundCondition(
+	accountNamespacedName *types.NamespacedName) (metav1.Condition, error) {
+	account := &crdv1alpha1.CloudProviderAccount{}
+	if err := r.Get(context.TODO(), *accountNamespacedName, account); err != nil {
+		if !errors.IsNotFound(err) {
+			return metav1.Condition{}, err
+		}
+		return metav1.Condition{
+			Type:    crdv1alpha1.SelectorConditionAccountFound,
+			Status:  metav1.ConditionFalse,
+			Reason:  crdv1alpha1.SelectorReasonAccountNotFound,
+			Message: fmt.Sprintf("account %v not found, delete the selector if the account was deleted", accountNamespacedName),
+		}, nil
+	}
+	return metav1.Condition{
+		Type:   crdv1alpha1.SelectorConditionAccountFound,
+		Status: metav1.ConditionTrue,
+		Reason: crdv1alpha1.SelectorReasonAccountFound,
+	}, nil
+}
+
 func (r *CloudEntitySelectorReconciler) processDelete(selectorNamespacedName *types.NamespacedName) error {
 	r.Log.Info("Received request", "selector", selectorNamespacedName, "operation", "delete")
+	r.mutex.Lock()
 	accountNamespacedName, found := r.selectorToAccountMap[*selectorNamespacedName]
+	delete(r.selectorToAccountMap, *selectorNamespacedName)
+	r.mutex.Unlock()
 	if !found {
 		return fmt.Errorf("failed to find account for selector %s", selectorNamespacedName.String())
 	}
-	delete(r.selectorToAccountMap, *selectorNamespacedName)
 	_ = r.AccManager.RemoveResourceFiltersFromAccount(&accountNamespacedName, selectorNamespacedName)
 	return nil
 }
 
-// updateStatus updates the status on the CloudEntitySelector CR.
-func (r *CloudEntitySelectorReconciler) updateStatus(namespacedName *types.NamespacedName, err error) {
+// updateStatus updates the error and the conditions on the CloudEntitySelector CR.
+func (r *CloudEntitySelectorReconciler) updateStatus(namespacedName *types.NamespacedName, err error,
+	conditions ...metav1.Condition) {
 	var errorMsg string
 	if err != nil {
 		errorMsg = err.Error()
@@ -170,8 +244,19 @@ func (r *CloudEntitySelectorReconciler) updateStatus(namespacedName *types.Names
 		if err = r.Get(context.TODO(), *namespacedName, selector); err != nil {
 			return nil
 		}
-		if selector.Status.Error != errorMsg {
+		conditionChanged := false
+		for _, condition := range conditions {
+			current := meta.FindStatusCondition(selector.Status.Conditions, condition.Type)
+			if current == nil || current.Status != condition.Status || current.Reason != condition.Reason ||
+				current.Message != condition.Message {
+				conditionChanged = true
+			}
+		}
+		if selector.Status.Error != errorMsg || conditionChanged {
 			selector.Status.Error = errorMsg
+			for _, condition := range conditions {
+				meta.SetStatusCondition(&selector.Status.Conditions, condition)
+			}
 			r.Log.Info("Setting CES status", "selector", namespacedName, "message", errorMsg)
 			if err = r.Client.Status().Update(context.TODO(), selector); err != nil {
 				r.Log.Error(err, "failed to update CES status, retrying", "selector", namespacedName)
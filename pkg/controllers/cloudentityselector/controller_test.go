@@ -22,6 +22,7 @@ import (
 	mock "github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -31,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	antreanetworking "antrea.io/antrea/pkg/apis/controlplane/v1beta2"
 	antreatypes "antrea.io/antrea/pkg/apis/crd/v1alpha2"
@@ -101,6 +103,14 @@ var _ = Describe("CloudEntitySelector Controller", func() {
 					},
 				},
 			}
+
+			account := &crdv1alpha1.CloudProviderAccount{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      testAccountNamespacedName.Name,
+					Namespace: testAccountNamespacedName.Namespace,
+				},
+			}
+			Expect(fakeClient.Create(context.Background(), account)).Should(Succeed())
 		})
 
 		It("CES Add and Delete workflow", func() {
@@ -154,6 +164,54 @@ var _ = Describe("CloudEntitySelector Controller", func() {
 			err := reconciler.processCreateOrUpdate(selector, &testSelectorNamespacedName)
 			Expect(err).Should(HaveOccurred())
 		})
+		It("CES Add for a nonexistent account", func() {
+			selector.Spec.AccountName = "deleted-account"
+			Expect(fakeClient.Create(context.Background(), selector)).Should(Succeed())
+
+			err := reconciler.processCreateOrUpdate(selector, &testSelectorNamespacedName)
+			Expect(err).Should(HaveOccurred())
+			temp := &crdv1alpha1.CloudEntitySelector{}
+			Expect(fakeClient.Get(context.Background(), testSelectorNamespacedName, temp)).Should(Succeed())
+			Expect(temp.Status.Error).Should(ContainSubstring("namespace01/deleted-account not found"))
+			condition := meta.FindStatusCondition(temp.Status.Conditions, crdv1alpha1.SelectorConditionAccountFound)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(v1.ConditionFalse))
+			Expect(condition.Reason).Should(Equal(crdv1alpha1.SelectorReasonAccountNotFound))
+
+			By("Account created")
+			selector.Spec.AccountName = testAccountNamespacedName.Name
+			mockAccManager.EXPECT().AddResourceFiltersToAccount(&testAccountNamespacedName, &testSelectorNamespacedName,
+				selector, false).Return(false, nil).Times(1)
+			err = reconciler.processCreateOrUpdate(selector, &testSelectorNamespacedName)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fakeClient.Get(context.Background(), testSelectorNamespacedName, temp)).Should(Succeed())
+			Expect(temp.Status.Error).Should(BeEmpty())
+			Expect(meta.IsStatusConditionTrue(temp.Status.Conditions, crdv1alpha1.SelectorConditionAccountFound)).Should(BeTrue())
+		})
+		It("CES reconciled on deletion of its account", func() {
+			Expect(fakeClient.Create(context.Background(), selector)).Should(Succeed())
+			mockAccManager.EXPECT().AddResourceFiltersToAccount(&testAccountNamespacedName, &testSelectorNamespacedName,
+				selector, false).Return(false, nil).Times(1)
+			err := reconciler.processCreateOrUpdate(selector, &testSelectorNamespacedName)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Account deleted")
+			account := &crdv1alpha1.CloudProviderAccount{}
+			Expect(fakeClient.Get(context.Background(), testAccountNamespacedName, account)).Should(Succeed())
+			Expect(fakeClient.Delete(context.Background(), account)).Should(Succeed())
+			requests := reconciler.getAccountSelectors(account)
+			Expect(requests).Should(Equal([]reconcile.Request{{NamespacedName: testSelectorNamespacedName}}))
+
+			reconciler.initialized = true
+			_, err = reconciler.Reconcile(context.Background(), requests[0])
+			Expect(err).Should(HaveOccurred())
+			temp := &crdv1alpha1.CloudEntitySelector{}
+			Expect(fakeClient.Get(context.Background(), testSelectorNamespacedName, temp)).Should(Succeed())
+			condition := meta.FindStatusCondition(temp.Status.Conditions, crdv1alpha1.SelectorConditionAccountFound)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(v1.ConditionFalse))
+			Expect(condition.Reason).Should(Equal(crdv1alpha1.SelectorReasonAccountNotFound))
+		})
 		It("CES Delete failure", func() {
 			err := reconciler.processDelete(&testSelectorNamespacedName)
 			Expect(err).Should(HaveOccurred())
@@ -16,18 +16,24 @@ package cloudprovideraccount
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
-	"time"
 
 	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -54,9 +60,13 @@ type CloudProviderAccountReconciler struct {
 	AccManager       accountmanager.Interface
 	pendingSyncCount int
 	initialized      bool
-	watcher          watch.Interface
 	clientset        kubernetes.Interface
 	NpController     networkpolicy.NetworkPolicyController
+
+	secretInformer      cache.SharedIndexInformer
+	secretEventsMutex   sync.Mutex
+	pendingSecretEvents map[types.NamespacedName]watch.EventType
+	secretEventsCh      chan struct{}
 }
 
 // nolint:lll
@@ -77,7 +87,7 @@ func (r *CloudProviderAccountReconciler) Reconcile(ctx context.Context, req ctrl
 
 	providerAccount := &crdv1alpha1.CloudProviderAccount{}
 	if err := r.Get(ctx, req.NamespacedName, providerAccount); err != nil {
-		if !errors.IsNotFound(err) {
+		if !apierrors.IsNotFound(err) {
 			return ctrl.Result{}, err
 		}
 		r.Log.Info("Received request", "account", req.NamespacedName, "operation", "delete")
@@ -103,9 +113,11 @@ func (r *CloudProviderAccountReconciler) SetupWithManager(mgr ctrl.Manager) erro
 	}
 
 	// Using GenerationChangedPredicate to allow CPA controller to receive CPA updates
-	// for all events except change in status.
+	// for all events except change in status. Annotation changes are also received, as plugins honor well-known
+	// account annotations.
 	if err := ctrl.NewControllerManagedBy(mgr).
-		For(&crdv1alpha1.CloudProviderAccount{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		For(&crdv1alpha1.CloudProviderAccount{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{}))).
 		Complete(r); err != nil {
 		return err
 	}
@@ -141,17 +153,99 @@ func (r *CloudProviderAccountReconciler) processCreateOrUpdate(namespacedName *t
 	account *crdv1alpha1.CloudProviderAccount) error {
 	accountCloudType, err := util.GetAccountProviderType(account)
 	if err != nil {
-		return fmt.Errorf("failed to add or update account: %v", err)
+		err = fmt.Errorf("failed to add or update account: %v", err)
+		r.updateStatus(namespacedName, err)
+		return err
+	}
+
+	// Do not let the cloud plugin default the credentials, when the Secret is absent. An account already added stops
+	// being polled until its Secret is available again.
+	if err := r.checkSecretRefs(account); err != nil {
+		r.Log.Info("Account Secret not available", "account", namespacedName, "err", err)
+		r.AccManager.InvalidateAccount(namespacedName)
+		credentialsValid := newCredentialsValidCondition(err)
+		credentialsValid.Reason = crdv1alpha1.AccountReasonSecretNotFound
+		r.updateStatus(namespacedName, err, newSecretAvailableCondition(err), credentialsValid)
+		return nil
 	}
 
 	retryAdd, err := r.AccManager.AddAccount(namespacedName, accountCloudType, account)
+	conditions := []metav1.Condition{newSecretAvailableCondition(nil)}
+	// Other errors, e.g. a cloud plugin failure, do not tell whether the credentials are valid.
+	if err == nil || isCredentialsError(err) {
+		conditions = append(conditions, newCredentialsValidCondition(err))
+	}
+	r.updateStatus(namespacedName, err, conditions...)
 	if err != nil && retryAdd {
 		return err
 	}
-	r.updateStatus(namespacedName, err)
 	return nil
 }
 
+// checkSecretRefs returns an error when none of the Secrets referenced by the account exists with the referenced key.
+func (r *CloudProviderAccountReconciler) checkSecretRefs(account *crdv1alpha1.CloudProviderAccount) error {
+	secretRefs := getAccountSecretRefs(account)
+	if len(secretRefs) == 0 {
+		return fmt.Errorf("%w, no Secret configured", util.ErrSecretReference)
+	}
+	var errs []string
+	for _, secretRef := range secretRefs {
+		secret := &v1.Secret{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name},
+			secret); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to get Secret object: %v/%v", secretRef.Namespace, secretRef.Name))
+			continue
+		}
+		if len(secret.Data[secretRef.Key]) == 0 {
+			errs = append(errs, fmt.Sprintf("failed to get Secret key: %v/%v, key: %v", secretRef.Namespace,
+				secretRef.Name, secretRef.Key))
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("%w, %v", util.ErrSecretReference, strings.Join(errs, "; "))
+}
+
+// newSecretAvailableCondition returns the SecretAvailable condition of an account given the Secret check error.
+func newSecretAvailableCondition(err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    crdv1alpha1.AccountConditionSecretAvailable,
+			Status:  metav1.ConditionFalse,
+			Reason:  crdv1alpha1.AccountReasonSecretNotFound,
+			Message: err.Error(),
+		}
+	}
+	return metav1.Condition{
+		Type:   crdv1alpha1.AccountConditionSecretAvailable,
+		Status: metav1.ConditionTrue,
+		Reason: crdv1alpha1.AccountReasonSecretFound,
+	}
+}
+
+// isCredentialsError returns true if the account add error is caused by the account credentials, as classified by
+// the account manager.
+func isCredentialsError(err error) bool {
+	return errors.Is(err, util.ErrSecretReference)
+}
+
+// newCredentialsValidCondition returns the CredentialsValid condition of an account given the account add error.
+func newCredentialsValidCondition(err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    crdv1alpha1.AccountConditionCredentialsValid,
+			Status:  metav1.ConditionFalse,
+			Reason:  crdv1alpha1.AccountReasonCredentialsRejected,
+			Message: err.Error(),
+		}
+	}
+	return metav1.Condition{
+		Type:   crdv1alpha1.AccountConditionCredentialsValid,
+		Status: metav1.ConditionTrue,
+		Reason: crdv1alpha1.AccountReasonCredentialsAccepted,
+	}
+}
+
 func (r *CloudProviderAccountReconciler) processDelete(namespacedName *types.NamespacedName) error {
 	deletedCpa := &crdv1alpha1.CloudProviderAccount{
 		ObjectMeta: metav1.ObjectMeta{Name: namespacedName.Name, Namespace: namespacedName.Namespace},
@@ -198,49 +292,47 @@ func (r *CloudProviderAccountReconciler) setSyncStatusAndSecretWatcher() {
 	}()
 }
 
-// getCpaBySecret returns nil only when the Secret is not used by any CloudProvideAccount CR,
-// otherwise the dependent CloudProvideAccount CRs will be returned.
-func (r *CloudProviderAccountReconciler) getCpaBySecret(s *types.NamespacedName) ([]*crdv1alpha1.CloudProviderAccount, error) {
-	cpaList := &crdv1alpha1.CloudProviderAccountList{}
-	if err := r.Client.List(context.TODO(), cpaList, &client.ListOptions{}); err != nil {
-		return nil, fmt.Errorf("failed to get CloudProviderAccount list, err %v", err)
-	}
-	var cpaItems []*crdv1alpha1.CloudProviderAccount
-	for i, cpa := range cpaList.Items {
-		if cpa.Spec.AWSConfig != nil {
-			if cpa.Spec.AWSConfig.SecretRef.Name == s.Name &&
-				cpa.Spec.AWSConfig.SecretRef.Namespace == s.Namespace {
-				cpaItems = append(cpaItems, &cpaList.Items[i])
-			}
-		}
-		if cpa.Spec.AzureConfig != nil {
-			if cpa.Spec.AzureConfig.SecretRef.Name == s.Name &&
-				cpa.Spec.AzureConfig.SecretRef.Namespace == s.Namespace {
-				cpaItems = append(cpaItems, &cpaList.Items[i])
-			}
-		}
+// getAccountSecretRefs returns the primary and fallback Secrets of an account, both are dependencies of the account.
+func getAccountSecretRefs(cpa *crdv1alpha1.CloudProviderAccount) []*crdv1alpha1.SecretReference {
+	var secretRefs []*crdv1alpha1.SecretReference
+	if cpa.Spec.AWSConfig != nil {
+		secretRefs = append(secretRefs, cpa.Spec.AWSConfig.GetSecretRefs()...)
+	}
+	if cpa.Spec.AzureConfig != nil {
+		secretRefs = append(secretRefs, cpa.Spec.AzureConfig.GetSecretRefs()...)
 	}
-	return cpaItems, nil
+	return secretRefs
 }
 
-// processSecretUpdateEvent updates all dependent accounts for a given Secret Namespace.
-func (r *CloudProviderAccountReconciler) processSecretUpdateEvent(secretNamespacedName *types.NamespacedName,
-	eventType watch.EventType) {
+// processSecretEvents updates all dependent accounts for a batch of Secret events. Accounts are listed once per batch
+// and each dependent account is updated once, even when several of its Secrets changed.
+func (r *CloudProviderAccountReconciler) processSecretEvents(events map[types.NamespacedName]watch.EventType) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	cpaItems, err := r.getCpaBySecret(secretNamespacedName)
-	if err != nil {
-		r.Log.WithName("Secret").Error(err, "error getting account by Secret", "Secret", secretNamespacedName)
+	cpaList := &crdv1alpha1.CloudProviderAccountList{}
+	if err := r.Client.List(context.TODO(), cpaList, &client.ListOptions{}); err != nil {
+		r.Log.WithName("Secret").Error(err, "error getting account list", "Secrets", len(events))
+		return
 	}
-
-	for _, cpa := range cpaItems {
-		accountNamespacedName := &types.NamespacedName{Namespace: cpa.Namespace, Name: cpa.Name}
-		if eventType == watch.Added {
-			// Add event is ignored, if account credentials are already valid.
-			if r.AccManager.IsAccountCredentialsValid(accountNamespacedName) {
+	for i := range cpaList.Items {
+		cpa := &cpaList.Items[i]
+		referenced, addOnly := false, true
+		for _, secretRef := range getAccountSecretRefs(cpa) {
+			eventType, found := events[types.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name}]
+			if !found {
 				continue
 			}
+			referenced = true
+			addOnly = addOnly && eventType == watch.Added
+		}
+		if !referenced {
+			continue
+		}
+		accountNamespacedName := &types.NamespacedName{Namespace: cpa.Namespace, Name: cpa.Name}
+		// Add event is ignored, if account credentials are already valid.
+		if addOnly && r.AccManager.IsAccountCredentialsValid(accountNamespacedName) {
+			continue
 		}
 		r.Log.WithName("Secret").Info("Updating account", "account", *accountNamespacedName)
 		if err := r.processCreateOrUpdate(accountNamespacedName, cpa); err != nil {
@@ -249,42 +341,78 @@ func (r *CloudProviderAccountReconciler) processSecretUpdateEvent(secretNamespac
 	}
 }
 
-// watchSecret watch the Secret objects and update dependent CPA objects.
-func (r *CloudProviderAccountReconciler) watchSecret() {
-	for {
-		event, ok := <-r.watcher.ResultChan()
-		if !ok || event.Type == watch.Error {
-			r.resetSecretWatcher()
-		} else {
-			secret := event.Object.(*v1.Secret)
-			namespacedName := &types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
-			r.Log.WithName("Secret").Info("Received request", "Secret", namespacedName, "operation", event.Type)
-			r.processSecretUpdateEvent(namespacedName, event.Type)
-		}
+// enqueueSecretEvent adds a Secret event to the pending batch. An add event does not override a pending update or
+// delete event of the same Secret.
+func (r *CloudProviderAccountReconciler) enqueueSecretEvent(obj interface{}, eventType watch.EventType) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	namespacedName := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+	r.Log.WithName("Secret").Info("Received request", "Secret", namespacedName, "operation", eventType)
+
+	r.secretEventsMutex.Lock()
+	if _, found := r.pendingSecretEvents[namespacedName]; !found || eventType != watch.Added {
+		r.pendingSecretEvents[namespacedName] = eventType
+	}
+	r.secretEventsMutex.Unlock()
+
+	select {
+	case r.secretEventsCh <- struct{}{}:
+	default:
 	}
 }
 
-// resetSecretWatcher create a watcher for Secret
-func (r *CloudProviderAccountReconciler) resetSecretWatcher() {
-	var err error
-	for {
-		if r.watcher, err = r.clientset.CoreV1().Secrets(env.GetPodNamespace()).Watch(context.Background(), metav1.ListOptions{}); err != nil {
-			r.Log.WithName("Secret").Error(err, "error creating Secret watcher")
-			time.Sleep(time.Second * 5)
-			continue
+// processSecretEventBatches processes the pending Secret events, events received while a batch is processed are
+// collected into the next batch.
+func (r *CloudProviderAccountReconciler) processSecretEventBatches() {
+	for range r.secretEventsCh {
+		r.secretEventsMutex.Lock()
+		events := r.pendingSecretEvents
+		r.pendingSecretEvents = make(map[types.NamespacedName]watch.EventType)
+		r.secretEventsMutex.Unlock()
+		if len(events) > 0 {
+			r.processSecretEvents(events)
 		}
-		break
 	}
 }
 
-// setupSecretWatcher set up a watcher for Secret objects.
+// setupSecretWatcher sets up a single shared informer for Secret objects, whose events are fanned out to the
+// dependent accounts.
 func (r *CloudProviderAccountReconciler) setupSecretWatcher() {
-	r.resetSecretWatcher()
-	r.watchSecret()
+	r.pendingSecretEvents = make(map[types.NamespacedName]watch.EventType)
+	r.secretEventsCh = make(chan struct{}, 1)
+	factory := informers.NewSharedInformerFactoryWithOptions(r.clientset, 0, informers.WithNamespace(env.GetPodNamespace()))
+	r.secretInformer = factory.Core().V1().Secrets().Informer()
+	if _, err := r.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.enqueueSecretEvent(obj, watch.Added)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, newSecret := oldObj.(*v1.Secret), newObj.(*v1.Secret)
+			// credentials are only carried in Secret data, ignore metadata only updates.
+			if reflect.DeepEqual(oldSecret.Data, newSecret.Data) && reflect.DeepEqual(oldSecret.StringData, newSecret.StringData) {
+				return
+			}
+			r.enqueueSecretEvent(newObj, watch.Modified)
+		},
+		DeleteFunc: func(obj interface{}) {
+			r.enqueueSecretEvent(obj, watch.Deleted)
+		},
+	}); err != nil {
+		r.Log.WithName("Secret").Error(err, "error creating Secret watcher")
+		return
+	}
+	go r.processSecretEventBatches()
+	r.secretInformer.Run(wait.NeverStop)
 }
 
-// updateStatus udpates the status on the CloudProviderAccount CR.
-func (r *CloudProviderAccountReconciler) updateStatus(namespacedName *types.NamespacedName, err error) {
+// updateStatus udpates the error and the conditions owned by the reconciler on the CloudProviderAccount CR.
+func (r *CloudProviderAccountReconciler) updateStatus(namespacedName *types.NamespacedName, err error,
+	conditions ...metav1.Condition) {
 	var errorMsg string
 	if err != nil {
 		errorMsg = err.Error()
@@ -295,9 +423,20 @@ func (r *CloudProviderAccountReconciler) updateStatus(namespacedName *types.Name
 		if err = r.Get(context.TODO(), *namespacedName, account); err != nil {
 			return nil
 		}
-		if account.Status.Error != errorMsg {
+		conditionChanged := false
+		for _, condition := range conditions {
+			current := meta.FindStatusCondition(account.Status.Conditions, condition.Type)
+			if current == nil || current.Status != condition.Status || current.Reason != condition.Reason ||
+				current.Message != condition.Message {
+				conditionChanged = true
+			}
+		}
+		if account.Status.Error != errorMsg || conditionChanged {
 			r.Log.Info("Setting CPA status", "account", namespacedName, "message", errorMsg)
 			account.Status.Error = errorMsg
+			for _, condition := range conditions {
+				meta.SetStatusCondition(&account.Status.Conditions, condition)
+			}
 			if err = r.Client.Status().Update(context.TODO(), account); err != nil {
 				r.Log.Error(err, "failed to update CPA status, retrying", "account", namespacedName)
 				return err
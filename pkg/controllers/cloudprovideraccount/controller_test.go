@@ -26,6 +26,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -151,6 +152,7 @@ var _ = Describe("CloudProviderAccount Controller", func() {
 				ObjectMeta: v1.ObjectMeta{Name: testAccountNamespacedName.Name, Namespace: testAccountNamespacedName.Namespace},
 			}
 			mockNpController.EXPECT().LocalEvent(watch.Event{Type: watch.Deleted, Object: deletedCpa}).Times(1)
+			_ = fakeClient.Create(context.Background(), secret)
 			err = reconciler.processCreateOrUpdate(&testAccountNamespacedName, account)
 			Expect(err).ShouldNot(HaveOccurred())
 
@@ -176,6 +178,94 @@ var _ = Describe("CloudProviderAccount Controller", func() {
 			err = reconciler.processDelete(&testAccountNamespacedName)
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		It("Account add with missing Secret", func() {
+			_ = fakeClient.Create(context.Background(), account)
+			mockAccManager.EXPECT().InvalidateAccount(&testAccountNamespacedName).Times(1)
+			err := reconciler.processCreateOrUpdate(&testAccountNamespacedName, account)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			cpa := &v1alpha1.CloudProviderAccount{}
+			err = fakeClient.Get(context.Background(), testAccountNamespacedName, cpa)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(cpa.Status.Error).Should(ContainSubstring(util.ErrorMsgSecretReference))
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, v1alpha1.AccountConditionSecretAvailable)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(v1.ConditionFalse))
+			Expect(condition.Reason).Should(Equal(v1alpha1.AccountReasonSecretNotFound))
+			Expect(condition.Message).Should(ContainSubstring(testSecretNamespacedName.String()))
+			condition = meta.FindStatusCondition(cpa.Status.Conditions, v1alpha1.AccountConditionCredentialsValid)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(v1.ConditionFalse))
+			Expect(condition.Reason).Should(Equal(v1alpha1.AccountReasonSecretNotFound))
+
+			By("Add the Secret")
+			accountCloudType, err := util.GetAccountProviderType(account)
+			Expect(err).ShouldNot(HaveOccurred())
+			mockAccManager.EXPECT().AddAccount(&testAccountNamespacedName, accountCloudType, account).Return(false, nil).Times(1)
+			_ = fakeClient.Create(context.Background(), secret)
+			err = reconciler.processCreateOrUpdate(&testAccountNamespacedName, account)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = fakeClient.Get(context.Background(), testAccountNamespacedName, cpa)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(cpa.Status.Error).Should(BeEmpty())
+			Expect(meta.IsStatusConditionTrue(cpa.Status.Conditions, v1alpha1.AccountConditionSecretAvailable)).Should(BeTrue())
+			Expect(meta.IsStatusConditionTrue(cpa.Status.Conditions, v1alpha1.AccountConditionCredentialsValid)).Should(BeTrue())
+
+			By("Delete the Secret")
+			mockAccManager.EXPECT().InvalidateAccount(&testAccountNamespacedName).Times(1)
+			_ = fakeClient.Delete(context.Background(), secret)
+			err = reconciler.processCreateOrUpdate(&testAccountNamespacedName, account)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = fakeClient.Get(context.Background(), testAccountNamespacedName, cpa)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(cpa.Status.Error).Should(ContainSubstring(util.ErrorMsgSecretReference))
+			Expect(meta.IsStatusConditionFalse(cpa.Status.Conditions, v1alpha1.AccountConditionSecretAvailable)).Should(BeTrue())
+			Expect(meta.IsStatusConditionFalse(cpa.Status.Conditions, v1alpha1.AccountConditionCredentialsValid)).Should(BeTrue())
+		})
+		It("Account add with invalid credentials", func() {
+			_ = fakeClient.Create(context.Background(), account)
+			_ = fakeClient.Create(context.Background(), secret)
+			accountCloudType, err := util.GetAccountProviderType(account)
+			Expect(err).ShouldNot(HaveOccurred())
+			By("Fail the account add for another reason")
+			mockAccManager.EXPECT().AddAccount(&testAccountNamespacedName, accountCloudType, account).
+				Return(false, fmt.Errorf("plugin failure")).Times(1)
+			err = reconciler.processCreateOrUpdate(&testAccountNamespacedName, account)
+			Expect(err).ShouldNot(HaveOccurred())
+			cpa := &v1alpha1.CloudProviderAccount{}
+			err = fakeClient.Get(context.Background(), testAccountNamespacedName, cpa)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(cpa.Status.Error).Should(Equal("plugin failure"))
+			Expect(meta.FindStatusCondition(cpa.Status.Conditions, v1alpha1.AccountConditionCredentialsValid)).Should(BeNil())
+
+			By("Reject the credentials")
+			invalidCredentialsErr := fmt.Errorf("%w, failed to decode Secret key: %v/%v", util.ErrSecretReference,
+				secret.Namespace, secret.Name)
+			mockAccManager.EXPECT().AddAccount(&testAccountNamespacedName, accountCloudType, account).
+				Return(false, invalidCredentialsErr).Times(1)
+			err = reconciler.processCreateOrUpdate(&testAccountNamespacedName, account)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = fakeClient.Get(context.Background(), testAccountNamespacedName, cpa)
+			Expect(err).ShouldNot(HaveOccurred())
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, v1alpha1.AccountConditionCredentialsValid)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(v1.ConditionFalse))
+			Expect(condition.Reason).Should(Equal(v1alpha1.AccountReasonCredentialsRejected))
+			Expect(condition.Message).Should(Equal(invalidCredentialsErr.Error()))
+
+			By("Fix the credentials")
+			mockAccManager.EXPECT().AddAccount(&testAccountNamespacedName, accountCloudType, account).Return(false, nil).Times(1)
+			err = reconciler.processCreateOrUpdate(&testAccountNamespacedName, account)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = fakeClient.Get(context.Background(), testAccountNamespacedName, cpa)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(cpa.Status.Error).Should(BeEmpty())
+			condition = meta.FindStatusCondition(cpa.Status.Conditions, v1alpha1.AccountConditionCredentialsValid)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(v1.ConditionTrue))
+			Expect(condition.Reason).Should(Equal(v1alpha1.AccountReasonCredentialsAccepted))
+		})
 		It("CloudProviderAccount set pending sync count to 2", func() {
 			ctrlsync.GetControllerSyncStatusInstance().Configure()
 			ctrlsync.GetControllerSyncStatusInstance().ResetControllerSyncStatus(ctrlsync.ControllerTypeCPA)
@@ -263,8 +353,10 @@ var _ = Describe("CloudProviderAccount Controller", func() {
 
 			})
 			It("Delete", func() {
-				mockAccManager.EXPECT().AddAccount(&testAccountNamespacedName, accountCloudType, account).
-					Return(false, fmt.Errorf(util.ErrorMsgSecretReference)).Times(1)
+				// AddAccount is not invoked once the Secret is deleted, the account is invalidated and a SecretAvailable
+				// condition is set instead.
+				mockAccManager.EXPECT().AddAccount(&testAccountNamespacedName, accountCloudType, account).Times(0)
+				mockAccManager.EXPECT().InvalidateAccount(&testAccountNamespacedName).Times(1)
 				mockAccManager.EXPECT().IsAccountCredentialsValid(&testAccountNamespacedName).Return(true).Times(1)
 				By("Add the Secret")
 				_ = fakeClient.Create(context.Background(), secret)
@@ -282,6 +374,46 @@ var _ = Describe("CloudProviderAccount Controller", func() {
 					Delete(context.Background(), testSecretNamespacedName.Name, v1.DeleteOptions{})
 				time.Sleep(1 * time.Second)
 				Expect(err).ShouldNot(HaveOccurred())
+				cpa := &v1alpha1.CloudProviderAccount{}
+				err = fakeClient.Get(context.Background(), testAccountNamespacedName, cpa)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(meta.IsStatusConditionFalse(cpa.Status.Conditions, v1alpha1.AccountConditionSecretAvailable)).Should(BeTrue())
+			})
+			It("Update Secret referenced by two accounts", func() {
+				testAccount02NamespacedName := types.NamespacedName{Namespace: "namespace01", Name: "account02"}
+				account02 := account.DeepCopy()
+				account02.Name = testAccount02NamespacedName.Name
+				mockAccManager.EXPECT().IsAccountCredentialsValid(&testAccountNamespacedName).Return(true).Times(1)
+				mockAccManager.EXPECT().IsAccountCredentialsValid(&testAccount02NamespacedName).Return(true).Times(1)
+
+				By("Add the Secret")
+				_ = fakeClient.Create(context.Background(), secret)
+				// Create CPAs sharing the Secret.
+				_ = fakeClient.Create(context.Background(), account)
+				_ = fakeClient.Create(context.Background(), account02)
+				mockAccManager.EXPECT().AddAccount(&testAccountNamespacedName, accountCloudType, account).Return(false, nil).Times(1)
+				mockAccManager.EXPECT().AddAccount(&testAccount02NamespacedName, accountCloudType, account02).Return(false, nil).Times(1)
+				time.Sleep(1 * time.Second)
+				_, err = reconciler.clientset.CoreV1().Secrets(testSecretNamespacedName.Namespace).
+					Create(context.Background(), secret, v1.CreateOptions{})
+				time.Sleep(1 * time.Second)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Update the Secret")
+				credential := `{"accessKeyId": "keyId","accessKeySecret": "Secret"}`
+				secret = &corev1.Secret{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      testSecretNamespacedName.Name,
+						Namespace: testSecretNamespacedName.Namespace,
+					},
+					Data: map[string][]byte{
+						credentials: []byte(credential),
+					},
+				}
+				_, err = reconciler.clientset.CoreV1().Secrets(testSecretNamespacedName.Namespace).
+					Update(context.Background(), secret, v1.UpdateOptions{})
+				time.Sleep(1 * time.Second)
+				Expect(err).ShouldNot(HaveOccurred())
 			})
 			It("Add for AzureAccount", func() {
 				mockAccManager.EXPECT().IsAccountCredentialsValid(&testAccountNamespacedName).Return(true).Times(1)
@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -36,10 +38,13 @@ import (
 	antreav1alpha2 "antrea.io/antrea/pkg/apis/crd/v1alpha2"
 	antreanetworkingclient "antrea.io/antrea/pkg/client/clientset/versioned/typed/controlplane/v1beta2"
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
+	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
+	"antrea.io/nephe/pkg/cloudprovider/cloud"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/securitygroup"
 	"antrea.io/nephe/pkg/config"
 	"antrea.io/nephe/pkg/controllers/sync"
+	"antrea.io/nephe/pkg/converter/target"
 	"antrea.io/nephe/pkg/inventory"
 )
 
@@ -57,6 +62,12 @@ const (
 	retryCount = 3
 
 	cloudResponseChBuffer = 50
+	vmAddedChBuffer       = 50
+	sgChangedChBuffer     = 50
+
+	// sgChangeDebounce is how long security groups changed in cloud are accumulated before they are synchronized, so
+	// that a burst of change notifications, e.g. those of Nephe's own writes to a security group, costs one sync.
+	sgChangeDebounce = time.Second * 10
 
 	// NetworkPolicy controller is ready to sync after it receives bookmarks from
 	// networkpolicy, addressGroup and appliedToGroup.
@@ -114,6 +125,31 @@ type NetworkPolicyReconciler struct {
 
 	// localRequest sends and receives network policy requests from local stack.
 	localRequest chan watch.Event
+
+	// cloudSyncRequest receives requests to synchronize security groups with cloud out of the sync interval.
+	cloudSyncRequest chan struct{}
+
+	// accountRulesUpdateRequest receives requests to update the rules of the appliedTo security groups of the accounts
+	// in pendingAccountRulesUpdates.
+	accountRulesUpdateRequest chan struct{}
+	// pendingAccountRulesUpdates holds the accounts whose options changing how security groups are enforced changed.
+	pendingAccountRulesUpdates      map[types.NamespacedName]struct{}
+	pendingAccountRulesUpdatesMutex gosync.Mutex
+
+	// ReconcileMembershipOnInventoryChange enables reconciling membership of groups waiting on a VM as soon as the
+	// VM is added to inventory.
+	ReconcileMembershipOnInventoryChange bool
+
+	// vmAdded receives VMs newly added to inventory.
+	vmAdded chan types.NamespacedName
+
+	// sgChanged receives cloud IDs of security groups changed in cloud, as reported by cloud change notifications.
+	sgChanged chan string
+	// pendingSgChanges holds the lower case cloud IDs of security groups changed in cloud and not yet synchronized.
+	pendingSgChanges map[string]struct{}
+	// cloudIDToSGs holds the security groups held by every cloud security group in the last cloud view, keyed by the
+	// lower case cloud ID, so that security groups of a cloud security group deleted in cloud are known.
+	cloudIDToSGs map[string][]cloudSecurityGroupKey
 }
 
 // isNetworkPolicySupported check if network policy is supported.
@@ -126,8 +162,11 @@ func (r *NetworkPolicyReconciler) isNetworkPolicySupported(anp *antreanetworking
 	}
 	// Check for support actions.
 	for _, rule := range anp.Rules {
+		if isPassRule(&rule) {
+			continue
+		}
 		if rule.Action != nil && *rule.Action != antreav1alpha1.RuleActionAllow {
-			return fmt.Errorf("only Allow action is supported in antrea network policy")
+			return fmt.Errorf("only Allow and Pass actions are supported in antrea network policy")
 		}
 		// check for supported protocol.
 		for _, s := range rule.Services {
@@ -140,6 +179,32 @@ func (r *NetworkPolicyReconciler) isNetworkPolicySupported(anp *antreanetworking
 	return nil
 }
 
+// isPassRule returns true if rule has Pass action.
+func isPassRule(rule *antreanetworking.NetworkPolicyRule) bool {
+	return rule.Action != nil && *rule.Action == antreav1alpha1.RuleActionPass
+}
+
+// removePassRules removes rules with Pass action from anp. Pass defers the decision to lower tiers, which has no
+// cloud equivalent. Cloud security groups only allow traffic, so skipping Pass rules leaves the traffic to the
+// Allow rules of other policies, same as the lower tiers would. Rules are removed before cloud rules are computed
+// so that they take no priority. It returns true if all rules of anp had Pass action.
+func (r *NetworkPolicyReconciler) removePassRules(anp *antreanetworking.NetworkPolicy) bool {
+	if len(anp.Rules) == 0 {
+		return false
+	}
+	rules := make([]antreanetworking.NetworkPolicyRule, 0, len(anp.Rules))
+	for _, rule := range anp.Rules {
+		if isPassRule(&rule) {
+			r.Log.Info("Skipping NetworkPolicy rule with Pass action", "Name", anp.Name, "Namespace", anp.Namespace,
+				"rule", rule.Name)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	anp.Rules = rules
+	return len(rules) == 0
+}
+
 // updateRuleRealizationStatus checks rule realization status on all appliedTo groups for a np and send status.
 func (r *NetworkPolicyReconciler) updateRuleRealizationStatus(currentSgID string, np *networkPolicy, err error) {
 	if err != nil {
@@ -393,6 +458,131 @@ func (r *NetworkPolicyReconciler) processAppliedToGroup(event watch.Event) error
 	return r.processGroup(getNormalizedName(accessor.GetName()), event.Type, false, added, removed)
 }
 
+// registerCloudSyncHooks requests a cloud sync whenever account credentials are rotated, so that security groups
+// which drifted while the old credentials were in use are corrected, whenever vpcs of an account are deleted from
+// cloud, so that their security groups are recreated or removed, and whenever a paused account is resumed. Rules of
+// the appliedTo security groups of an account are updated again whenever its security options change.
+func (r *NetworkPolicyReconciler) registerCloudSyncHooks() {
+	for _, providerType := range cloud.GetSupportedCloudProviderTypes() {
+		cloudInterface, err := cloud.GetCloudInterface(providerType)
+		if err != nil {
+			continue
+		}
+		cloudInterface.SetCredentialRotationHook(r.requestCloudSync)
+		cloudInterface.SetVpcDeletedHook(r.requestCloudSync)
+		cloudInterface.SetAccountResumedHook(r.requestCloudSync)
+		cloudInterface.SetSecurityOptionsChangedHook(r.requestAccountRulesUpdate)
+	}
+}
+
+// requestAccountRulesUpdate requests the rules of the appliedTo security groups of the account to be updated again, so
+// that they are enforced with its changed security options.
+func (r *NetworkPolicyReconciler) requestAccountRulesUpdate(accountNamespacedName *types.NamespacedName) {
+	r.pendingAccountRulesUpdatesMutex.Lock()
+	if r.pendingAccountRulesUpdates == nil {
+		r.pendingAccountRulesUpdates = make(map[types.NamespacedName]struct{})
+	}
+	r.pendingAccountRulesUpdates[*accountNamespacedName] = struct{}{}
+	r.pendingAccountRulesUpdatesMutex.Unlock()
+	select {
+	case r.accountRulesUpdateRequest <- struct{}{}:
+		r.Log.V(1).Info("Requested rules update", "account", accountNamespacedName)
+	default:
+	}
+}
+
+// updateAccountRules updates the rules of the appliedTo security groups of the accounts pending a rules update.
+func (r *NetworkPolicyReconciler) updateAccountRules() {
+	r.pendingAccountRulesUpdatesMutex.Lock()
+	accounts := r.pendingAccountRulesUpdates
+	r.pendingAccountRulesUpdates = nil
+	r.pendingAccountRulesUpdatesMutex.Unlock()
+
+	accountIDs := make(map[string]struct{}, len(accounts))
+	for account := range accounts {
+		accountIDs[account.String()] = struct{}{}
+	}
+	for _, obj := range r.appliedToSGIndexer.List() {
+		sg := obj.(*appliedToSecurityGroup)
+		if _, ok := accountIDs[sg.id.AccountID]; !ok {
+			continue
+		}
+		r.Log.V(1).Info("Updating rules on security options change", "appliedToGroup", sg.id.Name)
+		sg.reapplyRules(r)
+	}
+}
+
+// requestCloudSync requests a sync with cloud, a request already pending is not duplicated.
+func (r *NetworkPolicyReconciler) requestCloudSync(accountNamespacedName *types.NamespacedName) {
+	select {
+	case r.cloudSyncRequest <- struct{}{}:
+		r.Log.V(1).Info("Requested sync with cloud", "account", accountNamespacedName)
+	default:
+	}
+}
+
+// RequestSecurityGroupReconcile requests a sync with cloud of the security groups held by the cloud security group of
+// cloudID, which is changed in cloud. A full sync with cloud is requested instead if too many requests are pending.
+func (r *NetworkPolicyReconciler) RequestSecurityGroupReconcile(cloudID string) {
+	select {
+	case r.sgChanged <- cloudID:
+	default:
+		r.Log.V(1).Info("Dropped security group reconcile request", "cloudID", cloudID)
+		r.requestCloudSync(nil)
+	}
+}
+
+// drainSecurityGroupChanges adds the lower case cloud IDs of cloudID and of all queued security group changes to the
+// pending security group changes.
+func (r *NetworkPolicyReconciler) drainSecurityGroupChanges(cloudID string) {
+	if r.pendingSgChanges == nil {
+		r.pendingSgChanges = make(map[string]struct{})
+	}
+	r.pendingSgChanges[strings.ToLower(cloudID)] = struct{}{}
+	for {
+		select {
+		case cloudID := <-r.sgChanged:
+			r.pendingSgChanges[strings.ToLower(cloudID)] = struct{}{}
+		default:
+			return
+		}
+	}
+}
+
+// syncSecurityGroupChanges synchronizes the pending security group changes with cloud. Changes received before the
+// first sync with cloud are synchronized by it.
+func (r *NetworkPolicyReconciler) syncSecurityGroupChanges() {
+	cloudIDs := r.pendingSgChanges
+	r.pendingSgChanges = nil
+	if len(cloudIDs) == 0 || !r.syncedWithCloud {
+		return
+	}
+	r.Log.Info("Synchronizing security groups with cloud on change notification", "cloudIDs", len(cloudIDs))
+	r.syncSecurityGroupsWithCloud(cloudIDs)
+}
+
+// requestMembershipReconcile requests membership reconciliation of groups waiting on a VM newly added to inventory.
+// Request is dropped if too many are pending, such groups are still reconciled on the next retry.
+func (r *NetworkPolicyReconciler) requestMembershipReconcile(vm *runtimev1alpha1.VirtualMachine) {
+	select {
+	case r.vmAdded <- types.NamespacedName{Namespace: vm.Namespace, Name: vm.Name}:
+	default:
+		r.Log.V(1).Info("Dropped membership reconcile request", "vm", vm.Name)
+	}
+}
+
+// reconcileMembershipOnVmAdd retries pending groups waiting to add the ExternalEntity of a VM newly added to inventory.
+func (r *NetworkPolicyReconciler) reconcileMembershipOnVmAdd(vmNamespacedName types.NamespacedName) {
+	eeNamespacedName := types.NamespacedName{
+		Namespace: vmNamespacedName.Namespace,
+		Name:      target.GetExternalEntityLabelKind(&runtimev1alpha1.VirtualMachine{}) + "-" + vmNamespacedName.Name,
+	}
+	for _, id := range r.retryQueue.getPendingGroupsWithMember(eeNamespacedName.String()) {
+		r.Log.V(1).Info("Reconcile group membership on vm add", "group", id, "vm", vmNamespacedName)
+		r.retryQueue.RunItem(id)
+	}
+}
+
 // processNetworkPolicy processes NetworkPolicy updates from Antrea controller.
 func (r *NetworkPolicyReconciler) processNetworkPolicy(event watch.Event) error {
 	anp, ok := event.Object.(*antreanetworking.NetworkPolicy)
@@ -418,6 +608,14 @@ func (r *NetworkPolicyReconciler) processNetworkPolicy(event watch.Event) error
 		anp.Name = anp.SourceRef.Name
 		anp.Namespace = anp.SourceRef.Namespace
 	}
+	if onlyPass := r.removePassRules(anp); onlyPass && event.Type != watch.Deleted {
+		// without rules, the appliedTo VMs would be attached to security groups denying all of their traffic, while
+		// Pass leaves it to the lower tiers. The policy is not realized, and removed if realized before.
+		r.Log.Info("Skipping realization of NetworkPolicy with only Pass rules", "Name", anp.Name,
+			"Namespace", anp.Namespace)
+		event.Type = watch.Deleted
+		r.sendRuleRealizationStatus(anp, nil)
+	}
 	r.normalizedANPObject(anp)
 
 	var np *networkPolicy
@@ -495,6 +693,8 @@ func (r *NetworkPolicyReconciler) Start(stop context.Context) error {
 
 	r.Log.Info("Re-sync finished, listening to new events")
 	ticker := time.NewTicker(time.Second)
+	// sgChangeTimer fires once the pending security group changes are debounced, it is nil when none are pending.
+	var sgChangeTimer <-chan time.Time
 	for {
 		var err error
 		select {
@@ -537,6 +737,22 @@ func (r *NetworkPolicyReconciler) Start(stop context.Context) error {
 				return nil
 			}
 			err = r.processLocalEvent(event)
+		case <-r.cloudSyncRequest:
+			r.Log.Info("Synchronizing security groups with cloud on request")
+			r.syncWithCloud(true)
+		case <-r.accountRulesUpdateRequest:
+			r.Log.Info("Updating rules of security groups on security options change")
+			r.updateAccountRules()
+		case vmNamespacedName := <-r.vmAdded:
+			r.reconcileMembershipOnVmAdd(vmNamespacedName)
+		case cloudID := <-r.sgChanged:
+			r.drainSecurityGroupChanges(cloudID)
+			if sgChangeTimer == nil {
+				sgChangeTimer = time.After(sgChangeDebounce)
+			}
+		case <-sgChangeTimer:
+			sgChangeTimer = nil
+			r.syncSecurityGroupChanges()
 		case <-ticker.C:
 			r.backgroupProcess()
 			r.retryQueue.CheckToRun(false)
@@ -710,10 +926,11 @@ func (r *NetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		})
 	// cloudRuleIndexer stores the realized rules on the cloud.
 	r.cloudRuleIndexer = cache.NewIndexer(
-		// Each cloudRule is uniquely identified by its hash.
+		// Each cloudRule is uniquely identified by its appliedToSecurityGroup and hash, the hash only covers the
+		// semantic fields of the rule which may be identical across appliedToSecurityGroups.
 		func(obj interface{}) (string, error) {
 			rule := obj.(*cloudresource.CloudRule)
-			return rule.Hash, nil
+			return rule.AppliedToGrp + "/" + rule.Hash, nil
 		},
 		// cloudRules indexed by appliedToSecurityGroup.
 		cache.Indexers{
@@ -723,6 +940,14 @@ func (r *NetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			},
 		})
 	r.localRequest = make(chan watch.Event)
+	r.cloudSyncRequest = make(chan struct{}, 1)
+	r.accountRulesUpdateRequest = make(chan struct{}, 1)
+	r.registerCloudSyncHooks()
+	r.vmAdded = make(chan types.NamespacedName, vmAddedChBuffer)
+	r.sgChanged = make(chan string, sgChangedChBuffer)
+	if r.ReconcileMembershipOnInventoryChange {
+		r.Inventory.AddVmAddHandler(r.requestMembershipReconcile)
+	}
 	r.cloudResponse = make(chan *securityGroupStatus, cloudResponseChBuffer)
 	r.pendingDeleteGroups = NewPendingItemQueue(r, nil)
 	retryCnt := retryCount
@@ -127,6 +127,30 @@ var _ = Describe("NetworkPolicy", func() {
 		mockInventory = inventory.NewMockInterface(mockCtrl)
 		mockCloudSecurityAPI = cloudtest.NewMockCloudSecurityGroupInterface(mockCtrl)
 		securitygroup.CloudSecurityGroup = mockCloudSecurityAPI
+		// batched rule updates are expected as the rule updates of each of their appliedTo groups.
+		mockCloudSecurityAPI.EXPECT().UpdateSecurityGroupRulesBatch(mock.Any()).AnyTimes().DoAndReturn(
+			func(updates []cloudresource.GroupRuleUpdate) <-chan error {
+				ch := make(chan error)
+				go func() {
+					defer close(ch)
+					batchErr := &cloudresource.GroupRuleUpdateBatchError{Failed: make(map[cloudresource.CloudResource]error)}
+					for _, update := range updates {
+						err := <-mockCloudSecurityAPI.UpdateSecurityGroupRules(update.AppliedToGroup, update.AddRules,
+							update.RmRules)
+						if err != nil {
+							batchErr.Failed[*update.AppliedToGroup] = err
+							continue
+						}
+						batchErr.Succeeded = append(batchErr.Succeeded, *update.AppliedToGroup)
+					}
+					if len(batchErr.Failed) > 0 {
+						ch <- batchErr
+						return
+					}
+					ch <- nil
+				}()
+				return ch
+			})
 		reconciler = &NetworkPolicyReconciler{
 			Log:             logf.Log,
 			Client:          mockClient,
@@ -954,6 +978,43 @@ var _ = Describe("NetworkPolicy", func() {
 		Expect(err).To(HaveOccurred())
 	})
 
+	It("Verify networkPolicy pass action rules are skipped", func() {
+		passAction := v1alpha1.RuleActionPass
+		protocol := antreanetworking.ProtocolICMP
+		passRule := antreanetworking.NetworkPolicyRule{
+			Direction: antreanetworking.DirectionIn,
+			Action:    &passAction,
+			// protocol not supported on Allow rules is ignored on skipped Pass rules.
+			Services: []antreanetworking.Service{{Protocol: &protocol}},
+		}
+		allowRules := append([]antreanetworking.NetworkPolicyRule{}, anp.Rules...)
+		anp.Rules = append([]antreanetworking.NetworkPolicyRule{passRule}, anp.Rules...)
+		event := watch.Event{Type: watch.Added, Object: anp}
+		err := reconciler.processNetworkPolicy(event)
+		Expect(err).ToNot(HaveOccurred())
+
+		obj, found, _ := reconciler.networkPolicyIndexer.GetByKey(
+			types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}.String())
+		Expect(found).To(BeTrue())
+		np := obj.(*networkPolicy)
+		Expect(np.Rules).To(HaveLen(len(allowRules)))
+		for _, rule := range np.Rules {
+			Expect(isPassRule(&rule)).To(BeFalse())
+		}
+	})
+
+	It("Verify networkPolicy with only pass action rules is not realized", func() {
+		passAction := v1alpha1.RuleActionPass
+		anp.Rules = []antreanetworking.NetworkPolicyRule{{Direction: antreanetworking.DirectionIn, Action: &passAction}}
+		event := watch.Event{Type: watch.Added, Object: anp}
+		err := reconciler.processNetworkPolicy(event)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, found, _ := reconciler.networkPolicyIndexer.GetByKey(
+			types.NamespacedName{Name: anp.Name, Namespace: anp.Namespace}.String())
+		Expect(found).To(BeFalse())
+	})
+
 	It("Verify unsupported networkPolicy protocol", func() {
 		anpTemp := anp
 		inRule := antreanetworking.NetworkPolicyRule{Direction: antreanetworking.DirectionIn}
@@ -1124,6 +1185,39 @@ var _ = Describe("NetworkPolicy", func() {
 		Expect(len(reconciler.pendingDeleteGroups.items)).To(BeZero())
 	})
 
+	It("Reconcile pending group membership on inventory vm add", func() {
+		reconciler.ReconcileMembershipOnInventoryChange = true
+		mockInventory.EXPECT().AddVmAddHandler(mock.Any()).Times(1)
+		err := reconciler.SetupWithManager(nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		ee := vmExternalEntities[vmNames[0]]
+		ag := &antreanetworking.AddressGroup{}
+		ag.Name = addrGrpNames[0]
+		ag.GroupMembers = []antreanetworking.GroupMember{
+			{ExternalEntity: &antreanetworking.ExternalEntityReference{Name: ee.Name, Namespace: ee.Namespace}},
+		}
+
+		By("AddressGroup member not yet discovered")
+		mockClient.EXPECT().Get(mock.Any(), client.ObjectKey{Name: ee.Name, Namespace: ee.Namespace}, mock.Any()).
+			Return(errors.NewNotFound(schema.GroupResource{}, ee.Name)).Times(1)
+		err = reconciler.processAddressGroup(watch.Event{Type: watch.Added, Object: ag})
+		Expect(err).To(HaveOccurred())
+		uGroupName := getGroupUniqueName(ag.Name, true)
+		Expect(reconciler.retryQueue.Has(uGroupName)).To(BeTrue())
+
+		By("Inventory adds the vm owning the AddressGroup member")
+		checkAddrGroup(ag)
+		// ExternalEntity is named after the VirtualMachine.
+		vm := &runtimev1alpha1.VirtualMachine{}
+		vm.Namespace = ee.Namespace
+		vm.Name = strings.TrimPrefix(ee.Name, "virtualmachine-")
+		reconciler.requestMembershipReconcile(vm)
+		reconciler.reconcileMembershipOnVmAdd(<-reconciler.vmAdded)
+		wait()
+		Expect(reconciler.retryQueue.Has(uGroupName)).To(BeFalse())
+	})
+
 	var (
 		opSgConfig = map[string][]securityGroupConfig{
 			"K8sGet": {
@@ -1415,4 +1509,192 @@ var _ = Describe("NetworkPolicy", func() {
 		Entry("Cloud has mismatch security group rule", cloudReturnDiffRuleSG),
 		Entry("Cloud has extra security group", cloudReturnExtraSG),
 	)
+
+	It("Should realize and remove return rules of stateless rule enforcement", func() {
+		cloudresource.SetStatelessRuleEnforcement(true)
+		defer cloudresource.SetStatelessRuleEnforcement(false)
+
+		grpID := &cloudresource.CloudResource{
+			Type:            cloudresource.CloudResourceTypeVM,
+			CloudResourceID: *appliedToGrpIDs[appliedToGrpsNames[0]],
+			AccountID:       accountID,
+		}
+		state := securityGroupStateCreated
+		sg := newAppliedToSecurityGroup(grpID, []*cloudresource.CloudResource{}, &state).(*appliedToSecurityGroup)
+		np := &networkPolicy{NetworkPolicy: *anp, rulesReady: true}
+		for _, rule := range ingressRule {
+			ruleCopy := deepcopy.Copy(rule).(*cloudresource.IngressRule)
+			ruleCopy.AppliedToGroup = map[string]struct{}{grpID.Name: {}}
+			np.ingressRules = append(np.ingressRules, ruleCopy)
+		}
+		Expect(reconciler.networkPolicyIndexer.Add(np)).To(Succeed())
+
+		By("Return rules are computed along with the policy rules")
+		addRules, rmRules, err := sg.computeCloudRulesFromNp(reconciler, np)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rmRules).To(BeEmpty())
+		addIngress, addEgress := utils.SplitCloudRulesByDirection(addRules)
+		Expect(addIngress).To(HaveLen(len(ingressRule)))
+		Expect(addEgress).To(HaveLen(len(ingressRule)))
+		for _, rule := range addEgress {
+			Expect(rule.Generated).To(BeTrue())
+			Expect(rule.NpNamespacedName).To(Equal(np.getNamespacedName()))
+		}
+		// rules are indexed once updated in cloud.
+		for _, rule := range addRules {
+			Expect(reconciler.cloudRuleIndexer.Update(rule)).To(Succeed())
+		}
+		Expect(sg.checkRealization(reconciler, np)).To(Succeed())
+
+		By("Return rules reported by cloud are in sync")
+		syncContent := &cloudresource.SynchronizationContent{Resource: *grpID}
+		for _, rule := range addRules {
+			// rules reported by cloud are not marked as generated.
+			cloudRule := cloudresource.CloudRule{
+				Rule:             deepcopy.Copy(rule.Rule).(cloudresource.Rule),
+				NpNamespacedName: rule.NpNamespacedName,
+				AppliedToGrp:     rule.AppliedToGrp,
+			}
+			cloudRule.Hash = cloudRule.GetHash()
+			if _, ok := cloudRule.Rule.(*cloudresource.IngressRule); ok {
+				syncContent.IngressRules = append(syncContent.IngressRules, cloudRule)
+			} else {
+				syncContent.EgressRules = append(syncContent.EgressRules, cloudRule)
+			}
+		}
+		sg.sync(syncContent, reconciler)
+		// rules are only marked ready when cloud and controller rules match.
+		Expect(sg.ruleReady).To(BeTrue())
+		addRules, rmRules, err = sg.computeCloudRulesFromNp(reconciler, np)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addRules).To(BeEmpty())
+		Expect(rmRules).To(BeEmpty())
+
+		By("Removed rules are removed along with their return rules only")
+		np.ingressRules = np.ingressRules[:1]
+		addRules, rmRules, err = sg.computeCloudRulesFromNp(reconciler, np)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addRules).To(BeEmpty())
+		rmIngress, rmEgress := utils.SplitCloudRulesByDirection(rmRules)
+		Expect(rmIngress).To(HaveLen(1))
+		Expect(rmIngress[0].Rule.(*cloudresource.IngressRule).FromSecurityGroups).To(Equal(ingressRule[1].FromSecurityGroups))
+		Expect(rmEgress).To(HaveLen(1))
+		Expect(rmEgress[0].Rule.(*cloudresource.EgressRule).ToSecurityGroups).To(Equal(ingressRule[1].FromSecurityGroups))
+	})
+
+	It("Should keep security groups of shortened cloud names after restart", func() {
+		longName := "ns-with-a-long-name/policy-with-a-very-long-name-exceeding-the-azure-asg-name-length-01"
+		grpID := &cloudresource.CloudResource{
+			Type:            cloudresource.CloudResourceTypeVM,
+			CloudResourceID: cloudresource.CloudResourceID{Name: longName, Vpc: vpc},
+			AccountID:       accountID,
+			CloudProvider:   string(runtimev1alpha1.AzureCloudProvider),
+		}
+		state := securityGroupStateCreated
+		sg := newAddrSecurityGroup(grpID, []*cloudresource.CloudResource{}, &state).(*addrSecurityGroup)
+		Expect(reconciler.addrSGIndexer.Add(sg)).To(Succeed())
+		cloudName := strings.TrimPrefix(grpID.GetCloudNameOfProvider(runtimev1alpha1.AzureCloudProvider, true),
+			cloudresource.GetControllerAddressGroupPrefix())
+		Expect(cloudName).ToNot(Equal(longName))
+
+		// the shortened names recorded before restart are lost.
+		cloudresource.SetKnownCloudNames(nil)
+		ch := make(chan cloudresource.SynchronizationContent)
+		mockCloudSecurityAPI.EXPECT().GetSecurityGroupSyncChan().DoAndReturn(
+			func() <-chan cloudresource.SynchronizationContent {
+				go func() {
+					// cloud plugin recovers the security group name from its cloud name.
+					ch <- cloudresource.SynchronizationContent{
+						Resource: cloudresource.CloudResource{
+							CloudResourceID: cloudresource.CloudResourceID{
+								Name: cloudresource.GetOriginalCloudName(cloudName),
+								Vpc:  vpc,
+							},
+							AccountID:     accountID,
+							CloudProvider: string(runtimev1alpha1.AzureCloudProvider),
+						},
+						MembershipOnly: true,
+					}
+					close(ch)
+				}()
+				return ch
+			})
+		mockCloudSecurityAPI.EXPECT().DeleteSecurityGroup(mock.Any(), mock.Any()).Times(0)
+		reconciler.bookmarkCnt = npSyncReadyBookMarkCnt
+		reconciler.syncWithCloud(true)
+		wait()
+		_, found, _ := reconciler.addrSGIndexer.GetByKey(
+			(&cloudresource.CloudResourceID{Name: cloudName, Vpc: vpc}).String())
+		Expect(found).To(BeFalse())
+	})
+
+	It("Should synchronize only security groups changed in cloud on change notification", func() {
+		newSyncContent := func(name, cloudID string) cloudresource.SynchronizationContent {
+			return cloudresource.SynchronizationContent{
+				Resource: cloudresource.CloudResource{
+					CloudResourceID: cloudresource.CloudResourceID{Name: name, Vpc: vpc},
+				},
+				MembershipOnly: true,
+				CloudID:        cloudID,
+			}
+		}
+		changedSG := newSyncContent("Changed", "sg-changed")
+		unchangedSG := newSyncContent("Unchanged", "sg-unchanged")
+		ch := make(chan cloudresource.SynchronizationContent)
+		mockCloudSecurityAPI.EXPECT().GetSecurityGroupSyncChan().Return(ch)
+		go func() {
+			ch <- changedSG
+			ch <- unchangedSG
+			close(ch)
+		}()
+		// Only the unknown security group changed in cloud is removed.
+		deleteCh := make(chan error)
+		mockCloudSecurityAPI.EXPECT().DeleteSecurityGroup(&changedSG.Resource, true).Return(deleteCh)
+		go func() {
+			deleteCh <- nil
+		}()
+
+		reconciler.RequestSecurityGroupReconcile("SG-Changed")
+		reconciler.RequestSecurityGroupReconcile("sg-changed")
+		reconciler.drainSecurityGroupChanges(<-reconciler.sgChanged)
+		Expect(reconciler.pendingSgChanges).To(Equal(map[string]struct{}{"sg-changed": {}}))
+		reconciler.syncSecurityGroupChanges()
+		Expect(reconciler.pendingSgChanges).To(BeNil())
+		wait()
+	})
+
+	It("Should recreate security groups deleted in cloud on change notification", func() {
+		grpID := &cloudresource.CloudResource{
+			Type:            cloudresource.CloudResourceTypeVM,
+			CloudResourceID: cloudresource.CloudResourceID{Name: "Deleted", Vpc: vpc},
+			AccountID:       accountID,
+		}
+		state := securityGroupStateCreated
+		sg := newAddrSecurityGroup(grpID, []*cloudresource.CloudResource{}, &state).(*addrSecurityGroup)
+		Expect(reconciler.addrSGIndexer.Add(sg)).To(Succeed())
+		reconciler.cloudIDToSGs = map[string][]cloudSecurityGroupKey{
+			"sg-deleted": {{id: grpID.CloudResourceID, membershipOnly: true}},
+		}
+
+		// the deleted security group is absent from the cloud view.
+		ch := make(chan cloudresource.SynchronizationContent)
+		close(ch)
+		mockCloudSecurityAPI.EXPECT().GetSecurityGroupSyncChan().Return(ch)
+		createCh := make(chan error)
+		mockCloudSecurityAPI.EXPECT().CreateSecurityGroup(grpID, true).Return(createCh)
+		go func() {
+			createCh <- nil
+		}()
+		mockCloudSecurityAPI.EXPECT().UpdateSecurityGroupMembers(mock.Any(), mock.Any(), true).AnyTimes().
+			DoAndReturn(func(_ *cloudresource.CloudResource, _ []*cloudresource.CloudResource, _ bool) <-chan error {
+				ret := make(chan error, 1)
+				ret <- nil
+				return ret
+			})
+
+		reconciler.bookmarkCnt = npSyncReadyBookMarkCnt
+		reconciler.syncSecurityGroupsWithCloud(map[string]struct{}{"sg-deleted": {}})
+		wait()
+		Expect(reconciler.cloudIDToSGs).ToNot(HaveKey("sg-deleted"))
+	})
 })
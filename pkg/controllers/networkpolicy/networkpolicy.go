@@ -16,6 +16,7 @@ package networkpolicy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -87,6 +88,12 @@ type securityGroupStatus struct {
 	err error
 }
 
+// cloudSecurityGroupKey identifies an addrSecurityGroup or appliedToSecurityGroup.
+type cloudSecurityGroupKey struct {
+	id             cloudresource.CloudResourceID
+	membershipOnly bool
+}
+
 // cloudSecurityGroup is the cloud interface for addrSecurityGroup and appliedToSecurityGroup.
 type cloudSecurityGroup interface {
 	add(r *NetworkPolicyReconciler) error
@@ -626,6 +633,9 @@ func (a *addrSecurityGroup) notify(op securityGroupOperation, status error, r *N
 		if a.state == securityGroupStateInit {
 			a.state = securityGroupStateCreated
 		}
+	case securityGroupOperationUpdateMembers:
+		a.refreshRemoteAppliedToGroups(r)
+		return nil
 	default:
 		return nil
 	}
@@ -646,6 +656,63 @@ func (a *addrSecurityGroup) notify(op securityGroupOperation, status error, r *N
 	return nil
 }
 
+// refreshRemoteAppliedToGroups realizes again the rules referencing addrSecurityGroup of appliedTo groups in other vpcs,
+// if their cloud plug-in resolves addrSecurityGroup to the addresses of its members.
+func (a *addrSecurityGroup) refreshRemoteAppliedToGroups(r *NetworkPolicyReconciler) {
+	sgs, err := r.appliedToSGIndexer.ByIndex(appliedToIndexerByAddrGroupRef, a.id.CloudResourceID.String())
+	if err != nil {
+		r.Log.Error(err, "failed to get from appliedToSG indexer", "indexer", appliedToIndexerByAddrGroupRef, "sg", a.id.Name)
+		return
+	}
+	for _, i := range sgs {
+		sg := i.(*appliedToSecurityGroup)
+		if strings.EqualFold(sg.id.Vpc, a.id.Vpc) ||
+			!utils.ResolvesRemoteSecurityGroups(runtimev1alpha1.CloudProvider(sg.id.CloudProvider)) {
+			continue
+		}
+		rules, err := r.cloudRuleIndexer.ByIndex(cloudRuleIndexerByAppliedToGrp, sg.id.CloudResourceID.String())
+		if err != nil {
+			r.Log.Error(err, "get cloudRule indexer", "sg", sg.id.CloudResourceID.String())
+			continue
+		}
+		for _, obj := range rules {
+			rule := obj.(*cloudresource.CloudRule)
+			if !ruleReferencesSecurityGroup(rule, &a.id.CloudResourceID) {
+				continue
+			}
+			if sg.refreshRuleHashes == nil {
+				sg.refreshRuleHashes = make(map[string]struct{})
+			}
+			sg.refreshRuleHashes[rule.Hash] = struct{}{}
+		}
+		if len(sg.refreshRuleHashes) == 0 {
+			continue
+		}
+		r.Log.V(1).Info("Refreshing rules referencing AddrSecurityGroup of another vpc", "Name", a.id.Name,
+			"appliedToGroup", sg.id.Name)
+		if err := sg.updateAllRules(r); err != nil {
+			r.Log.Error(err, "failed to refresh rules", "appliedToGroup", sg.id.Name)
+		}
+	}
+}
+
+// ruleReferencesSecurityGroup returns true if rule references the security group.
+func ruleReferencesSecurityGroup(rule *cloudresource.CloudRule, id *cloudresource.CloudResourceID) bool {
+	var securityGroups []*cloudresource.CloudResourceID
+	switch r := rule.Rule.(type) {
+	case *cloudresource.IngressRule:
+		securityGroups = r.FromSecurityGroups
+	case *cloudresource.EgressRule:
+		securityGroups = r.ToSecurityGroups
+	}
+	for _, sg := range securityGroups {
+		if sg.String() == id.String() {
+			return true
+		}
+	}
+	return false
+}
+
 // getStatus returns status of this addrSecurityGroup.
 func (a *addrSecurityGroup) getStatus() error {
 	if a.status != nil {
@@ -719,6 +786,11 @@ type appliedToSecurityGroup struct {
 	hasMembers    bool
 	addrGroupRefs map[string]struct{}
 	pendingNpQ    chan *networkPolicy
+	// refreshRuleHashes are the hashes of realized rules referencing address groups of other vpcs whose members
+	// changed, such rules are removed and added again so that cloud plug-in resolves the groups to their new members.
+	refreshRuleHashes map[string]struct{}
+	// rulesReapplyPending is set when rules are to be reapplied once the ongoing cloud operation completes.
+	rulesReapplyPending bool
 }
 
 // newAddrAppliedGroup creates a new addSecurityGroup from Antrea AddressGroup membership.
@@ -794,8 +866,85 @@ func (a *appliedToSecurityGroup) updateAllRules(r *NetworkPolicyReconciler) erro
 	return nil
 }
 
+// reapplyRules invokes cloud plug-in to update rules of appliedToSecurityGroup without any rule change, so that the
+// rules cloud plug-in builds from account options rather than from ANPs, e.g. egress allow-list rules, are rebuilt.
+func (a *appliedToSecurityGroup) reapplyRules(r *NetworkPolicyReconciler) {
+	// rules of a security group not yet created are built with the account options once it is created.
+	if !a.isReady() || a.deletePending {
+		return
+	}
+	if a.retryOp != nil || a.cloudOpInProgress {
+		a.rulesReapplyPending = true
+		return
+	}
+	a.rulesReapplyPending = false
+	a.cloudOpInProgress = true
+	ch := securitygroup.CloudSecurityGroup.UpdateSecurityGroupRules(&a.id, nil, nil)
+
+	go func() {
+		err := <-ch
+		a.cloudOpInProgress = false
+		r.cloudResponse <- &securityGroupStatus{sg: a, op: securityGroupOperationUpdateRules, err: err}
+	}()
+}
+
 // updateANPRules invokes cloud plug-in to update rules of appliedToSecurityGroup for a given ANP.
 func (a *appliedToSecurityGroup) updateANPRules(r *NetworkPolicyReconciler, np *networkPolicy) {
+	addRules, rmRules, ok := a.prepareANPRulesUpdate(r, np)
+	if !ok {
+		return
+	}
+	ch := securitygroup.CloudSecurityGroup.UpdateSecurityGroupRules(&a.id, addRules, rmRules)
+
+	go func() {
+		a.completeANPRulesUpdate(r, np, addRules, rmRules, <-ch)
+	}()
+}
+
+// updateANPRulesInBatch invokes cloud plug-in to update rules of the given appliedToSecurityGroups for a given ANP in
+// a single batch, so that the appliedToSecurityGroups referenced by the rules of others are updated first. The
+// addrSecurityGroups referenced by the rules are created beforehand, as rules of the ANP are only ready once all of its
+// addrSecurityGroups are created.
+func updateANPRulesInBatch(r *NetworkPolicyReconciler, np *networkPolicy, sgs []*appliedToSecurityGroup) {
+	if len(sgs) <= 1 {
+		for _, a := range sgs {
+			a.updateANPRules(r, np)
+		}
+		return
+	}
+	var updating []*appliedToSecurityGroup
+	var updates []cloudresource.GroupRuleUpdate
+	for _, a := range sgs {
+		addRules, rmRules, ok := a.prepareANPRulesUpdate(r, np)
+		if !ok {
+			continue
+		}
+		updating = append(updating, a)
+		updates = append(updates, cloudresource.GroupRuleUpdate{AppliedToGroup: &a.id, AddRules: addRules,
+			RmRules: rmRules})
+	}
+	if len(updates) == 0 {
+		return
+	}
+	ch := securitygroup.CloudSecurityGroup.UpdateSecurityGroupRulesBatch(updates)
+
+	go func() {
+		err := <-ch
+		batchErr, isBatchErr := err.(*cloudresource.GroupRuleUpdateBatchError)
+		for i, a := range updating {
+			sgErr := err
+			if isBatchErr {
+				sgErr = batchErr.Failed[a.id]
+			}
+			a.completeANPRulesUpdate(r, np, updates[i].AddRules, updates[i].RmRules, sgErr)
+		}
+	}()
+}
+
+// prepareANPRulesUpdate computes the rules to add to and remove from appliedToSecurityGroup for a given ANP, and marks
+// the cloud operation in progress. It returns false if no cloud operation is needed.
+func (a *appliedToSecurityGroup) prepareANPRulesUpdate(r *NetworkPolicyReconciler,
+	np *networkPolicy) ([]*cloudresource.CloudRule, []*cloudresource.CloudRule, bool) {
 	// skip the rule update if:
 	// - the security group is not created in the cloud;
 	// - the security group is pending deletion;
@@ -804,17 +953,17 @@ func (a *appliedToSecurityGroup) updateANPRules(r *NetworkPolicyReconciler, np *
 	// - there is a cloud operation in progress.
 	if !np.rulesReady {
 		r.Log.V(1).Info("NetworkPolicy is not in ready state", "np", np.Name, "appliedToGroup", a.id.Name)
-		return
+		return nil, nil, false
 	}
 	if !a.isReady() || a.deletePending || a.retryOp != nil {
 		r.Log.V(1).Info("AppliedToGroup is not in ready state", "np", np.Name, "appliedToGroup", a.id.Name,
 			"DeletePending", a.deletePending, "retryOp", a.retryOp)
-		return
+		return nil, nil, false
 	}
 	if a.cloudOpInProgress {
 		r.Log.V(1).Info("Adding NetworkPolicy to pending queue", "appliedToGroup", a.id.Name, "networkPolicy", np.Name)
 		a.pendingNpQ <- np
-		return
+		return nil, nil, false
 	}
 
 	nps, err := r.networkPolicyIndexer.ByIndex(networkPolicyIndexerByAppliedToGrp, a.id.Name)
@@ -824,11 +973,11 @@ func (a *appliedToSecurityGroup) updateANPRules(r *NetworkPolicyReconciler, np *
 		r.sendRuleRealizationStatus(&np.NetworkPolicy, err)
 		a.status = err
 		_ = a.updateNPTracker(r)
-		return
+		return nil, nil, false
 	}
 	if len(nps) == 0 {
 		a.clearMembers(r, np)
-		return
+		return nil, nil, false
 	}
 
 	addRules, rmRules, err := a.computeCloudRulesFromNp(r, np)
@@ -836,7 +985,7 @@ func (a *appliedToSecurityGroup) updateANPRules(r *NetworkPolicyReconciler, np *
 		r.sendRuleRealizationStatus(&np.NetworkPolicy, err)
 		a.status = err
 		_ = a.updateNPTracker(r)
-		return
+		return nil, nil, false
 	}
 
 	if len(addRules) == 0 && len(rmRules) == 0 {
@@ -846,28 +995,44 @@ func (a *appliedToSecurityGroup) updateANPRules(r *NetworkPolicyReconciler, np *
 			r.updateRuleRealizationStatus(a.id.CloudResourceID.String(), np, nil)
 			r.cloudResponse <- &securityGroupStatus{sg: a, op: securityGroupOperationUpdateRules, err: nil}
 		}()
-		return
+		return nil, nil, false
 	}
 
 	a.cloudOpInProgress = true
 	r.Log.V(1).Info("Updating AppliedToSecurityGroup rules for anp", "anp", np.Name, "name", a.id.Name,
 		"added", addRules, "removed", rmRules)
-	ch := securitygroup.CloudSecurityGroup.UpdateSecurityGroupRules(&a.id, addRules, rmRules)
-
-	go func() {
-		err = <-ch
-		if err == nil {
-			for _, rule := range addRules {
-				_ = r.cloudRuleIndexer.Update(rule)
-			}
-			for _, rule := range rmRules {
-				_ = r.cloudRuleIndexer.Delete(rule)
+	return addRules, rmRules, true
+}
+
+// completeANPRulesUpdate processes the result of a cloud plug-in rules update of appliedToSecurityGroup for a given ANP.
+func (a *appliedToSecurityGroup) completeANPRulesUpdate(r *NetworkPolicyReconciler, np *networkPolicy,
+	addRules, rmRules []*cloudresource.CloudRule, err error) {
+	// rules rejected as invalid, and security groups left out of rules, are reported in the realization status, while
+	// the other rules are updated and the security group proceeds as on success, retrying does not resolve them.
+	opErr := err
+	var invalidRulesErr *cloudresource.InvalidRulesError
+	var unresolvedGroupsErr *cloudresource.UnresolvedGroupsError
+	if errors.As(err, &invalidRulesErr) || errors.As(err, &unresolvedGroupsErr) {
+		opErr = nil
+	}
+	if opErr == nil {
+		// stale rules share the hash of their replacement, so remove before add.
+		for _, rule := range rmRules {
+			_ = r.cloudRuleIndexer.Delete(rule)
+			delete(a.refreshRuleHashes, rule.Hash)
+		}
+		for _, rule := range addRules {
+			if invalidRulesErr != nil {
+				if _, rejected := invalidRulesErr.Rejected[rule]; rejected {
+					continue
+				}
 			}
+			_ = r.cloudRuleIndexer.Update(rule)
 		}
-		a.cloudOpInProgress = false
-		r.updateRuleRealizationStatus(a.id.CloudResourceID.String(), np, err)
-		r.cloudResponse <- &securityGroupStatus{sg: a, op: securityGroupOperationUpdateRules, err: err}
-	}()
+	}
+	a.cloudOpInProgress = false
+	r.updateRuleRealizationStatus(a.id.CloudResourceID.String(), np, err)
+	r.cloudResponse <- &securityGroupStatus{sg: a, op: securityGroupOperationUpdateRules, err: opErr}
 }
 
 // clearMembers removes all members from a security group.
@@ -888,7 +1053,8 @@ func (a *appliedToSecurityGroup) clearMembers(r *NetworkPolicyReconciler, np *ne
 	a.ruleReady = false
 }
 
-// getCloudRulesFromNps converts and combines all rules from given anps to securitygroup.CloudRule.
+// getCloudRulesFromNps converts and combines all rules from given anps to securitygroup.CloudRule. The return-direction
+// rules of stateless rule enforcement are included, so that they are indexed and removed along with their policy.
 func (a *appliedToSecurityGroup) getCloudRulesFromNps(nps []interface{}) []*cloudresource.CloudRule {
 	rules := make([]*cloudresource.CloudRule, 0)
 	for _, i := range nps {
@@ -897,6 +1063,8 @@ func (a *appliedToSecurityGroup) getCloudRulesFromNps(nps []interface{}) []*clou
 			continue
 		}
 		npNamespacedName := np.getNamespacedName()
+		npUID := string(np.UID)
+		npRules := make([]*cloudresource.CloudRule, 0, len(np.ingressRules)+len(np.egressRules))
 		for _, r := range np.ingressRules {
 			if _, ok := r.AppliedToGroup[a.id.Name]; !ok {
 				continue
@@ -907,10 +1075,12 @@ func (a *appliedToSecurityGroup) getCloudRulesFromNps(nps []interface{}) []*clou
 			rule := &cloudresource.CloudRule{
 				Rule:             ruleCopy,
 				NpNamespacedName: npNamespacedName,
+				NpUID:            npUID,
 				AppliedToGrp:     a.id.CloudResourceID.String(),
+				Annotations:      np.Labels,
 			}
 			rule.Hash = rule.GetHash()
-			rules = append(rules, rule)
+			npRules = append(npRules, rule)
 		}
 		for _, r := range np.egressRules {
 			if _, ok := r.AppliedToGroup[a.id.Name]; !ok {
@@ -922,11 +1092,14 @@ func (a *appliedToSecurityGroup) getCloudRulesFromNps(nps []interface{}) []*clou
 			rule := &cloudresource.CloudRule{
 				Rule:             ruleCopy,
 				NpNamespacedName: npNamespacedName,
+				NpUID:            npUID,
 				AppliedToGrp:     a.id.CloudResourceID.String(),
+				Annotations:      np.Labels,
 			}
 			rule.Hash = rule.GetHash()
-			rules = append(rules, rule)
+			npRules = append(npRules, rule)
 		}
+		rules = append(rules, utils.ExpandStatelessRules(runtimev1alpha1.CloudProvider(a.id.CloudProvider), npRules)...)
 	}
 	return rules
 }
@@ -952,11 +1125,18 @@ func (a *appliedToSecurityGroup) computeCloudRulesFromNp(r *NetworkPolicyReconci
 	// no rule with same np found                     -> rule removed, delete.
 	// same rule with different np found              -> duplicate rules with other np, err.
 	// no rule with different np found                -> no-op.
+	// rule of a previous np with same name           -> stale rule, delete and re-add.
+	// same rule with same np to be refreshed         -> delete and re-add.
 	addRules := make([]*cloudresource.CloudRule, 0)
 	removeRules := make([]*cloudresource.CloudRule, 0)
 	for _, obj := range realizedRules {
 		realizedRule := obj.(*cloudresource.CloudRule)
 		npNamespacedName := np.getNamespacedName()
+		if realizedRule.IsStale(npNamespacedName, string(np.UID)) {
+			r.Log.V(1).Info("Removing stale rule of recreated anp", "anp", npNamespacedName, "uid", realizedRule.NpUID)
+			removeRules = append(removeRules, realizedRule)
+			continue
+		}
 
 		sameNP := realizedRule.NpNamespacedName == npNamespacedName
 		currentRule, sameRule := currentRuleMap[realizedRule.Hash]
@@ -974,6 +1154,10 @@ func (a *appliedToSecurityGroup) computeCloudRulesFromNp(r *NetworkPolicyReconci
 			continue
 		}
 		if sameRule && sameNP {
+			if _, refresh := a.refreshRuleHashes[realizedRule.Hash]; refresh {
+				removeRules = append(removeRules, realizedRule)
+				continue
+			}
 			delete(currentRuleMap, realizedRule.Hash)
 		}
 	}
@@ -1003,27 +1187,27 @@ func (a *appliedToSecurityGroup) checkRealization(r *NetworkPolicyReconciler, np
 		realizedRuleMap[rule.Hash] = rule
 	}
 
+	desiredRules := make([]*cloudresource.CloudRule, 0, len(np.ingressRules)+len(np.egressRules))
 	for _, irule := range np.ingressRules {
-		desiredRule := cloudresource.CloudRule{
+		desiredRules = append(desiredRules, &cloudresource.CloudRule{
 			Rule:         irule,
 			AppliedToGrp: a.id.CloudResourceID.String(),
-		}
-		desiredRule.Hash = desiredRule.GetHash()
-		_, found := realizedRuleMap[desiredRule.Hash]
-		if !found {
-			return fmt.Errorf("ingress rule not realized %+v", desiredRule)
-		}
-		delete(realizedRuleMap, desiredRule.Hash)
+		})
 	}
 	for _, erule := range np.egressRules {
-		desiredRule := cloudresource.CloudRule{
+		desiredRules = append(desiredRules, &cloudresource.CloudRule{
 			Rule:         erule,
 			AppliedToGrp: a.id.CloudResourceID.String(),
-		}
+		})
+	}
+	for _, desiredRule := range utils.ExpandStatelessRules(runtimev1alpha1.CloudProvider(a.id.CloudProvider), desiredRules) {
 		desiredRule.Hash = desiredRule.GetHash()
 		_, found := realizedRuleMap[desiredRule.Hash]
 		if !found {
-			return fmt.Errorf("egress rule not realized %+v", desiredRule)
+			if _, ok := desiredRule.Rule.(*cloudresource.IngressRule); ok {
+				return fmt.Errorf("ingress rule not realized %+v", *desiredRule)
+			}
+			return fmt.Errorf("egress rule not realized %+v", *desiredRule)
 		}
 		delete(realizedRuleMap, desiredRule.Hash)
 	}
@@ -1179,6 +1363,9 @@ func (a *appliedToSecurityGroup) notify(op securityGroupOperation, status error,
 		a.notifyImpl(a, false, op, status, r)
 		// Process pending Network Policies.
 		a.processPendingNetworkPolicy(r)
+		if a.rulesReapplyPending {
+			a.reapplyRules(r)
+		}
 	}()
 
 	if !(a.state == securityGroupStateGarbageCollectState && op != securityGroupOperationDelete) {
@@ -1280,6 +1467,7 @@ func (r *networkPolicyRule) rules(rr *NetworkPolicyReconciler, policyAppliedToGr
 		for _, ip := range rule.From.IPBlocks {
 			ingress := &cloudresource.IngressRule{}
 			ingress.AppliedToGroup = make(map[string]struct{}, 0)
+			ingress.EnableLogging = rule.EnableLogging
 			ipNet := net.IPNet{IP: net.IP(ip.CIDR.IP), Mask: net.CIDRMask(int(ip.CIDR.PrefixLength), 8*net.IPv4len)}
 			if ipNet.IP.To4() == nil {
 				ipNet = net.IPNet{IP: net.IP(ip.CIDR.IP), Mask: net.CIDRMask(int(ip.CIDR.PrefixLength), 8*net.IPv6len)}
@@ -1305,6 +1493,7 @@ func (r *networkPolicyRule) rules(rr *NetworkPolicyReconciler, policyAppliedToGr
 				if len(id.Vpc) > 0 {
 					ingress := &cloudresource.IngressRule{}
 					ingress.AppliedToGroup = make(map[string]struct{}, 0)
+					ingress.EnableLogging = rule.EnableLogging
 					ingress.FromSecurityGroups = append(ingress.FromSecurityGroups, &id)
 					setAppliedToGroup(rule.AppliedToGroups, policyAppliedToGroups, ingress)
 					iRules = append(iRules, ingress)
@@ -1330,10 +1519,13 @@ func (r *networkPolicyRule) rules(rr *NetworkPolicyReconciler, policyAppliedToGr
 				port := int(s.Port.IntVal)
 				fromPort = &port
 			}
+			srcPort, srcEndPort := getSourcePortRange(s)
 			for _, ingress := range iRules {
 				i := deepcopy.Copy(ingress).(*cloudresource.IngressRule)
 				i.FromPort = fromPort
 				i.Protocol = protocol
+				i.SrcPort = srcPort
+				i.SrcEndPort = srcEndPort
 				ingressList = append(ingressList, i)
 			}
 		}
@@ -1343,6 +1535,7 @@ func (r *networkPolicyRule) rules(rr *NetworkPolicyReconciler, policyAppliedToGr
 	for _, ip := range rule.To.IPBlocks {
 		egress := &cloudresource.EgressRule{}
 		egress.AppliedToGroup = make(map[string]struct{}, 0)
+		egress.EnableLogging = rule.EnableLogging
 		ipNet := net.IPNet{IP: net.IP(ip.CIDR.IP), Mask: net.CIDRMask(int(ip.CIDR.PrefixLength), 8*net.IPv4len)}
 		if ipNet.IP.To4() == nil {
 			ipNet = net.IPNet{IP: net.IP(ip.CIDR.IP), Mask: net.CIDRMask(int(ip.CIDR.PrefixLength), 8*net.IPv6len)}
@@ -1368,6 +1561,7 @@ func (r *networkPolicyRule) rules(rr *NetworkPolicyReconciler, policyAppliedToGr
 			if len(id.Vpc) > 0 {
 				egress := &cloudresource.EgressRule{}
 				egress.AppliedToGroup = make(map[string]struct{}, 0)
+				egress.EnableLogging = rule.EnableLogging
 				egress.ToSecurityGroups = append(egress.ToSecurityGroups, &id)
 				setAppliedToGroup(rule.AppliedToGroups, policyAppliedToGroups, egress)
 				eRules = append(eRules, egress)
@@ -1393,16 +1587,37 @@ func (r *networkPolicyRule) rules(rr *NetworkPolicyReconciler, policyAppliedToGr
 			port := int(s.Port.IntVal)
 			fromPort = &port
 		}
+		srcPort, srcEndPort := getSourcePortRange(s)
 		for _, egress := range eRules {
 			e := deepcopy.Copy(egress).(*cloudresource.EgressRule)
 			e.ToPort = fromPort
 			e.Protocol = protocol
+			e.SrcPort = srcPort
+			e.SrcEndPort = srcEndPort
 			egressList = append(egressList, e)
 		}
 	}
 	return
 }
 
+// getSourcePortRange returns the source port range of an Antrea service, nil for any source port, including a range
+// covering every port.
+func getSourcePortRange(s antreanetworking.Service) (*int, *int) {
+	var srcPort, srcEndPort *int
+	if s.SrcPort != nil && s.SrcEndPort != nil && *s.SrcPort <= 0 && *s.SrcEndPort >= 65535 {
+		return nil, nil
+	}
+	if s.SrcPort != nil {
+		port := int(*s.SrcPort)
+		srcPort = &port
+		if s.SrcEndPort != nil {
+			endPort := int(*s.SrcEndPort)
+			srcEndPort = &endPort
+		}
+	}
+	return srcPort, srcEndPort
+}
+
 // networkPolicy describe an Antrea internal/user facing networkPolicy.
 type networkPolicy struct {
 	antreanetworking.NetworkPolicy
@@ -1502,6 +1717,7 @@ func (n *networkPolicy) update(anp *antreanetworking.NetworkPolicy, recompute bo
 	// process appliedToGroups needs updates in this networkPolicy.
 	modifiedAppliedTo = append(modifiedAppliedTo, removedAppliedTo...)
 	modifiedAppliedTo = append(modifiedAppliedTo, addedAppliedTo...)
+	var appliedToSGs []*appliedToSecurityGroup
 	for _, id := range modifiedAppliedTo {
 		sgs, err := r.appliedToSGIndexer.ByIndex(addrAppliedToIndexerByGroupID, id)
 		if err != nil {
@@ -1509,10 +1725,10 @@ func (n *networkPolicy) update(anp *antreanetworking.NetworkPolicy, recompute bo
 			continue
 		}
 		for _, i := range sgs {
-			sg := i.(*appliedToSecurityGroup)
-			sg.updateANPRules(r, n)
+			appliedToSGs = append(appliedToSGs, i.(*appliedToSecurityGroup))
 		}
 	}
+	updateANPRulesInBatch(r, n, appliedToSGs)
 }
 
 // delete deletes a networkPolicy.
@@ -1524,16 +1740,17 @@ func (n *networkPolicy) delete(r *NetworkPolicyReconciler) error {
 		r.Log.Error(err, "delete from networkPolicy indexer", "Name", n.Name, "Namespace", n.Namespace)
 	}
 
+	var appliedToSGs []*appliedToSecurityGroup
 	for _, gname := range getAppliedToGroups(n) {
 		sgs, err := r.appliedToSGIndexer.ByIndex(addrAppliedToIndexerByGroupID, gname)
 		if err != nil {
 			return fmt.Errorf("unable to get appliedToSGs %s from indexer: %w", gname, err)
 		}
 		for _, i := range sgs {
-			sg := i.(*appliedToSecurityGroup)
-			sg.updateANPRules(r, n)
+			appliedToSGs = append(appliedToSGs, i.(*appliedToSecurityGroup))
 		}
 	}
+	updateANPRulesInBatch(r, n, appliedToSGs)
 	var addrGrp []string
 	for _, rule := range n.Rules {
 		addrGrp = append(addrGrp, rule.To.AddressGroups...)
@@ -1613,18 +1830,19 @@ func (n *networkPolicy) notifyAddressGroupChange(r *NetworkPolicyReconciler, gro
 		return nil
 	}
 
+	var appliedToSGs []*appliedToSecurityGroup
 	for _, gname := range getAppliedToGroups(n) {
 		sgs, err := r.appliedToSGIndexer.ByIndex(addrAppliedToIndexerByGroupID, gname)
 		if err != nil {
 			return fmt.Errorf("unable to get appliedToSGs %s from indexer: %w", gname, err)
 		}
 		for _, i := range sgs {
-			sg := i.(*appliedToSecurityGroup)
-			r.Log.V(1).Info("Updating NetworkPolicy rules due to change in AddressGroup",
-				"addressGroup", groupName, "np", n.Name)
-			sg.updateANPRules(r, n)
+			appliedToSGs = append(appliedToSGs, i.(*appliedToSecurityGroup))
 		}
 	}
+	r.Log.V(1).Info("Updating NetworkPolicy rules due to change in AddressGroup",
+		"addressGroup", groupName, "np", n.Name)
+	updateANPRulesInBatch(r, n, appliedToSGs)
 	return nil
 }
 
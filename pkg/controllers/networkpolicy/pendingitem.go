@@ -139,23 +139,47 @@ func (q *PendingItemQueue) CheckToRun(forceRetry bool) {
 		return
 	}
 	for k, i := range q.items {
-		run, del := i.RunOrDeletePendingItem(k, q.context)
-		if del {
-			q.Remove(k)
+		q.runItem(k, i)
+	}
+	lastRetryTime = time.Now().Unix()
+}
+
+// RunItem runs item id on queue immediately, regardless of retry interval.
+func (q *PendingItemQueue) RunItem(id string) {
+	if i, ok := q.items[id]; ok {
+		q.runItem(id, i)
+	}
+}
+
+func (q *PendingItemQueue) runItem(k string, i countingPendingItem) {
+	run, del := i.RunOrDeletePendingItem(k, q.context)
+	if del {
+		q.Remove(k)
+	}
+	if run {
+		if i.retryCount == nil || *i.retryCount > 0 {
+			del = i.RunPendingItem(k, q.context)
 		}
-		if run {
-			if i.retryCount == nil || *i.retryCount > 0 {
-				del = i.RunPendingItem(k, q.context)
-			}
-			if i.retryCount != nil {
-				*i.retryCount--
-			}
+		if i.retryCount != nil {
+			*i.retryCount--
 		}
-		if del || (i.retryCount != nil && *i.retryCount < 0) {
-			q.Remove(k)
+	}
+	if del || (i.retryCount != nil && *i.retryCount < 0) {
+		q.Remove(k)
+	}
+}
+
+// getPendingGroupsWithMember returns ids of pending groups on queue waiting to add member with key memberKey.
+func (q *PendingItemQueue) getPendingGroupsWithMember(memberKey string) []string {
+	var ids []string
+	for k, i := range q.items {
+		if p, ok := i.PendingItem.(*pendingGroup); ok {
+			if _, found := p.addedMembers[memberKey]; found {
+				ids = append(ids, k)
+			}
 		}
 	}
-	lastRetryTime = time.Now().Unix()
+	return ids
 }
 
 var (
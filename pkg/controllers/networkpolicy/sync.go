@@ -16,6 +16,7 @@ package networkpolicy
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/watch"
@@ -23,6 +24,7 @@ import (
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/cloudprovider/cloudresource"
 	"antrea.io/nephe/pkg/cloudprovider/securitygroup"
+	"antrea.io/nephe/pkg/cloudprovider/utils"
 	"antrea.io/nephe/pkg/inventory/indexer"
 )
 
@@ -109,19 +111,29 @@ func (a *appliedToSecurityGroup) sync(syncContent *cloudresource.Synchronization
 				log.V(1).Info("NetworkPolicy is not ready", "Name", np.Name, "Namespace", np.Namespace)
 			}
 		}
+		npRules := make([]*cloudresource.CloudRule, 0, len(np.ingressRules)+len(np.egressRules))
 		for _, iRule := range np.ingressRules {
 			if _, ok := iRule.AppliedToGroup[a.id.Name]; !ok {
 				// Skip this rule if it's not meant for given appliedToGroup.
 				continue
 			}
-			countIngressRuleItems(iRule, items, false)
+			npRules = append(npRules, &cloudresource.CloudRule{Rule: iRule})
 		}
 		for _, eRule := range np.egressRules {
 			if _, ok := eRule.AppliedToGroup[a.id.Name]; !ok {
 				// Skip this rule if it's not meant for given appliedToGroup.
 				continue
 			}
-			countEgressRuleItems(eRule, items, false)
+			npRules = append(npRules, &cloudresource.CloudRule{Rule: eRule})
+		}
+		// return-direction rules realized in cloud are counted along with the rules they are generated from.
+		for _, rule := range utils.ExpandStatelessRules(runtimev1alpha1.CloudProvider(a.id.CloudProvider), npRules) {
+			switch rule := rule.Rule.(type) {
+			case *cloudresource.IngressRule:
+				countIngressRuleItems(rule, items, false)
+			case *cloudresource.EgressRule:
+				countEgressRuleItems(rule, items, false)
+			}
 		}
 	}
 
@@ -200,15 +212,38 @@ func (r *NetworkPolicyReconciler) syncWithCloud(forceSync bool) {
 		return
 	}
 
-	log := r.Log.WithName("CloudSync")
 	if r.bookmarkCnt < npSyncReadyBookMarkCnt {
 		return
 	}
+	r.syncedWithCloud = true
+	// a full sync covers the pending security group changes.
+	r.pendingSgChanges = nil
+	r.syncSecurityGroupsWithCloud(nil)
+	lastSyncTime = time.Now().Unix()
+}
+
+// syncSecurityGroupsWithCloud synchronizes security groups in controller with cloud. When cloudIDs is not nil, only
+// security groups held by cloud security groups of the given lower case cloud IDs are synchronized, the cloud view is
+// still retrieved as a whole.
+func (r *NetworkPolicyReconciler) syncSecurityGroupsWithCloud(cloudIDs map[string]struct{}) {
+	log := r.Log.WithName("CloudSync")
+	r.setKnownCloudNames()
 	ch := securitygroup.CloudSecurityGroup.GetSecurityGroupSyncChan()
 	cloudAddrSGs := make(map[cloudresource.CloudResourceID]*cloudresource.SynchronizationContent)
 	cloudAppliedToSGs := make(map[cloudresource.CloudResourceID]*cloudresource.SynchronizationContent)
 	removeAddrSgs := make([]*addrSecurityGroup, 0)
+	cloudIDToSGs := make(map[string][]cloudSecurityGroupKey)
 	for content := range ch {
+		cloudID := strings.ToLower(content.CloudID)
+		if cloudIDs != nil {
+			if _, ok := cloudIDs[cloudID]; !ok {
+				continue
+			}
+		}
+		if cloudID != "" {
+			cloudIDToSGs[cloudID] = append(cloudIDToSGs[cloudID],
+				cloudSecurityGroupKey{id: content.Resource.CloudResourceID, membershipOnly: content.MembershipOnly})
+		}
 		log.V(1).Info("Sync from cloud", "SecurityGroup", content)
 		if content.MembershipOnly {
 			// mark unknown address groups and pending delete groups for deletion after appliedTo groups updates address group references.
@@ -240,15 +275,23 @@ func (r *NetworkPolicyReconciler) syncWithCloud(forceSync bool) {
 			cloudAppliedToSGs[content.Resource.CloudResourceID] = &cc
 		}
 	}
-	r.syncedWithCloud = true
+	missingSGs := r.updateCloudIDSecurityGroups(cloudIDs, cloudIDToSGs)
 	for _, i := range r.addrSGIndexer.List() {
 		sg := i.(*addrSecurityGroup)
+		_, missing := missingSGs[cloudSecurityGroupKey{id: sg.getID(), membershipOnly: true}]
+		if _, ok := cloudAddrSGs[sg.getID()]; cloudIDs != nil && !ok && !missing {
+			continue
+		}
 		sg.retryEnabled = false
 		sg.sync(cloudAddrSGs[sg.getID()], r)
 		sg.retryEnabled = true
 	}
 	for _, i := range r.appliedToSGIndexer.List() {
 		sg := i.(*appliedToSecurityGroup)
+		_, missing := missingSGs[cloudSecurityGroupKey{id: sg.getID(), membershipOnly: false}]
+		if _, ok := cloudAppliedToSGs[sg.getID()]; cloudIDs != nil && !ok && !missing {
+			continue
+		}
 		sg.retryEnabled = false
 		sg.sync(cloudAppliedToSGs[sg.getID()], r)
 		sg.retryEnabled = true
@@ -259,7 +302,56 @@ func (r *NetworkPolicyReconciler) syncWithCloud(forceSync bool) {
 		sg.retryEnabled = false
 		_ = sg.delete(r)
 	}
-	lastSyncTime = time.Now().Unix()
+}
+
+// updateCloudIDSecurityGroups records the security groups held by every cloud security group of the cloud view, and
+// returns the security groups held by cloud security groups of cloudIDs which are no longer in the cloud view, e.g.
+// deleted in cloud, so that they are recreated. A full sync with cloud is requested if such a cloud security group
+// created by Nephe holds no known security group.
+func (r *NetworkPolicyReconciler) updateCloudIDSecurityGroups(cloudIDs map[string]struct{},
+	cloudIDToSGs map[string][]cloudSecurityGroupKey) map[cloudSecurityGroupKey]struct{} {
+	if cloudIDs == nil {
+		r.cloudIDToSGs = cloudIDToSGs
+		return nil
+	}
+	if r.cloudIDToSGs == nil {
+		r.cloudIDToSGs = make(map[string][]cloudSecurityGroupKey)
+	}
+	missingSGs := make(map[cloudSecurityGroupKey]struct{})
+	for cloudID := range cloudIDs {
+		if sgs, ok := cloudIDToSGs[cloudID]; ok {
+			r.cloudIDToSGs[cloudID] = sgs
+			continue
+		}
+		sgs, ok := r.cloudIDToSGs[cloudID]
+		if !ok {
+			tokens := strings.Split(cloudID, "/")
+			if _, isAG, isAT := utils.IsNepheControllerCreatedSG(tokens[len(tokens)-1]); isAG || isAT {
+				r.Log.WithName("CloudSync").Info("Unknown security group missing in cloud", "cloudID", cloudID)
+				r.requestCloudSync(nil)
+			}
+			continue
+		}
+		r.Log.WithName("CloudSync").Info("Security group missing in cloud", "cloudID", cloudID)
+		delete(r.cloudIDToSGs, cloudID)
+		for _, sg := range sgs {
+			missingSGs[sg] = struct{}{}
+		}
+	}
+	return missingSGs
+}
+
+// setKnownCloudNames records the names of known security groups, so that the names of security groups shortened by
+// cloud plugins are recovered from the cloud view, including the ones created before controller restart.
+func (r *NetworkPolicyReconciler) setKnownCloudNames() {
+	names := make([]string, 0)
+	for _, i := range r.addrSGIndexer.List() {
+		names = append(names, i.(*addrSecurityGroup).id.Name)
+	}
+	for _, i := range r.appliedToSGIndexer.List() {
+		names = append(names, i.(*appliedToSecurityGroup).id.Name)
+	}
+	cloudresource.SetKnownCloudNames(names)
 }
 
 // processBookMark process bookmark event and return true.
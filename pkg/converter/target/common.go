@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"antrea.io/nephe/pkg/labels"
+	"antrea.io/nephe/pkg/util/k8s/tags"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -64,6 +65,12 @@ func genTargetEntityLabels(source interface{}, cl client.Client) map[string]stri
 	for key, val := range vmSource.GetTags() {
 		labelKey := labels.LabelPrefixNephe + labels.ExternalEntityLabelKeyTagPrefix + key
 		entityLabels[labelKey] = val
+		if customLabelKey, ok := labels.TagLabelKeys[key]; ok {
+			entityLabels[customLabelKey] = val
+		}
+	}
+	for key, val := range entityLabels {
+		entityLabels[key] = tags.TruncateLabelValue(val, labels.ValueTruncationStrategy)
 	}
 
 	return entityLabels
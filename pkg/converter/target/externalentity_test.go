@@ -27,6 +27,7 @@ import (
 	antreav1alpha2 "antrea.io/antrea/pkg/apis/crd/v1alpha2"
 	runtimev1alpha1 "antrea.io/nephe/apis/runtime/v1alpha1"
 	"antrea.io/nephe/pkg/converter/target"
+	nephelabels "antrea.io/nephe/pkg/labels"
 	"antrea.io/nephe/pkg/testing"
 	"antrea.io/nephe/pkg/testing/controllerruntimeclient"
 )
@@ -160,6 +161,21 @@ var _ = Describe("Externalentity", func() {
 			Entry("VirtualMachine", "VirtualMachine", &runtimev1alpha1.VirtualMachine{}))
 	})
 
+	Context("Tag label keys are configured", func() {
+		AfterEach(func() {
+			nephelabels.SetTagLabelKeys(nil)
+		})
+
+		It("Should label ExternalEntity with the custom label key of a tag", func() {
+			nephelabels.SetTagLabelKeys(map[string]string{"test-vm-tag": "example.com/app"})
+			externalEntity := target.NewExternalEntityFrom(externalEntitySources["VirtualMachine"], "test-externalentity",
+				namespace, mockclient)
+			Expect(externalEntity.Labels).To(HaveKeyWithValue("example.com/app", "test-vm-key"))
+			Expect(externalEntity.Labels).To(HaveKeyWithValue(
+				nephelabels.LabelPrefixNephe+nephelabels.ExternalEntityLabelKeyTagPrefix+"test-vm-tag", "test-vm-key"))
+		})
+	})
+
 	Context("Source does not have required information", func() {
 		JustBeforeEach(func() {
 			networkInterfaceIPAddresses = nil
@@ -72,4 +72,7 @@ type VMStore interface {
 
 	// UpdateVm updates virtual machine object in vm cache.
 	UpdateVm(vm *runtimev1alpha1.VirtualMachine) error
+
+	// AddVmAddHandler registers handler invoked for each vm newly added to the vm cache.
+	AddVmAddHandler(handler func(vm *runtimev1alpha1.VirtualMachine))
 }
@@ -20,6 +20,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/fields"
@@ -39,6 +40,9 @@ type Inventory struct {
 	log      logr.Logger
 	vpcStore antreastorage.Interface
 	vmStore  antreastorage.Interface
+
+	handlerMutex  sync.RWMutex
+	vmAddHandlers []func(vm *runtimev1alpha1.VirtualMachine)
 }
 
 // InitInventory creates an instance of Inventory struct and initializes inventory with cache indexers.
@@ -181,10 +185,23 @@ func (i *Inventory) BuildVmCache(discoveredVmMap map[string]*runtimev1alpha1.Vir
 			err = i.vmStore.Create(discoveredVm)
 			if err == nil {
 				numVmsToAdd++
+				i.notifyVmAdded(discoveredVm)
 			}
 		} else {
 			cachedVm := cachedObject.(*runtimev1alpha1.VirtualMachine)
-			if !i.compareVirtualMachineObjects(cachedVm.Status, discoveredVm.Status) {
+			if isVmRecreated(cachedVm, discoveredVm) {
+				// The vm was deleted and recreated with the same name, replace the cached vm so that watchers
+				// see the deletion of the old vm and the addition of the new one, instead of an update.
+				err = i.vmStore.Delete(key)
+				if err == nil {
+					numVmsToDelete++
+					err = i.vmStore.Create(discoveredVm)
+				}
+				if err == nil {
+					numVmsToAdd++
+					i.notifyVmAdded(discoveredVm)
+				}
+			} else if !i.compareVirtualMachineObjects(cachedVm.Status, discoveredVm.Status) {
 				if cachedVm.Status.Agented != discoveredVm.Status.Agented {
 					key := fmt.Sprintf("%v/%v", cachedVm.Namespace, cachedVm.Name)
 					err = i.vmStore.Delete(key)
@@ -211,6 +228,24 @@ func (i *Inventory) BuildVmCache(discoveredVmMap map[string]*runtimev1alpha1.Vir
 	}
 }
 
+// AddVmAddHandler registers handler invoked for each vm newly added to the vm cache.
+func (i *Inventory) AddVmAddHandler(handler func(vm *runtimev1alpha1.VirtualMachine)) {
+	i.handlerMutex.Lock()
+	defer i.handlerMutex.Unlock()
+
+	i.vmAddHandlers = append(i.vmAddHandlers, handler)
+}
+
+// notifyVmAdded invokes the registered handlers for a vm newly added to the vm cache.
+func (i *Inventory) notifyVmAdded(vm *runtimev1alpha1.VirtualMachine) {
+	i.handlerMutex.RLock()
+	defer i.handlerMutex.RUnlock()
+
+	for _, handler := range i.vmAddHandlers {
+		handler(vm)
+	}
+}
+
 // DeleteAllVmsFromCache deletes all entries from vm cache for a given account.
 func (i *Inventory) DeleteAllVmsFromCache(accountNamespacedName *types.NamespacedName) error {
 	vmsInCache, err := i.vmStore.GetByIndex(indexer.VirtualMachineByAccountNamespacedName, accountNamespacedName.String())
@@ -296,6 +331,14 @@ func (i *Inventory) WatchVms(ctx context.Context, key string, labelSelector labe
 	return i.vmStore.Watch(ctx, key, labelSelector, fieldSelector)
 }
 
+// isVmRecreated returns true if the cached and discovered vms have the same name, but different immutable cloud IDs.
+// The vm cache stays keyed by vm object name, which is derived from the Azure resource ID, hence from the VM name, so
+// that vm object names remain stable; a recreated vm is detected by its immutable cloud ID label instead.
+func isVmRecreated(cached, discovered *runtimev1alpha1.VirtualMachine) bool {
+	cachedUID, discoveredUID := cached.Labels[nephelabels.CloudVmUID], discovered.Labels[nephelabels.CloudVmUID]
+	return cachedUID != "" && discoveredUID != "" && cachedUID != discoveredUID
+}
+
 // compareVirtualMachineObjects compare if two virtual machine objects are the same. Return true if same.
 func (i *Inventory) compareVirtualMachineObjects(cached, discovered runtimev1alpha1.VirtualMachineStatus) bool {
 	// 1. Check if objects are same.
@@ -278,6 +278,38 @@ var _ = Describe("Validate VPC and Virtual Machine Inventory", func() {
 			Expect(exist).Should(BeTrue())
 			Expect(vm.Status.State).To(Equal(runtimev1alpha1.Stopped))
 		})
+		It("Replace a VM recreated with the same name and a new cloud ID", func() {
+			cloudInventory.BuildVmCache(vmList, &namespacedAccountName, &selectorNamespacedName)
+			var addedVms []*runtimev1alpha1.VirtualMachine
+			cloudInventory.AddVmAddHandler(func(vm *runtimev1alpha1.VirtualMachine) {
+				addedVms = append(addedVms, vm)
+			})
+
+			recreatedLabels := make(map[string]string)
+			for k, v := range vmLabelsMap {
+				recreatedLabels[k] = v
+			}
+			recreatedLabels[labels.CloudVmUID] = testVmID02
+			vmListRecreated := make(map[string]*runtimev1alpha1.VirtualMachine)
+			vmObjRecreated := new(runtimev1alpha1.VirtualMachine)
+			vmObjRecreated.Name = testVmID01
+			vmObjRecreated.Namespace = selectorNS
+			vmObjRecreated.Labels = recreatedLabels
+			vmObjRecreated.Status = *vmStatus
+			vmListRecreated[testVmID01] = vmObjRecreated
+			cloudInventory.BuildVmCache(vmListRecreated, &namespacedAccountName, &selectorNamespacedName)
+
+			// Vm object should be replaced by the recreated vm, and reported as newly added.
+			vm, exist := cloudInventory.GetVmByKey(vmCacheKey1)
+			Expect(exist).Should(BeTrue())
+			Expect(vm.Labels[labels.CloudVmUID]).To(Equal(testVmID02))
+			Expect(addedVms).Should(HaveLen(1))
+			Expect(addedVms[0].Labels[labels.CloudVmUID]).To(Equal(testVmID02))
+
+			// Polling the same vm again should not replace it.
+			cloudInventory.BuildVmCache(vmListRecreated, &namespacedAccountName, &selectorNamespacedName)
+			Expect(addedVms).Should(HaveLen(1))
+		})
 		It("Delete VM inventory", func() {
 			cloudInventory.BuildVmCache(vmList, &namespacedAccountName, &selectorNamespacedName)
 
@@ -41,3 +41,31 @@ const (
 	CloudVpcUID            = LabelPrefixNephe + "cloud-vpc-uid"
 	CloudVmUID             = LabelPrefixNephe + "cloud-vm-uid"
 )
+
+// TagLabelKeys maps cloud tag keys to custom ExternalEntity label keys, the values of those tags are additionally
+// labeled with.
+var TagLabelKeys map[string]string
+
+func SetTagLabelKeys(tagLabelKeys map[string]string) {
+	TagLabelKeys = tagLabelKeys
+}
+
+// TruncationStrategy specifies how label values exceeding the label value size limit are shortened.
+type TruncationStrategy string
+
+const (
+	// TruncationStrategyNone leaves label values as is, over-length tag values are not imported.
+	TruncationStrategyNone TruncationStrategy = ""
+	// TruncationStrategyTruncate cuts label values at the size limit.
+	TruncationStrategyTruncate TruncationStrategy = "truncate"
+	// TruncationStrategyHashSuffix cuts label values short of the size limit and appends a hash of the full value,
+	// keeping values sharing a long common prefix distinct.
+	TruncationStrategyHashSuffix TruncationStrategy = "hash-suffix"
+)
+
+// ValueTruncationStrategy is the strategy applied to over-length label values.
+var ValueTruncationStrategy = TruncationStrategyNone
+
+func SetValueTruncationStrategy(strategy TruncationStrategy) {
+	ValueTruncationStrategy = strategy
+}
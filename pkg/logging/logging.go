@@ -16,6 +16,9 @@ package logging
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/go-logr/logr"
@@ -26,10 +29,25 @@ import (
 
 type Logger = logr.Logger
 
+const (
+	// LogVerbosityEnvKey is the environment variable carrying per logger verbosity overrides, in the form of
+	// comma separated name=verbosity pairs, e.g. "azure-plugin=4,aws-plugin=2". It is read once, when the first
+	// logger is created, invalid pairs are ignored. Overrides are changed at runtime by SetLogVerbosity,
+	// ResetLogVerbosity and SetLogVerbosityOverrides.
+	LogVerbosityEnvKey = "NEPHE_LOG_VERBOSITY"
+)
+
+type loggerEntry struct {
+	name   string
+	logger Logger
+	level  zap2.AtomicLevel
+}
+
 var (
-	mutex    sync.Mutex
-	debugLog = false
-	loggers  = make(map[string]Logger)
+	mutex     sync.Mutex
+	debugLog  = false
+	loggers   = make(map[string]*loggerEntry)
+	verbosity map[string]int
 )
 
 func GetLogger(name string) Logger {
@@ -38,24 +56,134 @@ func GetLogger(name string) Logger {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	logger, found := loggers[key]
+	entry, found := loggers[key]
 	if !found {
+		entry = &loggerEntry{name: name, level: zap2.NewAtomicLevelAt(defaultLevel(debugLog))}
+		if v, ok := getVerbosityOverrides()[name]; ok {
+			entry.level.SetLevel(verbosityToLevel(v))
+		}
 		if debugLog {
-			logger = zap.New(UseDevMode()).WithName(name)
+			entry.logger = zap.New(UseDevMode(), useLevel(entry.level)).WithName(name)
 		} else {
-			logger = zap.New(UseProdMode()).WithName(name)
+			entry.logger = zap.New(UseProdMode(), useLevel(entry.level)).WithName(name)
 		}
-		loggers[key] = logger
-		return logger
+		loggers[key] = entry
 	}
 
-	return logger
+	return entry.logger
 }
 
 func SetDebugLog(enableDebugLog bool) {
 	debugLog = enableDebugLog
 }
 
+// SetLogVerbosity overrides the verbosity of logger name at runtime, so that V(verbosity) and lower level logs are
+// emitted. It applies to loggers already handed out by GetLogger as well as those created later.
+func SetLogVerbosity(name string, v int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	getVerbosityOverrides()[name] = v
+	for _, entry := range loggers {
+		if entry.name == name {
+			entry.level.SetLevel(verbosityToLevel(v))
+		}
+	}
+}
+
+// ResetLogVerbosity removes the verbosity override of logger name, restoring the default verbosity.
+func ResetLogVerbosity(name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(getVerbosityOverrides(), name)
+	for key, entry := range loggers {
+		if entry.name == name {
+			entry.level.SetLevel(defaultLevel(strings.HasSuffix(key, "-debug=true")))
+		}
+	}
+}
+
+// SetLogVerbosityOverrides replaces the verbosity overrides of all loggers at runtime, with overrides in the format
+// of LogVerbosityEnvKey. Loggers without an override are restored to the default verbosity. Overrides are left
+// unchanged if any of them is invalid.
+func SetLogVerbosityOverrides(overrides string) error {
+	parsed, err := parseVerbosityOverrides(overrides)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	verbosity = parsed
+	for key, entry := range loggers {
+		if v, ok := verbosity[entry.name]; ok {
+			entry.level.SetLevel(verbosityToLevel(v))
+		} else {
+			entry.level.SetLevel(defaultLevel(strings.HasSuffix(key, "-debug=true")))
+		}
+	}
+	return nil
+}
+
+// getVerbosityOverrides returns the verbosity overrides, initializing them from LogVerbosityEnvKey on first use.
+// Invalid overrides in LogVerbosityEnvKey are ignored. Must be called with mutex held.
+func getVerbosityOverrides() map[string]int {
+	if verbosity != nil {
+		return verbosity
+	}
+	verbosity, _ = parseVerbosityOverrides(os.Getenv(LogVerbosityEnvKey))
+	return verbosity
+}
+
+// parseVerbosityOverrides parses comma separated name=verbosity pairs, verbosity being a non-negative integer. It
+// returns the valid overrides along with an error for the first invalid one.
+func parseVerbosityOverrides(overrides string) (map[string]int, error) {
+	parsed := make(map[string]int)
+	var parseErr error
+	for _, pair := range strings.Split(overrides, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		tokens := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(tokens) != 2 || strings.TrimSpace(tokens[0]) == "" {
+			if parseErr == nil {
+				parseErr = fmt.Errorf("invalid verbosity override %q, expected name=verbosity", pair)
+			}
+			continue
+		}
+		name := strings.TrimSpace(tokens[0])
+		v, err := strconv.Atoi(strings.TrimSpace(tokens[1]))
+		if err != nil || v < 0 {
+			if parseErr == nil {
+				parseErr = fmt.Errorf("invalid verbosity %q of logger %s, expected a non-negative integer", tokens[1], name)
+			}
+			continue
+		}
+		parsed[name] = v
+	}
+	return parsed, parseErr
+}
+
+func defaultLevel(debug bool) zapcore.Level {
+	if debug {
+		return zapcore.DebugLevel
+	}
+	return zapcore.InfoLevel
+}
+
+// verbosityToLevel converts logr verbosity to zap level, logr V(n) is logged at zap level -n.
+func verbosityToLevel(v int) zapcore.Level {
+	return zapcore.Level(-v)
+}
+
+func useLevel(level zap2.AtomicLevel) zap.Opts {
+	return func(o *zap.Options) {
+		o.Level = level
+	}
+}
+
 func UseDevMode() zap.Opts {
 	return func(o *zap.Options) {
 		o.Development = true
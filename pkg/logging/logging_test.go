@@ -0,0 +1,67 @@
+// Copyright 2023 Antrea Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogVerbosity(t *testing.T) {
+	defer ResetLogVerbosity("azure-plugin")
+	azureLogger := GetLogger("azure-plugin")
+	awsLogger := GetLogger("aws-plugin")
+	assert.False(t, azureLogger.V(4).Enabled())
+
+	SetLogVerbosity("azure-plugin", 4)
+	assert.True(t, azureLogger.V(4).Enabled())
+	assert.False(t, azureLogger.V(5).Enabled())
+	assert.False(t, awsLogger.V(4).Enabled())
+	assert.True(t, GetLogger("azure-plugin").V(4).Enabled())
+
+	ResetLogVerbosity("azure-plugin")
+	assert.False(t, azureLogger.V(4).Enabled())
+}
+
+func TestLogVerbosityOverrides(t *testing.T) {
+	defer func() {
+		assert.NoError(t, SetLogVerbosityOverrides(""))
+	}()
+	azureLogger := GetLogger("azure-plugin")
+	awsLogger := GetLogger("aws-plugin")
+
+	assert.NoError(t, SetLogVerbosityOverrides("azure-plugin=4, aws-plugin=2"))
+	assert.True(t, azureLogger.V(4).Enabled())
+	assert.True(t, awsLogger.V(2).Enabled())
+	assert.False(t, awsLogger.V(3).Enabled())
+
+	// overrides are replaced, restoring the default verbosity of loggers left out.
+	assert.NoError(t, SetLogVerbosityOverrides("aws-plugin=3"))
+	assert.False(t, azureLogger.V(1).Enabled())
+	assert.True(t, awsLogger.V(3).Enabled())
+
+	// invalid overrides are rejected and leave the overrides unchanged.
+	for _, overrides := range []string{"azure-plugin", "azure-plugin=-1", "azure-plugin=high", "=4"} {
+		assert.Error(t, SetLogVerbosityOverrides(overrides), overrides)
+	}
+	assert.True(t, awsLogger.V(3).Enabled())
+}
+
+func TestParseVerbosityOverrides(t *testing.T) {
+	parsed, err := parseVerbosityOverrides("azure-plugin=4,aws-plugin=high, controller = 1")
+	assert.Error(t, err)
+	assert.Equal(t, map[string]int{"azure-plugin": 4, "controller": 1}, parsed)
+}
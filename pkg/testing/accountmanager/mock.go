@@ -81,6 +81,18 @@ func (mr *MockInterfaceMockRecorder) AddResourceFiltersToAccount(arg0, arg1, arg
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddResourceFiltersToAccount", reflect.TypeOf((*MockInterface)(nil).AddResourceFiltersToAccount), arg0, arg1, arg2, arg3)
 }
 
+// InvalidateAccount mocks base method.
+func (m *MockInterface) InvalidateAccount(arg0 *types.NamespacedName) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "InvalidateAccount", arg0)
+}
+
+// InvalidateAccount indicates an expected call of InvalidateAccount.
+func (mr *MockInterfaceMockRecorder) InvalidateAccount(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateAccount", reflect.TypeOf((*MockInterface)(nil).InvalidateAccount), arg0)
+}
+
 // IsAccountCredentialsValid mocks base method.
 func (m *MockInterface) IsAccountCredentialsValid(arg0 *types.NamespacedName) bool {
 	m.ctrl.T.Helper()
@@ -21,6 +21,7 @@ package cloud
 
 import (
 	reflect "reflect"
+	time "time"
 
 	v1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
 	v1alpha10 "antrea.io/nephe/apis/runtime/v1alpha1"
@@ -169,6 +170,81 @@ func (mr *MockCloudInterfaceMockRecorder) GetEnforcedSecurity() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEnforcedSecurity", reflect.TypeOf((*MockCloudInterface)(nil).GetEnforcedSecurity))
 }
 
+// GetMatchingSelectors mocks base method.
+func (m *MockCloudInterface) GetMatchingSelectors(arg0 *types0.NamespacedName, arg1 string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMatchingSelectors", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMatchingSelectors indicates an expected call of GetMatchingSelectors.
+func (mr *MockCloudInterfaceMockRecorder) GetMatchingSelectors(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMatchingSelectors", reflect.TypeOf((*MockCloudInterface)(nil).GetMatchingSelectors), arg0, arg1)
+}
+
+// GetSelectorCloudInventory mocks base method.
+func (m *MockCloudInterface) GetSelectorCloudInventory(arg0, arg1 *types0.NamespacedName) (*types.CloudInventory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSelectorCloudInventory", arg0, arg1)
+	ret0, _ := ret[0].(*types.CloudInventory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSelectorCloudInventory indicates an expected call of GetSelectorCloudInventory.
+func (mr *MockCloudInterfaceMockRecorder) GetSelectorCloudInventory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSelectorCloudInventory", reflect.TypeOf((*MockCloudInterface)(nil).GetSelectorCloudInventory), arg0, arg1)
+}
+
+// GetSnapshotFootprint mocks base method.
+func (m *MockCloudInterface) GetSnapshotFootprint(arg0 *types0.NamespacedName) (*types.SnapshotFootprint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSnapshotFootprint", arg0)
+	ret0, _ := ret[0].(*types.SnapshotFootprint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSnapshotFootprint indicates an expected call of GetSnapshotFootprint.
+func (mr *MockCloudInterfaceMockRecorder) GetSnapshotFootprint(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshotFootprint", reflect.TypeOf((*MockCloudInterface)(nil).GetSnapshotFootprint), arg0)
+}
+
+// GetVpcPeerings mocks base method.
+func (m *MockCloudInterface) GetVpcPeerings(arg0 *types0.NamespacedName) ([]types.VpcPeering, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVpcPeerings", arg0)
+	ret0, _ := ret[0].([]types.VpcPeering)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVpcPeerings indicates an expected call of GetVpcPeerings.
+func (mr *MockCloudInterfaceMockRecorder) GetVpcPeerings(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVpcPeerings", reflect.TypeOf((*MockCloudInterface)(nil).GetVpcPeerings), arg0)
+}
+
+// PreviewSelector mocks base method.
+func (m *MockCloudInterface) PreviewSelector(arg0 *types0.NamespacedName, arg1 *v1alpha1.CloudEntitySelector) ([]*v1alpha10.VirtualMachine, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreviewSelector", arg0, arg1)
+	ret0, _ := ret[0].([]*v1alpha10.VirtualMachine)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreviewSelector indicates an expected call of PreviewSelector.
+func (mr *MockCloudInterfaceMockRecorder) PreviewSelector(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreviewSelector", reflect.TypeOf((*MockCloudInterface)(nil).PreviewSelector), arg0, arg1)
+}
+
 // ProviderType mocks base method.
 func (m *MockCloudInterface) ProviderType() v1alpha10.CloudProvider {
 	m.ctrl.T.Helper()
@@ -183,6 +259,20 @@ func (mr *MockCloudInterfaceMockRecorder) ProviderType() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProviderType", reflect.TypeOf((*MockCloudInterface)(nil).ProviderType))
 }
 
+// RefreshVpc mocks base method.
+func (m *MockCloudInterface) RefreshVpc(arg0 *types0.NamespacedName, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshVpc", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefreshVpc indicates an expected call of RefreshVpc.
+func (mr *MockCloudInterfaceMockRecorder) RefreshVpc(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshVpc", reflect.TypeOf((*MockCloudInterface)(nil).RefreshVpc), arg0, arg1)
+}
+
 // RemoveAccountResourcesSelector mocks base method.
 func (m *MockCloudInterface) RemoveAccountResourcesSelector(arg0, arg1 *types0.NamespacedName) {
 	m.ctrl.T.Helper()
@@ -221,6 +311,68 @@ func (mr *MockCloudInterfaceMockRecorder) ResetInventoryCache(arg0 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetInventoryCache", reflect.TypeOf((*MockCloudInterface)(nil).ResetInventoryCache), arg0)
 }
 
+// SetAccountResumedHook mocks base method.
+func (m *MockCloudInterface) SetAccountResumedHook(arg0 func(*types0.NamespacedName)) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetAccountResumedHook", arg0)
+}
+
+// SetAccountResumedHook indicates an expected call of SetAccountResumedHook.
+func (mr *MockCloudInterfaceMockRecorder) SetAccountResumedHook(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAccountResumedHook", reflect.TypeOf((*MockCloudInterface)(nil).SetAccountResumedHook), arg0)
+}
+
+// SetCredentialRotationHook mocks base method.
+func (m *MockCloudInterface) SetCredentialRotationHook(arg0 func(*types0.NamespacedName)) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetCredentialRotationHook", arg0)
+}
+
+// SetCredentialRotationHook indicates an expected call of SetCredentialRotationHook.
+func (mr *MockCloudInterfaceMockRecorder) SetCredentialRotationHook(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCredentialRotationHook", reflect.TypeOf((*MockCloudInterface)(nil).SetCredentialRotationHook), arg0)
+}
+
+// SetSecurityOptionsChangedHook mocks base method.
+func (m *MockCloudInterface) SetSecurityOptionsChangedHook(arg0 func(*types0.NamespacedName)) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetSecurityOptionsChangedHook", arg0)
+}
+
+// SetSecurityOptionsChangedHook indicates an expected call of SetSecurityOptionsChangedHook.
+func (mr *MockCloudInterfaceMockRecorder) SetSecurityOptionsChangedHook(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSecurityOptionsChangedHook", reflect.TypeOf((*MockCloudInterface)(nil).SetSecurityOptionsChangedHook), arg0)
+}
+
+// SetVpcDeletedHook mocks base method.
+func (m *MockCloudInterface) SetVpcDeletedHook(arg0 func(*types0.NamespacedName)) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetVpcDeletedHook", arg0)
+}
+
+// SetVpcDeletedHook indicates an expected call of SetVpcDeletedHook.
+func (mr *MockCloudInterfaceMockRecorder) SetVpcDeletedHook(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVpcDeletedHook", reflect.TypeOf((*MockCloudInterface)(nil).SetVpcDeletedHook), arg0)
+}
+
+// Shutdown mocks base method.
+func (m *MockCloudInterface) Shutdown(arg0 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shutdown", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockCloudInterfaceMockRecorder) Shutdown(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockCloudInterface)(nil).Shutdown), arg0)
+}
+
 // UpdateSecurityGroupMembers mocks base method.
 func (m *MockCloudInterface) UpdateSecurityGroupMembers(arg0 *cloudresource.CloudResource, arg1 []*cloudresource.CloudResource, arg2 bool) error {
 	m.ctrl.T.Helper()
@@ -248,3 +400,17 @@ func (mr *MockCloudInterfaceMockRecorder) UpdateSecurityGroupRules(arg0, arg1, a
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSecurityGroupRules", reflect.TypeOf((*MockCloudInterface)(nil).UpdateSecurityGroupRules), arg0, arg1, arg2)
 }
+
+// UpdateSecurityGroupRulesBatch mocks base method.
+func (m *MockCloudInterface) UpdateSecurityGroupRulesBatch(arg0 []cloudresource.GroupRuleUpdate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSecurityGroupRulesBatch", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSecurityGroupRulesBatch indicates an expected call of UpdateSecurityGroupRulesBatch.
+func (mr *MockCloudInterfaceMockRecorder) UpdateSecurityGroupRulesBatch(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSecurityGroupRulesBatch", reflect.TypeOf((*MockCloudInterface)(nil).UpdateSecurityGroupRulesBatch), arg0)
+}
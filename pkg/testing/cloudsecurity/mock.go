@@ -118,3 +118,17 @@ func (mr *MockCloudSecurityGroupInterfaceMockRecorder) UpdateSecurityGroupRules(
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSecurityGroupRules", reflect.TypeOf((*MockCloudSecurityGroupInterface)(nil).UpdateSecurityGroupRules), arg0, arg1, arg2)
 }
+
+// UpdateSecurityGroupRulesBatch mocks base method.
+func (m *MockCloudSecurityGroupInterface) UpdateSecurityGroupRulesBatch(arg0 []cloudresource.GroupRuleUpdate) <-chan error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSecurityGroupRulesBatch", arg0)
+	ret0, _ := ret[0].(<-chan error)
+	return ret0
+}
+
+// UpdateSecurityGroupRulesBatch indicates an expected call of UpdateSecurityGroupRulesBatch.
+func (mr *MockCloudSecurityGroupInterfaceMockRecorder) UpdateSecurityGroupRulesBatch(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSecurityGroupRulesBatch", reflect.TypeOf((*MockCloudSecurityGroupInterface)(nil).UpdateSecurityGroupRulesBatch), arg0)
+}
@@ -54,6 +54,18 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// AddVmAddHandler mocks base method.
+func (m *MockInterface) AddVmAddHandler(arg0 func(*v1alpha1.VirtualMachine)) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "AddVmAddHandler", arg0)
+}
+
+// AddVmAddHandler indicates an expected call of AddVmAddHandler.
+func (mr *MockInterfaceMockRecorder) AddVmAddHandler(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddVmAddHandler", reflect.TypeOf((*MockInterface)(nil).AddVmAddHandler), arg0)
+}
+
 // BuildVmCache mocks base method.
 func (m *MockInterface) BuildVmCache(arg0 map[string]*v1alpha1.VirtualMachine, arg1, arg2 *types.NamespacedName) {
 	m.ctrl.T.Helper()
@@ -26,3 +26,30 @@ type CloudInventory struct {
 	// VpcMap holds VPC objects.
 	VpcMap map[string]*runtimev1alpha1.Vpc
 }
+
+// SnapshotFootprint is the approximate memory footprint of the inventory cache snapshot of an account.
+type SnapshotFootprint struct {
+	VMs      int
+	Vpcs     int
+	VpcPeers int
+	// Bytes is an estimate of the memory held by the snapshot resources.
+	Bytes int64
+	// HistorySnapshots is the number of previous snapshots kept in the snapshot history.
+	HistorySnapshots int
+	// HistoryBytes is an estimate of the memory held by the previous snapshots kept in the snapshot history.
+	HistoryBytes int64
+}
+
+// VpcPeering is a peering of a VPC with a remote VPC, as seen from the VPC the peering belongs to.
+type VpcPeering struct {
+	// AccepterID is the ID of the VPC the peering belongs to.
+	AccepterID string
+	// RequesterID is the ID of the remote VPC of the peering.
+	RequesterID string
+	// SourceCIDR is the first address prefix of the accepter VPC.
+	SourceCIDR string
+	// DestinationCIDR is the first address prefix of the requester VPC.
+	DestinationCIDR string
+	// State is the state of the peering reported by the cloud, e.g. Connected in Azure or active in AWS.
+	State string
+}
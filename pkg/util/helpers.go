@@ -15,6 +15,7 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 
 	crdv1alpha1 "antrea.io/nephe/apis/crd/v1alpha1"
@@ -24,6 +25,9 @@ import (
 var (
 	ErrorMsgUnknownCloudProvider = "missing cloud provider config. Please add AWS or Azure Config"
 	ErrorMsgSecretReference      = "error fetching Secret reference"
+	ErrorMsgMissingCredential    = "must specify either credentials or role arn, cannot both be empty"
+	// ErrSecretReference is wrapped by the errors of account credentials which could not be read from their Secret.
+	ErrSecretReference = errors.New(ErrorMsgSecretReference)
 )
 
 // GetVMIPAddresses returns IP addresses of all network interfaces attached to the vm.
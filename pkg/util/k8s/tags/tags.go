@@ -15,7 +15,10 @@
 package tags
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"regexp"
+	"strings"
 
 	"antrea.io/nephe/pkg/labels"
 )
@@ -23,6 +26,8 @@ import (
 const (
 	LabelSizeLimit    = 63
 	TagCharacterClass = `^[a-zA-Z0-9][\.\-a-zA-Z0-9_]*[a-zA-Z0-9]$`
+	// labelHashSuffixLength is the number of hex characters of the value hash appended by the hash-suffix strategy.
+	labelHashSuffixLength = 8
 )
 
 // ImportTags function returns tags which comply with kubernetes labels format.
@@ -43,7 +48,7 @@ func ImportTags(tags map[string]string) map[string]string {
 			continue
 		}
 
-		if len(value) > LabelSizeLimit {
+		if len(value) > LabelSizeLimit && labels.ValueTruncationStrategy == labels.TruncationStrategyNone {
 			continue
 		}
 		if len(value) > 0 {
@@ -52,8 +57,31 @@ func ImportTags(tags map[string]string) map[string]string {
 			}
 		}
 
-		importedTags[key] = value
+		importedTags[key] = TruncateLabelValue(value, labels.ValueTruncationStrategy)
 	}
 
 	return importedTags
 }
+
+// TruncateLabelValue returns value shortened to LabelSizeLimit characters using strategy, value is returned as is when
+// it is within the limit or strategy is none. Trailing characters that may not end a label value are trimmed.
+func TruncateLabelValue(value string, strategy labels.TruncationStrategy) string {
+	if len(value) <= LabelSizeLimit {
+		return value
+	}
+	switch strategy {
+	case labels.TruncationStrategyTruncate:
+		return trimLabelValue(value[:LabelSizeLimit])
+	case labels.TruncationStrategyHashSuffix:
+		hash := sha256.Sum256([]byte(value))
+		suffix := hex.EncodeToString(hash[:])[:labelHashSuffixLength]
+		return trimLabelValue(value[:LabelSizeLimit-labelHashSuffixLength-1]) + "-" + suffix
+	default:
+		return value
+	}
+}
+
+// trimLabelValue removes the trailing characters of value which are not alphanumeric.
+func trimLabelValue(value string) string {
+	return strings.TrimRight(value, "-_.")
+}
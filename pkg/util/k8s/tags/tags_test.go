@@ -19,6 +19,8 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	"antrea.io/nephe/pkg/labels"
 )
 
 func TestTags(t *testing.T) {
@@ -70,4 +72,42 @@ var _ = Describe("Import Tags", func() {
 			Expect(importedTags).Should(HaveLen(len(tags)))
 		})
 	})
+
+	Context("Truncate label values", func() {
+		var (
+			// Over-length values sharing the first 63 characters, the character at the limit is a dash.
+			value01 = "aaaaaaaaaaAAAAAAAAAA0000000000bbbbbbbbbbBBBBBBBBBB111111111122-2value01"
+			value02 = "aaaaaaaaaaAAAAAAAAAA0000000000bbbbbbbbbbBBBBBBBBBB111111111122-2value02"
+			key     = "key01"
+		)
+		AfterEach(func() {
+			labels.SetValueTruncationStrategy(labels.TruncationStrategyNone)
+		})
+		It("Over-length value is kept as is without a truncation strategy", func() {
+			Expect(TruncateLabelValue(value01, labels.TruncationStrategyNone)).To(Equal(value01))
+		})
+		It("Over-length value is truncated at the size limit", func() {
+			truncated01 := TruncateLabelValue(value01, labels.TruncationStrategyTruncate)
+			Expect(truncated01).To(Equal(value01[:LabelSizeLimit-1]))
+			Expect(TruncateLabelValue(value02, labels.TruncationStrategyTruncate)).To(Equal(truncated01))
+		})
+		It("Over-length value is truncated with a hash suffix", func() {
+			truncated01 := TruncateLabelValue(value01, labels.TruncationStrategyHashSuffix)
+			truncated02 := TruncateLabelValue(value02, labels.TruncationStrategyHashSuffix)
+			Expect(len(truncated01)).To(BeNumerically("<=", LabelSizeLimit))
+			Expect(truncated01).To(HavePrefix(value01[:LabelSizeLimit-labelHashSuffixLength-1] + "-"))
+			Expect(truncated01).To(MatchRegexp(TagCharacterClass))
+			Expect(truncated01).NotTo(Equal(truncated02))
+			Expect(TruncateLabelValue(value01, labels.TruncationStrategyHashSuffix)).To(Equal(truncated01))
+		})
+		It("Value within the size limit is not truncated", func() {
+			Expect(TruncateLabelValue(key, labels.TruncationStrategyHashSuffix)).To(Equal(key))
+		})
+		It("Over-length tag value is imported truncated with a truncation strategy", func() {
+			labels.SetValueTruncationStrategy(labels.TruncationStrategyHashSuffix)
+			importedTags := ImportTags(map[string]string{key: value01})
+			Expect(importedTags).To(Equal(map[string]string{
+				key: TruncateLabelValue(value01, labels.TruncationStrategyHashSuffix)}))
+		})
+	})
 })